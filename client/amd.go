@@ -0,0 +1,60 @@
+package client
+
+import (
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// StartAMD starts answering machine detection on the given channel.  The
+// classification is reported to the channel's subscribers by a
+// proxy.AMDFinished event.
+func (c *Client) StartAMD(key *ari.Key, opts *proxy.ChannelAMD) error {
+	return c.commandRequest(&proxy.Request{
+		Kind:       "ChannelAMD",
+		Key:        key,
+		ChannelAMD: opts,
+	})
+}
+
+// DetectAnsweringMachine runs answering machine detection on the given
+// channel and waits for its classification.  If detection failed, the
+// (NOTSURE) result is returned along with the error.
+func (c *Client) DetectAnsweringMachine(key *ari.Key, opts *proxy.ChannelAMD) (*proxy.AMDResult, error) {
+	timeout := 30 * time.Second
+	if opts != nil && opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	// Subscribe before starting, so that the result is not missed
+	sub := c.Bus().Subscribe(key, proxy.EventAMDFinished)
+	defer sub.Cancel()
+
+	if err := c.StartAMD(key, opts); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTimer(timeout + c.requestTimeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			return nil, eris.New("timed out waiting for AMD result")
+		case e, ok := <-sub.Events():
+			if !ok {
+				return nil, eris.New("subscription closed")
+			}
+			v, ok := e.(*proxy.AMDFinished)
+			if !ok || v.ChannelID != key.ID {
+				continue
+			}
+			if v.Error != "" {
+				return &v.AMDResult, eris.New(v.Error)
+			}
+			return &v.AMDResult, nil
+		}
+	}
+}
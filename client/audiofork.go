@@ -0,0 +1,52 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// StartAudioFork starts streaming the live audio of the given channel.  The
+// returned key identifies the audio fork, for use with StopAudioFork, and the
+// returned data describes the NATS subject (see SubscribeAudio) and, if
+// enabled, the WebSocket URL from which the audio may be consumed.
+func (c *Client) StartAudioFork(key *ari.Key, opts *proxy.AudioFork) (*ari.Key, *proxy.AudioForkData, error) {
+	resp, err := c.makeRequest("create", &proxy.Request{
+		Kind:      "AudioForkStart",
+		Key:       key,
+		AudioFork: opts,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = resp.Err(); err != nil {
+		return nil, nil, err
+	}
+	if resp.Data == nil || resp.Data.AudioFork == nil {
+		return nil, nil, eris.New("no audio fork in response")
+	}
+	return resp.Key, resp.Data.AudioFork, nil
+}
+
+// StopAudioFork stops the given audio fork
+func (c *Client) StopAudioFork(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "AudioForkStop",
+		Key:  key,
+	})
+}
+
+// SubscribeAudio calls the handler with each audio frame of the given audio
+// fork, until the returned cancel function is called
+func (c *Client) SubscribeAudio(fork *proxy.AudioForkData, handler func(frame []byte)) (cancel func(), err error) {
+	sub, err := c.nc.Conn.Subscribe(fork.Subject, func(m *nats.Msg) {
+		handler(m.Data)
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to audio")
+	}
+	return func() {
+		sub.Unsubscribe() // nolint: errcheck
+	}, nil
+}
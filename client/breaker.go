@@ -0,0 +1,227 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// ErrNodeUnavailable indicates that a request addressed to a node was not
+// made, because the circuit breaker has stopped routing requests to the node
+var ErrNodeUnavailable = eris.New("node unavailable: too many failed requests")
+
+// Defaults of the CircuitBreakerConfig
+var (
+	DefaultBreakerWindow       = 30 * time.Second
+	DefaultBreakerMinRequests  = 5
+	DefaultBreakerFailureRatio = 0.5
+	DefaultBreakerCooldown     = 10 * time.Second
+)
+
+// CircuitBreakerConfig describes when the client stops routing requests to a
+// node.  A request fails, for the purpose of the breaker, if it times out or
+// cannot be delivered; error responses from the node (such as a channel not
+// being found) count as successes.  Any zero field takes its default.
+type CircuitBreakerConfig struct {
+	// Window is the period over which the failure rate of a node is measured.
+	// It defaults to DefaultBreakerWindow.
+	Window time.Duration
+
+	// MinRequests is the number of requests which must be made to a node
+	// within a window before the node may be blacklisted.  It defaults to
+	// DefaultBreakerMinRequests.
+	MinRequests int
+
+	// FailureRatio is the fraction of the requests to a node within a window
+	// which must fail for the node to be blacklisted.  It defaults to
+	// DefaultBreakerFailureRatio.
+	FailureRatio float64
+
+	// Cooldown is the time for which a node is blacklisted before it is
+	// probed with a ping.  The node is reinstated once it answers the ping
+	// with an announcement.  It defaults to DefaultBreakerCooldown.
+	Cooldown time.Duration
+}
+
+func (cfg CircuitBreakerConfig) validate() error {
+	if cfg.Window < 0 {
+		return eris.New("circuit breaker window may not be negative")
+	}
+	if cfg.MinRequests < 0 {
+		return eris.New("circuit breaker minimum requests may not be negative")
+	}
+	if cfg.FailureRatio < 0 || cfg.FailureRatio > 1 {
+		return eris.New("circuit breaker failure ratio must be between 0 and 1")
+	}
+	if cfg.Cooldown < 0 {
+		return eris.New("circuit breaker cooldown may not be negative")
+	}
+	return nil
+}
+
+func (cfg CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if cfg.Window == 0 {
+		cfg.Window = DefaultBreakerWindow
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = DefaultBreakerMinRequests
+	}
+	if cfg.FailureRatio == 0 {
+		cfg.FailureRatio = DefaultBreakerFailureRatio
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = DefaultBreakerCooldown
+	}
+	return cfg
+}
+
+// BlacklistedNode describes a node to which the circuit breaker has stopped
+// routing requests
+type BlacklistedNode struct {
+	// Application is the ARI application of the node
+	Application string
+
+	// Node is the Asterisk ID of the node
+	Node string
+
+	// Since is the time at which the node was blacklisted
+	Since time.Time
+
+	// Probing indicates that the cooldown has elapsed and the node has been
+	// pinged, but has not yet answered
+	Probing bool
+}
+
+// breakerNode is the state of the circuit of a node
+type breakerNode struct {
+	app, node string
+
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// open indicates that the node is blacklisted, since openedAt
+	open     bool
+	openedAt time.Time
+
+	// probing indicates that the node has been pinged, at probedAt, after
+	// its cooldown, and is reinstated by its next announcement
+	probing  bool
+	probedAt time.Time
+}
+
+// breaker tracks the failure rates of the nodes of the cluster, indexed by
+// application and node
+type breaker struct {
+	cfg   CircuitBreakerConfig
+	nodes map[string]*breakerNode
+
+	mu sync.Mutex
+}
+
+func newBreaker(cfg CircuitBreakerConfig) *breaker {
+	return &breaker{
+		cfg:   cfg.withDefaults(),
+		nodes: make(map[string]*breakerNode),
+	}
+}
+
+func breakerKey(app, node string) string {
+	return app + "/" + node
+}
+
+// allow indicates whether a request may be made to the given node.  If the
+// node is blacklisted and its cooldown has elapsed since it was blacklisted
+// or last probed, it is marked as being probed, and probe is returned so that
+// the caller pings the cluster.
+func (b *breaker) allow(app, node string, now time.Time) (ok bool, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, found := b.nodes[breakerKey(app, node)]
+	if !found || !n.open {
+		return true, false
+	}
+	if now.Sub(n.probedAt) >= b.cfg.Cooldown {
+		n.probing = true
+		n.probedAt = now
+		return false, true
+	}
+	return false, false
+}
+
+// record counts the outcome of a request to the given node, returning whether
+// it caused the node to be blacklisted
+func (b *breaker) record(app, node string, failed bool, now time.Time) (tripped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := breakerKey(app, node)
+	n, ok := b.nodes[key]
+	if !ok {
+		n = &breakerNode{app: app, node: node, windowStart: now}
+		b.nodes[key] = n
+	}
+	if n.open {
+		return false
+	}
+
+	if now.Sub(n.windowStart) >= b.cfg.Window {
+		n.windowStart = now
+		n.requests = 0
+		n.failures = 0
+	}
+	n.requests++
+	if failed {
+		n.failures++
+	}
+
+	if n.requests >= b.cfg.MinRequests && float64(n.failures) >= b.cfg.FailureRatio*float64(n.requests) {
+		n.open = true
+		n.openedAt = now
+		n.probedAt = now
+		return true
+	}
+	return false
+}
+
+// announced records the announcement of the given node, returning whether it
+// reinstated the node
+func (b *breaker) announced(app, node string, now time.Time) (reinstated bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, ok := b.nodes[breakerKey(app, node)]
+	if !ok || !n.open || !n.probing {
+		return false
+	}
+	*n = breakerNode{app: app, node: node, windowStart: now}
+	return true
+}
+
+// blacklisted returns the nodes which are blacklisted, ordered by application
+// and node
+func (b *breaker) blacklisted() (ret []BlacklistedNode) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, n := range b.nodes {
+		if n.open {
+			ret = append(ret, BlacklistedNode{
+				Application: n.app,
+				Node:        n.node,
+				Since:       n.openedAt,
+				Probing:     n.probing,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Application != ret[j].Application {
+			return ret[i].Application < ret[j].Application
+		}
+		return ret[i].Node < ret[j].Node
+	})
+	return ret
+}
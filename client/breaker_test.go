@@ -0,0 +1,80 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(CircuitBreakerConfig{
+		Window:       time.Minute,
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		Cooldown:     10 * time.Second,
+	})
+	now := time.Now()
+
+	// Failures below the minimum request count do not trip the breaker
+	for i := 0; i < 3; i++ {
+		if b.record("app", "a", true, now) {
+			t.Fatalf("tripped after %d requests", i+1)
+		}
+	}
+
+	// Other nodes are unaffected
+	for i := 0; i < 4; i++ {
+		b.record("app", "b", i == 0, now)
+	}
+
+	if !b.record("app", "a", false, now) {
+		t.Fatal("failed to trip at the failure ratio")
+	}
+	if ok, _ := b.allow("app", "a", now); ok {
+		t.Error("allowed request to blacklisted node")
+	}
+	if ok, _ := b.allow("app", "b", now); !ok {
+		t.Error("refused request to healthy node")
+	}
+	if list := b.blacklisted(); len(list) != 1 || list[0].Node != "a" || list[0].Probing {
+		t.Errorf("unexpected blacklist %+v", list)
+	}
+
+	// Announcements before the probe do not reinstate the node
+	if b.announced("app", "a", now.Add(time.Second)) {
+		t.Error("reinstated node before probe")
+	}
+
+	later := now.Add(10 * time.Second)
+	if ok, probe := b.allow("app", "a", later); ok || !probe {
+		t.Errorf("expected probe after cooldown, got ok=%v probe=%v", ok, probe)
+	}
+	if _, probe := b.allow("app", "a", later); probe {
+		t.Error("probed twice within cooldown")
+	}
+	if _, probe := b.allow("app", "a", later.Add(10*time.Second)); !probe {
+		t.Error("failed to probe again after unanswered probe")
+	}
+
+	if !b.announced("app", "a", later) {
+		t.Fatal("failed to reinstate probed node")
+	}
+	if ok, _ := b.allow("app", "a", later); !ok {
+		t.Error("refused request to reinstated node")
+	}
+	if len(b.blacklisted()) != 0 {
+		t.Error("reinstated node still blacklisted")
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b := newBreaker(CircuitBreakerConfig{Window: time.Minute, MinRequests: 2})
+	now := time.Now()
+
+	b.record("app", "a", true, now)
+	if b.record("app", "a", true, now.Add(time.Minute)) {
+		t.Error("counted failures of an expired window")
+	}
+	if !b.record("app", "a", true, now.Add(time.Minute+time.Second)) {
+		t.Error("failed to trip within the window")
+	}
+}
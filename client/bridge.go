@@ -1,6 +1,8 @@
 package client
 
 import (
+	"time"
+
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/CyCoreSystems/ari/v5/rid"
@@ -25,6 +27,55 @@ func (b *bridge) Create(key *ari.Key, btype, name string) (*ari.BridgeHandle, er
 	return ari.NewBridgeHandle(k, b, nil), nil
 }
 
+// EnsureBridge returns a handle to the bridge of the given key, creating the
+// bridge if it does not exist.  It fails if the bridge exists with a different
+// type (mixing or holding) from the one requested.
+func (c *Client) EnsureBridge(key *ari.Key, btype, name string) (*ari.BridgeHandle, error) {
+	k, err := c.createRequest(&proxy.Request{
+		Kind: "BridgeEnsure",
+		Key:  key,
+		BridgeCreate: &proxy.BridgeCreate{
+			Type: btype,
+			Name: name,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ari.NewBridgeHandle(k, c.Bridge(), nil), nil
+}
+
+// AssembleBridge creates a bridge and adds the given channels to it, in order,
+// as one operation.  If any channel cannot be added, the bridge is destroyed
+// and the error of the channel is returned.  The result of each channel is
+// returned, even on failure, when the bridge was created.
+func (c *Client) AssembleBridge(key *ari.Key, btype, name string, channels ...proxy.BridgeAddChannel) (*ari.BridgeHandle, *proxy.BridgeAssembly, error) {
+	resp, err := c.makeRequest("create", &proxy.Request{
+		Kind: "BridgeAssemble",
+		Key:  key,
+		BridgeAssemble: &proxy.BridgeAssemble{
+			Type:     btype,
+			Name:     name,
+			Channels: channels,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result *proxy.BridgeAssembly
+	if resp.Data != nil {
+		result = resp.Data.BridgeAssembly
+	}
+	if err = resp.Err(); err != nil {
+		return nil, result, err
+	}
+	if resp.Key == nil {
+		return nil, result, ErrNil
+	}
+	return ari.NewBridgeHandle(resp.Key, c.Bridge(), nil), result, nil
+}
+
 func (b *bridge) StageCreate(key *ari.Key, btype, name string) (*ari.BridgeHandle, error) {
 	k, err := b.c.createRequest(&proxy.Request{
 		Kind: "BridgeStageCreate",
@@ -63,6 +114,12 @@ func (b *bridge) List(filter *ari.Key) ([]*ari.Key, error) {
 }
 
 func (b *bridge) Data(key *ari.Key) (*ari.BridgeData, error) {
+	if b.c.cache != nil {
+		if d, ok := b.c.cache.bridge(key, time.Now()); ok {
+			return d, nil
+		}
+	}
+
 	resp, err := b.c.dataRequest(&proxy.Request{
 		Kind: "BridgeData",
 		Key:  key,
@@ -70,6 +127,9 @@ func (b *bridge) Data(key *ari.Key) (*ari.BridgeData, error) {
 	if err != nil {
 		return nil, err
 	}
+	if b.c.cache != nil {
+		b.c.cache.putBridge(resp.Bridge, time.Now())
+	}
 	return resp.Bridge, nil
 }
 
@@ -187,7 +247,7 @@ func (b *bridge) Record(key *ari.Key, name string, opts *ari.RecordingOptions) (
 	if err != nil {
 		return nil, err
 	}
-	return ari.NewLiveRecordingHandle(k.New(ari.LiveRecordingKey, name), b.c.LiveRecording(), nil), nil
+	return ari.NewLiveRecordingHandle(recordingKey(k, name), b.c.LiveRecording(), nil), nil
 }
 
 func (b *bridge) StageRecord(key *ari.Key, name string, opts *ari.RecordingOptions) (*ari.LiveRecordingHandle, error) {
@@ -210,8 +270,9 @@ func (b *bridge) StageRecord(key *ari.Key, name string, opts *ari.RecordingOptio
 		return nil, err
 	}
 
-	return ari.NewLiveRecordingHandle(k.New(ari.LiveRecordingKey, name), b.c.LiveRecording(), func(h *ari.LiveRecordingHandle) error {
-		_, err := b.Record(k.New(ari.BridgeKey, key.ID), name, opts)
+	rk := recordingKey(k, name)
+	return ari.NewLiveRecordingHandle(rk, b.c.LiveRecording(), func(h *ari.LiveRecordingHandle) error {
+		_, err := b.Record(k.New(ari.BridgeKey, key.ID), rk.ID, opts)
 		return err
 	}), nil
 }
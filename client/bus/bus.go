@@ -1,9 +1,9 @@
 package bus
 
 import (
-	"fmt"
 	"sync"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/inconshreveable/log15"
 
@@ -16,41 +16,84 @@ var EventChanBufferLength = 10
 
 // Bus provides an ari.Bus interface to NATS
 type Bus struct {
-	prefix string
+	subjects proxy.SubjectBuilder
 
 	log log15.Logger
 
 	nc *nats.EncodedConn
+
+	// mux is the optional multiplexer to which subscriptions are attached
+	mux *Mux
+
+	// typed indicates that subscriptions to particular event types subscribe
+	// to the per-type event subjects of those types
+	typed bool
 }
 
 // New returns a new Bus
 func New(prefix string, nc *nats.EncodedConn, log log15.Logger) *Bus {
+	return NewWithSubjects(proxy.NewSubjectBuilder(prefix), nc, log)
+}
+
+// NewWithSubjects returns a new Bus which constructs its NATS subjects with
+// the given SubjectBuilder
+func NewWithSubjects(subjects proxy.SubjectBuilder, nc *nats.EncodedConn, log log15.Logger) *Bus {
 	return &Bus{
-		prefix: prefix,
-		log:    log,
-		nc:     nc,
+		subjects: subjects,
+		log:      log,
+		nc:       nc,
 	}
 }
 
+// UseMux attaches the Bus's subscriptions to the NATS subscriptions of the
+// given Mux, wherever the Mux shares them
+func (b *Bus) UseMux(m *Mux) {
+	b.mux = m
+}
+
+// UseEventTypeSubjects makes the Bus subscribe to the per-type event subjects
+// of the event types of its subscriptions, to which the proxies publish their
+// events when configured to (see proxy.TypedEventSubjectBuilder).  It has no
+// effect if the SubjectBuilder of the Bus does not support per-type subjects.
+func (b *Bus) UseEventTypeSubjects() {
+	_, b.typed = b.subjects.(proxy.TypedEventSubjectBuilder)
+}
+
 func (b *Bus) subjectFromKey(key *ari.Key) string {
 	if key == nil {
-		return fmt.Sprintf("%sevent.>", b.prefix)
+		return b.subjects.Event("", "")
 	}
 
 	if key.Dialog != "" {
-		return fmt.Sprintf("%sdialogevent.%s", b.prefix, key.Dialog)
+		return b.subjects.DialogEvent(key.Dialog)
+	}
+
+	if b.typed && key.Node != "" {
+		// The event subject of a node does not match its per-type subjects
+		return b.subjects.(proxy.TypedEventSubjectBuilder).TypedEvent(key.App, key.Node, "")
 	}
+	return b.subjects.Event(key.App, key.Node)
+}
 
-	subj := fmt.Sprintf("%sevent.", b.prefix)
-	if key.App == "" {
-		return subj + ">"
+// subjectsFor returns the subjects of a subscription to the events of the
+// given types for the given key
+func (b *Bus) subjectsFor(key *ari.Key, types []string) []string {
+	if !b.typed || key == nil || key.Dialog != "" || len(types) == 0 {
+		return []string{b.subjectFromKey(key)}
 	}
-	subj += key.App + "."
 
-	if key.Node == "" {
-		return subj + ">"
+	var ret []string
+	seen := make(map[string]bool)
+	for _, typ := range types {
+		if typ == ari.Events.All {
+			return []string{b.subjectFromKey(key)}
+		}
+		if !seen[typ] {
+			seen[typ] = true
+			ret = append(ret, b.subjects.(proxy.TypedEventSubjectBuilder).TypedEvent(key.App, key.Node, typ))
+		}
 	}
-	return subj + key.Node
+	return ret
 }
 
 // Subscription represents an ari.Subscription over NATS
@@ -59,7 +102,14 @@ type Subscription struct {
 
 	log log15.Logger
 
-	subscription *nats.Subscription
+	// subscriptions are the NATS subscriptions of the subjects which are not
+	// attached to the Mux
+	subscriptions []*nats.Subscription
+
+	// mux is the Mux to which the subscription is attached, if any, by
+	// muxSubs
+	mux     *Mux
+	muxSubs []muxAttachment
 
 	eventChan chan ari.Event
 
@@ -82,8 +132,6 @@ func (b *Bus) Send(e ari.Event) {
 
 // Subscribe implements ari.Bus
 func (b *Bus) Subscribe(key *ari.Key, n ...string) ari.Subscription {
-	var err error
-
 	s := &Subscription{
 		key:       key,
 		log:       b.log,
@@ -91,12 +139,20 @@ func (b *Bus) Subscribe(key *ari.Key, n ...string) ari.Subscription {
 		events:    n,
 	}
 
-	s.subscription, err = b.nc.Subscribe(b.subjectFromKey(key), func(m *nats.Msg) {
-		s.receive(m)
-	})
-	if err != nil {
-		b.log.Error("failed to subscribe to NATS", "error", err)
-		return nil
+	for _, subject := range b.subjectsFor(key, n) {
+		if b.mux != nil && b.mux.attach(subject, key != nil && key.Dialog != "", s) {
+			continue
+		}
+
+		sub, err := b.nc.Subscribe(subject, func(m *nats.Msg) {
+			s.receive(m)
+		})
+		if err != nil {
+			b.log.Error("failed to subscribe to NATS", "error", err)
+			s.Cancel()
+			return nil
+		}
+		s.subscriptions = append(s.subscriptions, sub)
 	}
 	return s
 }
@@ -112,8 +168,12 @@ func (s *Subscription) Cancel() {
 		return
 	}
 
-	if s.subscription != nil {
-		err := s.subscription.Unsubscribe()
+	if s.mux != nil {
+		s.mux.detach(s)
+	}
+
+	for _, sub := range s.subscriptions {
+		err := sub.Unsubscribe()
 		if err != nil {
 			s.log.Error("failed unsubscribe from NATS", "error", err)
 		}
@@ -128,12 +188,17 @@ func (s *Subscription) Cancel() {
 }
 
 func (s *Subscription) receive(o *nats.Msg) {
-	e, err := ari.DecodeEvent(o.Data)
+	e, err := proxy.DecodeEvent(o.Data)
 	if err != nil {
 		s.log.Error("failed to convert received message to ari.Event", "error", err)
 		return
 	}
 
+	s.deliver(e)
+}
+
+// deliver sends the event to the subscriber, if it matches the subscription
+func (s *Subscription) deliver(e ari.Event) {
 	if s.matchEvent(e) {
 		s.mu.RLock()
 		if !s.closed {
@@ -1,11 +1,13 @@
 package bus
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/inconshreveable/log15"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 )
 
@@ -50,3 +52,38 @@ func TestMatchEvent(t *testing.T) {
 		t.Error("matched incorrect event")
 	}
 }
+
+func TestSubjectsFor(t *testing.T) {
+	b := New("ari.", nil, log15.New())
+	node := ari.NewKey("", "", ari.WithApp("app"), ari.WithNode("node"))
+	dialog := ari.NewKey("", "", ari.WithDialog("d1"))
+
+	if got := b.subjectsFor(node, []string{"StasisStart"}); !reflect.DeepEqual(got, []string{"ari.event.app.node"}) {
+		t.Errorf("unexpected subjects: %v", got)
+	}
+
+	b.UseEventTypeSubjects()
+	for _, tt := range []struct {
+		key      *ari.Key
+		types    []string
+		expected []string
+	}{
+		{node, []string{"StasisStart", "StasisEnd", "StasisStart"}, []string{"ari.event.app.node.StasisStart", "ari.event.app.node.StasisEnd"}},
+		{ari.NewKey(ari.ChannelKey, "ch1", ari.WithApp("app")), []string{"ChannelDtmfReceived"}, []string{"ari.event.app.*.ChannelDtmfReceived"}},
+		{node, []string{"StasisStart", ari.Events.All}, []string{"ari.event.app.node.>"}},
+		{ari.NewKey("", "", ari.WithApp("app")), []string{ari.Events.All}, []string{"ari.event.app.>"}},
+		{dialog, []string{"StasisStart"}, []string{"ari.dialogevent.d1"}},
+		{nil, []string{"StasisStart"}, []string{"ari.event.>"}},
+	} {
+		if got := b.subjectsFor(tt.key, tt.types); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v %v: subjects %v != %v", tt.key, tt.types, got, tt.expected)
+		}
+	}
+
+	// Builders without per-type subjects are unaffected
+	b = NewWithSubjects(struct{ proxy.SubjectBuilder }{proxy.NewSubjectBuilder("ari.")}, nil, log15.New())
+	b.UseEventTypeSubjects()
+	if got := b.subjectsFor(node, []string{"StasisStart"}); !reflect.DeepEqual(got, []string{"ari.event.app.node"}) {
+		t.Errorf("unexpected subjects: %v", got)
+	}
+}
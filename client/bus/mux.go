@@ -0,0 +1,301 @@
+package bus
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultMuxWorkers is the default number of goroutines which deliver the
+// events of a Mux
+var DefaultMuxWorkers = 16
+
+// muxQueueLength is the number of events which may be queued to each worker
+// of a Mux
+const muxQueueLength = 64
+
+// MuxOptions describes the sharing of the NATS subscriptions of a Mux
+type MuxOptions struct {
+	// Shared indicates that Bus subscriptions to the same subject share a
+	// single NATS subscription, which is set up on demand and removed with
+	// its last Bus subscription.  Otherwise, only the subscriptions to warm
+	// subjects (see Mux.Warm) are shared.
+	Shared bool
+
+	// DialogWildcard is a wildcard subject which matches the event subjects
+	// of all dialogs (e.g. "ari.dialogevent.*").  If it is set, shared dialog
+	// subscriptions are attached to a single subscription to it, so that the
+	// number of NATS subscriptions does not grow with the number of dialogs.
+	DialogWildcard string
+
+	// Workers is the number of goroutines which deliver events to Bus
+	// subscriptions.  The events of a subject are always delivered by the
+	// same goroutine, in order.  It defaults to DefaultMuxWorkers.
+	Workers int
+}
+
+// Mux multiplexes the Bus subscriptions of a client process over a bounded set
+// of NATS subscriptions and goroutines.  A Bus which uses a Mux attaches its
+// subscriptions to the Mux's NATS subscriptions instead of setting up its own.
+type Mux struct {
+	nc   *nats.EncodedConn
+	log  log15.Logger
+	opts MuxOptions
+
+	// subs is the set of NATS subscriptions, indexed by subject
+	subs map[string]*sharedSub
+
+	workers []chan muxDelivery
+	done    chan struct{}
+
+	closed bool
+	mu     sync.Mutex
+}
+
+// sharedSub is a NATS subscription and the Bus subscriptions which are
+// attached to it, indexed by their subjects.  A Bus subscription's subject is
+// either that of the NATS subscription or, for a wildcard NATS subscription,
+// one of the subjects which it matches.
+type sharedSub struct {
+	subject string
+	sub     *nats.Subscription
+
+	listeners map[string]map[*Subscription]struct{}
+	refs      int
+
+	// warm indicates that the subscription is kept without listeners
+	warm bool
+
+	mu sync.RWMutex
+}
+
+// muxAttachment is the attachment of a Bus subscription to a subject of a
+// shared subscription
+type muxAttachment struct {
+	ss      *sharedSub
+	subject string
+}
+
+// muxDelivery is a message to be delivered to a set of Bus subscriptions
+type muxDelivery struct {
+	m         *nats.Msg
+	listeners []*Subscription
+}
+
+// NewMux returns a Mux of the given NATS connection
+func NewMux(nc *nats.EncodedConn, log log15.Logger, opts MuxOptions) *Mux {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultMuxWorkers
+	}
+
+	m := &Mux{
+		nc:      nc,
+		log:     log,
+		opts:    opts,
+		subs:    make(map[string]*sharedSub),
+		workers: make([]chan muxDelivery, opts.Workers),
+		done:    make(chan struct{}),
+	}
+	for i := range m.workers {
+		m.workers[i] = make(chan muxDelivery, muxQueueLength)
+		go m.runWorker(m.workers[i])
+	}
+	return m
+}
+
+func (m *Mux) runWorker(ch chan muxDelivery) {
+	for {
+		select {
+		case <-m.done:
+			return
+		case d := <-ch:
+			for _, l := range d.listeners {
+				l.receive(d.m)
+			}
+		}
+	}
+}
+
+// subscribe sets up a NATS subscription to the given subject.  The Mux must
+// be locked.
+func (m *Mux) subscribe(subject string) (*sharedSub, error) {
+	ss := &sharedSub{
+		subject:   subject,
+		listeners: make(map[string]map[*Subscription]struct{}),
+	}
+
+	var err error
+	ss.sub, err = m.nc.Subscribe(subject, func(msg *nats.Msg) {
+		m.dispatch(ss, msg)
+	})
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to subscribe to %s", subject)
+	}
+
+	m.subs[subject] = ss
+	return ss, nil
+}
+
+// dispatch queues a received message for delivery to the Bus subscriptions
+// which it matches
+func (m *Mux) dispatch(ss *sharedSub, msg *nats.Msg) {
+	ss.mu.RLock()
+	var listeners []*Subscription
+	for l := range ss.listeners[ss.subject] {
+		listeners = append(listeners, l)
+	}
+	if msg.Subject != ss.subject {
+		for l := range ss.listeners[msg.Subject] {
+			listeners = append(listeners, l)
+		}
+	}
+	ss.mu.RUnlock()
+
+	if len(listeners) == 0 {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(msg.Subject)) // nolint: errcheck
+
+	select {
+	case m.workers[h.Sum32()%uint32(len(m.workers))] <- muxDelivery{m: msg, listeners: listeners}:
+	case <-m.done:
+	}
+}
+
+// attach delivers the events of the given subject to the Bus subscription,
+// returning false if the subscription must set up its own NATS subscription
+func (m *Mux) attach(subject string, dialog bool, l *Subscription) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false
+	}
+
+	target := subject
+	if dialog && m.opts.Shared && m.opts.DialogWildcard != "" {
+		target = m.opts.DialogWildcard
+	}
+
+	ss, ok := m.subs[target]
+	if !ok {
+		if !m.opts.Shared {
+			return false
+		}
+
+		var err error
+		if ss, err = m.subscribe(target); err != nil {
+			m.log.Error("failed to subscribe to NATS", "error", err)
+			return false
+		}
+	}
+
+	ss.mu.Lock()
+	if ss.listeners[subject] == nil {
+		ss.listeners[subject] = make(map[*Subscription]struct{})
+	}
+	ss.listeners[subject][l] = struct{}{}
+	ss.refs++
+	ss.mu.Unlock()
+
+	l.mux = m
+	l.muxSubs = append(l.muxSubs, muxAttachment{ss: ss, subject: subject})
+	return true
+}
+
+// detach stops the delivery of events to the Bus subscription, removing its
+// NATS subscription if it was the last one attached and it is not warm
+func (m *Mux) detach(l *Subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, a := range l.muxSubs {
+		ss := a.ss
+
+		ss.mu.Lock()
+		if _, ok := ss.listeners[a.subject][l]; ok {
+			delete(ss.listeners[a.subject], l)
+			if len(ss.listeners[a.subject]) == 0 {
+				delete(ss.listeners, a.subject)
+			}
+			ss.refs--
+		}
+		unused := ss.refs == 0 && !ss.warm
+		ss.mu.Unlock()
+
+		if unused && m.subs[ss.subject] == ss {
+			delete(m.subs, ss.subject)
+			if err := ss.sub.Unsubscribe(); err != nil {
+				m.log.Debug("failed to unsubscribe from NATS", "subject", ss.subject, "error", err)
+			}
+		}
+	}
+}
+
+// Warm establishes a persistent subscription to the given subject, if there
+// is not one already, and waits for the NATS server to process it
+func (m *Mux) Warm(subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return eris.New("mux is closed")
+	}
+
+	if ss, ok := m.subs[subject]; ok {
+		ss.mu.Lock()
+		ss.warm = true
+		ss.mu.Unlock()
+		return nil
+	}
+
+	ss, err := m.subscribe(subject)
+	if err != nil {
+		return err
+	}
+	ss.warm = true
+
+	if err = m.nc.Flush(); err != nil {
+		return eris.Wrapf(err, "failed to flush subscription to %s", subject)
+	}
+	return nil
+}
+
+// Warmed indicates whether the given subject has a persistent subscription
+func (m *Mux) Warmed(subject string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ss, ok := m.subs[subject]
+	if !ok {
+		return false
+	}
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.warm
+}
+
+// Close removes the NATS subscriptions and stops the delivery of events
+func (m *Mux) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+	close(m.done)
+
+	for subject, ss := range m.subs {
+		if err := ss.sub.Unsubscribe(); err != nil {
+			m.log.Debug("failed to unsubscribe from NATS", "subject", subject, "error", err)
+		}
+	}
+	m.subs = make(map[string]*sharedSub)
+}
@@ -0,0 +1,78 @@
+package bus
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+)
+
+// benchDialogs is the number of concurrent dialogs subscribed by the
+// benchmarks
+const benchDialogs = 5000
+
+func benchNATS(b *testing.B) *nats.EncodedConn {
+	uri := os.Getenv("NATS_URI")
+	if uri == "" {
+		uri = nats.DefaultURL
+	}
+	nc, err := nats.Connect(uri)
+	if err != nil {
+		b.Skipf("Error connecting to nats: %s", err)
+	}
+	c, err := nats.NewEncodedConn(nc, nats.JSON_ENCODER)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+// benchmarkDialogs subscribes to the events of many dialogs, reporting the
+// heap memory and goroutines used per dialog
+func benchmarkDialogs(b *testing.B, mux bool) {
+	nc := benchNATS(b)
+	defer nc.Close()
+
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		goroutines := runtime.NumGoroutine()
+
+		bus := New("ari.", nc, log15.New())
+		var m *Mux
+		if mux {
+			m = NewMux(nc, log15.New(), MuxOptions{Shared: true, DialogWildcard: "ari.dialogevent.*"})
+			bus.UseMux(m)
+		}
+
+		subs := make([]ari.Subscription, benchDialogs)
+		for j := range subs {
+			subs[j] = bus.Subscribe(ari.NewKey("", "", ari.WithDialog(fmt.Sprintf("dialog-%d", j))), ari.Events.All)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/benchDialogs, "heapB/dialog")
+		b.ReportMetric(float64(runtime.NumGoroutine()-goroutines), "goroutines")
+
+		for _, s := range subs {
+			s.Cancel()
+		}
+		if m != nil {
+			m.Close()
+		}
+	}
+}
+
+func BenchmarkDialogSubscriptions(b *testing.B) {
+	benchmarkDialogs(b, false)
+}
+
+func BenchmarkDialogSubscriptionsMux(b *testing.B) {
+	benchmarkDialogs(b, true)
+}
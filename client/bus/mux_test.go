@@ -0,0 +1,97 @@
+package bus
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+)
+
+// warmSub adds a warm shared subscription, without a NATS subscription, to
+// the Mux
+func warmSub(m *Mux, subject string) *sharedSub {
+	ss := &sharedSub{
+		subject:   subject,
+		listeners: make(map[string]map[*Subscription]struct{}),
+		warm:      true,
+	}
+	m.subs[subject] = ss
+	return ss
+}
+
+func stasisStart(t *testing.T, subject string) *nats.Msg {
+	data, err := json.Marshal(&ari.StasisStart{
+		EventData: ari.EventData{Type: "StasisStart", Application: "app", Node: "node"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nats.Msg{Subject: subject, Data: data}
+}
+
+func expectEvent(t *testing.T, sub ari.Subscription, expected bool) {
+	t.Helper()
+	select {
+	case <-sub.Events():
+		if !expected {
+			t.Error("unexpected event")
+		}
+	case <-time.After(50 * time.Millisecond):
+		if expected {
+			t.Error("event should be delivered")
+		}
+	}
+}
+
+func TestMuxWarmSubject(t *testing.T) {
+	m := NewMux(nil, log15.New(), MuxOptions{Workers: 2})
+	defer m.Close()
+	ss := warmSub(m, "ari.event.app.node")
+
+	b := New("ari.", nil, log15.New())
+	b.UseMux(m)
+
+	sub := b.Subscribe(ari.NewKey("", "", ari.WithApp("app"), ari.WithNode("node")), "StasisStart").(*Subscription)
+	if sub.mux != m || len(sub.subscriptions) != 0 {
+		t.Fatal("subscription to a warm subject should attach to the mux")
+	}
+
+	m.dispatch(ss, stasisStart(t, "ari.event.app.node"))
+	expectEvent(t, sub, true)
+
+	sub.Cancel()
+	if ss.refs != 0 || len(ss.listeners) != 0 {
+		t.Error("cancelled subscription should be detached")
+	}
+	if !m.Warmed("ari.event.app.node") {
+		t.Error("warm subscription should be kept without listeners")
+	}
+}
+
+func TestMuxDialogWildcard(t *testing.T) {
+	m := NewMux(nil, log15.New(), MuxOptions{Shared: true, DialogWildcard: "ari.dialogevent.*"})
+	defer m.Close()
+	ss := warmSub(m, "ari.dialogevent.*")
+
+	b := New("ari.", nil, log15.New())
+	b.UseMux(m)
+
+	d1 := b.Subscribe(ari.NewKey("", "", ari.WithDialog("d1")), "StasisStart")
+	d2 := b.Subscribe(ari.NewKey("", "", ari.WithDialog("d2")), "StasisStart")
+	if len(m.subs) != 1 || ss.refs != 2 {
+		t.Fatalf("dialogs should share the wildcard subscription: %v", m.subs)
+	}
+
+	m.dispatch(ss, stasisStart(t, "ari.dialogevent.d1"))
+	expectEvent(t, d1, true)
+	expectEvent(t, d2, false)
+
+	d1.Cancel()
+	d2.Cancel()
+	if ss.refs != 0 {
+		t.Errorf("unexpected references: %d", ss.refs)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// entityCache maintains the data of channels and bridges from the event
+// stream, so that Data reads may be served locally.  An entry is only served
+// while it is younger than the cache's maximum age; older entries are
+// refreshed by a request.
+type entityCache struct {
+	maxAge time.Duration
+
+	channels map[string]cachedChannel
+	bridges  map[string]cachedBridge
+
+	mu sync.RWMutex
+}
+
+type cachedChannel struct {
+	data    ari.ChannelData
+	updated time.Time
+}
+
+type cachedBridge struct {
+	data    ari.BridgeData
+	updated time.Time
+}
+
+func newEntityCache(maxAge time.Duration) *entityCache {
+	return &entityCache{
+		maxAge:   maxAge,
+		channels: make(map[string]cachedChannel),
+		bridges:  make(map[string]cachedBridge),
+	}
+}
+
+// run updates the cache from the events of the subscription until it is
+// cancelled
+func (ec *entityCache) run(sub ari.Subscription) {
+	for e := range sub.Events() {
+		ec.process(e, time.Now())
+	}
+}
+
+// process updates the cache from an event
+func (ec *entityCache) process(e ari.Event, now time.Time) {
+	switch v := e.(type) {
+	case *ari.StasisStart:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelCreated:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelStateChange:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelCallerID:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelConnectedLine:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelDialplan:
+		ec.putChannel(&v.Channel, now)
+	case *ari.ChannelDestroyed:
+		ec.removeChannel(v.Channel.ID)
+	case *ari.BridgeCreated:
+		ec.putBridge(&v.Bridge, now)
+	case *ari.ChannelEnteredBridge:
+		ec.putChannel(&v.Channel, now)
+		ec.putBridge(&v.Bridge, now)
+	case *ari.ChannelLeftBridge:
+		ec.putChannel(&v.Channel, now)
+		ec.putBridge(&v.Bridge, now)
+	case *ari.BridgeDestroyed:
+		ec.removeBridge(v.Bridge.ID)
+	}
+}
+
+func (ec *entityCache) putChannel(d *ari.ChannelData, now time.Time) {
+	if d == nil || d.ID == "" {
+		return
+	}
+	ec.mu.Lock()
+	ec.channels[d.ID] = cachedChannel{data: *d, updated: now}
+	ec.mu.Unlock()
+}
+
+func (ec *entityCache) putBridge(d *ari.BridgeData, now time.Time) {
+	if d == nil || d.ID == "" {
+		return
+	}
+	ec.mu.Lock()
+	ec.bridges[d.ID] = cachedBridge{data: *d, updated: now}
+	ec.mu.Unlock()
+}
+
+func (ec *entityCache) removeChannel(id string) {
+	ec.mu.Lock()
+	delete(ec.channels, id)
+	ec.mu.Unlock()
+}
+
+func (ec *entityCache) removeBridge(id string) {
+	ec.mu.Lock()
+	delete(ec.bridges, id)
+	ec.mu.Unlock()
+}
+
+// channel returns a copy of the cached data of the given channel, if it is
+// fresh
+func (ec *entityCache) channel(key *ari.Key, now time.Time) (*ari.ChannelData, bool) {
+	ec.mu.RLock()
+	entry, ok := ec.channels[key.ID]
+	ec.mu.RUnlock()
+
+	if !ok || now.Sub(entry.updated) > ec.maxAge {
+		return nil, false
+	}
+
+	d := entry.data
+	if d.Key == nil {
+		d.Key = key
+	}
+	return &d, true
+}
+
+// bridge returns a copy of the cached data of the given bridge, if it is
+// fresh
+func (ec *entityCache) bridge(key *ari.Key, now time.Time) (*ari.BridgeData, bool) {
+	ec.mu.RLock()
+	entry, ok := ec.bridges[key.ID]
+	ec.mu.RUnlock()
+
+	if !ok || now.Sub(entry.updated) > ec.maxAge {
+		return nil, false
+	}
+
+	d := entry.data
+	d.ChannelIDs = append([]string(nil), d.ChannelIDs...)
+	if d.Key == nil {
+		d.Key = key
+	}
+	return &d, true
+}
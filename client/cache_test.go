@@ -0,0 +1,44 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestEntityCache(t *testing.T) {
+	now := time.Now()
+	ec := newEntityCache(time.Second)
+
+	ec.process(&ari.ChannelStateChange{Channel: ari.ChannelData{ID: "c1", State: "Up"}}, now)
+	ec.process(&ari.ChannelEnteredBridge{
+		Bridge:  ari.BridgeData{ID: "b1", ChannelIDs: []string{"c1"}},
+		Channel: ari.ChannelData{ID: "c1", State: "Up"},
+	}, now)
+
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	d, ok := ec.channel(key, now)
+	if !ok || d.State != "Up" || d.Key != key {
+		t.Errorf("unexpected cached channel: %v %v", d, ok)
+	}
+
+	b, ok := ec.bridge(ari.NewKey(ari.BridgeKey, "b1"), now)
+	if !ok || len(b.ChannelIDs) != 1 {
+		t.Errorf("unexpected cached bridge: %v %v", b, ok)
+	}
+
+	if _, ok = ec.channel(key, now.Add(2*time.Second)); ok {
+		t.Error("stale channel data should not be served")
+	}
+
+	ec.process(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c1"}}, now)
+	if _, ok = ec.channel(key, now); ok {
+		t.Error("destroyed channel should be evicted")
+	}
+
+	ec.process(&ari.BridgeDestroyed{Bridge: ari.BridgeData{ID: "b1"}}, now)
+	if _, ok = ec.bridge(ari.NewKey(ari.BridgeKey, "b1"), now); ok {
+		t.Error("destroyed bridge should be evicted")
+	}
+}
@@ -0,0 +1,19 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// CallGraph returns the topology of the channels and bridges connected to the
+// given channel
+func (c *Client) CallGraph(key *ari.Key) (*proxy.CallGraph, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind: "CallGraph",
+		Key:  key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.CallGraph, nil
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/cluster"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ErrNotSupported indicates that no proxy of the cluster supports the kind of
+// a request.  The errors returned for unsupported requests are
+// *NotSupportedError values, which match ErrNotSupported with errors.Is.
+var ErrNotSupported = eris.New("request kind not supported")
+
+// NotSupportedError is the error returned, without contacting the cluster,
+// for a request whose Kind is not supported by any of the proxies to which it
+// would be sent
+type NotSupportedError struct {
+	// Kind is the unsupported request Kind
+	Kind string
+}
+
+func (err *NotSupportedError) Error() string {
+	return "request kind not supported: " + err.Kind
+}
+
+// Is implements errors.Is, matching ErrNotSupported
+func (err *NotSupportedError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+// capabilitySet tracks the request Kinds, and the last announcement, of each
+// proxy of the cluster, indexed by node and application
+type capabilitySet struct {
+	kinds         map[string]map[string]struct{}
+	announcements map[string]*proxy.Announcement
+	mu            sync.RWMutex
+}
+
+// update records the Kinds of an announcement.  Announcements without a list
+// of Kinds come from proxies which predate capability announcements.
+func (cs *capabilitySet) update(a *proxy.Announcement) {
+	var kinds map[string]struct{}
+	if len(a.Kinds) > 0 {
+		kinds = make(map[string]struct{}, len(a.Kinds))
+		for _, k := range a.Kinds {
+			kinds[k] = struct{}{}
+		}
+	}
+
+	cs.mu.Lock()
+	if cs.kinds == nil {
+		cs.kinds = make(map[string]map[string]struct{})
+		cs.announcements = make(map[string]*proxy.Announcement)
+	}
+	cs.kinds[a.Node+"|"+a.Application] = kinds
+	cs.announcements[a.Node+"|"+a.Application] = a
+	cs.mu.Unlock()
+}
+
+// remove forgets the proxy of the announcement
+func (cs *capabilitySet) remove(a *proxy.Announcement) {
+	cs.mu.Lock()
+	delete(cs.kinds, a.Node+"|"+a.Application)
+	delete(cs.announcements, a.Node+"|"+a.Application)
+	cs.mu.Unlock()
+}
+
+// announced returns the last announcements of the given members, where known
+func (cs *capabilitySet) announced(members []cluster.Member) (ret []*proxy.Announcement) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, m := range members {
+		if a, ok := cs.announcements[m.ID+"|"+m.App]; ok {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// supports indicates whether any of the given members may support the kind.
+// Unless every member is known to lack the kind, it is considered supported.
+func (cs *capabilitySet) supports(kind string, members []cluster.Member) bool {
+	if len(members) == 0 {
+		return true
+	}
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, m := range members {
+		kinds, ok := cs.kinds[m.ID+"|"+m.App]
+		if !ok || kinds == nil {
+			// Unknown capabilities
+			return true
+		}
+		if _, ok := kinds[kind]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Supports indicates whether the proxies of the client's application support
+// the given request Kind (e.g. "ChannelAMD"), based on their announcements.
+// If the capabilities of any proxy are unknown, the Kind is assumed to be
+// supported.
+func (c *Client) Supports(kind string) bool {
+	return c.caps.supports(kind, c.cluster.Matching("", c.appName, c.clusterMaxAge))
+}
+
+// Nodes returns the last announcements of the proxies of the client's
+// application, ordered by node, for call placement: the announcements
+// describe the Asterisk version, channel drivers and call capacity of each
+// node.  The returned announcements must not be modified.
+func (c *Client) Nodes() []*proxy.Announcement {
+	ret := c.caps.announced(c.cluster.Matching("", c.appName, c.clusterMaxAge))
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Application != ret[j].Application {
+			return ret[i].Application < ret[j].Application
+		}
+		return ret[i].Node < ret[j].Node
+	})
+	return ret
+}
+
+// NodesWithChannelDriver returns the announcements of the proxies of the
+// client's application whose Asterisk has the given channel driver (e.g.
+// "chan_audiosocket") loaded, ordered by node
+func (c *Client) NodesWithChannelDriver(name string) (ret []*proxy.Announcement) {
+	for _, a := range c.Nodes() {
+		if a.HasChannelDriver(name) {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// NodesWithLabel returns the announcements of the proxies of the client's
+// application which have the given label with the given value (e.g. "region"
+// and "eu-west-1"), ordered by node
+func (c *Client) NodesWithLabel(name, value string) (ret []*proxy.Announcement) {
+	for _, a := range c.Nodes() {
+		if a.HasLabel(name, value) {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// checkSupported returns a NotSupportedError if none of the proxies to which
+// the request would be sent supports its Kind
+func (c *Client) checkSupported(req *proxy.Request) error {
+	if req == nil || req.Kind == "" {
+		return nil
+	}
+
+	key := req.Key
+	if key == nil {
+		key = ari.NewKey("", "")
+	}
+	app := key.App
+	if app == "" {
+		app = c.appName
+	}
+
+	if !c.caps.supports(req.Kind, c.cluster.Matching(key.Node, app, c.clusterMaxAge)) {
+		return &NotSupportedError{Kind: req.Kind}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/cluster"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestCapabilitySet(t *testing.T) {
+	var cs capabilitySet
+	cs.update(&proxy.Announcement{Node: "n1", Application: "app", Kinds: []string{"ChannelData", "ChannelAMD"}})
+	cs.update(&proxy.Announcement{Node: "n2", Application: "app", Kinds: []string{"ChannelData"}})
+
+	members := []cluster.Member{{ID: "n1", App: "app"}, {ID: "n2", App: "app"}}
+
+	if !cs.supports("ChannelAMD", members) {
+		t.Error("kind supported by one member should be supported")
+	}
+	if cs.supports("FaxSend", members) {
+		t.Error("kind supported by no member should not be supported")
+	}
+	if cs.supports("ChannelAMD", members[1:]) {
+		t.Error("kind not supported by the only member should not be supported")
+	}
+	if !cs.supports("FaxSend", nil) {
+		t.Error("kinds should be assumed supported without known members")
+	}
+
+	// Proxies which predate capability announcements support unknown kinds
+	cs.update(&proxy.Announcement{Node: "n3", Application: "app"})
+	if !cs.supports("FaxSend", append(members, cluster.Member{ID: "n3", App: "app"})) {
+		t.Error("kinds should be assumed supported by members of unknown capabilities")
+	}
+}
+
+func TestNotSupportedError(t *testing.T) {
+	var err error = &NotSupportedError{Kind: "FaxSend"}
+	if !errors.Is(err, ErrNotSupported) {
+		t.Error("NotSupportedError should match ErrNotSupported")
+	}
+}
+
+func TestCapabilitySetAnnounced(t *testing.T) {
+	var cs capabilitySet
+	cs.update(&proxy.Announcement{Node: "n1", Application: "app", ChannelDrivers: []string{"chan_pjsip"}})
+	cs.update(&proxy.Announcement{Node: "n2", Application: "app", ChannelDrivers: []string{"chan_audiosocket", "chan_pjsip"}})
+
+	list := cs.announced([]cluster.Member{{ID: "n2", App: "app"}, {ID: "n3", App: "app"}})
+	if len(list) != 1 || list[0].Node != "n2" {
+		t.Fatalf("unexpected announcements %+v", list)
+	}
+	if !list[0].HasChannelDriver("chan_audiosocket.so") || list[0].HasChannelDriver("chan_sip") {
+		t.Errorf("unexpected channel drivers %v", list[0].ChannelDrivers)
+	}
+
+	cs.remove(&proxy.Announcement{Node: "n2", Application: "app", Leaving: true})
+	if list := cs.announced([]cluster.Member{{ID: "n2", App: "app"}}); len(list) != 0 {
+		t.Errorf("unexpected announcements of a removed proxy %+v", list)
+	}
+}
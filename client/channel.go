@@ -84,6 +84,12 @@ func (c *channel) Create(key *ari.Key, o ari.ChannelCreateRequest) (*ari.Channel
 }
 
 func (c *channel) Data(key *ari.Key) (*ari.ChannelData, error) {
+	if c.c.cache != nil {
+		if d, ok := c.c.cache.channel(key, time.Now()); ok {
+			return d, nil
+		}
+	}
+
 	data, err := c.c.dataRequest(&proxy.Request{
 		Kind: "ChannelData",
 		Key:  key,
@@ -91,6 +97,9 @@ func (c *channel) Data(key *ari.Key) (*ari.ChannelData, error) {
 	if err != nil {
 		return nil, err
 	}
+	if c.c.cache != nil {
+		c.c.cache.putChannel(data.Channel, time.Now())
+	}
 	return data.Channel, nil
 }
 
@@ -370,7 +379,7 @@ func (c *channel) Record(key *ari.Key, name string, opts *ari.RecordingOptions)
 	if err != nil {
 		return nil, err
 	}
-	return ari.NewLiveRecordingHandle(rb.New(ari.LiveRecordingKey, name), c.c.LiveRecording(), nil), nil
+	return ari.NewLiveRecordingHandle(recordingKey(rb, name), c.c.LiveRecording(), nil), nil
 }
 
 func (c *channel) StageRecord(key *ari.Key, name string, opts *ari.RecordingOptions) (*ari.LiveRecordingHandle, error) {
@@ -48,6 +48,9 @@ type core struct {
 	// cluster describes the cluster of ARI proxies
 	cluster *cluster.Cluster
 
+	// caps tracks the request Kinds supported by the proxies of the cluster
+	caps capabilitySet
+
 	// clusterMaxAge is the maximum age of cluster members to include in queries
 	clusterMaxAge time.Duration
 
@@ -63,6 +66,10 @@ type core struct {
 	// prefix is the prefix to use on all NATS subjects.  It defaults to "ari.".
 	prefix string
 
+	// subjects constructs the NATS subjects.  It defaults to the default
+	// scheme with prefix.
+	subjects proxy.SubjectBuilder
+
 	// refCounter is the reference counter for derived clients.  When there are
 	// no more referenced clients, the core is shut down.
 	refCounter int
@@ -98,6 +105,41 @@ type core struct {
 	// started indicates whether this core has been started; a started core will
 	// no-op core.start()
 	started bool
+
+	// warmStandby indicates that the event subjects of the announced nodes of
+	// standbyApp (or of every application, if it is empty) are subscribed
+	// ahead of time
+	warmStandby bool
+	standbyApp  string
+
+	// multiplex indicates that event subscriptions share NATS subscriptions,
+	// delivered by muxWorkers goroutines
+	multiplex  bool
+	muxWorkers int
+
+	// eventTypeSubjects indicates that event subscriptions subscribe to the
+	// per-type event subjects of their event types
+	eventTypeSubjects bool
+
+	// mux multiplexes the event subscriptions of the clients of the core,
+	// if warm standby or multiplexing is enabled
+	mux *bus.Mux
+
+	// breakerConfig configures the circuit breaker, if it is enabled
+	breakerConfig *CircuitBreakerConfig
+
+	// breaker tracks the failure rates of nodes, if the circuit breaker is
+	// enabled
+	breaker *breaker
+
+	// streamed is the set of request classes made through JetStream
+	streamed map[string]bool
+
+	// codecName is the name of the codec with which requests are encoded
+	codecName string
+
+	// codec is the Codec named by codecName
+	codec proxy.Codec
 }
 
 // clientClosed is called any time a derived ARI client is closed; if the
@@ -124,6 +166,10 @@ func (c *core) close() {
 		}
 	}
 
+	if c.mux != nil {
+		c.mux.Close()
+	}
+
 	if c.closeNATSOnClose && c.nc != nil {
 		c.nc.Close()
 	}
@@ -162,6 +208,17 @@ func (c *core) Start() error {
 	// Create and start the cluster
 	c.cluster = cluster.New()
 
+	if c.warmStandby || c.multiplex {
+		opts := bus.MuxOptions{
+			Workers: c.muxWorkers,
+		}
+		if c.multiplex {
+			opts.Shared = true
+			opts.DialogWildcard = c.subjects.DialogEvent("*")
+		}
+		c.mux = bus.NewMux(c.nc, c.log, opts)
+	}
+
 	// Maintain the cluster
 	err := c.maintainCluster()
 	if err != nil {
@@ -173,15 +230,50 @@ func (c *core) Start() error {
 }
 
 func (c *core) maintainCluster() (err error) {
-	c.annSub, err = c.nc.Subscribe(proxy.AnnouncementSubject(c.prefix), func(o *proxy.Announcement) {
+	c.annSub, err = c.nc.Subscribe(c.subjects.Announcement(), func(o *proxy.Announcement) {
+		if o.Leaving {
+			// Stop routing requests to the proxy at once, and ping the
+			// cluster, so that any other proxy of the node is re-added
+			c.log.Info("proxy leaving the cluster", "application", o.Application, "node", o.Node, "instance", o.Instance)
+			c.cluster.Remove(o.Node, o.Application)
+			c.caps.remove(o)
+			if err := c.nc.Publish(c.subjects.Ping(), &proxy.Request{}); err != nil {
+				c.log.Warn("failed to ping cluster", "error", err)
+			}
+			return
+		}
 		c.cluster.Update(o.Node, o.Application)
+		c.caps.update(o)
+		if c.breaker != nil && c.breaker.announced(o.Application, o.Node, time.Now()) {
+			c.log.Info("reinstated node after probe", "application", o.Application, "node", o.Node)
+		}
+		c.warm(o)
 	})
 	if err != nil {
 		return eris.Wrap(err, "failed to listen to proxy announcements")
 	}
 
 	// Send an initial ping for proxy announcements
-	return c.nc.Publish(proxy.PingSubject(c.prefix), &proxy.Request{})
+	return c.nc.Publish(c.subjects.Ping(), &proxy.Request{})
+}
+
+// warm subscribes the event subjects of the announced node ahead of time, if
+// warm standby is enabled for its application
+func (c *core) warm(o *proxy.Announcement) {
+	if !c.warmStandby || c.mux == nil || (c.standbyApp != "" && o.Application != c.standbyApp) {
+		return
+	}
+	for _, subject := range []string{
+		c.eventSubject(o.Application, "", ""),
+		c.eventSubject(o.Application, o.Node, ""),
+	} {
+		if c.mux.Warmed(subject) {
+			continue
+		}
+		if err := c.mux.Warm(subject); err != nil {
+			c.log.Warn("failed to warm event subscription", "subject", subject, "error", err)
+		}
+	}
 }
 
 // Client provides an ari.Client for an ari-proxy server
@@ -192,8 +284,25 @@ type Client struct {
 
 	appName string
 
+	// tenant is the optional tenant identifier attached to each request
+	tenant string
+
+	// cacheMaxAge is the maximum age of the cached channel and bridge data
+	// served by Data reads.  If zero, the cache is disabled.
+	cacheMaxAge time.Duration
+
+	// cache is the cache of channel and bridge data, if enabled
+	cache *entityCache
+
+	// cacheSub is the event subscription which maintains the cache
+	cacheSub ari.Subscription
+
 	cancel context.CancelFunc
 
+	// ctx is the context by which the requests of the client are bound (see
+	// WithContext), if any
+	ctx context.Context
+
 	// closed indicates that this client has been closed and is no longer attached to a core
 	closed bool
 }
@@ -226,6 +335,20 @@ func New(ctx context.Context, opts ...OptionFunc) (*Client, error) {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if err := c.validate(); err != nil {
+		cancel()
+		return nil, eris.Wrap(err, "invalid client option")
+	}
+
+	if c.core.subjects == nil {
+		c.core.subjects = proxy.NewSubjectBuilder(c.core.prefix)
+	}
+	if c.core.warmStandby && !c.core.started {
+		c.core.standbyApp = c.appName
+	}
+	if c.core.breakerConfig != nil && c.core.breaker == nil {
+		c.core.breaker = newBreaker(*c.core.breakerConfig)
+	}
 
 	// Start the core, if it is not already started
 	err := c.core.Start()
@@ -234,7 +357,12 @@ func New(ctx context.Context, opts ...OptionFunc) (*Client, error) {
 	}
 
 	// Create the bus
-	c.bus = bus.New(c.core.prefix, c.core.nc, c.core.log)
+	c.bus = c.core.newBus()
+
+	// Maintain the entity cache, if enabled
+	if c.cacheMaxAge > 0 {
+		c.startCache()
+	}
 
 	// Call Close whenever the context is closed
 	go func() {
@@ -261,10 +389,37 @@ func (c *Client) New(ctx context.Context) *Client {
 
 	return &Client{
 		appName: c.appName,
+		tenant:  c.tenant,
 		cancel:  cancel,
 		core:    c.core,
-		bus:     bus.New(c.core.prefix, c.core.nc, c.core.log),
+		bus:     c.core.newBus(),
+		cache:   c.cache,
+	}
+}
+
+// newBus returns a new event bus, attached to the multiplexer, if any
+func (c *core) newBus() *bus.Bus {
+	b := bus.NewWithSubjects(c.subjects, c.nc, c.log)
+	if c.mux != nil {
+		b.UseMux(c.mux)
+	}
+	if c.eventTypeSubjects {
+		b.UseEventTypeSubjects()
+	}
+	return b
+}
+
+// eventSubject returns the subject of the events of the given type (or of
+// all types, if empty) of the given application and node, which is per-type
+// if the client subscribes to per-type event subjects
+func (c *core) eventSubject(app, node, typ string) string {
+	if b, ok := c.subjects.(proxy.TypedEventSubjectBuilder); ok && c.eventTypeSubjects {
+		if typ == "" && node == "" {
+			return c.subjects.Event(app, node)
+		}
+		return b.TypedEvent(app, node, typ)
 	}
+	return c.subjects.Event(app, node)
 }
 
 // OptionFunc is a function which configures options on a Client
@@ -296,6 +451,14 @@ func WithApplication(name string) OptionFunc {
 	}
 }
 
+// WithTenant configures the ARI Client to identify its requests as belonging
+// to the given tenant.  Servers use the tenant to enforce per-tenant quotas.
+func WithTenant(name string) OptionFunc {
+	return func(c *Client) {
+		c.tenant = name
+	}
+}
+
 // WithLogger sets the logger on a Client.
 func WithLogger(l log15.Logger) OptionFunc {
 	return func(c *Client) {
@@ -332,6 +495,23 @@ func WithPrefix(prefix string) OptionFunc {
 	}
 }
 
+// WithSubjectBuilder configures the construction of the NATS subjects used by
+// a Client.  It must be equivalent to the SubjectBuilder of the servers.  If
+// it is not given, the default scheme is used with the configured prefix.
+func WithSubjectBuilder(b proxy.SubjectBuilder) OptionFunc {
+	return func(c *Client) {
+		c.core.subjects = b
+	}
+}
+
+// WithRequestTimeout configures the time to wait for the response to a
+// request.  It defaults to DefaultRequestTimeout.
+func WithRequestTimeout(d time.Duration) OptionFunc {
+	return func(c *Client) {
+		c.core.requestTimeout = d
+	}
+}
+
 // WithTimeoutRetries configures the amount of times to retry on request timeout for a Client
 func WithTimeoutRetries(count int) OptionFunc {
 	return func(c *Client) {
@@ -339,6 +519,117 @@ func WithTimeoutRetries(count int) OptionFunc {
 	}
 }
 
+// WithCache enables a cache of channel and bridge data, maintained from the
+// event stream.  Data reads of channels and bridges are served from the cache
+// when the cached data is no older than maxAge.
+func WithCache(maxAge time.Duration) OptionFunc {
+	return func(c *Client) {
+		c.cacheMaxAge = maxAge
+	}
+}
+
+// WithWarmStandby configures the Client to subscribe to the event subjects of
+// every announced node of its application (or of every application, if none
+// is configured) as soon as the node is announced, before any request is
+// made.  Event subscriptions to these subjects then attach to the existing
+// NATS subscriptions instead of setting up their own, eliminating the latency
+// of subscription setup from the first calls.
+func WithWarmStandby() OptionFunc {
+	return func(c *Client) {
+		c.core.warmStandby = true
+	}
+}
+
+// WithMultiplexing configures the Client to multiplex its event subscriptions
+// over a bounded set of NATS subscriptions and goroutines, for processes which
+// handle thousands of concurrent dialogs.  Subscriptions to the same subject
+// share a single NATS subscription, the subscriptions of all dialogs share a
+// single wildcard subscription, and events are delivered by the given number
+// of goroutines (or bus.DefaultMuxWorkers, if zero), with the events of each
+// subject delivered in order.
+//
+// As the process then receives the events of every dialog, including those
+// of other processes, multiplexing suits processes which handle most of the
+// dialogs of a cluster.  A subscriber which does not consume its events
+// delays the delivery of the events of the other subjects handled by the
+// same goroutine.
+func WithMultiplexing(workers int) OptionFunc {
+	return func(c *Client) {
+		c.core.multiplex = true
+		c.core.muxWorkers = workers
+	}
+}
+
+// WithCodec configures the codec with which requests are encoded (see
+// proxy.RegisterCodec).  It defaults to JSON.  Responses and events are
+// decoded with the codec which encoded them.
+func WithCodec(name string) OptionFunc {
+	return func(c *Client) {
+		c.core.codecName = name
+	}
+}
+
+// WithCircuitBreaker configures the Client to stop routing requests to nodes
+// whose requests time out or fail too often, as described by the given
+// configuration.  Requests addressed to a blacklisted node fail immediately
+// with ErrNodeUnavailable.  Once its cooldown has elapsed, the node is probed
+// with a ping, and it is reinstated when it answers.  Broadcast requests,
+// which are not addressed to a node, are unaffected.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) OptionFunc {
+	return func(c *Client) {
+		c.core.breakerConfig = &cfg
+	}
+}
+
+// WithEventTypeSubjects configures the Client to subscribe to the per-type
+// event subjects of the event types to which it subscribes, for clusters
+// whose proxies publish their events to per-type subjects (the
+// nats.event_type_subjects setting of the proxies), so that the NATS servers
+// only deliver the events which the client handles.  The clients and proxies
+// of a cluster must be switched together, as each only receives the events
+// published in its own scheme.
+func WithEventTypeSubjects() OptionFunc {
+	return func(c *Client) {
+		c.core.eventTypeSubjects = true
+	}
+}
+
+// validate checks the configuration of the Client once its options are applied
+func (c *Client) validate() error {
+	if c.core.requestTimeout <= 0 {
+		return eris.New("request timeout must be positive")
+	}
+	if c.core.timeoutRetries < 0 {
+		return eris.New("timeout retries may not be negative")
+	}
+	if c.core.muxWorkers < 0 {
+		return eris.New("multiplexing workers may not be negative")
+	}
+	if c.cacheMaxAge < 0 {
+		return eris.New("cache maximum age may not be negative")
+	}
+	if c.log == nil {
+		return eris.New("no logger")
+	}
+	codec, err := proxy.LookupCodec(c.core.codecName)
+	if err != nil {
+		return err
+	}
+	c.core.codec = codec
+	for class := range c.core.streamed {
+		if class != "create" && class != "command" {
+			return eris.Errorf("cannot make %q requests through JetStream", class)
+		}
+	}
+	if _, ok := c.core.subjects.(proxy.TypedEventSubjectBuilder); c.core.eventTypeSubjects && c.core.subjects != nil && !ok {
+		return eris.New("subject builder does not support per-type event subjects")
+	}
+	if c.core.breakerConfig != nil {
+		return c.core.breakerConfig.validate()
+	}
+	return nil
+}
+
 // ApplicationName returns the ARI application's name
 func (c *Client) ApplicationName() string {
 	return c.appName
@@ -364,6 +655,10 @@ func (c *Client) Close() {
 		c.cancel()
 	}
 
+	if c.cacheSub != nil {
+		c.cacheSub.Cancel()
+	}
+
 	if c.bus != nil {
 		c.bus.Close()
 	}
@@ -374,6 +669,24 @@ func (c *Client) Close() {
 	}
 }
 
+// startCache starts maintaining the entity cache from the events of the
+// client's application
+func (c *Client) startCache() {
+	var filter *ari.Key
+	if c.appName != "" {
+		filter = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+
+	c.cache = newEntityCache(c.cacheMaxAge)
+	c.cacheSub = c.bus.Subscribe(filter, ari.Events.All)
+	if c.cacheSub == nil {
+		c.log.Warn("failed to subscribe to events; entity cache disabled")
+		c.cache = nil
+		return
+	}
+	go c.cache.run(c.cacheSub)
+}
+
 // Application is the application operation accessor
 func (c *Client) Application() ari.Application {
 	return &application{c}
@@ -508,25 +821,145 @@ func (c *Client) listRequest(req *proxy.Request) ([]*ari.Key, error) {
 }
 
 func (c *Client) makeRequest(class string, req *proxy.Request) (*proxy.Response, error) {
-	var resp proxy.Response
+	var resp *proxy.Response
 	var err error
 
+	if err = c.checkSupported(req); err != nil {
+		return nil, err
+	}
+
+	c.setTenant(req)
+	c.setAcceptEncoding(req)
+
 	if !c.completeCoordinates(req) {
 		return c.makeBroadcastRequestReturnFirstGoodResponse(class, req)
 	}
 
+	if !c.allowNode(req.Key.App, req.Key.Node) {
+		return nil, ErrNodeUnavailable
+	}
+
 	for i := 0; i <= c.core.timeoutRetries; i++ {
-		err = c.nc.Request(c.subject(class, req), req, &resp, c.requestTimeout)
+		var timeout time.Duration
+		if timeout, err = c.setDeadline(req, c.core.streamed[class]); err != nil {
+			return nil, err
+		}
+		if c.core.streamed[class] {
+			resp, err = c.streamRequest(c.subject(class, req), req, timeout)
+		} else {
+			resp, err = c.request(c.subject(class, req), req, timeout)
+		}
+		c.recordNode(req.Key.App, req.Key.Node, err)
 		if err == nats.ErrTimeout {
 			c.countTimeouts++
 			continue
 		}
-		return &resp, err
+		return resp, err
 	}
 
 	return nil, err
 }
 
+// allowNode indicates whether the circuit breaker, if enabled, allows a
+// request to the given node, pinging the cluster to probe the node once its
+// cooldown has elapsed
+func (c *Client) allowNode(app, node string) bool {
+	if c.core.breaker == nil {
+		return true
+	}
+	ok, probe := c.core.breaker.allow(app, node, time.Now())
+	if probe {
+		c.log.Debug("probing blacklisted node", "application", app, "node", node)
+		if err := c.core.nc.Publish(c.core.subjects.Ping(), &proxy.Request{}); err != nil {
+			c.log.Warn("failed to ping cluster", "error", err)
+		}
+	}
+	return ok
+}
+
+// recordNode records the outcome of a request to the given node with the
+// circuit breaker, if enabled
+func (c *Client) recordNode(app, node string, err error) {
+	if c.core.breaker == nil {
+		return
+	}
+	if c.core.breaker.record(app, node, err != nil, time.Now()) {
+		c.log.Warn("blacklisted node after failed requests", "application", app, "node", node)
+	}
+}
+
+// BlacklistedNodes returns the nodes to which the circuit breaker has stopped
+// routing requests.  It is empty if the circuit breaker is not enabled.
+func (c *Client) BlacklistedNodes() []BlacklistedNode {
+	if c.core.breaker == nil {
+		return nil
+	}
+	return c.core.breaker.blacklisted()
+}
+
+// request makes a single NATS request, waiting up to the given timeout for
+// the response and decoding it (if compressed or chunked)
+func (c *Client) request(subject string, req *proxy.Request, timeout time.Duration) (*proxy.Response, error) {
+	// A chunked response spans several messages, so it cannot be received
+	// with Conn.Request, which only delivers the first
+	inbox := nats.NewInbox()
+	sub, err := c.nc.Conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to response")
+	}
+	defer sub.Unsubscribe() // nolint: errcheck
+
+	if err = c.publishRequest(subject, inbox, req); err != nil {
+		return nil, err
+	}
+	return nextResponse(c.context(), sub, timeout)
+}
+
+// nextResponse waits, up to the given timeout, for the next response on the
+// subscription, reassembling it if it is chunked.  It returns
+// nats.ErrTimeout if no complete response is received in time, or the error
+// of the context if it is done first.
+func nextResponse(ctx context.Context, sub *nats.Subscription, timeout time.Duration) (*proxy.Response, error) {
+	var asm proxy.ChunkAssembler
+
+	wait, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		msg, err := sub.NextMsgWithContext(wait)
+		if err != nil {
+			if err == context.DeadlineExceeded && ctx.Err() == nil {
+				err = nats.ErrTimeout
+			}
+			return nil, err
+		}
+		if resp, err := asm.DecodeResponse(msg.Data); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+}
+
+// publishRequest publishes a request, encoded with the client's codec, with
+// the given reply subject, if any
+func (c *Client) publishRequest(subject, reply string, req *proxy.Request) error {
+	return proxy.EncodeWith(c.core.codec, req, func(data []byte) error {
+		if reply == "" {
+			return c.core.nc.Conn.Publish(subject, data)
+		}
+		return c.core.nc.Conn.PublishRequest(subject, reply, data)
+	})
+}
+
+// decodeReply decodes a reply message, reassembling chunked responses with
+// the given assembler and converting decoding failures into error responses.
+// It returns nil while a chunked response is incomplete.
+func decodeReply(asm *proxy.ChunkAssembler, m *nats.Msg) *proxy.Response {
+	resp, err := asm.DecodeResponse(m.Data)
+	if err != nil {
+		return proxy.NewErrorResponse(err)
+	}
+	return resp
+}
+
 func (c *Client) makeRequests(class string, req *proxy.Request) (responses []*proxy.Response, err error) {
 	if req == nil {
 		return nil, eris.New("empty request")
@@ -535,14 +968,31 @@ func (c *Client) makeRequests(class string, req *proxy.Request) (responses []*pr
 		req.Key = ari.NewKey("", "")
 	}
 
+	if err = c.checkSupported(req); err != nil {
+		return nil, err
+	}
+
+	c.setTenant(req)
+	c.setAcceptEncoding(req)
+
+	timeout, err := c.setDeadline(req, false)
+	if err != nil {
+		return nil, err
+	}
+
 	var responseCount int
 	expected := len(c.core.cluster.Matching(req.Key.Node, req.Key.App, c.core.clusterMaxAge))
 	reply := rid.New("rp")
 	replyChan := make(chan *proxy.Response)
-	replySub, err := c.core.nc.Subscribe(reply, func(o *proxy.Response) {
+	asm := new(proxy.ChunkAssembler)
+	replySub, err := c.core.nc.Subscribe(reply, func(m *nats.Msg) {
+		resp := decodeReply(asm, m)
+		if resp == nil {
+			return
+		}
 		responseCount++
 
-		replyChan <- o
+		replyChan <- resp
 
 		if responseCount >= expected {
 			close(replyChan)
@@ -554,16 +1004,19 @@ func (c *Client) makeRequests(class string, req *proxy.Request) (responses []*pr
 	defer replySub.Unsubscribe() // nolint: errcheck
 
 	// Make an all-call for the entity data
-	err = c.core.nc.PublishRequest(c.subject(class, req), reply, req)
+	err = c.publishRequest(c.subject(class, req), reply, req)
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to make request for data")
 	}
 
 	// Wait for replies
+	expired := time.After(timeout)
 	for {
 		select {
-		case <-time.After(c.requestTimeout):
+		case <-expired:
 			return responses, nil
+		case <-c.context().Done():
+			return responses, c.context().Err()
 		case resp, ok := <-replyChan:
 			if !ok {
 				return responses, nil
@@ -614,6 +1067,11 @@ func (c *Client) makeBroadcastRequestReturnFirstGoodResponse(class string, req *
 		req.Key = ari.NewKey("", "")
 	}
 
+	timeout, err := c.setDeadline(req, c.core.streamed[class])
+	if err != nil {
+		return nil, err
+	}
+
 	reply := rid.New("rp")
 
 	rf := &limitedResponseForwarder{
@@ -621,21 +1079,36 @@ func (c *Client) makeBroadcastRequestReturnFirstGoodResponse(class string, req *
 		fwdChan:  make(chan *proxy.Response),
 	}
 
-	replySub, err := c.core.nc.Subscribe(reply, rf.Forward)
+	asm := new(proxy.ChunkAssembler)
+	replySub, err := c.core.nc.Subscribe(reply, func(m *nats.Msg) {
+		if resp := decodeReply(asm, m); resp != nil {
+			rf.Forward(resp)
+		}
+	})
 	if err != nil {
 		return nil, eris.Wrap(err, "failed to subscribe to data responses")
 	}
 	defer replySub.Unsubscribe() // nolint: errcheck
 
-	// Make an all-call for the entity data
-	if err = c.core.nc.PublishRequest(c.subject(class, req), reply, req); err != nil {
+	// Make an all-call for the entity data.  A streamed request gives its
+	// reply subject in the request, as the stream acknowledges it on the NATS
+	// reply subject.
+	if c.core.streamed[class] {
+		req.ReplyTo = reply
+		err = c.publishRequest(c.subject(class, req), "", req)
+		req.ReplyTo = ""
+	} else {
+		err = c.publishRequest(c.subject(class, req), reply, req)
+	}
+	if err != nil {
 		return nil, eris.Wrap(err, "failed to make request for data")
 	}
 
 	// Wait for replies
+	expired := time.After(timeout)
 	for {
 		select {
-		case <-time.After(c.requestTimeout):
+		case <-expired:
 			// Return the last error if we got one; otherwise, return a timeout error
 			if err == nil {
 				err = eris.New("timeout")
@@ -659,6 +1132,22 @@ func (c *Client) makeBroadcastRequestReturnFirstGoodResponse(class string, req *
 	}
 }
 
+// setTenant attaches the client's tenant to the request, if the request does
+// not already declare one
+func (c *Client) setTenant(req *proxy.Request) {
+	if req != nil && req.Tenant == "" {
+		req.Tenant = c.tenant
+	}
+}
+
+// setAcceptEncoding declares the response encodings which the client can
+// decode
+func (c *Client) setAcceptEncoding(req *proxy.Request) {
+	if req != nil && len(req.AcceptEncoding) == 0 {
+		req.AcceptEncoding = []string{proxy.EncodingGzip, proxy.EncodingChunked}
+	}
+}
+
 func (c *Client) completeCoordinates(req *proxy.Request) bool {
 	if req == nil || req.Key == nil {
 		return false
@@ -670,9 +1159,9 @@ func (c *Client) completeCoordinates(req *proxy.Request) bool {
 
 func (c *Client) subject(class string, req *proxy.Request) string {
 	if req == nil || req.Key == nil {
-		return proxy.Subject(c.core.prefix, class, c.appName, "")
+		return c.core.subjects.Request(class, c.appName, "")
 	}
-	return proxy.Subject(c.core.prefix, class, req.Key.App, req.Key.Node)
+	return c.core.subjects.Request(class, req.Key.App, req.Key.Node)
 }
 
 // TimeoutCount is the amount of times the NATS communication times out
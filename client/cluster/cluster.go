@@ -128,6 +128,14 @@ func (c *Cluster) Update(id, app string) {
 	}
 }
 
+// Remove removes a proxy from the cluster (e.g. when it announces that it is
+// leaving)
+func (c *Cluster) Remove(id, app string) {
+	c.mu.Lock()
+	delete(c.members, hash(id, app))
+	c.mu.Unlock()
+}
+
 // Purge removes any proxies in the cluster which are older than the given maxAge.
 func (c *Cluster) Purge(maxAge time.Duration) {
 	c.mu.Lock()
@@ -107,3 +107,17 @@ func TestPurge(t *testing.T) {
 		t.Errorf("Incorrect number of cluster members: %d != 2", len(list))
 	}
 }
+
+func TestRemove(t *testing.T) {
+	c := New()
+	c.Update("A1", "TestApp")
+	c.Update("A2", "TestApp")
+
+	c.Remove("A1", "TestApp")
+	c.Remove("A3", "TestApp")
+
+	list := c.All(0)
+	if len(list) != 1 || list[0].ID != "A2" {
+		t.Errorf("unexpected cluster members %+v", list)
+	}
+}
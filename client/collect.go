@@ -0,0 +1,79 @@
+package client
+
+import (
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// StartCollectDigits starts collecting DTMF digits on the given channel.  The
+// collected digits are reported to the channel's subscribers by a
+// proxy.DigitsCollected event.
+func (c *Client) StartCollectDigits(key *ari.Key, opts *proxy.CollectDigits) error {
+	return c.commandRequest(&proxy.Request{
+		Kind:          "CollectDigits",
+		Key:           key,
+		CollectDigits: opts,
+	})
+}
+
+// CollectDigits collects DTMF digits on the given channel, optionally playing
+// a prompt, and waits for the collection to complete.  The reason of its
+// completion (e.g. proxy.CollectTimeout) is returned along with the digits.
+func (c *Client) CollectDigits(key *ari.Key, opts *proxy.CollectDigits) (*proxy.DigitsCollected, error) {
+	timeout := 10 * time.Second
+	interDigit := 5 * time.Second
+	if opts != nil && opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	if opts != nil && opts.InterDigitTimeout > 0 {
+		interDigit = opts.InterDigitTimeout
+	}
+
+	// Each digit restarts the server's timeout (a retry key restarts the
+	// longer first digit timeout), so wait for the completion as long as the
+	// channel receives digits
+	wait := timeout
+	if interDigit > wait {
+		wait = interDigit
+	}
+
+	// Subscribe before starting, so that the result is not missed
+	sub := c.Bus().Subscribe(key, proxy.EventDigitsCollected)
+	defer sub.Cancel()
+	dtmf := c.Bus().Subscribe(key, ari.Events.ChannelDtmfReceived)
+	defer dtmf.Cancel()
+
+	if err := c.StartCollectDigits(key, opts); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTimer(timeout + c.requestTimeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			return nil, eris.New("timed out waiting for collected digits")
+		case _, ok := <-dtmf.Events():
+			if !ok {
+				return nil, eris.New("subscription closed")
+			}
+			if !t.Stop() {
+				<-t.C
+			}
+			t.Reset(wait + c.requestTimeout)
+		case e, ok := <-sub.Events():
+			if !ok {
+				return nil, eris.New("subscription closed")
+			}
+			v, ok := e.(*proxy.DigitsCollected)
+			if !ok || v.ChannelID != key.ID {
+				continue
+			}
+			return v, nil
+		}
+	}
+}
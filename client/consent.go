@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// RecordWithConsent plays a consent announcement to the given channel and
+// starts recording it once consent has been obtained.  The returned handle
+// refers to the recording which will be created; the outcome of the workflow
+// is reported to the channel's subscribers by a proxy.RecordingConsent event.
+func (c *Client) RecordWithConsent(key *ari.Key, opts *proxy.ChannelRecordConsent) (*ari.LiveRecordingHandle, error) {
+	k, err := c.createRequest(&proxy.Request{
+		Kind:                 "ChannelRecordConsent",
+		Key:                  key,
+		ChannelRecordConsent: opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ari.NewLiveRecordingHandle(k, c.LiveRecording(), nil), nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// StartDebugCapture starts capturing, on the node identified by the given
+// key, the HTTP exchanges with Asterisk of the requests of the given kinds and
+// of the requests made in the given dialogs
+func (c *Client) StartDebugCapture(node *ari.Key, kinds, dialogs []string) error {
+	if node == nil || node.App == "" || node.Node == "" {
+		return eris.New("debug capture requires the key of a single node")
+	}
+	return c.commandRequest(&proxy.Request{
+		Kind: "DebugCaptureStart",
+		Key:  node,
+		DebugCapture: &proxy.DebugCapture{
+			Kinds:   kinds,
+			Dialogs: dialogs,
+		},
+	})
+}
+
+// StopDebugCapture stops capturing, on the node identified by the given key,
+// the exchanges of the given kinds and dialogs, or all exchanges if none are
+// given.  The exchanges already captured are kept.
+func (c *Client) StopDebugCapture(node *ari.Key, kinds, dialogs []string) error {
+	if node == nil || node.App == "" || node.Node == "" {
+		return eris.New("debug capture requires the key of a single node")
+	}
+	return c.commandRequest(&proxy.Request{
+		Kind: "DebugCaptureStop",
+		Key:  node,
+		DebugCapture: &proxy.DebugCapture{
+			Kinds:   kinds,
+			Dialogs: dialogs,
+		},
+	})
+}
+
+// DebugCapture returns the debug capture of the node identified by the given
+// key, with the exchanges captured for the given call (the ID of the entity
+// of the captured requests, e.g. a channel ID)
+func (c *Client) DebugCapture(node *ari.Key, call string) (*proxy.DebugCaptureData, error) {
+	if node == nil || node.App == "" || node.Node == "" {
+		return nil, eris.New("debug capture requires the key of a single node")
+	}
+	data, err := c.dataRequest(&proxy.Request{
+		Kind: "DebugCaptureData",
+		Key:  node,
+		DebugCapture: &proxy.DebugCapture{
+			Call: call,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.DebugCapture, nil
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultDialWait is the time for which DialAndWait waits for the result of a
+// dial which has no timeout
+const DefaultDialWait = 2 * time.Minute
+
+// CancelDial aborts the dial of the given channel, hanging it up with the
+// given reason (default "normal").  It fails if the channel is not being
+// dialed or has already been answered.
+func (c *Client) CancelDial(key *ari.Key, reason string) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "DialCancel",
+		Key:  key,
+		DialCancel: &proxy.DialCancel{
+			Reason: reason,
+		},
+	})
+}
+
+// DialAndWait dials the given channel and waits for the outcome of the dial,
+// as reported by the proxy.DialResult event.  The result is returned whether
+// or not the channel was answered; check its Result.  If no timeout is given,
+// the result is awaited for up to DefaultDialWait.
+func (c *Client) DialAndWait(key *ari.Key, caller string, timeout time.Duration) (*proxy.DialResult, error) {
+	wait := DefaultDialWait
+	if timeout > 0 {
+		wait = timeout
+	}
+
+	// Subscribe before dialing, so that the result is not missed
+	sub := c.Bus().Subscribe(key, proxy.EventDialResult)
+	defer sub.Cancel()
+
+	if err := c.Channel().Dial(key, caller, timeout); err != nil {
+		return nil, err
+	}
+
+	t := time.NewTimer(wait + c.requestTimeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			return nil, eris.New("timed out waiting for dial result")
+		case e, ok := <-sub.Events():
+			if !ok {
+				return nil, eris.New("subscription closed")
+			}
+			if v, ok := e.(*proxy.DialResult); ok && v.ChannelID == key.ID {
+				return v, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// StartCampaign starts an outbound dialer campaign.  The key optionally
+// identifies the campaign (by ID) and the dialog to which its calls are
+// bound.  The returned key identifies the campaign, including the node on
+// which it runs, for use with the other campaign methods.
+func (c *Client) StartCampaign(key *ari.Key, opts *proxy.Campaign) (*ari.Key, error) {
+	if key == nil {
+		key = ari.NewKey(proxy.CampaignKey, "")
+	}
+	return c.createRequest(&proxy.Request{
+		Kind:     "CampaignStart",
+		Key:      key,
+		Campaign: opts,
+	})
+}
+
+// PauseCampaign stops placing new calls for the given campaign
+func (c *Client) PauseCampaign(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "CampaignPause",
+		Key:  key,
+	})
+}
+
+// ResumeCampaign resumes placing calls for the given paused campaign
+func (c *Client) ResumeCampaign(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "CampaignResume",
+		Key:  key,
+	})
+}
+
+// StopCampaign stops the given campaign.  Calls in progress are not affected.
+func (c *Client) StopCampaign(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "CampaignStop",
+		Key:  key,
+	})
+}
+
+// CampaignStats returns the progress of the given campaign
+func (c *Client) CampaignStats(key *ari.Key) (*proxy.CampaignStats, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind: "CampaignStats",
+		Key:  key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.Campaign, nil
+}
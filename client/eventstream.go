@@ -0,0 +1,223 @@
+package client
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/bus"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+
+	"github.com/nats-io/nats.go"
+)
+
+// jetStreamAPIPrefix is the prefix of the subjects of the JetStream API
+const jetStreamAPIPrefix = "$JS.API"
+
+// StreamEvent is an event replayed from a JetStream event stream
+type StreamEvent struct {
+	ari.Event
+
+	// Sequence is the sequence number of the event in the stream.  A
+	// subscription which starts after it resumes after the event.
+	Sequence uint64
+}
+
+// StreamSubscription is a subscription to the events of the application
+// stored in a JetStream event stream (see server.EventStreamConfig)
+type StreamSubscription struct {
+	c        *Client
+	stream   string
+	consumer string
+	types    []string
+
+	sub    *nats.Subscription
+	events chan *StreamEvent
+
+	lastSeq uint64
+	closed  bool
+	mu      sync.RWMutex
+}
+
+// SubscribeStream subscribes to the events of the given types (or all
+// events, if none are given) of the client's application stored in the given
+// JetStream stream, starting with the event of the given sequence number.  A
+// client which restarts thus replays the events it missed by subscribing from
+// the sequence number following that of the last event it handled.  A
+// sequence number of zero subscribes to new events only.
+func (c *Client) SubscribeStream(stream string, startSeq uint64, types ...string) (*StreamSubscription, error) {
+	if stream == "" {
+		return nil, eris.New("no event stream")
+	}
+	if len(types) == 0 {
+		types = []string{ari.Events.All}
+	}
+
+	s := &StreamSubscription{
+		c:      c,
+		stream: stream,
+		types:  types,
+		events: make(chan *StreamEvent, bus.EventChanBufferLength),
+	}
+
+	deliver := nats.NewInbox()
+	var err error
+	s.sub, err = c.core.nc.Conn.Subscribe(deliver, s.receive)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to event stream")
+	}
+
+	s.consumer, err = c.createStreamConsumer(stream, deliver, startSeq)
+	if err != nil {
+		s.sub.Unsubscribe() // nolint: errcheck
+		return nil, err
+	}
+	return s, nil
+}
+
+// streamConsumerRequest is the JetStream API request which creates an
+// ephemeral push consumer
+type streamConsumerRequest struct {
+	Stream string `json:"stream_name"`
+	Config struct {
+		DeliverSubject string `json:"deliver_subject"`
+		DeliverPolicy  string `json:"deliver_policy"`
+		StartSeq       uint64 `json:"opt_start_seq,omitempty"`
+		AckPolicy      string `json:"ack_policy"`
+		FilterSubject  string `json:"filter_subject"`
+	} `json:"config"`
+}
+
+// streamConsumerResponse is the response of the JetStream API to the
+// creation of a consumer
+type streamConsumerResponse struct {
+	Name  string `json:"name"`
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// createStreamConsumer creates an ephemeral consumer of the client's events in
+// the given stream, returning its name
+func (c *Client) createStreamConsumer(stream, deliver string, startSeq uint64) (string, error) {
+	var req streamConsumerRequest
+	req.Stream = stream
+	req.Config.DeliverSubject = deliver
+	req.Config.DeliverPolicy = "new"
+	if startSeq > 0 {
+		req.Config.DeliverPolicy = "by_start_sequence"
+		req.Config.StartSeq = startSeq
+	}
+	req.Config.AckPolicy = "none"
+	req.Config.FilterSubject = c.core.subjects.Event(c.appName, "")
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	msg, err := c.core.nc.Conn.Request(jetStreamAPIPrefix+".CONSUMER.CREATE."+stream, data, c.requestTimeout)
+	if err != nil {
+		return "", eris.Wrap(err, "JetStream API request failed")
+	}
+
+	var resp streamConsumerResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return "", eris.Wrap(err, "invalid JetStream API response")
+	}
+	if resp.Error != nil {
+		return "", eris.Errorf("JetStream error %d: %s", resp.Error.Code, resp.Error.Description)
+	}
+	return resp.Name, nil
+}
+
+// streamSequence returns the stream sequence number of a message delivered by
+// a JetStream consumer, from its reply subject
+// ($JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>.<time>.<pending>,
+// or, with a domain and account hash, two tokens after <stream>)
+func streamSequence(reply string) (uint64, error) {
+	tokens := strings.Split(reply, ".")
+	if len(tokens) < 9 || tokens[0] != "$JS" || tokens[1] != "ACK" {
+		return 0, eris.Errorf("not a JetStream delivery: %q", reply)
+	}
+	i := 5
+	if len(tokens) > 9 {
+		i = 7
+	}
+	return strconv.ParseUint(tokens[i], 10, 64)
+}
+
+func (s *StreamSubscription) receive(m *nats.Msg) {
+	seq, err := streamSequence(m.Reply)
+	if err != nil {
+		s.c.log.Error("invalid event stream delivery", "error", err)
+		return
+	}
+	e, err := proxy.DecodeEvent(m.Data)
+	if err != nil {
+		s.c.log.Error("failed to decode stream event", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.lastSeq = seq
+	s.mu.Unlock()
+
+	if !s.matches(e) {
+		return
+	}
+	s.mu.RLock()
+	if !s.closed {
+		s.events <- &StreamEvent{Event: e, Sequence: seq}
+	}
+	s.mu.RUnlock()
+}
+
+func (s *StreamSubscription) matches(e ari.Event) bool {
+	for _, typ := range s.types {
+		if typ == ari.Events.All || typ == e.GetType() {
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns the channel on which the events are delivered
+func (s *StreamSubscription) Events() <-chan *StreamEvent {
+	return s.events
+}
+
+// Sequence returns the sequence number of the last event received from the
+// stream, including the events which did not match the subscription
+func (s *StreamSubscription) Sequence() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSeq
+}
+
+// Cancel ends the subscription, deleting its consumer
+func (s *StreamSubscription) Cancel() {
+	if s == nil {
+		return
+	}
+
+	if err := s.sub.Unsubscribe(); err != nil {
+		s.c.log.Debug("failed to unsubscribe from event stream", "error", err)
+	}
+	if s.consumer != "" {
+		subject := jetStreamAPIPrefix + ".CONSUMER.DELETE." + s.stream + "." + s.consumer
+		if _, err := s.c.core.nc.Conn.Request(subject, nil, s.c.requestTimeout); err != nil {
+			s.c.log.Debug("failed to delete event stream consumer", "consumer", s.consumer, "error", err)
+		}
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+}
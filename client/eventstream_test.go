@@ -0,0 +1,124 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamSequence(t *testing.T) {
+	for reply, expected := range map[string]uint64{
+		"$JS.ACK.EVENTS.abc123.1.42.7.1600000000000000000.0":               42,
+		"$JS.ACK.hub.ACCHASH.EVENTS.abc123.1.43.8.1600000000000000000.0.x": 43,
+	} {
+		seq, err := streamSequence(reply)
+		if err != nil || seq != expected {
+			t.Errorf("%s: expected sequence %d, got %d (%v)", reply, expected, seq, err)
+		}
+	}
+
+	for _, reply := range []string{"", "_INBOX.abc", "$JS.ACK.EVENTS.abc123.1.x.7.0.0"} {
+		if _, err := streamSequence(reply); err == nil {
+			t.Errorf("%q: expected error", reply)
+		}
+	}
+}
+
+func TestSubscribeStream(t *testing.T) {
+	c, nc, done := newStreamTest(t)
+	defer done()
+
+	// The test plays the part of the JetStream API, creating the consumer
+	// and recording its deletion
+	consumers := make(chan *streamConsumerRequest, 1)
+	deleted := make(chan string, 1)
+	if _, err := nc.Subscribe(jetStreamAPIPrefix+".CONSUMER.CREATE.EVENTS", func(m *nats.Msg) {
+		req := new(streamConsumerRequest)
+		if err := json.Unmarshal(m.Data, req); err != nil {
+			t.Error(err)
+		}
+		consumers <- req
+		nc.Publish(m.Reply, []byte(`{"name":"cons1"}`)) // nolint: errcheck
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nc.Subscribe(jetStreamAPIPrefix+".CONSUMER.DELETE.EVENTS.*", func(m *nats.Msg) {
+		deleted <- m.Subject
+		nc.Publish(m.Reply, []byte(`{"success":true}`)) // nolint: errcheck
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := c.SubscribeStream("EVENTS", 41, ari.Events.ChannelHangupRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-consumers
+	if req.Stream != "EVENTS" || req.Config.DeliverPolicy != "by_start_sequence" || req.Config.StartSeq != 41 ||
+		req.Config.AckPolicy != "none" || req.Config.FilterSubject != "ari.event.app.>" {
+		t.Errorf("unexpected consumer: %+v", req)
+	}
+
+	// The consumer delivers the stored events, of which the subscription
+	// only passes on those of its types
+	deliver := func(seq uint64, e ari.Event) {
+		err := proxy.EncodeEvent(e, nil, func(data []byte) error {
+			reply := fmt.Sprintf("$JS.ACK.EVENTS.cons1.1.%d.%d.1600000000000000000.0", seq, seq-40)
+			return nc.PublishRequest(req.Config.DeliverSubject, reply, data)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliver(41, &ari.ChannelHangupRequest{
+		EventData: ari.EventData{Type: ari.Events.ChannelHangupRequest, Application: "app"},
+		Channel:   ari.ChannelData{ID: "c1"},
+	})
+	deliver(42, &ari.StasisStart{
+		EventData: ari.EventData{Type: ari.Events.StasisStart, Application: "app"},
+		Channel:   ari.ChannelData{ID: "c2"},
+	})
+	deliver(43, &ari.ChannelHangupRequest{
+		EventData: ari.EventData{Type: ari.Events.ChannelHangupRequest, Application: "app"},
+		Channel:   ari.ChannelData{ID: "c3"},
+	})
+
+	for _, expected := range []struct {
+		seq     uint64
+		channel string
+	}{{41, "c1"}, {43, "c3"}} {
+		select {
+		case e := <-sub.Events():
+			v, ok := e.Event.(*ari.ChannelHangupRequest)
+			if !ok || e.Sequence != expected.seq || v.Channel.ID != expected.channel {
+				t.Errorf("unexpected event %d: %+v", e.Sequence, e.Event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", expected.seq)
+		}
+	}
+	if seq := sub.Sequence(); seq != 43 {
+		t.Errorf("unexpected sequence %d", seq)
+	}
+
+	sub.Cancel()
+	select {
+	case subject := <-deleted:
+		if subject != jetStreamAPIPrefix+".CONSUMER.DELETE.EVENTS.cons1" {
+			t.Errorf("unexpected deletion: %s", subject)
+		}
+	case <-time.After(time.Second):
+		t.Error("consumer not deleted")
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("events not closed")
+	}
+}
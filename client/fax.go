@@ -0,0 +1,28 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// SendFax sends a fax on the given channel.  The channel leaves the ARI
+// application for the duration of the transfer, and the result is reported by
+// a proxy.FaxFinished event.
+func (c *Client) SendFax(key *ari.Key, opts *proxy.Fax) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "FaxSend",
+		Key:  key,
+		Fax:  opts,
+	})
+}
+
+// ReceiveFax receives a fax on the given channel.  The channel leaves the ARI
+// application for the duration of the transfer, and the result is reported by
+// a proxy.FaxFinished event.
+func (c *Client) ReceiveFax(key *ari.Key, opts *proxy.Fax) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "FaxReceive",
+		Key:  key,
+		Fax:  opts,
+	})
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// ChannelDataFields returns the data of the given channel, restricted to the
+// given fields (named by their JSON names, e.g. "state").  The key and ID are
+// always included.
+func (c *Client) ChannelDataFields(key *ari.Key, fields ...string) (*ari.ChannelData, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind:   "ChannelData",
+		Key:    key,
+		Fields: fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.Channel, nil
+}
+
+// BridgeDataFields returns the data of the given bridge, restricted to the
+// given fields (named by their JSON names, e.g. "channels").  The key and ID
+// are always included.
+func (c *Client) BridgeDataFields(key *ari.Key, fields ...string) (*ari.BridgeData, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind:   "BridgeData",
+		Key:    key,
+		Fields: fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.Bridge, nil
+}
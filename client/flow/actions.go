@@ -0,0 +1,70 @@
+package flow
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// Goto moves the flow to the given state
+func Goto(next string) Action {
+	return func(*Context) (string, error) {
+		return next, nil
+	}
+}
+
+// Answer answers the channel
+func Answer() Action {
+	return func(c *Context) (string, error) {
+		return "", c.Session.Answer()
+	}
+}
+
+// Hangup hangs up the channel
+func Hangup() Action {
+	return func(c *Context) (string, error) {
+		return "", c.Session.Hangup()
+	}
+}
+
+// Play plays the given media URIs in sequence and waits for their completion
+// (see session.CallSession.PlayAndWait).  The digits received during the
+// playback trigger the DTMF transitions of the state once the actions of the
+// state complete.
+func Play(uris ...string) Action {
+	return func(c *Context) (string, error) {
+		return "", c.Session.PlayAndWait(uris...)
+	}
+}
+
+// Set sets the variable of the given name
+func Set(name, value string) Action {
+	return func(c *Context) (string, error) {
+		c.Vars[name] = value
+		return "", nil
+	}
+}
+
+// Gather plays the given prompt, if any, and collects DTMF digits as described
+// by the options (see session.CallSession.GatherDigits), storing them in the
+// variable of the given name
+func Gather(prompt string, opts *proxy.CollectDigits, name string) Action {
+	return func(c *Context) (string, error) {
+		digits, err := c.Session.GatherDigits(prompt, opts)
+		if err != nil {
+			return "", err
+		}
+		c.Vars[name] = digits
+		return "", nil
+	}
+}
+
+// Switch moves the flow to the state which the given cases map the value of
+// the variable of the given name to, or else to the default state, if not
+// empty
+func Switch(name string, cases map[string]string, def string) Action {
+	return func(c *Context) (string, error) {
+		if next, ok := cases[c.Vars[name]]; ok {
+			return next, nil
+		}
+		return def, nil
+	}
+}
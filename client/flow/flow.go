@@ -0,0 +1,331 @@
+// Package flow defines call flows as state machines, which the client executes
+// over the proxy on a call session (see session.CallSession), so that the
+// call-flow logic of applications is written in a common form:
+//
+//	f := flow.New("menu")
+//	f.State("menu").
+//		Enter(flow.Play("sound:press-1-for-sales")).
+//		OnDTMF("1", "sales").
+//		OnDTMF("", "menu").
+//		OnTimeout(10*time.Second, "goodbye")
+//	f.State("sales").
+//		Enter(flow.Gather("sound:enter-account", &proxy.CollectDigits{MaxDigits: 6}, "account"),
+//			flow.Switch("account", map[string]string{"": "goodbye"}, "transfer"))
+//	f.State("transfer").Enter(transfer)
+//	f.State("goodbye").Enter(flow.Play("sound:vm-goodbye"), flow.Hangup()).Final()
+//
+//	err := f.Run(s, store)
+//
+// On entering a state, the flow runs the actions of the state in order.  An
+// action may move the flow to another state directly; otherwise, the flow
+// waits for a transition of the state: a DTMF digit, an event of the channel,
+// or the timeout of the state.  The flow ends after the actions of a final
+// state, or when the session ends.
+//
+// The state and variables of a flow are saved to a Store, if given, on each
+// transition, so that a flow interrupted by the restart of its application
+// may be resumed by running it again on the same channel.  A resumed flow
+// re-enters the saved state, running its actions again.
+package flow
+
+import (
+	"sort"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/session"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// Action is an action of a state, run when the flow enters the state.  It
+// returns the state to which the flow moves, skipping the remaining actions
+// and the transitions of the state, or "" to continue.
+type Action func(c *Context) (next string, err error)
+
+// Context is the execution context of a flow, passed to its actions
+type Context struct {
+	// Session is the call session on which the flow runs
+	Session *session.CallSession
+
+	// State is the current state of the flow
+	State string
+
+	// Vars are the variables of the flow, which are saved with its state
+	Vars map[string]string
+
+	// Event is the event which triggered the transition to the current
+	// state, if any (e.g. an *ari.ChannelDtmfReceived)
+	Event ari.Event
+}
+
+// State is a state of a flow
+type State struct {
+	name string
+
+	actions []Action
+
+	// digits maps DTMF digits to the states to which they transition, ""
+	// matching any other digit
+	digits map[string]string
+
+	// events maps event types to the states to which they transition
+	events map[string]string
+
+	timeout   time.Duration
+	onTimeout string
+
+	final bool
+}
+
+// Enter appends actions to run when the flow enters the state
+func (st *State) Enter(actions ...Action) *State {
+	st.actions = append(st.actions, actions...)
+	return st
+}
+
+// OnDTMF transitions to the next state when the given DTMF digit is received
+// on the channel, or any digit without a transition of its own, if digit is
+// empty
+func (st *State) OnDTMF(digit, next string) *State {
+	if st.digits == nil {
+		st.digits = make(map[string]string)
+	}
+	st.digits[digit] = next
+	return st
+}
+
+// OnEvent transitions to the next state when an event of the given type is
+// received on the channel (e.g. "ChannelHold").  The transitions of DTMF
+// digits take precedence for ChannelDtmfReceived events.
+func (st *State) OnEvent(typ, next string) *State {
+	if st.events == nil {
+		st.events = make(map[string]string)
+	}
+	st.events[typ] = next
+	return st
+}
+
+// OnTimeout transitions to the next state if no other transition occurs
+// within the given duration of the completion of the actions of the state
+func (st *State) OnTimeout(d time.Duration, next string) *State {
+	st.timeout = d
+	st.onTimeout = next
+	return st
+}
+
+// Final marks the state as final: the flow ends after its actions
+func (st *State) Final() *State {
+	st.final = true
+	return st
+}
+
+// eventTypes returns the types of the events on which the state transitions
+func (st *State) eventTypes() []string {
+	var types []string
+	if len(st.digits) > 0 {
+		types = append(types, ari.Events.ChannelDtmfReceived)
+	}
+	for typ := range st.events {
+		if typ != ari.Events.ChannelDtmfReceived || len(st.digits) == 0 {
+			types = append(types, typ)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// transition returns the state to which the given event transitions, or ""
+// if it does not
+func (st *State) transition(e ari.Event) string {
+	if d, ok := e.(*ari.ChannelDtmfReceived); ok && len(st.digits) > 0 {
+		if next, ok := st.digits[d.Digit]; ok {
+			return next
+		}
+		return st.digits[""]
+	}
+	return st.events[e.GetType()]
+}
+
+// targets returns the states to which the state transitions
+func (st *State) targets() []string {
+	var ret []string
+	for _, next := range st.digits {
+		ret = append(ret, next)
+	}
+	for _, next := range st.events {
+		ret = append(ret, next)
+	}
+	if st.timeout > 0 {
+		ret = append(ret, st.onTimeout)
+	}
+	return ret
+}
+
+// Flow is the definition of a call flow as a state machine
+type Flow struct {
+	initial string
+
+	states map[string]*State
+}
+
+// New returns a new flow which starts in the given state
+func New(initial string) *Flow {
+	return &Flow{
+		initial: initial,
+		states:  make(map[string]*State),
+	}
+}
+
+// State returns the state of the given name, adding it to the flow if it does
+// not yet exist
+func (f *Flow) State(name string) *State {
+	st, ok := f.states[name]
+	if !ok {
+		st = &State{name: name}
+		f.states[name] = st
+	}
+	return st
+}
+
+// Validate checks that the initial state and the targets of the transitions
+// of the flow are defined, and that every state which is not final has
+// actions or transitions
+func (f *Flow) Validate() error {
+	if _, ok := f.states[f.initial]; !ok {
+		return eris.Errorf("initial state %q is not defined", f.initial)
+	}
+	for name, st := range f.states {
+		if !st.final && len(st.actions) == 0 && len(st.targets()) == 0 {
+			return eris.Errorf("state %q has neither actions nor transitions", name)
+		}
+		if st.timeout < 0 {
+			return eris.Errorf("state %q has a negative timeout", name)
+		}
+		for _, next := range st.targets() {
+			if _, ok := f.states[next]; !ok {
+				return eris.Errorf("state %q transitions to undefined state %q", name, next)
+			}
+		}
+	}
+	return nil
+}
+
+// Run executes the flow on the given session until the flow ends, returning
+// session.ErrHangup if the channel hangs up first.  If a store is given, the
+// flow resumes from the state saved for the channel, if any, and saves its
+// state on each transition.  The saved state is deleted once the flow ends,
+// or when the channel hangs up, but kept if the flow fails or the session is
+// closed, so that the flow may be resumed.
+func (f *Flow) Run(s *session.CallSession, store Store) error {
+	if err := f.Validate(); err != nil {
+		return eris.Wrap(err, "invalid flow")
+	}
+
+	id := s.Channel().ID()
+	c := &Context{
+		Session: s,
+		State:   f.initial,
+		Vars:    make(map[string]string),
+	}
+	if store != nil {
+		snap, err := store.Load(id)
+		if err != nil {
+			return eris.Wrap(err, "failed to load the state of the flow")
+		}
+		if snap != nil {
+			if _, ok := f.states[snap.State]; !ok {
+				return eris.Errorf("saved state %q is not defined", snap.State)
+			}
+			c.State = snap.State
+			if snap.Vars != nil {
+				c.Vars = snap.Vars
+			}
+		}
+	}
+
+	for {
+		if store != nil {
+			if err := store.Save(id, &Snapshot{State: c.State, Vars: c.Vars}); err != nil {
+				return eris.Wrap(err, "failed to save the state of the flow")
+			}
+		}
+
+		next, err := f.enter(c)
+		if (err == nil && next == "") || eris.Is(err, session.ErrHangup) {
+			if store != nil {
+				if derr := store.Delete(id); derr != nil && err == nil {
+					err = eris.Wrap(derr, "failed to delete the state of the flow")
+				}
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := f.states[next]; !ok {
+			return eris.Errorf("state %q moved to undefined state %q", c.State, next)
+		}
+		c.State = next
+	}
+}
+
+// enter runs the actions of the current state and waits for its transition,
+// returning the next state, or "" if the state is final
+func (f *Flow) enter(c *Context) (string, error) {
+	st := f.states[c.State]
+
+	// Subscribe before running the actions, so that the digits entered
+	// during a prompt are not missed
+	var events <-chan ari.Event
+	if types := st.eventTypes(); len(types) > 0 {
+		sub := c.Session.Channel().Subscribe(types...)
+		if sub == nil {
+			return "", eris.Errorf("failed to subscribe to the events of state %q", st.name)
+		}
+		defer sub.Cancel()
+		events = sub.Events()
+	}
+
+	for _, a := range st.actions {
+		next, err := a(c)
+		if eris.Is(err, session.ErrHangup) {
+			return "", session.ErrHangup
+		}
+		if err != nil {
+			return "", eris.Wrapf(err, "action of state %q failed", st.name)
+		}
+		if next != "" {
+			c.Event = nil
+			return next, nil
+		}
+	}
+	if st.final {
+		return "", nil
+	}
+
+	var timeout <-chan time.Time
+	if st.timeout > 0 {
+		t := time.NewTimer(st.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for {
+		select {
+		case <-c.Session.Done():
+			return "", c.Session.Wait()
+		case <-timeout:
+			c.Event = nil
+			return st.onTimeout, nil
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if next := st.transition(e); next != "" {
+				c.Event = e
+				return next, nil
+			}
+		}
+	}
+}
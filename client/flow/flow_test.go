@@ -0,0 +1,149 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client/session"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+// newSession returns a session on a mock channel, along with the channels of
+// the hangup and DTMF events of the channel
+func newSession() (*session.CallSession, *arimocks.Channel, chan ari.Event, chan ari.Event) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	hangups := make(chan ari.Event, 1)
+	digits := make(chan ari.Event, 10)
+
+	hangupSub := new(arimocks.Subscription)
+	hangupSub.On("Events").Return((<-chan ari.Event)(hangups))
+	hangupSub.On("Cancel").Return()
+
+	digitSub := new(arimocks.Subscription)
+	digitSub.On("Events").Return((<-chan ari.Event)(digits))
+	digitSub.On("Cancel").Return()
+
+	ch := new(arimocks.Channel)
+	ch.On("Subscribe", key, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(hangupSub)
+	ch.On("Subscribe", key, ari.Events.ChannelDtmfReceived).Return(digitSub)
+	ch.On("Answer", key).Return(nil)
+
+	s := session.New(context.Background(), new(arimocks.Client), ari.NewChannelHandle(key, ch, nil))
+	return s, ch, hangups, digits
+}
+
+func menuFlow() *Flow {
+	f := New("menu")
+	f.State("menu").
+		Enter(Answer()).
+		OnDTMF("1", "sales").
+		OnDTMF("", "menu").
+		OnTimeout(time.Minute, "done")
+	f.State("sales").Enter(Set("department", "sales"), Goto("done"), Set("department", "skipped"))
+	f.State("done").Final()
+	return f
+}
+
+func TestRun(t *testing.T) {
+	s, ch, _, digits := newSession()
+	defer s.Close()
+
+	// The first digit has no transition of its own, and re-enters the menu
+	digits <- &ari.ChannelDtmfReceived{EventData: ari.EventData{Type: ari.Events.ChannelDtmfReceived}, Digit: "9"}
+
+	store := NewMemStore()
+	done := make(chan error, 1)
+	go func() {
+		done <- menuFlow().Run(s, store)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	digits <- &ari.ChannelDtmfReceived{EventData: ari.EventData{Type: ari.Events.ChannelDtmfReceived}, Digit: "1"}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("flow failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flow did not end")
+	}
+	ch.AssertNumberOfCalls(t, "Answer", 2)
+
+	if snap, _ := store.Load("c1"); snap != nil {
+		t.Errorf("state left behind: %+v", snap)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	s, ch, _, _ := newSession()
+	defer s.Close()
+
+	var vars map[string]string
+	f := menuFlow()
+	f.State("done").Enter(func(c *Context) (string, error) {
+		vars = c.Vars
+		return "", nil
+	})
+
+	store := NewMemStore()
+	store.Save("c1", &Snapshot{State: "sales", Vars: map[string]string{"caller": "alice"}}) // nolint: errcheck
+
+	if err := f.Run(s, store); err != nil {
+		t.Fatalf("flow failed: %v", err)
+	}
+	if vars["caller"] != "alice" || vars["department"] != "sales" {
+		t.Errorf("unexpected variables %v", vars)
+	}
+	ch.AssertNotCalled(t, "Answer", ari.NewKey(ari.ChannelKey, "c1"))
+}
+
+func TestRunHangup(t *testing.T) {
+	s, _, hangups, _ := newSession()
+	defer s.Close()
+
+	store := NewMemStore()
+	done := make(chan error, 1)
+	go func() {
+		done <- menuFlow().Run(s, store)
+	}()
+
+	hangups <- &ari.StasisEnd{}
+	select {
+	case err := <-done:
+		if err != session.ErrHangup {
+			t.Errorf("expected ErrHangup, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flow did not end on hangup")
+	}
+	if snap, _ := store.Load("c1"); snap != nil {
+		t.Errorf("state left behind: %+v", snap)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, f := range map[string]*Flow{
+		"initial": New("start"),
+		"target": func() *Flow {
+			f := New("start")
+			f.State("start").OnDTMF("1", "missing")
+			return f
+		}(),
+		"dead end": func() *Flow {
+			f := New("start")
+			f.State("start")
+			return f
+		}(),
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := menuFlow().Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
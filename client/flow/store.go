@@ -0,0 +1,82 @@
+package flow
+
+import "sync"
+
+// Snapshot is the saved state of a flow
+type Snapshot struct {
+	// State is the current state of the flow
+	State string `json:"state"`
+
+	// Vars are the variables of the flow
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// Store persists the state of flows, by channel ID, so that they may be
+// resumed (e.g. by another instance of the application, in a shared store)
+type Store interface {
+	// Load returns the saved state of the flow of the given channel, or nil
+	// if there is none
+	Load(id string) (*Snapshot, error)
+
+	// Save saves the state of the flow of the given channel
+	Save(id string, snap *Snapshot) error
+
+	// Delete deletes the saved state of the flow of the given channel
+	Delete(id string) error
+}
+
+// MemStore is a Store which keeps the state of flows in memory, resuming the
+// flows interrupted within the application (e.g. by the closure of their
+// sessions)
+type MemStore struct {
+	snaps map[string]Snapshot
+
+	mu sync.Mutex
+}
+
+// NewMemStore returns a new, empty MemStore
+func NewMemStore() *MemStore {
+	return &MemStore{
+		snaps: make(map[string]Snapshot),
+	}
+}
+
+// Load implements Store
+func (m *MemStore) Load(id string) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap, ok := m.snaps[id]
+	if !ok {
+		return nil, nil
+	}
+	snap.Vars = copyVars(snap.Vars)
+	return &snap, nil
+}
+
+// Save implements Store
+func (m *MemStore) Save(id string, snap *Snapshot) error {
+	m.mu.Lock()
+	m.snaps[id] = Snapshot{State: snap.State, Vars: copyVars(snap.Vars)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements Store
+func (m *MemStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.snaps, id)
+	m.mu.Unlock()
+	return nil
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	if vars == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(vars))
+	for k, v := range vars {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,14 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// EventHeader returns the header which the proxy set on the given event,
+// describing its origin (application, Asterisk node, proxy version), its
+// dialog, and its sequence number.  The header is empty for events which were
+// not received from a proxy.
+func EventHeader(e ari.Event) proxy.EventHeader {
+	return proxy.GetEventHeader(e)
+}
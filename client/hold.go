@@ -0,0 +1,29 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// CallHold places the given channel on hold and plays it music on hold of the
+// given class (or the default class, if empty).  The change is reported by a
+// proxy.HoldStateChanged event.
+func (c *Client) CallHold(key *ari.Key, mohClass string) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "CallHold",
+		Key:  key,
+		CallHold: &proxy.CallHold{
+			MOHClass: mohClass,
+		},
+	})
+}
+
+// CallResume retrieves the given channel from a hold started by CallHold.  The
+// change, with the duration of the hold, is reported by a
+// proxy.HoldStateChanged event.
+func (c *Client) CallResume(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "CallResume",
+		Key:  key,
+	})
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultPageSize is the default number of keys retrieved per page by a
+// KeyIterator
+var DefaultPageSize = 100
+
+// KeyIterator iterates over the results of a list request, retrieving them
+// from the cluster one page at a time
+type KeyIterator struct {
+	c   *Client
+	req proxy.Request
+
+	limit  int
+	cursor string
+
+	page []*ari.Key
+	cur  *ari.Key
+	last bool
+	err  error
+}
+
+// Iterate returns an iterator over the results of the given list request
+// (e.g. a "ChannelList" request), retrieving pageSize keys at a time.  If
+// pageSize is not positive, DefaultPageSize is used.
+//
+//   it := cl.Iterate(&proxy.Request{Kind: "ChannelList"}, 0)
+//   for it.Next() {
+//   	fmt.Println(it.Key().ID)
+//   }
+//   if err := it.Err(); err != nil {
+//   	...
+//   }
+func (c *Client) Iterate(req *proxy.Request, pageSize int) *KeyIterator {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &KeyIterator{
+		c:     c,
+		req:   *req,
+		limit: pageSize,
+	}
+}
+
+// Next advances the iterator to the next key, retrieving the next page if
+// necessary.  It returns false when there are no further keys or an error has
+// occurred.
+func (it *KeyIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if len(it.page) == 0 {
+		if it.last {
+			return false
+		}
+		it.page, it.cursor, it.err = it.c.listPage(&it.req, proxy.Pagination{Cursor: it.cursor, Limit: it.limit})
+		if it.err != nil {
+			return false
+		}
+		it.last = it.cursor == ""
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Key returns the current key
+func (it *KeyIterator) Key() *ari.Key {
+	return it.cur
+}
+
+// Err returns the error, if any, which stopped the iteration
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// listPage retrieves one page of the results of a list request from the
+// cluster.  Each node returns its own page; the pages are merged and cut to
+// the limit, and the next cursor is returned if any node has further results.
+// The page fails if any node fails to return its own.
+func (c *Client) listPage(req *proxy.Request, p proxy.Pagination) ([]*ari.Key, string, error) {
+	r := *req
+	r.Pagination = &p
+
+	responses, err := c.makeRequests("get", &r)
+	if err != nil {
+		return nil, "", err
+	}
+	return mergePages(responses, p.Limit)
+}
+
+// mergePages merges the pages returned by the nodes of the cluster, cutting
+// them to the limit.  A page is incomplete if any node failed to return its
+// own, so the error of the first failed node is returned instead.
+func mergePages(responses []*proxy.Response, limit int) ([]*ari.Key, string, error) {
+	var list []*ari.Key
+	var more bool
+	for _, resp := range responses {
+		if err := resp.Err(); err != nil {
+			return nil, "", eris.Wrapf(err, "failed to list the page of proxy %s", resp.Instance)
+		}
+		list = append(list, resp.Keys...)
+		if resp.NextCursor != "" {
+			more = true
+		}
+	}
+
+	proxy.SortKeys(list)
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+		more = true
+	}
+
+	var next string
+	if more && len(list) > 0 {
+		next = proxy.KeyCursor(list[len(list)-1])
+	}
+	return list, next, nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func channelKeys(ids ...string) []*ari.Key {
+	ret := make([]*ari.Key, len(ids))
+	for i, id := range ids {
+		ret[i] = ari.NewKey(ari.ChannelKey, id)
+	}
+	return ret
+}
+
+func TestMergePages(t *testing.T) {
+	list, next, err := mergePages([]*proxy.Response{
+		{Keys: channelKeys("c", "d"), NextCursor: proxy.KeyCursor(ari.NewKey(ari.ChannelKey, "d"))},
+		{Keys: channelKeys("a", "e")},
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].ID != "a" || list[2].ID != "d" {
+		t.Errorf("unexpected page %v", list)
+	}
+	if next != proxy.KeyCursor(list[2]) {
+		t.Errorf("unexpected cursor %q", next)
+	}
+
+	// The last page has no cursor
+	if _, next, err := mergePages([]*proxy.Response{{Keys: channelKeys("a")}, {}}, 3); err != nil || next != "" {
+		t.Errorf("unexpected cursor %q (%v)", next, err)
+	}
+}
+
+func TestMergePagesFailedNode(t *testing.T) {
+	// The keys of the other nodes do not hide the failure of one
+	failed := proxy.NewErrorResponse(errors.New("ARI connection is down"))
+	failed.Instance = "in-2"
+	list, next, err := mergePages([]*proxy.Response{
+		{Keys: channelKeys("a", "b"), Instance: "in-1"},
+		failed,
+		{Keys: channelKeys("c"), Instance: "in-3"},
+	}, 10)
+	if err == nil {
+		t.Fatalf("expected an error, got page %v", list)
+	}
+	if list != nil || next != "" {
+		t.Errorf("unexpected partial page %v (cursor %q)", list, next)
+	}
+}
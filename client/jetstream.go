@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrStreamedRequestTimeout indicates that a request was stored in the
+// JetStream stream, but that no response arrived within the request timeout.
+// The request is not retried, as it is still delivered to a proxy.
+var ErrStreamedRequestTimeout = eris.New("streamed request stored, but not answered in time")
+
+// WithJetStream configures the Client to make the requests of the given
+// classes ("create" and/or "command"; both, if none are given) through the
+// JetStream stream which captures their subjects, for proxies which consume
+// them from the stream (see server.JetStreamConfig).  A request is then only
+// lost if it cannot be stored in the stream, and is executed even if the
+// proxy which received it crashes, at the cost of being executed again if
+// the proxy crashed after executing it.
+func WithJetStream(classes ...string) OptionFunc {
+	return func(c *Client) {
+		if len(classes) == 0 {
+			classes = []string{"create", "command"}
+		}
+		c.core.streamed = make(map[string]bool)
+		for _, class := range classes {
+			c.core.streamed[class] = true
+		}
+	}
+}
+
+// pubAck is the acknowledgment with which a JetStream stream answers the
+// publication of a message which it stored
+type pubAck struct {
+	Stream string          `json:"stream"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// streamAck interprets the answer to the publication of a streamed request.
+// It is normally the acknowledgment of the stream, but may be the response of
+// a proxy which received the request directly (e.g. if no stream captures its
+// subject), in which case the response is returned.
+func streamAck(data []byte) (*proxy.Response, error) {
+	var ack pubAck
+	if err := json.Unmarshal(data, &ack); err == nil {
+		if ack.Stream != "" {
+			return nil, nil
+		}
+		if len(ack.Error) > 0 && ack.Error[0] == '{' {
+			var e struct {
+				Code        int    `json:"code"`
+				Description string `json:"description"`
+			}
+			if err := json.Unmarshal(ack.Error, &e); err != nil {
+				return nil, eris.Wrap(err, "invalid JetStream error")
+			}
+			return nil, eris.Errorf("JetStream error %d: %s", e.Code, e.Description)
+		}
+	}
+	return proxy.DecodeResponse(data)
+}
+
+// streamRequest makes a request through the JetStream stream which captures
+// its subject.  The stream acknowledges the request on the NATS reply subject,
+// so the proxy publishes its response to the request's ReplyTo subject.
+func (c *Client) streamRequest(subject string, req *proxy.Request, timeout time.Duration) (*proxy.Response, error) {
+	req.ReplyTo = nats.NewInbox()
+	defer func() {
+		req.ReplyTo = ""
+	}()
+
+	sub, err := c.nc.Conn.SubscribeSync(req.ReplyTo)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to response")
+	}
+	defer sub.Unsubscribe() // nolint: errcheck
+
+	var msg *nats.Msg
+	err = proxy.EncodeWith(c.core.codec, req, func(data []byte) (err error) {
+		msg, err = c.nc.Conn.Request(subject, data, timeout)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp, err := streamAck(msg.Data); resp != nil || err != nil {
+		return resp, err
+	}
+
+	resp, err := nextResponse(c.context(), sub, timeout)
+	if err == nats.ErrTimeout {
+		return nil, ErrStreamedRequestTimeout
+	}
+	return resp, err
+}
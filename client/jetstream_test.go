@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/natstest"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+)
+
+func TestStreamAck(t *testing.T) {
+	if resp, err := streamAck([]byte(`{"stream":"ARI","seq":12}`)); resp != nil || err != nil {
+		t.Errorf("unexpected result %v (%v) of acknowledgment", resp, err)
+	}
+	if _, err := streamAck([]byte(`{"error":{"code":503,"description":"no stream"}}`)); err == nil || err.Error() != "JetStream error 503: no stream" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// A proxy which received the request directly answers it
+	resp, err := streamAck([]byte(`{"error":"Not found"}`))
+	if err != nil || resp == nil || !resp.IsNotFound() {
+		t.Errorf("unexpected response %v (%v)", resp, err)
+	}
+}
+
+// newStreamTest connects a client, with the given options, to an in-process
+// NATS server, returning the client and a separate connection on which the
+// test plays the part of JetStream and the proxies
+func newStreamTest(t *testing.T, opts ...OptionFunc) (*Client, *nats.Conn, func()) {
+	t.Helper()
+
+	ns, err := natstest.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := nats.Connect(ns.URL())
+	if err != nil {
+		ns.Close()
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts = append([]OptionFunc{WithURI(ns.URL()), WithApplication("app"), WithRequestTimeout(200 * time.Millisecond)}, opts...)
+	c, err := New(ctx, opts...)
+	if err != nil {
+		cancel()
+		nc.Close()
+		ns.Close()
+		t.Fatal(err)
+	}
+	// The client is closed with its context
+	return c, nc, func() {
+		cancel()
+		nc.Close()
+		ns.Close()
+	}
+}
+
+func TestStreamedRequest(t *testing.T) {
+	c, nc, done := newStreamTest(t, WithJetStream("command"), WithTimeoutRetries(2))
+	defer done()
+
+	// The stream acknowledges each request, and the proxy answers it on its
+	// ReplyTo subject, unless it is to be lost
+	var received int32
+	requests := make(chan *proxy.Request, 10)
+	if _, err := nc.Subscribe("ari.command.>", func(m *nats.Msg) {
+		atomic.AddInt32(&received, 1)
+		req, err := proxy.DecodeRequest(m.Data)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		requests <- req
+		nc.Publish(m.Reply, []byte(`{"stream":"REQUESTS","seq":1}`)) // nolint: errcheck
+		if req.Key.ID == "lost" {
+			return
+		}
+		data, _ := json.Marshal(&proxy.Response{}) // nolint: errcheck
+		nc.Publish(req.ReplyTo, data)              // nolint: errcheck
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	key := ari.NewKey(ari.ChannelKey, "c1", ari.WithApp("app"), ari.WithNode("node"))
+	if err := c.Channel().Answer(key); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.Kind != "ChannelAnswer" || req.Key.ID != "c1" || req.ReplyTo == "" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// A stored request which is not answered in time is not retried, as a
+	// proxy still executes it
+	lost := ari.NewKey(ari.ChannelKey, "lost", ari.WithApp("app"), ari.WithNode("node"))
+	if err := c.Channel().Answer(lost); err != ErrStreamedRequestTimeout {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&received); n != 2 {
+		t.Errorf("received %d requests", n)
+	}
+
+	// Requests of other classes are made directly
+	if _, err := nc.Subscribe("ari.data.>", func(m *nats.Msg) {
+		data, _ := json.Marshal(&proxy.Response{Data: &proxy.EntityData{Channel: &ari.ChannelData{ID: "c1"}}}) // nolint: errcheck
+		nc.Publish(m.Reply, data)                                                                              // nolint: errcheck
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := c.Channel().Data(key); err != nil || data.ID != "c1" {
+		t.Errorf("unexpected channel data: %+v (%v)", data, err)
+	}
+}
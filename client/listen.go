@@ -2,8 +2,8 @@ package client
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/nats-io/nats.go"
 	"github.com/rotisserie/eris"
@@ -25,7 +25,7 @@ func Listen(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.
 		return eris.New("ARI Client must be a proxy client")
 	}
 
-	subj := fmt.Sprintf("%sevent.%s.>", c.core.prefix, c.ApplicationName())
+	subj := c.core.eventSubject(c.ApplicationName(), "", "StasisStart")
 
 	c.log.Debug("listening for events", "subject", subj)
 	sub, err := c.nc.QueueSubscribe(subj, ListenQueue, listenProcessor(ac, h))
@@ -41,7 +41,7 @@ func Listen(ctx context.Context, ac ari.Client, h func(*ari.ChannelHandle, *ari.
 
 func listenProcessor(ac ari.Client, h func(*ari.ChannelHandle, *ari.StasisStart)) func(*nats.Msg) {
 	return func(m *nats.Msg) {
-		e, err := ari.DecodeEvent(m.Data)
+		e, err := proxy.DecodeEvent(m.Data)
 		if err != nil {
 			Logger.Error("failed to decode event", "error", err)
 			return
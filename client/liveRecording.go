@@ -93,3 +93,13 @@ func (l *liveRecording) Subscribe(key *ari.Key, n ...string) ari.Subscription {
 
 	return l.c.Bus().Subscribe(key, n...)
 }
+
+// recordingKey returns the key of the live recording started by a record
+// request, whose name may have been generated or expanded from a template by
+// the proxy
+func recordingKey(k *ari.Key, name string) *ari.Key {
+	if k.Kind == ari.LiveRecordingKey && k.ID != "" {
+		return k
+	}
+	return k.New(ari.LiveRecordingKey, name)
+}
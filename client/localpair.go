@@ -0,0 +1,20 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// LocalChannelPair resolves the halves of the Local channel of the given
+// channel, which may be either half of a Local channel or the channel behind
+// its ;2 half, and the channel behind it
+func (c *Client) LocalChannelPair(key *ari.Key) (*proxy.LocalChannelPair, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind: "ChannelLocalPair",
+		Key:  key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.LocalPair, nil
+}
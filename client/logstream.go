@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// StartLogStream starts streaming the lines of the given logging levels (e.g.
+// "warning,error") of the Asterisk node identified by the given key.  If
+// levels is empty, the proxy's default levels are streamed.  The returned key
+// identifies the log stream, for use with StopLogStream, and the returned data
+// describes the NATS subject on which the lines are published (see
+// SubscribeLogStream).
+func (c *Client) StartLogStream(key *ari.Key, levels string) (*ari.Key, *proxy.LogStreamData, error) {
+	resp, err := c.makeRequest("create", &proxy.Request{
+		Kind: "LogStreamStart",
+		Key:  key,
+		LogStream: &proxy.LogStream{
+			Levels: levels,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = resp.Err(); err != nil {
+		return nil, nil, err
+	}
+	if resp.Data == nil || resp.Data.LogStream == nil {
+		return nil, nil, eris.New("no log stream in response")
+	}
+	return resp.Key, resp.Data.LogStream, nil
+}
+
+// StopLogStream stops the given log stream
+func (c *Client) StopLogStream(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "LogStreamStop",
+		Key:  key,
+	})
+}
+
+// SubscribeLogStream calls the handler with each line of the given log
+// stream, until the returned cancel function is called
+func (c *Client) SubscribeLogStream(stream *proxy.LogStreamData, handler func(line string)) (cancel func(), err error) {
+	sub, err := c.nc.Conn.Subscribe(stream.Subject, func(m *nats.Msg) {
+		handler(string(m.Data))
+	})
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to log stream")
+	}
+	return func() {
+		sub.Unsubscribe() // nolint: errcheck
+	}, nil
+}
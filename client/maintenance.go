@@ -0,0 +1,40 @@
+package client
+
+import (
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ScheduleMaintenance schedules a maintenance window on the node identified by
+// the given key, replacing any window already scheduled.  From start (or
+// immediately, if start is zero) until end, the node announces that it is
+// draining and rejects new create requests with proxy.ErrDraining, after which
+// it resumes automatically.
+func (c *Client) ScheduleMaintenance(node *ari.Key, start, end time.Time) error {
+	if node == nil || node.App == "" || node.Node == "" {
+		return eris.New("maintenance requires the key of a single node")
+	}
+	return c.commandRequest(&proxy.Request{
+		Kind: "MaintenanceSchedule",
+		Key:  node,
+		Maintenance: &proxy.MaintenanceWindow{
+			Start: start,
+			End:   end,
+		},
+	})
+}
+
+// CancelMaintenance cancels the maintenance window of the node identified by
+// the given key, resuming the node if the window has started
+func (c *Client) CancelMaintenance(node *ari.Key) error {
+	if node == nil || node.App == "" || node.Node == "" {
+		return eris.New("maintenance requires the key of a single node")
+	}
+	return c.commandRequest(&proxy.Request{
+		Kind: "MaintenanceCancel",
+		Key:  node,
+	})
+}
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// ChannelMove moves the given channel from its Stasis application to the
+// given one (e.g. from an IVR application to a queue application), which
+// receives it, with the given arguments, in a StasisStart event.  The
+// application must be registered on the Asterisk node of the channel, as by
+// an ari-proxy of that application.
+func (c *Client) ChannelMove(key *ari.Key, app string, args ...string) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "ChannelMove",
+		Key:  key,
+		ChannelMove: &proxy.ChannelMove{
+			Application: app,
+			Args:        args,
+		},
+	})
+}
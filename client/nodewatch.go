@@ -0,0 +1,108 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultNodeDownTimeout is the default time without heartbeats after which a
+// node is considered to be down
+var DefaultNodeDownTimeout = 3 * proxy.HeartbeatInterval
+
+// WatchNodes monitors the heartbeats of the nodes of the client's application,
+// calling onDown with the last heartbeat of any node from which no heartbeat
+// has been received for the given timeout (or DefaultNodeDownTimeout, if
+// zero).  Each outage is reported once; a node which resumes its heartbeats
+// may be reported again.  The watch runs until the returned cancel function
+// is called.
+func (c *Client) WatchNodes(timeout time.Duration, onDown func(last *proxy.Heartbeat)) (cancel func(), err error) {
+	if timeout <= 0 {
+		timeout = DefaultNodeDownTimeout
+	}
+
+	var filter *ari.Key
+	if c.appName != "" {
+		filter = ari.NewKey("", "", ari.WithApp(c.appName))
+	}
+	sub := c.Bus().Subscribe(filter, proxy.EventHeartbeat)
+	if sub == nil {
+		return nil, eris.New("failed to subscribe to heartbeats")
+	}
+
+	w := newNodeWatcher(timeout)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(timeout / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if h, ok := e.(*proxy.Heartbeat); ok {
+					w.heartbeat(h, time.Now())
+				}
+			case <-ticker.C:
+				for _, h := range w.check(time.Now()) {
+					onDown(h)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			sub.Cancel()
+		})
+	}, nil
+}
+
+// watchedNode is the heartbeat state of a node
+type watchedNode struct {
+	last     *proxy.Heartbeat
+	received time.Time
+	down     bool
+}
+
+// nodeWatcher tracks the heartbeats of nodes, indexed by application and node
+type nodeWatcher struct {
+	timeout time.Duration
+	nodes   map[string]*watchedNode
+}
+
+func newNodeWatcher(timeout time.Duration) *nodeWatcher {
+	return &nodeWatcher{
+		timeout: timeout,
+		nodes:   make(map[string]*watchedNode),
+	}
+}
+
+// heartbeat records a heartbeat received at the given time
+func (w *nodeWatcher) heartbeat(h *proxy.Heartbeat, now time.Time) {
+	w.nodes[h.Application+"/"+h.Node] = &watchedNode{
+		last:     h,
+		received: now,
+	}
+}
+
+// check returns the last heartbeats of the nodes which have newly gone down
+func (w *nodeWatcher) check(now time.Time) (ret []*proxy.Heartbeat) {
+	for _, n := range w.nodes {
+		if !n.down && now.Sub(n.received) >= w.timeout {
+			n.down = true
+			ret = append(ret, n.last)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestNodeWatcher(t *testing.T) {
+	w := newNodeWatcher(time.Minute)
+	now := time.Now()
+
+	hb := func(node string) *proxy.Heartbeat {
+		return &proxy.Heartbeat{EventData: ari.EventData{Application: "app", Node: node}}
+	}
+	w.heartbeat(hb("n1"), now)
+	w.heartbeat(hb("n2"), now.Add(30*time.Second))
+
+	if down := w.check(now.Add(59 * time.Second)); len(down) != 0 {
+		t.Errorf("no node should be down yet: %v", down)
+	}
+
+	down := w.check(now.Add(time.Minute))
+	if len(down) != 1 || down[0].Node != "n1" {
+		t.Fatalf("n1 should be down: %v", down)
+	}
+	if down := w.check(now.Add(80 * time.Second)); len(down) != 0 {
+		t.Errorf("outage should be reported once: %v", down)
+	}
+
+	// A node which resumes may be reported again
+	w.heartbeat(hb("n1"), now.Add(2*time.Minute))
+	down = w.check(now.Add(3 * time.Minute))
+	if len(down) != 2 {
+		t.Errorf("both nodes should be down: %v", down)
+	}
+}
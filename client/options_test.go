@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// untypedSubjects is a SubjectBuilder without per-type event subjects
+type untypedSubjects struct {
+	proxy.SubjectBuilder
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for name, opt := range map[string]OptionFunc{
+		"request timeout": WithRequestTimeout(0),
+		"timeout retries": WithTimeoutRetries(-1),
+		"multiplexing":    WithMultiplexing(-1),
+		"cache":           WithCache(-time.Second),
+		"logger":          WithLogger(nil),
+		"circuit breaker": WithCircuitBreaker(CircuitBreakerConfig{FailureRatio: 2}),
+		"jetstream":       WithJetStream("get"),
+		"codec":           WithCodec("no-such-codec"),
+	} {
+		_, err := New(context.Background(), opt, WithURI("nats://127.0.0.1:1"))
+		if err == nil || !strings.Contains(err.Error(), "invalid client option") {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	_, err := New(context.Background(), WithSubjectBuilder(untypedSubjects{proxy.NewSubjectBuilder("ari.")}), WithEventTypeSubjects(), WithURI("nats://127.0.0.1:1"))
+	if err == nil || !strings.Contains(err.Error(), "per-type event subjects") {
+		t.Errorf("event type subjects: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// Page pages the given endpoints from the given channel, which should already
+// be answered.  The returned handle refers to the page bridge.  A
+// proxy.PageFinished event is sent to the channel's subscribers when the page
+// is torn down.
+func (c *Client) Page(key *ari.Key, opts *proxy.Page) (*ari.BridgeHandle, error) {
+	k, err := c.createRequest(&proxy.Request{
+		Kind: "Page",
+		Key:  key,
+		Page: opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ari.NewBridgeHandle(k, c.Bridge(), nil), nil
+}
@@ -3,8 +3,52 @@ package client
 import (
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
 )
 
+// PlayWithOptions plays the given media to the channel or bridge of the given
+// key (by its kind), with the given language, offset, and skip interval
+func (c *Client) PlayWithOptions(key *ari.Key, playbackID, mediaURI string, opts proxy.PlayOptions) (*ari.PlaybackHandle, error) {
+	return c.PlayPlaylist(key, playbackID, []string{mediaURI}, opts)
+}
+
+// PlayPlaylist plays the given list of media in sequence, as a single
+// playback, to the channel or bridge of the given key (by its kind).  The
+// progress of the playlist is reported by proxy.PlaylistItemStarted events.
+// Playlists require Asterisk 14 or later.
+func (c *Client) PlayPlaylist(key *ari.Key, playbackID string, media []string, opts proxy.PlayOptions) (*ari.PlaybackHandle, error) {
+	if playbackID == "" {
+		playbackID = rid.New(rid.Playback)
+	}
+
+	req := &proxy.Request{
+		Kind: "ChannelPlay",
+		Key:  key,
+		ChannelPlay: &proxy.ChannelPlay{
+			PlaybackID:  playbackID,
+			MediaURIs:   media,
+			PlayOptions: opts,
+		},
+	}
+	if key.Kind == ari.BridgeKey {
+		req = &proxy.Request{
+			Kind: "BridgePlay",
+			Key:  key,
+			BridgePlay: &proxy.BridgePlay{
+				PlaybackID:  playbackID,
+				MediaURIs:   media,
+				PlayOptions: opts,
+			},
+		}
+	}
+
+	k, err := c.createRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return ari.NewPlaybackHandle(k, c.Playback(), nil), nil
+}
+
 type playback struct {
 	c *Client
 }
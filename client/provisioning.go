@@ -0,0 +1,258 @@
+package client
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// The configuration classes and object types by which voicemail boxes and
+// queue members are provisioned through the AsteriskConfig requests.  ARI
+// dynamic configuration only applies to sorcery objects, so the Asterisk
+// installation must map these object types (in sorcery.conf) to the backend
+// from which app_voicemail and app_queue read their configuration (such as
+// realtime).
+var (
+	VoicemailConfigClass = "voicemail"
+	VoicemailConfigType  = "mailbox"
+	VoicemailModule      = "app_voicemail.so"
+
+	QueueConfigClass      = "queue"
+	QueueMemberConfigType = "member"
+	QueueModule           = "app_queue.so"
+)
+
+// configKey is the key kind of Asterisk configuration objects
+const configKey = "config"
+
+var (
+	configNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+	mailboxRegex    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	pinRegex        = regexp.MustCompile(`^[0-9]*$`)
+	emailRegex      = regexp.MustCompile(`^[^@\s,]+@[^@\s,]+$`)
+	interfaceRegex  = regexp.MustCompile(`^[A-Za-z0-9_]+/[^\s,]+$`)
+)
+
+// VoicemailBox describes an app_voicemail mailbox
+type VoicemailBox struct {
+	// Context is the voicemail context of the mailbox.  It defaults to
+	// "default".
+	Context string
+
+	// Mailbox is the mailbox number
+	Mailbox string
+
+	// Password is the numeric PIN of the mailbox
+	Password string
+
+	// FullName is the name of the owner of the mailbox
+	FullName string
+
+	// Email is the address to which messages are sent, if any
+	Email string
+
+	// Attach indicates that messages are attached to email notifications
+	Attach bool
+
+	// DeleteAfterEmail indicates that messages are deleted once they have
+	// been emailed
+	DeleteAfterEmail bool
+}
+
+// ID returns the configuration object ID of the mailbox
+func (b *VoicemailBox) ID() string {
+	return b.Mailbox + "@" + b.contextOrDefault()
+}
+
+// Validate checks the mailbox
+func (b *VoicemailBox) Validate() error {
+	if !mailboxRegex.MatchString(b.Mailbox) {
+		return eris.Errorf("invalid mailbox %q", b.Mailbox)
+	}
+	if b.Context != "" && !configNameRegex.MatchString(b.Context) {
+		return eris.Errorf("invalid voicemail context %q", b.Context)
+	}
+	if !pinRegex.MatchString(b.Password) {
+		return eris.Errorf("mailbox %s: password must be numeric", b.Mailbox)
+	}
+	if strings.ContainsAny(b.FullName, ",|\n") {
+		return eris.Errorf("mailbox %s: full name may not contain commas, pipes, or newlines", b.Mailbox)
+	}
+	if b.Email != "" && !emailRegex.MatchString(b.Email) {
+		return eris.Errorf("mailbox %s: invalid email address %q", b.Mailbox, b.Email)
+	}
+	if (b.Attach || b.DeleteAfterEmail) && b.Email == "" {
+		return eris.Errorf("mailbox %s: email options require an email address", b.Mailbox)
+	}
+	return nil
+}
+
+// Tuples returns the configuration of the mailbox
+func (b *VoicemailBox) Tuples() []ari.ConfigTuple {
+	return []ari.ConfigTuple{
+		{Attribute: "context", Value: b.contextOrDefault()},
+		{Attribute: "mailbox", Value: b.Mailbox},
+		{Attribute: "password", Value: b.Password},
+		{Attribute: "fullname", Value: b.FullName},
+		{Attribute: "email", Value: b.Email},
+		{Attribute: "attach", Value: yesNo(b.Attach)},
+		{Attribute: "delete", Value: yesNo(b.DeleteAfterEmail)},
+	}
+}
+
+func (b *VoicemailBox) contextOrDefault() string {
+	if b.Context == "" {
+		return "default"
+	}
+	return b.Context
+}
+
+// QueueMember describes a static member of an app_queue queue
+type QueueMember struct {
+	// Queue is the name of the queue
+	Queue string
+
+	// Interface is the channel interface of the member (e.g. "PJSIP/1000")
+	Interface string
+
+	// MemberName is the display name of the member
+	MemberName string
+
+	// StateInterface is the interface whose device state determines the
+	// availability of the member, if it differs from Interface
+	StateInterface string
+
+	// Penalty is the penalty of the member; members with lower penalties are
+	// called first
+	Penalty int
+
+	// Paused indicates that the member is paused
+	Paused bool
+}
+
+// ID returns the configuration object ID of the queue member
+func (m *QueueMember) ID() string {
+	return m.Queue + "-" + strings.Replace(m.Interface, "/", "_", -1)
+}
+
+// Validate checks the queue member
+func (m *QueueMember) Validate() error {
+	if !configNameRegex.MatchString(m.Queue) {
+		return eris.Errorf("invalid queue name %q", m.Queue)
+	}
+	if !interfaceRegex.MatchString(m.Interface) {
+		return eris.Errorf("queue %s: invalid member interface %q", m.Queue, m.Interface)
+	}
+	if m.StateInterface != "" && !interfaceRegex.MatchString(m.StateInterface) {
+		return eris.Errorf("queue %s: invalid state interface %q", m.Queue, m.StateInterface)
+	}
+	if strings.ContainsAny(m.MemberName, ",\n") {
+		return eris.Errorf("queue %s: member name may not contain commas or newlines", m.Queue)
+	}
+	if m.Penalty < 0 {
+		return eris.Errorf("queue %s: penalty may not be negative", m.Queue)
+	}
+	return nil
+}
+
+// Tuples returns the configuration of the queue member
+func (m *QueueMember) Tuples() []ari.ConfigTuple {
+	return []ari.ConfigTuple{
+		{Attribute: "queue_name", Value: m.Queue},
+		{Attribute: "interface", Value: m.Interface},
+		{Attribute: "membername", Value: m.MemberName},
+		{Attribute: "state_interface", Value: m.StateInterface},
+		{Attribute: "penalty", Value: strconv.Itoa(m.Penalty)},
+		{Attribute: "paused", Value: boolDigit(m.Paused)},
+	}
+}
+
+// ProvisionVoicemailBoxes creates or updates the given voicemail boxes and
+// reloads app_voicemail once they are all written.  Every box is validated
+// before any is written.
+func (c *Client) ProvisionVoicemailBoxes(boxes ...*VoicemailBox) error {
+	for _, b := range boxes {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range boxes {
+		if err := c.Asterisk().Config().Update(voicemailConfigKey(b.ID()), b.Tuples()); err != nil {
+			return eris.Wrapf(err, "failed to provision mailbox %s", b.ID())
+		}
+	}
+	return c.reloadModule(VoicemailModule)
+}
+
+// RemoveVoicemailBoxes deletes the given voicemail boxes, by mailbox and
+// context, and reloads app_voicemail
+func (c *Client) RemoveVoicemailBoxes(boxes ...*VoicemailBox) error {
+	for _, b := range boxes {
+		if err := c.Asterisk().Config().Delete(voicemailConfigKey(b.ID())); err != nil {
+			return eris.Wrapf(err, "failed to remove mailbox %s", b.ID())
+		}
+	}
+	return c.reloadModule(VoicemailModule)
+}
+
+// ProvisionQueueMembers creates or updates the given queue members and
+// reloads app_queue once they are all written.  Every member is validated
+// before any is written.
+func (c *Client) ProvisionQueueMembers(members ...*QueueMember) error {
+	for _, m := range members {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range members {
+		if err := c.Asterisk().Config().Update(queueMemberConfigKey(m.ID()), m.Tuples()); err != nil {
+			return eris.Wrapf(err, "failed to provision member %s of queue %s", m.Interface, m.Queue)
+		}
+	}
+	return c.reloadModule(QueueModule)
+}
+
+// RemoveQueueMembers deletes the given queue members, by queue and
+// interface, and reloads app_queue
+func (c *Client) RemoveQueueMembers(members ...*QueueMember) error {
+	for _, m := range members {
+		if err := c.Asterisk().Config().Delete(queueMemberConfigKey(m.ID())); err != nil {
+			return eris.Wrapf(err, "failed to remove member %s of queue %s", m.Interface, m.Queue)
+		}
+	}
+	return c.reloadModule(QueueModule)
+}
+
+func (c *Client) reloadModule(name string) error {
+	if err := c.Asterisk().Modules().Reload(ari.NewKey(ari.ModuleKey, name)); err != nil {
+		return eris.Wrapf(err, "failed to reload %s", name)
+	}
+	return nil
+}
+
+func voicemailConfigKey(id string) *ari.Key {
+	return ari.NewKey(configKey, ari.ConfigID(VoicemailConfigClass, VoicemailConfigType, id))
+}
+
+func queueMemberConfigKey(id string) *ari.Key {
+	return ari.NewKey(configKey, ari.ConfigID(QueueConfigClass, QueueMemberConfigType, id))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func boolDigit(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,55 @@
+package client
+
+import "testing"
+
+func TestVoicemailBoxValidate(t *testing.T) {
+	b := &VoicemailBox{Mailbox: "1000", Password: "1234", FullName: "Jane Doe", Email: "jane@example.com", Attach: true}
+	if err := b.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if b.ID() != "1000@default" {
+		t.Errorf("unexpected ID: %s", b.ID())
+	}
+
+	for _, b := range []*VoicemailBox{
+		{Mailbox: ""},
+		{Mailbox: "1000", Password: "abcd"},
+		{Mailbox: "1000", Context: "bad context"},
+		{Mailbox: "1000", FullName: "Doe, Jane"},
+		{Mailbox: "1000", Email: "not-an-address"},
+		{Mailbox: "1000", Attach: true},
+	} {
+		if err := b.Validate(); err == nil {
+			t.Errorf("%+v: expected error", b)
+		}
+	}
+}
+
+func TestQueueMemberValidate(t *testing.T) {
+	m := &QueueMember{Queue: "support", Interface: "PJSIP/1000", Penalty: 2, Paused: true}
+	if err := m.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if m.ID() != "support-PJSIP_1000" {
+		t.Errorf("unexpected ID: %s", m.ID())
+	}
+
+	tuples := make(map[string]string)
+	for _, tu := range m.Tuples() {
+		tuples[tu.Attribute] = tu.Value
+	}
+	if tuples["penalty"] != "2" || tuples["paused"] != "1" || tuples["interface"] != "PJSIP/1000" {
+		t.Errorf("unexpected tuples: %v", tuples)
+	}
+
+	for _, m := range []*QueueMember{
+		{Queue: "", Interface: "PJSIP/1000"},
+		{Queue: "support", Interface: "1000"},
+		{Queue: "support", Interface: "PJSIP/1000", Penalty: -1},
+		{Queue: "support", Interface: "PJSIP/1000", StateInterface: "bogus"},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%+v: expected error", m)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// ErrFileChunkSequence indicates that a chunk of a file transfer was lost or
+// received out of order
+var ErrFileChunkSequence = eris.New("file chunk out of sequence")
+
+// StoredRecordingFile downloads the file of the given stored recording over
+// NATS, from the proxy of the node which stores it, so that clients need no
+// HTTP access to the Asterisk nodes.  The file is streamed in chunks, each of
+// which must arrive within the request timeout; the returned reader fails if
+// a chunk is lost, corrupted or late.  The reader must be closed.
+func (c *Client) StoredRecordingFile(key *ari.Key) (io.ReadCloser, error) {
+	req := &proxy.Request{
+		Kind: "RecordingStoredFile",
+		Key:  key,
+	}
+	if err := c.checkSupported(req); err != nil {
+		return nil, err
+	}
+	c.setTenant(req)
+
+	// The file must be fetched from the node which stores the recording
+	if !c.completeCoordinates(req) {
+		k, err := c.getRequest(&proxy.Request{
+			Kind: "RecordingStoredGet",
+			Key:  key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		req.Key = k
+	}
+
+	timeout, err := c.setDeadline(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := c.core.nc.Conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to file chunks")
+	}
+
+	// The chunks are published as fast as they are read, so they must not
+	// be dropped as a slow consumer while the reader falls behind
+	if err = sub.SetPendingLimits(-1, -1); err != nil {
+		sub.Unsubscribe() // nolint: errcheck
+		return nil, eris.Wrap(err, "failed to set pending limits")
+	}
+
+	if err = c.publishRequest(c.subject("data", req), inbox, req); err != nil {
+		sub.Unsubscribe() // nolint: errcheck
+		return nil, err
+	}
+
+	ctx := c.context()
+	return &fileReader{
+		next: func() ([]byte, error) {
+			wait, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			msg, err := sub.NextMsgWithContext(wait)
+			if err != nil {
+				if err == context.DeadlineExceeded && ctx.Err() == nil {
+					err = nats.ErrTimeout
+				}
+				return nil, err
+			}
+			return msg.Data, nil
+		},
+		close: sub.Unsubscribe,
+	}, nil
+}
+
+// fileReader reassembles a file from the chunks of a file transfer
+type fileReader struct {
+	// next returns the next message of the transfer
+	next func() ([]byte, error)
+
+	close func() error
+
+	seq  uint64
+	buf  bytes.Reader
+	done bool
+	err  error
+}
+
+// Read implements io.Reader
+func (r *fileReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.receive()
+	}
+	return r.buf.Read(p)
+}
+
+// receive receives the next chunk of the file into the buffer
+func (r *fileReader) receive() error {
+	data, err := r.next()
+	if err != nil {
+		return eris.Wrap(err, "failed to receive file chunk")
+	}
+
+	if !proxy.IsFileChunk(data) {
+		// The proxy reports the failure of the transfer by a response
+		var asm proxy.ChunkAssembler
+		resp, err := asm.DecodeResponse(data)
+		if err != nil {
+			return eris.Wrap(err, "failed to decode response")
+		}
+		if resp == nil || resp.Err() == nil {
+			return eris.New("unexpected response to file request")
+		}
+		return resp.Err()
+	}
+
+	c, err := proxy.DecodeFileChunk(data)
+	if err != nil {
+		return err
+	}
+	if c.Seq != r.seq {
+		return eris.Wrapf(ErrFileChunkSequence, "expected chunk %d, received %d", r.seq, c.Seq)
+	}
+	r.seq++
+	r.done = c.Last
+	r.buf.Reset(c.Data)
+	return nil
+}
+
+// Close implements io.Closer, ending the transfer
+func (r *fileReader) Close() error {
+	if r.err == nil {
+		r.err = eris.New("file reader closed")
+	}
+	return r.close()
+}
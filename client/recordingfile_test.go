@@ -0,0 +1,61 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+func testFileReader(msgs ...[]byte) *fileReader {
+	return &fileReader{
+		next: func() ([]byte, error) {
+			if len(msgs) == 0 {
+				return nil, eris.New("no more messages")
+			}
+			m := msgs[0]
+			msgs = msgs[1:]
+			return m, nil
+		},
+		close: func() error { return nil },
+	}
+}
+
+func TestFileReader(t *testing.T) {
+	r := testFileReader(
+		(&proxy.FileChunk{Seq: 0, Data: []byte("hello, ")}).Encode(),
+		(&proxy.FileChunk{Seq: 1}).Encode(),
+		(&proxy.FileChunk{Seq: 2, Data: []byte("world"), Last: true}).Encode(),
+	)
+	data, err := ioutil.ReadAll(r)
+	if err != nil || string(data) != "hello, world" {
+		t.Errorf("unexpected file %q (%v)", data, err)
+	}
+
+	// A lost chunk
+	r = testFileReader(
+		(&proxy.FileChunk{Seq: 0, Data: []byte("a")}).Encode(),
+		(&proxy.FileChunk{Seq: 2, Data: []byte("c"), Last: true}).Encode(),
+	)
+	if _, err := ioutil.ReadAll(r); !eris.Is(err, ErrFileChunkSequence) {
+		t.Errorf("expected a sequence error, got %v", err)
+	}
+
+	// A corrupted chunk
+	m := (&proxy.FileChunk{Seq: 0, Data: []byte("abc"), Last: true}).Encode()
+	m[len(m)-1] = 'x'
+	if _, err := ioutil.ReadAll(testFileReader(m)); !eris.Is(err, proxy.ErrFileChunkChecksum) {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+
+	// The failure of the transfer
+	resp, err := json.Marshal(proxy.NewErrorResponse(eris.New("Recording not found")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(testFileReader(resp)); err == nil || err.Error() != "Recording not found" {
+		t.Errorf("expected the error of the proxy, got %v", err)
+	}
+}
@@ -1 +1,66 @@
 package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// WithContext returns a copy of the client whose requests are bound by the
+// given context, such as the context of a call: the requests fail once it is
+// done, and wait for their responses no later than its deadline, which is
+// passed to the proxies so that they do not execute the requests which the
+// client no longer waits for.  The handles obtained from the copy make their
+// requests with it.
+//
+// The copy shares the event bus and lifecycle of the client, so closing it
+// has no effect.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	d := *c
+	d.ctx = ctx
+	d.cancel = nil
+	d.cacheSub = nil
+	d.closed = true
+	return &d
+}
+
+// context returns the context by which the requests of the client are bound
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// setDeadline sets the deadline of a request to the time after which the
+// client stops waiting for its response: after the request timeout, or at
+// the deadline of the client's context, if sooner.  A request made through
+// JetStream (streamed) is still executed once the client stops waiting, as
+// the stream stores it, so only the deadline of the context applies to it.
+// It returns the time to wait for the response, failing if the context is
+// already done.
+func (c *Client) setDeadline(req *proxy.Request, streamed bool) (time.Duration, error) {
+	ctx := c.context()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	timeout := c.requestTimeout
+	req.Deadline = nil
+	if d, ok := ctx.Deadline(); ok {
+		if !d.After(now) {
+			return 0, context.DeadlineExceeded
+		}
+		if d.Before(now.Add(timeout)) {
+			timeout = d.Sub(now)
+		}
+		req.Deadline = &d
+	}
+	if !streamed {
+		deadline := now.Add(timeout)
+		req.Deadline = &deadline
+	}
+	return timeout, nil
+}
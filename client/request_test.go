@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestSetDeadline(t *testing.T) {
+	c := &Client{core: &core{requestTimeout: time.Minute}}
+
+	// Without a context, the request timeout applies
+	req := new(proxy.Request)
+	timeout, err := c.setDeadline(req, false)
+	if err != nil || timeout != time.Minute {
+		t.Fatalf("timeout %v, error %v", timeout, err)
+	}
+	if req.Deadline == nil || time.Until(*req.Deadline) > time.Minute {
+		t.Errorf("unexpected deadline %v", req.Deadline)
+	}
+
+	// A streamed request has no deadline but that of the context
+	if _, err = c.setDeadline(req, true); err != nil || req.Deadline != nil {
+		t.Errorf("streamed request deadline %v, error %v", req.Deadline, err)
+	}
+
+	// The deadline of the context shortens the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	cc := c.WithContext(ctx)
+	timeout, err = cc.setDeadline(req, true)
+	if err != nil || timeout > time.Second {
+		t.Errorf("timeout %v, error %v", timeout, err)
+	}
+	if d, _ := ctx.Deadline(); req.Deadline == nil || !req.Deadline.Equal(d) {
+		t.Errorf("deadline %v, want that of the context", req.Deadline)
+	}
+
+	// Requests fail once the context is done
+	cancel()
+	if _, err = cc.setDeadline(req, false); err != context.Canceled {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// The copy cannot close the client
+	cc.Close()
+	if c.closed {
+		t.Error("closing the copy closed the client")
+	}
+}
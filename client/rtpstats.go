@@ -0,0 +1,19 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// ChannelRTPStatistics returns the RTP statistics (packet counts, jitter, loss
+// and round-trip times) of the given channel
+func (c *Client) ChannelRTPStatistics(key *ari.Key) (*proxy.RTPStatistics, error) {
+	data, err := c.dataRequest(&proxy.Request{
+		Kind: "ChannelRTPStatistics",
+		Key:  key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.RTPStatistics, nil
+}
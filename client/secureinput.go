@@ -0,0 +1,82 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// SecureInputKeyBits is the size of the RSA keys generated for secure input
+// captures.  The proxy rejects keys shorter than proxy.MinSecureInputKeyBits.
+var SecureInputKeyBits = proxy.MinSecureInputKeyBits
+
+// SecureInputCapture is a secure input capture in progress
+type SecureInputCapture struct {
+	c   *Client
+	key *ari.Key
+
+	privateKey *rsa.PrivateKey
+}
+
+// Key returns the key of the capture
+func (sc *SecureInputCapture) Key() *ari.Key {
+	return sc.key
+}
+
+// Stop stops the capture and returns the captured digits.  If the capture
+// has already completed (see proxy.SecureInputComplete), the digits captured
+// up to that point are returned.
+func (sc *SecureInputCapture) Stop() (string, error) {
+	data, err := sc.c.dataRequest(&proxy.Request{
+		Kind: "SecureInputStop",
+		Key:  sc.key,
+	})
+	if err != nil {
+		return "", err
+	}
+	if data.SecureInput == nil {
+		return "", eris.New("no secure input in response")
+	}
+	return proxy.DecryptSecureInput(sc.privateKey, data.SecureInput.Digits)
+}
+
+// StartSecureInput starts capturing sensitive DTMF input (such as a payment
+// card number) from the given channel.  Until the capture completes, the
+// channel's DTMF events are withheld from the event stream and its recordings
+// are paused.  The digits are encrypted to a key generated for the capture
+// and are only returned by Stop.  The PublicKey of the options is ignored.
+func (c *Client) StartSecureInput(key *ari.Key, opts *proxy.SecureInput) (*SecureInputCapture, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, SecureInputKeyBits)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to generate secure input key")
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to encode secure input key")
+	}
+
+	req := new(proxy.SecureInput)
+	if opts != nil {
+		*req = *opts
+	}
+	req.PublicKey = pub
+
+	k, err := c.createRequest(&proxy.Request{
+		Kind:        "SecureInputStart",
+		Key:         key,
+		SecureInput: req,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecureInputCapture{
+		c:          c,
+		key:        k,
+		privateKey: privateKey,
+	}, nil
+}
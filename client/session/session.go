@@ -0,0 +1,245 @@
+// Package session provides CallSession, a synchronous handle on a call, with
+// which simple IVRs are written as sequential code:
+//
+//	client.Listen(ctx, cl, func(h *ari.ChannelHandle, _ *ari.StasisStart) {
+//		s := session.New(ctx, cl, h)
+//		defer s.Close()
+//
+//		if err := s.Answer(); err != nil {
+//			return
+//		}
+//		account, err := s.GatherDigits("sound:enter-account", &proxy.CollectDigits{MaxDigits: 6, Terminator: "#"})
+//		if err != nil {
+//			return
+//		}
+//		if err := s.PlayAndWait("sound:thank-you", "digits:"+account); err != nil {
+//			return
+//		}
+//		s.Hangup() // nolint: errcheck
+//	})
+//
+// The operations of a session block until they complete, and fail with
+// ErrHangup once the channel hangs up or leaves the application.
+package session
+
+import (
+	"context"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/ext/play"
+	"github.com/CyCoreSystems/ari/v5/ext/record"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// ErrHangup indicates that the channel of the session hung up or left the
+// application
+var ErrHangup = eris.New("channel hung up")
+
+// DigitCollector collects DTMF digits on a channel, as the proxy client does
+// (see client.Client.CollectDigits)
+type DigitCollector interface {
+	CollectDigits(key *ari.Key, opts *proxy.CollectDigits) (*proxy.DigitsCollected, error)
+}
+
+// CallSession is a synchronous handle on a call
+type CallSession struct {
+	c ari.Client
+	h *ari.ChannelHandle
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sub ari.Subscription
+
+	// hungUp indicates that the channel hung up or left the application
+	hungUp bool
+
+	mu sync.Mutex
+}
+
+// New returns the session of the given channel, which ends when the channel
+// hangs up or leaves the application, when the context is closed, or when the
+// session is closed.  The client should be an ari-proxy client, which
+// supports GatherDigits.
+func New(ctx context.Context, c ari.Client, h *ari.ChannelHandle) *CallSession {
+	s := &CallSession{
+		c:   c,
+		h:   h,
+		sub: h.Subscribe(ari.Events.StasisEnd, ari.Events.ChannelDestroyed),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	go s.watch()
+	return s
+}
+
+// watch ends the session when the channel hangs up
+func (s *CallSession) watch() {
+	defer s.cancel()
+
+	var events <-chan ari.Event
+	if s.sub != nil {
+		events = s.sub.Events()
+	}
+
+	select {
+	case <-s.ctx.Done():
+	case _, ok := <-events:
+		if ok {
+			s.mu.Lock()
+			s.hungUp = true
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Channel returns the handle of the channel of the session
+func (s *CallSession) Channel() *ari.ChannelHandle {
+	return s.h
+}
+
+// Context returns the context of the session, which is closed when the
+// session ends
+func (s *CallSession) Context() context.Context {
+	return s.ctx
+}
+
+// Done returns a channel which is closed when the session ends
+func (s *CallSession) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close ends the session, without hanging up the channel
+func (s *CallSession) Close() {
+	s.cancel()
+	if s.sub != nil {
+		s.sub.Cancel()
+	}
+}
+
+// err returns ErrHangup if the channel hung up, or else the error of the
+// context of the session, if it ended, or else the given error
+func (s *CallSession) err(err error) error {
+	s.mu.Lock()
+	hungUp := s.hungUp
+	s.mu.Unlock()
+
+	if hungUp {
+		return ErrHangup
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return err
+}
+
+// Answer answers the channel
+func (s *CallSession) Answer() error {
+	if err := s.err(nil); err != nil {
+		return err
+	}
+	return s.err(s.h.Answer())
+}
+
+// Hangup hangs up the channel
+func (s *CallSession) Hangup() error {
+	if err := s.err(nil); err != nil {
+		return err
+	}
+	return s.err(s.h.Hangup())
+}
+
+// PlayAndWait plays the given media URIs (e.g. "sound:tt-monkeys") in
+// sequence and waits for their completion.  DTMF does not interrupt the
+// playback.
+func (s *CallSession) PlayAndWait(uris ...string) error {
+	if err := s.err(nil); err != nil {
+		return err
+	}
+	return s.err(play.Play(s.ctx, s.h, play.URI(uris...), play.NoExitOnDTMF()).Err())
+}
+
+// GatherDigits plays the given prompt, if any, and collects DTMF digits as
+// described by the options (see proxy.CollectDigits), returning the digits
+// which were collected when the collection completed, whether by match or by
+// timeout.  It requires a client which collects digits (see DigitCollector).
+func (s *CallSession) GatherDigits(prompt string, opts *proxy.CollectDigits) (string, error) {
+	if err := s.err(nil); err != nil {
+		return "", err
+	}
+	dc, ok := s.c.(DigitCollector)
+	if !ok {
+		return "", eris.New("client does not support digit collection")
+	}
+
+	var o proxy.CollectDigits
+	if opts != nil {
+		o = *opts
+	}
+	if prompt != "" {
+		o.Prompt = prompt
+	}
+
+	res, err := dc.CollectDigits(s.h.Key(), &o)
+	if err != nil {
+		return "", s.err(err)
+	}
+	if res.Reason == proxy.CollectHangup {
+		return res.Digits, ErrHangup
+	}
+	return res.Digits, nil
+}
+
+// RecordAndWait records the channel under the given name (or a generated one,
+// if empty) and waits for the recording to complete, as described by the
+// options (e.g. record.TerminateOn("#"), record.MaxDuration(time.Minute)).
+// The result is returned even if the channel hangs up during the recording,
+// along with ErrHangup, so that the recording may be kept.
+func (s *CallSession) RecordAndWait(name string, opts ...record.OptionFunc) (*record.Result, error) {
+	if err := s.err(nil); err != nil {
+		return nil, err
+	}
+	if name != "" {
+		opts = append([]record.OptionFunc{record.Name(name)}, opts...)
+	}
+
+	res, err := record.Record(s.ctx, s.h, opts...).Result()
+	if res != nil && res.Hangup {
+		return res, ErrHangup
+	}
+	if err != nil {
+		return res, s.err(err)
+	}
+	return res, nil
+}
+
+// Bridge joins the channel of the session with the given channel in a new
+// mixing bridge, on the node of the session's channel, and returns the bridge
+func (s *CallSession) Bridge(other *ari.Key) (*ari.BridgeHandle, error) {
+	if err := s.err(nil); err != nil {
+		return nil, err
+	}
+
+	id := rid.New(rid.Bridge)
+	br, err := s.c.Bridge().Create(s.h.Key().New(ari.BridgeKey, id), "mixing", id)
+	if err != nil {
+		return nil, s.err(eris.Wrap(err, "failed to create bridge"))
+	}
+	for _, ch := range []string{s.h.ID(), other.ID} {
+		if err := br.AddChannel(ch); err != nil {
+			br.Delete() // nolint: errcheck
+			return nil, s.err(eris.Wrapf(err, "failed to add channel %s to bridge", ch))
+		}
+	}
+	return br, nil
+}
+
+// Wait waits for the session to end, returning ErrHangup if the channel hung
+// up
+func (s *CallSession) Wait() error {
+	<-s.ctx.Done()
+	return s.err(nil)
+}
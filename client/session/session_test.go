@@ -0,0 +1,85 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/client"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+var _ DigitCollector = (*client.Client)(nil)
+
+// collectingClient is a client which collects digits
+type collectingClient struct {
+	*arimocks.Client
+
+	opts   *proxy.CollectDigits
+	result *proxy.DigitsCollected
+}
+
+func (c *collectingClient) CollectDigits(key *ari.Key, opts *proxy.CollectDigits) (*proxy.DigitsCollected, error) {
+	c.opts = opts
+	return c.result, nil
+}
+
+func TestCallSession(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1", ari.WithNode("node"))
+	events := make(chan ari.Event, 1)
+
+	sub := new(arimocks.Subscription)
+	sub.On("Events").Return((<-chan ari.Event)(events))
+	sub.On("Cancel").Return()
+
+	ch := new(arimocks.Channel)
+	ch.On("Subscribe", key, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(sub)
+	ch.On("Answer", key).Return(nil)
+
+	c := &collectingClient{
+		Client: new(arimocks.Client),
+		result: &proxy.DigitsCollected{ChannelID: "c1", Digits: "1234", Reason: proxy.CollectTerminator},
+	}
+	s := New(context.Background(), c, ari.NewChannelHandle(key, ch, nil))
+	defer s.Close()
+
+	if err := s.Answer(); err != nil {
+		t.Fatalf("failed to answer: %v", err)
+	}
+	digits, err := s.GatherDigits("sound:enter-account", &proxy.CollectDigits{MaxDigits: 4})
+	if err != nil || digits != "1234" {
+		t.Errorf("unexpected digits %q (%v)", digits, err)
+	}
+	if c.opts.Prompt != "sound:enter-account" || c.opts.MaxDigits != 4 {
+		t.Errorf("unexpected collection options %+v", c.opts)
+	}
+
+	events <- &ari.StasisEnd{}
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session did not end on hangup")
+	}
+	if err := s.Wait(); err != ErrHangup {
+		t.Errorf("expected ErrHangup, got %v", err)
+	}
+	if err := s.Answer(); err != ErrHangup {
+		t.Errorf("expected ErrHangup after hangup, got %v", err)
+	}
+	ch.AssertNumberOfCalls(t, "Answer", 1)
+}
+
+func TestGatherDigitsUnsupported(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	ch := new(arimocks.Channel)
+	ch.On("Subscribe", key, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(nil)
+
+	s := New(context.Background(), new(arimocks.Client), ari.NewChannelHandle(key, ch, nil))
+	defer s.Close()
+
+	if _, err := s.GatherDigits("", nil); err == nil {
+		t.Error("digit collection should require a collecting client")
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"io"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// maxSoundUploadChunk is the maximum size of the data of a chunk of a
+	// sound upload
+	maxSoundUploadChunk = 256 * 1024
+
+	// soundUploadOverhead is the space reserved in each chunk request for
+	// the fields of the request other than the chunk
+	soundUploadOverhead = 4096
+)
+
+// UploadSound uploads the sound file read from r into the sounds directory of
+// the node identified by the given key, under the name, format and language
+// of the given description, returning the key of the sound.  The file is sent
+// in a sequence of requests, each carrying a checksummed chunk of the file;
+// the sound becomes available once the last chunk is stored.  If the upload
+// fails, it is aborted, so that no partial file remains on the node.
+func (c *Client) UploadSound(node *ari.Key, sound *proxy.SoundUpload, r io.Reader) (*ari.Key, error) {
+	if node == nil || node.App == "" || node.Node == "" {
+		return nil, eris.New("sound upload requires the key of a single node")
+	}
+	if sound == nil || sound.Name == "" || sound.Format == "" {
+		return nil, eris.New("sound upload requires the name and format of the sound")
+	}
+
+	resp, err := c.makeRequest("data", &proxy.Request{
+		Kind: "SoundUploadStart",
+		Key:  node,
+		SoundUpload: &proxy.SoundUpload{
+			Name:      sound.Name,
+			Format:    sound.Format,
+			Language:  sound.Language,
+			Overwrite: sound.Overwrite,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err() != nil {
+		return nil, resp.Err()
+	}
+	if resp.Data == nil || resp.Data.SoundUpload == nil {
+		return nil, ErrNil
+	}
+	id := resp.Data.SoundUpload.Upload
+
+	if err := c.sendSoundChunks(node, id, r); err != nil {
+		if aerr := c.commandRequest(&proxy.Request{
+			Kind:        "SoundUploadAbort",
+			Key:         node,
+			SoundUpload: &proxy.SoundUpload{Upload: id},
+		}); aerr != nil {
+			c.log.Debug("failed to abort sound upload", "upload", id, "error", aerr)
+		}
+		return nil, err
+	}
+
+	key := resp.Key
+	if key == nil {
+		key = node.New(ari.SoundKey, sound.Name)
+	}
+	return key, nil
+}
+
+// sendSoundChunks sends the file read from r to the given upload, in chunks
+// sized to the maximum payload of the NATS connection
+func (c *Client) sendSoundChunks(node *ari.Key, id string, r io.Reader) error {
+	// The chunks are base64-encoded in the JSON of the requests
+	size := int(c.core.nc.Conn.MaxPayload()-soundUploadOverhead)*3/4 - proxy.FileChunkHeaderSize
+	if size > maxSoundUploadChunk || size <= 0 {
+		size = maxSoundUploadChunk
+	}
+
+	// Read ahead by one chunk, so that the last chunk is marked as such
+	// even if the file ends on a chunk boundary
+	cur, next := make([]byte, size), make([]byte, size)
+	n, err := io.ReadFull(r, cur)
+	for seq := uint64(0); ; seq++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return eris.Wrap(err, "failed to read sound file")
+		}
+		last := err != nil
+
+		var m int
+		if !last {
+			m, err = io.ReadFull(r, next)
+			last = err == io.EOF
+		}
+
+		chunk := &proxy.FileChunk{Seq: seq, Data: cur[:n], Last: last}
+		if err := c.commandRequest(&proxy.Request{
+			Kind:        "SoundUploadChunk",
+			Key:         node,
+			SoundUpload: &proxy.SoundUpload{Upload: id, Chunk: chunk.Encode()},
+		}); err != nil {
+			return eris.Wrapf(err, "failed to upload chunk %d of sound file", seq)
+		}
+		if last {
+			return nil
+		}
+		cur, next, n = next, cur, m
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"sort"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// Topology is a snapshot of the proxy servers of a cluster, for dashboards
+type Topology struct {
+	// Nodes describes each server which answered, ordered by application and
+	// node
+	Nodes []*proxy.NodeInfo
+
+	// Channels is the total number of channels on the Asterisk nodes
+	Channels int
+
+	// Bridges is the total number of bridges on the Asterisk nodes
+	Bridges int
+
+	// Draining is the number of servers which are draining
+	Draining int
+}
+
+// Applications returns the servers of the topology, indexed by application
+func (t *Topology) Applications() map[string][]*proxy.NodeInfo {
+	ret := make(map[string][]*proxy.NodeInfo)
+	for _, n := range t.Nodes {
+		ret[n.Application] = append(ret[n.Application], n)
+	}
+	return ret
+}
+
+// ClusterInfo asks every server of the cluster to describe itself, returning
+// the aggregated topology of the servers which answer within the request
+// timeout
+func (c *Client) ClusterInfo() (*Topology, error) {
+	responses, err := c.makeRequests("get", &proxy.Request{
+		Kind: "ClusterInfo",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newTopology(responses), nil
+}
+
+// newTopology aggregates the responses to a ClusterInfo request
+func newTopology(responses []*proxy.Response) *Topology {
+	t := new(Topology)
+	for _, r := range responses {
+		if r.Err() != nil || r.Data == nil || r.Data.NodeInfo == nil {
+			continue
+		}
+		n := r.Data.NodeInfo
+
+		t.Nodes = append(t.Nodes, n)
+		t.Channels += n.Channels
+		t.Bridges += n.Bridges
+		if n.Draining {
+			t.Draining++
+		}
+	}
+
+	sort.Slice(t.Nodes, func(i, j int) bool {
+		if t.Nodes[i].Application != t.Nodes[j].Application {
+			return t.Nodes[i].Application < t.Nodes[j].Application
+		}
+		return t.Nodes[i].Node < t.Nodes[j].Node
+	})
+	return t
+}
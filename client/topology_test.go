@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestNewTopology(t *testing.T) {
+	info := func(app, node string, channels int, draining bool) *proxy.Response {
+		return &proxy.Response{
+			Data: &proxy.EntityData{
+				NodeInfo: &proxy.NodeInfo{Application: app, Node: node, Channels: channels, Bridges: 1, Draining: draining},
+			},
+		}
+	}
+
+	topo := newTopology([]*proxy.Response{
+		info("b", "n1", 3, false),
+		info("a", "n2", 2, true),
+		{Error: "ARI connection is down"},
+		info("a", "n1", 1, false),
+	})
+
+	if len(topo.Nodes) != 3 {
+		t.Fatalf("unexpected nodes: %v", topo.Nodes)
+	}
+	for i, expected := range []string{"a/n1", "a/n2", "b/n1"} {
+		if n := topo.Nodes[i]; n.Application+"/"+n.Node != expected {
+			t.Errorf("node %d: %s/%s != %s", i, n.Application, n.Node, expected)
+		}
+	}
+	if topo.Channels != 6 || topo.Bridges != 3 || topo.Draining != 1 {
+		t.Errorf("unexpected totals: %+v", topo)
+	}
+	if apps := topo.Applications(); len(apps["a"]) != 2 || len(apps["b"]) != 1 {
+		t.Errorf("unexpected applications: %v", apps)
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// DepositVoicemail plays the mailbox greeting to the given channel and records
+// a message into the mailbox.  The returned handle refers to the stored
+// recording of the message, which exists once the proxy.VoicemailFinished
+// event for the channel has been received.
+func (c *Client) DepositVoicemail(key *ari.Key, opts *proxy.Voicemail) (*ari.StoredRecordingHandle, error) {
+	k, err := c.createRequest(&proxy.Request{
+		Kind:      "VoicemailDeposit",
+		Key:       key,
+		Voicemail: opts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ari.NewStoredRecordingHandle(k, c.StoredRecording(), nil), nil
+}
+
+// RetrieveVoicemail runs the voicemail retrieval menu for the given mailbox on
+// the given channel.  A proxy.VoicemailFinished event is sent to the
+// channel's subscribers when the caller leaves the menu.
+func (c *Client) RetrieveVoicemail(key *ari.Key, mailbox string) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "VoicemailRetrieve",
+		Key:  key,
+		Voicemail: &proxy.Voicemail{
+			Mailbox: mailbox,
+		},
+	})
+}
+
+// VoicemailMessages lists the stored recording keys of the messages in the
+// given mailbox, new messages first
+func (c *Client) VoicemailMessages(filter *ari.Key, mailbox string) ([]*ari.Key, error) {
+	return c.listRequest(&proxy.Request{
+		Kind: "VoicemailList",
+		Key:  filter,
+		Voicemail: &proxy.Voicemail{
+			Mailbox: mailbox,
+		},
+	})
+}
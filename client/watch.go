@@ -0,0 +1,47 @@
+package client
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// Watch registers interest in the changes of the data of the given channel or
+// bridge.  The returned key identifies the watch, and the returned data is
+// the entity's current data.  The changes are reported by
+// proxy.EntityChanged events, to which one may subscribe by the watch key:
+//
+//   sub := cl.Bus().Subscribe(watchKey, proxy.EventEntityChanged, proxy.EventWatchExpired)
+//
+// The watch expires after its TTL unless it is renewed by RenewWatch.
+func (c *Client) Watch(key *ari.Key, opts *proxy.Watch) (*ari.Key, *proxy.EntityData, error) {
+	resp, err := c.makeRequest("create", &proxy.Request{
+		Kind:  "Watch",
+		Key:   key,
+		Watch: opts,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = resp.Err(); err != nil {
+		return nil, nil, err
+	}
+	return resp.Key, resp.Data, nil
+}
+
+// RenewWatch restarts the expiry of the given watch.  If opts specifies a
+// TTL, it replaces the TTL of the watch.
+func (c *Client) RenewWatch(key *ari.Key, opts *proxy.Watch) error {
+	return c.commandRequest(&proxy.Request{
+		Kind:  "WatchRenew",
+		Key:   key,
+		Watch: opts,
+	})
+}
+
+// CancelWatch ends the given watch
+func (c *Client) CancelWatch(key *ari.Key) error {
+	return c.commandRequest(&proxy.Request{
+		Kind: "WatchCancel",
+		Key:  key,
+	})
+}
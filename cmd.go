@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/server"
 	"github.com/CyCoreSystems/ari/v5/client/native"
@@ -44,6 +47,14 @@ var RootCmd = &cobra.Command{
 
 		native.Logger.SetHandler(handler)
 
+		if err := expandConfig(viper.GetViper()); err != nil {
+			return err
+		}
+
+		if ok, _ := cmd.PersistentFlags().GetBool("selftest"); ok { // nolint: gas
+			return runSelfTest(ctx, Log)
+		}
+
 		return runServer(ctx, Log)
 	},
 }
@@ -58,6 +69,7 @@ func init() {
 	p := RootCmd.PersistentFlags()
 
 	p.BoolP("version", "V", false, "Print version information and exit")
+	p.Bool("selftest", false, "Validate the configuration against ARI and NATS, print diagnostics and exit")
 
 	p.StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ari-proxy.yaml)")
 	p.BoolP("verbose", "v", false, "Enable verbose logging")
@@ -97,21 +109,69 @@ func readConfig() {
 	}
 }
 
-func runServer(ctx context.Context, log log15.Logger) error {
-	natsURL := viper.GetString("nats.url")
+// natsURL returns the URL of the NATS cluster
+func natsURL() string {
 	if os.Getenv("NATS_SERVICE_HOST") != "" {
-		natsURL = "nats://" + os.Getenv("NATS_SERVICE_HOST") + ":" + os.Getenv("NATS_SERVICE_PORT_CLIENT")
+		return "nats://" + os.Getenv("NATS_SERVICE_HOST") + ":" + os.Getenv("NATS_SERVICE_PORT_CLIENT")
 	}
+	return viper.GetString("nats.url")
+}
 
-	srv := server.New()
-	srv.Log = log
-
-	log.Info("starting ari-proxy server", "version", version)
-	return srv.Listen(ctx, &native.Options{
+// ariOptions returns the options for connecting to ARI
+func ariOptions() *native.Options {
+	return &native.Options{
 		Application:  viper.GetString("ari.application"),
 		Username:     viper.GetString("ari.username"),
 		Password:     viper.GetString("ari.password"),
 		URL:          viper.GetString("ari.http_url"),
 		WebsocketURL: viper.GetString("ari.websocket_url"),
-	}, natsURL)
+	}
+}
+
+// runSelfTest validates the configuration, printing the diagnostics of each
+// step, and fails if any step failed
+func runSelfTest(ctx context.Context, log log15.Logger) error {
+	srv, err := newServer(log)
+	if err != nil {
+		return err
+	}
+
+	report := srv.SelfTest(ctx, ariOptions(), natsURL(), 0)
+	if err := report.Write(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return errors.New("self-test failed")
+	}
+	return nil
+}
+
+func runServer(ctx context.Context, log log15.Logger) error {
+	srv, err := newServer(log)
+	if err != nil {
+		return err
+	}
+
+	// Stop the server on interrupt or termination
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Info("stopping ari-proxy server", "signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Info("starting ari-proxy server", "version", version, "excluded", server.ExcludedSubsystems())
+	err = srv.Listen(ctx, ariOptions(), natsURL())
+	if err == context.Canceled {
+		return nil
+	}
+	return err
 }
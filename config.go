@@ -0,0 +1,416 @@
+package main
+
+import (
+	"os"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/server"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/lcr"
+
+	"github.com/inconshreveable/log15"
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+)
+
+// newServer returns a Server configured from the loaded configuration
+func newServer(log log15.Logger) (*server.Server, error) {
+	opts := []server.Option{
+		server.WithLogger(log),
+		server.WithVersion(version),
+		server.WithEmergencyDestinations(viper.GetStringSlice("emergency_destinations")...),
+	}
+
+	if viper.IsSet("quota") {
+		quota := new(server.QuotaConfig)
+		if err := viper.UnmarshalKey("quota", quota); err != nil {
+			return nil, eris.Wrap(err, "failed to parse quota configuration")
+		}
+		opts = append(opts, server.WithQuota(quota))
+	}
+
+	if viper.GetBool("compression.enabled") {
+		cc := new(server.CompressionConfig)
+		if err := viper.UnmarshalKey("compression", cc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse compression configuration")
+		}
+		opts = append(opts, server.WithCompression(cc))
+	}
+
+	if viper.IsSet("fan_out") {
+		fo := new(server.FanOutConfig)
+		if err := viper.UnmarshalKey("fan_out", fo); err != nil {
+			return nil, eris.Wrap(err, "failed to parse fan-out configuration")
+		}
+		opts = append(opts, server.WithFanOut(fo))
+	}
+
+	if viper.IsSet("varset_filter") {
+		vf := new(server.VarsetFilterConfig)
+		if err := viper.UnmarshalKey("varset_filter", vf); err != nil {
+			return nil, eris.Wrap(err, "failed to parse varset filter configuration")
+		}
+		opts = append(opts, server.WithVarsetFilter(vf))
+	}
+
+	if viper.IsSet("sound_upload") {
+		su := new(server.SoundUploadConfig)
+		if err := viper.UnmarshalKey("sound_upload", su); err != nil {
+			return nil, eris.Wrap(err, "failed to parse sound upload configuration")
+		}
+		opts = append(opts, server.WithSoundUpload(su))
+	}
+
+	if viper.IsSet("dialog_event_limit") {
+		dl := new(server.DialogEventLimitConfig)
+		if err := viper.UnmarshalKey("dialog_event_limit", dl); err != nil {
+			return nil, eris.Wrap(err, "failed to parse dialog event limit configuration")
+		}
+		opts = append(opts, server.WithDialogEventLimit(dl))
+	}
+
+	if viper.IsSet("nats.codec") {
+		opts = append(opts, server.WithCodec(viper.GetString("nats.codec")))
+	}
+
+	if viper.IsSet("nats.max_response_size") {
+		opts = append(opts, server.WithMaxResponseSize(viper.GetInt("nats.max_response_size")))
+	}
+
+	if viper.IsSet("retry") {
+		rc := new(server.RetryConfig)
+		if err := viper.UnmarshalKey("retry", rc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse retry configuration")
+		}
+		opts = append(opts, server.WithRetry(rc))
+	}
+
+	if viper.IsSet("state_conflict") {
+		sc := new(server.StateConflictConfig)
+		if err := viper.UnmarshalKey("state_conflict", sc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse state conflict configuration")
+		}
+		opts = append(opts, server.WithStateConflict(sc))
+	}
+
+	if viper.IsSet("metrics") {
+		mc := new(server.MetricsConfig)
+		if err := viper.UnmarshalKey("metrics", mc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse metrics configuration")
+		}
+		opts = append(opts, server.WithMetrics(mc))
+	}
+
+	if viper.IsSet("health") {
+		hc := new(server.HealthConfig)
+		if err := viper.UnmarshalKey("health", hc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse health endpoint configuration")
+		}
+		opts = append(opts, server.WithHealthEndpoint(hc))
+	}
+
+	if viper.IsSet("nats.jetstream") {
+		js := new(server.JetStreamConfig)
+		if err := viper.UnmarshalKey("nats.jetstream", js); err != nil {
+			return nil, eris.Wrap(err, "failed to parse JetStream configuration")
+		}
+		opts = append(opts, server.WithJetStream(js))
+	}
+
+	if viper.IsSet("nats.event_stream") {
+		es := new(server.EventStreamConfig)
+		if err := viper.UnmarshalKey("nats.event_stream", es); err != nil {
+			return nil, eris.Wrap(err, "failed to parse event stream configuration")
+		}
+		opts = append(opts, server.WithEventStream(es))
+	}
+
+	if viper.IsSet("ari.keepalive") {
+		ka := new(server.KeepaliveConfig)
+		if err := viper.UnmarshalKey("ari.keepalive", ka); err != nil {
+			return nil, eris.Wrap(err, "failed to parse ARI keepalive configuration")
+		}
+		opts = append(opts, server.WithKeepalive(ka))
+	}
+
+	if viper.IsSet("ari.reconnect") {
+		rc := new(server.ARIReconnectConfig)
+		if err := viper.UnmarshalKey("ari.reconnect", rc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse ARI reconnection configuration")
+		}
+		opts = append(opts, server.WithARIReconnect(rc))
+	}
+
+	if viper.IsSet("instance_id") {
+		opts = append(opts, server.WithInstanceID(viper.GetString("instance_id")))
+	}
+
+	if viper.IsSet("labels") {
+		opts = append(opts, server.WithLabels(viper.GetStringMapString("labels")))
+	}
+
+	if viper.IsSet("event_routes") {
+		var routes []server.EventRoute
+		if err := viper.UnmarshalKey("event_routes", &routes); err != nil {
+			return nil, eris.Wrap(err, "failed to parse event routes")
+		}
+		opts = append(opts, server.WithEventRoutes(routes...))
+	}
+
+	if viper.IsSet("call_flows") {
+		flows, err := loadCallFlows()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, server.WithCallFlows(flows...))
+	}
+
+	if viper.IsSet("channel_variables") {
+		opts = append(opts, server.WithChannelVariables(viper.GetStringSlice("channel_variables")...))
+	}
+
+	if viper.IsSet("max_calls") {
+		opts = append(opts, server.WithMaxCalls(viper.GetInt("max_calls")))
+	}
+
+	if viper.IsSet("ari.version") {
+		opts = append(opts, server.WithARIVersion(viper.GetString("ari.version")))
+	}
+
+	if viper.IsSet("shutdown_grace_period") {
+		opts = append(opts, server.WithShutdownGracePeriod(viper.GetDuration("shutdown_grace_period")))
+	}
+
+	if viper.GetBool("systemd.enabled") {
+		sd := new(server.SystemdConfig)
+		if err := viper.UnmarshalKey("systemd", sd); err != nil {
+			return nil, eris.Wrap(err, "failed to parse systemd configuration")
+		}
+		opts = append(opts, server.WithSystemd(sd))
+	}
+
+	if viper.IsSet("drain_timeout") {
+		opts = append(opts, server.WithDrainTimeout(viper.GetDuration("drain_timeout")))
+	}
+
+	srv := server.New(opts...)
+
+	if err := configureRewriters(srv); err != nil {
+		return nil, err
+	}
+
+	srv.StirShaken = viper.GetBool("stir_shaken.enabled")
+	srv.AllowDebugCapture = viper.GetBool("debug_capture.enabled")
+	srv.VerifyPermissions = viper.GetBool("nats.verify_permissions")
+	srv.EventTypeSubjects = viper.GetBool("nats.event_type_subjects")
+	srv.CompressOversized = viper.GetBool("nats.compress_oversized")
+
+	if viper.GetBool("voicemail.enabled") {
+		vm := new(server.VoicemailConfig)
+		if err := viper.UnmarshalKey("voicemail", vm); err != nil {
+			return nil, eris.Wrap(err, "failed to parse voicemail configuration")
+		}
+		srv.Voicemail = vm
+	}
+
+	if viper.GetBool("fax.enabled") {
+		fax := new(server.FaxConfig)
+		if err := viper.UnmarshalKey("fax", fax); err != nil {
+			return nil, eris.Wrap(err, "failed to parse fax configuration")
+		}
+		srv.Fax = fax
+	}
+
+	if viper.GetBool("amd.enabled") {
+		amd := new(server.DialplanAMD)
+		if err := viper.UnmarshalKey("amd", amd); err != nil {
+			return nil, eris.Wrap(err, "failed to parse AMD configuration")
+		}
+		srv.AMD = amd
+	}
+
+	if viper.GetBool("audio_fork.enabled") {
+		af := new(server.AudioForkConfig)
+		if err := viper.UnmarshalKey("audio_fork", af); err != nil {
+			return nil, eris.Wrap(err, "failed to parse audio fork configuration")
+		}
+		srv.AudioFork = af
+	}
+
+	if viper.GetBool("dead_air.enabled") {
+		da := new(server.DeadAirConfig)
+		if err := viper.UnmarshalKey("dead_air", da); err != nil {
+			return nil, eris.Wrap(err, "failed to parse dead-air configuration")
+		}
+		srv.DeadAir = da
+	}
+
+	if viper.GetBool("log_stream.enabled") {
+		ls := new(server.LogStreamConfig)
+		if err := viper.UnmarshalKey("log_stream", ls); err != nil {
+			return nil, eris.Wrap(err, "failed to parse log stream configuration")
+		}
+		srv.LogStream = ls
+	}
+
+	if viper.IsSet("recording") {
+		rc := new(server.RecordingConfig)
+		if err := viper.UnmarshalKey("recording", rc); err != nil {
+			return nil, eris.Wrap(err, "failed to parse recording configuration")
+		}
+		srv.Recording = rc
+	}
+
+	if viper.IsSet("click_to_call.listen") {
+		c2c := new(server.ClickToCallConfig)
+		if err := viper.UnmarshalKey("click_to_call", c2c); err != nil {
+			return nil, eris.Wrap(err, "failed to parse click-to-call configuration")
+		}
+		srv.ClickToCall = c2c
+	}
+
+	if viper.IsSet("screening.rules") {
+		var rules []server.ScreeningRule
+		if err := viper.UnmarshalKey("screening.rules", &rules); err != nil {
+			return nil, eris.Wrap(err, "failed to parse screening rules")
+		}
+		sc, err := server.NewRuleScreener(rules)
+		if err != nil {
+			return nil, err
+		}
+		srv.Screeners = append(srv.Screeners, sc)
+	}
+	srv.ScreeningTimeout = viper.GetDuration("screening.timeout")
+
+	if viper.IsSet("caller_id") {
+		p, err := loadCallerIDProvider()
+		if err != nil {
+			return nil, err
+		}
+		srv.CallerID = p
+	}
+
+	if viper.IsSet("geography") {
+		cfg := new(server.GeographyConfig)
+		if err := viper.UnmarshalKey("geography", cfg); err != nil {
+			return nil, eris.Wrap(err, "failed to parse geography configuration")
+		}
+		g, err := server.NewGeographer(*cfg)
+		if err != nil {
+			return nil, err
+		}
+		srv.Geography = g
+	}
+
+	if viper.IsSet("fraud.international") {
+		l := new(server.InternationalCallLimit)
+		if err := viper.UnmarshalKey("fraud.international", l); err != nil {
+			return nil, eris.Wrap(err, "failed to parse international call limit")
+		}
+		srv.OriginatePolicies = append(srv.OriginatePolicies, l)
+	}
+
+	if f := viper.GetString("lcr.rate_table"); f != "" {
+		table, err := loadRateTable(f)
+		if err != nil {
+			return nil, err
+		}
+		srv.Router = table
+	}
+
+	return srv, nil
+}
+
+// configureRewriters loads the endpoint rewriters from the configuration
+func configureRewriters(srv *server.Server) error {
+	if viper.IsSet("rewrite.e164") {
+		n := new(server.E164Normalizer)
+		if err := viper.UnmarshalKey("rewrite.e164", n); err != nil {
+			return eris.Wrap(err, "failed to parse E.164 normalization configuration")
+		}
+		srv.EndpointRewriters = append(srv.EndpointRewriters, n)
+	}
+
+	if viper.IsSet("rewrite.rules") {
+		var rules []server.RewriteRule
+		if err := viper.UnmarshalKey("rewrite.rules", &rules); err != nil {
+			return eris.Wrap(err, "failed to parse rewrite rules")
+		}
+		r, err := server.NewRuleRewriter(rules)
+		if err != nil {
+			return err
+		}
+		srv.EndpointRewriters = append(srv.EndpointRewriters, r)
+	}
+
+	return nil
+}
+
+// loadCallFlows loads the declarative call flows given in the configuration
+// (call_flows.flows) and in the YAML file named by call_flows.file, under its
+// flows key
+func loadCallFlows() ([]server.CallFlow, error) {
+	var flows []server.CallFlow
+	if err := viper.UnmarshalKey("call_flows.flows", &flows); err != nil {
+		return nil, eris.Wrap(err, "failed to parse call flows")
+	}
+
+	if fn := viper.GetString("call_flows.file"); fn != "" {
+		v := viper.New()
+		v.SetConfigFile(fn)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, eris.Wrap(err, "failed to read call flows file")
+		}
+
+		var more []server.CallFlow
+		if err := v.UnmarshalKey("flows", &more); err != nil {
+			return nil, eris.Wrap(err, "failed to parse call flows file")
+		}
+		flows = append(flows, more...)
+	}
+	return flows, nil
+}
+
+// loadRateTable loads the least-cost routing rate table from the given CSV file
+func loadRateTable(fn string) (*lcr.Table, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to open LCR rate table")
+	}
+	defer f.Close() // nolint: errcheck
+
+	table := lcr.New(nil)
+	if err := table.LoadCSV(f); err != nil {
+		return nil, eris.Wrap(err, "failed to load LCR rate table")
+	}
+	return table, nil
+}
+
+// loadCallerIDProvider builds the caller ID lookup provider from the
+// configuration: an HTTP lookup service or a static CSV table, cached if a
+// cache TTL is given
+func loadCallerIDProvider() (server.CallerIDProvider, error) {
+	var p server.CallerIDProvider
+	switch {
+	case viper.IsSet("caller_id.http"):
+		h := new(server.HTTPCallerID)
+		if err := viper.UnmarshalKey("caller_id.http", h); err != nil {
+			return nil, eris.Wrap(err, "failed to parse caller ID lookup configuration")
+		}
+		if h.URL == "" {
+			return nil, eris.New("no caller ID lookup URL")
+		}
+		p = h
+	case viper.IsSet("caller_id.file"):
+		t, err := server.LoadStaticCallerIDFile(viper.GetString("caller_id.file"))
+		if err != nil {
+			return nil, err
+		}
+		p = t
+	default:
+		return nil, eris.New("no caller ID lookup provider (http or file)")
+	}
+
+	if ttl := viper.GetDuration("caller_id.cache_ttl"); ttl > 0 {
+		p = server.NewCachedCallerID(p, ttl, viper.GetInt("caller_id.cache_size"))
+	}
+	return p, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/spf13/viper"
+)
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandedKeys are the configuration keys, with the keys below them, whose
+// values may reference environment variables.  They are limited to the
+// identity and subjects of the proxy, so that other values, such as
+// passwords, which may legitimately contain `${`, are taken literally.
+var expandedKeys = []string{
+	"instance_id",
+	"labels",
+	"event_routes",
+	"nats.event_stream.subjects",
+	"nats.jetstream.consumer",
+}
+
+// isExpandedKey indicates whether the value of the configuration key may
+// reference environment variables
+func isExpandedKey(key string) bool {
+	for _, k := range expandedKeys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandConfig replaces the references to environment variables in the string
+// values of the expanded keys of the configuration (see expandEnv), so that
+// per-process values, such as the name of a Kubernetes pod, may be templated
+// into it
+func expandConfig(v *viper.Viper) error {
+	for _, key := range v.AllKeys() {
+		if !isExpandedKey(key) {
+			continue
+		}
+		val, changed, err := expandValue(v.Get(key), os.LookupEnv)
+		if err != nil {
+			return eris.Wrapf(err, "failed to expand configuration value %s", key)
+		}
+		if changed {
+			v.Set(key, val)
+		}
+	}
+	return nil
+}
+
+// expandValue expands the strings of the given configuration value, recursing
+// into lists and maps, returning whether any was changed.  Changed lists and
+// maps are copied rather than modified.
+func expandValue(val interface{}, lookup func(string) (string, bool)) (interface{}, bool, error) {
+	switch t := val.(type) {
+	case string:
+		s, err := expandEnv(t, lookup)
+		return s, err == nil && s != t, err
+	case []string:
+		var changed bool
+		ret := make([]string, len(t))
+		for i, e := range t {
+			s, err := expandEnv(e, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			ret[i], changed = s, changed || s != e
+		}
+		return ret, changed, nil
+	case []interface{}:
+		var changed bool
+		ret := make([]interface{}, len(t))
+		for i, e := range t {
+			v, c, err := expandValue(e, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			ret[i], changed = v, changed || c
+		}
+		return ret, changed, nil
+	case map[string]interface{}:
+		var changed bool
+		ret := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			v, c, err := expandValue(e, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			ret[k], changed = v, changed || c
+		}
+		return ret, changed, nil
+	case map[interface{}]interface{}:
+		var changed bool
+		ret := make(map[interface{}]interface{}, len(t))
+		for k, e := range t {
+			v, c, err := expandValue(e, lookup)
+			if err != nil {
+				return nil, false, err
+			}
+			ret[k], changed = v, changed || c
+		}
+		return ret, changed, nil
+	}
+	return val, false, nil
+}
+
+// expandEnv replaces the references to environment variables in s: `${NAME}`
+// is replaced by the value of the variable NAME, which must be set, and
+// `${NAME:-default}` by its value or, if it is unset or empty, by the default.
+// `$${` stands for a literal `${`; any other `$` is left as is.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", eris.New("unterminated environment variable reference")
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def := ref, ""
+		hasDefault := false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDefault = ref[:j], ref[j+2:], true
+		}
+		if !envNameRegex.MatchString(name) {
+			return "", eris.Errorf("invalid environment variable name %q", name)
+		}
+
+		val, ok := lookup(name)
+		switch {
+		case hasDefault && val == "":
+			val = def
+		case !ok:
+			return "", eris.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(val)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func testLookup(name string) (string, bool) {
+	v, ok := map[string]string{
+		"POD_NAME":    "ari-proxy-0",
+		"NODE_REGION": "eu-west-1",
+		"EMPTY":       "",
+	}[name]
+	return v, ok
+}
+
+func TestExpandEnv(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":                      "plain",
+		"${POD_NAME}":                "ari-proxy-0",
+		"pbx-${POD_NAME}-blue":       "pbx-ari-proxy-0-blue",
+		"${POD_NAME}/${NODE_REGION}": "ari-proxy-0/eu-west-1",
+		"${ZONE:-a}":                 "a",
+		"${EMPTY:-b}":                "b",
+		"${EMPTY}":                   "",
+		"${NODE_REGION:-x}":          "eu-west-1",
+		"pa$$word":                   "pa$$word",
+		"$POD_NAME":                  "$POD_NAME",
+		"$${POD_NAME}":               "${POD_NAME}",
+	} {
+		got, err := expandEnv(in, testLookup)
+		if err != nil || got != want {
+			t.Errorf("expandEnv(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"${ZONE}", "${POD_NAME", "${}", "${1X}"} {
+		if _, err := expandEnv(in, testLookup); err == nil {
+			t.Errorf("expandEnv(%q) did not fail", in)
+		}
+	}
+}
+
+func TestExpandConfig(t *testing.T) {
+	for name, val := range map[string]string{"TEST_POD_NAME": "ari-proxy-0", "TEST_NODE_REGION": "eu-west-1"} {
+		os.Setenv(name, val)    // nolint: errcheck
+		defer os.Unsetenv(name) // nolint: errcheck
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(`
+instance_id: ${TEST_POD_NAME}
+labels:
+  region: ${TEST_NODE_REGION}
+event_routes:
+  - subject: calls.${TEST_NODE_REGION}
+nats:
+  jetstream:
+    consumer: proxy-${TEST_POD_NAME}
+ari:
+  password: pa${ss
+channel_variables: ["X_${TEST_NODE_REGION}"]
+max_calls: 10
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := expandConfig(v); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("instance_id"); got != "ari-proxy-0" {
+		t.Errorf("unexpected instance ID %q", got)
+	}
+	if got := v.GetStringMapString("labels")["region"]; got != "eu-west-1" {
+		t.Errorf("unexpected region label %q", got)
+	}
+	if got := v.GetString("nats.jetstream.consumer"); got != "proxy-ari-proxy-0" {
+		t.Errorf("unexpected consumer %q", got)
+	}
+	var routes []struct{ Subject string }
+	if err := v.UnmarshalKey("event_routes", &routes); err != nil || len(routes) != 1 || routes[0].Subject != "calls.eu-west-1" {
+		t.Errorf("unexpected event routes %v: %v", routes, err)
+	}
+	if got := v.GetInt("max_calls"); got != 10 {
+		t.Errorf("unexpected maximum calls %d", got)
+	}
+
+	// Other values are taken literally
+	if got := v.GetString("ari.password"); got != "pa${ss" {
+		t.Errorf("unexpected password %q", got)
+	}
+	if got := v.GetStringSlice("channel_variables"); len(got) != 1 || got[0] != "X_${TEST_NODE_REGION}" {
+		t.Errorf("unexpected channel variables %v", got)
+	}
+
+	v.Set("instance_id", "${TEST_UNSET_POD_NAME}")
+	if err := expandConfig(v); err == nil || !strings.Contains(err.Error(), "instance_id") {
+		t.Errorf("unexpected error for unset variable: %v", err)
+	}
+}
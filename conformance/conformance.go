@@ -0,0 +1,407 @@
+// Package conformance is a wire-level compatibility suite for the ari-proxy
+// NATS protocol.  It speaks the protocol directly (JSON requests, raw
+// replies, and event messages), without the Go client library, so that it
+// verifies the semantics on which alternate client implementations rely.
+//
+// The suite runs against a live server.  It is read-only except for the
+// event checks, which create and destroy a temporary bridge.  To run it from
+// a Go test:
+//
+//   func TestConformance(t *testing.T) {
+//   	nc, _ := nats.Connect("nats://localhost:4222")
+//   	conformance.Run(t, &conformance.Config{
+//   		NATS:        nc,
+//   		Application: "test",
+//   	})
+//   }
+//
+// The package's own test runs the suite when the ARI_PROXY_CONFORMANCE_NATS
+// environment variable names the NATS URI of a live deployment (with
+// ARI_PROXY_CONFORMANCE_APP and, optionally, ARI_PROXY_CONFORMANCE_PREFIX).
+package conformance
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultTimeout is the default timeout of each request and event wait
+var DefaultTimeout = 2 * time.Second
+
+// Config describes the deployment under test
+type Config struct {
+	// NATS is the connection to the NATS cluster of the deployment
+	NATS *nats.Conn
+
+	// Application is the ARI application of the server under test
+	Application string
+
+	// Subjects is the subject scheme of the deployment.  It defaults to the
+	// default scheme with the "ari." prefix.
+	Subjects proxy.SubjectBuilder
+
+	// Timeout is the timeout of each request and event wait.  It defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+}
+
+// suite is the state of a conformance run
+type suite struct {
+	cfg *Config
+
+	// node is the Asterisk ID of the server under test, discovered from its
+	// announcement
+	node string
+}
+
+// Run runs the conformance suite against the deployment
+func Run(t *testing.T, cfg *Config) {
+	c := *cfg
+	if c.Subjects == nil {
+		c.Subjects = proxy.NewSubjectBuilder("ari.")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	s := &suite{cfg: &c}
+
+	if !t.Run("Announcement", s.testAnnouncement) {
+		t.Fatal("server did not announce itself; skipping remaining checks")
+	}
+	t.Run("AsteriskInfo", s.testAsteriskInfo)
+	t.Run("ApplicationList", s.testApplicationList)
+	t.Run("ChannelList", s.testChannelList)
+	t.Run("Pagination", s.testPagination)
+	t.Run("Compression", s.testCompression)
+	t.Run("NotFound", s.testNotFound)
+	t.Run("UnknownKind", s.testUnknownKind)
+	t.Run("Events", s.testEvents)
+}
+
+// request sends a request to the server under test, returning its response
+func (s *suite) request(class string, req *proxy.Request) (*proxy.Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to encode request")
+	}
+
+	msg, err := s.cfg.NATS.Request(s.cfg.Subjects.Request(class, s.cfg.Application, s.node), data, s.cfg.Timeout)
+	if err != nil {
+		return nil, eris.Wrap(err, "request failed")
+	}
+	return proxy.DecodeResponse(msg.Data)
+}
+
+// key returns a key addressed to the server under test
+func (s *suite) key(kind, id string) *ari.Key {
+	return ari.NewKey(kind, id, ari.WithApp(s.cfg.Application), ari.WithNode(s.node))
+}
+
+// testAnnouncement verifies that the server answers pings with an
+// announcement of its node, application, and capabilities
+func (s *suite) testAnnouncement(t *testing.T) {
+	sub, err := s.cfg.NATS.SubscribeSync(s.cfg.Subjects.Announcement())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe() // nolint: errcheck
+
+	if err = s.cfg.NATS.Publish(s.cfg.Subjects.Ping(), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(s.cfg.Timeout)
+	for time.Now().Before(deadline) {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if err != nil {
+			break
+		}
+
+		a := new(proxy.Announcement)
+		if err := json.Unmarshal(msg.Data, a); err != nil {
+			t.Errorf("invalid announcement: %v", err)
+			continue
+		}
+		if a.Application != s.cfg.Application {
+			continue
+		}
+		if a.Node == "" {
+			t.Error("announcement has no node")
+			continue
+		}
+		if len(a.Kinds) == 0 {
+			t.Log("announcement lists no kinds; the server predates capability announcements")
+		}
+		s.node = a.Node
+		return
+	}
+	t.Fatalf("no announcement received for application %s", s.cfg.Application)
+}
+
+// testAsteriskInfo verifies data requests and the node identity
+func (s *suite) testAsteriskInfo(t *testing.T) {
+	resp, err := s.request("data", &proxy.Request{
+		Kind: "AsteriskInfo",
+		Key:  ari.NodeKey(s.cfg.Application, s.node),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Fatalf("unexpected error response: %v", err)
+	}
+	if resp.Data == nil || resp.Data.Asterisk == nil {
+		t.Fatal("response has no asterisk data")
+	}
+	if id := resp.Data.Asterisk.SystemInfo.EntityID; id != s.node {
+		t.Errorf("entity ID %q does not match announced node %q", id, s.node)
+	}
+}
+
+// testApplicationList verifies list requests and key coordinates
+func (s *suite) testApplicationList(t *testing.T) {
+	resp, err := s.request("get", &proxy.Request{
+		Kind: "ApplicationList",
+		Key:  s.key(ari.ApplicationKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Fatalf("unexpected error response: %v", err)
+	}
+
+	var found bool
+	for _, k := range resp.Keys {
+		if k.Kind != ari.ApplicationKey {
+			t.Errorf("unexpected key kind %q", k.Kind)
+		}
+		if k.ID == s.cfg.Application {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("application %s is not listed", s.cfg.Application)
+	}
+}
+
+// testChannelList verifies that listed channels carry complete coordinates
+func (s *suite) testChannelList(t *testing.T) {
+	resp, err := s.request("get", &proxy.Request{
+		Kind: "ChannelList",
+		Key:  s.key(ari.ChannelKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Fatalf("unexpected error response: %v", err)
+	}
+	for _, k := range resp.Keys {
+		if k.Kind != ari.ChannelKey || k.ID == "" {
+			t.Errorf("invalid channel key %v", k)
+		}
+		if k.Node != s.node || k.App != s.cfg.Application {
+			t.Errorf("channel key %v lacks the server's coordinates", k)
+		}
+	}
+}
+
+// testPagination verifies that paginated lists honour the limit and cursor
+func (s *suite) testPagination(t *testing.T) {
+	seen := make(map[string]bool)
+	var cursor string
+	for i := 0; i < 1000; i++ {
+		resp, err := s.request("get", &proxy.Request{
+			Kind:       "ApplicationList",
+			Key:        s.key(ari.ApplicationKey, ""),
+			Pagination: &proxy.Pagination{Cursor: cursor, Limit: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = resp.Err(); err != nil {
+			t.Fatalf("unexpected error response: %v", err)
+		}
+		if len(resp.Keys) > 1 {
+			t.Fatalf("page of limit 1 has %d keys", len(resp.Keys))
+		}
+		for _, k := range resp.Keys {
+			if seen[k.ID] {
+				t.Fatalf("key %s returned twice", k.ID)
+			}
+			seen[k.ID] = true
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	if !seen[s.cfg.Application] {
+		t.Errorf("application %s is not listed by the pages", s.cfg.Application)
+	}
+
+	resp, err := s.request("get", &proxy.Request{
+		Kind:       "ApplicationList",
+		Key:        s.key(ari.ApplicationKey, ""),
+		Pagination: &proxy.Pagination{Cursor: "!", Limit: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Err() == nil {
+		t.Error("invalid cursor should be rejected")
+	}
+}
+
+// testCompression verifies that responses remain decodable when compression
+// is accepted
+func (s *suite) testCompression(t *testing.T) {
+	resp, err := s.request("get", &proxy.Request{
+		Kind:           "ApplicationList",
+		Key:            s.key(ari.ApplicationKey, ""),
+		AcceptEncoding: []string{proxy.EncodingGzip},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Fatalf("unexpected error response: %v", err)
+	}
+	if len(resp.Keys) == 0 {
+		t.Error("compressed-capable list returned no keys")
+	}
+}
+
+// testNotFound verifies that requests for missing entities return errors
+func (s *suite) testNotFound(t *testing.T) {
+	resp, err := s.request("data", &proxy.Request{
+		Kind: "ChannelData",
+		Key:  s.key(ari.ChannelKey, rid.New("cf")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Err() == nil {
+		t.Error("data of a missing channel should be an error")
+	}
+}
+
+// testUnknownKind verifies that unknown kinds are rejected with an error
+// response rather than ignored
+func (s *suite) testUnknownKind(t *testing.T) {
+	resp, err := s.request("command", &proxy.Request{
+		Kind: "ConformanceUnknownKind",
+		Key:  s.key("", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Err() == nil {
+		t.Error("unknown kind should be an error")
+	}
+}
+
+// testEvents verifies the delivery of events on the canonical and dialog
+// subjects, using the events of a temporary bridge
+func (s *suite) testEvents(t *testing.T) {
+	dialog := rid.New("cf")
+	bridgeID := rid.New(rid.Bridge)
+
+	canonical, err := s.cfg.NATS.SubscribeSync(s.cfg.Subjects.Event(s.cfg.Application, s.node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer canonical.Unsubscribe() // nolint: errcheck
+
+	dialogSub, err := s.cfg.NATS.SubscribeSync(s.cfg.Subjects.DialogEvent(dialog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialogSub.Unsubscribe() // nolint: errcheck
+
+	key := s.key(ari.BridgeKey, bridgeID)
+	key.Dialog = dialog
+
+	resp, err := s.request("create", &proxy.Request{
+		Kind: "BridgeCreate",
+		Key:  key,
+		BridgeCreate: &proxy.BridgeCreate{
+			Type: "mixing",
+			Name: "ari-proxy-conformance",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Fatalf("failed to create bridge: %v", err)
+	}
+	if resp.Key == nil || resp.Key.ID != bridgeID {
+		t.Errorf("created bridge key %v does not match requested ID %s", resp.Key, bridgeID)
+	}
+
+	resp, err = s.request("command", &proxy.Request{
+		Kind: "BridgeDelete",
+		Key:  key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = resp.Err(); err != nil {
+		t.Errorf("failed to delete bridge: %v", err)
+	}
+
+	if err := s.awaitEvent(canonical, "BridgeDestroyed", bridgeID, ""); err != nil {
+		t.Errorf("canonical subject: %v", err)
+	}
+	if err := s.awaitEvent(dialogSub, "BridgeDestroyed", bridgeID, dialog); err != nil {
+		t.Errorf("dialog subject: %v", err)
+	}
+}
+
+// awaitEvent waits for an event of the given type which refers to the given
+// bridge, verifying its metadata
+func (s *suite) awaitEvent(sub *nats.Subscription, typ, bridgeID, dialog string) error {
+	deadline := time.Now().Add(s.cfg.Timeout)
+	for time.Now().Before(deadline) {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if err != nil {
+			break
+		}
+
+		e, err := proxy.DecodeEvent(msg.Data)
+		if err != nil {
+			return eris.Wrap(err, "failed to decode event")
+		}
+		if e.GetType() != typ || !refersTo(e, bridgeID) {
+			continue
+		}
+
+		if e.GetApplication() != s.cfg.Application {
+			return eris.Errorf("event application %q != %q", e.GetApplication(), s.cfg.Application)
+		}
+		if dialog != "" && e.GetDialog() != dialog {
+			return eris.Errorf("event dialog %q != %q", e.GetDialog(), dialog)
+		}
+		return nil
+	}
+	return eris.Errorf("no %s event received", typ)
+}
+
+func refersTo(e ari.Event, id string) bool {
+	for _, k := range e.Keys() {
+		if k != nil && strings.EqualFold(k.ID, id) {
+			return true
+		}
+	}
+	return false
+}
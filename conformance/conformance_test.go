@@ -0,0 +1,33 @@
+package conformance
+
+import (
+	"os"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/nats-io/nats.go"
+)
+
+func TestConformance(t *testing.T) {
+	uri := os.Getenv("ARI_PROXY_CONFORMANCE_NATS")
+	if uri == "" {
+		t.Skip("ARI_PROXY_CONFORMANCE_NATS is not set; skipping conformance suite")
+	}
+
+	nc, err := nats.Connect(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	prefix := os.Getenv("ARI_PROXY_CONFORMANCE_PREFIX")
+	if prefix == "" {
+		prefix = "ari."
+	}
+
+	Run(t, &Config{
+		NATS:        nc,
+		Application: os.Getenv("ARI_PROXY_CONFORMANCE_APP"),
+		Subjects:    proxy.NewSubjectBuilder(prefix),
+	})
+}
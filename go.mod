@@ -23,4 +23,5 @@ require (
 	github.com/spf13/pflag v1.0.0 // indirect
 	github.com/spf13/viper v1.0.2
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
 )
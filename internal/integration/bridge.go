@@ -13,9 +13,9 @@ func TestBridgeCreate(t *testing.T, s Server) {
 	runTest("simple", t, s, func(t *testing.T, m *mock, cl ari.Client) {
 		bh := ari.NewBridgeHandle(key, m.Bridge, nil)
 
-		m.Bridge.On("Create", key, "bridgeType", "bridgeName").Return(bh, nil)
+		m.Bridge.On("Create", key, "mixing", "bridgeName").Return(bh, nil)
 
-		ret, err := cl.Bridge().Create(key, "bridgeType", "bridgeName")
+		ret, err := cl.Bridge().Create(key, "mixing", "bridgeName")
 		if err != nil {
 			t.Errorf("Unexpected error in remote create call: %v", err)
 		}
@@ -28,15 +28,15 @@ func TestBridgeCreate(t *testing.T, s Server) {
 
 		m.Shutdown()
 
-		m.Bridge.AssertCalled(t, "Create", key, "bridgeType", "bridgeName")
+		m.Bridge.AssertCalled(t, "Create", key, "mixing", "bridgeName")
 	})
 
 	runTest("error", t, s, func(t *testing.T, m *mock, cl ari.Client) {
 		expected := eris.New("unknown error")
 
-		m.Bridge.On("Create", key, "bridgeType", "bridgeName").Return(nil, expected)
+		m.Bridge.On("Create", key, "mixing", "bridgeName").Return(nil, expected)
 
-		ret, err := cl.Bridge().Create(key, "bridgeType", "bridgeName")
+		ret, err := cl.Bridge().Create(key, "mixing", "bridgeName")
 		if err == nil || eris.Cause(err).Error() != expected.Error() {
 			t.Errorf("Expected error '%v', got '%v'", expected, err)
 		}
@@ -46,7 +46,7 @@ func TestBridgeCreate(t *testing.T, s Server) {
 
 		m.Shutdown()
 
-		m.Bridge.AssertCalled(t, "Create", key, "bridgeType", "bridgeName")
+		m.Bridge.AssertCalled(t, "Create", key, "mixing", "bridgeName")
 	})
 }
 
@@ -50,28 +50,28 @@ func TestPlaybackControl(t *testing.T, s Server) {
 	key := ari.NewKey(ari.PlaybackKey, "pb1")
 
 	runTest("ok", t, s, func(t *testing.T, m *mock, cl ari.Client) {
-		m.Playback.On("Control", key, "op").Return(nil)
+		m.Playback.On("Control", key, "pause").Return(nil)
 
-		err := cl.Playback().Control(key, "op")
+		err := cl.Playback().Control(key, "pause")
 		if err != nil {
 			t.Errorf("Unexpected error in Playback Control: %s", err)
 		}
 
 		m.Shutdown()
 
-		m.Playback.AssertCalled(t, "Control", key, "op")
+		m.Playback.AssertCalled(t, "Control", key, "pause")
 	})
 	runTest("err", t, s, func(t *testing.T, m *mock, cl ari.Client) {
-		m.Playback.On("Control", key, "op").Return(errors.New("error"))
+		m.Playback.On("Control", key, "pause").Return(errors.New("error"))
 
-		err := cl.Playback().Control(key, "op")
+		err := cl.Playback().Control(key, "pause")
 		if err == nil {
 			t.Errorf("Expected error in Playback Control: %s", err)
 		}
 
 		m.Shutdown()
 
-		m.Playback.AssertCalled(t, "Control", key, "op")
+		m.Playback.AssertCalled(t, "Control", key, "pause")
 	})
 }
 
@@ -0,0 +1,295 @@
+// Package natstest provides a minimal in-process NATS server for tests which
+// exercise the proxy over a real NATS connection.  It implements the core
+// publish-subscribe protocol (including queue groups and wildcards), without
+// authentication, clustering or JetStream.
+package natstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rotisserie/eris"
+)
+
+// MaxPayload is the maximum payload announced by the server
+const MaxPayload = 1024 * 1024
+
+// Server is a minimal NATS server listening on the loopback interface
+type Server struct {
+	ln net.Listener
+
+	conns map[*conn]struct{}
+	next  int
+	mu    sync.Mutex
+
+	wg sync.WaitGroup
+}
+
+// Run starts a server on a random loopback port
+func Run() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to listen")
+	}
+	s := &Server{
+		ln:    ln,
+		conns: make(map[*conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// URL returns the URL to which NATS clients connect
+func (s *Server) URL() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+// Close stops the server, closing the connections of its clients
+func (s *Server) Close() {
+	s.ln.Close() // nolint: errcheck
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.nc.Close() // nolint: errcheck
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{
+			s:    s,
+			nc:   nc,
+			subs: make(map[string]*subscription),
+		}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			nc.Close() // nolint: errcheck
+		}()
+	}
+}
+
+// subscription is the subscription of a client to a subject
+type subscription struct {
+	c       *conn
+	sid     string
+	subject string
+	queue   string
+
+	// remaining is the number of messages after which the subscription is
+	// cancelled, if positive
+	remaining int
+}
+
+// publish delivers a message to the matching subscriptions, and to a single
+// member of each matching queue group
+func (s *Server) publish(subject, reply string, data []byte) {
+	var targets []*subscription
+	queues := make(map[string][]*subscription)
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.mu.Lock()
+		for _, sub := range c.subs {
+			if !matches(sub.subject, subject) {
+				continue
+			}
+			if sub.queue == "" {
+				targets = append(targets, sub)
+			} else {
+				queues[sub.queue] = append(queues[sub.queue], sub)
+			}
+		}
+		c.mu.Unlock()
+	}
+	for _, members := range queues {
+		targets = append(targets, members[s.next%len(members)])
+		s.next++
+	}
+	s.mu.Unlock()
+
+	for _, sub := range targets {
+		sub.c.deliver(sub, subject, reply, data)
+	}
+}
+
+// conn is the connection of a client
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	subs map[string]*subscription
+	mu   sync.Mutex
+
+	wmu sync.Mutex
+}
+
+func (c *conn) write(format string, args ...interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := fmt.Fprintf(c.nc, format, args...)
+	return err
+}
+
+func (c *conn) deliver(sub *subscription, subject, reply string, data []byte) {
+	c.mu.Lock()
+	if c.subs[sub.sid] != sub {
+		c.mu.Unlock()
+		return
+	}
+	if sub.remaining > 0 {
+		sub.remaining--
+		if sub.remaining == 0 {
+			delete(c.subs, sub.sid)
+		}
+	}
+	c.mu.Unlock()
+
+	if reply != "" {
+		reply += " "
+	}
+	c.write("MSG %s %s %s%d\r\n%s\r\n", subject, sub.sid, reply, len(data), data) // nolint: errcheck
+}
+
+func (c *conn) serve() {
+	info, _ := json.Marshal(map[string]interface{}{ // nolint: errcheck
+		"server_id":   "natstest",
+		"version":     "2.0.0",
+		"proto":       1,
+		"max_payload": MaxPayload,
+	})
+	if err := c.write("INFO %s\r\n", info); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(c.nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONNECT", "PONG":
+		case "PING":
+			err = c.write("PONG\r\n")
+		case "SUB":
+			err = c.subscribe(fields[1:])
+		case "UNSUB":
+			err = c.unsubscribe(fields[1:])
+		case "PUB":
+			err = c.pub(r, fields[1:])
+		default:
+			err = eris.Errorf("unknown operation %s", fields[0])
+		}
+		if err != nil {
+			c.write("-ERR '%s'\r\n", err) // nolint: errcheck
+			return
+		}
+	}
+}
+
+func (c *conn) subscribe(args []string) error {
+	sub := &subscription{c: c}
+	switch len(args) {
+	case 2:
+		sub.subject, sub.sid = args[0], args[1]
+	case 3:
+		sub.subject, sub.queue, sub.sid = args[0], args[1], args[2]
+	default:
+		return eris.New("invalid SUB")
+	}
+	c.mu.Lock()
+	c.subs[sub.sid] = sub
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *conn) unsubscribe(args []string) error {
+	if len(args) == 0 {
+		return eris.New("invalid UNSUB")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(args) > 1 {
+		max, err := strconv.Atoi(args[1])
+		if err != nil {
+			return eris.Wrap(err, "invalid UNSUB")
+		}
+		if sub, ok := c.subs[args[0]]; ok && max > 0 {
+			sub.remaining = max
+			return nil
+		}
+	}
+	delete(c.subs, args[0])
+	return nil
+}
+
+func (c *conn) pub(r *bufio.Reader, args []string) error {
+	var subject, reply, size string
+	switch len(args) {
+	case 2:
+		subject, size = args[0], args[1]
+	case 3:
+		subject, reply, size = args[0], args[1], args[2]
+	default:
+		return eris.New("invalid PUB")
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil {
+		return eris.Wrap(err, "invalid PUB")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, 2); err != nil {
+		return err
+	}
+	c.s.publish(subject, reply, data)
+	return nil
+}
+
+// matches reports whether the subject matches the pattern of a subscription,
+// which may contain wildcards
+func matches(pattern, subject string) bool {
+	p := strings.Split(pattern, ".")
+	t := strings.Split(subject, ".")
+	for i, tok := range p {
+		if tok == ">" {
+			return len(t) > i
+		}
+		if i >= len(t) || (tok != "*" && tok != t[i]) {
+			return false
+		}
+	}
+	return len(p) == len(t)
+}
@@ -0,0 +1,75 @@
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestMatches(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, subject string
+		expected         bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a.b.c", false},
+		{"a.>", "a.b.c", true},
+		{"a.>", "a", false},
+		{"a.b.c", "a.b", false},
+	} {
+		if got := matches(tt.pattern, tt.subject); got != tt.expected {
+			t.Errorf("%s matches %s: %v", tt.pattern, tt.subject, got)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	s, err := Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	nc, err := nats.Connect(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	// Only one member of a queue group answers
+	for i := 0; i < 2; i++ {
+		if _, err := nc.QueueSubscribe("echo", "q", func(m *nats.Msg) {
+			nc.Publish(m.Reply, m.Data) // nolint: errcheck
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replies, err := nc.SubscribeSync("_INBOX.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.PublishRequest("echo", "_INBOX.test", []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	m, err := replies.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Data) != "ping" {
+		t.Errorf("unexpected reply %q", m.Data)
+	}
+	if _, err := replies.NextMsg(50 * time.Millisecond); err == nil {
+		t.Error("queue group answered twice")
+	}
+
+	m, err = nc.Request("echo", []byte("pong"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Data) != "pong" {
+		t.Errorf("unexpected reply %q", m.Data)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
+import "os"
+
 var version = "master"
 
 func main() {
 	if err := RootCmd.Execute(); err != nil {
 		Log.Error("server died", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// Channel variables by which the proxy attaches normalized STIR/SHAKEN
+// attestation data to the channel of a StasisStart event
+const (
+	// AttestationLevelVar holds the attestation level of the call ("A", "B", or "C")
+	AttestationLevelVar = "ARI_PROXY_ATTESTATION_LEVEL"
+
+	// AttestationResultVar holds the normalized verification result (see AttestationResult)
+	AttestationResultVar = "ARI_PROXY_ATTESTATION_RESULT"
+
+	// AttestationOrigVar holds the originating telephone number asserted by the PASSporT
+	AttestationOrigVar = "ARI_PROXY_ATTESTATION_ORIG"
+
+	// AttestationDestVar holds the comma-separated destination telephone numbers asserted by the PASSporT
+	AttestationDestVar = "ARI_PROXY_ATTESTATION_DEST"
+)
+
+// AttestationResult is the normalized outcome of STIR/SHAKEN verification
+type AttestationResult string
+
+const (
+	// AttestationNotPresent indicates that the call carried no Identity information
+	AttestationNotPresent AttestationResult = "not_present"
+
+	// AttestationVerified indicates that the Identity was verified successfully
+	AttestationVerified AttestationResult = "verified"
+
+	// AttestationFailed indicates that verification of the Identity failed
+	AttestationFailed AttestationResult = "failed"
+
+	// AttestationUnverified indicates that Identity information was present
+	// but was not verified by Asterisk
+	AttestationUnverified AttestationResult = "unverified"
+)
+
+// Attestation describes the STIR/SHAKEN attestation of an inbound call
+type Attestation struct {
+	// Level is the attestation level ("A", "B", or "C"), if known
+	Level string `json:"level,omitempty"`
+
+	// Result is the verification result
+	Result AttestationResult `json:"result"`
+
+	// Orig is the originating telephone number asserted by the PASSporT
+	Orig string `json:"orig,omitempty"`
+
+	// Dest is the list of destination telephone numbers asserted by the PASSporT
+	Dest []string `json:"dest,omitempty"`
+}
+
+// Trusted indicates whether the call was verified with full (A-level) attestation
+func (a *Attestation) Trusted() bool {
+	return a != nil && a.Result == AttestationVerified && a.Level == "A"
+}
+
+// GetAttestation returns the attestation data which the proxy attached to the
+// given channel, or nil if none was attached.
+func GetAttestation(ch *ari.ChannelData) *Attestation {
+	if ch == nil || ch.ChannelVars == nil {
+		return nil
+	}
+
+	result, ok := ch.ChannelVars[AttestationResultVar]
+	if !ok {
+		return nil
+	}
+
+	a := &Attestation{
+		Level:  ch.ChannelVars[AttestationLevelVar],
+		Result: AttestationResult(result),
+		Orig:   ch.ChannelVars[AttestationOrigVar],
+	}
+	if dest := ch.ChannelVars[AttestationDestVar]; dest != "" {
+		a.Dest = strings.Split(dest, ",")
+	}
+	return a
+}
+
+// SetAttestation attaches the given attestation data to the channel
+func SetAttestation(ch *ari.ChannelData, a *Attestation) {
+	if ch == nil || a == nil {
+		return
+	}
+	if ch.ChannelVars == nil {
+		ch.ChannelVars = make(map[string]string)
+	}
+
+	ch.ChannelVars[AttestationResultVar] = string(a.Result)
+	if a.Level != "" {
+		ch.ChannelVars[AttestationLevelVar] = a.Level
+	}
+	if a.Orig != "" {
+		ch.ChannelVars[AttestationOrigVar] = a.Orig
+	}
+	if len(a.Dest) > 0 {
+		ch.ChannelVars[AttestationDestVar] = strings.Join(a.Dest, ",")
+	}
+}
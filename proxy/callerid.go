@@ -0,0 +1,67 @@
+package proxy
+
+import "github.com/CyCoreSystems/ari/v5"
+
+// Channel variables by which the proxy attaches the result of a caller ID
+// lookup to the channel of a StasisStart event
+const (
+	// CallerNameVar holds the name of the caller
+	CallerNameVar = "ARI_PROXY_CALLER_NAME"
+
+	// CallerTypeVar holds the type of the caller (e.g. "business",
+	// "residential", or "spam"), as reported by the lookup provider
+	CallerTypeVar = "ARI_PROXY_CALLER_TYPE"
+
+	// CallerSourceVar holds the name of the lookup provider
+	CallerSourceVar = "ARI_PROXY_CALLER_SOURCE"
+)
+
+// CallerInfo describes the caller of an inbound call, as resolved from its
+// caller ID number
+type CallerInfo struct {
+	// Name is the name of the caller (CNAM)
+	Name string `json:"name,omitempty"`
+
+	// Type is the type of the caller (e.g. "business", "residential", or
+	// "spam"), if the provider reports one
+	Type string `json:"type,omitempty"`
+
+	// Source identifies the provider of the information
+	Source string `json:"source,omitempty"`
+}
+
+// GetCallerInfo returns the caller information which the proxy attached to
+// the given channel, or nil if none was attached
+func GetCallerInfo(ch *ari.ChannelData) *CallerInfo {
+	if ch == nil || ch.ChannelVars == nil {
+		return nil
+	}
+
+	name, ok := ch.ChannelVars[CallerNameVar]
+	if !ok {
+		return nil
+	}
+	return &CallerInfo{
+		Name:   name,
+		Type:   ch.ChannelVars[CallerTypeVar],
+		Source: ch.ChannelVars[CallerSourceVar],
+	}
+}
+
+// SetCallerInfo attaches the given caller information to the channel
+func SetCallerInfo(ch *ari.ChannelData, info *CallerInfo) {
+	if ch == nil || info == nil {
+		return
+	}
+	if ch.ChannelVars == nil {
+		ch.ChannelVars = make(map[string]string)
+	}
+
+	ch.ChannelVars[CallerNameVar] = info.Name
+	if info.Type != "" {
+		ch.ChannelVars[CallerTypeVar] = info.Type
+	}
+	if info.Source != "" {
+		ch.ChannelVars[CallerSourceVar] = info.Source
+	}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+// CallGraph is the topology of the channels and bridges connected to a
+// channel, as returned by a CallGraph request
+type CallGraph struct {
+	// Root is the ID of the channel from which the graph was assembled
+	Root string `json:"root"`
+
+	// Channels is the list of the channels of the graph
+	Channels []CallGraphChannel `json:"channels"`
+
+	// Bridges is the list of the bridges of the graph
+	Bridges []CallGraphBridge `json:"bridges,omitempty"`
+
+	// Links is the list of the connections between the channels and bridges
+	// of the graph
+	Links []CallGraphLink `json:"links,omitempty"`
+}
+
+// Kinds of channels of a call graph
+const (
+	CallGraphChannelStandard = "channel"
+	CallGraphChannelLocal    = "local"
+	CallGraphChannelSnoop    = "snoop"
+)
+
+// CallGraphChannel describes a channel of a call graph
+type CallGraphChannel struct {
+	// ID is the ID of the channel
+	ID string `json:"id"`
+
+	// Name is the name of the channel (e.g. "PJSIP/100-00000001")
+	Name string `json:"name"`
+
+	// Kind is the kind of channel (CallGraphChannelStandard, etc.)
+	Kind string `json:"kind"`
+
+	// State is the state of the channel (e.g. "Up")
+	State string `json:"state,omitempty"`
+
+	// CallerNumber is the caller ID number of the channel
+	CallerNumber string `json:"caller_number,omitempty"`
+
+	// ConnectedNumber is the connected line number of the channel
+	ConnectedNumber string `json:"connected_number,omitempty"`
+}
+
+// CallGraphBridge describes a bridge of a call graph
+type CallGraphBridge struct {
+	// ID is the ID of the bridge
+	ID string `json:"id"`
+
+	// Type is the type of the bridge (e.g. "mixing")
+	Type string `json:"type,omitempty"`
+
+	// Technology is the bridging technology (e.g. "simple_bridge")
+	Technology string `json:"technology,omitempty"`
+}
+
+// Types of links of a call graph
+const (
+	// CallGraphBridged links a channel (From) to the bridge it is in (To)
+	CallGraphBridged = "bridged"
+
+	// CallGraphLocalPair links the ;1 half of a Local channel (From) to its
+	// ;2 half (To)
+	CallGraphLocalPair = "local_pair"
+
+	// CallGraphSnoop links a snoop channel (From) to the channel it spies on
+	// (To)
+	CallGraphSnoop = "snoop"
+)
+
+// CallGraphLink is a connection between the channels and bridges of a call
+// graph
+type CallGraphLink struct {
+	// Type is the type of the link (CallGraphBridged, etc.)
+	Type string `json:"type"`
+
+	// From is the ID of the channel from which the link originates
+	From string `json:"from"`
+
+	// To is the ID of the channel or bridge to which the link leads
+	To string `json:"to"`
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/rotisserie/eris"
+)
+
+// EncodingChunked identifies responses which may be split into several
+// messages, when they exceed the maximum size of a message
+const EncodingChunked = "chunked"
+
+// chunkMarker is the first byte of the chunks of a chunked response.  It is
+// followed by the length and the bytes of the ID of the transfer, the index
+// of the chunk and the number of chunks (as uvarints), and the data of the
+// chunk.  Neither JSON encodings, codec-encoded messages (see codecMarker) nor
+// compressed responses start with it.
+const chunkMarker = 0x02
+
+// MaxChunks is the maximum number of chunks of a response, which bounds the
+// memory held by a receiver for an incomplete response
+const MaxChunks = 1024
+
+// chunkHeaderSize returns the maximum size of the header of the chunks of the
+// transfer of the given ID
+func chunkHeaderSize(id string) int {
+	return 2 + len(id) + 2*binary.MaxVarintLen32
+}
+
+// ChunkResponse splits the encoding of a response into chunks of at most the
+// given size, including their headers, and passes each chunk, in order, to fn.
+// The ID identifies the transfer among those received on the same subject
+// (e.g. the responses of several proxies to a broadcast request), and may be
+// at most 255 bytes long.
+func ChunkResponse(id string, data []byte, size int, fn func(chunk []byte) error) error {
+	if len(id) == 0 || len(id) > 255 {
+		return eris.New("invalid chunked transfer ID")
+	}
+	payload := size - chunkHeaderSize(id)
+	if payload <= 0 {
+		return eris.Errorf("chunk size %d is too small", size)
+	}
+	count := (len(data) + payload - 1) / payload
+	if count > MaxChunks {
+		return eris.Wrapf(ErrResponseTooLarge, "response of %d bytes requires more than %d chunks", len(data), MaxChunks)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	var n [binary.MaxVarintLen32]byte
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(data) {
+			end = len(data)
+		}
+
+		buf.Reset()
+		buf.WriteByte(chunkMarker)
+		buf.WriteByte(byte(len(id)))
+		buf.WriteString(id)
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(i))])
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(count))])
+		buf.Write(data[i*payload : end])
+
+		if err := fn(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsChunk indicates whether the given message is a chunk of a chunked response
+func IsChunk(data []byte) bool {
+	return len(data) > 0 && data[0] == chunkMarker
+}
+
+// parseChunk returns the transfer ID, index, number of chunks, and data of a
+// chunk
+func parseChunk(data []byte) (id string, index, count int, payload []byte, err error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return "", 0, 0, nil, eris.New("truncated chunk header")
+	}
+	id = string(data[2 : 2+int(data[1])])
+	data = data[2+int(data[1]):]
+
+	i, n := binary.Uvarint(data)
+	if n <= 0 {
+		return "", 0, 0, nil, eris.New("invalid chunk index")
+	}
+	data = data[n:]
+	c, n := binary.Uvarint(data)
+	if n <= 0 || c == 0 || c > MaxChunks || i >= c {
+		return "", 0, 0, nil, eris.New("invalid chunk count")
+	}
+	return id, int(i), int(c), data[n:], nil
+}
+
+// chunkedTransfer is a chunked response being reassembled
+type chunkedTransfer struct {
+	chunks   [][]byte
+	received int
+}
+
+// ChunkAssembler reassembles the chunked responses received on a subject.
+// Messages which are not chunks are passed through.
+type ChunkAssembler struct {
+	transfers map[string]*chunkedTransfer
+	mu        sync.Mutex
+}
+
+// Add adds a message to the assembler, returning the complete message once
+// all of its chunks are received, or nil while it is incomplete
+func (a *ChunkAssembler) Add(data []byte) ([]byte, error) {
+	if !IsChunk(data) {
+		return data, nil
+	}
+	id, index, count, payload, err := parseChunk(data)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.transfers == nil {
+		a.transfers = make(map[string]*chunkedTransfer)
+	}
+	t, ok := a.transfers[id]
+	if !ok {
+		t = &chunkedTransfer{chunks: make([][]byte, count)}
+		a.transfers[id] = t
+	}
+	if len(t.chunks) != count {
+		delete(a.transfers, id)
+		return nil, eris.Errorf("inconsistent chunk count in transfer %s", id)
+	}
+	if t.chunks[index] == nil {
+		// The data of the message may be reused by the receiver
+		t.chunks[index] = append([]byte(nil), payload...)
+		t.received++
+	}
+	if t.received < count {
+		return nil, nil
+	}
+
+	delete(a.transfers, id)
+	var size int
+	for _, c := range t.chunks {
+		size += len(c)
+	}
+	ret := make([]byte, 0, size)
+	for _, c := range t.chunks {
+		ret = append(ret, c...)
+	}
+	return ret, nil
+}
+
+// DecodeResponse adds a message to the assembler and decodes the response
+// once it is complete (see DecodeResponse).  It returns a nil response and
+// error while the response is incomplete.
+func (a *ChunkAssembler) DecodeResponse(data []byte) (*Response, error) {
+	data, err := a.Add(data)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return DecodeResponse(data)
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func chunks(t *testing.T, id string, data []byte, size int) [][]byte {
+	var ret [][]byte
+	err := ChunkResponse(id, data, size, func(chunk []byte) error {
+		if len(chunk) > size {
+			t.Errorf("chunk of %d bytes exceeds %d", len(chunk), size)
+		}
+		ret = append(ret, append([]byte(nil), chunk...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestChunkResponse(t *testing.T) {
+	resp := &Response{
+		Keys: []*ari.Key{ari.NewKey(ari.SoundKey, strings.Repeat("x", 1000))},
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	one := chunks(t, "one", data, 100)
+	two := chunks(t, "two", data, 300)
+	if len(one) < 10 || len(two) < 4 {
+		t.Fatalf("unexpected chunk counts: %d, %d", len(one), len(two))
+	}
+
+	// Interleave the chunks of the two transfers, with a duplicate and a
+	// message which is not chunked
+	var asm ChunkAssembler
+	var complete int
+	for i := len(one) - 1; i >= 0; i-- {
+		in := [][]byte{one[i]}
+		if i < len(two) {
+			in = append(in, two[i], two[i])
+		}
+		for _, m := range in {
+			out, err := asm.DecodeResponse(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != nil {
+				complete++
+				if len(out.Keys) != 1 || out.Keys[0].ID != resp.Keys[0].ID {
+					t.Errorf("unexpected response: %+v", out)
+				}
+			}
+		}
+	}
+	if complete != 2 {
+		t.Errorf("expected 2 complete responses, got %d", complete)
+	}
+
+	if out, err := asm.Add(data); err != nil || !bytes.Equal(out, data) {
+		t.Error("messages which are not chunked should pass through")
+	}
+}
+
+func TestChunkResponseLimits(t *testing.T) {
+	if err := ChunkResponse("id", make([]byte, 100), 10, func([]byte) error { return nil }); err == nil {
+		t.Error("chunks smaller than their headers should be rejected")
+	}
+	err := ChunkResponse("id", make([]byte, 100*MaxChunks), 50, func([]byte) error { return nil })
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("expected ErrResponseTooLarge, got %v", err)
+	}
+
+	var asm ChunkAssembler
+	for _, m := range [][]byte{
+		{chunkMarker},
+		{chunkMarker, 5, 'a'},
+		{chunkMarker, 1, 'a', 3, 2},
+		{chunkMarker, 1, 'a', 0, 0},
+	} {
+		if _, err := asm.Add(m); err == nil {
+			t.Errorf("invalid chunk %v should be rejected", m)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// CodecJSON is the name of the JSON codec, which is the default
+const CodecJSON = "json"
+
+// codecMarker is the first byte of the messages encoded by codecs other than
+// JSON, followed by the ID of the codec.  JSON encodings never start with it,
+// nor do compressed responses, so receivers decode each message with the codec
+// which encoded it, whichever codec they are configured to encode with.
+const codecMarker = 0x00
+
+// Codec encodes the Requests, Responses and events exchanged by proxies and
+// their clients.  The JSON codec is built in; others (e.g. protobuf, following
+// the message definitions of the schema) are registered with RegisterCodec
+// by the applications which use them, on both proxies and clients.
+type Codec interface {
+	// Name is the name by which the codec is configured
+	Name() string
+
+	// Encode encodes a Request or Response and passes the encoding to fn,
+	// under the same terms as EncodeJSON
+	Encode(v interface{}, fn func(data []byte) error) error
+
+	// Decode decodes a Request or Response
+	Decode(data []byte, v interface{}) error
+
+	// EncodeEvent encodes an event, including the given header, and passes
+	// the encoding to fn, under the same terms as EncodeJSON
+	EncodeEvent(e ari.Event, h ari.Header, fn func(data []byte) error) error
+
+	// DecodeEvent decodes an event, including its header
+	DecodeEvent(data []byte) (ari.Event, error)
+}
+
+// JSONCodec is the built-in JSON Codec
+type JSONCodec struct{}
+
+// Name implements Codec
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+// Encode implements Codec
+func (JSONCodec) Encode(v interface{}, fn func(data []byte) error) error {
+	return EncodeJSON(v, fn)
+}
+
+// Decode implements Codec
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// EncodeEvent implements Codec
+func (JSONCodec) EncodeEvent(e ari.Event, h ari.Header, fn func(data []byte) error) error {
+	return encodeJSONEvent(e, h, fn)
+}
+
+// DecodeEvent implements Codec
+func (JSONCodec) DecodeEvent(data []byte) (ari.Event, error) {
+	return decodeJSONEvent(data)
+}
+
+var codecRegistry = struct {
+	byName map[string]Codec
+	byID   map[byte]Codec
+	ids    map[string]byte
+	mu     sync.RWMutex
+}{
+	byName: map[string]Codec{CodecJSON: JSONCodec{}},
+	byID:   make(map[byte]Codec),
+	ids:    make(map[string]byte),
+}
+
+// RegisterCodec registers a Codec under the given ID, which identifies its
+// encodings on the wire and must be the same on all proxies and clients.  The
+// ID may not be zero.
+func RegisterCodec(id byte, c Codec) error {
+	if id == 0 {
+		return eris.New("codec ID may not be zero")
+	}
+	if c == nil || c.Name() == "" {
+		return eris.New("codec must have a name")
+	}
+
+	codecRegistry.mu.Lock()
+	defer codecRegistry.mu.Unlock()
+
+	if _, ok := codecRegistry.byName[c.Name()]; ok {
+		return eris.Errorf("codec %s is already registered", c.Name())
+	}
+	if existing, ok := codecRegistry.byID[id]; ok {
+		return eris.Errorf("codec ID %d is already registered by %s", id, existing.Name())
+	}
+	codecRegistry.byName[c.Name()] = c
+	codecRegistry.byID[id] = c
+	codecRegistry.ids[c.Name()] = id
+	return nil
+}
+
+// LookupCodec returns the registered Codec of the given name.  An empty name
+// designates the JSON codec.
+func LookupCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecJSON
+	}
+
+	codecRegistry.mu.RLock()
+	defer codecRegistry.mu.RUnlock()
+
+	c, ok := codecRegistry.byName[name]
+	if !ok {
+		return nil, eris.Errorf("unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// Codecs returns the names of the registered codecs
+func Codecs() (names []string) {
+	codecRegistry.mu.RLock()
+	defer codecRegistry.mu.RUnlock()
+
+	for name := range codecRegistry.byName {
+		names = append(names, name)
+	}
+	return
+}
+
+// codecID returns the wire ID of the given codec, or zero for JSON
+func codecID(c Codec) byte {
+	codecRegistry.mu.RLock()
+	defer codecRegistry.mu.RUnlock()
+	return codecRegistry.ids[c.Name()]
+}
+
+// codecOf returns the codec which encoded the given message, and the message
+// without its codec marker
+func codecOf(data []byte) (Codec, []byte, error) {
+	if len(data) == 0 || data[0] != codecMarker {
+		return JSONCodec{}, data, nil
+	}
+	if len(data) < 2 {
+		return nil, nil, eris.New("truncated codec marker")
+	}
+
+	codecRegistry.mu.RLock()
+	c, ok := codecRegistry.byID[data[1]]
+	codecRegistry.mu.RUnlock()
+	if !ok {
+		return nil, nil, eris.Errorf("message encoded by unknown codec %d", data[1])
+	}
+	return c, data[2:], nil
+}
+
+// frame passes the given encoding to fn, preceded by the marker of the codec
+// which produced it
+func frame(id byte, fn func(data []byte) error) func(data []byte) error {
+	if id == 0 {
+		return fn
+	}
+	return func(data []byte) error {
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		buf.WriteByte(codecMarker)
+		buf.WriteByte(id)
+		buf.Write(data)
+		return fn(buf.Bytes())
+	}
+}
+
+// EncodeWith encodes a Request or Response with the given codec (JSON, if it
+// is nil), and passes the encoding to fn, under the same terms as EncodeJSON
+func EncodeWith(c Codec, v interface{}, fn func(data []byte) error) error {
+	if c == nil {
+		return EncodeJSON(v, fn)
+	}
+	return c.Encode(v, frame(codecID(c), fn))
+}
+
+// EncodeEventWith encodes an event with the given codec (JSON, if it is nil),
+// including the given header, and passes the encoding to fn, under the same
+// terms as EncodeJSON
+func EncodeEventWith(c Codec, e ari.Event, h ari.Header, fn func(data []byte) error) error {
+	if c == nil {
+		return encodeJSONEvent(e, h, fn)
+	}
+	return c.EncodeEvent(e, h, frame(codecID(c), fn))
+}
+
+// DecodeRequest decodes a request, with the codec which encoded it
+func DecodeRequest(data []byte) (*Request, error) {
+	c, data, err := codecOf(data)
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(Request)
+	if err := c.Decode(data, req); err != nil {
+		return nil, eris.Wrap(err, "failed to decode request")
+	}
+	return req, nil
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"sync"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// base64Codec is a test Codec whose encodings are not JSON
+type base64Codec struct{}
+
+func (base64Codec) Name() string { return "base64" }
+
+func (base64Codec) Encode(v interface{}, fn func(data []byte) error) error {
+	return EncodeJSON(v, func(data []byte) error {
+		return fn([]byte(base64.StdEncoding.EncodeToString(data)))
+	})
+}
+
+func (base64Codec) Decode(data []byte, v interface{}) error {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+	return JSONCodec{}.Decode(raw, v)
+}
+
+func (base64Codec) EncodeEvent(e ari.Event, h ari.Header, fn func(data []byte) error) error {
+	return EncodeEvent(e, h, func(data []byte) error {
+		return fn([]byte(base64.StdEncoding.EncodeToString(data)))
+	})
+}
+
+func (base64Codec) DecodeEvent(data []byte) (ari.Event, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return JSONCodec{}.DecodeEvent(raw)
+}
+
+var registerTestCodec sync.Once
+
+func testCodecs(t testing.TB) []Codec {
+	registerTestCodec.Do(func() {
+		if err := RegisterCodec(200, base64Codec{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return []Codec{nil, JSONCodec{}, base64Codec{}}
+}
+
+func codecName(c Codec) string {
+	if c == nil {
+		return "default"
+	}
+	return c.Name()
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, c := range testCodecs(t) {
+		req := &Request{Kind: "ChannelPlay", Key: ari.NewKey(ari.ChannelKey, "c1")}
+		var got *Request
+		err := EncodeWith(c, req, func(data []byte) (err error) {
+			got, err = DecodeRequest(data)
+			return err
+		})
+		if err != nil || got.Kind != req.Kind || got.Key.ID != "c1" {
+			t.Errorf("%s: unexpected request %+v (%v)", codecName(c), got, err)
+		}
+
+		resp := &Response{Error: "boom", ErrorCode: ErrorCodeConflict}
+		var gotResp *Response
+		err = EncodeWith(c, resp, func(data []byte) (err error) {
+			compressed, err := CompressResponse(data)
+			if err != nil {
+				return err
+			}
+			gotResp, err = DecodeResponse(compressed)
+			return err
+		})
+		if err != nil || gotResp.Error != "boom" || gotResp.ErrorCode != ErrorCodeConflict {
+			t.Errorf("%s: unexpected response %+v (%v)", codecName(c), gotResp, err)
+		}
+
+		var e ari.Event
+		err = EncodeEventWith(c, benchEvent(), ari.Header{"tenant": []string{"acme"}}, func(data []byte) (err error) {
+			e, err = DecodeEvent(data)
+			return err
+		})
+		if err != nil {
+			t.Errorf("%s: failed to decode event: %v", codecName(c), err)
+			continue
+		}
+		v, ok := e.(*ari.StasisStart)
+		if !ok || v.Channel.ID != "1234.5" || v.Header.Get("tenant") != "acme" {
+			t.Errorf("%s: unexpected event %+v", codecName(c), e)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	testCodecs(t)
+
+	if err := RegisterCodec(0, base64Codec{}); err == nil {
+		t.Error("expected error for zero codec ID")
+	}
+	if err := RegisterCodec(201, base64Codec{}); err == nil {
+		t.Error("expected error for duplicate codec name")
+	}
+	if err := RegisterCodec(200, JSONCodec{}); err == nil {
+		t.Error("expected error for duplicate codec ID")
+	}
+	if _, err := LookupCodec("no-such-codec"); err == nil {
+		t.Error("expected error for unknown codec")
+	}
+	if c, err := LookupCodec(""); err != nil || c.Name() != CodecJSON {
+		t.Errorf("expected JSON codec by default, got %v (%v)", c, err)
+	}
+	if _, err := DecodeRequest([]byte{codecMarker, 99, '{', '}'}); err == nil {
+		t.Error("expected error for unknown codec ID")
+	}
+}
+
+// benchmarkCodecs runs the given benchmark with each of the registered codecs,
+// so that codecs registered by applications (e.g. protobuf) may be compared
+// with JSON
+func benchmarkCodecs(b *testing.B, fn func(b *testing.B, c Codec)) {
+	for _, name := range Codecs() {
+		c, err := LookupCodec(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			fn(b, c)
+		})
+	}
+}
+
+func benchRequest() *Request {
+	return &Request{
+		Kind:        "ChannelPlay",
+		Key:         ari.NewKey(ari.ChannelKey, "1234.5", ari.WithApp("app"), ari.WithNode("node")),
+		ChannelPlay: &ChannelPlay{PlaybackID: "pb1", MediaURI: "sound:hello-world"},
+	}
+}
+
+func BenchmarkCodecRequest(b *testing.B) {
+	req := benchRequest()
+	benchmarkCodecs(b, func(b *testing.B, c Codec) {
+		for i := 0; i < b.N; i++ {
+			err := EncodeWith(c, req, func(data []byte) error {
+				_, err := DecodeRequest(data)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCodecResponse(b *testing.B) {
+	resp := &Response{Data: &EntityData{Channel: &benchEvent().Channel}}
+	benchmarkCodecs(b, func(b *testing.B, c Codec) {
+		for i := 0; i < b.N; i++ {
+			err := EncodeWith(c, resp, func(data []byte) error {
+				_, err := DecodeResponse(data)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCodecEvent(b *testing.B) {
+	e := benchEvent()
+	h := ari.Header{"tenant": []string{"acme"}}
+	benchmarkCodecs(b, func(b *testing.B, c Codec) {
+		for i := 0; i < b.N; i++ {
+			err := EncodeEventWith(c, e, h, func(data []byte) error {
+				_, err := DecodeEvent(data)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// CollectDigits describes a request to collect DTMF digits from a channel.
+// The collection completes when the digits match the Pattern, when
+// MaxDigits digits are collected, when a Terminator digit is received, or
+// on timeout; the result is reported by a DigitsCollected event.
+type CollectDigits struct {
+	// Prompt is the optional media URI (e.g. "sound:enter-account") played
+	// to the channel when the collection starts, and again on each retry.
+	// The prompt is stopped by the first digit.
+	Prompt string `json:"prompt,omitempty"`
+
+	// Pattern is an optional regular expression which completes the
+	// collection once it matches all of the collected digits (e.g.
+	// `\d{4}` or `1\d{10}|[2-9]\d{9}`)
+	Pattern string `json:"pattern,omitempty"`
+
+	// MaxDigits is the number of digits after which the collection
+	// completes.  If zero, the number of digits is not limited.
+	MaxDigits int `json:"max_digits,omitempty"`
+
+	// Terminator is the set of digits which complete the collection.  The
+	// terminating digit is not collected.
+	Terminator string `json:"terminator,omitempty"`
+
+	// ClearKey is the set of digits which discard the digits collected so
+	// far
+	ClearKey string `json:"clear_key,omitempty"`
+
+	// RetryKey is the set of digits which discard the digits collected so
+	// far and restart the collection, replaying the prompt and its timeouts
+	RetryKey string `json:"retry_key,omitempty"`
+
+	// Timeout is the maximum time to wait for the first digit, from the
+	// start (or retry) of the collection.  It defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// InterDigitTimeout is the maximum time to wait for each further digit.
+	// It defaults to 5 seconds.
+	InterDigitTimeout time.Duration `json:"inter_digit_timeout,omitempty"`
+}
+
+// Validate checks the options of the collection
+func (c *CollectDigits) Validate() error {
+	if c.Pattern != "" {
+		if _, err := regexp.Compile(c.Pattern); err != nil {
+			return eris.Wrap(err, "invalid digit pattern")
+		}
+	}
+	if c.MaxDigits < 0 || c.Timeout < 0 || c.InterDigitTimeout < 0 {
+		return eris.New("digit collection limits may not be negative")
+	}
+	return nil
+}
+
+// Reasons for the completion of a digit collection
+const (
+	CollectPattern      = "pattern"
+	CollectMaxDigits    = "max_digits"
+	CollectTerminator   = "terminator"
+	CollectTimeout      = "timeout"
+	CollectInterDigit   = "inter_digit_timeout"
+	CollectHangup       = "hangup"
+	CollectPromptFailed = "prompt_failed"
+)
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/rotisserie/eris"
+)
+
+// EncodingGzip identifies gzip-compressed responses
+const EncodingGzip = "gzip"
+
+// gzipMagic is the header of gzip streams, by which compressed responses are
+// distinguished from JSON responses
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// AcceptsEncoding indicates whether the request accepts responses with the
+// given encoding
+func (r *Request) AcceptsEncoding(encoding string) bool {
+	for _, e := range r.AcceptEncoding {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCompressed indicates whether the given message is gzip-compressed
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+// CompressResponse returns the gzip compression of the JSON-encoded response
+func CompressResponse(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, eris.Wrap(err, "failed to compress response")
+	}
+	if err := w.Close(); err != nil {
+		return nil, eris.Wrap(err, "failed to compress response")
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeResponse decodes a response, which may have been compressed, with the
+// codec which encoded it
+func DecodeResponse(data []byte) (*Response, error) {
+	if IsCompressed(data) {
+		var err error
+		if data, err = decompress(data); err != nil {
+			return nil, eris.Wrap(err, "failed to decompress response")
+		}
+	}
+
+	c, data, err := codecOf(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(Response)
+	if err := c.Decode(data, resp); err != nil {
+		return nil, eris.Wrap(err, "failed to decode response")
+	}
+	return resp, nil
+}
+
+// decompress returns the decompression of gzip-compressed data
+func decompress(data []byte) ([]byte, error) {
+	var err error
+	r, ok := gzipReaderPool.Get().(*gzip.Reader)
+	if ok {
+		err = r.Reset(bytes.NewReader(data))
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReaderPool.Put(r)
+
+	return ioutil.ReadAll(r)
+}
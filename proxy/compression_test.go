@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	resp := &Response{
+		Keys: []*ari.Key{ari.NewKey(ari.SoundKey, strings.Repeat("x", 100))},
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := CompressResponse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, in := range map[string][]byte{"plain": data, "gzip": compressed} {
+		out, err := DecodeResponse(in)
+		if err != nil {
+			t.Errorf("%s: failed to decode response: %v", name, err)
+			continue
+		}
+		if len(out.Keys) != 1 || out.Keys[0].ID != resp.Keys[0].ID {
+			t.Errorf("%s: unexpected response: %+v", name, out)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	req := &Request{AcceptEncoding: []string{EncodingGzip}}
+	if !req.AcceptsEncoding(EncodingGzip) {
+		t.Error("request should accept gzip")
+	}
+	if new(Request).AcceptsEncoding(EncodingGzip) {
+		t.Error("request should not accept gzip")
+	}
+}
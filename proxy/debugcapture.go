@@ -0,0 +1,67 @@
+package proxy
+
+import "time"
+
+// DebugCapture is the request for starting, stopping or retrieving the capture
+// of the HTTP exchanges of a proxy with Asterisk
+type DebugCapture struct {
+	// Kinds are the request kinds whose ARI exchanges are captured (for
+	// DebugCaptureStart) or no longer captured (for DebugCaptureStop)
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Dialogs are the dialogs whose requests have their ARI exchanges
+	// captured (for DebugCaptureStart) or no longer captured (for
+	// DebugCaptureStop)
+	Dialogs []string `json:"dialogs,omitempty"`
+
+	// Call is the ID of the entity (e.g. the channel) whose captured
+	// exchanges are retrieved (for DebugCaptureData)
+	Call string `json:"call,omitempty"`
+}
+
+// ARIExchange is an HTTP exchange of a proxy with Asterisk, captured in
+// debug mode.  The bodies are truncated to a maximum size.
+type ARIExchange struct {
+	// Time is the time at which the request was made
+	Time time.Time `json:"time"`
+
+	// Kind is the kind of the proxy request which made the exchange
+	Kind string `json:"kind"`
+
+	// Dialog is the dialog of the proxy request, if any
+	Dialog string `json:"dialog,omitempty"`
+
+	// Method and URL describe the HTTP request
+	Method string `json:"method"`
+	URL    string `json:"url"`
+
+	// RequestBody is the body of the HTTP request
+	RequestBody string `json:"request_body,omitempty"`
+
+	// Status is the HTTP status of the response, or zero if the request
+	// failed
+	Status int `json:"status,omitempty"`
+
+	// ResponseBody is the body of the HTTP response
+	ResponseBody string `json:"response_body,omitempty"`
+
+	// Duration is the time taken by the exchange
+	Duration time.Duration `json:"duration"`
+
+	// Error is the error of a failed request
+	Error string `json:"error,omitempty"`
+}
+
+// DebugCaptureData describes the debug capture of a proxy, as returned by a
+// DebugCaptureData request
+type DebugCaptureData struct {
+	// Kinds are the request kinds being captured
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Dialogs are the dialogs being captured
+	Dialogs []string `json:"dialogs,omitempty"`
+
+	// Exchanges are the exchanges captured for the requested call, oldest
+	// first
+	Exchanges []ARIExchange `json:"exchanges,omitempty"`
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import "errors"
+
+// Typed errors of requests which conflict with the state of their entities
+// in Asterisk (HTTP 409, 412 and 422 responses of ARI), typically because of
+// a race with another operation, such as a command on a channel which hung up.
+// Clients detect them with errors.Is.
+var (
+	// ErrChannelGone indicates that the channel of the request hung up or
+	// left the application
+	ErrChannelGone = errors.New("channel is gone")
+
+	// ErrInvalidState indicates that the entity of the request is not in a
+	// state which permits the operation (e.g. a channel which is not yet
+	// answered)
+	ErrInvalidState = errors.New("entity in invalid state")
+
+	// ErrConflict indicates that the operation conflicts with the state of
+	// the entity of the request (e.g. a bridge which is not in the
+	// application, or a channel which is being recorded)
+	ErrConflict = errors.New("conflict with entity state")
+)
+
+// ErrResponseTooLarge indicates that a response exceeded the maximum size of
+// a message, and the request did not accept chunked responses (see
+// EncodingChunked)
+var ErrResponseTooLarge = errors.New("response too large")
+
+// ErrDeadlineExceeded indicates that a request was not executed because its
+// deadline (see Request.Deadline) passed before the proxy could execute it
+var ErrDeadlineExceeded = errors.New("request deadline exceeded")
+
+// Error codes of the typed errors, carried by Response.ErrorCode
+const (
+	ErrorCodeChannelGone  = "channel_gone"
+	ErrorCodeInvalidState = "invalid_state"
+	ErrorCodeConflict     = "conflict"
+
+	ErrorCodeResponseTooLarge = "response_too_large"
+	ErrorCodeDeadlineExceeded = "deadline_exceeded"
+)
+
+var typedErrors = map[string]error{
+	ErrorCodeChannelGone:  ErrChannelGone,
+	ErrorCodeInvalidState: ErrInvalidState,
+	ErrorCodeConflict:     ErrConflict,
+
+	ErrorCodeResponseTooLarge: ErrResponseTooLarge,
+	ErrorCodeDeadlineExceeded: ErrDeadlineExceeded,
+}
+
+// ErrorCode returns the error code of the typed error which the given error
+// wraps, if any
+func ErrorCode(err error) string {
+	for code, typed := range typedErrors {
+		if errors.Is(err, typed) {
+			return code
+		}
+	}
+	return ""
+}
+
+// TypedError is an error received in a response, which wraps the typed error
+// of its error code
+type TypedError struct {
+	// Message is the error message of the response
+	Message string
+
+	// Code is the error code of the response
+	Code string
+}
+
+func (e *TypedError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the typed error of the error code
+func (e *TypedError) Unwrap() error {
+	return typedErrors[e.Code]
+}
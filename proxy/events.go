@@ -0,0 +1,1136 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// Proxy events are events which are generated by the ARI proxy itself rather
+// than by Asterisk.  They implement ari.Event and are published on the same
+// subjects (canonical and dialog) as the ARI events, so clients may subscribe
+// to them through the normal ari.Bus by their type names.
+
+var eventRegistry = struct {
+	types map[string]func() ari.Event
+	mu    sync.RWMutex
+}{
+	types: make(map[string]func() ari.Event),
+}
+
+// RegisterEvent registers a proxy event type, such that it may be decoded by
+// DecodeEvent.  The constructor must return a pointer to a new, empty event.
+func RegisterEvent(typ string, constructor func() ari.Event) {
+	eventRegistry.mu.Lock()
+	eventRegistry.types[typ] = constructor
+	eventRegistry.mu.Unlock()
+}
+
+// EventTypes returns the sorted type names of the registered proxy events
+func EventTypes() []string {
+	eventRegistry.mu.RLock()
+	defer eventRegistry.mu.RUnlock()
+
+	ret := make([]string, 0, len(eventRegistry.types))
+	for typ := range eventRegistry.types {
+		ret = append(ret, typ)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewEvent returns a new, empty proxy event of the given registered type
+func NewEvent(typ string) (ari.Event, bool) {
+	eventRegistry.mu.RLock()
+	constructor, ok := eventRegistry.types[typ]
+	eventRegistry.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return constructor(), true
+}
+
+// DecodeEvent converts an encoded event to an ari.Event, with the codec which
+// encoded it.  Both ARI events and registered proxy events are supported.
+func DecodeEvent(data []byte) (ari.Event, error) {
+	// Proxies may compress events which exceed the maximum NATS payload
+	if IsCompressed(data) {
+		var err error
+		if data, err = decompress(data); err != nil {
+			return nil, eris.Wrap(err, "failed to decompress event")
+		}
+	}
+
+	c, data, err := codecOf(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.DecodeEvent(data)
+}
+
+func decodeJSONEvent(data []byte) (ari.Event, error) {
+	typ, header, err := decodeEnvelope(data)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to decode type")
+	}
+
+	eventRegistry.mu.RLock()
+	constructor, ok := eventRegistry.types[typ]
+	eventRegistry.mu.RUnlock()
+
+	var e ari.Event
+	if ok {
+		e = constructor()
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, eris.Wrapf(err, "failed to decode %s event", typ)
+		}
+	} else if e, err = ari.DecodeEvent(data); err != nil {
+		return nil, err
+	}
+
+	if header != nil {
+		setEventHeader(e, header)
+	}
+	return e, nil
+}
+
+func init() {
+	RegisterEvent(EventRoutingDecision, func() ari.Event { return new(RoutingDecision) })
+	RegisterEvent(EventCallScreened, func() ari.Event { return new(CallScreened) })
+	RegisterEvent(EventRecordingConsent, func() ari.Event { return new(RecordingConsent) })
+	RegisterEvent(EventVoicemailFinished, func() ari.Event { return new(VoicemailFinished) })
+	RegisterEvent(EventFaxFinished, func() ari.Event { return new(FaxFinished) })
+	RegisterEvent(EventPageFinished, func() ari.Event { return new(PageFinished) })
+	RegisterEvent(EventCampaignFinished, func() ari.Event { return new(CampaignFinished) })
+	RegisterEvent(EventAMDFinished, func() ari.Event { return new(AMDFinished) })
+	RegisterEvent(EventSecureInputComplete, func() ari.Event { return new(SecureInputComplete) })
+	RegisterEvent(EventAudioForkStopped, func() ari.Event { return new(AudioForkStopped) })
+	RegisterEvent(EventHoldStateChanged, func() ari.Event { return new(HoldStateChanged) })
+	RegisterEvent(EventDeadAirDetected, func() ari.Event { return new(DeadAirDetected) })
+	RegisterEvent(EventEntityChanged, func() ari.Event { return new(EntityChanged) })
+	RegisterEvent(EventWatchExpired, func() ari.Event { return new(WatchExpired) })
+	RegisterEvent(EventDialResult, func() ari.Event { return new(DialResult) })
+	RegisterEvent(EventPlaylistItemStarted, func() ari.Event { return new(PlaylistItemStarted) })
+	RegisterEvent(EventRecordingStored, func() ari.Event { return new(RecordingStored) })
+	RegisterEvent(EventRecordingLimitReached, func() ari.Event { return new(RecordingLimitReached) })
+	RegisterEvent(EventHeartbeat, func() ari.Event { return new(Heartbeat) })
+	RegisterEvent(EventInstanceConflict, func() ari.Event { return new(InstanceConflict) })
+	RegisterEvent(EventChannelVariables, func() ari.Event { return new(ChannelVariables) })
+	RegisterEvent(EventOriginateBlocked, func() ari.Event { return new(OriginateBlocked) })
+	RegisterEvent(EventDigitsCollected, func() ari.Event { return new(DigitsCollected) })
+	RegisterEvent(EventBridgePartyJoined, func() ari.Event { return new(BridgePartyJoined) })
+	RegisterEvent(EventBridgePartyLeft, func() ari.Event { return new(BridgePartyLeft) })
+	RegisterEvent(EventDialogEventsDropped, func() ari.Event { return new(DialogEventsDropped) })
+}
+
+// EventRoutingDecision is the type name of the RoutingDecision event
+const EventRoutingDecision = "RoutingDecision"
+
+// Route describes a candidate route for an outbound call
+type Route struct {
+	// Endpoint is the Asterisk endpoint to which the call is sent
+	Endpoint string `json:"endpoint"`
+
+	// Trunk is the name of the trunk (carrier) used by the route
+	Trunk string `json:"trunk,omitempty"`
+
+	// Prefix is the destination prefix which selected the route
+	Prefix string `json:"prefix,omitempty"`
+
+	// Rate is the cost of the route, in the units of the rate table
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// RoutingDecision is a proxy event which is emitted for each attempt to route
+// an originate request, for billing and auditing purposes
+type RoutingDecision struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel being originated
+	ChannelID string `json:"channel_id"`
+
+	// Tenant is the tenant on whose behalf the channel was originated
+	Tenant string `json:"tenant,omitempty"`
+
+	// Destination is the dialed number which was routed
+	Destination string `json:"destination"`
+
+	// Route is the route which was attempted
+	Route Route `json:"route"`
+
+	// Attempt is the 1-based index of this attempt in the failover order
+	Attempt int `json:"attempt"`
+
+	// Error is the reason for failure, if the attempt failed
+	Error string `json:"error,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *RoutingDecision) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventCallScreened is the type name of the CallScreened event
+const EventCallScreened = "CallScreened"
+
+// CallScreened is a proxy event which is emitted immediately before the
+// StasisStart event of a call which matched a screening rule with the "tag"
+// action
+type CallScreened struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the screened channel
+	ChannelID string `json:"channel_id"`
+
+	// Caller is the caller ID number of the channel
+	Caller string `json:"caller,omitempty"`
+
+	// Callee is the dialed extension of the channel
+	Callee string `json:"callee,omitempty"`
+
+	// Rule is the name of the screening rule which matched
+	Rule string `json:"rule,omitempty"`
+
+	// Tag is the label assigned by the screening rule
+	Tag string `json:"tag,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *CallScreened) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventRecordingConsent is the type name of the RecordingConsent event
+const EventRecordingConsent = "RecordingConsent"
+
+// Consent statuses reported by the RecordingConsent event
+const (
+	// ConsentAccepted indicates that the caller pressed an accepting digit
+	ConsentAccepted = "accepted"
+
+	// ConsentImplied indicates that the announcement was played and no
+	// explicit acceptance was required
+	ConsentImplied = "implied"
+
+	// ConsentDeclined indicates that the caller pressed a declining digit
+	ConsentDeclined = "declined"
+
+	// ConsentTimeout indicates that no accepting digit was received in time
+	ConsentTimeout = "timeout"
+
+	// ConsentHangup indicates that the channel left the application before
+	// consent was obtained
+	ConsentHangup = "hangup"
+
+	// ConsentFailed indicates that the workflow failed (see Error)
+	ConsentFailed = "failed"
+)
+
+// RecordingConsent is a proxy event which reports the outcome of a
+// ChannelRecordConsent request.  The recording has been started if and only
+// if the Status is ConsentAccepted or ConsentImplied.
+type RecordingConsent struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel being recorded
+	ChannelID string `json:"channel_id"`
+
+	// RecordingName is the name of the live recording
+	RecordingName string `json:"recording_name"`
+
+	// Status is the consent status
+	Status string `json:"status"`
+
+	// Digit is the DTMF digit by which consent was accepted or declined
+	Digit string `json:"digit,omitempty"`
+
+	// Error is the reason for failure, if the workflow failed
+	Error string `json:"error,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *RecordingConsent) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	if e.RecordingName != "" {
+		sx = append(sx, e.Key(ari.LiveRecordingKey, e.RecordingName))
+	}
+	return
+}
+
+// EventVoicemailFinished is the type name of the VoicemailFinished event
+const EventVoicemailFinished = "VoicemailFinished"
+
+// VoicemailFinished is a proxy event which is emitted when a voicemail deposit
+// or retrieval session on a channel has ended
+type VoicemailFinished struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel of the session
+	ChannelID string `json:"channel_id"`
+
+	// Mailbox is the mailbox identifier
+	Mailbox string `json:"mailbox"`
+
+	// Operation is the type of session ("deposit" or "retrieve")
+	Operation string `json:"operation"`
+
+	// Message is the name of the stored recording of a deposited message
+	Message string `json:"message,omitempty"`
+
+	// Duration is the length of a deposited message, in seconds
+	Duration int `json:"duration,omitempty"`
+
+	// Played is the number of messages played by a retrieval session
+	Played int `json:"played,omitempty"`
+
+	// Deleted is the number of messages deleted by a retrieval session
+	Deleted int `json:"deleted,omitempty"`
+
+	// Error is the reason for failure, if the session failed
+	Error string `json:"error,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *VoicemailFinished) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	if e.Mailbox != "" {
+		sx = append(sx, e.Key(ari.MailboxKey, e.Mailbox))
+	}
+	return
+}
+
+// EventFaxFinished is the type name of the FaxFinished event
+const EventFaxFinished = "FaxFinished"
+
+// FaxFinished is a proxy event which reports the completion of a FaxSend or
+// FaxReceive request
+type FaxFinished struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel on which the fax was transferred
+	ChannelID string `json:"channel_id"`
+
+	// Operation is the fax operation ("send" or "receive")
+	Operation string `json:"operation"`
+
+	// File is the path of the fax file
+	File string `json:"file"`
+
+	// Status is the fax status reported by Asterisk ("SUCCESS" or "FAILED")
+	Status string `json:"status"`
+
+	// Pages is the number of pages transferred
+	Pages int `json:"pages"`
+
+	// Bitrate is the transfer rate of the fax, in bits per second
+	Bitrate int `json:"bitrate,omitempty"`
+
+	// RemoteStationID is the station identifier of the remote party
+	RemoteStationID string `json:"remote_station_id,omitempty"`
+
+	// Error is the failure reason reported by Asterisk, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *FaxFinished) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventPageFinished is the type name of the PageFinished event
+const EventPageFinished = "PageFinished"
+
+// PageFinished is a proxy event which is emitted when a page has been torn down
+type PageFinished struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the paging channel
+	ChannelID string `json:"channel_id"`
+
+	// BridgeID is the ID of the page bridge
+	BridgeID string `json:"bridge_id"`
+
+	// Paged is the number of endpoints which were successfully called
+	Paged int `json:"paged"`
+
+	// Answered is the number of endpoints which answered and joined the page
+	Answered int `json:"answered"`
+}
+
+// Keys implements ari.Event
+func (e *PageFinished) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	if e.BridgeID != "" {
+		sx = append(sx, e.Key(ari.BridgeKey, e.BridgeID))
+	}
+	return
+}
+
+// EventCampaignFinished is the type name of the CampaignFinished event
+const EventCampaignFinished = "CampaignFinished"
+
+// CampaignFinished is a proxy event which is emitted when a dialer campaign
+// has completed or been stopped, with its final statistics
+type CampaignFinished struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	CampaignStats `json:",inline"`
+}
+
+// Keys implements ari.Event
+func (e *CampaignFinished) Keys() (sx ari.Keys) {
+	if e.CampaignStats.ID != "" {
+		sx = append(sx, e.Key(CampaignKey, e.CampaignStats.ID))
+	}
+	return
+}
+
+// EventAMDFinished is the type name of the AMDFinished event
+const EventAMDFinished = "AMDFinished"
+
+// AMDFinished is a proxy event which reports the result of answering machine
+// detection on a channel
+type AMDFinished struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel which was classified
+	ChannelID string `json:"channel_id"`
+
+	AMDResult `json:",inline"`
+
+	// Error is the reason detection failed, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *AMDFinished) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventSecureInputComplete is the type name of the SecureInputComplete event
+const EventSecureInputComplete = "SecureInputComplete"
+
+// SecureInputComplete is a proxy event which is emitted when a secure input
+// capture has stopped capturing digits.  The digits themselves are only
+// returned by SecureInputStop.
+type SecureInputComplete struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel from which digits were captured
+	ChannelID string `json:"channel_id"`
+
+	// Reason is the reason the capture completed (terminator, max_digits,
+	// timeout, stopped, or hangup)
+	Reason string `json:"reason"`
+
+	// Digits is the number of digits captured
+	Digits int `json:"digits"`
+}
+
+// Keys implements ari.Event
+func (e *SecureInputComplete) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventAudioForkStopped is the type name of the AudioForkStopped event
+const EventAudioForkStopped = "AudioForkStopped"
+
+// AudioForkStopped is a proxy event which is emitted when an audio fork has
+// been torn down
+type AudioForkStopped struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ForkID is the ID of the audio fork
+	ForkID string `json:"fork_id"`
+
+	// ChannelID is the ID of the channel whose audio was streamed
+	ChannelID string `json:"channel_id"`
+}
+
+// Keys implements ari.Event
+func (e *AudioForkStopped) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	if e.ForkID != "" {
+		sx = append(sx, e.Key(AudioForkKey, e.ForkID))
+	}
+	return
+}
+
+// EventHoldStateChanged is the type name of the HoldStateChanged event
+const EventHoldStateChanged = "HoldStateChanged"
+
+// Hold states
+const (
+	HoldStateHeld    = "held"
+	HoldStateResumed = "resumed"
+
+	// HoldStateEnded indicates that the channel hung up while on hold
+	HoldStateEnded = "ended"
+)
+
+// HoldStateChanged is a proxy event which reports a change of the hold state
+// of a channel held by CallHold, with the hold metrics of the channel
+type HoldStateChanged struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the held channel
+	ChannelID string `json:"channel_id"`
+
+	// State is the new hold state (held, resumed, or ended)
+	State string `json:"state"`
+
+	// Reason is the cause of the change (request or hangup)
+	Reason string `json:"reason"`
+
+	// MOHClass is the music on hold class of the hold
+	MOHClass string `json:"moh_class"`
+
+	// DurationMs is the duration of the hold which has just ended, in
+	// milliseconds
+	DurationMs int64 `json:"duration_ms,omitempty"`
+
+	// HoldCount is the number of times the channel has been held
+	HoldCount int `json:"hold_count"`
+
+	// TotalDurationMs is the cumulative duration of the channel's completed
+	// holds, in milliseconds
+	TotalDurationMs int64 `json:"total_duration_ms"`
+}
+
+// Keys implements ari.Event
+func (e *HoldStateChanged) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventDeadAirDetected is the type name of the DeadAirDetected event
+const EventDeadAirDetected = "DeadAirDetected"
+
+// DeadAirDetected is a proxy event which is emitted when no party of a bridge
+// has talked for the configured duration.  It is emitted once per period of
+// silence.
+type DeadAirDetected struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// BridgeID is the ID of the silent bridge
+	BridgeID string `json:"bridge_id"`
+
+	// ChannelIDs is the list of the channels in the bridge
+	ChannelIDs []string `json:"channel_ids"`
+
+	// SilenceMs is the duration of the silence, in milliseconds
+	SilenceMs int64 `json:"silence_ms"`
+}
+
+// Keys implements ari.Event
+func (e *DeadAirDetected) Keys() (sx ari.Keys) {
+	if e.BridgeID != "" {
+		sx = append(sx, e.Key(ari.BridgeKey, e.BridgeID))
+	}
+	for _, id := range e.ChannelIDs {
+		sx = append(sx, e.Key(ari.ChannelKey, id))
+	}
+	return
+}
+
+// EventEntityChanged is the type name of the EntityChanged event
+const EventEntityChanged = "EntityChanged"
+
+// EntityChanged is a proxy event which reports a change of the data of a
+// watched channel or bridge (see Watch)
+type EntityChanged struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// WatchID is the ID of the watch
+	WatchID string `json:"watch_id"`
+
+	// Kind is the kind of the watched entity (channel or bridge)
+	Kind string `json:"kind"`
+
+	// EntityID is the ID of the watched entity
+	EntityID string `json:"entity_id"`
+
+	// Changes is the new value of each changed field of the entity data,
+	// indexed by the field's JSON name.  A field which is no longer set has a
+	// null value.
+	Changes map[string]json.RawMessage `json:"changes,omitempty"`
+
+	// Removed indicates that the entity has been destroyed, ending the watch
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *EntityChanged) Keys() (sx ari.Keys) {
+	if e.EntityID != "" {
+		sx = append(sx, e.Key(e.Kind, e.EntityID))
+	}
+	if e.WatchID != "" {
+		sx = append(sx, e.Key(WatchKey, e.WatchID))
+	}
+	return
+}
+
+// EventWatchExpired is the type name of the WatchExpired event
+const EventWatchExpired = "WatchExpired"
+
+// WatchExpired is a proxy event which is emitted when a watch expires without
+// being renewed
+type WatchExpired struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// WatchID is the ID of the watch
+	WatchID string `json:"watch_id"`
+
+	// Kind is the kind of the watched entity (channel or bridge)
+	Kind string `json:"kind"`
+
+	// EntityID is the ID of the watched entity
+	EntityID string `json:"entity_id"`
+}
+
+// Keys implements ari.Event
+func (e *WatchExpired) Keys() (sx ari.Keys) {
+	if e.EntityID != "" {
+		sx = append(sx, e.Key(e.Kind, e.EntityID))
+	}
+	if e.WatchID != "" {
+		sx = append(sx, e.Key(WatchKey, e.WatchID))
+	}
+	return
+}
+
+// EventDialResult is the type name of the DialResult event
+const EventDialResult = "DialResult"
+
+// DialResult is a proxy event which reports the final outcome of a ChannelDial
+// request, correlated from the Dial, state change, and hangup events of the
+// dialed channel.  It is emitted once per dial, when the channel is answered
+// or destroyed.
+type DialResult struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the dialed channel
+	ChannelID string `json:"channel_id"`
+
+	// Caller is the ID of the calling channel, if one was given
+	Caller string `json:"caller,omitempty"`
+
+	// Result is the outcome of the dial (answer, busy, noanswer, congestion,
+	// chanunavail, cancel, or failed)
+	Result string `json:"result"`
+
+	// DialStatus is the last dial status reported by Asterisk, if any
+	DialStatus string `json:"dial_status,omitempty"`
+
+	// Cause is the Q.850 hangup cause of the dialed channel, if it was not
+	// answered
+	Cause int `json:"cause,omitempty"`
+
+	// CauseText is the text representation of Cause
+	CauseText string `json:"cause_text,omitempty"`
+
+	// Duration is the time between the dial request and its outcome
+	Duration time.Duration `json:"duration"`
+}
+
+// Keys implements ari.Event
+func (e *DialResult) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	if e.Caller != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.Caller))
+	}
+	return
+}
+
+// EventPlaylistItemStarted is the type name of the PlaylistItemStarted event
+const EventPlaylistItemStarted = "PlaylistItemStarted"
+
+// PlaylistItemStarted is a proxy event which reports the progress of a
+// playback of multiple media URIs.  It follows the PlaybackStarted or
+// PlaybackContinuing event of each item of the playlist.
+type PlaylistItemStarted struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// PlaybackID is the ID of the playback
+	PlaybackID string `json:"playback_id"`
+
+	// TargetURI is the channel or bridge on which the media is played (e.g.
+	// "channel:1234")
+	TargetURI string `json:"target_uri,omitempty"`
+
+	// Index is the (zero-based) position of the item in the playlist
+	Index int `json:"index"`
+
+	// Count is the number of items in the playlist
+	Count int `json:"count"`
+
+	// MediaURI is the URI of the item being played
+	MediaURI string `json:"media_uri"`
+}
+
+// Keys implements ari.Event
+func (e *PlaylistItemStarted) Keys() (sx ari.Keys) {
+	if e.PlaybackID != "" {
+		sx = append(sx, e.Key(ari.PlaybackKey, e.PlaybackID))
+	}
+	if k := TargetKey(e.EventData, e.TargetURI); k != nil {
+		sx = append(sx, k)
+	}
+	return
+}
+
+// TargetKey returns the key of the channel or bridge of the given target URI
+// (e.g. "channel:1234"), or nil if it has none
+func TargetKey(e ari.EventData, uri string) *ari.Key {
+	if i := strings.Index(uri, ":"); i > 0 {
+		switch kind := uri[:i]; kind {
+		case ari.ChannelKey, ari.BridgeKey:
+			return e.Key(kind, uri[i+1:])
+		}
+	}
+	return nil
+}
+
+// EventRecordingStored is the type name of the RecordingStored event
+const EventRecordingStored = "RecordingStored"
+
+// RecordingStored is a proxy event which links a finished live recording to
+// the stored recording which it produced.  It follows the RecordingFinished
+// event.
+type RecordingStored struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// Name is the name of the live recording, which is also the ID of the
+	// stored recording
+	Name string `json:"name"`
+
+	// StoredRecording is the key of the stored recording
+	StoredRecording *ari.Key `json:"stored_recording"`
+
+	// Format is the file format of the recording
+	Format string `json:"format"`
+
+	// Duration is the length of the recording
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// TargetURI is the channel or bridge which was recorded (e.g.
+	// "channel:1234")
+	TargetURI string `json:"target_uri,omitempty"`
+
+	// ArchiveURL is the URL of the recording in the archive to which
+	// recordings are offloaded, if one is configured
+	ArchiveURL string `json:"archive_url,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *RecordingStored) Keys() (sx ari.Keys) {
+	if e.Name != "" {
+		sx = append(sx, e.Key(ari.LiveRecordingKey, e.Name), e.Key(ari.StoredRecordingKey, e.Name))
+	}
+	if k := TargetKey(e.EventData, e.TargetURI); k != nil {
+		sx = append(sx, k)
+	}
+	return
+}
+
+// EventRecordingLimitReached is the type name of the RecordingLimitReached
+// event
+const EventRecordingLimitReached = "RecordingLimitReached"
+
+// Recording limits, as reported by the RecordingLimitReached event
+const (
+	RecordingLimitMaxDuration = "max_duration"
+)
+
+// Enforcers of recording limits, as reported by the RecordingLimitReached
+// event
+const (
+	EnforcedByAsterisk = "asterisk"
+	EnforcedByProxy    = "proxy"
+)
+
+// RecordingLimitReached is a proxy event which reports that a live recording
+// was stopped for reaching its maximum duration, either by Asterisk or, if
+// Asterisk failed to enforce the limit, by the proxy
+type RecordingLimitReached struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// Name is the name of the live recording
+	Name string `json:"name"`
+
+	// TargetURI is the channel or bridge which was recorded (e.g.
+	// "channel:1234"), if known
+	TargetURI string `json:"target_uri,omitempty"`
+
+	// Limit is the limit which was reached (max_duration)
+	Limit string `json:"limit"`
+
+	// Value is the value of the limit
+	Value time.Duration `json:"value"`
+
+	// EnforcedBy indicates whether Asterisk or the proxy stopped the
+	// recording
+	EnforcedBy string `json:"enforced_by"`
+}
+
+// Keys implements ari.Event
+func (e *RecordingLimitReached) Keys() (sx ari.Keys) {
+	if e.Name != "" {
+		sx = append(sx, e.Key(ari.LiveRecordingKey, e.Name))
+	}
+	if k := TargetKey(e.EventData, e.TargetURI); k != nil {
+		sx = append(sx, k)
+	}
+	return
+}
+
+// HeartbeatInterval is the interval between the Heartbeat events of a proxy
+var HeartbeatInterval = 15 * time.Second
+
+// EventHeartbeat is the type name of the Heartbeat event
+const EventHeartbeat = "Heartbeat"
+
+// Heartbeat is a proxy event which each proxy emits every HeartbeatInterval,
+// by which clients may detect that a node has gone down
+type Heartbeat struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// StartedAt is the time at which the proxy started listening
+	StartedAt time.Time `json:"started_at"`
+
+	// Uptime is the time for which the proxy has been listening
+	Uptime time.Duration `json:"uptime"`
+
+	// LastARIContact is the time at which the proxy last received an event
+	// or response from Asterisk
+	LastARIContact time.Time `json:"last_ari_contact"`
+
+	// Draining indicates that the proxy is rejecting new create requests
+	Draining bool `json:"draining,omitempty"`
+
+	// PermissionViolations is the number of NATS permissions violations
+	// reported on the proxy's connection since it started
+	PermissionViolations int64 `json:"permission_violations,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *Heartbeat) Keys() (sx ari.Keys) {
+	return
+}
+
+// EventInstanceConflict is the type name of the InstanceConflict event
+const EventInstanceConflict = "InstanceConflict"
+
+// InstanceConflict is a proxy event which a proxy emits when another proxy
+// instance announces itself, under the same prefix, as serving the same
+// application and node.  The clients of such a cluster receive every event
+// twice and may have their requests handled by either proxy, so this usually
+// indicates a misconfigured duplicate deployment.
+type InstanceConflict struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// Instance is the instance ID of the proxy which emitted the event
+	Instance string `json:"instance"`
+
+	// ConflictingInstance is the instance ID of the other proxy
+	ConflictingInstance string `json:"conflicting_instance"`
+
+	// ConflictingVersion is the version of the other proxy, if it announced
+	// one
+	ConflictingVersion string `json:"conflicting_version,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *InstanceConflict) Keys() (sx ari.Keys) {
+	return
+}
+
+// EventChannelVariables is the type name of the ChannelVariables event
+const EventChannelVariables = "ChannelVariables"
+
+// ChannelVariables is a proxy event which follows the StasisStart event of a
+// call entering the application, reporting the channel variables which the
+// proxy is configured to read at call start
+type ChannelVariables struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel
+	ChannelID string `json:"channel_id"`
+
+	// Variables maps the names of the variables to their values
+	Variables map[string]string `json:"variables"`
+
+	// Missing lists the variables which could not be read (e.g. because the
+	// channel hung up)
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Keys implements ari.Event
+func (e *ChannelVariables) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventOriginateBlocked is the type name of the OriginateBlocked event
+const EventOriginateBlocked = "OriginateBlocked"
+
+// OriginateBlocked is a proxy event which records, for auditing purposes, an
+// outbound channel whose creation was blocked by an originate policy
+type OriginateBlocked struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel which was not created
+	ChannelID string `json:"channel_id"`
+
+	// Tenant is the tenant (account) on whose behalf the channel was
+	// requested
+	Tenant string `json:"tenant,omitempty"`
+
+	// Destination is the dialed number
+	Destination string `json:"destination"`
+
+	// Policy is the name of the policy which blocked the channel
+	Policy string `json:"policy,omitempty"`
+
+	// Reason describes why the channel was blocked
+	Reason string `json:"reason"`
+}
+
+// Keys implements ari.Event
+func (e *OriginateBlocked) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// EventDigitsCollected is the type name of the DigitsCollected event
+const EventDigitsCollected = "DigitsCollected"
+
+// DigitsCollected is a proxy event which reports the result of a
+// CollectDigits request
+type DigitsCollected struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// ChannelID is the ID of the channel from which digits were collected
+	ChannelID string `json:"channel_id"`
+
+	// Digits is the collected digit string
+	Digits string `json:"digits"`
+
+	// Reason is the reason the collection completed (see CollectPattern,
+	// etc.)
+	Reason string `json:"reason"`
+}
+
+// Keys implements ari.Event
+func (e *DigitsCollected) Keys() (sx ari.Keys) {
+	if e.ChannelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, e.ChannelID))
+	}
+	return
+}
+
+// BridgeParty describes a channel in a bridge
+type BridgeParty struct {
+	// ChannelID is the ID of the channel
+	ChannelID string `json:"channel_id"`
+
+	// Name is the name of the channel (e.g. "PJSIP/100-00000001")
+	Name string `json:"name,omitempty"`
+
+	// CallerNumber is the caller ID number of the channel
+	CallerNumber string `json:"caller_number,omitempty"`
+
+	// CallerName is the caller ID name of the channel
+	CallerName string `json:"caller_name,omitempty"`
+}
+
+// EventBridgePartyJoined is the type name of the BridgePartyJoined event
+const EventBridgePartyJoined = "BridgePartyJoined"
+
+// BridgePartyJoined is a proxy event which reports that a channel entered a
+// bridge, along with the complete list of the parties of the bridge.  It
+// follows the ChannelEnteredBridge event from which it is derived.
+type BridgePartyJoined struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// BridgeID is the ID of the bridge
+	BridgeID string `json:"bridge_id"`
+
+	// Party is the channel which entered the bridge
+	Party BridgeParty `json:"party"`
+
+	// Participants is the list of the parties of the bridge, including Party
+	Participants []BridgeParty `json:"participants"`
+}
+
+// Keys implements ari.Event
+func (e *BridgePartyJoined) Keys() ari.Keys {
+	return bridgePartyKeys(e.EventData, e.BridgeID, e.Party.ChannelID)
+}
+
+// EventBridgePartyLeft is the type name of the BridgePartyLeft event
+const EventBridgePartyLeft = "BridgePartyLeft"
+
+// BridgePartyLeft is a proxy event which reports that a channel left a bridge,
+// along with the complete list of the remaining parties of the bridge.  It
+// follows the ChannelLeftBridge event from which it is derived.
+type BridgePartyLeft struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// BridgeID is the ID of the bridge
+	BridgeID string `json:"bridge_id"`
+
+	// Party is the channel which left the bridge
+	Party BridgeParty `json:"party"`
+
+	// Participants is the list of the remaining parties of the bridge
+	Participants []BridgeParty `json:"participants"`
+}
+
+// Keys implements ari.Event
+func (e *BridgePartyLeft) Keys() ari.Keys {
+	return bridgePartyKeys(e.EventData, e.BridgeID, e.Party.ChannelID)
+}
+
+func bridgePartyKeys(e ari.EventData, bridgeID, channelID string) (sx ari.Keys) {
+	if bridgeID != "" {
+		sx = append(sx, e.Key(ari.BridgeKey, bridgeID))
+	}
+	if channelID != "" {
+		sx = append(sx, e.Key(ari.ChannelKey, channelID))
+	}
+	return
+}
+
+// EventDialogEventsDropped is the type name of the DialogEventsDropped event
+const EventDialogEventsDropped = "DialogEventsDropped"
+
+// DialogEventsDropped is a proxy event which is published to a dialog after
+// events of the dialog were dropped by the dialog event limit of the proxy,
+// summarizing the events dropped since the previous summary
+type DialogEventsDropped struct {
+	ari.EventData `json:",inline"`
+
+	// Header describes any transport-related metadata
+	Header ari.Header `json:"-"`
+
+	// Dropped maps the types of the dropped events to their number
+	Dropped map[string]uint64 `json:"dropped"`
+}
+
+// Keys implements ari.Event
+func (e *DialogEventsDropped) Keys() (sx ari.Keys) {
+	return
+}
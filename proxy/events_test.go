@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	data, err := json.Marshal(&RoutingDecision{
+		EventData: ari.EventData{
+			Type:        EventRoutingDecision,
+			Application: "app",
+			Node:        "node",
+		},
+		ChannelID: "c1",
+		Attempt:   1,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode event: %s", err)
+	}
+
+	e, err := DecodeEvent(data)
+	if err != nil {
+		t.Fatalf("failed to decode event: %s", err)
+	}
+	rd, ok := e.(*RoutingDecision)
+	if !ok {
+		t.Fatalf("incorrect event type %T", e)
+	}
+	if rd.ChannelID != "c1" || rd.GetApplication() != "app" {
+		t.Errorf("incorrect event data: %v", rd)
+	}
+	if keys := rd.Keys(); len(keys) != 1 || keys[0].ID != "c1" || keys[0].Node != "node" {
+		t.Errorf("incorrect event keys: %v", keys)
+	}
+
+	e, err = DecodeEvent([]byte(`{"type":"StasisEnd","channel":{"id":"c2"}}`))
+	if err != nil {
+		t.Fatalf("failed to decode ARI event: %s", err)
+	}
+	if _, ok := e.(*ari.StasisEnd); !ok {
+		t.Errorf("incorrect event type %T", e)
+	}
+
+	compressed, err := CompressResponse([]byte(`{"type":"StasisEnd","channel":{"id":"c3"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err = DecodeEvent(compressed)
+	if err != nil {
+		t.Fatalf("failed to decode compressed event: %s", err)
+	}
+	if v, ok := e.(*ari.StasisEnd); !ok || v.Channel.ID != "c3" {
+		t.Errorf("incorrect compressed event %+v", e)
+	}
+
+	if _, err = DecodeEvent([]byte(`{"type":"NoSuchEvent"}`)); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// SelectChannelFields returns a copy of the channel data containing only the
+// given fields, named by their JSON names (e.g. "state", "caller").  The key
+// and ID are always included.  If no fields are given, the data is returned
+// unchanged.
+func SelectChannelFields(d *ari.ChannelData, fields []string) (*ari.ChannelData, error) {
+	if d == nil || len(fields) == 0 {
+		return d, nil
+	}
+
+	ret := &ari.ChannelData{
+		Key: d.Key,
+		ID:  d.ID,
+	}
+	for _, f := range fields {
+		switch f {
+		case "key", "id":
+		case "name":
+			ret.Name = d.Name
+		case "state":
+			ret.State = d.State
+		case "accountcode":
+			ret.Accountcode = d.Accountcode
+		case "caller":
+			ret.Caller = d.Caller
+		case "connected":
+			ret.Connected = d.Connected
+		case "creationtime":
+			ret.Creationtime = d.Creationtime
+		case "dialplan":
+			ret.Dialplan = d.Dialplan
+		case "language":
+			ret.Language = d.Language
+		case "channelvars":
+			ret.ChannelVars = d.ChannelVars
+		default:
+			return nil, eris.Errorf("unknown channel field %q", f)
+		}
+	}
+	return ret, nil
+}
+
+// SelectBridgeFields returns a copy of the bridge data containing only the
+// given fields, named by their JSON names (e.g. "channels", "bridge_type").
+// The key and ID are always included.  If no fields are given, the data is
+// returned unchanged.
+func SelectBridgeFields(d *ari.BridgeData, fields []string) (*ari.BridgeData, error) {
+	if d == nil || len(fields) == 0 {
+		return d, nil
+	}
+
+	ret := &ari.BridgeData{
+		Key: d.Key,
+		ID:  d.ID,
+	}
+	for _, f := range fields {
+		switch f {
+		case "key", "id":
+		case "bridge_class":
+			ret.Class = d.Class
+		case "bridge_type":
+			ret.Type = d.Type
+		case "channels":
+			ret.ChannelIDs = d.ChannelIDs
+		case "creator":
+			ret.Creator = d.Creator
+		case "name":
+			ret.Name = d.Name
+		case "technology":
+			ret.Technology = d.Technology
+		default:
+			return nil, eris.Errorf("unknown bridge field %q", f)
+		}
+	}
+	return ret, nil
+}
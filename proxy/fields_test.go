@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestSelectChannelFields(t *testing.T) {
+	d := &ari.ChannelData{
+		ID:       "c1",
+		Name:     "PJSIP/100-0001",
+		State:    "Up",
+		Language: "en",
+		Caller:   &ari.CallerID{Number: "100"},
+	}
+
+	ret, err := SelectChannelFields(d, []string{"state", "caller"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.ID != "c1" || ret.State != "Up" || ret.Caller == nil || ret.Caller.Number != "100" {
+		t.Errorf("selected fields missing: %+v", ret)
+	}
+	if ret.Name != "" || ret.Language != "" {
+		t.Errorf("unselected fields present: %+v", ret)
+	}
+
+	if ret, _ = SelectChannelFields(d, nil); ret != d {
+		t.Error("data should be unchanged without a field mask")
+	}
+
+	if _, err = SelectChannelFields(d, []string{"bogus"}); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestSelectBridgeFields(t *testing.T) {
+	d := &ari.BridgeData{
+		ID:         "b1",
+		Type:       "mixing",
+		ChannelIDs: []string{"c1", "c2"},
+		Name:       "conf",
+	}
+
+	ret, err := SelectBridgeFields(d, []string{"channels"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.ID != "b1" || len(ret.ChannelIDs) != 2 || ret.Type != "" || ret.Name != "" {
+		t.Errorf("unexpected selection: %+v", ret)
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/rotisserie/eris"
+)
+
+// fileChunkMarker is the first byte of the chunks of a file transfer (see
+// RecordingStoredFile).  It is followed by a flags byte, the sequence number
+// of the chunk (as a uvarint), the CRC-32 (IEEE) checksum of the data of the
+// chunk (big-endian), and the data.  Neither JSON encodings, codec-encoded
+// messages, compressed responses nor response chunks start with it.
+const fileChunkMarker = 0x03
+
+// fileChunkLast flags the last chunk of a file transfer
+const fileChunkLast = 0x01
+
+// FileChunkHeaderSize is the maximum size of the header of a file chunk
+const FileChunkHeaderSize = 2 + binary.MaxVarintLen64 + 4
+
+// ErrFileChunkChecksum indicates that the data of a file chunk does not match
+// its checksum
+var ErrFileChunkChecksum = eris.New("file chunk checksum mismatch")
+
+// FileChunk is a chunk of a file transferred over NATS, in a sequence of
+// messages published to the reply subject of the request
+type FileChunk struct {
+	// Seq is the sequence number of the chunk, starting from zero
+	Seq uint64
+
+	// Data is the data of the chunk
+	Data []byte
+
+	// Last indicates that the chunk is the last of the file
+	Last bool
+}
+
+// Encode returns the message of the chunk
+func (c *FileChunk) Encode() []byte {
+	buf := make([]byte, 0, FileChunkHeaderSize+len(c.Data))
+	buf = append(buf, fileChunkMarker, 0)
+	if c.Last {
+		buf[1] = fileChunkLast
+	}
+
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, n[:binary.PutUvarint(n[:], c.Seq)]...)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(c.Data))
+	buf = append(buf, sum[:]...)
+
+	return append(buf, c.Data...)
+}
+
+// IsFileChunk indicates whether the given message is a file chunk, as
+// opposed to a Response (reporting the failure of the transfer)
+func IsFileChunk(data []byte) bool {
+	return len(data) > 0 && data[0] == fileChunkMarker
+}
+
+// DecodeFileChunk decodes a file chunk, verifying its checksum.  The data of
+// the chunk refers to the given message.
+func DecodeFileChunk(data []byte) (*FileChunk, error) {
+	if !IsFileChunk(data) || len(data) < 2 {
+		return nil, eris.New("not a file chunk")
+	}
+	c := &FileChunk{Last: data[1]&fileChunkLast != 0}
+
+	seq, n := binary.Uvarint(data[2:])
+	if n <= 0 {
+		return nil, eris.New("invalid file chunk sequence number")
+	}
+	c.Seq = seq
+
+	data = data[2+n:]
+	if len(data) < 4 {
+		return nil, eris.New("truncated file chunk header")
+	}
+	c.Data = data[4:]
+	if crc32.ChecksumIEEE(c.Data) != binary.BigEndian.Uint32(data[:4]) {
+		return nil, eris.Wrapf(ErrFileChunkChecksum, "chunk %d", seq)
+	}
+	return c, nil
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rotisserie/eris"
+)
+
+func TestFileChunk(t *testing.T) {
+	c := &FileChunk{Seq: 300, Data: []byte("RIFF...WAVE"), Last: true}
+	data := c.Encode()
+	if !IsFileChunk(data) || IsFileChunk([]byte(`{"error":""}`)) || IsChunk(data) {
+		t.Error("file chunk not identified")
+	}
+
+	d, err := DecodeFileChunk(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Seq != 300 || !d.Last || !bytes.Equal(d.Data, c.Data) {
+		t.Errorf("unexpected chunk %+v", d)
+	}
+
+	// Corrupted data fails the checksum
+	data[len(data)-1] ^= 0xff
+	if _, err = DecodeFileChunk(data); !eris.Is(err, ErrFileChunkChecksum) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err = DecodeFileChunk(data[:3]); err == nil {
+		t.Error("truncated chunk decoded")
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import "github.com/CyCoreSystems/ari/v5"
+
+// Channel variables by which the proxy attaches the geography of the caller
+// number to the channel of a StasisStart event
+const (
+	// CallerCountryVar holds the ISO 3166-1 alpha-2 code of the country of
+	// the caller number
+	CallerCountryVar = "ARI_PROXY_CALLER_COUNTRY"
+
+	// CallerCallingCodeVar holds the country calling code of the caller
+	// number
+	CallerCallingCodeVar = "ARI_PROXY_CALLER_CALLING_CODE"
+
+	// CallerRegionVar holds the region of the caller number within its
+	// country, if known
+	CallerRegionVar = "ARI_PROXY_CALLER_REGION"
+)
+
+// NumberGeography describes where a telephone number is allocated
+type NumberGeography struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country (e.g. "US").
+	// Numbers of non-geographic services have the code "001".
+	Country string `json:"country"`
+
+	// CallingCode is the country calling code (e.g. "1")
+	CallingCode string `json:"calling_code"`
+
+	// Region is the region within the country (e.g. "CA" for California),
+	// if known
+	Region string `json:"region,omitempty"`
+}
+
+// GetNumberGeography returns the geography of the caller number which the
+// proxy attached to the given channel, or nil if none was attached
+func GetNumberGeography(ch *ari.ChannelData) *NumberGeography {
+	if ch == nil || ch.ChannelVars == nil {
+		return nil
+	}
+
+	country, ok := ch.ChannelVars[CallerCountryVar]
+	if !ok {
+		return nil
+	}
+	return &NumberGeography{
+		Country:     country,
+		CallingCode: ch.ChannelVars[CallerCallingCodeVar],
+		Region:      ch.ChannelVars[CallerRegionVar],
+	}
+}
+
+// SetNumberGeography attaches the given geography of the caller number to the
+// channel
+func SetNumberGeography(ch *ari.ChannelData, g *NumberGeography) {
+	if ch == nil || g == nil {
+		return
+	}
+	if ch.ChannelVars == nil {
+		ch.ChannelVars = make(map[string]string)
+	}
+
+	ch.ChannelVars[CallerCountryVar] = g.Country
+	ch.ChannelVars[CallerCallingCodeVar] = g.CallingCode
+	if g.Region != "" {
+		ch.ChannelVars[CallerRegionVar] = g.Region
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// The keys of the headers which the proxy sets on the events which it
+// publishes.  The header of an event travels in the "header" member of the
+// JSON encoding of the event and is decoded into the Header field of the
+// event, from which it may be read with GetEventHeader.
+const (
+	// HeaderApplication is the ARI application which received the event
+	HeaderApplication = "application"
+
+	// HeaderAsterisk is the ID of the Asterisk node which emitted the event
+	HeaderAsterisk = "asterisk"
+
+	// HeaderInstance is the instance ID of the proxy which published the
+	// event
+	HeaderInstance = "instance"
+
+	// HeaderDialog is the dialog to which the event was published, if any
+	HeaderDialog = "dialog"
+
+	// HeaderSequence is the sequence number of the event among the events
+	// published by the proxy, which increases by one with each event
+	HeaderSequence = "sequence"
+
+	// HeaderTenant is the tenant on whose behalf the event's entity was
+	// created, where it is known
+	HeaderTenant = "tenant"
+
+	// HeaderVersion is the version of the proxy which published the event
+	HeaderVersion = "version"
+)
+
+// EventHeader provides typed access to the header of an event
+type EventHeader ari.Header
+
+// Application returns the ARI application which received the event
+func (h EventHeader) Application() string {
+	return ari.Header(h).Get(HeaderApplication)
+}
+
+// Asterisk returns the ID of the Asterisk node which emitted the event
+func (h EventHeader) Asterisk() string {
+	return ari.Header(h).Get(HeaderAsterisk)
+}
+
+// Dialog returns the dialog to which the event was published, if any
+func (h EventHeader) Dialog() string {
+	return ari.Header(h).Get(HeaderDialog)
+}
+
+// Instance returns the instance ID of the proxy which published the event
+func (h EventHeader) Instance() string {
+	return ari.Header(h).Get(HeaderInstance)
+}
+
+// Sequence returns the sequence number of the event, and whether it has one
+func (h EventHeader) Sequence() (uint64, bool) {
+	n, err := strconv.ParseUint(ari.Header(h).Get(HeaderSequence), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Tenant returns the tenant of the event, if it is known
+func (h EventHeader) Tenant() string {
+	return ari.Header(h).Get(HeaderTenant)
+}
+
+// Version returns the version of the proxy which published the event
+func (h EventHeader) Version() string {
+	return ari.Header(h).Get(HeaderVersion)
+}
+
+// SetSequence sets the sequence number of the event
+func (h EventHeader) SetSequence(n uint64) {
+	ari.Header(h).Set(HeaderSequence, strconv.FormatUint(n, 10))
+}
+
+// GetEventHeader returns the header of the given event, which is empty if the
+// event has none
+func GetEventHeader(e ari.Event) EventHeader {
+	if f, ok := headerField(e); ok {
+		return EventHeader(f.Interface().(ari.Header))
+	}
+	return nil
+}
+
+// setEventHeader sets the header of the given event, if it has a Header field
+func setEventHeader(e ari.Event, h ari.Header) {
+	if f, ok := headerField(e); ok {
+		f.Set(reflect.ValueOf(h))
+	}
+}
+
+// headerFields caches the index of the Header field of each event type, or
+// -1 if the type has none
+var headerFields sync.Map
+
+var headerType = reflect.TypeOf(ari.Header(nil))
+
+// headerField returns the Header field of the given event.  Both ARI events
+// and proxy events are structs with a Header field of type ari.Header.
+func headerField(e ari.Event) (reflect.Value, bool) {
+	v := reflect.ValueOf(e)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	v = v.Elem()
+
+	index := -1
+	if i, ok := headerFields.Load(v.Type()); ok {
+		index = i.(int)
+	} else {
+		if f, ok := v.Type().FieldByName("Header"); ok && f.Type == headerType && len(f.Index) == 1 {
+			index = f.Index[0]
+		}
+		headerFields.Store(v.Type(), index)
+	}
+	if index < 0 {
+		return reflect.Value{}, false
+	}
+	return v.Field(index), true
+}
+
+// EncodeEvent encodes the given event as JSON, including the given header,
+// and passes the encoding to fn, under the same terms as EncodeJSON.  The
+// header is encoded separately, so the event need not be modified to publish
+// it with different headers (e.g. for each of its dialogs).
+func EncodeEvent(e ari.Event, h ari.Header, fn func(data []byte) error) error {
+	return encodeJSONEvent(e, h, fn)
+}
+
+func encodeJSONEvent(e ari.Event, h ari.Header, fn func(data []byte) error) error {
+	if len(h) == 0 {
+		return EncodeJSON(e, fn)
+	}
+
+	hdr, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return EncodeJSON(e, func(data []byte) error {
+		if len(data) < 2 || data[len(data)-1] != '}' {
+			return fn(data)
+		}
+
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		buf.Write(data[:len(data)-1])
+		if len(data) > 2 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"header":`)
+		buf.Write(hdr)
+		buf.WriteByte('}')
+		return fn(buf.Bytes())
+	})
+}
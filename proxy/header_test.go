@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestEventHeaderRoundTrip(t *testing.T) {
+	h := ari.Header{}
+	h.Set(HeaderApplication, "app")
+	h.Set(HeaderAsterisk, "node")
+	h.Set(HeaderDialog, "d1")
+	h.Set(HeaderInstance, "in1")
+	h.Set(HeaderTenant, "acme")
+	h.Set(HeaderVersion, "v5.3.0")
+	EventHeader(h).SetSequence(42)
+
+	for _, e := range []ari.Event{
+		&ari.ChannelStateChange{
+			EventData: ari.EventData{Type: "ChannelStateChange"},
+			Channel:   ari.ChannelData{ID: "c1"},
+		},
+		&HoldStateChanged{
+			EventData: ari.EventData{Type: EventHoldStateChanged},
+			ChannelID: "c1",
+		},
+	} {
+		var data []byte
+		err := EncodeEvent(e, h, func(b []byte) error {
+			data = append([]byte(nil), b...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(data) {
+			t.Fatalf("invalid encoding %s", data)
+		}
+
+		// Encoding the header does not modify the event
+		if len(GetEventHeader(e)) != 0 {
+			t.Errorf("%s: header set on encoded event", e.GetType())
+		}
+
+		decoded, err := DecodeEvent(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.GetType() != e.GetType() {
+			t.Errorf("decoded type %s != %s", decoded.GetType(), e.GetType())
+		}
+
+		dh := GetEventHeader(decoded)
+		if dh.Application() != "app" || dh.Asterisk() != "node" || dh.Dialog() != "d1" || dh.Instance() != "in1" ||
+			dh.Tenant() != "acme" || dh.Version() != "v5.3.0" {
+			t.Errorf("%s: unexpected header %v", e.GetType(), dh)
+		}
+		if seq, ok := dh.Sequence(); !ok || seq != 42 {
+			t.Errorf("%s: sequence %d (%v) != 42", e.GetType(), seq, ok)
+		}
+	}
+}
+
+func TestEventHeaderMissing(t *testing.T) {
+	data, err := json.Marshal(&ari.ChannelStateChange{
+		EventData: ari.EventData{Type: "ChannelStateChange"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := DecodeEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := GetEventHeader(e)
+	if h.Application() != "" {
+		t.Errorf("unexpected application %q", h.Application())
+	}
+	if _, ok := h.Sequence(); ok {
+		t.Error("unexpected sequence")
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+// LocalChannelPair describes the two halves of a Local channel and the
+// channel behind it, as returned by a ChannelLocalPair request
+type LocalChannelPair struct {
+	// One is the ID of the ;1 half of the Local channel, which faces the
+	// originator of the call
+	One string `json:"one"`
+
+	// Two is the ID of the ;2 half of the Local channel, which runs the
+	// dialplan
+	Two string `json:"two"`
+
+	// Name is the name of the Local channel, without its ;1 or ;2 suffix
+	// (e.g. "Local/100@default-00000001")
+	Name string `json:"name"`
+
+	// Peer is the ID of the channel to which the ;2 half is bridged (e.g. the
+	// channel dialed by the dialplan), if it is bridged yet
+	Peer string `json:"peer,omitempty"`
+
+	// PeerName is the name of the Peer channel
+	PeerName string `json:"peer_name,omitempty"`
+}
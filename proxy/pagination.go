@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// ErrInvalidCursor indicates that the pagination cursor of a request could not
+// be decoded
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Pagination describes the page of results requested from a list operation.
+// Results are ordered by ID (and node), so that pages are stable while
+// entities come and go.
+type Pagination struct {
+	// Cursor is the opaque position after which results are returned, as
+	// returned by the previous page.  If empty, results are returned from the
+	// start of the list.
+	Cursor string `json:"cursor,omitempty"`
+
+	// Limit is the maximum number of results to return.  If zero, all results
+	// after the cursor are returned.
+	Limit int `json:"limit,omitempty"`
+}
+
+// keyOrder returns the sort order of a key
+func keyOrder(k *ari.Key) string {
+	return k.ID + "\x00" + k.Node
+}
+
+// KeyCursor returns the pagination cursor which follows the given key
+func KeyCursor(k *ari.Key) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(keyOrder(k)))
+}
+
+// SortKeys sorts a list of keys in pagination order
+func SortKeys(list []*ari.Key) {
+	sort.Slice(list, func(i, j int) bool {
+		return keyOrder(list[i]) < keyOrder(list[j])
+	})
+}
+
+// Paginate returns the requested page of the list, and the cursor of the next
+// page if there are further results.  If the pagination is nil, the list is
+// returned unchanged.
+func Paginate(list []*ari.Key, p *Pagination) ([]*ari.Key, string, error) {
+	if p == nil || (p.Cursor == "" && p.Limit <= 0) {
+		return list, "", nil
+	}
+
+	var after string
+	if p.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		after = string(b)
+	}
+
+	ret := make([]*ari.Key, 0, len(list))
+	for _, k := range list {
+		if after == "" || keyOrder(k) > after {
+			ret = append(ret, k)
+		}
+	}
+	SortKeys(ret)
+
+	if p.Limit > 0 && len(ret) > p.Limit {
+		ret = ret[:p.Limit]
+		return ret, KeyCursor(ret[len(ret)-1]), nil
+	}
+	return ret, "", nil
+}
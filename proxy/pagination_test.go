@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestPaginate(t *testing.T) {
+	var list []*ari.Key
+	for _, id := range []string{"d", "b", "e", "a", "c"} {
+		list = append(list, ari.NewKey(ari.ChannelKey, id, ari.WithNode("n1")))
+	}
+
+	if page, next, err := Paginate(list, nil); err != nil || len(page) != 5 || next != "" {
+		t.Errorf("unpaginated list should be returned unchanged: %v %q %v", page, next, err)
+	}
+
+	var ids []string
+	p := &Pagination{Limit: 2}
+	for i := 0; i < 5; i++ {
+		page, next, err := Paginate(list, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range page {
+			ids = append(ids, k.ID)
+		}
+		if next == "" {
+			break
+		}
+		p.Cursor = next
+	}
+	if len(ids) != 5 || ids[0] != "a" || ids[4] != "e" {
+		t.Errorf("unexpected pages: %v", ids)
+	}
+
+	if _, _, err := Paginate(list, &Pagination{Cursor: "!!"}); err != ErrInvalidCursor {
+		t.Errorf("expected invalid cursor error, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to
+// the pool, so that an occasional large message (e.g. a long list) does not
+// pin its memory
+const maxPooledBufferSize = 64 * 1024
+
+// bufferPool holds the buffers into which messages are encoded
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// gzipWriterPool holds the writers with which responses are compressed
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// gzipReaderPool holds the readers with which responses are decompressed
+var gzipReaderPool sync.Pool
+
+// envelopePool holds the envelopes by which the types and headers of events
+// are decoded
+var envelopePool = sync.Pool{
+	New: func() interface{} { return new(eventEnvelope) },
+}
+
+// eventEnvelope is the part of the JSON encoding of an event which is common
+// to all events
+type eventEnvelope struct {
+	Type   string     `json:"type"`
+	Header ari.Header `json:"header,omitempty"`
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// EncodeJSON JSON-encodes the given value (as json.Marshal does) into a
+// pooled buffer and calls fn with the encoding.  The encoding is only valid
+// until fn returns; fn must copy it if it is retained.  (Publishing it over
+// NATS copies it.)
+func EncodeJSON(v interface{}, fn func(data []byte) error) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return eris.Wrap(err, "failed to encode message")
+	}
+
+	// Unlike json.Marshal, the Encoder terminates the encoding with a newline
+	return fn(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// decodeEnvelope decodes the type and header of a JSON-encoded event
+func decodeEnvelope(data []byte) (string, ari.Header, error) {
+	env := envelopePool.Get().(*eventEnvelope)
+	defer envelopePool.Put(env)
+
+	env.Type = ""
+	env.Header = nil
+	if err := json.Unmarshal(data, env); err != nil {
+		return "", nil, err
+	}
+	return env.Type, env.Header, nil
+}
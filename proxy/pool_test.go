@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func benchEvent() *ari.StasisStart {
+	return &ari.StasisStart{
+		EventData: ari.EventData{
+			Type:        "StasisStart",
+			Application: "app",
+			Node:        "node",
+			Timestamp:   ari.DateTime(time.Now()),
+		},
+		Args: []string{"a", "b"},
+		Channel: ari.ChannelData{
+			ID:    "1234.5",
+			Name:  "PJSIP/100-00000001",
+			State: "Ring",
+			Dialplan: &ari.DialplanCEP{
+				Context:  "default",
+				Exten:    "100",
+				Priority: 1,
+			},
+		},
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	for _, v := range []interface{}{
+		benchEvent(),
+		&Response{Error: "<html> & friends"},
+	} {
+		expected, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = EncodeJSON(v, func(data []byte) error {
+			if !bytes.Equal(data, expected) {
+				t.Errorf("encoding %s != %s", data, expected)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalEvent(b *testing.B) {
+	e := benchEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeJSONEvent(b *testing.B) {
+	e := benchEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := EncodeJSON(e, func([]byte) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeEvent(b *testing.B) {
+	data, err := json.Marshal(benchEvent())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeEvent(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompressResponse(b *testing.B) {
+	data := []byte(strings.Repeat(`{"kind":"sound","id":"hello-world"},`, 200))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CompressResponse(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeCompressedResponse(b *testing.B) {
+	data, err := json.Marshal(&Response{Keys: []*ari.Key{ari.NewKey(ari.SoundKey, strings.Repeat("x", 4096))}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	compressed, err := CompressResponse(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeResponse(compressed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+// RTPStatistics describes the RTP statistics of a channel, as returned by a
+// ChannelRTPStatistics request.  The fields are those of the RTPstat model of
+// ARI, under the same names.  Jitter and round-trip times are in seconds;
+// "local" values are measured by Asterisk and "remote" values are reported
+// by the peer in RTCP.
+type RTPStatistics struct {
+	// TxCount is the number of packets transmitted
+	TxCount int64 `json:"txcount"`
+
+	// RxCount is the number of packets received
+	RxCount int64 `json:"rxcount"`
+
+	// TxJitter is the jitter on transmitted packets
+	TxJitter float64 `json:"txjitter,omitempty"`
+
+	// RxJitter is the jitter on received packets
+	RxJitter float64 `json:"rxjitter,omitempty"`
+
+	RemoteMaxJitter     float64 `json:"remote_maxjitter,omitempty"`
+	RemoteMinJitter     float64 `json:"remote_minjitter,omitempty"`
+	RemoteNormDevJitter float64 `json:"remote_normdevjitter,omitempty"`
+	RemoteStdevJitter   float64 `json:"remote_stdevjitter,omitempty"`
+	LocalMaxJitter      float64 `json:"local_maxjitter,omitempty"`
+	LocalMinJitter      float64 `json:"local_minjitter,omitempty"`
+	LocalNormDevJitter  float64 `json:"local_normdevjitter,omitempty"`
+	LocalStdevJitter    float64 `json:"local_stdevjitter,omitempty"`
+
+	// TxPacketLoss is the number of transmitted packets lost
+	TxPacketLoss int64 `json:"txploss"`
+
+	// RxPacketLoss is the number of received packets lost
+	RxPacketLoss int64 `json:"rxploss"`
+
+	RemoteMaxRxPacketLoss     float64 `json:"remote_maxrxploss,omitempty"`
+	RemoteMinRxPacketLoss     float64 `json:"remote_minrxploss,omitempty"`
+	RemoteNormDevRxPacketLoss float64 `json:"remote_normdevrxploss,omitempty"`
+	RemoteStdevRxPacketLoss   float64 `json:"remote_stdevrxploss,omitempty"`
+	LocalMaxRxPacketLoss      float64 `json:"local_maxrxploss,omitempty"`
+	LocalMinRxPacketLoss      float64 `json:"local_minrxploss,omitempty"`
+	LocalNormDevRxPacketLoss  float64 `json:"local_normdevrxploss,omitempty"`
+	LocalStdevRxPacketLoss    float64 `json:"local_stdevrxploss,omitempty"`
+
+	// RTT is the round-trip time
+	RTT float64 `json:"rtt,omitempty"`
+
+	MaxRTT     float64 `json:"maxrtt,omitempty"`
+	MinRTT     float64 `json:"minrtt,omitempty"`
+	NormDevRTT float64 `json:"normdevrtt,omitempty"`
+	StdevRTT   float64 `json:"stdevrtt,omitempty"`
+
+	// LocalSSRC and RemoteSSRC are the synchronization sources of the local
+	// and remote streams
+	LocalSSRC  int64 `json:"local_ssrc"`
+	RemoteSSRC int64 `json:"remote_ssrc"`
+
+	// TxOctetCount and RxOctetCount are the numbers of octets transmitted
+	// and received
+	TxOctetCount int64 `json:"txoctetcount"`
+	RxOctetCount int64 `json:"rxoctetcount"`
+
+	// ChannelUniqueID is the unique ID of the channel
+	ChannelUniqueID string `json:"channel_uniqueid,omitempty"`
+}
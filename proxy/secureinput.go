@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// SecureInputKey is the ari.Key kind of secure input captures
+const SecureInputKey = "secureinput"
+
+// secureInputLabel is the OAEP label of encrypted secure input digits
+var secureInputLabel = []byte("ari-proxy-secure-input")
+
+// MinSecureInputKeyBits is the minimum size of the RSA keys to which secure
+// input is encrypted
+const MinSecureInputKeyBits = 2048
+
+// MaxSecureInputDigits is the maximum number of digits of a secure input
+// capture, which is the largest RSA-OAEP (SHA-256) plaintext of a key of
+// MinSecureInputKeyBits
+const MaxSecureInputDigits = MinSecureInputKeyBits/8 - 2*sha256.Size - 2
+
+// SecureInput describes a request to capture sensitive DTMF input (such as
+// payment card numbers) from a channel.  While the capture is active, the
+// channel's DTMF events are withheld from the event stream and the recordings
+// of the channel are paused.  The captured digits are only returned,
+// encrypted to the requester's public key, in the reply to SecureInputStop.
+type SecureInput struct {
+	// PublicKey is the PKIX (DER) encoded RSA public key to which the captured
+	// digits are encrypted
+	PublicKey []byte `json:"public_key"`
+
+	// MaxDigits is the number of digits after which the capture completes.  It
+	// may not exceed MaxSecureInputDigits, after which the capture completes
+	// if it is zero.
+	MaxDigits int `json:"max_digits,omitempty"`
+
+	// Terminator is the set of digits which complete the capture.  The
+	// terminating digit is not captured.
+	Terminator string `json:"terminator,omitempty"`
+
+	// Timeout is the maximum duration of the capture.  It defaults to two
+	// minutes.  A capture which times out is discarded, with its digits.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Validate checks the options of the capture
+func (o *SecureInput) Validate() error {
+	if _, err := ParseSecureInputKey(o.PublicKey); err != nil {
+		return err
+	}
+	if o.MaxDigits < 0 || o.Timeout < 0 {
+		return eris.New("secure input limits may not be negative")
+	}
+	if o.MaxDigits > MaxSecureInputDigits {
+		return eris.Errorf("secure input may not capture more than %d digits", MaxSecureInputDigits)
+	}
+	return nil
+}
+
+// SecureInputResult is the result of a secure input capture
+type SecureInputResult struct {
+	// Digits is the RSA-OAEP (SHA-256) ciphertext of the captured digits
+	Digits []byte `json:"digits"`
+}
+
+// EncryptSecureInput encrypts captured digits to the given PKIX (DER) encoded
+// RSA public key
+func EncryptSecureInput(publicKey []byte, digits string) ([]byte, error) {
+	pub, err := ParseSecureInputKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, []byte(digits), secureInputLabel)
+}
+
+// DecryptSecureInput decrypts the digits of a SecureInputResult
+func DecryptSecureInput(key *rsa.PrivateKey, ciphertext []byte) (string, error) {
+	digits, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext, secureInputLabel)
+	if err != nil {
+		return "", eris.Wrap(err, "failed to decrypt secure input")
+	}
+	return string(digits), nil
+}
+
+// ParseSecureInputKey parses a PKIX (DER) encoded RSA public key of at least
+// MinSecureInputKeyBits
+func ParseSecureInputKey(publicKey []byte) (*rsa.PublicKey, error) {
+	k, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to parse public key")
+	}
+	pub, ok := k.(*rsa.PublicKey)
+	if !ok {
+		return nil, eris.New("public key is not an RSA key")
+	}
+	if pub.N.BitLen() < MinSecureInputKeyBits {
+		return nil, eris.Errorf("RSA public key of %d bits is shorter than %d bits", pub.N.BitLen(), MinSecureInputKeyBits)
+	}
+	return pub, nil
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func TestSecureInputEncryption(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := EncryptSecureInput(pub, "4111111111111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digits, err := DecryptSecureInput(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digits != "4111111111111111" {
+		t.Errorf("unexpected digits: %q", digits)
+	}
+
+	if _, err := EncryptSecureInput([]byte("bogus"), "1234"); err == nil {
+		t.Error("expected error for invalid public key")
+	}
+}
+
+func TestSecureInputValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakPub, err := x509.MarshalPKIXPublicKey(&weak.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		opts  SecureInput
+		valid bool
+	}{
+		{"default", SecureInput{PublicKey: pub}, true},
+		{"max digits", SecureInput{PublicKey: pub, MaxDigits: MaxSecureInputDigits}, true},
+		{"too many digits", SecureInput{PublicKey: pub, MaxDigits: MaxSecureInputDigits + 1}, false},
+		{"negative digits", SecureInput{PublicKey: pub, MaxDigits: -1}, false},
+		{"negative timeout", SecureInput{PublicKey: pub, Timeout: -1}, false},
+		{"short key", SecureInput{PublicKey: weakPub}, false},
+		{"no key", SecureInput{}, false},
+	} {
+		if err := tc.opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: unexpected validation result: %v", tc.name, err)
+		}
+	}
+
+	// The most digits which may be captured fit the encryption
+	digits := strings.Repeat("1", MaxSecureInputDigits)
+	ciphertext, err := EncryptSecureInput(pub, digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecryptSecureInput(key, ciphertext); err != nil || got != digits {
+		t.Errorf("failed to decrypt the most digits: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+// SoundUpload is the request for uploading a sound file to the sounds
+// directory of an Asterisk node, in a sequence of requests: a
+// SoundUploadStart request describes the sound and returns the ID of the
+// upload, then SoundUploadChunk requests carry the file in order, the last of
+// which completes the upload, or a SoundUploadAbort request discards it.
+type SoundUpload struct {
+	// Name is the name of the sound, by which it is played (e.g.
+	// "custom/welcome" for "sound:custom/welcome"), for SoundUploadStart
+	Name string `json:"name,omitempty"`
+
+	// Format is the format of the file, which is its file extension (e.g.
+	// "wav", "ulaw" or "gsm"), for SoundUploadStart
+	Format string `json:"format,omitempty"`
+
+	// Language is the language of the sound (e.g. "en"), if any, for
+	// SoundUploadStart
+	Language string `json:"language,omitempty"`
+
+	// Overwrite replaces an existing file of the sound, for SoundUploadStart
+	Overwrite bool `json:"overwrite,omitempty"`
+
+	// Upload is the ID of the upload, for SoundUploadChunk and
+	// SoundUploadAbort
+	Upload string `json:"upload,omitempty"`
+
+	// Chunk is the encoded FileChunk of the file, for SoundUploadChunk
+	Chunk []byte `json:"chunk,omitempty"`
+}
+
+// SoundUploadData describes an upload of a sound file
+type SoundUploadData struct {
+	// Upload is the ID of the upload
+	Upload string `json:"upload"`
+
+	// Size is the number of bytes received
+	Size int64 `json:"size"`
+}
@@ -13,3 +13,134 @@ func Subject(prefix, class, appName, asterisk string) (ret string) {
 	}
 	return
 }
+
+// AudioSubject returns the NATS subject on which the audio of the given audio
+// fork is published
+func AudioSubject(prefix, forkID string) string {
+	return fmt.Sprintf("%saudio.%s", prefix, forkID)
+}
+
+// LogStreamSubject returns the NATS subject on which the lines of the given
+// log stream are published
+func LogStreamSubject(prefix, streamID string) string {
+	return fmt.Sprintf("%slogstream.%s", prefix, streamID)
+}
+
+// SubjectBuilder constructs the NATS subjects of the proxy protocol.  Clients
+// and servers of a deployment must use equivalent builders.  Deployments which
+// need to scope their subjects beyond a prefix (e.g. by datacenter or tenant
+// tokens) may provide their own implementation.
+type SubjectBuilder interface {
+	// Request returns the subject of requests of the given class ("get",
+	// "data", "command", or "create") addressed to the given application and
+	// node.  Either may be empty, addressing all applications or all nodes.
+	Request(class, app, node string) string
+
+	// Event returns the subject of the events of the given application and
+	// node.  If either is empty, the returned subject is a wildcard which
+	// matches the events of all applications or all nodes.
+	Event(app, node string) string
+
+	// DialogEvent returns the subject of the events of the given dialog
+	DialogEvent(dialog string) string
+
+	// Announcement returns the subject of proxy announcements
+	Announcement() string
+
+	// Ping returns the subject of proxy pings
+	Ping() string
+
+	// Audio returns the subject of the audio of the given audio fork
+	Audio(forkID string) string
+
+	// LogStream returns the subject of the lines of the given log stream
+	LogStream(streamID string) string
+}
+
+// TypedEventSubjectBuilder is implemented by the SubjectBuilders which
+// support per-type event subjects, to which proxies publish their events when
+// they are configured to, so that clients subscribe only to the types of
+// events they handle
+type TypedEventSubjectBuilder interface {
+	SubjectBuilder
+
+	// TypedEvent returns the subject of the events of the given type of the
+	// given application and node.  If any of them is empty, the returned
+	// subject is a wildcard which matches the events of all applications,
+	// nodes or types.  The subjects of the events of an application must
+	// also be matched by its wildcard Event subject (that of all its nodes).
+	TypedEvent(app, node, typ string) string
+}
+
+// PrefixSubjectBuilder is the default SubjectBuilder, which prepends a prefix
+// (e.g. "ari.") to each subject
+type PrefixSubjectBuilder struct {
+	Prefix string
+}
+
+// NewSubjectBuilder returns the default SubjectBuilder for the given prefix
+func NewSubjectBuilder(prefix string) *PrefixSubjectBuilder {
+	return &PrefixSubjectBuilder{Prefix: prefix}
+}
+
+// Request implements SubjectBuilder
+func (b *PrefixSubjectBuilder) Request(class, app, node string) string {
+	return Subject(b.Prefix, class, app, node)
+}
+
+// Event implements SubjectBuilder
+func (b *PrefixSubjectBuilder) Event(app, node string) string {
+	subj := b.Prefix + "event."
+	if app == "" {
+		return subj + ">"
+	}
+	subj += app + "."
+
+	if node == "" {
+		return subj + ">"
+	}
+	return subj + node
+}
+
+// TypedEvent implements TypedEventSubjectBuilder
+func (b *PrefixSubjectBuilder) TypedEvent(app, node, typ string) string {
+	subj := b.Prefix + "event."
+	if app == "" && node == "" && typ == "" {
+		return subj + ">"
+	}
+	for _, tok := range []string{app, node} {
+		if tok == "" {
+			tok = "*"
+		}
+		subj += tok + "."
+	}
+	if typ == "" {
+		return subj + ">"
+	}
+	return subj + typ
+}
+
+// DialogEvent implements SubjectBuilder
+func (b *PrefixSubjectBuilder) DialogEvent(dialog string) string {
+	return fmt.Sprintf("%sdialogevent.%s", b.Prefix, dialog)
+}
+
+// Announcement implements SubjectBuilder
+func (b *PrefixSubjectBuilder) Announcement() string {
+	return AnnouncementSubject(b.Prefix)
+}
+
+// Ping implements SubjectBuilder
+func (b *PrefixSubjectBuilder) Ping() string {
+	return PingSubject(b.Prefix)
+}
+
+// Audio implements SubjectBuilder
+func (b *PrefixSubjectBuilder) Audio(forkID string) string {
+	return AudioSubject(b.Prefix, forkID)
+}
+
+// LogStream implements SubjectBuilder
+func (b *PrefixSubjectBuilder) LogStream(streamID string) string {
+	return LogStreamSubject(b.Prefix, streamID)
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import "testing"
+
+func TestPrefixSubjectBuilder(t *testing.T) {
+	b := NewSubjectBuilder("ari.")
+
+	tests := []struct {
+		got, expected string
+	}{
+		{b.Request("get", "", ""), "ari.get"},
+		{b.Request("get", "app", ""), "ari.get.app"},
+		{b.Request("create", "app", "node"), "ari.create.app.node"},
+		{b.Event("", ""), "ari.event.>"},
+		{b.Event("app", ""), "ari.event.app.>"},
+		{b.Event("app", "node"), "ari.event.app.node"},
+		{b.TypedEvent("app", "node", "StasisStart"), "ari.event.app.node.StasisStart"},
+		{b.TypedEvent("app", "", "StasisStart"), "ari.event.app.*.StasisStart"},
+		{b.TypedEvent("", "", "StasisStart"), "ari.event.*.*.StasisStart"},
+		{b.TypedEvent("app", "node", ""), "ari.event.app.node.>"},
+		{b.TypedEvent("", "", ""), "ari.event.>"},
+		{b.DialogEvent("dlg"), "ari.dialogevent.dlg"},
+		{b.Announcement(), "ari.announce"},
+		{b.Ping(), "ari.ping"},
+		{b.Audio("af1"), "ari.audio.af1"},
+		{b.LogStream("ls1"), "ari.logstream.ls1"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("subject %q != %q", tt.got, tt.expected)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/CyCoreSystems/ari/v5"
@@ -20,6 +21,99 @@ type Announcement struct {
 
 	// Application indicates the ARI application as which the proxy is connected
 	Application string `json:"application"`
+
+	// Instance uniquely identifies the proxy process, distinguishing the
+	// proxies which serve the same application and node
+	Instance string `json:"instance,omitempty"`
+
+	// Version is the version of the proxy
+	Version string `json:"version,omitempty"`
+
+	// Kinds is the list of request Kinds which the proxy supports
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Encodings is the list of response encodings (e.g. "gzip") which the
+	// proxy may use (see Request.AcceptEncoding)
+	Encodings []string `json:"encodings,omitempty"`
+
+	// Features is the list of optional features (see the Feature constants)
+	// which are enabled on the proxy
+	Features []string `json:"features,omitempty"`
+
+	// Draining indicates that the proxy is rejecting new create requests
+	// (see ErrDraining)
+	Draining bool `json:"draining,omitempty"`
+
+	// Leaving indicates that the proxy is stopping: it refuses new requests
+	// (see ErrLeaving) while it completes those being handled, and clients
+	// should no longer route requests to it
+	Leaving bool `json:"leaving,omitempty"`
+
+	// Maintenance is the current or next scheduled maintenance window of the
+	// node, if any
+	Maintenance *MaintenanceWindow `json:"maintenance,omitempty"`
+
+	// AsteriskVersion is the version of Asterisk on the node
+	AsteriskVersion string `json:"asterisk_version,omitempty"`
+
+	// ChannelDrivers is the sorted list of the channel driver modules (e.g.
+	// "chan_pjsip") which are loaded in Asterisk
+	ChannelDrivers []string `json:"channel_drivers,omitempty"`
+
+	// MaxCalls is the number of concurrent calls which the node is configured
+	// to handle, as a hint for call placement, or zero if it is not known
+	MaxCalls int `json:"max_calls,omitempty"`
+
+	// Labels are the arbitrary labels (e.g. region or zone) with which the
+	// proxy is configured, for call placement and cluster inventory
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Optional features of the proxy, as announced in Announcement.Features
+const (
+	FeatureAMD               = "amd"
+	FeatureAudioFork         = "audio_fork"
+	FeatureClickToCall       = "click_to_call"
+	FeatureCompression       = "compression"
+	FeatureDeadAir           = "dead_air"
+	FeatureEventTypeSubjects = "event_type_subjects"
+	FeatureFax               = "fax"
+	FeatureLCR               = "lcr"
+	FeatureLogStream         = "log_stream"
+	FeatureQuota             = "quota"
+	FeatureScreening         = "screening"
+	FeatureStirShaken        = "stir_shaken"
+	FeatureVoicemail         = "voicemail"
+)
+
+// HasFeature indicates whether the announced proxy has the given feature
+// enabled
+func (a *Announcement) HasFeature(name string) bool {
+	for _, f := range a.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChannelDriver indicates whether the announced node has the given channel
+// driver (e.g. "chan_audiosocket") loaded
+func (a *Announcement) HasChannelDriver(name string) bool {
+	name = strings.TrimSuffix(name, ".so")
+	for _, d := range a.ChannelDrivers {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLabel indicates whether the announced proxy has the given label with the
+// given value
+func (a *Announcement) HasLabel(name, value string) bool {
+	v, ok := a.Labels[name]
+	return ok && v == value
 }
 
 // AnnouncementSubject returns the NATS subject
@@ -36,17 +130,28 @@ func PingSubject(prefix string) string {
 type EntityData struct {
 	Application     *ari.ApplicationData     `json:"application,omitempty"`
 	Asterisk        *ari.AsteriskInfo        `json:"asterisk,omitempty"`
+	AudioFork       *AudioForkData           `json:"audio_fork,omitempty"`
 	Bridge          *ari.BridgeData          `json:"bridge,omitempty"`
+	BridgeAssembly  *BridgeAssembly          `json:"bridge_assembly,omitempty"`
+	CallGraph       *CallGraph               `json:"call_graph,omitempty"`
+	Campaign        *CampaignStats           `json:"campaign,omitempty"`
 	Channel         *ari.ChannelData         `json:"channel,omitempty"`
 	Config          *ari.ConfigData          `json:"config,omitempty"`
+	DebugCapture    *DebugCaptureData        `json:"debug_capture,omitempty"`
 	DeviceState     *ari.DeviceStateData     `json:"device_state,omitempty"`
 	Endpoint        *ari.EndpointData        `json:"endpoint,omitempty"`
 	LiveRecording   *ari.LiveRecordingData   `json:"live_recording,omitempty"`
+	LocalPair       *LocalChannelPair        `json:"local_pair,omitempty"`
 	Log             *ari.LogData             `json:"log,omitempty"`
+	LogStream       *LogStreamData           `json:"log_stream,omitempty"`
 	Mailbox         *ari.MailboxData         `json:"mailbox,omitempty"`
 	Module          *ari.ModuleData          `json:"module,omitempty"`
+	NodeInfo        *NodeInfo                `json:"node_info,omitempty"`
 	Playback        *ari.PlaybackData        `json:"playback,omitempty"`
+	RTPStatistics   *RTPStatistics           `json:"rtp_statistics,omitempty"`
+	SecureInput     *SecureInputResult       `json:"secure_input,omitempty"`
 	Sound           *ari.SoundData           `json:"sound,omitempty"`
+	SoundUpload     *SoundUploadData         `json:"sound_upload,omitempty"`
 	StoredRecording *ari.StoredRecordingData `json:"stored_recording,omitempty"`
 	TextMessage     *ari.TextMessageData     `json:"text_message,omitempty"`
 
@@ -56,11 +161,38 @@ type EntityData struct {
 // ErrNotFound indicates that the operation did not return a result
 var ErrNotFound = errors.New("Not found")
 
+// ErrDraining indicates that a create request was rejected because the node
+// is draining (e.g. during a maintenance window)
+var ErrDraining = errors.New("node is draining")
+
+// ErrLeaving indicates that a request was refused because the proxy is
+// stopping (see Announcement.Leaving)
+var ErrLeaving = errors.New("proxy is leaving the cluster")
+
+// ErrNotSupportedByAsterisk indicates that a request was rejected because the
+// ARI version of the node's Asterisk predates the operation of the request
+var ErrNotSupportedByAsterisk = errors.New("operation not supported by Asterisk")
+
+// ErrOriginateBlocked indicates that the creation of an outbound channel was
+// blocked by an originate policy of the proxy (e.g. a fraud detection limit).
+// The error returned to clients describes the policy and the reason.
+var ErrOriginateBlocked = errors.New("originate blocked")
+
+// IsOriginateBlocked indicates whether the given error reports that an
+// outbound channel was blocked by an originate policy
+func IsOriginateBlocked(err error) bool {
+	return err != nil && strings.Contains(err.Error(), ErrOriginateBlocked.Error())
+}
+
 // Response is a response to a request.  This acts as a base type for more complicated responses, as well.
 type Response struct {
 	// Error is the error encountered
 	Error string `json:"error"`
 
+	// ErrorCode classifies the error, if it is a typed error (e.g.
+	// ErrorCodeChannelGone)
+	ErrorCode string `json:"error_code,omitempty"`
+
 	// Data is the returned entity data, if applicable
 	Data *EntityData `json:"data,omitempty"`
 
@@ -69,14 +201,24 @@ type Response struct {
 
 	// Keys is the list of keys of any matching entities, if applicable
 	Keys []*ari.Key `json:"keys,omitempty"`
+
+	// NextCursor is the pagination cursor of the next page of a paginated
+	// list, if there are further results
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Instance is the instance ID of the proxy which handled the request
+	Instance string `json:"instance,omitempty"`
 }
 
-// Err returns an error from the Response.  If the response's Error is empty, a nil error is returned.  Otherwise, the error will be filled with the value of response.Error.
+// Err returns an error from the Response.  If the response's Error is empty, a nil error is returned.  Otherwise, the error will be filled with the value of response.Error.  Typed errors (see ErrorCode) are returned as a *TypedError.
 func (e *Response) Err() error {
 	if e == nil {
 		return nil
 	}
 	if e.Error != "" {
+		if _, ok := typedErrors[e.ErrorCode]; ok {
+			return &TypedError{Message: e.Error, Code: e.ErrorCode}
+		}
 		return errors.New(e.Error)
 	}
 	return nil
@@ -92,7 +234,7 @@ func NewErrorResponse(err error) *Response {
 	if err == nil {
 		return &Response{}
 	}
-	return &Response{Error: err.Error()}
+	return &Response{Error: err.Error(), ErrorCode: ErrorCode(err)}
 }
 
 // Request describes a request which is sent from an ARI proxy Client to an ARI proxy Server
@@ -103,13 +245,46 @@ type Request struct {
 	// Key is the key or key filter on which this request should be processed
 	Key *ari.Key `json:"key"`
 
+	// Tenant optionally identifies the tenant on whose behalf the request is made
+	Tenant string `json:"tenant,omitempty"`
+
+	// Pagination optionally requests a page of the results of a list request
+	Pagination *Pagination `json:"pagination,omitempty"`
+
+	// Fields optionally restricts the entity data of a data request to the
+	// given fields, named by their JSON names
+	Fields []string `json:"fields,omitempty"`
+
+	// AcceptEncoding is the list of response encodings (e.g. "gzip") which the
+	// requester can decode.  The server may compress large responses with one
+	// of them.
+	AcceptEncoding []string `json:"accept_encoding,omitempty"`
+
+	// Deadline is the time after which the requester no longer waits for the
+	// response.  A proxy does not execute a request whose deadline has passed
+	// (e.g. a request which was queued while the proxy was busy), and stops
+	// retrying it once its deadline passes, replying with the last error.  It
+	// does not interrupt a request being executed: its ARI calls, and any
+	// background work it starts (e.g. AMD detection), run to completion past
+	// the deadline.  It assumes that the clocks of the requester and the
+	// proxy are synchronized.
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// ReplyTo is the subject to which the response is published, for requests
+	// made through a JetStream stream, whose NATS reply subject receives the
+	// stream's acknowledgment instead
+	ReplyTo string `json:"reply_to,omitempty"`
+
 	ApplicationSubscribe *ApplicationSubscribe `json:"application_subscribe,omitempty"`
 
 	AsteriskConfig         *AsteriskConfig         `json:"asterisk_config,omitempty"`
 	AsteriskLoggingChannel *AsteriskLoggingChannel `json:"asterisk_logging_channel,omitempty"`
 	AsteriskVariableSet    *AsteriskVariableSet    `json:"asterisk_variable_set,omitempty"`
 
+	AudioFork *AudioFork `json:"audio_fork,omitempty"`
+
 	BridgeAddChannel    *BridgeAddChannel    `json:"bridge_add_channel,omitempty"`
+	BridgeAssemble      *BridgeAssemble      `json:"bridge_assemble,omitempty"`
 	BridgeCreate        *BridgeCreate        `json:"bridge_create,omitempty"`
 	BridgeMOH           *BridgeMOH           `json:"bridge_moh,omitempty"`
 	BridgePlay          *BridgePlay          `json:"bridge_play,omitempty"`
@@ -117,31 +292,60 @@ type Request struct {
 	BridgeRemoveChannel *BridgeRemoveChannel `json:"bridge_remove_channel,omitempty"`
 	BridgeVideoSource   *BridgeVideoSource   `json:"bridge_video_source,omitempty"`
 
+	CallHold *CallHold `json:"call_hold,omitempty"`
+
+	Campaign *Campaign `json:"campaign,omitempty"`
+
+	CollectDigits *CollectDigits `json:"collect_digits,omitempty"`
+
+	ChannelAMD           *ChannelAMD           `json:"channel_amd,omitempty"`
 	ChannelCreate        *ChannelCreate        `json:"channel_create,omitempty"`
 	ChannelContinue      *ChannelContinue      `json:"channel_continue,omitempty"`
 	ChannelDial          *ChannelDial          `json:"channel_dial,omitempty"`
 	ChannelHangup        *ChannelHangup        `json:"channel_hangup,omitempty"`
 	ChannelMOH           *ChannelMOH           `json:"channel_moh,omitempty"`
+	ChannelMove          *ChannelMove          `json:"channel_move,omitempty"`
 	ChannelMute          *ChannelMute          `json:"channel_mute,omitempty"`
 	ChannelOriginate     *ChannelOriginate     `json:"channel_originate,omitempty"`
 	ChannelPlay          *ChannelPlay          `json:"channel_play,omitempty"`
 	ChannelRecord        *ChannelRecord        `json:"channel_record,omitempty"`
+	ChannelRecordConsent *ChannelRecordConsent `json:"channel_record_consent,omitempty"`
 	ChannelSendDTMF      *ChannelSendDTMF      `json:"channel_send_dtmf,omitempty"`
 	ChannelSnoop         *ChannelSnoop         `json:"channel_snoop,omitempty"`
 	ChannelExternalMedia *ChannelExternalMedia `json:"channel_external_media,omitempty"`
 	ChannelVariable      *ChannelVariable      `json:"channel_variable,omitempty"`
 
+	DebugCapture *DebugCapture `json:"debug_capture,omitempty"`
+
 	DeviceStateUpdate *DeviceStateUpdate `json:"device_state_update,omitempty"`
 
+	DialCancel *DialCancel `json:"dial_cancel,omitempty"`
+
 	EndpointListByTech *EndpointListByTech `json:"endpoint_list_by_tech,omitempty"`
 
+	Fax *Fax `json:"fax,omitempty"`
+
+	LogStream *LogStream `json:"log_stream,omitempty"`
+
 	MailboxUpdate *MailboxUpdate `json:"mailbox_update,omitempty"`
 
+	Maintenance *MaintenanceWindow `json:"maintenance,omitempty"`
+
+	Page *Page `json:"page,omitempty"`
+
 	PlaybackControl *PlaybackControl `json:"playback_control,omitempty"`
 
 	RecordingStoredCopy *RecordingStoredCopy `json:"recording_stored_copy,omitempty"`
 
+	SecureInput *SecureInput `json:"secure_input,omitempty"`
+
 	SoundList *SoundList `json:"sound_list,omitempty"`
+
+	SoundUpload *SoundUpload `json:"sound_upload,omitempty"`
+
+	Voicemail *Voicemail `json:"voicemail,omitempty"`
+
+	Watch *Watch `json:"watch,omitempty"`
 }
 
 // ApplicationSubscribe describes a request to subscribe/unsubscribe a particular ARI application to an EventSource
@@ -160,6 +364,116 @@ type AsteriskVariableSet struct {
 	Value string `json:"value"`
 }
 
+// AudioFork describes a request to stream the live audio of a channel
+type AudioFork struct {
+	// Direction is the direction of the audio to stream (in, out, or both).
+	// It defaults to both.
+	Direction ari.Direction `json:"direction,omitempty"`
+
+	// Format is the audio format (e.g. "slin16" or "ulaw").  It defaults to
+	// "slin16", which is delivered as big-endian 16-bit samples at 16kHz.
+	Format string `json:"format,omitempty"`
+}
+
+// AudioForkKey is the ari.Key kind of audio forks
+const AudioForkKey = "audiofork"
+
+// AudioForkData describes an audio fork and the means by which its audio may
+// be consumed
+type AudioForkData struct {
+	// ID is the audio fork identifier
+	ID string `json:"id"`
+
+	// ChannelID is the ID of the channel whose audio is streamed
+	ChannelID string `json:"channel_id"`
+
+	// Format is the audio format
+	Format string `json:"format"`
+
+	// Subject is the NATS subject on which each audio frame is published
+	Subject string `json:"subject"`
+
+	// URL is the WebSocket URL from which the audio frames may be received,
+	// if the WebSocket endpoint is enabled
+	URL string `json:"url,omitempty"`
+}
+
+// LogStream describes a request to stream the lines written to an Asterisk
+// logging channel
+type LogStream struct {
+	// Levels is the comma-separated list of logging levels to stream (e.g.
+	// "warning,error").  It defaults to "notice,warning,error".
+	Levels string `json:"levels,omitempty"`
+}
+
+// LogStreamKey is the ari.Key kind of log streams
+const LogStreamKey = "logstream"
+
+// LogStreamData describes a log stream and the NATS subject on which its
+// lines are published
+type LogStreamData struct {
+	// ID is the log stream identifier
+	ID string `json:"id"`
+
+	// Channel is the name of the Asterisk logging channel which is streamed
+	Channel string `json:"channel"`
+
+	// Levels is the list of streamed logging levels
+	Levels string `json:"levels"`
+
+	// Subject is the NATS subject on which each log line is published
+	Subject string `json:"subject"`
+}
+
+// NodeInfo describes the state of a proxy server and its Asterisk node, as
+// reported in response to a ClusterInfo request
+type NodeInfo struct {
+	// Application is the ARI application as which the proxy is connected
+	Application string `json:"application"`
+
+	// Node is the Asterisk ID to which the proxy is connected
+	Node string `json:"node"`
+
+	// Version is the version of the proxy
+	Version string `json:"version,omitempty"`
+
+	// StartedAt is the time at which the proxy started listening
+	StartedAt time.Time `json:"started_at"`
+
+	// Uptime is the time for which the proxy has been listening
+	Uptime time.Duration `json:"uptime"`
+
+	// Channels is the number of channels on the Asterisk node
+	Channels int `json:"channels"`
+
+	// Bridges is the number of bridges on the Asterisk node
+	Bridges int `json:"bridges"`
+
+	// Draining indicates that the proxy is rejecting new create requests
+	Draining bool `json:"draining,omitempty"`
+
+	// Leaving indicates that the proxy is stopping: it refuses new requests
+	// (see ErrLeaving) while it completes those being handled, and clients
+	// should no longer route requests to it
+	Leaving bool `json:"leaving,omitempty"`
+
+	// Maintenance is the current or next scheduled maintenance window of the
+	// node, if any
+	Maintenance *MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// MaintenanceWindow describes a period during which a node drains: it
+// announces that it is draining and rejects new create requests, other than
+// those to emergency destinations, until the window ends.
+type MaintenanceWindow struct {
+	// Start is the time at which the window starts.  If zero, the window
+	// starts immediately.
+	Start time.Time `json:"start,omitempty"`
+
+	// End is the time at which the window ends and the node resumes
+	End time.Time `json:"end"`
+}
+
 // BridgeAddChannel is the request type for adding a channel to a bridge
 type BridgeAddChannel struct {
 	// Channel is the channel ID to add to the bridge
@@ -171,15 +485,58 @@ type BridgeAddChannel struct {
 	// Mute indicates that the channel should be muted, preventing audio from it passing through to the bridge
 	Mute bool `json:"mute,omitempty"`
 
-	// Role indicates the channel's role in the bridge
+	// Role indicates the channel's role in the bridge (e.g. "announcer" or
+	// "participant" for holding bridges).  Roles may only contain letters,
+	// digits, underscores, and hyphens, and an announcer may not be muted.
 	Role string `json:"role,omitempty"`
 }
 
+// BridgeAssemble is the request type for creating a bridge and adding
+// channels to it as one operation.  The channels are added in order; if any
+// of them cannot be added, the bridge is destroyed.
+type BridgeAssemble struct {
+	// Type is the type of the bridge (see BridgeCreate)
+	Type string `json:"type"`
+
+	// Name is the name to assign to the bridge (optional)
+	Name string `json:"name,omitempty"`
+
+	// Channels is the list of channels to add to the bridge, with their join
+	// options
+	Channels []BridgeAddChannel `json:"channels"`
+}
+
+// BridgeAssembly describes the outcome of a BridgeAssemble request
+type BridgeAssembly struct {
+	// Channels is the result of adding each channel of the request, in order
+	Channels []BridgeChannelResult `json:"channels"`
+
+	// RolledBack indicates that a channel could not be added and that the
+	// bridge was therefore destroyed
+	RolledBack bool `json:"rolled_back,omitempty"`
+}
+
+// BridgeChannelResult is the result of adding a channel to an assembled
+// bridge
+type BridgeChannelResult struct {
+	// Channel is the ID of the channel
+	Channel string `json:"channel"`
+
+	// Added indicates that the channel was added to the bridge (and, if the
+	// assembly was rolled back, has since been removed)
+	Added bool `json:"added,omitempty"`
+
+	// Error is the error with which the channel could not be added, if any.
+	// Neither Added nor Error is set for the channels which were not
+	// attempted, following the channel which failed.
+	Error string `json:"error,omitempty"`
+}
+
 // BridgeCreate is the request type for creating a bridge
 type BridgeCreate struct {
 	// Type is the comma-separated list of bridge type attributes (mixing,
-	// holding, dtmf_events, proxy_media).  If not set, the default (mixing)
-	// will be used.
+	// holding, dtmf_events, proxy_media, video_sfu, video_single).  If not
+	// set, the default (mixing) will be used.
 	Type string `json:"type"`
 
 	// Name is the name to assign to the bridge (optional)
@@ -199,6 +556,20 @@ type BridgePlay struct {
 
 	// MediaURI is the URI from which to obtain the playback media
 	MediaURI string `json:"media_uri"`
+
+	// MediaURIs is a playlist of media URIs to play in sequence (Asterisk
+	// 14+).  If set, it takes the place of MediaURI.
+	MediaURIs []string `json:"media_uris,omitempty"`
+
+	PlayOptions `json:",inline"`
+}
+
+// Media returns the list of media URIs to play
+func (p *BridgePlay) Media() []string {
+	if len(p.MediaURIs) > 0 {
+		return p.MediaURIs
+	}
+	return []string{p.MediaURI}
 }
 
 // BridgeRecord is the request for recording a bridge
@@ -222,6 +593,128 @@ type BridgeVideoSource struct {
 	Channel string `json:"channel"`
 }
 
+// CallHold describes a request to place a call on hold
+type CallHold struct {
+	// MOHClass is the music on hold class played to the held channel.  It
+	// defaults to "default".
+	MOHClass string `json:"moh_class,omitempty"`
+}
+
+// Campaign describes an outbound dialer campaign.  Numbers are dialed at the
+// configured pace, and answered calls enter the ARI application.
+type Campaign struct {
+	// Numbers is the list of numbers to dial
+	Numbers []string `json:"numbers"`
+
+	// Endpoint is the endpoint template for each call, in which `{number}` is
+	// replaced by the number to dial (e.g. "PJSIP/{number}@trunk")
+	Endpoint string `json:"endpoint"`
+
+	// CallerID is the caller ID to present
+	CallerID string `json:"caller_id,omitempty"`
+
+	// CallsPerMinute is the maximum rate at which calls are placed.  If zero,
+	// one call is placed per second.
+	CallsPerMinute int `json:"calls_per_minute,omitempty"`
+
+	// Concurrency is the maximum number of concurrent calls.  If zero, the
+	// number of concurrent calls is not limited.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// Timeout is the time to wait for each call to be answered
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// AppArgs is the application argument of answered calls.  It defaults to
+	// "campaign:<id>".
+	AppArgs string `json:"app_args,omitempty"`
+
+	// Variables is the set of channel variables to set on each call
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// AMD, if set, runs answering machine detection on each answered call,
+	// reporting the result with an AMDFinished event
+	AMD *ChannelAMD `json:"amd,omitempty"`
+
+	// HangupMachines causes calls which AMD classifies as answered by a
+	// machine to be hung up
+	HangupMachines bool `json:"hangup_machines,omitempty"`
+}
+
+// CampaignKey is the ari.Key kind of dialer campaigns
+const CampaignKey = "campaign"
+
+// Campaign states
+const (
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignStopped   = "stopped"
+	CampaignCompleted = "completed"
+)
+
+// CampaignStats describes the progress of a dialer campaign
+type CampaignStats struct {
+	// ID is the campaign identifier
+	ID string `json:"id"`
+
+	// State is the campaign state (running, paused, stopped, or completed)
+	State string `json:"state"`
+
+	// Total is the number of numbers in the campaign
+	Total int `json:"total"`
+
+	// Pending is the number of numbers which have not yet been dialed
+	Pending int `json:"pending"`
+
+	// Active is the number of calls in progress
+	Active int `json:"active"`
+
+	// Dialed is the number of calls placed
+	Dialed int `json:"dialed"`
+
+	// Answered is the number of calls which were answered
+	Answered int `json:"answered"`
+
+	// NoAnswer is the number of calls which ended without being answered
+	NoAnswer int `json:"no_answer"`
+
+	// Failed is the number of calls which could not be placed
+	Failed int `json:"failed"`
+
+	// Machines is the number of answered calls which AMD classified as
+	// answered by a machine
+	Machines int `json:"machines,omitempty"`
+}
+
+// ChannelAMD describes a request to run answering machine detection on a
+// channel.  The classification is reported by an AMDFinished event.
+type ChannelAMD struct {
+	// Options is the parameter string passed to the AMD dialplan application
+	// (e.g. "2500,1500,800,5000").  It is ignored by other detectors.
+	Options string `json:"options,omitempty"`
+
+	// Timeout is the maximum time to wait for a classification.  It defaults
+	// to thirty seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// AMD classifications
+const (
+	AMDHuman   = "HUMAN"
+	AMDMachine = "MACHINE"
+	AMDNotSure = "NOTSURE"
+	AMDHangup  = "HANGUP"
+)
+
+// AMDResult is the result of answering machine detection
+type AMDResult struct {
+	// Status is the classification (HUMAN, MACHINE, NOTSURE, or HANGUP)
+	Status string `json:"status"`
+
+	// Cause is the reason for the classification, as reported by the
+	// detector (e.g. "INITIALSILENCE-2500-2500")
+	Cause string `json:"cause,omitempty"`
+}
+
 // ChannelCreate describes a request to create a new channel
 type ChannelCreate struct {
 	// ChannelCreateRequest is the request for creating the channel
@@ -245,10 +738,31 @@ type ChannelDial struct {
 	// Caller is the channel ID of the "caller" channel; if specified, the media parameters of the dialing channel will be matched to the "caller" channel.
 	Caller string `json:"caller"`
 
-	// Timeout is the maximum time which should be allowed for the dial to complete
+	// Timeout is the maximum time which should be allowed for the dial to
+	// complete.  The proxy hangs up the channel (with reason "no_answer") if it
+	// has not been answered within the timeout.
 	Timeout time.Duration `json:"timeout"`
 }
 
+// Dial results, as reported by the DialResult event
+const (
+	DialAnswer      = "answer"
+	DialBusy        = "busy"
+	DialNoAnswer    = "noanswer"
+	DialCongestion  = "congestion"
+	DialUnavailable = "chanunavail"
+	DialCancelled   = "cancel"
+	DialFailed      = "failed"
+)
+
+// DialCancel is the request for aborting the dial of a channel which has not
+// yet been answered
+type DialCancel struct {
+	// Reason is the hangup reason of the cancelled channel.  It defaults to
+	// "normal".
+	Reason string `json:"reason,omitempty"`
+}
+
 // ChannelHangup is the request for hanging up a channel
 type ChannelHangup struct {
 	// Reason is the reason the channel is being hung up
@@ -261,6 +775,18 @@ type ChannelMOH struct {
 	Music string `json:"music"`
 }
 
+// ChannelMove is the request for moving a channel from its Stasis application
+// to another
+type ChannelMove struct {
+	// Application is the name of the Stasis application to which the channel
+	// is moved
+	Application string `json:"application"`
+
+	// Args are the arguments passed to the application, which it receives in
+	// its StasisStart event
+	Args []string `json:"args,omitempty"`
+}
+
 // ChannelMute is the request for muting or unmuting a channel
 type ChannelMute struct {
 	// Direction is the direction to mute
@@ -280,6 +806,39 @@ type ChannelPlay struct {
 
 	// MediaURI is the URI from which to obtain the playback media
 	MediaURI string `json:"media_uri"`
+
+	// MediaURIs is a playlist of media URIs to play in sequence (Asterisk
+	// 14+).  If set, it takes the place of MediaURI.
+	MediaURIs []string `json:"media_uris,omitempty"`
+
+	PlayOptions `json:",inline"`
+}
+
+// Media returns the list of media URIs to play
+func (p *ChannelPlay) Media() []string {
+	if len(p.MediaURIs) > 0 {
+		return p.MediaURIs
+	}
+	return []string{p.MediaURI}
+}
+
+// PlayOptions are the optional parameters of a playback
+type PlayOptions struct {
+	// Language is the language of the sounds to play, for sounds with
+	// multiple languages
+	Language string `json:"language,omitempty"`
+
+	// OffsetMS is the number of milliseconds to skip before playing
+	OffsetMS int `json:"offsetms,omitempty"`
+
+	// SkipMS is the number of milliseconds to skip for the forward and
+	// reverse playback controls.  Asterisk defaults to 3000.
+	SkipMS int `json:"skipms,omitempty"`
+}
+
+// Empty indicates whether no playback options are set
+func (o PlayOptions) Empty() bool {
+	return o == (PlayOptions{})
 }
 
 // ChannelRecord is the request for recording a channel
@@ -291,6 +850,31 @@ type ChannelRecord struct {
 	Options *ari.RecordingOptions `json:"options,omitempty"`
 }
 
+// ChannelRecordConsent is the request for recording a channel after playing a
+// consent announcement.  The recording is started only once consent is
+// obtained, and the outcome is reported by a RecordingConsent event.
+type ChannelRecordConsent struct {
+	// Name is the name for the recording
+	Name string `json:"name"`
+
+	// Options is the list of recording Options
+	Options *ari.RecordingOptions `json:"options,omitempty"`
+
+	// Announcement is the media URI of the consent announcement (e.g. "sound:recording-consent")
+	Announcement string `json:"announcement"`
+
+	// AcceptDTMF is the set of DTMF digits which indicate acceptance.  If
+	// empty, consent is implied once the announcement has finished.
+	AcceptDTMF string `json:"accept_dtmf,omitempty"`
+
+	// DeclineDTMF is the set of DTMF digits which indicate refusal
+	DeclineDTMF string `json:"decline_dtmf,omitempty"`
+
+	// Timeout is the maximum time to wait for an accepting digit after the
+	// announcement has finished.  It defaults to ten seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
 // ChannelSendDTMF is the request for sending a DTMF event to a channel
 type ChannelSendDTMF struct {
 	// DTMF is the series of DTMF inputs to send
@@ -335,6 +919,24 @@ type EndpointListByTech struct {
 	Tech string `json:"tech"`
 }
 
+// Fax describes a request to send (FaxSend) or receive (FaxReceive) a fax on a
+// channel
+type Fax struct {
+	// File is the path of the TIFF file on the Asterisk server from which the
+	// fax is sent or to which it is received
+	File string `json:"file"`
+
+	// Options is the option string passed to SendFAX or ReceiveFAX (e.g. "f"
+	// to allow audio fallback)
+	Options string `json:"options,omitempty"`
+
+	// LocalStationID is the local station identifier to report
+	LocalStationID string `json:"local_station_id,omitempty"`
+
+	// HeaderInfo is the header information placed on sent pages
+	HeaderInfo string `json:"header_info,omitempty"`
+}
+
 // MailboxUpdate describes the request for updating a mailbox
 type MailboxUpdate struct {
 	// New is the number of New (unread) messages in the mailbox
@@ -344,9 +946,33 @@ type MailboxUpdate struct {
 	Old int `json:"old"`
 }
 
+// Page describes a request to page (intercom) a set of endpoints from the
+// channel of the request key.  The paged endpoints hear the paging channel
+// but cannot be heard.
+type Page struct {
+	// Endpoints is the list of endpoints to page (e.g. "PJSIP/101")
+	Endpoints []string `json:"endpoints"`
+
+	// CallerID is the caller ID presented to the paged endpoints
+	CallerID string `json:"caller_id,omitempty"`
+
+	// Headers is the set of channel variables used to request auto-answer
+	// from the paged devices.  If nil, the server's defaults (Alert-Info and
+	// Call-Info headers for PJSIP) are used.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Timeout is the maximum time to wait for each endpoint to answer
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// MaxDuration is the maximum duration of the page, after which it is torn down
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+}
+
 // PlaybackControl describes the request for performing a playback command
 type PlaybackControl struct {
-	// Command is the playback control command to run
+	// Command is the playback control command to run (restart, pause,
+	// unpause, reverse, or forward).  A playback is stopped by a PlaybackStop
+	// request rather than by a control command.
 	Command string `json:"command"`
 }
 
@@ -362,6 +988,17 @@ type SoundList struct {
 	Filters map[string]string `json:"filters"`
 }
 
+// Voicemail describes a request of the voicemail module (VoicemailDeposit,
+// VoicemailRetrieve, or VoicemailList)
+type Voicemail struct {
+	// Mailbox is the mailbox identifier (e.g. "1000@default")
+	Mailbox string `json:"mailbox"`
+
+	// Greeting is the media URI of the greeting to play before depositing a
+	// message.  If empty, the server's default greeting is used.
+	Greeting string `json:"greeting,omitempty"`
+}
+
 // AsteriskConfig describes the request relating to asterisk configuration
 type AsteriskConfig struct {
 	// Tuples is the list of configuration tuples to update
@@ -0,0 +1,17 @@
+package proxy
+
+import "time"
+
+// WatchKey is the ari.Key kind of watches
+const WatchKey = "watch"
+
+// Watch describes a request to be notified of the changes of the data of a
+// channel or bridge.  Instead of polling the entity's data, the watcher
+// receives an EntityChanged event with the changed fields whenever an event
+// of the entity changes its data.  A watch which is not renewed expires after
+// its TTL.
+type Watch struct {
+	// TTL is the duration after which the watch expires unless it is renewed.
+	// It defaults to five minutes.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
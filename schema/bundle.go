@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// Bundle returns the schema document of the protocol.  Its definitions
+// describe the Request, Response, and Announcement messages, the proxy events
+// (as "event.<Type>"), and the request of each Kind (as "kind.<Kind>"), whose
+// payload properties are given, by Request field name, in payloads (see
+// KindPayloads).
+func Bundle(payloads map[string][]string) *Schema {
+	g := NewGenerator()
+
+	requestType := reflect.TypeOf(proxy.Request{})
+
+	doc := &Schema{
+		Schema:      Draft,
+		Title:       "ari-proxy protocol",
+		Description: "Messages of the ari-proxy NATS protocol",
+	}
+	defs := map[string]*Schema{
+		"request":      g.For(requestType),
+		"response":     g.For(reflect.TypeOf(proxy.Response{})),
+		"announcement": g.For(reflect.TypeOf(proxy.Announcement{})),
+	}
+
+	for _, typ := range proxy.EventTypes() {
+		e, _ := proxy.NewEvent(typ)
+		defs["event."+typ] = g.For(reflect.TypeOf(e))
+	}
+
+	kinds := make([]string, 0, len(payloads))
+	for kind := range payloads {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		props := map[string]*Schema{
+			"kind": {Type: "string", Enum: []string{kind}},
+		}
+		for _, name := range payloads[kind] {
+			f, ok := requestType.FieldByName(name)
+			if !ok || name == "Kind" || name == "Key" {
+				continue
+			}
+			props[jsonName(f)] = g.For(f.Type)
+		}
+		defs["kind."+kind] = &Schema{
+			AllOf: []*Schema{
+				Ref("request"),
+				{Type: "object", Properties: props},
+			},
+		}
+	}
+
+	for name, s := range g.Definitions {
+		defs[name] = s
+	}
+	doc.Definitions = defs
+	return doc
+}
+
+// Marshal returns the indented JSON encoding of the schema
+func Marshal(s *Schema) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,40 @@
+// Command gen generates the JSON Schema bundle of the ari-proxy protocol
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/schema"
+)
+
+func main() {
+	out := flag.String("o", "", "output file (default stdout)")
+	serverDir := flag.String("server", "../server", "directory of the server package source")
+	flag.Parse()
+
+	if err := run(*out, *serverDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(out, serverDir string) error {
+	payloads, err := schema.KindPayloads(serverDir)
+	if err != nil {
+		return err
+	}
+
+	data, err := schema.Marshal(schema.Bundle(payloads))
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(out, data, 0644)
+}
@@ -0,0 +1,151 @@
+package schema
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// KindPayloads determines, from the source of the server package in the
+// given directory, the Request fields which the handler of each request Kind
+// reads.  The handler of each Kind is found in dispatchRequest, and the
+// fields are those selected from its request argument, including within the
+// server methods to which it passes the request.
+func KindPayloads(dir string) (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	methods := make(map[string]*ast.FuncDecl)
+	for _, fn := range files {
+		if matched, _ := filepath.Match("*_test.go", filepath.Base(fn)); matched {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fn, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv != nil {
+				methods[fd.Name.Name] = fd
+			}
+		}
+	}
+
+	dispatch, ok := methods["dispatchRequest"]
+	if !ok {
+		return make(map[string][]string), nil
+	}
+
+	ret := make(map[string][]string)
+	for _, stmt := range caseClauses(dispatch) {
+		kind, handler := dispatchCase(stmt)
+		if kind == "" {
+			continue
+		}
+		fields := make(map[string]bool)
+		collectFields(methods, handler, fields, make(map[string]bool))
+
+		list := make([]string, 0, len(fields))
+		for f := range fields {
+			list = append(list, f)
+		}
+		sort.Strings(list)
+		ret[kind] = list
+	}
+	return ret, nil
+}
+
+func caseClauses(fd *ast.FuncDecl) (ret []*ast.CaseClause) {
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if c, ok := n.(*ast.CaseClause); ok {
+			ret = append(ret, c)
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// dispatchCase returns the Kind and handler method name of a dispatch case of
+// the form `case "Kind": f = s.handler`
+func dispatchCase(c *ast.CaseClause) (kind, handler string) {
+	if len(c.List) != 1 || len(c.Body) != 1 {
+		return "", ""
+	}
+	lit, ok := c.List[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", ""
+	}
+	assign, ok := c.Body[0].(*ast.AssignStmt)
+	if !ok || len(assign.Rhs) != 1 {
+		return "", ""
+	}
+	sel, ok := assign.Rhs[0].(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	kind, _ = strconv.Unquote(lit.Value)
+	return kind, sel.Sel.Name
+}
+
+// collectFields adds the fields selected from the `req` parameter of the
+// given method, following the server methods to which it passes `req`
+func collectFields(methods map[string]*ast.FuncDecl, name string, fields, visited map[string]bool) {
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+
+	fd, ok := methods[name]
+	if !ok {
+		return
+	}
+	param := requestParam(fd)
+	if param == "" {
+		return
+	}
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := v.X.(*ast.Ident); ok && id.Name == param {
+				fields[v.Sel.Name] = true
+			}
+		case *ast.CallExpr:
+			sel, ok := v.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			for _, arg := range v.Args {
+				if id, ok := arg.(*ast.Ident); ok && id.Name == param {
+					collectFields(methods, sel.Sel.Name, fields, visited)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// requestParam returns the name of the *proxy.Request parameter of a method
+func requestParam(fd *ast.FuncDecl) string {
+	for _, p := range fd.Type.Params.List {
+		star, ok := p.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		sel, ok := star.X.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Request" {
+			continue
+		}
+		if len(p.Names) > 0 {
+			return p.Names[0].Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+// Package schema generates JSON Schema (draft-07) documents describing the
+// messages of the ari-proxy NATS protocol from their Go types, so that
+// clients in other languages may validate and generate their messages.
+//
+// The generated bundle of the current protocol is committed as
+// ari-proxy.schema.json; regenerate it with `go generate ./schema` after
+// changing the proxy types.
+package schema
+
+//go:generate go run ./gen -o ari-proxy.schema.json
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// Draft is the JSON Schema draft of the generated schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Encoding    string             `json:"contentEncoding,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	AllOf       []*Schema          `json:"allOf,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Additional  *Schema            `json:"additionalProperties,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// overrides are the schemas of the types whose JSON encoding differs from
+// their Go structure
+var overrides = map[reflect.Type]*Schema{
+	reflect.TypeOf(time.Time{}):          {Type: "string", Format: "date-time"},
+	reflect.TypeOf(time.Duration(0)):     {Type: "integer", Description: "duration in nanoseconds"},
+	reflect.TypeOf(ari.DateTime{}):       {Type: "string", Format: "date-time"},
+	reflect.TypeOf(ari.DurationSec(0)):   {Type: "integer", Description: "duration in seconds"},
+	reflect.TypeOf(json.RawMessage{}):    {Description: "any JSON value"},
+	reflect.TypeOf([]byte{}):             {Type: "string", Encoding: "base64"},
+	reflect.TypeOf((*error)(nil)).Elem(): {Type: "string"},
+
+	// The protobuf timestamp of ari.ChannelData is encoded in ARI's date format
+	reflect.TypeOf(ari.ChannelData{}.Creationtime).Elem(): {Type: "string", Format: "date-time"},
+}
+
+// Generator generates the schemas of Go types, collecting the definitions of
+// the named struct types which they reference
+type Generator struct {
+	// Definitions are the schemas of the named struct types, indexed by
+	// qualified name (e.g. "proxy.Request")
+	Definitions map[string]*Schema
+}
+
+// NewGenerator returns a new Generator
+func NewGenerator() *Generator {
+	return &Generator{
+		Definitions: make(map[string]*Schema),
+	}
+}
+
+// Ref returns a reference to the definition of the given named struct type
+// (e.g. "proxy.Request")
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/definitions/" + name}
+}
+
+// Name returns the qualified name of a named type (e.g. "proxy.Request")
+func Name(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if strings.HasPrefix(pkg, "v") && len(pkg) > 1 && pkg[1] >= '0' && pkg[1] <= '9' {
+		// Major version suffix of a module path (e.g. ari/v5)
+		p := strings.TrimSuffix(t.PkgPath(), "/"+pkg)
+		pkg = p[strings.LastIndex(p, "/")+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+// For returns the schema of the given Go type
+func (g *Generator) For(t reflect.Type) *Schema {
+	if s, ok := overrides[t]; ok {
+		c := *s
+		return &c
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.For(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.For(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", Additional: g.For(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := Name(t)
+		if _, ok := g.Definitions[name]; !ok {
+			// Reserve the name before descending, for recursive types
+			g.Definitions[name] = nil
+			g.Definitions[name] = g.structSchema(t)
+		}
+		return Ref(name)
+	default:
+		// interface{} and other dynamic values
+		return &Schema{}
+	}
+}
+
+// structSchema returns the schema of the JSON object encoding of a struct
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	g.addFields(s, t)
+	return s
+}
+
+// addFields adds the JSON properties of the fields of a struct, flattening
+// embedded structs as encoding/json does
+func (g *Generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.For(f.Type)
+	}
+}
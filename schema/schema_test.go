@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestFor(t *testing.T) {
+	g := NewGenerator()
+
+	s := g.For(reflect.TypeOf(proxy.Watch{}))
+	if s.Ref != "#/definitions/proxy.Watch" {
+		t.Fatalf("unexpected reference %q", s.Ref)
+	}
+	ttl := g.Definitions["proxy.Watch"].Properties["ttl"]
+	if ttl == nil || ttl.Type != "integer" {
+		t.Errorf("unexpected ttl schema: %+v", ttl)
+	}
+
+	// Embedded event data is flattened
+	g.For(reflect.TypeOf(proxy.HoldStateChanged{}))
+	props := g.Definitions["proxy.HoldStateChanged"].Properties
+	if props["type"] == nil || props["channel_id"] == nil {
+		t.Errorf("event properties missing: %v", props)
+	}
+	if _, ok := props["Header"]; ok {
+		t.Error("excluded field present")
+	}
+}
+
+func TestKindPayloads(t *testing.T) {
+	payloads, err := KindPayloads("../server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !contains(payloads["ChannelDial"], "ChannelDial") {
+		t.Errorf("ChannelDial payload not found: %v", payloads["ChannelDial"])
+	}
+	if !contains(payloads["ChannelList"], "Pagination") {
+		t.Errorf("pagination of list requests not found: %v", payloads["ChannelList"])
+	}
+}
+
+// TestBundleUpToDate verifies that the committed schema bundle matches the
+// current types; run `go generate ./schema` to update it
+func TestBundleUpToDate(t *testing.T) {
+	payloads, err := KindPayloads("../server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(Bundle(payloads))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	committed, err := ioutil.ReadFile("ari-proxy.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, committed) {
+		t.Error("ari-proxy.schema.json is out of date; run `go generate ./schema`")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// AMDUserEvent is the name of the user event by which the AMD dialplan
+// reports its classification
+const AMDUserEvent = "AriProxyAMD"
+
+// DefaultAMDTimeout is the default maximum time to wait for a classification
+var DefaultAMDTimeout = 30 * time.Second
+
+// AMDDetector classifies the party which answered a channel as a human or a
+// machine.  Detectors are given the native ARI client, so that they may, for
+// instance, snoop the channel's audio and pass it to an external classifier.
+// The context is closed when the detection times out.
+type AMDDetector interface {
+	Detect(ctx context.Context, client ari.Client, key *ari.Key, opts *proxy.ChannelAMD) (*proxy.AMDResult, error)
+}
+
+// AMDDetectorFunc is a function which implements AMDDetector
+type AMDDetectorFunc func(ctx context.Context, client ari.Client, key *ari.Key, opts *proxy.ChannelAMD) (*proxy.AMDResult, error)
+
+// Detect implements AMDDetector
+func (f AMDDetectorFunc) Detect(ctx context.Context, client ari.Client, key *ari.Key, opts *proxy.ChannelAMD) (*proxy.AMDResult, error) {
+	return f(ctx, client, key, opts)
+}
+
+// DialplanAMD is an AMDDetector which runs the Asterisk AMD dialplan
+// application.  The channel is continued into a dialplan context which runs
+// AMD, reports the result with a user event, and returns the channel to the
+// ARI application, such as:
+//
+//   [ari-proxy-amd]
+//   exten => s,1,AMD(${ARI_PROXY_AMD_OPTIONS})
+//    same => n,UserEvent(AriProxyAMD,status:${AMDSTATUS},cause:${AMDCAUSE})
+//    same => n,Stasis(${ARI_PROXY_AMD_APP})
+//
+// The detection completes once the channel has returned to the application.
+type DialplanAMD struct {
+	// Context is the dialplan context which runs AMD.  It defaults to
+	// "ari-proxy-amd".
+	Context string `mapstructure:"context"`
+}
+
+// Detect implements AMDDetector
+func (d *DialplanAMD) Detect(ctx context.Context, client ari.Client, key *ari.Key, opts *proxy.ChannelAMD) (*proxy.AMDResult, error) {
+	amdContext := d.Context
+	if amdContext == "" {
+		amdContext = "ari-proxy-amd"
+	}
+
+	app := client.ApplicationName()
+
+	// Keep receiving the channel's events once it leaves the application so
+	// that the result user event is delivered
+	if err := client.Application().Subscribe(ari.NewKey(ari.ApplicationKey, app), "channel:"+key.ID); err != nil {
+		return nil, eris.Wrap(err, "failed to subscribe to channel")
+	}
+
+	sub := client.Bus().Subscribe(ari.NewKey(ari.ChannelKey, key.ID), ari.Events.ChannelUserevent, ari.Events.StasisStart, ari.Events.ChannelDestroyed)
+	defer sub.Cancel()
+
+	vars := map[string]string{
+		"ARI_PROXY_AMD_APP":     app,
+		"ARI_PROXY_AMD_OPTIONS": opts.Options,
+	}
+	for k, v := range vars {
+		if err := client.Channel().SetVariable(key, k, v); err != nil {
+			return nil, eris.Wrapf(err, "failed to set %s", k)
+		}
+	}
+
+	if err := client.Channel().Continue(key, amdContext, "s", 1); err != nil {
+		return nil, eris.Wrap(err, "failed to start AMD")
+	}
+
+	var result *proxy.AMDResult
+	for {
+		select {
+		case <-ctx.Done():
+			if result != nil {
+				return result, eris.New("timed out waiting for the channel to return to the application")
+			}
+			return nil, eris.New("timed out waiting for AMD result")
+		case e, ok := <-sub.Events():
+			if !ok {
+				return result, eris.New("subscription closed")
+			}
+			switch v := e.(type) {
+			case *ari.ChannelUserevent:
+				if v.Eventname == AMDUserEvent && result == nil {
+					result = parseAMDResult(v.Userevent)
+				}
+			case *ari.StasisStart:
+				if result != nil {
+					return result, nil
+				}
+			case *ari.ChannelDestroyed:
+				return &proxy.AMDResult{Status: proxy.AMDHangup}, nil
+			}
+		}
+	}
+}
+
+// parseAMDResult converts the data of the AMD user event into an AMDResult
+func parseAMDResult(data interface{}) *proxy.AMDResult {
+	ret := &proxy.AMDResult{
+		Status: proxy.AMDNotSure,
+	}
+
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return ret
+	}
+
+	if v, ok := m["status"]; ok && v != nil {
+		switch status := strings.ToUpper(fmt.Sprint(v)); status {
+		case proxy.AMDHuman, proxy.AMDMachine, proxy.AMDHangup:
+			ret.Status = status
+		}
+	}
+	if v, ok := m["cause"]; ok && v != nil {
+		ret.Cause = fmt.Sprint(v)
+	}
+	return ret
+}
+
+func (s *Server) channelAMD(ctx context.Context, reply string, req *proxy.Request) {
+	if s.AMD == nil {
+		s.sendError(reply, eris.New("answering machine detection is not enabled"))
+		return
+	}
+
+	opts := req.ChannelAMD
+	if opts == nil {
+		opts = new(proxy.ChannelAMD)
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	s.sendError(reply, nil)
+
+	go s.publishEvent(s.detectAMD(ctx, req.Key, opts))
+}
+
+// detectAMD runs the configured AMDDetector on the channel and returns the
+// resulting AMDFinished event.  Detection errors are reported on the event,
+// with the status NOTSURE if no classification was made.
+func (s *Server) detectAMD(ctx context.Context, key *ari.Key, opts *proxy.ChannelAMD) *proxy.AMDFinished {
+	timeout := DefaultAMDTimeout
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ev := &proxy.AMDFinished{
+		EventData: s.newEventData(proxy.EventAMDFinished),
+		ChannelID: key.ID,
+	}
+
+	res, err := s.AMD.Detect(ctx, s.ari, key, opts)
+	if res != nil {
+		ev.AMDResult = *res
+	}
+	if err != nil {
+		s.Log.Warn("answering machine detection failed", "channel", key.ID, "error", err)
+		ev.Error = err.Error()
+	}
+	if ev.Status == "" {
+		ev.Status = proxy.AMDNotSure
+	}
+
+	return ev
+}
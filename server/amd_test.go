@@ -0,0 +1,28 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestParseAMDResult(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"status":"MACHINE","cause":"LONGGREETING-1600-1500"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	res := parseAMDResult(data)
+	if res.Status != proxy.AMDMachine || res.Cause != "LONGGREETING-1600-1500" {
+		t.Errorf("unexpected AMD result: %+v", res)
+	}
+
+	if res = parseAMDResult(map[string]interface{}{"status": "bogus"}); res.Status != proxy.AMDNotSure {
+		t.Errorf("expected NOTSURE for unknown status, got %+v", res)
+	}
+
+	if res = parseAMDResult(nil); res.Status != proxy.AMDNotSure {
+		t.Errorf("expected NOTSURE for missing result, got %+v", res)
+	}
+}
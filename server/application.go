@@ -29,9 +29,7 @@ func (s *Server) applicationList(ctx context.Context, reply string, req *proxy.R
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) applicationGet(ctx context.Context, reply string, req *proxy.Request) {
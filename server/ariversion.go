@@ -0,0 +1,130 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// kindARIVersions maps the request Kinds whose ARI operations were introduced
+// after the first version of ARI to the earliest ARI version which provides
+// them.  Each version is that of the first major release of Asterisk which
+// carried the operation, so that older releases are reliably excluded.
+var kindARIVersions = map[string]ariVersion{
+	"AsteriskConfigData":        {1, 8, 0},
+	"AsteriskConfigDelete":      {1, 8, 0},
+	"AsteriskConfigUpdate":      {1, 8, 0},
+	"AsteriskLoggingCreate":     {1, 9, 0},
+	"AsteriskLoggingData":       {1, 9, 0},
+	"AsteriskLoggingDelete":     {1, 9, 0},
+	"AsteriskLoggingGet":        {1, 9, 0},
+	"AsteriskLoggingList":       {1, 9, 0},
+	"AsteriskLoggingRotate":     {1, 9, 0},
+	"AsteriskModuleData":        {1, 8, 0},
+	"AsteriskModuleGet":         {1, 8, 0},
+	"AsteriskModuleList":        {1, 8, 0},
+	"AsteriskModuleLoad":        {1, 8, 0},
+	"AsteriskModuleReload":      {1, 8, 0},
+	"AsteriskModuleUnload":      {1, 8, 0},
+	"BridgeVideoSource":         {2, 0, 0},
+	"BridgeVideoSourceDelete":   {2, 0, 0},
+	"ChannelCreate":             {2, 0, 0},
+	"ChannelDial":               {2, 0, 0},
+	"ChannelExternalMedia":      {5, 0, 0},
+	"ChannelMove":               {7, 0, 0},
+	"ChannelRTPStatistics":      {7, 0, 0},
+	"ChannelStageExternalMedia": {5, 0, 0},
+}
+
+// ariVersion is a parsed ARI version, as major, minor and patch numbers
+type ariVersion [3]int
+
+// parseARIVersion parses an ARI version, such as "5.0.0".  Missing minor and
+// patch numbers are zero.
+func parseARIVersion(s string) (v ariVersion, err error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) > len(v) {
+		return v, eris.Errorf("invalid ARI version %q", s)
+	}
+	for i, p := range parts {
+		if v[i], err = strconv.Atoi(p); err != nil || v[i] < 0 {
+			return ariVersion{}, eris.Errorf("invalid ARI version %q", s)
+		}
+	}
+	return v, nil
+}
+
+// less indicates whether the version precedes the other
+func (v ariVersion) less(o ariVersion) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+func (v ariVersion) String() string {
+	return strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1]) + "." + strconv.Itoa(v[2])
+}
+
+// detectARIVersion determines the ARI version of Asterisk, unless it was
+// configured.  If it cannot be determined, every request Kind is passed
+// through to Asterisk.
+func (s *Server) detectARIVersion() {
+	if s.ARIVersion == "" {
+		v, err := s.rest.apiVersion()
+		if err != nil {
+			s.Log.Warn("failed to detect ARI version; operations will not be gated", "error", err)
+			return
+		}
+		s.ARIVersion = v
+	}
+
+	v, err := parseARIVersion(s.ARIVersion)
+	if err != nil {
+		s.Log.Warn("failed to parse ARI version; operations will not be gated", "error", err)
+		return
+	}
+	s.ariVersion = &v
+
+	s.Log.Info("detected ARI version", "version", s.ARIVersion, "unsupported", s.unsupportedKinds())
+}
+
+// supportedByAsterisk indicates whether the ARI version of Asterisk provides
+// the operation of the given request Kind.  Kinds are supported if the
+// version is unknown.
+func (s *Server) supportedByAsterisk(kind string) bool {
+	if s.ariVersion == nil {
+		return true
+	}
+	min, ok := kindARIVersions[kind]
+	return !ok || !s.ariVersion.less(min)
+}
+
+// unsupportedKinds returns the sorted list of the supported request Kinds
+// which the ARI version of Asterisk does not provide
+func (s *Server) unsupportedKinds() (ret []string) {
+	for _, k := range SupportedKinds {
+		if !s.supportedByAsterisk(k) {
+			ret = append(ret, k)
+		}
+	}
+	return
+}
+
+// announcedKinds returns the request Kinds which the server announces: those
+// which it handles and which the ARI version of Asterisk provides
+func (s *Server) announcedKinds() []string {
+	if s.ariVersion == nil {
+		return SupportedKinds
+	}
+	ret := make([]string, 0, len(SupportedKinds))
+	for _, k := range SupportedKinds {
+		if s.supportedByAsterisk(k) {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/inconshreveable/log15"
+)
+
+func TestParseARIVersion(t *testing.T) {
+	for in, want := range map[string]ariVersion{
+		"5.0.0": {5, 0, 0},
+		"1.10":  {1, 10, 0},
+		"2":     {2, 0, 0},
+	} {
+		v, err := parseARIVersion(in)
+		if err != nil || v != want {
+			t.Errorf("%q: got %v, %v", in, v, err)
+		}
+	}
+	for _, in := range []string{"", "five", "1.2.3.4", "1.-1"} {
+		if _, err := parseARIVersion(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+	if !(ariVersion{1, 9, 0}).less(ariVersion{1, 10, 0}) || (ariVersion{2, 0, 0}).less(ariVersion{1, 10, 0}) {
+		t.Error("unexpected ordering")
+	}
+}
+
+func TestKindARIVersions(t *testing.T) {
+	for k := range kindARIVersions {
+		if !isSupportedKind(k) {
+			t.Errorf("gated kind %q is not supported", k)
+		}
+	}
+}
+
+func TestSupportedByAsterisk(t *testing.T) {
+	log := log15.New()
+	log.SetHandler(log15.DiscardHandler())
+
+	// Without a known version, nothing is gated
+	s := &Server{Log: log}
+	s.detectARIVersion()
+	if !s.supportedByAsterisk("ChannelExternalMedia") || len(s.announcedKinds()) != len(SupportedKinds) {
+		t.Error("gated kinds of unknown version")
+	}
+
+	s = &Server{Log: log, ARIVersion: "1.10.0"}
+	s.detectARIVersion()
+	if s.supportedByAsterisk("ChannelCreate") || s.supportedByAsterisk("ChannelExternalMedia") {
+		t.Error("newer operations supported by ARI 1.10.0")
+	}
+	if !s.supportedByAsterisk("AsteriskLoggingList") || !s.supportedByAsterisk("ChannelAnswer") {
+		t.Error("older operations unsupported by ARI 1.10.0")
+	}
+	kinds := s.announcedKinds()
+	if len(kinds)+len(s.unsupportedKinds()) != len(SupportedKinds) {
+		t.Errorf("announced %d kinds, %d unsupported, of %d", len(kinds), len(s.unsupportedKinds()), len(SupportedKinds))
+	}
+	for _, k := range kinds {
+		if k == "ChannelDial" {
+			t.Error("announced unsupported kind")
+		}
+	}
+}
+
+func TestARIRESTAPIVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ari/api-docs/resources.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"apiVersion":"4.1.3","swaggerVersion":"1.1"}`)) // nolint: errcheck
+	}))
+	defer srv.Close()
+
+	v, err := newARIREST(&native.Options{URL: srv.URL + "/ari"}).apiVersion()
+	if err != nil || v != "4.1.3" {
+		t.Errorf("got %q, %v", v, err)
+	}
+}
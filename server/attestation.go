@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// attachAttestation reads the STIR/SHAKEN information of an inbound PJSIP
+// call entering the application and attaches the normalized result to the
+// channel variables of its StasisStart event (see proxy.GetAttestation).  It
+// is run off the event loop, by prepareStart, since reading the information
+// takes several ARI requests.
+//
+// The verification results of Asterisk's res_stir_shaken are preferred.  If
+// those are unavailable, the SIP Identity header is read and decoded, but its
+// signature is not verified.
+func (s *Server) attachAttestation(e *ari.StasisStart) {
+	if !s.StirShaken || !isPJSIPChannel(e.Channel) {
+		return
+	}
+
+	key := ari.NewKey(ari.ChannelKey, e.Channel.ID)
+	get := func(name string) string {
+		v, err := s.ari.Channel().GetVariable(key, name)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(v)
+	}
+
+	a := &proxy.Attestation{
+		Result: proxy.AttestationNotPresent,
+	}
+
+	if count := get("STIR_SHAKEN(count)"); count != "" && count != "0" {
+		a.Level = normalizeAttestationLevel(get("STIR_SHAKEN(0,attestation)"))
+		a.Result = normalizeVerifyResult(get("STIR_SHAKEN(0,verify_result)"))
+		a.Orig = get("STIR_SHAKEN(0,identity)")
+	} else if hdr := get("PJSIP_HEADER(read,Identity)"); hdr != "" {
+		parsed, err := parseIdentityHeader(hdr)
+		if err != nil {
+			s.Log.Debug("failed to parse Identity header", "channel", e.Channel.ID, "error", err)
+		} else {
+			a = parsed
+		}
+	}
+
+	proxy.SetAttestation(&e.Channel, a)
+}
+
+// isPJSIPChannel indicates whether the channel is a PJSIP channel, the only
+// kind which carries STIR/SHAKEN information
+func isPJSIPChannel(ch ari.ChannelData) bool {
+	return strings.HasPrefix(ch.Name, "PJSIP/")
+}
+
+// passport is the subset of the claims of a SHAKEN PASSporT which is surfaced
+// to applications
+type passport struct {
+	Attest string `json:"attest"`
+	Orig   struct {
+		TN string `json:"tn"`
+	} `json:"orig"`
+	Dest struct {
+		TN []string `json:"tn"`
+	} `json:"dest"`
+}
+
+// parseIdentityHeader decodes the PASSporT claims of a SIP Identity header
+// (RFC 8224).  The signature is not verified, so the result is marked
+// unverified.
+func parseIdentityHeader(hdr string) (*proxy.Attestation, error) {
+	token := strings.TrimSpace(strings.SplitN(hdr, ";", 2)[0])
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, eris.New("Identity header is not a compact JWS")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to decode PASSporT payload")
+	}
+
+	var p passport
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, eris.Wrap(err, "failed to parse PASSporT claims")
+	}
+
+	return &proxy.Attestation{
+		Level:  normalizeAttestationLevel(p.Attest),
+		Result: proxy.AttestationUnverified,
+		Orig:   p.Orig.TN,
+		Dest:   p.Dest.TN,
+	}, nil
+}
+
+func normalizeAttestationLevel(level string) string {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	switch level {
+	case "A", "B", "C":
+		return level
+	default:
+		return ""
+	}
+}
+
+// normalizeVerifyResult maps the verification results reported by
+// res_stir_shaken (e.g. "Verification successful") to an AttestationResult
+func normalizeVerifyResult(result string) proxy.AttestationResult {
+	r := strings.ToLower(result)
+	switch {
+	case r == "":
+		return proxy.AttestationUnverified
+	case strings.Contains(r, "not present"):
+		return proxy.AttestationNotPresent
+	case strings.Contains(r, "success") || r == "passed":
+		return proxy.AttestationVerified
+	case strings.Contains(r, "fail"):
+		return proxy.AttestationFailed
+	default:
+		return proxy.AttestationUnverified
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseIdentityHeader(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"attest":"a","orig":{"tn":"15555550100"},"dest":{"tn":["15555550199"]},"iat":1600000000}`))
+	hdr := "eyJhbGciOiJFUzI1NiJ9." + payload + ".c2ln;info=<https://cert.example.com/cert.pem>;alg=ES256;ppt=shaken"
+
+	a, err := parseIdentityHeader(hdr)
+	if err != nil {
+		t.Fatalf("failed to parse Identity header: %s", err)
+	}
+	if a.Level != "A" {
+		t.Errorf("expected level A, got %q", a.Level)
+	}
+	if a.Result != proxy.AttestationUnverified {
+		t.Errorf("expected unverified result, got %q", a.Result)
+	}
+	if a.Orig != "15555550100" || len(a.Dest) != 1 || a.Dest[0] != "15555550199" {
+		t.Errorf("unexpected telephone numbers: %+v", a)
+	}
+	if a.Trusted() {
+		t.Error("unverified attestation should not be trusted")
+	}
+
+	if _, err := parseIdentityHeader("garbage"); err == nil {
+		t.Error("expected error for invalid header")
+	}
+}
+
+func TestNormalizeVerifyResult(t *testing.T) {
+	tests := map[string]proxy.AttestationResult{
+		"Verification successful":   proxy.AttestationVerified,
+		"Verification failed":       proxy.AttestationFailed,
+		"Signature encoding failed": proxy.AttestationFailed,
+		"Verification not present":  proxy.AttestationNotPresent,
+		"":                          proxy.AttestationUnverified,
+	}
+	for in, expected := range tests {
+		if out := normalizeVerifyResult(in); out != expected {
+			t.Errorf("%q: expected %q, got %q", in, expected, out)
+		}
+	}
+}
+
+func TestAttachAttestation(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+
+	ch := new(arimocks.Channel)
+	ch.On("GetVariable", key, "STIR_SHAKEN(count)").Return("1", nil)
+	ch.On("GetVariable", key, "STIR_SHAKEN(0,attestation)").Return("A", nil)
+	ch.On("GetVariable", key, "STIR_SHAKEN(0,verify_result)").Return("Verification successful", nil)
+	ch.On("GetVariable", key, "STIR_SHAKEN(0,identity)").Return("15555550100", nil)
+
+	cl := new(arimocks.Client)
+	cl.On("Channel").Return(ch)
+
+	s := &Server{StirShaken: true, ari: cl}
+	if !s.preparesStarts() {
+		t.Fatal("StasisStarts not prepared with STIR/SHAKEN")
+	}
+
+	e := &ari.StasisStart{Channel: ari.ChannelData{ID: "c1", Name: "PJSIP/trunk-00000001"}}
+	s.attachAttestation(e)
+	if a := proxy.GetAttestation(&e.Channel); a == nil || a.Level != "A" || a.Orig != "15555550100" {
+		t.Errorf("unexpected attestation: %+v", a)
+	}
+
+	// Only PJSIP channels carry STIR/SHAKEN information
+	e = &ari.StasisStart{Channel: ari.ChannelData{ID: "c2", Name: "Local/100@default-00000001;2"}}
+	s.attachAttestation(e)
+	if a := proxy.GetAttestation(&e.Channel); a != nil {
+		t.Errorf("attestation attached to a Local channel: %+v", a)
+	}
+	ch.AssertNotCalled(t, "GetVariable", ari.NewKey(ari.ChannelKey, "c2"), mock.Anything)
+}
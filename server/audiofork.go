@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+	"golang.org/x/net/websocket"
+)
+
+// AudioForkAppArgs is the application argument of the snoop channels created
+// by audio forks
+const AudioForkAppArgs = "ari-proxy-audio-fork"
+
+// AudioForkConfig describes the configuration of the audio fork module.  An
+// audio fork snoops on a channel and bridges the snoop channel to an external
+// media channel, whose RTP stream is received by the proxy and republished,
+// without the RTP headers, as binary frames on a NATS subject (see
+// proxy.AudioSubject) and, optionally, to WebSocket consumers.
+type AudioForkConfig struct {
+	// RTPAddress is the local IP address on which the RTP streams are
+	// received.  It must be reachable from Asterisk.
+	RTPAddress string `mapstructure:"rtp_address"`
+
+	// WebSocketListen is the address on which to serve WebSocket consumers
+	// (e.g. ":9991" or "unix:/run/ari-proxy/audio.sock").  If empty, audio
+	// is only published over NATS.
+	WebSocketListen string `mapstructure:"websocket_listen"`
+
+	// WebSocketURL is the base URL by which consumers reach the WebSocket
+	// endpoint (e.g. "ws://proxy.example.com:9991").
+	WebSocketURL string `mapstructure:"websocket_url"`
+}
+
+// audioFork is a stream of a channel's audio
+type audioFork struct {
+	id      string
+	token   string
+	channel string
+
+	conn *net.UDPConn
+
+	snoop  *ari.Key
+	media  *ari.Key
+	bridge *ari.Key
+
+	consumers map[chan []byte]struct{}
+
+	stopOnce sync.Once
+	mu       sync.Mutex
+}
+
+func (f *audioFork) addConsumer() chan []byte {
+	ch := make(chan []byte, 50)
+
+	f.mu.Lock()
+	if f.consumers == nil {
+		f.consumers = make(map[chan []byte]struct{})
+	}
+	f.consumers[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch
+}
+
+func (f *audioFork) removeConsumer(ch chan []byte) {
+	f.mu.Lock()
+	if _, ok := f.consumers[ch]; ok {
+		delete(f.consumers, ch)
+		close(ch)
+	}
+	f.mu.Unlock()
+}
+
+// deliver sends a frame to the WebSocket consumers, dropping it for any
+// consumer which is not keeping up
+func (f *audioFork) deliver(frame []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.consumers {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+func (f *audioFork) closeConsumers() {
+	f.mu.Lock()
+	for ch := range f.consumers {
+		close(ch)
+	}
+	f.consumers = nil
+	f.mu.Unlock()
+}
+
+// audioForkSet is the set of audio forks in progress
+type audioForkSet struct {
+	m  map[string]*audioFork
+	mu sync.RWMutex
+}
+
+func (fs *audioForkSet) add(f *audioFork) {
+	fs.mu.Lock()
+	if fs.m == nil {
+		fs.m = make(map[string]*audioFork)
+	}
+	fs.m[f.id] = f
+	fs.mu.Unlock()
+}
+
+func (fs *audioForkSet) get(id string) (*audioFork, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	f, ok := fs.m[id]
+	return f, ok
+}
+
+func (fs *audioForkSet) remove(id string) {
+	fs.mu.Lock()
+	delete(fs.m, id)
+	fs.mu.Unlock()
+}
+
+// rtpPayload returns the payload of an RTP packet
+func rtpPayload(pkt []byte) ([]byte, bool) {
+	if len(pkt) < 12 || pkt[0]>>6 != 2 {
+		return nil, false
+	}
+
+	n := 12 + int(pkt[0]&0x0f)*4
+	if pkt[0]&0x10 != 0 {
+		// Header extension
+		if len(pkt) < n+4 {
+			return nil, false
+		}
+		n += 4 + int(binary.BigEndian.Uint16(pkt[n+2:]))*4
+	}
+
+	end := len(pkt)
+	if pkt[0]&0x20 != 0 && end > 0 {
+		// Padding
+		end -= int(pkt[end-1])
+	}
+	if n > end {
+		return nil, false
+	}
+	return pkt[n:end], true
+}
+
+func (s *Server) audioForkStart(ctx context.Context, reply string, req *proxy.Request) {
+	if !withAudioFork {
+		s.sendError(reply, errExcluded(SubsystemAudioFork))
+		return
+	}
+	if s.AudioFork == nil {
+		s.sendError(reply, eris.New("audio fork module is not enabled"))
+		return
+	}
+
+	rtpIP := net.ParseIP(s.AudioFork.RTPAddress)
+	if rtpIP == nil {
+		s.sendError(reply, eris.New("audio fork module requires an RTP address"))
+		return
+	}
+
+	opts := req.AudioFork
+	if opts == nil {
+		opts = new(proxy.AudioFork)
+	}
+	direction := opts.Direction
+	if direction == "" {
+		direction = ari.DirectionBoth
+	}
+	format := opts.Format
+	if format == "" {
+		format = "slin16"
+	}
+
+	token, err := newToken()
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: rtpIP})
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to listen for RTP"))
+		return
+	}
+
+	f := &audioFork{
+		id:      rid.New("af"),
+		token:   token,
+		channel: req.Key.ID,
+		conn:    conn,
+	}
+
+	if err = s.setupAudioFork(f, req.Key, direction, format); err != nil {
+		s.teardownAudioFork(f)
+		s.sendError(reply, err)
+		return
+	}
+
+	if req.Key.Dialog != "" {
+		for _, id := range []string{f.snoop.ID, f.media.ID} {
+			s.Dialog.Bind(req.Key.Dialog, "channel", id)
+		}
+	}
+
+	s.forks.add(f)
+
+	go s.runAudioFork(ctx, f)
+
+	data := &proxy.AudioForkData{
+		ID:        f.id,
+		ChannelID: f.channel,
+		Format:    format,
+		Subject:   s.Subjects.Audio(f.id),
+	}
+	if s.AudioFork.WebSocketURL != "" {
+		data.URL = strings.TrimSuffix(s.AudioFork.WebSocketURL, "/") + "/audio/" + f.id + "?token=" + f.token
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: ari.NewKey(proxy.AudioForkKey, f.id, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+		Data: &proxy.EntityData{
+			AudioFork: data,
+		},
+	})
+}
+
+// setupAudioFork creates the snoop channel, the external media channel, and
+// the bridge which joins them
+func (s *Server) setupAudioFork(f *audioFork, key *ari.Key, direction ari.Direction, format string) error {
+	snoop, err := s.ari.Channel().Snoop(key, rid.New(rid.Snoop), &ari.SnoopOptions{
+		App:     s.Application,
+		AppArgs: AudioForkAppArgs,
+		Spy:     direction,
+	})
+	if err != nil {
+		return eris.Wrap(err, "failed to snoop channel")
+	}
+	f.snoop = snoop.Key()
+
+	media, err := s.ari.Channel().ExternalMedia(nil, ari.ExternalMediaOptions{
+		ChannelID:    rid.New(rid.Channel),
+		App:          s.Application,
+		ExternalHost: f.conn.LocalAddr().String(),
+		Format:       format,
+		Direction:    "both",
+	})
+	if err != nil {
+		return eris.Wrap(err, "failed to create external media channel")
+	}
+	f.media = media.Key()
+
+	bridge, err := s.ari.Bridge().Create(ari.NewKey(ari.BridgeKey, rid.New(rid.Bridge)), "mixing", "audio-fork-"+f.id)
+	if err != nil {
+		return eris.Wrap(err, "failed to create audio fork bridge")
+	}
+	f.bridge = bridge.Key()
+
+	for _, k := range []*ari.Key{f.snoop, f.media} {
+		if err := s.ari.Bridge().AddChannel(f.bridge, k.ID); err != nil {
+			return eris.Wrap(err, "failed to bridge audio fork channels")
+		}
+	}
+	return nil
+}
+
+// runAudioFork republishes the received audio until the fork is stopped or
+// the forked channel is destroyed
+func (s *Server) runAudioFork(ctx context.Context, f *audioFork) {
+	sub := s.ari.Bus().Subscribe(nil, ari.Events.ChannelDestroyed)
+	defer sub.Cancel()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				s.stopAudioFork(f)
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if v, ok := e.(*ari.ChannelDestroyed); ok && v.Channel.ID == f.channel {
+					s.stopAudioFork(f)
+					return
+				}
+			}
+		}
+	}()
+
+	subject := s.Subjects.Audio(f.id)
+	buf := make([]byte, 2048)
+	for {
+		n, err := f.conn.Read(buf)
+		if err != nil {
+			// The connection is closed when the fork is stopped
+			s.stopAudioFork(f)
+			return
+		}
+
+		payload, ok := rtpPayload(buf[:n])
+		if !ok || len(payload) == 0 {
+			continue
+		}
+		frame := make([]byte, len(payload))
+		copy(frame, payload)
+
+		if err := s.nats.Conn.Publish(subject, frame); err != nil {
+			s.Log.Debug("failed to publish audio", "fork", f.id, "error", err)
+		}
+		f.deliver(frame)
+	}
+}
+
+// stopAudioFork tears down the audio fork and reports that it has stopped
+func (s *Server) stopAudioFork(f *audioFork) {
+	f.stopOnce.Do(func() {
+		s.forks.remove(f.id)
+		s.teardownAudioFork(f)
+
+		s.publishEvent(&proxy.AudioForkStopped{
+			EventData: s.newEventData(proxy.EventAudioForkStopped),
+			ForkID:    f.id,
+			ChannelID: f.channel,
+		})
+	})
+}
+
+// teardownAudioFork releases the resources of the audio fork
+func (s *Server) teardownAudioFork(f *audioFork) {
+	f.conn.Close() // nolint: errcheck
+
+	for _, k := range []*ari.Key{f.snoop, f.media} {
+		if k != nil {
+			s.ari.Channel().Hangup(k, "normal") // nolint: errcheck
+		}
+	}
+	if f.bridge != nil {
+		s.destroyBridge(f.bridge)
+	}
+
+	f.closeConsumers()
+}
+
+func (s *Server) audioForkStop(ctx context.Context, reply string, req *proxy.Request) {
+	f, ok := s.forks.get(req.Key.ID)
+	if !ok {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+	s.stopAudioFork(f)
+	s.sendError(reply, nil)
+}
+
+// startAudioForkWebSocket starts the WebSocket endpoint of the audio fork
+// module, which is stopped when the context is closed
+func (s *Server) startAudioForkWebSocket(ctx context.Context) error {
+	ln, err := listen(s.AudioFork.WebSocketListen)
+	if err != nil {
+		return eris.Wrap(err, "failed to listen for audio fork consumers")
+	}
+
+	srv := &http.Server{
+		Handler: s.audioForkHandler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close() // nolint: errcheck
+	}()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.Log.Error("audio fork endpoint failed", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// audioForkHandler serves the audio of fork <id> at `/audio/<id>?token=<token>`
+func (s *Server) audioForkHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/audio/", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := s.forks.get(strings.TrimPrefix(r.URL.Path, "/audio/"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(f.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		websocket.Server{
+			Handler: func(ws *websocket.Conn) {
+				ws.PayloadType = websocket.BinaryFrame
+
+				ch := f.addConsumer()
+				defer f.removeConsumer(ch)
+
+				for frame := range ch {
+					if _, err := ws.Write(frame); err != nil {
+						return
+					}
+				}
+			},
+		}.ServeHTTP(w, r)
+	})
+	return mux
+}
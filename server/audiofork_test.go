@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRTPPayload(t *testing.T) {
+	header := []byte{0x80, 0x76, 0x00, 0x01, 0x00, 0x00, 0x00, 0xa0, 0x12, 0x34, 0x56, 0x78}
+	payload := []byte{1, 2, 3, 4}
+
+	if p, ok := rtpPayload(append(header, payload...)); !ok || !bytes.Equal(p, payload) {
+		t.Errorf("unexpected payload: %v (%v)", p, ok)
+	}
+
+	// One CSRC, a one-word header extension, and two bytes of padding
+	pkt := []byte{0xb1, 0x76, 0x00, 0x01, 0x00, 0x00, 0x00, 0xa0, 0x12, 0x34, 0x56, 0x78}
+	pkt = append(pkt, 0xca, 0xfe, 0xca, 0xfe)
+	pkt = append(pkt, 0xbe, 0xde, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00)
+	pkt = append(pkt, payload...)
+	pkt = append(pkt, 0x00, 0x02)
+	if p, ok := rtpPayload(pkt); !ok || !bytes.Equal(p, payload) {
+		t.Errorf("unexpected payload: %v (%v)", p, ok)
+	}
+
+	if _, ok := rtpPayload([]byte{0x80, 0x76}); ok {
+		t.Error("expected failure for short packet")
+	}
+	if _, ok := rtpPayload(append([]byte{0x40}, header[1:]...)); ok {
+		t.Error("expected failure for wrong RTP version")
+	}
+}
+
+func TestAudioForkConsumers(t *testing.T) {
+	f := new(audioFork)
+
+	ch := f.addConsumer()
+	f.deliver([]byte{1})
+	if frame := <-ch; !bytes.Equal(frame, []byte{1}) {
+		t.Errorf("unexpected frame: %v", frame)
+	}
+
+	f.closeConsumers()
+	if _, ok := <-ch; ok {
+		t.Error("consumer should be closed")
+	}
+
+	// Removing a consumer which has already been closed must not panic
+	f.removeConsumer(ch)
+}
+
+func TestAudioForkFlow(t *testing.T) {
+	if !withAudioFork {
+		t.Skip("audio fork subsystem excluded from the build")
+	}
+
+	ft := newFlowTest(t)
+	defer ft.Close()
+	ft.s.AudioFork = &AudioForkConfig{RTPAddress: "127.0.0.1"}
+
+	bridge := new(arimocks.Bridge)
+	ft.client.On("Bridge").Return(bridge)
+
+	var snoopKey, mediaKey, bridgeKey *ari.Key
+	media := make(chan ari.ExternalMediaOptions, 1)
+	ft.channel.On("Snoop", mock.Anything, mock.Anything, mock.Anything).Return(func(key *ari.Key, id string, opts *ari.SnoopOptions) *ari.ChannelHandle {
+		if opts.App != "app" || opts.AppArgs != AudioForkAppArgs || opts.Spy != ari.DirectionIn {
+			t.Errorf("unexpected snoop options: %+v", opts)
+		}
+		snoopKey = ari.NewKey(ari.ChannelKey, id)
+		return ari.NewChannelHandle(snoopKey, ft.channel, nil)
+	}, nil)
+	ft.channel.On("ExternalMedia", mock.Anything, mock.Anything).Return(func(_ *ari.Key, opts ari.ExternalMediaOptions) *ari.ChannelHandle {
+		media <- opts
+		mediaKey = ari.NewKey(ari.ChannelKey, opts.ChannelID)
+		return ari.NewChannelHandle(mediaKey, ft.channel, nil)
+	}, nil)
+	ft.channel.On("Hangup", mock.Anything, "normal").Return(nil)
+	bridge.On("Create", mock.Anything, "mixing", mock.Anything).Return(func(key *ari.Key, _, _ string) *ari.BridgeHandle {
+		bridgeKey = key
+		return ari.NewBridgeHandle(key, bridge, nil)
+	}, nil)
+	bridge.On("AddChannel", mock.Anything, mock.Anything).Return(nil)
+	bridge.On("Delete", mock.Anything).Return(nil)
+
+	resp := ft.request(t, &proxy.Request{
+		Kind:      "AudioForkStart",
+		Key:       ari.NewKey(ari.ChannelKey, "c1"),
+		AudioFork: &proxy.AudioFork{Direction: ari.DirectionIn, Format: "ulaw"},
+	})
+	if resp.Err() != nil || resp.Data == nil || resp.Data.AudioFork == nil {
+		t.Fatalf("unexpected response: %+v (%v)", resp, resp.Err())
+	}
+	data := resp.Data.AudioFork
+	if data.ChannelID != "c1" || data.Format != "ulaw" || data.Subject != ft.s.Subjects.Audio(data.ID) {
+		t.Errorf("unexpected fork: %+v", data)
+	}
+	bridge.AssertCalled(t, "AddChannel", bridgeKey, snoopKey.ID)
+	bridge.AssertCalled(t, "AddChannel", bridgeKey, mediaKey.ID)
+
+	// The RTP stream of the external media channel is republished over NATS
+	// without its header
+	sub, err := ft.nc.SubscribeSync(data.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ft.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	opts := <-media
+	if opts.Format != "ulaw" {
+		t.Errorf("unexpected media format: %s", opts.Format)
+	}
+	conn, err := net.Dial("udp", opts.ExternalHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	header := []byte{0x80, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0xa0, 0x12, 0x34, 0x56, 0x78}
+	if _, err := conn.Write(append(header, 1, 2, 3, 4)); err != nil {
+		t.Fatal(err)
+	}
+	m, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.Data, []byte{1, 2, 3, 4}) {
+		t.Errorf("unexpected audio frame: %v", m.Data)
+	}
+
+	// The fork is torn down with the forked channel
+	ft.send(&ari.ChannelDestroyed{
+		EventData: ari.EventData{Type: ari.Events.ChannelDestroyed},
+		Channel:   ari.ChannelData{ID: "c1"},
+	})
+	e, ok := ft.event(t, proxy.EventAudioForkStopped).(*proxy.AudioForkStopped)
+	if !ok || e.ForkID != data.ID || e.ChannelID != "c1" {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	ft.channel.AssertCalled(t, "Hangup", snoopKey, "normal")
+	ft.channel.AssertCalled(t, "Hangup", mediaKey, "normal")
+	bridge.AssertCalled(t, "Delete", bridgeKey)
+
+	if resp := ft.request(t, &proxy.Request{Kind: "AudioForkStop", Key: ari.NewKey(proxy.AudioForkKey, data.ID)}); resp.Err() == nil {
+		t.Error("stopped fork still found")
+	}
+}
@@ -2,13 +2,38 @@ package server
 
 import (
 	"context"
+	"regexp"
+	"strings"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
 )
 
+// bridgeRoleRegex matches the valid bridge roles of a channel
+var bridgeRoleRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateBridgeAddChannel checks the join options of a BridgeAddChannel
+// request
+func validateBridgeAddChannel(r *proxy.BridgeAddChannel) error {
+	if r == nil || r.Channel == "" {
+		return eris.New("no channel given")
+	}
+	if r.Role != "" && !bridgeRoleRegex.MatchString(r.Role) {
+		return eris.Errorf("invalid bridge role %q", r.Role)
+	}
+	if r.Role == "announcer" && r.Mute {
+		return eris.New("an announcer may not be muted")
+	}
+	return nil
+}
+
 func (s *Server) bridgeAddChannel(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateBridgeAddChannel(req.BridgeAddChannel); err != nil {
+		s.sendError(reply, err)
+		return
+	}
 	channel := req.BridgeAddChannel.Channel
 
 	// bind dialog
@@ -17,8 +42,7 @@ func (s *Server) bridgeAddChannel(ctx context.Context, reply string, req *proxy.
 		s.Dialog.Bind(req.Key.Dialog, "channel", channel)
 	}
 
-	err := s.ari.Bridge().AddChannel(req.Key, channel)
-	if err != nil {
+	if err := addBridgeChannel(s.ari.Bridge(), req.Key, req.BridgeAddChannel); err != nil {
 		s.sendError(reply, err)
 		return
 	}
@@ -26,7 +50,168 @@ func (s *Server) bridgeAddChannel(ctx context.Context, reply string, req *proxy.
 	s.sendError(reply, nil)
 }
 
+// addBridgeChannel adds a channel to a bridge with its join options
+func addBridgeChannel(b ari.Bridge, key *ari.Key, opts *proxy.BridgeAddChannel) error {
+	if opts.AbsorbDTMF || opts.Mute || opts.Role != "" {
+		return b.AddChannelWithOptions(key, opts.Channel, &ari.BridgeAddChannelOptions{
+			AbsorbDTMF: opts.AbsorbDTMF,
+			Mute:       opts.Mute,
+			Role:       opts.Role,
+		})
+	}
+	return b.AddChannel(key, opts.Channel)
+}
+
+// validateBridgeAssemble checks a BridgeAssemble request
+func validateBridgeAssemble(r *proxy.BridgeAssemble) error {
+	if r == nil || len(r.Channels) == 0 {
+		return eris.New("no channels given")
+	}
+	if err := validateBridgeType(r.Type); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for i := range r.Channels {
+		if err := validateBridgeAddChannel(&r.Channels[i]); err != nil {
+			return err
+		}
+		if seen[r.Channels[i].Channel] {
+			return eris.Errorf("duplicate channel %s", r.Channels[i].Channel)
+		}
+		seen[r.Channels[i].Channel] = true
+	}
+	return nil
+}
+
+// assembleBridge creates a bridge and adds the requested channels to it, in
+// order.  If a channel cannot be added, the remaining channels are not
+// attempted and the bridge is destroyed.  The returned error is that of the
+// failed channel, or of the creation of the bridge.
+func assembleBridge(b ari.Bridge, key *ari.Key, r *proxy.BridgeAssemble) (*ari.Key, *proxy.BridgeAssembly, error) {
+	h, err := b.Create(key, r.Type, r.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	key = h.Key()
+
+	ret := &proxy.BridgeAssembly{
+		Channels: make([]proxy.BridgeChannelResult, len(r.Channels)),
+	}
+	for i := range r.Channels {
+		ret.Channels[i].Channel = r.Channels[i].Channel
+	}
+
+	for i := range r.Channels {
+		if err = addBridgeChannel(b, key, &r.Channels[i]); err != nil {
+			ret.Channels[i].Error = err.Error()
+			err = eris.Wrapf(err, "failed to add channel %s", r.Channels[i].Channel)
+			break
+		}
+		ret.Channels[i].Added = true
+	}
+	if err == nil {
+		return key, ret, nil
+	}
+
+	if derr := b.Delete(key); derr != nil {
+		return key, ret, eris.Errorf("%v; failed to destroy bridge: %v", err, derr)
+	}
+	ret.RolledBack = true
+	return key, ret, err
+}
+
+func (s *Server) bridgeAssemble(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateBridgeAssemble(req.BridgeAssemble); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// bind dialog
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "bridge", req.Key.ID)
+		for _, c := range req.BridgeAssemble.Channels {
+			s.Dialog.Bind(req.Key.Dialog, "channel", c.Channel)
+		}
+	}
+
+	key, result, err := assembleBridge(s.ari.Bridge(), req.Key, req.BridgeAssemble)
+	resp := proxy.NewErrorResponse(err)
+	resp.Key = key
+	if result != nil {
+		resp.Data = &proxy.EntityData{
+			BridgeAssembly: result,
+		}
+	}
+	s.publish(reply, resp)
+}
+
+// bridgeTypes are the valid bridge type attributes
+var bridgeTypes = map[string]bool{
+	"mixing":       true,
+	"holding":      true,
+	"dtmf_events":  true,
+	"proxy_media":  true,
+	"video_sfu":    true,
+	"video_single": true,
+}
+
+// validateBridgeType checks the comma-separated list of bridge type attributes
+// of a BridgeCreate request
+func validateBridgeType(btype string) error {
+	if btype == "" {
+		return nil
+	}
+
+	attrs := make(map[string]bool)
+	for _, a := range strings.Split(btype, ",") {
+		a = strings.TrimSpace(a)
+		if !bridgeTypes[a] {
+			return eris.Errorf("invalid bridge type %q", a)
+		}
+		if attrs[a] {
+			return eris.Errorf("duplicate bridge type %q", a)
+		}
+		attrs[a] = true
+	}
+
+	if attrs["mixing"] && attrs["holding"] {
+		return eris.New("a bridge may not be both mixing and holding")
+	}
+	if attrs["video_sfu"] && attrs["video_single"] {
+		return eris.New("a bridge may only have one video mode")
+	}
+	if attrs["holding"] && (attrs["video_sfu"] || attrs["video_single"]) {
+		return eris.New("a holding bridge may not have a video mode")
+	}
+	return nil
+}
+
+// bridgeTypeMatches indicates whether an existing bridge of the given type
+// (as reported by Asterisk) satisfies the requested bridge type
+func bridgeTypeMatches(requested, existing string) bool {
+	if existing == "" {
+		return true
+	}
+
+	want := "mixing"
+	if strings.Contains(requested, "holding") {
+		want = "holding"
+	}
+	for _, a := range strings.Split(existing, ",") {
+		if strings.TrimSpace(a) == want {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) bridgeCreate(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateBridgeType(req.BridgeCreate.Type); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
 	// bind dialog
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "bridge", req.Key.ID)
@@ -43,6 +228,44 @@ func (s *Server) bridgeCreate(ctx context.Context, reply string, req *proxy.Requ
 	})
 }
 
+func (s *Server) bridgeEnsure(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateBridgeType(req.BridgeCreate.Type); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// bind dialog
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "bridge", req.Key.ID)
+	}
+
+	// Return the existing bridge, if there is one
+	if data, err := s.ari.Bridge().Data(req.Key); err == nil {
+		if !bridgeTypeMatches(req.BridgeCreate.Type, data.Type) {
+			s.sendError(reply, eris.Errorf("bridge %s exists with type %q", req.Key.ID, data.Type))
+			return
+		}
+		key := data.Key
+		if key == nil {
+			key = req.Key
+		}
+		s.publish(reply, &proxy.Response{
+			Key: key,
+		})
+		return
+	}
+
+	h, err := s.ari.Bridge().Create(req.Key, req.BridgeCreate.Type, req.BridgeCreate.Name)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: h.Key(),
+	})
+}
+
 func (s *Server) bridgeStageCreate(ctx context.Context, reply string, req *proxy.Request) {
 	bh := s.ari.Bridge().Get(req.Key)
 
@@ -57,6 +280,9 @@ func (s *Server) bridgeStageCreate(ctx context.Context, reply string, req *proxy
 
 func (s *Server) bridgeData(ctx context.Context, reply string, req *proxy.Request) {
 	bd, err := s.ari.Bridge().Data(req.Key)
+	if err == nil {
+		bd, err = proxy.SelectBridgeFields(bd, req.Fields)
+	}
 	if err != nil {
 		s.sendError(reply, err)
 		return
@@ -107,9 +333,7 @@ func (s *Server) bridgeList(ctx context.Context, reply string, req *proxy.Reques
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) bridgeMOH(ctx context.Context, reply string, req *proxy.Request) {
@@ -137,20 +361,29 @@ func (s *Server) bridgeStopMOH(ctx context.Context, reply string, req *proxy.Req
 }
 
 func (s *Server) bridgePlay(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateMedia(req.BridgePlay.Media()); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	if err := validatePlayOptions(req.BridgePlay.PlayOptions); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
 	// bind dialog
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "bridge", req.Key.ID)
 		s.Dialog.Bind(req.Key.Dialog, "playback", req.BridgePlay.PlaybackID)
 	}
 
-	ph, err := s.ari.Bridge().Play(req.Key, req.BridgePlay.PlaybackID, req.BridgePlay.MediaURI)
+	k, err := s.play(req.Key, req.BridgePlay.PlaybackID, req.BridgePlay.Media(), req.BridgePlay.PlayOptions)
 	if err != nil {
 		s.sendError(reply, err)
 		return
 	}
 
 	s.publish(reply, &proxy.Response{
-		Key: ph.Key(),
+		Key: k,
 	})
 }
 
@@ -183,8 +416,21 @@ func (s *Server) bridgeRecord(ctx context.Context, reply string, req *proxy.Requ
 		return
 	}
 
-	if req.BridgeRecord.Name == "" {
-		req.BridgeRecord.Name = rid.New(rid.Recording)
+	name, err := s.recordingName(req.BridgeRecord.Name, req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	req.BridgeRecord.Name = name
+
+	if req.BridgeRecord.Options, err = s.recordingOptions(req.BridgeRecord.Options); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if err := s.quota.AdmitRecording(s.Application, req.Tenant, req.BridgeRecord.Name); err != nil {
+		s.sendError(reply, err)
+		return
 	}
 
 	// bind dialog
@@ -195,9 +441,11 @@ func (s *Server) bridgeRecord(ctx context.Context, reply string, req *proxy.Requ
 
 	h, err := s.ari.Bridge().Record(req.Key, req.BridgeRecord.Name, req.BridgeRecord.Options)
 	if err != nil {
+		s.quota.ReleaseRecording(req.BridgeRecord.Name)
 		s.sendError(reply, err)
 		return
 	}
+	s.limitRecording(req.BridgeRecord.Name, req.Key, req.BridgeRecord.Options)
 
 	s.publish(reply, &proxy.Response{
 		Key: h.Key(),
@@ -211,9 +459,12 @@ func (s *Server) bridgeStageRecord(ctx context.Context, reply string, req *proxy
 		return
 	}
 
-	if req.BridgeRecord.Name == "" {
-		req.BridgeRecord.Name = rid.New(rid.Recording)
+	name, err := s.recordingName(req.BridgeRecord.Name, req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
 	}
+	req.BridgeRecord.Name = name
 
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "bridge", data.ID)
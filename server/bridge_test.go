@@ -1,9 +1,14 @@
 package server
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/internal/integration"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/rotisserie/eris"
 )
 
 func TestBridgeCreate(t *testing.T) {
@@ -22,6 +27,65 @@ func TestBridgeAddChannel(t *testing.T) {
 	integration.TestBridgeAddChannel(t, &srv{})
 }
 
+func TestValidateBridgeAddChannel(t *testing.T) {
+	valid := []*proxy.BridgeAddChannel{
+		{Channel: "c1"},
+		{Channel: "c1", Role: "announcer", AbsorbDTMF: true},
+		{Channel: "c1", Role: "participant", Mute: true},
+	}
+	for _, r := range valid {
+		if err := validateBridgeAddChannel(r); err != nil {
+			t.Errorf("%+v: unexpected error: %v", r, err)
+		}
+	}
+
+	invalid := []*proxy.BridgeAddChannel{
+		nil,
+		{Role: "participant"},
+		{Channel: "c1", Role: "bad role"},
+		{Channel: "c1", Role: "announcer", Mute: true},
+	}
+	for _, r := range invalid {
+		if err := validateBridgeAddChannel(r); err == nil {
+			t.Errorf("%+v: expected error", r)
+		}
+	}
+}
+
+func TestValidateBridgeType(t *testing.T) {
+	for _, btype := range []string{"", "mixing", "holding", "mixing,dtmf_events,proxy_media", "mixing, video_sfu"} {
+		if err := validateBridgeType(btype); err != nil {
+			t.Errorf("%q: unexpected error: %v", btype, err)
+		}
+	}
+
+	for _, btype := range []string{"bogus", "mixing,holding", "mixing,mixing", "video_sfu,video_single", "holding,video_single"} {
+		if err := validateBridgeType(btype); err == nil {
+			t.Errorf("%q: expected error", btype)
+		}
+	}
+}
+
+func TestBridgeTypeMatches(t *testing.T) {
+	tests := []struct {
+		requested string
+		existing  string
+		matches   bool
+	}{
+		{"", "mixing", true},
+		{"mixing,dtmf_events", "mixing", true},
+		{"holding", "holding", true},
+		{"holding", "mixing", false},
+		{"", "holding", false},
+		{"mixing", "", true},
+	}
+	for _, tt := range tests {
+		if m := bridgeTypeMatches(tt.requested, tt.existing); m != tt.matches {
+			t.Errorf("%q vs %q: expected %v", tt.requested, tt.existing, tt.matches)
+		}
+	}
+}
+
 func TestBridgeRemoveChannel(t *testing.T) {
 	integration.TestBridgeRemoveChannel(t, &srv{})
 }
@@ -37,3 +101,71 @@ func TestBridgePlay(t *testing.T) {
 func TestBridgeRecord(t *testing.T) {
 	integration.TestBridgeRecord(t, &srv{})
 }
+
+func TestValidateBridgeAssemble(t *testing.T) {
+	if err := validateBridgeAssemble(&proxy.BridgeAssemble{Channels: []proxy.BridgeAddChannel{{Channel: "c1"}, {Channel: "c2", Role: "announcer"}}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, r := range []*proxy.BridgeAssemble{
+		nil,
+		{},
+		{Type: "bogus", Channels: []proxy.BridgeAddChannel{{Channel: "c1"}}},
+		{Channels: []proxy.BridgeAddChannel{{Channel: "c1"}, {}}},
+		{Channels: []proxy.BridgeAddChannel{{Channel: "c1"}, {Channel: "c1"}}},
+	} {
+		if err := validateBridgeAssemble(r); err == nil {
+			t.Errorf("%+v: expected error", r)
+		}
+	}
+}
+
+func TestAssembleBridge(t *testing.T) {
+	key := ari.NewKey(ari.BridgeKey, "b1")
+	req := &proxy.BridgeAssemble{
+		Type: "mixing",
+		Channels: []proxy.BridgeAddChannel{
+			{Channel: "c1"},
+			{Channel: "c2", Mute: true},
+			{Channel: "c3"},
+		},
+	}
+
+	b := new(arimocks.Bridge)
+	b.On("Create", key, "mixing", "").Return(ari.NewBridgeHandle(key, b, nil), nil)
+	b.On("AddChannel", key, "c1").Return(nil)
+	b.On("AddChannelWithOptions", key, "c2", &ari.BridgeAddChannelOptions{Mute: true}).Return(nil)
+	b.On("AddChannel", key, "c3").Return(nil)
+
+	k, result, err := assembleBridge(b, key, req)
+	if err != nil || k.ID != "b1" || result.RolledBack {
+		t.Fatalf("unexpected result %v %+v (%v)", k, result, err)
+	}
+	for _, c := range result.Channels {
+		if !c.Added || c.Error != "" {
+			t.Errorf("unexpected channel result %+v", c)
+		}
+	}
+
+	// A failed channel rolls the assembly back
+	b = new(arimocks.Bridge)
+	b.On("Create", key, "mixing", "").Return(ari.NewBridgeHandle(key, b, nil), nil)
+	b.On("AddChannel", key, "c1").Return(nil)
+	b.On("AddChannelWithOptions", key, "c2", &ari.BridgeAddChannelOptions{Mute: true}).Return(eris.New("channel not found"))
+	b.On("Delete", key).Return(nil)
+
+	_, result, err = assembleBridge(b, key, req)
+	if err == nil || !result.RolledBack {
+		t.Fatalf("unexpected result %+v (%v)", result, err)
+	}
+	want := []proxy.BridgeChannelResult{
+		{Channel: "c1", Added: true},
+		{Channel: "c2", Error: "channel not found"},
+		{Channel: "c3"},
+	}
+	if !reflect.DeepEqual(result.Channels, want) {
+		t.Errorf("channel results %+v, want %+v", result.Channels, want)
+	}
+	b.AssertCalled(t, "Delete", key)
+	b.AssertNotCalled(t, "AddChannel", key, "c3")
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// bridgePartyTracker derives BridgePartyJoined and BridgePartyLeft events from
+// the ChannelEnteredBridge and ChannelLeftBridge events.  The membership of
+// each bridge is taken from the bridge data of these events, which is
+// authoritative, so that it is complete even if other membership changes were
+// missed (e.g. during a reconnection to Asterisk); the tracker only remembers
+// the descriptions of the parties.
+type bridgePartyTracker struct {
+	// parties maps the IDs of the bridged channels to their descriptions
+	parties map[string]proxy.BridgeParty
+	mu      sync.Mutex
+}
+
+func bridgeParty(c *ari.ChannelData) proxy.BridgeParty {
+	p := proxy.BridgeParty{
+		ChannelID: c.ID,
+		Name:      c.Name,
+	}
+	if c.Caller != nil {
+		p.CallerNumber = c.Caller.Number
+		p.CallerName = c.Caller.Name
+	}
+	return p
+}
+
+// participants returns the descriptions of the given channels.  The channels
+// which are not known are described by their IDs only.
+func (t *bridgePartyTracker) participants(ids []string) []proxy.BridgeParty {
+	ret := make([]proxy.BridgeParty, 0, len(ids))
+	for _, id := range ids {
+		p, ok := t.parties[id]
+		if !ok {
+			p = proxy.BridgeParty{ChannelID: id}
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// process updates the parties from an event, returning the event derived from
+// it, if any
+func (t *bridgePartyTracker) process(e ari.Event) ari.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.parties == nil {
+		t.parties = make(map[string]proxy.BridgeParty)
+	}
+
+	switch v := e.(type) {
+	case *ari.ChannelEnteredBridge:
+		p := bridgeParty(&v.Channel)
+		t.parties[p.ChannelID] = p
+
+		return &proxy.BridgePartyJoined{
+			BridgeID:     v.Bridge.ID,
+			Party:        p,
+			Participants: t.participants(v.Bridge.ChannelIDs),
+		}
+	case *ari.ChannelLeftBridge:
+		p, ok := t.parties[v.Channel.ID]
+		if !ok {
+			p = bridgeParty(&v.Channel)
+		}
+		delete(t.parties, v.Channel.ID)
+
+		// Asterisk may report the bridge before the channel was removed
+		var remaining []string
+		for _, id := range v.Bridge.ChannelIDs {
+			if id != v.Channel.ID {
+				remaining = append(remaining, id)
+			}
+		}
+
+		return &proxy.BridgePartyLeft{
+			BridgeID:     v.Bridge.ID,
+			Party:        p,
+			Participants: t.participants(remaining),
+		}
+	case *ari.ChannelDestroyed:
+		delete(t.parties, v.Channel.ID)
+	}
+	return nil
+}
+
+// processBridgePartyEvent publishes the bridge party change derived from an
+// event, if any
+func (s *Server) processBridgePartyEvent(e ari.Event) {
+	switch ev := s.bridgeParties.process(e).(type) {
+	case *proxy.BridgePartyJoined:
+		ev.EventData = s.newEventData(proxy.EventBridgePartyJoined)
+		s.publishEvent(ev)
+	case *proxy.BridgePartyLeft:
+		ev.EventData = s.newEventData(proxy.EventBridgePartyLeft)
+		s.publishEvent(ev)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func entered(bridge, channel string, members ...string) *ari.ChannelEnteredBridge {
+	return &ari.ChannelEnteredBridge{
+		Bridge: ari.BridgeData{ID: bridge, ChannelIDs: members},
+		Channel: ari.ChannelData{
+			ID:     channel,
+			Name:   "PJSIP/" + channel,
+			Caller: &ari.CallerID{Number: "100" + channel},
+		},
+	}
+}
+
+func partyIDs(parties []proxy.BridgeParty) (ids []string) {
+	for _, p := range parties {
+		ids = append(ids, p.ChannelID)
+	}
+	return
+}
+
+func TestBridgePartyTracker(t *testing.T) {
+	var tr bridgePartyTracker
+
+	// "c0" entered the bridge before the tracker started
+	tr.process(entered("b1", "c1", "c0", "c1"))
+	joined, ok := tr.process(entered("b1", "c2", "c0", "c1", "c2")).(*proxy.BridgePartyJoined)
+	if !ok {
+		t.Fatal("expected BridgePartyJoined")
+	}
+	if joined.BridgeID != "b1" || joined.Party.ChannelID != "c2" || joined.Party.CallerNumber != "100c2" {
+		t.Errorf("unexpected event: %+v", joined)
+	}
+	if got := partyIDs(joined.Participants); len(got) != 3 || got[0] != "c0" || got[2] != "c2" {
+		t.Errorf("unexpected participants: %v", got)
+	}
+	if joined.Participants[0].Name != "" || joined.Participants[1].Name != "PJSIP/c1" {
+		t.Errorf("unexpected participant descriptions: %+v", joined.Participants)
+	}
+
+	left, ok := tr.process(&ari.ChannelLeftBridge{
+		Bridge:  ari.BridgeData{ID: "b1", ChannelIDs: []string{"c0", "c1", "c2"}},
+		Channel: ari.ChannelData{ID: "c1"},
+	}).(*proxy.BridgePartyLeft)
+	if !ok {
+		t.Fatal("expected BridgePartyLeft")
+	}
+	if left.Party.Name != "PJSIP/c1" {
+		t.Errorf("expected the description of the party which left, got %+v", left.Party)
+	}
+	if got := partyIDs(left.Participants); len(got) != 2 || got[0] != "c0" || got[1] != "c2" {
+		t.Errorf("unexpected remaining participants: %v", got)
+	}
+
+	if ev := tr.process(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c2"}}); ev != nil {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if _, ok := tr.parties["c2"]; ok {
+		t.Error("destroyed channel should be forgotten")
+	}
+}
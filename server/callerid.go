@@ -0,0 +1,274 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultCallerIDTimeout is the time allowed for the caller ID lookup of a
+// call entering the application, which delays its StasisStart event
+var DefaultCallerIDTimeout = time.Second
+
+// CallerIDProvider resolves the caller ID numbers of inbound calls (e.g. to a
+// CNAM)
+type CallerIDProvider interface {
+	// LookupCallerID returns the information about the caller of the given
+	// number.  A nil result indicates that the number is unknown.
+	LookupCallerID(ctx context.Context, number string) (*proxy.CallerInfo, error)
+}
+
+// CallerIDProviderFunc is a function which implements CallerIDProvider
+type CallerIDProviderFunc func(ctx context.Context, number string) (*proxy.CallerInfo, error)
+
+// LookupCallerID implements CallerIDProvider
+func (f CallerIDProviderFunc) LookupCallerID(ctx context.Context, number string) (*proxy.CallerInfo, error) {
+	return f(ctx, number)
+}
+
+// StaticCallerID is a CallerIDProvider which resolves numbers from a fixed
+// table
+type StaticCallerID map[string]proxy.CallerInfo
+
+// LookupCallerID implements CallerIDProvider
+func (t StaticCallerID) LookupCallerID(ctx context.Context, number string) (*proxy.CallerInfo, error) {
+	info, ok := t[number]
+	if !ok {
+		return nil, nil
+	}
+	if info.Source == "" {
+		info.Source = "static"
+	}
+	return &info, nil
+}
+
+// LoadStaticCallerID reads a StaticCallerID table from CSV records of the form
+// "number,name[,type]".  Lines starting with '#' are ignored.
+func LoadStaticCallerID(r io.Reader) (StaticCallerID, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	t := make(StaticCallerID)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, eris.Wrap(err, "failed to read caller ID table")
+		}
+		if len(rec) < 2 || rec[0] == "" {
+			return nil, eris.Errorf("invalid caller ID record %v: expected a number and a name", rec)
+		}
+
+		info := proxy.CallerInfo{Name: rec[1]}
+		if len(rec) > 2 {
+			info.Type = rec[2]
+		}
+		t[rec[0]] = info
+	}
+	return t, nil
+}
+
+// LoadStaticCallerIDFile reads a StaticCallerID table from the given CSV file
+// (see LoadStaticCallerID)
+func LoadStaticCallerIDFile(fn string) (StaticCallerID, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to open caller ID table")
+	}
+	defer f.Close() // nolint: errcheck
+
+	return LoadStaticCallerID(f)
+}
+
+// HTTPCallerID is a CallerIDProvider which looks numbers up with an HTTP GET
+// request.  A 200 response carries the JSON encoding of a proxy.CallerInfo, or
+// the plain-text name of the caller; a 404 response indicates that the
+// number is unknown.
+type HTTPCallerID struct {
+	// URL is the template of the URL of the lookup, in which {number} is
+	// replaced by the (query-escaped) number, such as
+	// "https://cnam.example.com/lookup?number={number}"
+	URL string `mapstructure:"url"`
+
+	// Headers are added to each request (e.g. an Authorization header)
+	Headers map[string]string `mapstructure:"headers"`
+
+	// Client is the HTTP client of the lookups.  If nil,
+	// http.DefaultClient is used.
+	Client *http.Client `mapstructure:"-"`
+}
+
+// LookupCallerID implements CallerIDProvider
+func (p *HTTPCallerID) LookupCallerID(ctx context.Context, number string) (*proxy.CallerInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.Replace(p.URL, "{number}", url.QueryEscape(number), -1), nil)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to build caller ID request")
+	}
+	req = req.WithContext(ctx)
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, eris.Wrap(err, "caller ID request failed")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, eris.Errorf("caller ID lookup returned %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to read caller ID response")
+	}
+
+	info := new(proxy.CallerInfo)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(body, info); err != nil {
+			return nil, eris.Wrap(err, "invalid caller ID response")
+		}
+	} else {
+		info.Name = strings.TrimSpace(string(body))
+	}
+	if info.Name == "" && info.Type == "" {
+		return nil, nil
+	}
+	if info.Source == "" {
+		info.Source = "http"
+	}
+	return info, nil
+}
+
+// cachedCallerID caches the results of a CallerIDProvider, including unknown
+// numbers, evicting the least recently used results beyond its size
+type cachedCallerID struct {
+	provider CallerIDProvider
+	ttl      time.Duration
+	size     int
+
+	entries map[string]*list.Element
+	lru     *list.List
+	mu      sync.Mutex
+}
+
+type callerIDEntry struct {
+	number  string
+	info    *proxy.CallerInfo
+	expires time.Time
+}
+
+// NewCachedCallerID returns a CallerIDProvider which caches the results of
+// the given provider for the given time, keeping at most size results.
+// Failed lookups are not cached.
+func NewCachedCallerID(p CallerIDProvider, ttl time.Duration, size int) CallerIDProvider {
+	return &cachedCallerID{
+		provider: p,
+		ttl:      ttl,
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// LookupCallerID implements CallerIDProvider
+func (c *cachedCallerID) LookupCallerID(ctx context.Context, number string) (*proxy.CallerInfo, error) {
+	if info, ok := c.get(number, time.Now()); ok {
+		return info, nil
+	}
+
+	info, err := c.provider.LookupCallerID(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	c.put(number, info, time.Now())
+	return info, nil
+}
+
+func (c *cachedCallerID) get(number string, now time.Time) (*proxy.CallerInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[number]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*callerIDEntry)
+	if now.After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, number)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.info, true
+}
+
+func (c *cachedCallerID) put(number string, info *proxy.CallerInfo, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[number]; ok {
+		c.lru.Remove(el)
+	}
+	c.entries[number] = c.lru.PushFront(&callerIDEntry{
+		number:  number,
+		info:    info,
+		expires: now.Add(c.ttl),
+	})
+
+	for c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*callerIDEntry).number)
+	}
+}
+
+// attachCallerInfo looks up the caller ID number of an inbound call entering
+// the application and attaches the result to the channel variables of its
+// StasisStart event (see proxy.GetCallerInfo).  A failed lookup is logged and
+// otherwise ignored.  It is run off the event loop, by prepareStart.
+func (s *Server) attachCallerInfo(ctx context.Context, e *ari.StasisStart) {
+	if s.CallerID == nil {
+		return
+	}
+	number := e.Channel.GetCaller().GetNumber()
+	if number == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultCallerIDTimeout)
+	defer cancel()
+
+	info, err := s.CallerID.LookupCallerID(ctx, number)
+	if err != nil {
+		s.Log.Warn("caller ID lookup failed", "channel", e.Channel.ID, "number", number, "error", err)
+		return
+	}
+	proxy.SetCallerInfo(&e.Channel, info)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+func TestLoadStaticCallerID(t *testing.T) {
+	table, err := LoadStaticCallerID(strings.NewReader(`# number,name,type
+15555550100,Acme Corp,business
+15555550101, Jane Doe
+`))
+	if err != nil {
+		t.Fatalf("failed to load table: %s", err)
+	}
+
+	info, err := table.LookupCallerID(context.Background(), "15555550100")
+	if err != nil || info == nil {
+		t.Fatalf("expected caller info, got %v (%v)", info, err)
+	}
+	if info.Name != "Acme Corp" || info.Type != "business" || info.Source != "static" {
+		t.Errorf("unexpected caller info: %+v", info)
+	}
+
+	info, _ = table.LookupCallerID(context.Background(), "15555550101")
+	if info == nil || info.Name != "Jane Doe" || info.Type != "" {
+		t.Errorf("unexpected caller info: %+v", info)
+	}
+
+	if info, _ = table.LookupCallerID(context.Background(), "15555550199"); info != nil {
+		t.Errorf("expected unknown number, got %+v", info)
+	}
+
+	if _, err := LoadStaticCallerID(strings.NewReader("15555550100\n")); err == nil {
+		t.Error("expected error for record without a name")
+	}
+}
+
+func TestHTTPCallerID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("number") {
+		case "+15555550100":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"Acme Corp","type":"business"}`)) // nolint: errcheck
+		case "+15555550101":
+			w.Write([]byte("Jane Doe\n")) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := &HTTPCallerID{
+		URL:     srv.URL + "/lookup?number={number}",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}
+
+	info, err := p.LookupCallerID(context.Background(), "+15555550100")
+	if err != nil || info == nil {
+		t.Fatalf("expected caller info, got %v (%v)", info, err)
+	}
+	if info.Name != "Acme Corp" || info.Type != "business" || info.Source != "http" {
+		t.Errorf("unexpected caller info: %+v", info)
+	}
+
+	info, err = p.LookupCallerID(context.Background(), "+15555550101")
+	if err != nil || info == nil || info.Name != "Jane Doe" {
+		t.Errorf("unexpected plain-text caller info: %+v (%v)", info, err)
+	}
+
+	info, err = p.LookupCallerID(context.Background(), "+15555550199")
+	if err != nil || info != nil {
+		t.Errorf("expected unknown number, got %+v (%v)", info, err)
+	}
+
+	p.Headers = nil
+	if _, err = p.LookupCallerID(context.Background(), "+15555550100"); err == nil {
+		t.Error("expected error for unauthorized lookup")
+	}
+}
+
+func TestCachedCallerID(t *testing.T) {
+	var lookups int
+	p := CallerIDProviderFunc(func(ctx context.Context, number string) (*proxy.CallerInfo, error) {
+		lookups++
+		if number == "unknown" {
+			return nil, nil
+		}
+		return &proxy.CallerInfo{Name: "caller " + number}, nil
+	})
+
+	c := NewCachedCallerID(p, time.Minute, 2).(*cachedCallerID)
+
+	for i := 0; i < 2; i++ {
+		info, _ := c.LookupCallerID(context.Background(), "1")
+		if info == nil || info.Name != "caller 1" {
+			t.Fatalf("unexpected caller info: %+v", info)
+		}
+		if info, _ = c.LookupCallerID(context.Background(), "unknown"); info != nil {
+			t.Fatalf("expected unknown number, got %+v", info)
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("expected 2 lookups, got %d", lookups)
+	}
+
+	// "2" evicts the least recently used "1"
+	c.LookupCallerID(context.Background(), "2") // nolint: errcheck
+	if _, ok := c.get("1", time.Now()); ok {
+		t.Error("expected least recently used result to be evicted")
+	}
+	if _, ok := c.get("unknown", time.Now()); !ok {
+		t.Error("expected cached unknown number")
+	}
+
+	if _, ok := c.get("2", time.Now().Add(2*time.Minute)); ok {
+		t.Error("expected result to expire")
+	}
+}
+
+func TestAttachCallerInfo(t *testing.T) {
+	log := log15.New()
+	log.SetHandler(log15.DiscardHandler())
+
+	s := &Server{
+		Log:      log,
+		CallerID: StaticCallerID{"15555550100": {Name: "Acme Corp", Type: "business"}},
+	}
+
+	e := &ari.StasisStart{Channel: ari.ChannelData{ID: "ch1", Caller: &ari.CallerID{Number: "15555550100"}}}
+	s.attachCallerInfo(context.Background(), e)
+
+	info := proxy.GetCallerInfo(&e.Channel)
+	if info == nil {
+		t.Fatal("expected caller info to be attached")
+	}
+	if info.Name != "Acme Corp" || info.Type != "business" || info.Source != "static" {
+		t.Errorf("unexpected caller info: %+v", info)
+	}
+
+	e = &ari.StasisStart{Channel: ari.ChannelData{ID: "ch2", Caller: &ari.CallerID{Number: "15555550199"}}}
+	s.attachCallerInfo(context.Background(), e)
+	if info := proxy.GetCallerInfo(&e.Channel); info != nil {
+		t.Errorf("expected no caller info for unknown number, got %+v", info)
+	}
+}
+
+func TestPrepareStartCallerInfo(t *testing.T) {
+	log := log15.New()
+	log.SetHandler(log15.DiscardHandler())
+
+	s := &Server{
+		Log:      log,
+		CallerID: StaticCallerID{"15555550100": {Name: "Acme Corp", Type: "business"}},
+	}
+	if !s.preparesStarts() {
+		t.Fatal("StasisStarts not prepared with a caller ID provider")
+	}
+
+	done := make(chan *preparedStart, 1)
+	e := &ari.StasisStart{Channel: ari.ChannelData{ID: "ch1", Caller: &ari.CallerID{Number: "15555550100"}}}
+	s.prepareStart(context.Background(), e, done)
+	if r := <-done; r.event != e || !r.publish || proxy.GetCallerInfo(&e.Channel) == nil {
+		t.Errorf("unexpected prepared StasisStart: %+v", r)
+	}
+
+	// The lookup ends with the server
+	var lookupErr error
+	ctx, cancel := context.WithCancel(context.Background())
+	s.CallerID = CallerIDProviderFunc(func(lctx context.Context, number string) (*proxy.CallerInfo, error) {
+		cancel()
+		<-lctx.Done()
+		lookupErr = lctx.Err()
+		return nil, lookupErr
+	})
+	s.attachCallerInfo(ctx, e)
+	if lookupErr != context.Canceled {
+		t.Errorf("lookup not cancelled with the server: %v", lookupErr)
+	}
+}
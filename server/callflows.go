@@ -0,0 +1,378 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultCallFlowTimeout is the time for which a call flow state with DTMF
+// transitions but no timeout waits for a digit
+const DefaultCallFlowTimeout = 10 * time.Second
+
+// maxCallFlowTransitions is the maximum number of transitions of a call flow,
+// which stops flows which loop without waiting for the caller
+const maxCallFlowTransitions = 1000
+
+// errCallFlowLeft indicates that the channel of a call flow left the
+// application by an action of the flow (hangup, continue or move)
+var errCallFlowLeft = eris.New("channel left the call flow")
+
+// CallFlow is a declarative call flow, which the proxy executes itself for the
+// calls entering the application which match it, so that trivial flows need
+// no client application.  The StasisStart events of these calls are not
+// published.  The flow is a state machine: on entering a state, the proxy
+// runs the actions of the state, then moves to the next state, or waits for
+// one of the DTMF digits of the state or for its timeout.  Once the flow
+// reaches a state without transitions, the call is hung up.
+type CallFlow struct {
+	// Name identifies the flow in logs
+	Name string `mapstructure:"name"`
+
+	// Match selects the calls of the flow
+	Match CallFlowMatch `mapstructure:"match"`
+
+	// Initial is the state in which the flow starts
+	Initial string `mapstructure:"initial"`
+
+	// States are the states of the flow, by name
+	States map[string]CallFlowState `mapstructure:"states"`
+}
+
+// CallFlowMatch selects the calls of a call flow.  A call matches if all of
+// the given criteria match; at least one is required, so that a flow does not
+// inadvertently take over the channels which clients create.
+type CallFlowMatch struct {
+	// Caller is the regular expression matched against the caller ID number
+	Caller string `mapstructure:"caller"`
+
+	// Callee is the regular expression matched against the dialed extension
+	Callee string `mapstructure:"callee"`
+
+	// Args are matched against the leading arguments with which the call
+	// entered the application (e.g. Stasis(app,ivr) matches ["ivr"])
+	Args []string `mapstructure:"args"`
+}
+
+// CallFlowState is a state of a call flow
+type CallFlowState struct {
+	// Actions are run, in order, on entering the state
+	Actions []CallFlowAction `mapstructure:"actions"`
+
+	// Next is the state to which the flow moves once the actions complete
+	Next string `mapstructure:"next"`
+
+	// DTMF maps DTMF digits to the states to which they move the flow, when
+	// received during a playback of the state (which they interrupt) or
+	// after the actions of the state
+	DTMF map[string]string `mapstructure:"dtmf"`
+
+	// Timeout is the time to wait for one of the DTMF digits after the
+	// actions of the state.  It defaults to DefaultCallFlowTimeout, if the
+	// state has DTMF transitions.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// OnTimeout is the state to which the flow moves when the timeout
+	// elapses.  If empty, the call is hung up.
+	OnTimeout string `mapstructure:"on_timeout"`
+}
+
+// CallFlowAction is an action of a call flow state.  Exactly one of its
+// fields is set.
+type CallFlowAction struct {
+	// Answer answers the channel
+	Answer bool `mapstructure:"answer"`
+
+	// Play plays the given media URI (e.g. "sound:hello-world") and waits
+	// for it to finish
+	Play string `mapstructure:"play"`
+
+	// Wait pauses for the given duration
+	Wait time.Duration `mapstructure:"wait"`
+
+	// Set sets the given channel variables
+	Set map[string]string `mapstructure:"set"`
+
+	// Goto moves the flow to the given state, skipping the remaining actions
+	Goto string `mapstructure:"goto"`
+
+	// Hangup hangs up the channel, ending the flow
+	Hangup bool `mapstructure:"hangup"`
+
+	// Continue returns the channel to the dialplan, ending the flow
+	Continue *CallFlowContinue `mapstructure:"continue"`
+
+	// Move moves the channel to the given Stasis application, ending the
+	// flow
+	Move string `mapstructure:"move"`
+}
+
+// CallFlowContinue describes the dialplan location to which a call flow
+// returns its channel
+type CallFlowContinue struct {
+	Context   string `mapstructure:"context"`
+	Extension string `mapstructure:"extension"`
+	Priority  int    `mapstructure:"priority"`
+}
+
+// dtmfDigits are the valid DTMF digits
+const dtmfDigits = "0123456789*#ABCD"
+
+// count returns the number of fields of the action which are set
+func (a CallFlowAction) count() (n int) {
+	for _, set := range []bool{a.Answer, a.Play != "", a.Wait > 0, len(a.Set) > 0, a.Goto != "", a.Hangup, a.Continue != nil, a.Move != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// validate checks that the states of the flow, and the states to which they
+// move it, are defined and valid
+func (f CallFlow) validate() error {
+	if f.Name == "" {
+		return eris.New("call flow has no name")
+	}
+	if f.Match.Caller == "" && f.Match.Callee == "" && len(f.Match.Args) == 0 {
+		return eris.Errorf("call flow %q matches every call", f.Name)
+	}
+
+	defined := func(state string) error {
+		if _, ok := f.States[state]; !ok {
+			return eris.Errorf("call flow %q: state %q is not defined", f.Name, state)
+		}
+		return nil
+	}
+	if err := defined(f.Initial); err != nil {
+		return err
+	}
+	for name, st := range f.States {
+		targets := []string{st.Next}
+		for digit, next := range st.DTMF {
+			if len(digit) != 1 || !strings.Contains(dtmfDigits, digit) {
+				return eris.Errorf("call flow %q: state %q has an invalid DTMF digit %q", f.Name, name, digit)
+			}
+			targets = append(targets, next)
+		}
+		if st.Timeout < 0 {
+			return eris.Errorf("call flow %q: state %q has a negative timeout", f.Name, name)
+		}
+		targets = append(targets, st.OnTimeout)
+
+		for i, a := range st.Actions {
+			if a.count() != 1 {
+				return eris.Errorf("call flow %q: action %d of state %q must set exactly one action", f.Name, i+1, name)
+			}
+			if a.Continue != nil && a.Continue.Context == "" && a.Continue.Extension == "" {
+				return eris.Errorf("call flow %q: action %d of state %q continues to no dialplan location", f.Name, i+1, name)
+			}
+			targets = append(targets, a.Goto)
+		}
+
+		for _, next := range targets {
+			if next == "" {
+				continue
+			}
+			if err := defined(next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compiledCallFlow is a validated call flow with its compiled match
+type compiledCallFlow struct {
+	flow CallFlow
+
+	caller *regexp.Regexp
+	callee *regexp.Regexp
+}
+
+// newCallFlows validates the given call flows and compiles their matches
+func newCallFlows(flows []CallFlow) ([]*compiledCallFlow, error) {
+	var ret []*compiledCallFlow
+	for _, f := range flows {
+		if err := f.validate(); err != nil {
+			return nil, err
+		}
+
+		c := &compiledCallFlow{flow: f}
+		var err error
+		if f.Match.Caller != "" {
+			if c.caller, err = regexp.Compile(f.Match.Caller); err != nil {
+				return nil, eris.Wrapf(err, "call flow %q: invalid caller pattern", f.Name)
+			}
+		}
+		if f.Match.Callee != "" {
+			if c.callee, err = regexp.Compile(f.Match.Callee); err != nil {
+				return nil, eris.Wrapf(err, "call flow %q: invalid callee pattern", f.Name)
+			}
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// matches indicates whether the call entering the application matches the
+// flow
+func (c *compiledCallFlow) matches(e *ari.StasisStart) bool {
+	if c.caller != nil && !c.caller.MatchString(e.Channel.GetCaller().GetNumber()) {
+		return false
+	}
+	if c.callee != nil && !c.callee.MatchString(e.Channel.GetDialplan().GetExten()) {
+		return false
+	}
+	if len(e.Args) < len(c.flow.Match.Args) {
+		return false
+	}
+	for i, arg := range c.flow.Match.Args {
+		if e.Args[i] != arg {
+			return false
+		}
+	}
+	return true
+}
+
+// startCallFlow starts the first call flow which matches the call entering
+// the application, if any, returning whether it did, in which case the
+// StasisStart event of the call is not published
+func (s *Server) startCallFlow(ctx context.Context, e *ari.StasisStart) bool {
+	for _, c := range s.callFlows {
+		if !c.matches(e) {
+			continue
+		}
+
+		// The call flow subscribes to the events of the channel before
+		// the event handler moves on to them
+		f := s.newCallFlow(ari.NewKey(ari.ChannelKey, e.Channel.ID))
+		go s.runCallFlow(ctx, f, &c.flow)
+		return true
+	}
+	return false
+}
+
+// runCallFlow executes the call flow on its channel, hanging up the channel
+// once the flow ends
+func (s *Server) runCallFlow(ctx context.Context, f *callFlow, flow *CallFlow) {
+	defer f.Close()
+
+	log := s.Log.New("flow", flow.Name, "channel", f.key.ID)
+	log.Debug("starting call flow")
+
+	state := flow.Initial
+	for i := 0; state != ""; i++ {
+		if i == maxCallFlowTransitions {
+			log.Warn("call flow exceeded the maximum number of transitions", "state", state)
+			break
+		}
+
+		next, err := s.runCallFlowState(ctx, f, flow.States[state], log)
+		if err == errHangup || err == errCallFlowLeft {
+			log.Debug("call flow ended", "state", state, "reason", err)
+			return
+		}
+		if err != nil {
+			log.Error("call flow failed", "state", state, "error", err)
+			break
+		}
+		state = next
+	}
+
+	log.Debug("call flow complete; hanging up")
+	if err := s.ari.Channel().Hangup(f.key, "normal"); err != nil {
+		log.Debug("failed to hang up channel of call flow", "error", err)
+	}
+}
+
+// runCallFlowState runs the actions of a call flow state and waits for its
+// transition, returning the next state, or "" if the flow ends
+func (s *Server) runCallFlowState(ctx context.Context, f *callFlow, st CallFlowState, log log15.Logger) (string, error) {
+	var interrupt string
+	for digit := range st.DTMF {
+		interrupt += digit
+	}
+
+	for _, a := range st.Actions {
+		var err error
+		switch {
+		case a.Answer:
+			err = s.ari.Channel().Answer(f.key)
+		case a.Play != "":
+			var digit string
+			if digit, err = f.Play(ctx, a.Play, interrupt); err == nil && digit != "" {
+				return st.DTMF[digit], nil
+			}
+		case a.Wait > 0:
+			if next, ok, err := s.waitCallFlowDigit(ctx, f, st, a.Wait); err != nil || ok {
+				return next, err
+			}
+		case len(a.Set) > 0:
+			for name, value := range a.Set {
+				if err = s.ari.Channel().SetVariable(f.key, name, value); err != nil {
+					break
+				}
+			}
+		case a.Goto != "":
+			return a.Goto, nil
+		case a.Hangup:
+			if err = s.ari.Channel().Hangup(f.key, "normal"); err == nil {
+				return "", errCallFlowLeft
+			}
+		case a.Continue != nil:
+			if err = s.ari.Channel().Continue(f.key, a.Continue.Context, a.Continue.Extension, a.Continue.Priority); err == nil {
+				return "", errCallFlowLeft
+			}
+		case a.Move != "":
+			params := url.Values{}
+			params.Set("app", a.Move)
+			if err = s.rest.post("/channels/"+url.PathEscape(f.key.ID)+"/move", params); err == nil {
+				return "", errCallFlowLeft
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if st.Next != "" {
+		return st.Next, nil
+	}
+	if len(st.DTMF) == 0 && st.Timeout == 0 {
+		return "", nil
+	}
+
+	timeout := st.Timeout
+	if timeout == 0 {
+		timeout = DefaultCallFlowTimeout
+	}
+	next, ok, err := s.waitCallFlowDigit(ctx, f, st, timeout)
+	if err != nil || ok {
+		return next, err
+	}
+	log.Debug("call flow state timed out", "next", st.OnTimeout)
+	return st.OnTimeout, nil
+}
+
+// waitCallFlowDigit waits up to the given duration for one of the DTMF digits
+// of the state, returning the state to which it moves the flow, if one was
+// received, ignoring other digits
+func (s *Server) waitCallFlowDigit(ctx context.Context, f *callFlow, st CallFlowState, d time.Duration) (next string, ok bool, err error) {
+	deadline := time.Now().Add(d)
+	for {
+		digit, err := f.WaitDigit(ctx, time.Until(deadline))
+		if err != nil || digit == "" {
+			return "", false, err
+		}
+		if next, ok := st.DTMF[digit]; ok {
+			return next, true, nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func menuCallFlow() CallFlow {
+	return CallFlow{
+		Name:    "menu",
+		Match:   CallFlowMatch{Callee: `^1\d{2}$`, Args: []string{"ivr"}},
+		Initial: "greeting",
+		States: map[string]CallFlowState{
+			"greeting": {
+				Actions: []CallFlowAction{{Answer: true}, {Set: map[string]string{"FLOW": "menu"}}},
+				DTMF:    map[string]string{"1": "sales"},
+				Timeout: time.Second,
+			},
+			"sales": {
+				Actions: []CallFlowAction{{Continue: &CallFlowContinue{Context: "sales", Extension: "s", Priority: 1}}},
+			},
+		},
+	}
+}
+
+func TestCallFlowValidation(t *testing.T) {
+	if _, err := newCallFlows([]CallFlow{menuCallFlow()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, modify := range map[string]func(f *CallFlow){
+		"no match":     func(f *CallFlow) { f.Match = CallFlowMatch{} },
+		"initial":      func(f *CallFlow) { f.Initial = "missing" },
+		"dtmf target":  func(f *CallFlow) { f.States["greeting"].DTMF["2"] = "missing" },
+		"dtmf digit":   func(f *CallFlow) { f.States["greeting"].DTMF["12"] = "sales" },
+		"empty action": func(f *CallFlow) { f.States["sales"] = CallFlowState{Actions: []CallFlowAction{{}}} },
+		"double action": func(f *CallFlow) {
+			f.States["sales"] = CallFlowState{Actions: []CallFlowAction{{Answer: true, Hangup: true}}}
+		},
+		"pattern": func(f *CallFlow) { f.Match.Caller = "(" },
+	} {
+		f := menuCallFlow()
+		modify(&f)
+		if _, err := newCallFlows([]CallFlow{f}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCallFlowMatch(t *testing.T) {
+	flows, err := newCallFlows([]CallFlow{menuCallFlow()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := flows[0]
+
+	call := func(exten string, args ...string) *ari.StasisStart {
+		return &ari.StasisStart{
+			Args:    args,
+			Channel: ari.ChannelData{ID: "c1", Dialplan: &ari.DialplanCEP{Exten: exten}},
+		}
+	}
+	if !c.matches(call("100", "ivr", "extra")) {
+		t.Error("matching call not matched")
+	}
+	if c.matches(call("100")) || c.matches(call("100", "queue")) || c.matches(call("2000", "ivr")) {
+		t.Error("unmatched call matched")
+	}
+}
+
+func TestRunCallFlow(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	events := make(chan ari.Event, 1)
+
+	sub := new(arimocks.Subscription)
+	sub.On("Events").Return((<-chan ari.Event)(events))
+	sub.On("Cancel").Return()
+
+	bus := new(arimocks.Bus)
+	bus.On("Subscribe", key, ari.Events.ChannelDtmfReceived, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(sub)
+
+	ch := new(arimocks.Channel)
+	ch.On("Answer", key).Return(nil)
+	ch.On("SetVariable", key, "FLOW", "menu").Return(nil)
+	ch.On("Continue", key, "sales", "s", 1).Return(nil)
+
+	cl := new(arimocks.Client)
+	cl.On("Bus").Return(bus)
+	cl.On("Channel").Return(ch)
+
+	s := New(WithCallFlows(menuCallFlow()))
+	s.ari = cl
+	var err error
+	if s.callFlows, err = newCallFlows(s.CallFlows); err != nil {
+		t.Fatal(err)
+	}
+
+	// The digit not of the state is ignored
+	events <- &ari.ChannelDtmfReceived{Digit: "5"}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		events <- &ari.ChannelDtmfReceived{Digit: "1"}
+	}()
+
+	f := s.newCallFlow(key)
+	done := make(chan struct{})
+	go func() {
+		s.runCallFlow(context.Background(), f, &s.callFlows[0].flow)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("call flow did not complete")
+	}
+
+	ch.AssertCalled(t, "Continue", key, "sales", "s", 1)
+	ch.AssertNotCalled(t, "Hangup", mock.Anything, mock.Anything)
+	sub.AssertCalled(t, "Cancel")
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// localPartnerName returns the name of the other half of the Local channel of
+// the given name, or the empty string if the channel is not a Local channel.
+// The halves of a Local channel are named "Local/<dest>-<seq>;1" and ";2".
+func localPartnerName(name string) string {
+	if !strings.HasPrefix(name, "Local/") {
+		return ""
+	}
+	switch {
+	case strings.HasSuffix(name, ";1"):
+		return strings.TrimSuffix(name, ";1") + ";2"
+	case strings.HasSuffix(name, ";2"):
+		return strings.TrimSuffix(name, ";2") + ";1"
+	}
+	return ""
+}
+
+// snoopTarget returns the ID of the channel spied on by the snoop channel of
+// the given name, or the empty string if the channel is not a snoop channel.
+// Snoop channels are named "Snoop/<spied channel ID>-<seq>".
+func snoopTarget(name string) string {
+	if !strings.HasPrefix(name, "Snoop/") {
+		return ""
+	}
+	id := strings.TrimPrefix(name, "Snoop/")
+	i := strings.LastIndex(id, "-")
+	if i <= 0 {
+		return ""
+	}
+	return id[:i]
+}
+
+// channelKind returns the call graph kind of the channel of the given name
+func channelKind(name string) string {
+	switch {
+	case localPartnerName(name) != "":
+		return proxy.CallGraphChannelLocal
+	case snoopTarget(name) != "":
+		return proxy.CallGraphChannelSnoop
+	}
+	return proxy.CallGraphChannelStandard
+}
+
+// buildCallGraph assembles the call graph of the given root channel from the
+// given snapshot of the channels and bridges of the node.  It walks from the
+// root through the bridges its channels are in, the other halves of Local
+// channels, and snoop channels, in both directions.
+func buildCallGraph(root string, channels []*ari.ChannelData, bridges []*ari.BridgeData) *proxy.CallGraph {
+	byID := make(map[string]*ari.ChannelData, len(channels))
+	byName := make(map[string]*ari.ChannelData, len(channels))
+	snoops := make(map[string][]*ari.ChannelData)
+	for _, c := range channels {
+		byID[c.ID] = c
+		byName[c.Name] = c
+		if target := snoopTarget(c.Name); target != "" {
+			snoops[target] = append(snoops[target], c)
+		}
+	}
+	bridgesOf := make(map[string][]*ari.BridgeData)
+	for _, b := range bridges {
+		for _, id := range b.ChannelIDs {
+			bridgesOf[id] = append(bridgesOf[id], b)
+		}
+	}
+
+	g := &proxy.CallGraph{Root: root}
+
+	seenChannels := make(map[string]bool)
+	seenBridges := make(map[string]bool)
+	queue := []string{root}
+
+	visit := func(id string) {
+		if !seenChannels[id] {
+			if _, ok := byID[id]; ok {
+				seenChannels[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+	seenChannels[root] = true
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		c, ok := byID[id]
+		if !ok {
+			continue
+		}
+		node := proxy.CallGraphChannel{
+			ID:    c.ID,
+			Name:  c.Name,
+			Kind:  channelKind(c.Name),
+			State: c.State,
+		}
+		if c.Caller != nil {
+			node.CallerNumber = c.Caller.Number
+		}
+		if c.Connected != nil {
+			node.ConnectedNumber = c.Connected.Number
+		}
+		g.Channels = append(g.Channels, node)
+
+		for _, b := range bridgesOf[id] {
+			g.Links = append(g.Links, proxy.CallGraphLink{
+				Type: proxy.CallGraphBridged,
+				From: id,
+				To:   b.ID,
+			})
+			if seenBridges[b.ID] {
+				continue
+			}
+			seenBridges[b.ID] = true
+			g.Bridges = append(g.Bridges, proxy.CallGraphBridge{
+				ID:         b.ID,
+				Type:       b.Type,
+				Technology: b.Technology,
+			})
+			for _, peer := range b.ChannelIDs {
+				visit(peer)
+			}
+		}
+
+		if partner, ok := byName[localPartnerName(c.Name)]; ok {
+			// Link the pair once, from its ;1 half
+			if strings.HasSuffix(c.Name, ";1") {
+				g.Links = append(g.Links, proxy.CallGraphLink{
+					Type: proxy.CallGraphLocalPair,
+					From: id,
+					To:   partner.ID,
+				})
+			}
+			visit(partner.ID)
+		}
+
+		if target := snoopTarget(c.Name); target != "" {
+			if _, ok := byID[target]; ok {
+				g.Links = append(g.Links, proxy.CallGraphLink{
+					Type: proxy.CallGraphSnoop,
+					From: id,
+					To:   target,
+				})
+				visit(target)
+			}
+		}
+		for _, snoop := range snoops[id] {
+			visit(snoop.ID)
+		}
+	}
+
+	return g
+}
+
+// snapshotTopology returns the data of all of the channels and bridges of the
+// node.  Entities may be destroyed while the snapshot is taken; those are left
+// out of it.
+func (s *Server) snapshotTopology() (channels []*ari.ChannelData, bridges []*ari.BridgeData, err error) {
+	channelKeys, err := s.ari.Channel().List(nil)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "failed to list channels")
+	}
+	bridgeKeys, err := s.ari.Bridge().List(nil)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "failed to list bridges")
+	}
+
+	for _, k := range channelKeys {
+		if d, err := s.ari.Channel().Data(k); err == nil {
+			channels = append(channels, d)
+		}
+	}
+	for _, k := range bridgeKeys {
+		if d, err := s.ari.Bridge().Data(k); err == nil {
+			bridges = append(bridges, d)
+		}
+	}
+	return channels, bridges, nil
+}
+
+func (s *Server) callGraph(ctx context.Context, reply string, req *proxy.Request) {
+	if _, err := s.ari.Channel().Data(req.Key); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	channels, bridges, err := s.snapshotTopology()
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	g := buildCallGraph(req.Key.ID, channels, bridges)
+	if len(g.Channels) == 0 {
+		// The root channel was destroyed while the snapshot was taken
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key,
+		Data: &proxy.EntityData{
+			CallGraph: g,
+		},
+	})
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestLocalPartnerName(t *testing.T) {
+	tests := map[string]string{
+		"Local/100@default-00000001;1": "Local/100@default-00000001;2",
+		"Local/100@default-00000001;2": "Local/100@default-00000001;1",
+		"PJSIP/100-00000001":           "",
+		"Local/100@default-00000001":   "",
+	}
+	for name, want := range tests {
+		if got := localPartnerName(name); got != want {
+			t.Errorf("localPartnerName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSnoopTarget(t *testing.T) {
+	tests := map[string]string{
+		"Snoop/1600000000.12-00000003": "1600000000.12",
+		"Snoop/-00000003":              "",
+		"PJSIP/100-00000001":           "",
+	}
+	for name, want := range tests {
+		if got := snoopTarget(name); got != want {
+			t.Errorf("snoopTarget(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBuildCallGraph(t *testing.T) {
+	channels := []*ari.ChannelData{
+		{ID: "caller", Name: "PJSIP/100-00000001", State: "Up", Caller: &ari.CallerID{Number: "100"}},
+		{ID: "local1", Name: "Local/200@default-00000002;1", State: "Up"},
+		{ID: "local2", Name: "Local/200@default-00000002;2", State: "Up"},
+		{ID: "callee", Name: "PJSIP/200-00000003", State: "Up"},
+		{ID: "snoop", Name: "Snoop/callee-00000004", State: "Up"},
+		{ID: "other", Name: "PJSIP/300-00000005", State: "Up"},
+	}
+	bridges := []*ari.BridgeData{
+		{ID: "b1", Type: "mixing", ChannelIDs: []string{"caller", "local1"}},
+		{ID: "b2", Type: "mixing", ChannelIDs: []string{"local2", "callee"}},
+		{ID: "b3", Type: "mixing", ChannelIDs: []string{"other"}},
+	}
+
+	g := buildCallGraph("caller", channels, bridges)
+
+	kinds := make(map[string]string)
+	for _, c := range g.Channels {
+		kinds[c.ID] = c.Kind
+	}
+	want := map[string]string{
+		"caller": proxy.CallGraphChannelStandard,
+		"local1": proxy.CallGraphChannelLocal,
+		"local2": proxy.CallGraphChannelLocal,
+		"callee": proxy.CallGraphChannelStandard,
+		"snoop":  proxy.CallGraphChannelSnoop,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("unexpected channels: %v", kinds)
+	}
+	for id, kind := range want {
+		if kinds[id] != kind {
+			t.Errorf("channel %s has kind %q, want %q", id, kinds[id], kind)
+		}
+	}
+	if g.Channels[0].ID != "caller" || g.Channels[0].CallerNumber != "100" {
+		t.Errorf("unexpected root channel: %+v", g.Channels[0])
+	}
+	if len(g.Bridges) != 2 {
+		t.Errorf("unexpected bridges: %+v", g.Bridges)
+	}
+
+	links := make(map[proxy.CallGraphLink]bool)
+	for _, l := range g.Links {
+		links[l] = true
+	}
+	for _, l := range []proxy.CallGraphLink{
+		{Type: proxy.CallGraphBridged, From: "caller", To: "b1"},
+		{Type: proxy.CallGraphBridged, From: "local1", To: "b1"},
+		{Type: proxy.CallGraphLocalPair, From: "local1", To: "local2"},
+		{Type: proxy.CallGraphBridged, From: "local2", To: "b2"},
+		{Type: proxy.CallGraphBridged, From: "callee", To: "b2"},
+		{Type: proxy.CallGraphSnoop, From: "snoop", To: "callee"},
+	} {
+		if !links[l] {
+			t.Errorf("missing link %+v", l)
+		}
+	}
+	if len(g.Links) != 6 {
+		t.Errorf("unexpected links: %+v", g.Links)
+	}
+}
+
+func TestBuildCallGraphMissingRoot(t *testing.T) {
+	g := buildCallGraph("gone", []*ari.ChannelData{{ID: "other", Name: "PJSIP/300-00000005"}}, nil)
+	if len(g.Channels) != 0 {
+		t.Errorf("unexpected channels: %+v", g.Channels)
+	}
+}
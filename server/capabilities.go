@@ -0,0 +1,247 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// SupportedKinds is the sorted list of request Kinds which the server
+// handles.  It is announced to clients for capability detection and must be
+// kept in sync with dispatchRequest.
+var SupportedKinds = []string{
+	"ApplicationData",
+	"ApplicationGet",
+	"ApplicationList",
+	"ApplicationSubscribe",
+	"ApplicationUnsubscribe",
+	"AsteriskConfigData",
+	"AsteriskConfigDelete",
+	"AsteriskConfigUpdate",
+	"AsteriskInfo",
+	"AsteriskLoggingCreate",
+	"AsteriskLoggingData",
+	"AsteriskLoggingDelete",
+	"AsteriskLoggingGet",
+	"AsteriskLoggingList",
+	"AsteriskLoggingRotate",
+	"AsteriskModuleData",
+	"AsteriskModuleGet",
+	"AsteriskModuleList",
+	"AsteriskModuleLoad",
+	"AsteriskModuleReload",
+	"AsteriskModuleUnload",
+	"AsteriskVariableGet",
+	"AsteriskVariableSet",
+	"AudioForkStart",
+	"AudioForkStop",
+	"BridgeAddChannel",
+	"BridgeAssemble",
+	"BridgeCreate",
+	"BridgeData",
+	"BridgeDelete",
+	"BridgeEnsure",
+	"BridgeGet",
+	"BridgeList",
+	"BridgeMOH",
+	"BridgePlay",
+	"BridgeRecord",
+	"BridgeRemoveChannel",
+	"BridgeStageCreate",
+	"BridgeStagePlay",
+	"BridgeStageRecord",
+	"BridgeStopMOH",
+	"BridgeSubscribe",
+	"BridgeUnsubscribe",
+	"BridgeVideoSource",
+	"BridgeVideoSourceDelete",
+	"CallGraph",
+	"CallHold",
+	"CallResume",
+	"CampaignPause",
+	"CampaignResume",
+	"CampaignStart",
+	"CampaignStats",
+	"CampaignStop",
+	"ChannelAMD",
+	"ChannelAnswer",
+	"ChannelBusy",
+	"ChannelCongestion",
+	"ChannelContinue",
+	"ChannelCreate",
+	"ChannelData",
+	"ChannelDial",
+	"ChannelExternalMedia",
+	"ChannelGet",
+	"ChannelHangup",
+	"ChannelHold",
+	"ChannelList",
+	"ChannelLocalPair",
+	"ChannelMOH",
+	"ChannelMove",
+	"ChannelMute",
+	"ChannelOriginate",
+	"ChannelPlay",
+	"ChannelRTPStatistics",
+	"ChannelRecord",
+	"ChannelRecordConsent",
+	"ChannelRing",
+	"ChannelSendDTMF",
+	"ChannelSilence",
+	"ChannelSnoop",
+	"ChannelStageExternalMedia",
+	"ChannelStageOriginate",
+	"ChannelStagePlay",
+	"ChannelStageRecord",
+	"ChannelStageSnoop",
+	"ChannelStopHold",
+	"ChannelStopMOH",
+	"ChannelStopRing",
+	"ChannelStopSilence",
+	"ChannelSubscribe",
+	"ChannelUnmute",
+	"ChannelVariableGet",
+	"ChannelVariableSet",
+	"ClusterInfo",
+	"CollectDigits",
+	"DebugCaptureData",
+	"DebugCaptureStart",
+	"DebugCaptureStop",
+	"DeviceStateData",
+	"DeviceStateDelete",
+	"DeviceStateGet",
+	"DeviceStateList",
+	"DeviceStateUpdate",
+	"DialCancel",
+	"EndpointData",
+	"EndpointGet",
+	"EndpointList",
+	"EndpointListByTech",
+	"FaxReceive",
+	"FaxSend",
+	"LogStreamStart",
+	"LogStreamStop",
+	"MailboxData",
+	"MailboxDelete",
+	"MailboxGet",
+	"MailboxList",
+	"MailboxUpdate",
+	"MaintenanceCancel",
+	"MaintenanceSchedule",
+	"Page",
+	"PlaybackControl",
+	"PlaybackData",
+	"PlaybackGet",
+	"PlaybackStop",
+	"PlaybackSubscribe",
+	"RecordingLiveData",
+	"RecordingLiveGet",
+	"RecordingLiveMute",
+	"RecordingLivePause",
+	"RecordingLiveResume",
+	"RecordingLiveScrap",
+	"RecordingLiveStop",
+	"RecordingLiveSubscribe",
+	"RecordingLiveUnmute",
+	"RecordingStoredCopy",
+	"RecordingStoredData",
+	"RecordingStoredDelete",
+	"RecordingStoredFile",
+	"RecordingStoredGet",
+	"RecordingStoredList",
+	"SecureInputStart",
+	"SecureInputStop",
+	"SoundData",
+	"SoundList",
+	"SoundUploadAbort",
+	"SoundUploadChunk",
+	"SoundUploadStart",
+	"VoicemailDeposit",
+	"VoicemailList",
+	"VoicemailRetrieve",
+	"Watch",
+	"WatchCancel",
+	"WatchRenew",
+}
+
+// isSupportedKind indicates whether the server handles the given request Kind
+func isSupportedKind(kind string) bool {
+	i := sort.SearchStrings(SupportedKinds, kind)
+	return i < len(SupportedKinds) && SupportedKinds[i] == kind
+}
+
+// features returns the optional features which are enabled on the server
+func (s *Server) features() (ret []string) {
+	if s.AMD != nil {
+		ret = append(ret, proxy.FeatureAMD)
+	}
+	if s.AudioFork != nil {
+		ret = append(ret, proxy.FeatureAudioFork)
+	}
+	if s.ClickToCall != nil {
+		ret = append(ret, proxy.FeatureClickToCall)
+	}
+	if s.Compression != nil {
+		ret = append(ret, proxy.FeatureCompression)
+	}
+	if s.DeadAir != nil {
+		ret = append(ret, proxy.FeatureDeadAir)
+	}
+	if s.EventTypeSubjects {
+		ret = append(ret, proxy.FeatureEventTypeSubjects)
+	}
+	if s.Fax != nil {
+		ret = append(ret, proxy.FeatureFax)
+	}
+	if s.Router != nil {
+		ret = append(ret, proxy.FeatureLCR)
+	}
+	if s.LogStream != nil {
+		ret = append(ret, proxy.FeatureLogStream)
+	}
+	if s.Quota != nil {
+		ret = append(ret, proxy.FeatureQuota)
+	}
+	if len(s.Screeners) > 0 {
+		ret = append(ret, proxy.FeatureScreening)
+	}
+	if s.StirShaken {
+		ret = append(ret, proxy.FeatureStirShaken)
+	}
+	if s.Voicemail != nil {
+		ret = append(ret, proxy.FeatureVoicemail)
+	}
+	sort.Strings(ret)
+	return
+}
+
+// encodings returns the response encodings which the server may use
+func (s *Server) encodings() []string {
+	if s.Compression == nil {
+		return []string{proxy.EncodingChunked}
+	}
+	return []string{proxy.EncodingGzip, proxy.EncodingChunked}
+}
+
+// newAnnouncement returns the server's announcement of its presence and
+// capabilities
+func (s *Server) newAnnouncement() *proxy.Announcement {
+	version, drivers := s.inventory.get()
+	return &proxy.Announcement{
+		Node:        s.nodeID(),
+		Application: s.Application,
+		Instance:    s.InstanceID,
+		Version:     s.Version,
+		Kinds:       s.announcedKinds(),
+		Encodings:   s.encodings(),
+		Features:    s.features(),
+		Draining:    s.draining(),
+		Leaving:     s.leaving(),
+		Maintenance: s.maintenance.get(),
+
+		AsteriskVersion: version,
+		ChannelDrivers:  drivers,
+		MaxCalls:        s.MaxCalls,
+		Labels:          s.Labels,
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// TestSupportedKinds verifies that SupportedKinds lists exactly the Kinds
+// handled by dispatchRequest
+func TestSupportedKinds(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "server.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dispatched []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "dispatchRequest" {
+			return true
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if c, ok := n.(*ast.CaseClause); ok {
+				for _, e := range c.List {
+					if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						v, _ := strconv.Unquote(lit.Value)
+						dispatched = append(dispatched, v)
+					}
+				}
+			}
+			return true
+		})
+		return false
+	})
+	sort.Strings(dispatched)
+
+	if !sort.StringsAreSorted(SupportedKinds) {
+		t.Error("SupportedKinds is not sorted")
+	}
+	if len(dispatched) != len(SupportedKinds) {
+		t.Fatalf("dispatchRequest handles %d kinds, SupportedKinds lists %d", len(dispatched), len(SupportedKinds))
+	}
+	for i := range dispatched {
+		if dispatched[i] != SupportedKinds[i] {
+			t.Errorf("kind mismatch: dispatched %q, listed %q", dispatched[i], SupportedKinds[i])
+		}
+	}
+}
+
+func TestAnnouncementFeatures(t *testing.T) {
+	s := &Server{
+		AsteriskID:  "node",
+		Application: "app",
+		InstanceID:  "in1",
+		Version:     "v5.0.0",
+		Compression: new(CompressionConfig),
+		StirShaken:  true,
+		MaxCalls:    500,
+		Labels:      map[string]string{"region": "eu-west-1"},
+	}
+	s.inventory.setVersion("18.9.0")
+	s.inventory.setChannelDrivers([]string{"chan_pjsip"})
+
+	a := s.newAnnouncement()
+	if a.Version != "v5.0.0" || a.Instance != "in1" || len(a.Kinds) != len(SupportedKinds) {
+		t.Errorf("unexpected announcement: %+v", a)
+	}
+	if a.AsteriskVersion != "18.9.0" || a.MaxCalls != 500 || !a.HasChannelDriver("chan_pjsip") || !a.HasLabel("region", "eu-west-1") {
+		t.Errorf("unexpected inventory: %+v", a)
+	}
+	if len(a.Encodings) != 2 || a.Encodings[0] != "gzip" || a.Encodings[1] != "chunked" {
+		t.Errorf("unexpected encodings: %v", a.Encodings)
+	}
+	if !a.HasFeature("compression") || !a.HasFeature("stir_shaken") || a.HasFeature("fax") {
+		t.Errorf("unexpected features: %v", a.Features)
+	}
+}
+
+func TestChannelDrivers(t *testing.T) {
+	got := channelDrivers([]string{"res_ari.so", "chan_pjsip.so", "app_dial.so", "chan_audiosocket.so", "chan_local"})
+	want := []string{"chan_audiosocket", "chan_local", "chan_pjsip"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -3,10 +3,13 @@ package server
 import (
 	"context"
 	"errors"
+	"net/url"
+	"strings"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
 )
 
 func (s *Server) channelAnswer(ctx context.Context, reply string, req *proxy.Request) {
@@ -34,12 +37,29 @@ func (s *Server) channelCongestion(ctx context.Context, reply string, req *proxy
 }
 
 func (s *Server) channelCreate(ctx context.Context, reply string, req *proxy.Request) {
+	var err error
+
 	create := req.ChannelCreate.ChannelCreateRequest
 
 	if create.ChannelID == "" {
 		create.ChannelID = rid.New(rid.Channel)
 	}
 
+	dest := create.Endpoint
+	create.Endpoint, err = s.rewriteEndpoint(create.Endpoint, req)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if err = s.admitChannel(req, create.ChannelID, false, dest, create.Endpoint); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// The other half of a Local channel is originated as well
+	s.originated.add(create.OtherChannelID)
+
 	// bind dialog
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", create.ChannelID)
@@ -48,6 +68,7 @@ func (s *Server) channelCreate(ctx context.Context, reply string, req *proxy.Req
 
 	h, err := s.ari.Channel().Create(req.Key, create)
 	if err != nil {
+		s.releaseChannel(create.ChannelID)
 		s.sendError(reply, err)
 		return
 	}
@@ -59,6 +80,9 @@ func (s *Server) channelCreate(ctx context.Context, reply string, req *proxy.Req
 
 func (s *Server) channelData(ctx context.Context, reply string, req *proxy.Request) {
 	d, err := s.ari.Channel().Data(req.Key)
+	if err == nil {
+		d, err = proxy.SelectChannelFields(d, req.Fields)
+	}
 	if err != nil {
 		s.sendError(reply, err)
 		return
@@ -87,16 +111,14 @@ func (s *Server) channelContinue(ctx context.Context, reply string, req *proxy.R
 	s.sendError(reply, s.ari.Channel().Continue(req.Key, req.ChannelContinue.Context, req.ChannelContinue.Extension, req.ChannelContinue.Priority))
 }
 
-func (s *Server) channelDial(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Dial(req.Key, req.ChannelDial.Caller, req.ChannelDial.Timeout))
-}
-
 func (s *Server) channelHangup(ctx context.Context, reply string, req *proxy.Request) {
 	s.sendError(reply, s.ari.Channel().Hangup(req.Key, req.ChannelHangup.Reason))
 }
 
 func (s *Server) channelHold(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Hold(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().Hold(req.Key)
+	}))
 }
 
 func (s *Server) channelList(ctx context.Context, reply string, req *proxy.Request) {
@@ -106,20 +128,57 @@ func (s *Server) channelList(ctx context.Context, reply string, req *proxy.Reque
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) channelMOH(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().MOH(req.Key, req.ChannelMOH.Music))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().MOH(req.Key, req.ChannelMOH.Music)
+	}))
+}
+
+// channelMove moves the channel to another Stasis application, through the
+// REST interface, as the ARI client library does not provide the operation
+func (s *Server) channelMove(ctx context.Context, reply string, req *proxy.Request) {
+	if req.ChannelMove == nil || req.ChannelMove.Application == "" {
+		s.sendError(reply, eris.New("no application to move the channel to"))
+		return
+	}
+
+	params := url.Values{}
+	params.Set("app", req.ChannelMove.Application)
+	if len(req.ChannelMove.Args) > 0 {
+		params.Set("appArgs", strings.Join(req.ChannelMove.Args, ","))
+	}
+	s.sendError(reply, s.rest.post("/channels/"+url.PathEscape(req.Key.ID)+"/move", params))
+}
+
+// channelRTPStatistics returns the RTP statistics of the channel, through the
+// REST interface, as the ARI client library does not provide the operation
+func (s *Server) channelRTPStatistics(ctx context.Context, reply string, req *proxy.Request) {
+	stats := new(proxy.RTPStatistics)
+	if err := s.rest.get("/channels/"+url.PathEscape(req.Key.ID)+"/rtp_statistics", stats); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key,
+		Data: &proxy.EntityData{
+			RTPStatistics: stats,
+		},
+	})
 }
 
 func (s *Server) channelMute(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Mute(req.Key, req.ChannelMute.Direction))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().Mute(req.Key, req.ChannelMute.Direction)
+	}))
 }
 
 func (s *Server) channelOriginate(ctx context.Context, reply string, req *proxy.Request) {
+	var err error
+
 	if req.ChannelOriginate == nil {
 		s.sendError(reply, errors.New("OriginateRequest is mandatory"))
 		return
@@ -130,6 +189,21 @@ func (s *Server) channelOriginate(ctx context.Context, reply string, req *proxy.
 		orig.ChannelID = rid.New(rid.Channel)
 	}
 
+	dest := orig.Endpoint
+	orig.Endpoint, err = s.rewriteEndpoint(orig.Endpoint, req)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if err = s.admitChannel(req, orig.ChannelID, true, dest, orig.Endpoint, orig.Extension); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// The other half of a Local channel is originated as well
+	s.originated.add(orig.OtherChannelID)
+
 	if req.Key != nil && req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", orig.ChannelID)
 		if orig.OtherChannelID != "" {
@@ -143,8 +217,9 @@ func (s *Server) channelOriginate(ctx context.Context, reply string, req *proxy.
 		}
 	}
 
-	h, err := s.ari.Channel().Originate(req.Key, orig)
+	h, err := s.originate(req, orig)
 	if err != nil {
+		s.releaseChannel(orig.ChannelID)
 		s.sendError(reply, err)
 		return
 	}
@@ -164,6 +239,7 @@ func (s *Server) channelStageOriginate(ctx context.Context, reply string, req *p
 	if orig.ChannelID == "" {
 		orig.ChannelID = rid.New(rid.Channel)
 	}
+	s.originated.add(orig.ChannelID, orig.OtherChannelID)
 
 	if req.Key != nil && req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", orig.ChannelID)
@@ -180,6 +256,7 @@ func (s *Server) channelStageOriginate(ctx context.Context, reply string, req *p
 
 	h, err := s.ari.Channel().StageOriginate(req.Key, orig)
 	if err != nil {
+		s.originated.remove(orig.ChannelID)
 		s.sendError(reply, err)
 		return
 	}
@@ -190,6 +267,15 @@ func (s *Server) channelStageOriginate(ctx context.Context, reply string, req *p
 }
 
 func (s *Server) channelPlay(ctx context.Context, reply string, req *proxy.Request) {
+	if err := validateMedia(req.ChannelPlay.Media()); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	if err := validatePlayOptions(req.ChannelPlay.PlayOptions); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
 	data, err := s.ari.Channel().Data(req.Key)
 	if err != nil || data == nil {
 		s.sendError(reply, err)
@@ -205,14 +291,14 @@ func (s *Server) channelPlay(ctx context.Context, reply string, req *proxy.Reque
 		s.Dialog.Bind(req.Key.Dialog, "playback", req.ChannelPlay.PlaybackID)
 	}
 
-	ph, err := s.ari.Channel().Play(req.Key, req.ChannelPlay.PlaybackID, req.ChannelPlay.MediaURI)
+	k, err := s.play(req.Key, req.ChannelPlay.PlaybackID, req.ChannelPlay.Media(), req.ChannelPlay.PlayOptions)
 	if err != nil {
 		s.sendError(reply, err)
 		return
 	}
 
 	s.publish(reply, &proxy.Response{
-		Key: ph.Key(),
+		Key: k,
 	})
 }
 
@@ -239,8 +325,21 @@ func (s *Server) channelStagePlay(ctx context.Context, reply string, req *proxy.
 }
 
 func (s *Server) channelRecord(ctx context.Context, reply string, req *proxy.Request) {
-	if req.ChannelRecord.Name == "" {
-		req.ChannelRecord.Name = rid.New(rid.Recording)
+	name, err := s.recordingName(req.ChannelRecord.Name, req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	req.ChannelRecord.Name = name
+
+	if req.ChannelRecord.Options, err = s.recordingOptions(req.ChannelRecord.Options); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if err := s.quota.AdmitRecording(s.Application, req.Tenant, req.ChannelRecord.Name); err != nil {
+		s.sendError(reply, err)
+		return
 	}
 
 	if req.Key.Dialog != "" {
@@ -250,9 +349,11 @@ func (s *Server) channelRecord(ctx context.Context, reply string, req *proxy.Req
 
 	h, err := s.ari.Channel().Record(req.Key, req.ChannelRecord.Name, req.ChannelRecord.Options)
 	if err != nil {
+		s.quota.ReleaseRecording(req.ChannelRecord.Name)
 		s.sendError(reply, err)
 		return
 	}
+	s.limitRecording(req.ChannelRecord.Name, req.Key, req.ChannelRecord.Options)
 
 	s.publish(reply, &proxy.Response{
 		Key: h.Key(),
@@ -266,9 +367,12 @@ func (s *Server) channelStageRecord(ctx context.Context, reply string, req *prox
 		return
 	}
 
-	if req.ChannelRecord.Name == "" {
-		req.ChannelRecord.Name = rid.New(rid.Recording)
+	name, err := s.recordingName(req.ChannelRecord.Name, req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
 	}
+	req.ChannelRecord.Name = name
 
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", data.ID)
@@ -281,7 +385,9 @@ func (s *Server) channelStageRecord(ctx context.Context, reply string, req *prox
 }
 
 func (s *Server) channelRing(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Ring(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().Ring(req.Key)
+	}))
 }
 
 func (s *Server) channelSendDTMF(ctx context.Context, reply string, req *proxy.Request) {
@@ -289,7 +395,9 @@ func (s *Server) channelSendDTMF(ctx context.Context, reply string, req *proxy.R
 }
 
 func (s *Server) channelSilence(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Silence(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().Silence(req.Key)
+	}))
 }
 
 func (s *Server) channelSnoop(ctx context.Context, reply string, req *proxy.Request) {
@@ -297,12 +405,18 @@ func (s *Server) channelSnoop(ctx context.Context, reply string, req *proxy.Requ
 		req.ChannelSnoop.SnoopID = rid.New(rid.Snoop)
 	}
 
+	if err := s.admitChannel(req, req.ChannelSnoop.SnoopID, false); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
 	if req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", req.ChannelSnoop.SnoopID)
 	}
 
 	h, err := s.ari.Channel().Snoop(req.Key, req.ChannelSnoop.SnoopID, req.ChannelSnoop.Options)
 	if err != nil {
+		s.releaseChannel(req.ChannelSnoop.SnoopID)
 		s.sendError(reply, err)
 		return
 	}
@@ -344,12 +458,18 @@ func (s *Server) channelExternalMedia(ctx context.Context, reply string, req *pr
 		opts.ChannelID = rid.New(rid.Channel)
 	}
 
+	if err := s.admitChannel(req, opts.ChannelID, false); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
 	if req.Key != nil && req.Key.Dialog != "" {
 		s.Dialog.Bind(req.Key.Dialog, "channel", opts.ChannelID)
 	}
 
 	h, err := s.ari.Channel().ExternalMedia(req.Key, opts)
 	if err != nil {
+		s.releaseChannel(opts.ChannelID)
 		s.sendError(reply, err)
 		return
 	}
@@ -386,19 +506,27 @@ func (s *Server) channelStageExternalMedia(ctx context.Context, reply string, re
 }
 
 func (s *Server) channelStopHold(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().StopHold(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().StopHold(req.Key)
+	}))
 }
 
 func (s *Server) channelStopMOH(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().StopMOH(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().StopMOH(req.Key)
+	}))
 }
 
 func (s *Server) channelStopRing(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().StopRing(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().StopRing(req.Key)
+	}))
 }
 
 func (s *Server) channelStopSilence(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().StopSilence(req.Key))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().StopSilence(req.Key)
+	}))
 }
 
 func (s *Server) channelSubscribe(ctx context.Context, reply string, req *proxy.Request) {
@@ -411,7 +539,9 @@ func (s *Server) channelSubscribe(ctx context.Context, reply string, req *proxy.
 }
 
 func (s *Server) channelUnmute(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Channel().Unmute(req.Key, req.ChannelMute.Direction))
+	s.sendError(reply, s.retryInvalidState(ctx, func() error {
+		return s.ari.Channel().Unmute(req.Key, req.ChannelMute.Direction)
+	}))
 }
 
 func (s *Server) channelVariableGet(ctx context.Context, reply string, req *proxy.Request) {
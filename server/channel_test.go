@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/internal/integration"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
 )
 
 func TestChannelData(t *testing.T) {
@@ -113,3 +119,51 @@ func TestChannelVariableGet(t *testing.T) {
 func TestChannelVariableSet(t *testing.T) {
 	integration.TestChannelVariableSet(t, &srv{})
 }
+
+func TestChannelMove(t *testing.T) {
+	var method, path, query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.rest = newARIREST(&native.Options{URL: ts.URL + "/ari"})
+
+	s.channelMove(context.Background(), "", &proxy.Request{
+		Kind:        "ChannelMove",
+		Key:         ari.NewKey(ari.ChannelKey, "c1"),
+		ChannelMove: &proxy.ChannelMove{Application: "queue", Args: []string{"sales", "vip"}},
+	})
+	if method != http.MethodPost || path != "/ari/channels/c1/move" {
+		t.Errorf("unexpected request %s %s", method, path)
+	}
+	if query != "app=queue&appArgs=sales%2Cvip" {
+		t.Errorf("unexpected query: %s", query)
+	}
+}
+
+func TestChannelRTPStatistics(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"txcount":100,"rxcount":98,"rxjitter":0.002,"rxploss":2,"rtt":0.045,"local_ssrc":1234,"channel_uniqueid":"1600000000.1"}`)) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.rest = newARIREST(&native.Options{URL: ts.URL + "/ari"})
+
+	stats := new(proxy.RTPStatistics)
+	if err := s.rest.get("/channels/c1/rtp_statistics", stats); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/ari/channels/c1/rtp_statistics" {
+		t.Errorf("unexpected path %s", path)
+	}
+	if stats.TxCount != 100 || stats.RxPacketLoss != 2 || stats.RTT != 0.045 || stats.LocalSSRC != 1234 || stats.ChannelUniqueID != "1600000000.1" {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// ClickToCallAppArgs is the application argument of the channels created by
+// click-to-call requests, whose StasisStart events are withheld from clients
+const ClickToCallAppArgs = "ari-proxy-click-to-call"
+
+// isClickToCallStart indicates whether the StasisStart is that of a leg of a
+// click-to-call call
+func isClickToCallStart(e *ari.StasisStart) bool {
+	return len(e.Args) == 1 && e.Args[0] == ClickToCallAppArgs
+}
+
+// clickToCallNumber restricts the characters which may be substituted into
+// the endpoint templates
+var clickToCallNumber = regexp.MustCompile(`^[+0-9A-Za-z*#._-]{1,64}$`)
+
+// ClickToCallConfig describes the optional click-to-call HTTP endpoint.  A
+// request to `POST /call?from=<from>&to=<to>` (or with a form or JSON body
+// containing those parameters) calls the `from` party and, once answered,
+// calls the `to` party and bridges the two.
+//
+// Requests are authenticated with the Token, passed either as a bearer token
+// in the Authorization header or as the `token` parameter of the form or JSON
+// body; it is not accepted in the query string, which is commonly logged.
+type ClickToCallConfig struct {
+	// Listen is the address on which to listen (e.g. ":9990" or
+	// "unix:/run/ari-proxy/clicktocall.sock")
+	Listen string `mapstructure:"listen"`
+
+	// Token is the shared secret which authenticates requests.  It is required.
+	Token string `mapstructure:"token"`
+
+	// FromEndpoint is the endpoint template of the calling party, in which
+	// `{from}` is replaced.  It defaults to "PJSIP/{from}".
+	FromEndpoint string `mapstructure:"from_endpoint"`
+
+	// ToEndpoint is the endpoint template of the called party, in which
+	// `{to}` is replaced.  It defaults to "PJSIP/{to}".
+	ToEndpoint string `mapstructure:"to_endpoint"`
+
+	// CallerID is the caller ID presented to the called party
+	CallerID string `mapstructure:"caller_id"`
+
+	// Timeout is the time to wait for each party to answer.  It defaults to
+	// thirty seconds.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Tenant is the tenant against whose quotas the calls are counted
+	Tenant string `mapstructure:"tenant"`
+}
+
+type clickToCallRequest struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Token string `json:"token"`
+}
+
+// startClickToCall starts the click-to-call HTTP endpoint, which is stopped
+// when the context is closed
+func (s *Server) startClickToCall(ctx context.Context) error {
+	if s.ClickToCall.Token == "" {
+		return eris.New("click-to-call requires a token")
+	}
+
+	ln, err := listen(s.ClickToCall.Listen)
+	if err != nil {
+		return eris.Wrap(err, "failed to listen for click-to-call requests")
+	}
+
+	srv := &http.Server{
+		Handler:      s.clickToCallHandler(ctx),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close() // nolint: errcheck
+	}()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.Log.Error("click-to-call endpoint failed", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) clickToCallHandler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/call", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req clickToCallRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		} else {
+			req.From = r.FormValue("from")
+			req.To = r.FormValue("to")
+			req.Token = r.PostFormValue("token")
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = req.Token
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.ClickToCall.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !clickToCallNumber.MatchString(req.From) || !clickToCallNumber.MatchString(req.To) {
+			http.Error(w, "invalid from or to", http.StatusBadRequest)
+			return
+		}
+
+		id, err := s.clickToCall(ctx, req.From, req.To)
+		if err != nil {
+			s.Log.Warn("click-to-call failed", "from", req.From, "to", req.To, "error", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"channel_id": id}) // nolint: errcheck
+	})
+	return mux
+}
+
+// clickToCall originates the calling party and starts the flow which calls
+// and bridges the called party once it answers.  It returns the channel ID of
+// the calling party.
+func (s *Server) clickToCall(ctx context.Context, from, to string) (string, error) {
+	cfg := s.ClickToCall
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	fromTmpl := cfg.FromEndpoint
+	if fromTmpl == "" {
+		fromTmpl = "PJSIP/{from}"
+	}
+
+	req := &proxy.Request{
+		Kind:   "ClickToCall",
+		Key:    ari.NewKey(ari.ChannelKey, rid.New(rid.Channel)),
+		Tenant: cfg.Tenant,
+	}
+
+	orig := ari.OriginateRequest{
+		Endpoint:  strings.Replace(fromTmpl, "{from}", from, -1),
+		Timeout:   int(timeout / time.Second),
+		CallerID:  to,
+		App:       s.Application,
+		AppArgs:   ClickToCallAppArgs,
+		ChannelID: req.Key.ID,
+	}
+
+	// Subscribe before originating, so that no lifecycle events are missed
+	sub := s.ari.Bus().Subscribe(nil, ari.Events.StasisStart, ari.Events.ChannelDestroyed)
+
+	if err := s.originateLeg(req, &orig); err != nil {
+		sub.Cancel()
+		return "", err
+	}
+
+	go s.runClickToCall(ctx, req, sub, to, timeout)
+
+	return req.Key.ID, nil
+}
+
+// originateLeg originates a proxy-initiated channel through the endpoint
+// rewriting, quota, and routing policies
+func (s *Server) originateLeg(req *proxy.Request, orig *ari.OriginateRequest) error {
+	dest := orig.Endpoint
+
+	var err error
+	if orig.Endpoint, err = s.rewriteEndpoint(orig.Endpoint, req); err != nil {
+		return err
+	}
+	if err = s.admitChannel(req, orig.ChannelID, true, dest, orig.Endpoint); err != nil {
+		return err
+	}
+	if _, err = s.originate(req, *orig); err != nil {
+		s.releaseChannel(orig.ChannelID)
+		return err
+	}
+	return nil
+}
+
+// runClickToCall calls the `to` party once the `from` party has answered,
+// bridges the two, and tears the call down when either party hangs up
+func (s *Server) runClickToCall(ctx context.Context, req *proxy.Request, sub ari.Subscription, to string, timeout time.Duration) {
+	defer sub.Cancel()
+
+	cfg := s.ClickToCall
+
+	toTmpl := cfg.ToEndpoint
+	if toTmpl == "" {
+		toTmpl = "PJSIP/{to}"
+	}
+
+	fromID := req.Key.ID
+	toID := rid.New(rid.Channel)
+	bridgeKey := ari.NewKey(ari.BridgeKey, rid.New(rid.Bridge))
+
+	var bridged bool
+	defer func() {
+		if ctx.Err() != nil {
+			// The server is shutting down; leave the call in place
+			return
+		}
+		for _, id := range []string{fromID, toID} {
+			s.ari.Channel().Hangup(ari.NewKey(ari.ChannelKey, id), "normal") // nolint: errcheck
+		}
+		if bridged {
+			s.destroyBridge(bridgeKey)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-sub.Events():
+			switch v := e.(type) {
+			case *ari.ChannelDestroyed:
+				if v.Channel.ID == fromID || v.Channel.ID == toID {
+					return
+				}
+			case *ari.StasisStart:
+				switch v.Channel.ID {
+				case fromID:
+					if _, err := s.ari.Bridge().Create(bridgeKey, "mixing", "click-to-call-"+fromID); err != nil {
+						s.Log.Warn("failed to create click-to-call bridge", "error", err)
+						return
+					}
+					bridged = true
+
+					if err := s.ari.Bridge().AddChannel(bridgeKey, fromID); err != nil {
+						s.Log.Warn("failed to bridge click-to-call party", "channel", fromID, "error", err)
+						return
+					}
+					s.ari.Channel().Ring(req.Key) // nolint: errcheck
+
+					orig := ari.OriginateRequest{
+						Endpoint:   strings.Replace(toTmpl, "{to}", to, -1),
+						Timeout:    int(timeout / time.Second),
+						CallerID:   cfg.CallerID,
+						App:        s.Application,
+						AppArgs:    ClickToCallAppArgs,
+						ChannelID:  toID,
+						Originator: fromID,
+					}
+					if err := s.originateLeg(req, &orig); err != nil {
+						s.Log.Warn("failed to call click-to-call destination", "to", to, "error", err)
+						return
+					}
+				case toID:
+					s.ari.Channel().StopRing(req.Key) // nolint: errcheck
+					if err := s.ari.Bridge().AddChannel(bridgeKey, toID); err != nil {
+						s.Log.Warn("failed to bridge click-to-call party", "channel", toID, "error", err)
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+func TestClickToCallHandlerRejects(t *testing.T) {
+	s := &Server{
+		ClickToCall: &ClickToCallConfig{Token: "secret"},
+		Log:         log15.New(),
+	}
+	h := s.clickToCallHandler(context.Background())
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		auth   string
+		code   int
+	}{
+		{"wrong method", http.MethodGet, "/call?from=101&to=102&token=secret", "", http.StatusMethodNotAllowed},
+		{"no token", http.MethodPost, "/call?from=101&to=102", "", http.StatusUnauthorized},
+		{"bad token", http.MethodPost, "/call?from=101&to=102", "Bearer nope", http.StatusUnauthorized},
+		{"missing to", http.MethodPost, "/call?from=101", "Bearer secret", http.StatusBadRequest},
+		{"token in query", http.MethodPost, "/call?from=101&to=102&token=secret", "", http.StatusUnauthorized},
+		{"invalid from", http.MethodPost, "/call?from=101@evil&to=102", "Bearer secret", http.StatusBadRequest},
+		{"token in form", http.MethodPost, "/call?from=101@evil&to=102", "form", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(""))
+		switch {
+		case tt.auth == "form":
+			r = httptest.NewRequest(tt.method, tt.target, strings.NewReader("token=secret"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		case tt.auth != "":
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.code, w.Code)
+		}
+	}
+}
+
+func TestIsClickToCallStart(t *testing.T) {
+	if !isClickToCallStart(&ari.StasisStart{Args: []string{ClickToCallAppArgs}}) {
+		t.Error("click-to-call leg not recognized")
+	}
+	if isClickToCallStart(&ari.StasisStart{Args: []string{"inbound"}}) || isClickToCallStart(new(ari.StasisStart)) {
+		t.Error("other call taken for a click-to-call leg")
+	}
+}
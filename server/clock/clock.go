@@ -0,0 +1,72 @@
+// Package clock provides the time source of the proxy server, so that tests
+// (and replays of recorded sessions) may control time deterministically.
+package clock
+
+import "time"
+
+// Clock is a source of time and timers
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel
+	After(d time.Duration) <-chan time.Time
+
+	// AfterFunc waits for the duration to elapse and then calls f in its own
+	// goroutine
+	AfterFunc(d time.Duration, f func()) Timer
+
+	// NewTicker returns a ticker which sends the current time on its channel
+	// after each period
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event, created by Clock.AfterFunc
+type Timer interface {
+	// Stop prevents the timer from firing, returning false if it already
+	// fired or was stopped
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration, returning whether
+	// it had been active
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks at intervals, created by Clock.NewTicker
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered
+	C() <-chan time.Time
+
+	// Stop turns off the ticker
+	Stop()
+}
+
+// Real is the Clock of the system
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
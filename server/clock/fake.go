@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only changes when it is advanced, for tests and
+// replays.  Its timers and tickers fire, in order, as it is advanced past
+// their deadlines.
+type Fake struct {
+	now     time.Time
+	waiters []*waiter
+
+	mu sync.Mutex
+}
+
+// NewFake returns a Fake clock set to the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// waiter is a timer or ticker of a Fake clock
+type waiter struct {
+	f *Fake
+
+	at     time.Time
+	period time.Duration
+
+	fn func()
+	ch chan time.Time
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After implements Clock
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	f.add(&waiter{f: f, at: f.Now().Add(d), ch: ch})
+	return ch
+}
+
+// AfterFunc implements Clock
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &waiter{f: f, at: f.Now().Add(d), fn: fn}
+	f.add(w)
+	return w
+}
+
+// NewTicker implements Clock
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &waiter{f: f, at: f.Now().Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.add(w)
+	return fakeTicker{w}
+}
+
+// Waiters returns the number of timers and tickers which have yet to fire
+// (or, for tickers, have not been stopped).  Tests use it to wait until the
+// goroutines under test have set their timers before advancing the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// Set advances the clock to the given time, firing the timers and tickers due
+// by then.  The clock is never set back.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		w := f.next(t)
+		if w == nil {
+			break
+		}
+		f.now = w.at
+		w.fire()
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// Advance advances the clock by the given duration, firing the timers and
+// tickers due by then
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// next returns the earliest waiter due by the given time, if any.  The clock
+// lock must be held.
+func (f *Fake) next(t time.Time) *waiter {
+	var ret *waiter
+	for _, w := range f.waiters {
+		if !w.at.After(t) && (ret == nil || w.at.Before(ret.at)) {
+			ret = w
+		}
+	}
+	return ret
+}
+
+func (f *Fake) add(w *waiter) {
+	f.mu.Lock()
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+}
+
+// remove removes the given waiter, returning whether it was present.  The
+// clock lock must be held.
+func (f *Fake) remove(w *waiter) bool {
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fire fires the waiter at the current time of the clock, rescheduling it if
+// it is a ticker.  The clock lock must be held.
+func (w *waiter) fire() {
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+	} else {
+		w.f.remove(w)
+	}
+
+	if w.fn != nil {
+		go w.fn()
+	}
+	if w.ch != nil {
+		// Like the tickers of the time package, drop the ticks which are
+		// not received in time
+		select {
+		case w.ch <- w.f.now:
+		default:
+		}
+	}
+}
+
+// Stop implements Timer
+func (w *waiter) Stop() bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	return w.f.remove(w)
+}
+
+// Reset implements Timer
+func (w *waiter) Reset(d time.Duration) bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+
+	active := w.f.remove(w)
+	w.at = w.f.now.Add(d)
+	w.f.waiters = append(w.f.waiters, w)
+	return active
+}
+
+// fakeTicker is a Ticker of a Fake clock
+type fakeTicker struct {
+	w *waiter
+}
+
+// C implements Ticker
+func (t fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+// Stop implements Ticker
+func (t fakeTicker) Stop() {
+	t.w.Stop()
+}
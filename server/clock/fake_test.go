@@ -0,0 +1,87 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeTimers(t *testing.T) {
+	f := NewFake(epoch)
+
+	fired := make(chan struct{}, 1)
+	f.AfterFunc(2*time.Second, func() { fired <- struct{}{} })
+	stopped := f.AfterFunc(time.Second, func() { t.Error("stopped timer fired") })
+	after := f.After(3 * time.Second)
+
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("unexpected results of Stop")
+	}
+
+	f.Advance(time.Second)
+	select {
+	case <-fired:
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	f.Advance(2 * time.Second)
+	<-fired
+	if now := <-after; !now.Equal(epoch.Add(3 * time.Second)) {
+		t.Errorf("After fired at %v", now)
+	}
+	if !f.Now().Equal(epoch.Add(3*time.Second)) || f.Waiters() != 0 {
+		t.Errorf("unexpected clock state %v, %d waiters", f.Now(), f.Waiters())
+	}
+}
+
+func TestFakeTimerReset(t *testing.T) {
+	f := NewFake(epoch)
+
+	fired := make(chan struct{}, 1)
+	timer := f.AfterFunc(time.Second, func() { fired <- struct{}{} })
+
+	f.Advance(500 * time.Millisecond)
+	if !timer.Reset(time.Second) {
+		t.Error("active timer reported inactive")
+	}
+	f.Advance(900 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("reset timer fired at its original deadline")
+	default:
+	}
+	f.Advance(100 * time.Millisecond)
+	<-fired
+
+	if timer.Reset(time.Second) {
+		t.Error("fired timer reported active")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+
+	f.Advance(time.Second)
+	if now := <-ticker.C(); !now.Equal(epoch.Add(time.Second)) {
+		t.Errorf("tick at %v", now)
+	}
+
+	// Ticks which are not received are dropped
+	f.Advance(3 * time.Second)
+	if now := <-ticker.C(); !now.Equal(epoch.Add(2 * time.Second)) {
+		t.Errorf("tick at %v", now)
+	}
+	select {
+	case <-ticker.C():
+		t.Error("unexpected buffered tick")
+	default:
+	}
+
+	ticker.Stop()
+	if f.Waiters() != 0 {
+		t.Error("stopped ticker still waiting")
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+)
+
+func TestQuotaOriginateRateClock(t *testing.T) {
+	f := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newQuotaEngine(&QuotaConfig{Default: QuotaLimits{OriginatesPerMinute: 1}})
+	q.clock = f
+
+	if err := q.AdmitChannel("app", "", "c1", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f.Advance(59 * time.Second)
+	if err := q.AdmitChannel("app", "", "c2", true); err == nil {
+		t.Error("expected originate rate error")
+	}
+	f.Advance(time.Second)
+	if err := q.AdmitChannel("app", "", "c3", true); err != nil {
+		t.Errorf("unexpected error once the minute elapsed: %s", err)
+	}
+}
+
+func TestMaintenanceClock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := clock.NewFake(now)
+	s := New(WithClock(f))
+	s.maintenance.clock = f
+
+	changes := make(chan struct{}, 2)
+	s.maintenance.set(&proxy.MaintenanceWindow{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}, func() {
+		changes <- struct{}{}
+	})
+
+	if s.draining() {
+		t.Error("draining before the window")
+	}
+	f.Advance(time.Hour)
+	<-changes
+	if !s.draining() {
+		t.Error("not draining during the window")
+	}
+	f.Advance(time.Hour)
+	<-changes
+	if s.draining() || s.maintenance.get() != nil {
+		t.Error("window not expired")
+	}
+}
@@ -1,28 +1,101 @@
 package server
 
+import (
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultShutdownGracePeriod is the default time allowed for the cleanup of
+// the server's subcomponents when it stops
+const DefaultShutdownGracePeriod = 5 * time.Second
+
+// ShutdownStats describes the cleanups performed when the server stopped
+type ShutdownStats struct {
+	// Shutdowns is the number of times the server has stopped
+	Shutdowns int64
+
+	// CleanupErrors is the number of cleanups which failed
+	CleanupErrors int64
+
+	// Timeouts is the number of shutdowns whose cleanup did not complete
+	// within the grace period
+	Timeouts int64
+
+	// LastDuration is the duration of the cleanup of the last shutdown
+	LastDuration time.Duration
+}
+
+// closeGroup is the set of cleanups of the subcomponents of a running server
 type closeGroup struct {
-	count   int
-	closeCh chan struct{}
+	closers []closer
 }
 
-func (cg *closeGroup) Add(fn func() error) func() {
-	if cg.count == 0 {
-		cg.closeCh = make(chan struct{})
-	}
-	cg.count++
-	return func() {
-		err := fn()
-		if err != nil {
-			panic(err.Error())
-		}
-		cg.count--
-		if cg.count == 0 {
-			close(cg.closeCh)
-			cg.count = -1
+// closer is a named cleanup function
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// Add registers the named cleanup function
+func (cg *closeGroup) Add(name string, fn func() error) {
+	cg.closers = append(cg.closers, closer{name: name, fn: fn})
+}
+
+// Close runs the cleanup functions, in the reverse order of their addition,
+// logging any which fail.  It waits for them for at most the given grace
+// period; any which have not completed by then are abandoned and keep running
+// in the background.
+func (cg *closeGroup) Close(grace time.Duration, log log15.Logger) (failed int, completed bool) {
+	var mu sync.Mutex
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for i := len(cg.closers) - 1; i >= 0; i-- {
+			c := cg.closers[i]
+			if err := c.fn(); err != nil && err != nats.ErrConnectionClosed {
+				log.Warn("failed to clean up on shutdown", "component", c.name, "error", err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
 		}
+	}()
+
+	select {
+	case <-done:
+		completed = true
+	case <-time.After(grace):
+		log.Error("timeout waiting for shutdown of sub components", "grace", grace)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return failed, completed
+}
+
+// shutdownTracker accumulates the ShutdownStats of a server
+type shutdownTracker struct {
+	stats ShutdownStats
+	mu    sync.Mutex
+}
+
+func (t *shutdownTracker) record(failed int, completed bool, d time.Duration) {
+	t.mu.Lock()
+	t.stats.Shutdowns++
+	t.stats.CleanupErrors += int64(failed)
+	if !completed {
+		t.stats.Timeouts++
 	}
+	t.stats.LastDuration = d
+	t.mu.Unlock()
 }
 
-func (cg *closeGroup) Done() chan struct{} {
-	return cg.closeCh
+func (t *shutdownTracker) get() ShutdownStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
 }
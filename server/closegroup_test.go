@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+)
+
+func TestCloseGroup(t *testing.T) {
+	log := log15.New()
+	log.SetHandler(log15.DiscardHandler())
+
+	var order []string
+	closeFn := func(name string, err error) func() error {
+		return func() error {
+			order = append(order, name)
+			return err
+		}
+	}
+
+	var cg closeGroup
+	cg.Add("a", closeFn("a", nil))
+	cg.Add("b", closeFn("b", errors.New("failed")))
+	cg.Add("c", closeFn("c", nats.ErrConnectionClosed))
+
+	failed, completed := cg.Close(time.Second, log)
+	if !completed {
+		t.Error("cleanup did not complete")
+	}
+	if failed != 1 {
+		t.Errorf("failed cleanups %d != 1", failed)
+	}
+	if !reflect.DeepEqual(order, []string{"c", "b", "a"}) {
+		t.Errorf("cleanup order %v", order)
+	}
+}
+
+func TestCloseGroupTimeout(t *testing.T) {
+	log := log15.New()
+	log.SetHandler(log15.DiscardHandler())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var cg closeGroup
+	cg.Add("stuck", func() error {
+		<-release
+		return nil
+	})
+
+	started := time.Now()
+	if _, completed := cg.Close(10*time.Millisecond, log); completed {
+		t.Error("stuck cleanup reported as completed")
+	}
+	if d := time.Since(started); d > time.Second {
+		t.Errorf("close took %v", d)
+	}
+
+	// An empty group completes immediately
+	var empty closeGroup
+	if _, completed := empty.Close(time.Second, log); !completed {
+		t.Error("empty cleanup did not complete")
+	}
+}
+
+func TestShutdownStats(t *testing.T) {
+	s := &Server{
+		ShutdownGracePeriod: 10 * time.Millisecond,
+		Log:                 log15.New(),
+	}
+	s.Log.SetHandler(log15.DiscardHandler())
+
+	var cg closeGroup
+	cg.Add("failing", func() error { return errors.New("failed") })
+	s.shutdown(&cg)
+
+	stats := s.ShutdownStats()
+	if stats.Shutdowns != 1 || stats.CleanupErrors != 1 || stats.Timeouts != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
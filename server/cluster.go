@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// nodeInfo describes the state of the server, given the load of its Asterisk
+// node
+func (s *Server) nodeInfo(channels, bridges int) *proxy.NodeInfo {
+	return &proxy.NodeInfo{
+		Application: s.Application,
+		Node:        s.nodeID(),
+		Version:     s.Version,
+		StartedAt:   s.started,
+		Uptime:      time.Since(s.started),
+		Channels:    channels,
+		Bridges:     bridges,
+		Draining:    s.draining(),
+		Maintenance: s.maintenance.get(),
+	}
+}
+
+func (s *Server) clusterInfo(ctx context.Context, reply string, req *proxy.Request) {
+	channels, err := s.ari.Channel().List(nil)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to list channels"))
+		return
+	}
+	bridges, err := s.ari.Bridge().List(nil)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to list bridges"))
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: ari.NodeKey(s.Application, s.nodeID()),
+		Data: &proxy.EntityData{
+			NodeInfo: s.nodeInfo(len(channels), len(bridges)),
+		},
+	})
+}
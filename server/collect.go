@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultCollectDigitsTimeout is the default time to wait for the first digit
+// of a digit collection
+var DefaultCollectDigitsTimeout = 10 * time.Second
+
+// DefaultInterDigitTimeout is the default time to wait for each further digit
+// of a digit collection
+var DefaultInterDigitTimeout = 5 * time.Second
+
+// digitCollector is the state of a digit collection
+type digitCollector struct {
+	key     *ari.Key
+	opts    proxy.CollectDigits
+	pattern *regexp.Regexp
+
+	digits strings.Builder
+
+	// prompt is the key of the prompt playback, while it may be playing
+	prompt *ari.Key
+
+	timer *time.Timer
+}
+
+func newDigitCollector(key *ari.Key, opts *proxy.CollectDigits) (*digitCollector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &digitCollector{
+		key:  key,
+		opts: *opts,
+	}
+	if opts.Pattern != "" {
+		// The pattern must match all of the digits
+		c.pattern = regexp.MustCompile(`^(?:` + opts.Pattern + `)$`)
+	}
+	if c.opts.Timeout == 0 {
+		c.opts.Timeout = DefaultCollectDigitsTimeout
+	}
+	if c.opts.InterDigitTimeout == 0 {
+		c.opts.InterDigitTimeout = DefaultInterDigitTimeout
+	}
+	return c, nil
+}
+
+// add collects a digit.  It returns the reason the collection completed, if
+// the digit completed it, and whether the digit restarted the collection.
+func (c *digitCollector) add(digit string) (reason string, retry bool) {
+	switch {
+	case c.opts.Terminator != "" && strings.Contains(c.opts.Terminator, digit):
+		return proxy.CollectTerminator, false
+	case c.opts.RetryKey != "" && strings.Contains(c.opts.RetryKey, digit):
+		c.digits.Reset()
+		return "", true
+	case c.opts.ClearKey != "" && strings.Contains(c.opts.ClearKey, digit):
+		c.digits.Reset()
+		return "", false
+	}
+
+	c.digits.WriteString(digit)
+	if c.pattern != nil && c.pattern.MatchString(c.digits.String()) {
+		return proxy.CollectPattern, false
+	}
+	if c.opts.MaxDigits > 0 && c.digits.Len() >= c.opts.MaxDigits {
+		return proxy.CollectMaxDigits, false
+	}
+	return "", false
+}
+
+// timeoutReason returns the reason reported if the collection times out in
+// its current state
+func (c *digitCollector) timeoutReason() string {
+	if c.digits.Len() == 0 {
+		return proxy.CollectTimeout
+	}
+	return proxy.CollectInterDigit
+}
+
+// digitCollectorSet is the set of digit collections in progress, indexed by
+// channel ID
+type digitCollectorSet struct {
+	byChannel map[string]*digitCollector
+	mu        sync.Mutex
+}
+
+func (cs *digitCollectorSet) add(c *digitCollector) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.byChannel == nil {
+		cs.byChannel = make(map[string]*digitCollector)
+	}
+	if _, ok := cs.byChannel[c.key.ID]; ok {
+		return eris.Errorf("digits are already being collected on channel %s", c.key.ID)
+	}
+	cs.byChannel[c.key.ID] = c
+	return nil
+}
+
+func (s *Server) collectDigits(ctx context.Context, reply string, req *proxy.Request) {
+	opts := req.CollectDigits
+	if opts == nil {
+		opts = new(proxy.CollectDigits)
+	}
+
+	c, err := newDigitCollector(req.Key, opts)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	if err := s.digitCollectors.add(c); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	s.digitCollectors.mu.Lock()
+	err = s.startDigitCollection(c)
+	if err != nil {
+		delete(s.digitCollectors.byChannel, c.key.ID)
+	}
+	s.digitCollectors.mu.Unlock()
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.sendError(reply, nil)
+}
+
+// startDigitCollection plays the prompt of the collection, if any, and arms
+// its timeout.  The digit collector lock must be held.
+func (s *Server) startDigitCollection(c *digitCollector) error {
+	if c.opts.Prompt != "" {
+		pb, err := s.ari.Channel().Play(c.key, rid.New(rid.Playback), c.opts.Prompt)
+		if err != nil {
+			return eris.Wrap(err, "failed to play digit collection prompt")
+		}
+		c.prompt = pb.Key()
+	}
+	s.armDigitTimer(c, c.opts.Timeout)
+	return nil
+}
+
+// armDigitTimer (re)starts the timeout of the collection.  The digit collector
+// lock must be held.
+func (s *Server) armDigitTimer(c *digitCollector, d time.Duration) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(d, func() {
+		s.digitCollectors.mu.Lock()
+		defer s.digitCollectors.mu.Unlock()
+
+		if s.digitCollectors.byChannel[c.key.ID] == c {
+			s.completeDigitCollection(c, c.timeoutReason())
+		}
+	})
+}
+
+// stopPrompt stops the prompt of the collection, if it may be playing.  The
+// digit collector lock must be held.
+func (s *Server) stopPrompt(c *digitCollector) {
+	if c.prompt == nil {
+		return
+	}
+	k := c.prompt
+	c.prompt = nil
+
+	go func() {
+		// The prompt has usually finished already
+		if err := s.ari.Playback().Stop(k); err != nil {
+			s.Log.Debug("failed to stop digit collection prompt", "playback", k.ID, "error", err)
+		}
+	}()
+}
+
+// processDigitCollection collects the DTMF events of channels with digit
+// collections in progress.  The events are still delivered to clients.
+func (s *Server) processDigitCollection(e ari.Event) {
+	switch v := e.(type) {
+	case *ari.ChannelDtmfReceived:
+		s.digitCollectors.mu.Lock()
+		defer s.digitCollectors.mu.Unlock()
+
+		c, ok := s.digitCollectors.byChannel[v.Channel.ID]
+		if !ok {
+			return
+		}
+		s.stopPrompt(c)
+
+		reason, retry := c.add(v.Digit)
+		switch {
+		case reason != "":
+			s.completeDigitCollection(c, reason)
+		case retry:
+			if err := s.startDigitCollection(c); err != nil {
+				s.Log.Warn("failed to restart digit collection", "channel", c.key.ID, "error", err)
+				s.completeDigitCollection(c, proxy.CollectPromptFailed)
+			}
+		case c.digits.Len() == 0:
+			s.armDigitTimer(c, c.opts.Timeout)
+		default:
+			s.armDigitTimer(c, c.opts.InterDigitTimeout)
+		}
+	case *ari.ChannelDestroyed:
+		s.digitCollectors.mu.Lock()
+		defer s.digitCollectors.mu.Unlock()
+
+		if c, ok := s.digitCollectors.byChannel[v.Channel.ID]; ok {
+			s.completeDigitCollection(c, proxy.CollectHangup)
+		}
+	}
+}
+
+// completeDigitCollection ends the collection, publishing a DigitsCollected
+// event.  The digit collector lock must be held.
+func (s *Server) completeDigitCollection(c *digitCollector, reason string) {
+	delete(s.digitCollectors.byChannel, c.key.ID)
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if reason != proxy.CollectHangup {
+		s.stopPrompt(c)
+	}
+
+	s.publishEvent(&proxy.DigitsCollected{
+		EventData: s.newEventData(proxy.EventDigitsCollected),
+		ChannelID: c.key.ID,
+		Digits:    c.digits.String(),
+		Reason:    reason,
+	})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func collect(t *testing.T, c *digitCollector, digits string) (reason string, retried bool) {
+	t.Helper()
+	for i, d := range digits {
+		var retry bool
+		reason, retry = c.add(string(d))
+		retried = retried || retry
+		if reason != "" && i < len(digits)-1 {
+			t.Fatalf("collection of %q completed early at %d: %s", digits, i, reason)
+		}
+	}
+	return reason, retried
+}
+
+func TestDigitCollector(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   proxy.CollectDigits
+		input  string
+		reason string
+		digits string
+	}{
+		{"pattern", proxy.CollectDigits{Pattern: `\d{4}`}, "1234", proxy.CollectPattern, "1234"},
+		{"anchored pattern", proxy.CollectDigits{Pattern: `1\d{10}|[2-9]\d{9}`}, "2565551234", proxy.CollectPattern, "2565551234"},
+		{"max digits", proxy.CollectDigits{MaxDigits: 3}, "123", proxy.CollectMaxDigits, "123"},
+		{"terminator", proxy.CollectDigits{Terminator: "#", MaxDigits: 10}, "12#", proxy.CollectTerminator, "12"},
+		{"clear key", proxy.CollectDigits{ClearKey: "*", MaxDigits: 3}, "12*456", proxy.CollectMaxDigits, "456"},
+		{"incomplete", proxy.CollectDigits{Pattern: `\d{4}`}, "12", "", "12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newDigitCollector(ari.NewKey(ari.ChannelKey, "c1"), &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reason, _ := collect(t, c, tt.input)
+			if reason != tt.reason {
+				t.Errorf("expected reason %q, got %q", tt.reason, reason)
+			}
+			if c.digits.String() != tt.digits {
+				t.Errorf("expected digits %q, got %q", tt.digits, c.digits.String())
+			}
+		})
+	}
+}
+
+func TestDigitCollectorRetry(t *testing.T) {
+	c, err := newDigitCollector(ari.NewKey(ari.ChannelKey, "c1"), &proxy.CollectDigits{RetryKey: "*", MaxDigits: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, retried := collect(t, c, "12*"); !retried {
+		t.Error("expected retry")
+	}
+	if c.timeoutReason() != proxy.CollectTimeout {
+		t.Errorf("expected first digit timeout after retry, got %q", c.timeoutReason())
+	}
+	collect(t, c, "9")
+	if c.timeoutReason() != proxy.CollectInterDigit {
+		t.Errorf("expected inter-digit timeout, got %q", c.timeoutReason())
+	}
+}
+
+func TestDigitCollectorInvalid(t *testing.T) {
+	if _, err := newDigitCollector(ari.NewKey(ari.ChannelKey, "c1"), &proxy.CollectDigits{Pattern: "(["}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	if _, err := newDigitCollector(ari.NewKey(ari.ChannelKey, "c1"), &proxy.CollectDigits{MaxDigits: -1}); err == nil {
+		t.Error("expected error for negative limit")
+	}
+}
+
+func TestDigitCollectorSet(t *testing.T) {
+	var cs digitCollectorSet
+
+	if err := cs.add(&digitCollector{key: ari.NewKey(ari.ChannelKey, "c1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.add(&digitCollector{key: ari.NewKey(ari.ChannelKey, "c1")}); err == nil {
+		t.Error("expected error for second collection on the same channel")
+	}
+}
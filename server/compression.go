@@ -0,0 +1,79 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// DefaultCompressionMinSize is the default size, in bytes, above which
+// responses are compressed
+const DefaultCompressionMinSize = 4096
+
+// CompressionConfig describes which responses are compressed.  A response is
+// only compressed if the request declares that it accepts gzip encoding (as
+// the client library does).
+type CompressionConfig struct {
+	// Kinds is the list of request kinds whose responses may be compressed
+	// (e.g. "SoundList", "ChannelList").  If empty, the responses of all
+	// kinds may be compressed.
+	Kinds []string `mapstructure:"kinds"`
+
+	// MinSize is the size, in bytes, of the JSON-encoded response above which
+	// it is compressed.  It defaults to 4096.
+	MinSize int `mapstructure:"min_size"`
+}
+
+func (c *CompressionConfig) appliesTo(kind string) bool {
+	if len(c.Kinds) == 0 {
+		return true
+	}
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// compressedReplies is the set of reply subjects whose responses may be
+// compressed
+type compressedReplies struct {
+	m sync.Map
+}
+
+// negotiateCompression records that the response to the request may be
+// compressed, if the request and the configuration allow it
+func (s *Server) negotiateCompression(reply string, req *proxy.Request) {
+	if s.Compression == nil || reply == "" || !req.AcceptsEncoding(proxy.EncodingGzip) || !s.Compression.appliesTo(req.Kind) {
+		return
+	}
+	s.compressed.m.Store(reply, struct{}{})
+}
+
+// compressResponse returns the compressed encoding of the response, if the
+// response to the subject may be compressed and is large enough
+func (s *Server) compressResponse(subject string, resp *proxy.Response) ([]byte, bool) {
+	if _, ok := s.compressed.m.Load(subject); !ok {
+		return nil, false
+	}
+	s.compressed.m.Delete(subject)
+
+	minSize := s.Compression.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+
+	var out []byte
+	err := proxy.EncodeWith(s.codec, resp, func(data []byte) (err error) {
+		if len(data) >= minSize {
+			out, err = proxy.CompressResponse(data)
+		}
+		return err
+	})
+	if err != nil {
+		s.Log.Warn("failed to compress response", "error", err)
+		return nil, false
+	}
+	return out, out != nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestCompressResponse(t *testing.T) {
+	s := New()
+	s.Compression = &CompressionConfig{
+		Kinds:   []string{"SoundList"},
+		MinSize: 100,
+	}
+
+	large := &proxy.Response{
+		Keys: []*ari.Key{ari.NewKey(ari.SoundKey, strings.Repeat("x", 200))},
+	}
+
+	s.negotiateCompression("r1", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingGzip}})
+	data, ok := s.compressResponse("r1", large)
+	if !ok {
+		t.Fatal("response should have been compressed")
+	}
+	resp, err := proxy.DecodeResponse(data)
+	if err != nil || len(resp.Keys) != 1 {
+		t.Errorf("unexpected response: %+v (%v)", resp, err)
+	}
+	if _, ok := s.compressResponse("r1", large); ok {
+		t.Error("only the first response to a reply subject should be compressed")
+	}
+
+	s.negotiateCompression("r2", &proxy.Request{Kind: "SoundList"})
+	if _, ok := s.compressResponse("r2", large); ok {
+		t.Error("response should not be compressed unless accepted")
+	}
+
+	s.negotiateCompression("r3", &proxy.Request{Kind: "ChannelList", AcceptEncoding: []string{proxy.EncodingGzip}})
+	if _, ok := s.compressResponse("r3", large); ok {
+		t.Error("response should not be compressed for unlisted kinds")
+	}
+
+	s.negotiateCompression("r4", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingGzip}})
+	if _, ok := s.compressResponse("r4", &proxy.Response{}); ok {
+		t.Error("small response should not be compressed")
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+// conflictTracker records the other instances which announce themselves as
+// serving the same application and node as the server, indexed by instance ID
+// with the time of their last announcement
+type conflictTracker struct {
+	seen map[string]time.Time
+	mu   sync.Mutex
+}
+
+// conflictExpiry is the time after its last announcement for which a
+// conflicting instance is considered to be running.  It spans two
+// announcements, so that one lost announcement does not cause the conflict to
+// be reported again.
+func conflictExpiry() time.Duration {
+	return 2 * proxy.AnnouncementInterval
+}
+
+// observe records an announcement of the given conflicting instance,
+// returning whether it is a new conflict, of an instance which had not been
+// seen, or had expired
+func (t *conflictTracker) observe(instance string, now time.Time) (fresh bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen == nil {
+		t.seen = make(map[string]time.Time)
+	}
+	last, ok := t.seen[instance]
+	t.seen[instance] = now
+	return !ok || now.Sub(last) > conflictExpiry()
+}
+
+// active returns the sorted instance IDs of the conflicting instances which
+// have not expired
+func (t *conflictTracker) active(now time.Time) (ret []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for instance, last := range t.seen {
+		if now.Sub(last) > conflictExpiry() {
+			delete(t.seen, instance)
+			continue
+		}
+		ret = append(ret, instance)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// watchConflicts listens to the announcements of the cluster for other
+// instances serving the same application and node, and pings the cluster so
+// that any such instance is detected on startup.  Afterwards, conflicts are
+// detected by the periodic announcements of the other instances.
+func (s *Server) watchConflicts(cg *closeGroup) error {
+	sub, err := s.nats.Subscribe(s.Subjects.Announcement(), s.processAnnouncement)
+	if err != nil {
+		return eris.Wrap(err, "failed to subscribe to announcements")
+	}
+	cg.Add("announcement subscription", sub.Unsubscribe)
+
+	if err := s.nats.Publish(s.Subjects.Ping(), &proxy.Request{}); err != nil {
+		s.Log.Warn("failed to ping the cluster", "error", err)
+	}
+	return nil
+}
+
+// processAnnouncement reports the announcements of other instances which serve
+// the same application and node as the server
+func (s *Server) processAnnouncement(a *proxy.Announcement) {
+	if a.Application != s.Application || a.Node != s.nodeID() {
+		return
+	}
+	if a.Instance == "" || a.Instance == s.InstanceID {
+		return
+	}
+
+	if !s.conflicts.observe(a.Instance, s.clock().Now()) {
+		return
+	}
+
+	s.Log.Error("another instance is serving the same application and node",
+		"application", a.Application, "node", a.Node, "instance", s.InstanceID,
+		"conflicting_instance", a.Instance, "conflicting_version", a.Version)
+
+	s.publishEvent(&proxy.InstanceConflict{
+		EventData:           s.newEventData(proxy.EventInstanceConflict),
+		Instance:            s.InstanceID,
+		ConflictingInstance: a.Instance,
+		ConflictingVersion:  a.Version,
+	})
+}
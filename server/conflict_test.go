@@ -0,0 +1,51 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestConflictTracker(t *testing.T) {
+	var c conflictTracker
+	now := time.Now()
+
+	if !c.observe("b", now) {
+		t.Error("first announcement is not a new conflict")
+	}
+	if c.observe("b", now.Add(proxy.AnnouncementInterval)) {
+		t.Error("repeated announcement is a new conflict")
+	}
+	if !c.observe("a", now.Add(proxy.AnnouncementInterval)) {
+		t.Error("announcement of another instance is not a new conflict")
+	}
+	if got := c.active(now.Add(proxy.AnnouncementInterval)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("active conflicts %v", got)
+	}
+
+	later := now.Add(4 * proxy.AnnouncementInterval)
+	if got := c.active(later); len(got) != 0 {
+		t.Errorf("expired conflicts %v are active", got)
+	}
+	if !c.observe("b", later) {
+		t.Error("announcement after expiry is not a new conflict")
+	}
+}
+
+func TestProcessAnnouncementIgnoresOthers(t *testing.T) {
+	s := &Server{Application: "app", AsteriskID: "node", InstanceID: "a"}
+
+	for _, a := range []*proxy.Announcement{
+		{Application: "app", Node: "node", Instance: "a"},
+		{Application: "app", Node: "node"},
+		{Application: "app", Node: "other", Instance: "b"},
+		{Application: "other", Node: "node", Instance: "b"},
+	} {
+		s.processAnnouncement(a)
+	}
+	if got := s.conflicts.active(time.Now()); len(got) != 0 {
+		t.Errorf("unexpected conflicts %v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// ConsentVariable is the channel variable on which the recording consent
+// status of a channel is recorded
+const ConsentVariable = "ARI_PROXY_RECORDING_CONSENT"
+
+// DefaultConsentTimeout is the default time to wait for an accepting digit
+// after the consent announcement has finished
+var DefaultConsentTimeout = 10 * time.Second
+
+func (s *Server) channelRecordConsent(ctx context.Context, reply string, req *proxy.Request) {
+	opts := req.ChannelRecordConsent
+	if opts == nil || opts.Announcement == "" {
+		s.sendError(reply, eris.New("consent announcement is required"))
+		return
+	}
+
+	name, err := s.recordingName(opts.Name, req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	opts.Name = name
+
+	if opts.Options, err = s.recordingOptions(opts.Options); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+		s.Dialog.Bind(req.Key.Dialog, "recording", opts.Name)
+	}
+
+	playbackID := rid.New(rid.Playback)
+
+	// Subscribe before playing the announcement so that early digits and
+	// hangups are not missed
+	sub := s.ari.Bus().Subscribe(req.Key, ari.Events.ChannelDtmfReceived, ari.Events.StasisEnd, ari.Events.ChannelDestroyed)
+	pbSub := s.ari.Bus().Subscribe(ari.NewKey(ari.PlaybackKey, playbackID), ari.Events.PlaybackFinished)
+
+	pb, err := s.ari.Channel().Play(req.Key, playbackID, opts.Announcement)
+	if err != nil {
+		sub.Cancel()
+		pbSub.Cancel()
+		s.sendError(reply, eris.Wrap(err, "failed to play consent announcement"))
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key.New(ari.LiveRecordingKey, opts.Name),
+	})
+
+	go s.runConsent(ctx, req, sub, pbSub, pb)
+}
+
+// runConsent waits for the caller's consent and starts the recording if it is
+// obtained
+func (s *Server) runConsent(ctx context.Context, req *proxy.Request, sub, pbSub ari.Subscription, pb *ari.PlaybackHandle) {
+	defer sub.Cancel()
+	defer pbSub.Cancel()
+
+	opts := req.ChannelRecordConsent
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConsentTimeout
+	}
+
+	ev := &proxy.RecordingConsent{
+		EventData:     s.newEventData(proxy.EventRecordingConsent),
+		ChannelID:     req.Key.ID,
+		RecordingName: opts.Name,
+	}
+
+	var timer <-chan time.Time
+	playing := true
+
+	for ev.Status == "" {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pbSub.Events():
+			if !playing {
+				continue
+			}
+			playing = false
+			if opts.AcceptDTMF == "" {
+				ev.Status = proxy.ConsentImplied
+				break
+			}
+			timer = s.clock().After(timeout)
+		case e := <-sub.Events():
+			v, ok := e.(*ari.ChannelDtmfReceived)
+			if !ok {
+				ev.Status = proxy.ConsentHangup
+				break
+			}
+			switch {
+			case opts.AcceptDTMF != "" && strings.Contains(opts.AcceptDTMF, v.Digit):
+				ev.Status = proxy.ConsentAccepted
+				ev.Digit = v.Digit
+			case opts.DeclineDTMF != "" && strings.Contains(opts.DeclineDTMF, v.Digit):
+				ev.Status = proxy.ConsentDeclined
+				ev.Digit = v.Digit
+			}
+		case <-timer:
+			ev.Status = proxy.ConsentTimeout
+		}
+	}
+
+	if playing && ev.Status != proxy.ConsentHangup {
+		if err := pb.Stop(); err != nil {
+			s.Log.Debug("failed to stop consent announcement", "error", err)
+		}
+	}
+
+	if ev.Status == proxy.ConsentAccepted || ev.Status == proxy.ConsentImplied {
+		if err := s.startConsentRecording(req); err != nil {
+			ev.Status = proxy.ConsentFailed
+			ev.Error = err.Error()
+		}
+	}
+
+	if ev.Status != proxy.ConsentHangup {
+		if err := s.ari.Channel().SetVariable(req.Key, ConsentVariable, ev.Status); err != nil {
+			s.Log.Warn("failed to tag channel with recording consent", "channel", req.Key.ID, "error", err)
+		}
+	}
+
+	s.publishEvent(ev)
+}
+
+func (s *Server) startConsentRecording(req *proxy.Request) error {
+	opts := req.ChannelRecordConsent
+
+	if err := s.quota.AdmitRecording(s.Application, req.Tenant, opts.Name); err != nil {
+		return err
+	}
+
+	if _, err := s.ari.Channel().Record(req.Key, opts.Name, opts.Options); err != nil {
+		s.quota.ReleaseRecording(opts.Name)
+		return eris.Wrap(err, "failed to start recording")
+	}
+	s.limitRecording(opts.Name, req.Key, opts.Options)
+	return nil
+}
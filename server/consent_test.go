@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/mock"
+)
+
+// consentTest runs a consent request against mock ARI, reporting the consent
+// status with which the channel is tagged
+type consentTest struct {
+	clock    *clock.Fake
+	channel  *arimocks.Channel
+	playback *arimocks.Playback
+
+	events   chan ari.Event
+	finished chan ari.Event
+	status   chan string
+}
+
+func newConsentTest(opts *proxy.ChannelRecordConsent) *consentTest {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	ct := &consentTest{
+		clock:    clock.NewFake(time.Unix(0, 0)),
+		channel:  new(arimocks.Channel),
+		playback: new(arimocks.Playback),
+		events:   make(chan ari.Event, 1),
+		finished: make(chan ari.Event, 1),
+		status:   make(chan string, 1),
+	}
+
+	sub := new(arimocks.Subscription)
+	sub.On("Events").Return((<-chan ari.Event)(ct.events))
+	sub.On("Cancel").Return()
+	pbSub := new(arimocks.Subscription)
+	pbSub.On("Events").Return((<-chan ari.Event)(ct.finished))
+	pbSub.On("Cancel").Return()
+
+	bus := new(arimocks.Bus)
+	bus.On("Subscribe", key, ari.Events.ChannelDtmfReceived, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(sub)
+	bus.On("Subscribe", mock.Anything, ari.Events.PlaybackFinished).Return(pbSub)
+
+	ct.channel.On("Play", key, mock.Anything, opts.Announcement).Return(func(key *ari.Key, id, uri string) *ari.PlaybackHandle {
+		return ari.NewPlaybackHandle(ari.NewKey(ari.PlaybackKey, id), ct.playback, nil)
+	}, nil)
+	ct.playback.On("Stop", mock.Anything).Return(nil)
+	ct.channel.On("SetVariable", key, ConsentVariable, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		ct.status <- args.String(2)
+	})
+
+	cl := new(arimocks.Client)
+	cl.On("Bus").Return(bus)
+	cl.On("Channel").Return(ct.channel)
+
+	s := New(WithClock(ct.clock))
+	s.ari = cl
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+
+	s.channelRecordConsent(context.Background(), "", &proxy.Request{Key: key, ChannelRecordConsent: opts})
+	return ct
+}
+
+func (ct *consentTest) expect(t *testing.T, status string) {
+	t.Helper()
+	select {
+	case got := <-ct.status:
+		if got != status {
+			t.Errorf("expected consent status %q, got %q", status, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("consent status %q not reported", status)
+	}
+}
+
+func TestConsentPrompt(t *testing.T) {
+	ct := newConsentTest(&proxy.ChannelRecordConsent{Name: "r1", Announcement: "sound:consent"})
+	ct.channel.On("Record", mock.Anything, "r1", (*ari.RecordingOptions)(nil)).Return(nil, nil)
+
+	// Consent is implied once the announcement has been played
+	ct.channel.AssertCalled(t, "Play", mock.Anything, mock.Anything, "sound:consent")
+	ct.finished <- &ari.PlaybackFinished{}
+	ct.expect(t, proxy.ConsentImplied)
+	ct.channel.AssertCalled(t, "Record", mock.Anything, "r1", (*ari.RecordingOptions)(nil))
+}
+
+func TestConsentAccept(t *testing.T) {
+	ct := newConsentTest(&proxy.ChannelRecordConsent{Name: "r1", Announcement: "sound:consent", AcceptDTMF: "1", DeclineDTMF: "2"})
+	ct.channel.On("Record", mock.Anything, "r1", (*ari.RecordingOptions)(nil)).Return(nil, nil)
+
+	ct.finished <- &ari.PlaybackFinished{}
+	ct.events <- &ari.ChannelDtmfReceived{Digit: "3"}
+	ct.events <- &ari.ChannelDtmfReceived{Digit: "1"}
+	ct.expect(t, proxy.ConsentAccepted)
+	ct.channel.AssertCalled(t, "Record", mock.Anything, "r1", (*ari.RecordingOptions)(nil))
+}
+
+func TestConsentDecline(t *testing.T) {
+	ct := newConsentTest(&proxy.ChannelRecordConsent{Name: "r1", Announcement: "sound:consent", AcceptDTMF: "1", DeclineDTMF: "2"})
+	// The announcement is interrupted by the declining digit
+	ct.events <- &ari.ChannelDtmfReceived{Digit: "2"}
+	ct.expect(t, proxy.ConsentDeclined)
+	ct.playback.AssertCalled(t, "Stop", mock.Anything)
+	ct.channel.AssertNotCalled(t, "Record", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConsentTimeout(t *testing.T) {
+	ct := newConsentTest(&proxy.ChannelRecordConsent{Name: "r1", Announcement: "sound:consent", AcceptDTMF: "1", Timeout: 5 * time.Second})
+
+	ct.finished <- &ari.PlaybackFinished{}
+	for ct.clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ct.clock.Advance(4 * time.Second)
+	select {
+	case status := <-ct.status:
+		t.Fatalf("consent %q before the timeout", status)
+	default:
+	}
+
+	ct.clock.Advance(time.Second)
+	ct.expect(t, proxy.ConsentTimeout)
+	ct.channel.AssertNotCalled(t, "Record", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// DeadAirConfig describes the configuration of dead-air monitoring.  Talk
+// detection (TALK_DETECT) is enabled on each channel which enters a bridge,
+// and a DeadAirDetected event is emitted when no party of a bridge with at
+// least two channels has talked for the configured duration.
+type DeadAirConfig struct {
+	// Silence is the duration of silence after which dead air is reported.
+	// It defaults to ten seconds.
+	Silence time.Duration `mapstructure:"silence"`
+
+	// SilenceThreshold is the duration of silence after which a channel is
+	// considered to have stopped talking.  It defaults to one second.
+	SilenceThreshold time.Duration `mapstructure:"silence_threshold"`
+
+	// TalkingThreshold is the average audio energy above which a channel is
+	// considered to be talking.  It defaults to Asterisk's default of 256.
+	TalkingThreshold int `mapstructure:"talking_threshold"`
+}
+
+func (c *DeadAirConfig) withDefaults() DeadAirConfig {
+	ret := *c
+	if ret.Silence <= 0 {
+		ret.Silence = 10 * time.Second
+	}
+	if ret.SilenceThreshold <= 0 {
+		ret.SilenceThreshold = time.Second
+	}
+	if ret.TalkingThreshold <= 0 {
+		ret.TalkingThreshold = 256
+	}
+	return ret
+}
+
+// deadAirBridge is the talk state of a bridge
+type deadAirBridge struct {
+	// talking indicates, for each channel in the bridge, whether it is talking
+	talking map[string]bool
+
+	// silentSince is the time at which the bridge became silent
+	silentSince time.Time
+
+	// reported indicates that dead air has been reported for the current
+	// period of silence
+	reported bool
+}
+
+func (b *deadAirBridge) silent() bool {
+	for _, talking := range b.talking {
+		if talking {
+			return false
+		}
+	}
+	return true
+}
+
+// deadAirReport describes a bridge in which dead air was detected
+type deadAirReport struct {
+	bridge   string
+	channels []string
+	silence  time.Duration
+}
+
+// deadAirMonitor tracks the talk state of bridges
+type deadAirMonitor struct {
+	bridges map[string]*deadAirBridge
+
+	// channels maps each bridged channel to its bridge
+	channels map[string]string
+
+	// silenceThreshold is the delay with which talk detection reports the
+	// end of talking
+	silenceThreshold time.Duration
+
+	mu sync.Mutex
+}
+
+func newDeadAirMonitor(silenceThreshold time.Duration) *deadAirMonitor {
+	return &deadAirMonitor{
+		bridges:          make(map[string]*deadAirBridge),
+		channels:         make(map[string]string),
+		silenceThreshold: silenceThreshold,
+	}
+}
+
+// process updates the talk state from an event.  It returns the ID of the
+// channel on which talk detection must be enabled, if any.
+func (m *deadAirMonitor) process(e ari.Event, now time.Time) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch v := e.(type) {
+	case *ari.ChannelEnteredBridge:
+		b, ok := m.bridges[v.Bridge.ID]
+		if !ok {
+			b = &deadAirBridge{talking: make(map[string]bool)}
+			m.bridges[v.Bridge.ID] = b
+		}
+		if b.silent() {
+			// A new party restarts the period of silence
+			b.silentSince = now
+			b.reported = false
+		}
+		b.talking[v.Channel.ID] = false
+		m.channels[v.Channel.ID] = v.Bridge.ID
+		return v.Channel.ID
+	case *ari.ChannelLeftBridge:
+		m.removeChannel(v.Channel.ID)
+	case *ari.ChannelDestroyed:
+		m.removeChannel(v.Channel.ID)
+	case *ari.BridgeDestroyed:
+		if b, ok := m.bridges[v.Bridge.ID]; ok {
+			for id := range b.talking {
+				delete(m.channels, id)
+			}
+			delete(m.bridges, v.Bridge.ID)
+		}
+	case *ari.ChannelTalkingStarted:
+		if b := m.bridgeOf(v.Channel.ID); b != nil {
+			b.talking[v.Channel.ID] = true
+			b.reported = false
+		}
+	case *ari.ChannelTalkingFinished:
+		if b := m.bridgeOf(v.Channel.ID); b != nil {
+			b.talking[v.Channel.ID] = false
+			if b.silent() {
+				// Talking ended when the silence began, not when it was detected
+				b.silentSince = now.Add(-m.silenceThreshold)
+			}
+		}
+	}
+	return ""
+}
+
+func (m *deadAirMonitor) bridgeOf(channel string) *deadAirBridge {
+	id, ok := m.channels[channel]
+	if !ok {
+		return nil
+	}
+	return m.bridges[id]
+}
+
+func (m *deadAirMonitor) removeChannel(channel string) {
+	b := m.bridgeOf(channel)
+	if b == nil {
+		return
+	}
+	delete(b.talking, channel)
+	delete(m.channels, channel)
+}
+
+// check returns the bridges of at least two channels which have been silent
+// for at least the given duration and have not already been reported
+func (m *deadAirMonitor) check(now time.Time, silence time.Duration) (reports []deadAirReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, b := range m.bridges {
+		if b.reported || len(b.talking) < 2 || !b.silent() {
+			continue
+		}
+		d := now.Sub(b.silentSince)
+		if d < silence {
+			continue
+		}
+		b.reported = true
+
+		r := deadAirReport{
+			bridge:  id,
+			silence: d,
+		}
+		for ch := range b.talking {
+			r.channels = append(r.channels, ch)
+		}
+		sort.Strings(r.channels)
+		reports = append(reports, r)
+	}
+	return
+}
+
+// processDeadAirEvent updates the dead-air monitor from an event, enabling
+// talk detection on channels which enter bridges
+func (s *Server) processDeadAirEvent(e ari.Event) {
+	if s.deadAir == nil {
+		return
+	}
+
+	if id := s.deadAir.process(e, time.Now()); id != "" {
+		cfg := s.DeadAir.withDefaults()
+		value := fmt.Sprintf("%d,%d", int(cfg.SilenceThreshold/time.Millisecond), cfg.TalkingThreshold)
+
+		go func() {
+			if err := s.ari.Channel().SetVariable(ari.NewKey(ari.ChannelKey, id), "TALK_DETECT(set)", value); err != nil {
+				s.Log.Debug("failed to enable talk detection", "channel", id, "error", err)
+			}
+		}()
+	}
+}
+
+// runDeadAirMonitor periodically reports the bridges in which dead air is
+// detected
+func (s *Server) runDeadAirMonitor(ctx context.Context) {
+	cfg := s.DeadAir.withDefaults()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, r := range s.deadAir.check(now, cfg.Silence) {
+				s.publishEvent(&proxy.DeadAirDetected{
+					EventData:  s.newEventData(proxy.EventDeadAirDetected),
+					BridgeID:   r.bridge,
+					ChannelIDs: r.channels,
+					SilenceMs:  int64(r.silence / time.Millisecond),
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestDeadAirMonitor(t *testing.T) {
+	m := newDeadAirMonitor(time.Second)
+	now := time.Now()
+
+	enter := func(ch string) *ari.ChannelEnteredBridge {
+		return &ari.ChannelEnteredBridge{Bridge: ari.BridgeData{ID: "b1"}, Channel: ari.ChannelData{ID: ch}}
+	}
+
+	if id := m.process(enter("c1"), now); id != "c1" {
+		t.Errorf("expected talk detection on c1, got %q", id)
+	}
+	if r := m.check(now.Add(time.Minute), 10*time.Second); len(r) != 0 {
+		t.Errorf("a bridge with a single channel should not be reported: %v", r)
+	}
+
+	m.process(enter("c2"), now)
+	m.process(&ari.ChannelTalkingStarted{Channel: ari.ChannelData{ID: "c1"}}, now)
+	if r := m.check(now.Add(time.Minute), 10*time.Second); len(r) != 0 {
+		t.Errorf("a bridge with a talking channel should not be reported: %v", r)
+	}
+
+	m.process(&ari.ChannelTalkingFinished{Channel: ari.ChannelData{ID: "c1"}}, now.Add(5*time.Second))
+	if r := m.check(now.Add(10*time.Second), 10*time.Second); len(r) != 0 {
+		t.Errorf("reported too early: %v", r)
+	}
+
+	r := m.check(now.Add(14*time.Second), 10*time.Second)
+	if len(r) != 1 || r[0].bridge != "b1" || len(r[0].channels) != 2 || r[0].silence != 10*time.Second {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if r := m.check(now.Add(time.Minute), 10*time.Second); len(r) != 0 {
+		t.Errorf("dead air should be reported once per silence: %v", r)
+	}
+
+	m.process(&ari.BridgeDestroyed{Bridge: ari.BridgeData{ID: "b1"}}, now)
+	if len(m.bridges) != 0 || len(m.channels) != 0 {
+		t.Errorf("bridge state should have been removed: %v %v", m.bridges, m.channels)
+	}
+}
@@ -0,0 +1,474 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// maxDebugCaptureBody is the size to which the captured bodies are
+	// truncated
+	maxDebugCaptureBody = 4096
+
+	// maxDebugCaptureExchanges is the number of exchanges kept for each
+	// call; older exchanges are discarded
+	maxDebugCaptureExchanges = 100
+
+	// maxDebugCaptureCalls is the number of calls whose exchanges are kept;
+	// the buffer of the call captured least recently is discarded
+	maxDebugCaptureCalls = 100
+)
+
+// debugCaptureError returns the error of the debug capture request, if the
+// server has no debug capture or the request is made on behalf of a tenant
+func (s *Server) debugCaptureError(req *proxy.Request) error {
+	if !withDebugCapture {
+		return errExcluded(SubsystemDebugCapture)
+	}
+	if !s.AllowDebugCapture {
+		return errDebugCaptureDisabled
+	}
+	if s.debugCapture == nil {
+		return errDebugCaptureUnavailable
+	}
+	if req.Tenant != "" {
+		// The capture spans the calls of every tenant of the node
+		return eris.New("debug capture may not be requested on behalf of a tenant")
+	}
+	return nil
+}
+
+// errDebugCaptureDisabled indicates that the server does not allow debug
+// captures
+var errDebugCaptureDisabled = eris.New("debug capture is not enabled")
+
+// errDebugCaptureUnavailable indicates that the server was not given the ARI
+// connection parameters (as when it is run with ListenOn), so that it cannot
+// identify its exchanges with Asterisk
+var errDebugCaptureUnavailable = eris.New("debug capture not available without direct ARI connection parameters")
+
+// debugCapture captures the HTTP exchanges of a server with Asterisk, for the
+// requests of the kinds and dialogs selected at runtime, into a buffer for
+// each call (the entity of the request)
+type debugCapture struct {
+	// url is the root URL of the ARI REST interface
+	url string
+
+	clock clock.Clock
+
+	// transport is the transport of the server's ARI requests, which
+	// captures the selected exchanges
+	transport *captureTransport
+
+	// active is the number of requests being captured
+	active int32
+
+	kinds   map[string]bool
+	dialogs map[string]bool
+
+	// requests are the requests being captured
+	requests map[*capturedRequest]struct{}
+
+	// calls are the captured exchanges, by call, and order the calls, least
+	// recently captured first
+	calls map[string][]proxy.ARIExchange
+	order []string
+
+	mu sync.Mutex
+}
+
+// capturedRequest is a request whose ARI exchanges are being captured
+type capturedRequest struct {
+	kind   string
+	dialog string
+
+	// call is the ID of the entity of the request, which ARI requests must
+	// name to be captured for it
+	call string
+}
+
+func newDebugCapture(url string, c clock.Clock) *debugCapture {
+	if url == "" {
+		url = DefaultARIURL
+	}
+	d := &debugCapture{
+		url:      strings.TrimSuffix(url, "/"),
+		clock:    c,
+		kinds:    make(map[string]bool),
+		dialogs:  make(map[string]bool),
+		requests: make(map[*capturedRequest]struct{}),
+		calls:    make(map[string][]proxy.ARIExchange),
+	}
+	d.transport = &captureTransport{next: http.DefaultTransport, capture: d}
+	return d
+}
+
+// relay starts a relay on the loopback interface through which the ARI
+// client library makes its REST requests, with the capture transport, since
+// the library offers no way to replace its transport.  It returns the
+// options of the library with the URL of the relay, and the function which
+// stops the relay.
+func (d *debugCapture) relay(opts *native.Options) (*native.Options, func(), error) {
+	target, err := url.Parse(d.url)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "failed to parse ARI URL")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "failed to listen for the ARI debug capture relay")
+	}
+	srv := &http.Server{
+		Handler: &httputil.ReverseProxy{
+			Director: func(r *http.Request) {
+				r.URL.Scheme = target.Scheme
+				r.URL.Host = target.Host
+				r.Host = target.Host
+			},
+			Transport: d.transport,
+		},
+	}
+	go srv.Serve(l) // nolint: errcheck
+
+	relayed := *opts
+	relayed.URL = "http://" + l.Addr().String() + target.Path
+	return &relayed, func() { srv.Close() }, nil // nolint: errcheck
+}
+
+// start adds the given kinds and dialogs to the capture
+func (d *debugCapture) start(kinds, dialogs []string) {
+	d.mu.Lock()
+	for _, k := range kinds {
+		d.kinds[k] = true
+	}
+	for _, id := range dialogs {
+		d.dialogs[id] = true
+	}
+	d.mu.Unlock()
+}
+
+// stop removes the given kinds and dialogs from the capture, or stops it
+// entirely if none are given
+func (d *debugCapture) stop(kinds, dialogs []string) {
+	d.mu.Lock()
+	if len(kinds) == 0 && len(dialogs) == 0 {
+		d.kinds = make(map[string]bool)
+		d.dialogs = make(map[string]bool)
+	}
+	for _, k := range kinds {
+		delete(d.kinds, k)
+	}
+	for _, id := range dialogs {
+		delete(d.dialogs, id)
+	}
+	d.mu.Unlock()
+}
+
+// capturedCall returns the ID of the entity of the request, by which its ARI
+// exchanges are identified: the ID of its key, or the ID of the channel
+// which it creates
+func capturedCall(req *proxy.Request) string {
+	switch {
+	case req.Key != nil && req.Key.ID != "":
+		return req.Key.ID
+	case req.ChannelOriginate != nil:
+		return req.ChannelOriginate.OriginateRequest.ChannelID
+	case req.ChannelCreate != nil:
+		return req.ChannelCreate.ChannelCreateRequest.ChannelID
+	}
+	return ""
+}
+
+// begin starts the capture of the exchanges of the given request, if its
+// kind or dialog is captured, returning the function which ends it.
+// Requests which name no entity are not captured, since their exchanges
+// could not be told from those of concurrent requests.
+func (d *debugCapture) begin(req *proxy.Request) func() {
+	if !withDebugCapture || d == nil {
+		return func() {}
+	}
+
+	var dialog string
+	if req.Key != nil {
+		dialog = req.Key.Dialog
+	}
+	call := capturedCall(req)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if call == "" || !d.kinds[req.Kind] && (dialog == "" || !d.dialogs[dialog]) {
+		return func() {}
+	}
+
+	r := &capturedRequest{kind: req.Kind, dialog: dialog, call: call}
+	d.requests[r] = struct{}{}
+	atomic.AddInt32(&d.active, 1)
+
+	return func() {
+		d.mu.Lock()
+		delete(d.requests, r)
+		d.mu.Unlock()
+		atomic.AddInt32(&d.active, -1)
+	}
+}
+
+// matching returns the requests being captured which made the given ARI
+// request
+func (d *debugCapture) matching(req *http.Request) (ret []*capturedRequest) {
+	u := req.URL.String()
+	if !strings.HasPrefix(u, d.url+"/") {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for r := range d.requests {
+		if strings.Contains(req.URL.EscapedPath(), r.call) || strings.Contains(req.URL.RawQuery, r.call) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// record adds the exchange to the buffer of the call of each of the given
+// requests
+func (d *debugCapture) record(requests []*capturedRequest, x proxy.ARIExchange) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, r := range requests {
+		x.Kind, x.Dialog = r.kind, r.dialog
+
+		buf := append(d.calls[r.call], x)
+		if len(buf) > maxDebugCaptureExchanges {
+			buf = buf[len(buf)-maxDebugCaptureExchanges:]
+		}
+		d.calls[r.call] = buf
+
+		// Move the call to the end of the order, discarding the least
+		// recently captured call once there are too many
+		for i, id := range d.order {
+			if id == r.call {
+				d.order = append(d.order[:i], d.order[i+1:]...)
+				break
+			}
+		}
+		d.order = append(d.order, r.call)
+		if len(d.order) > maxDebugCaptureCalls {
+			delete(d.calls, d.order[0])
+			d.order = d.order[1:]
+		}
+	}
+}
+
+// data describes the capture, with the exchanges captured for the given call
+func (d *debugCapture) data(call string) *proxy.DebugCaptureData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ret := &proxy.DebugCaptureData{
+		Exchanges: append([]proxy.ARIExchange(nil), d.calls[call]...),
+	}
+	for k := range d.kinds {
+		ret.Kinds = append(ret.Kinds, k)
+	}
+	for id := range d.dialogs {
+		ret.Dialogs = append(ret.Dialogs, id)
+	}
+	sort.Strings(ret.Kinds)
+	sort.Strings(ret.Dialogs)
+	return ret
+}
+
+// captureTransport is the http.RoundTripper of the ARI requests of a server,
+// which captures the exchanges selected by its debug capture.  Requests pass
+// straight through while nothing is being captured.  Bodies are streamed,
+// and only their first maxDebugCaptureBody bytes are captured.
+type captureTransport struct {
+	next    http.RoundTripper
+	capture *debugCapture
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d := t.capture
+	if atomic.LoadInt32(&d.active) == 0 {
+		return t.next.RoundTrip(req)
+	}
+	requests := d.matching(req)
+	if len(requests) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	x := proxy.ARIExchange{
+		Time:   d.clock.Now(),
+		Method: req.Method,
+		URL:    req.URL.String(),
+	}
+
+	reqBody := new(captureBuffer)
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &captureBody{ReadCloser: req.Body, buf: reqBody}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	x.Duration = time.Since(start)
+	x.RequestBody = reqBody.String()
+	if err != nil {
+		x.Error = err.Error()
+		d.record(requests, x)
+		return resp, err
+	}
+
+	// The exchange is recorded once the response body is read or closed
+	x.Status = resp.StatusCode
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		buf:        new(captureBuffer),
+		done: func(body string, err error) {
+			x.ResponseBody = body
+			if err != nil {
+				x.Error = err.Error()
+			}
+			d.record(requests, x)
+		},
+	}
+	return resp, nil
+}
+
+// captureBuffer keeps the first maxDebugCaptureBody bytes written to it
+type captureBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+	mu        sync.Mutex
+}
+
+func (b *captureBuffer) write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := maxDebugCaptureBody - b.buf.Len(); len(p) > n {
+		p, b.truncated = p[:n], true
+	}
+	b.buf.Write(p)
+}
+
+// String returns the captured data, marked if it was truncated
+func (b *captureBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return b.buf.String() + "..."
+	}
+	return b.buf.String()
+}
+
+// captureBody is a body which is captured into a buffer as it is read, and
+// which reports the captured data, and any read error, once it is fully read
+// or closed
+type captureBody struct {
+	io.ReadCloser
+	buf  *captureBuffer
+	done func(body string, err error)
+	once sync.Once
+}
+
+// Read implements io.Reader
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.write(p[:n])
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *captureBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *captureBody) finish(err error) {
+	if b.done == nil {
+		return
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	b.once.Do(func() {
+		b.done(b.buf.String(), err)
+	})
+}
+
+func (s *Server) debugCaptureStart(ctx context.Context, reply string, req *proxy.Request) {
+	if err := s.debugCaptureError(req); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	if req.DebugCapture == nil || (len(req.DebugCapture.Kinds) == 0 && len(req.DebugCapture.Dialogs) == 0) {
+		s.sendError(reply, eris.New("no kinds or dialogs to capture"))
+		return
+	}
+	for _, k := range req.DebugCapture.Kinds {
+		if !isSupportedKind(k) {
+			s.sendError(reply, eris.Errorf("unknown request kind %q", k))
+			return
+		}
+	}
+
+	s.Log.Info("starting ARI debug capture", "kinds", req.DebugCapture.Kinds, "dialogs", req.DebugCapture.Dialogs)
+	s.debugCapture.start(req.DebugCapture.Kinds, req.DebugCapture.Dialogs)
+	s.sendError(reply, nil)
+}
+
+func (s *Server) debugCaptureStop(ctx context.Context, reply string, req *proxy.Request) {
+	if err := s.debugCaptureError(req); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	var kinds, dialogs []string
+	if req.DebugCapture != nil {
+		kinds, dialogs = req.DebugCapture.Kinds, req.DebugCapture.Dialogs
+	}
+	s.Log.Info("stopping ARI debug capture", "kinds", kinds, "dialogs", dialogs)
+	s.debugCapture.stop(kinds, dialogs)
+	s.sendError(reply, nil)
+}
+
+func (s *Server) debugCaptureData(ctx context.Context, reply string, req *proxy.Request) {
+	if err := s.debugCaptureError(req); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	var call string
+	if req.DebugCapture != nil {
+		call = req.DebugCapture.Call
+	}
+	s.publish(reply, &proxy.Response{
+		Key: req.Key,
+		Data: &proxy.EntityData{
+			DebugCapture: s.debugCapture.data(call),
+		},
+	})
+}
@@ -0,0 +1,184 @@
+//go:build !no_debugcapture
+// +build !no_debugcapture
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
+)
+
+func TestDebugCapture(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"c1"}`)) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	d := newDebugCapture(ts.URL+"/ari", clock.Real)
+	c := &http.Client{Transport: d.transport}
+
+	get := func(path string) {
+		resp, err := c.Post(ts.URL+path, "application/json", strings.NewReader(`{"variables":{}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close() // nolint: errcheck
+		if string(body) != `{"id":"c1"}` {
+			t.Errorf("response body altered: %s", body)
+		}
+	}
+
+	// Nothing is captured until the kind is selected
+	end := d.begin(&proxy.Request{Kind: "ChannelAnswer", Key: ari.NewKey(ari.ChannelKey, "c1")})
+	get("/ari/channels/c1/answer")
+	end()
+
+	d.start([]string{"ChannelAnswer"}, []string{"d1"})
+	end = d.begin(&proxy.Request{Kind: "ChannelAnswer", Key: ari.NewKey(ari.ChannelKey, "c1")})
+	get("/ari/channels/c1/answer")
+	get("/ari/channels/c2/answer")
+	get("/other/channels/c1")
+	end()
+
+	// Requests which name no entity are not captured
+	end = d.begin(&proxy.Request{Kind: "ChannelAnswer"})
+	get("/ari/channels/c1/answer")
+	end()
+
+	// Requests of other kinds are captured in their dialog
+	end = d.begin(&proxy.Request{Kind: "ChannelHangup", Key: ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d1"))})
+	get("/ari/channels/c1")
+	end()
+	get("/ari/channels/c1/answer")
+
+	data := d.data("c1")
+	if len(data.Exchanges) != 2 {
+		t.Fatalf("captured %d exchanges, want 2: %+v", len(data.Exchanges), data.Exchanges)
+	}
+	x := data.Exchanges[0]
+	if x.Kind != "ChannelAnswer" || x.Method != http.MethodPost || x.URL != ts.URL+"/ari/channels/c1/answer" ||
+		x.Status != http.StatusOK || x.RequestBody != `{"variables":{}}` || x.ResponseBody != `{"id":"c1"}` {
+		t.Errorf("unexpected exchange %+v", x)
+	}
+	if x = data.Exchanges[1]; x.Kind != "ChannelHangup" || x.Dialog != "d1" {
+		t.Errorf("unexpected dialog exchange %+v", x)
+	}
+	if len(data.Kinds) != 1 || len(data.Dialogs) != 1 {
+		t.Errorf("unexpected capture %v %v", data.Kinds, data.Dialogs)
+	}
+
+	d.stop(nil, nil)
+	if data = d.data("c1"); len(data.Kinds) != 0 || len(data.Dialogs) != 0 || len(data.Exchanges) != 2 {
+		t.Errorf("unexpected capture after stop %+v", data)
+	}
+}
+
+func TestDebugCaptureBuffers(t *testing.T) {
+	d := newDebugCapture("", clock.Real)
+	for i := 0; i < maxDebugCaptureCalls+1; i++ {
+		r := &capturedRequest{call: string(rune('A' + i))}
+		d.record([]*capturedRequest{r}, proxy.ARIExchange{})
+	}
+	for i := 0; i < maxDebugCaptureExchanges+1; i++ {
+		d.record([]*capturedRequest{{call: "B"}}, proxy.ARIExchange{})
+	}
+
+	if len(d.calls) != maxDebugCaptureCalls || d.calls["A"] != nil {
+		t.Errorf("%d calls kept", len(d.calls))
+	}
+	if n := len(d.calls["B"]); n != maxDebugCaptureExchanges {
+		t.Errorf("%d exchanges kept", n)
+	}
+}
+
+func TestDebugCaptureLargeBody(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 10*maxDebugCaptureBody)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	d := newDebugCapture(ts.URL+"/ari", clock.Real)
+	d.start([]string{"StoredRecordingFile"}, nil)
+	end := d.begin(&proxy.Request{Kind: "StoredRecordingFile", Key: ari.NewKey(ari.StoredRecordingKey, "r1")})
+	defer end()
+
+	resp, err := (&http.Client{Transport: d.transport}).Get(ts.URL + "/ari/recordings/stored/r1/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close() // nolint: errcheck
+	if !bytes.Equal(body, large) {
+		t.Errorf("response body altered: %d bytes", len(body))
+	}
+
+	data := d.data("r1")
+	if len(data.Exchanges) != 1 {
+		t.Fatalf("captured %d exchanges, want 1", len(data.Exchanges))
+	}
+	if got := data.Exchanges[0].ResponseBody; len(got) != maxDebugCaptureBody+len("...") {
+		t.Errorf("captured %d bytes of the response body", len(got))
+	}
+}
+
+func TestDebugCaptureRelay(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	d := newDebugCapture(ts.URL+"/ari", clock.Real)
+	opts, stop, err := d.relay(&native.Options{URL: ts.URL + "/ari", Username: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if opts.URL == ts.URL+"/ari" || opts.Username != "u" {
+		t.Fatalf("unexpected relayed options %+v", opts)
+	}
+
+	d.start([]string{"ChannelAnswer"}, nil)
+	end := d.begin(&proxy.Request{Kind: "ChannelAnswer", Key: ari.NewKey(ari.ChannelKey, "c1")})
+	resp, err := http.Post(opts.URL+"/channels/c1/answer", "application/json", nil)
+	end()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if path != "/ari/channels/c1/answer" {
+		t.Errorf("request relayed to %q", path)
+	}
+	if data := d.data("c1"); len(data.Exchanges) != 1 || data.Exchanges[0].URL != ts.URL+"/ari/channels/c1/answer" {
+		t.Errorf("unexpected relayed exchanges %+v", data.Exchanges)
+	}
+}
+
+func TestDebugCaptureError(t *testing.T) {
+	s := new(Server)
+	if err := s.debugCaptureError(new(proxy.Request)); err != errDebugCaptureDisabled {
+		t.Errorf("unexpected error without AllowDebugCapture: %v", err)
+	}
+
+	s.AllowDebugCapture = true
+	s.debugCapture = newDebugCapture("", clock.Real)
+	if err := s.debugCaptureError(new(proxy.Request)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := s.debugCaptureError(&proxy.Request{Tenant: "t1"}); err == nil {
+		t.Error("debug capture allowed to a tenant")
+	}
+}
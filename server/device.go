@@ -43,9 +43,7 @@ func (s *Server) deviceStateList(ctx context.Context, reply string, req *proxy.R
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) deviceStateUpdate(ctx context.Context, reply string, req *proxy.Request) {
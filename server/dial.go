@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// pendingDial is a dial which has not yet been answered
+type pendingDial struct {
+	channel string
+
+	// caller is the ID of the calling channel, if any
+	caller string
+
+	// started is the time at which the dial was requested
+	started time.Time
+
+	// status is the last dial status reported by Asterisk
+	status string
+
+	// outcome is the result of a dial which the proxy has ended (by timeout or
+	// cancellation) and which is awaiting the destruction of its channel
+	outcome string
+
+	// timer hangs up the channel when the dial times out
+	timer *time.Timer
+}
+
+// dialTracker tracks the dials in progress, indexed by channel ID
+type dialTracker struct {
+	m  map[string]*pendingDial
+	mu sync.Mutex
+}
+
+// add registers a dial in progress.  It returns false if the channel is
+// already being dialed.
+func (t *dialTracker) add(d *pendingDial) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m == nil {
+		t.m = make(map[string]*pendingDial)
+	}
+	if _, ok := t.m[d.channel]; ok {
+		return false
+	}
+	t.m[d.channel] = d
+	return true
+}
+
+// expire marks the given dial as timed out, if it is still in progress.  It
+// returns false if the dial has already ended.
+func (t *dialTracker) expire(d *pendingDial) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m[d.channel] != d || d.outcome != "" {
+		return false
+	}
+	d.outcome = proxy.DialNoAnswer
+	return true
+}
+
+// cancel marks the dial of the given channel as cancelled, if it is still in
+// progress.  The dial remains tracked until its channel is destroyed, so that
+// its result can be reported.
+func (t *dialTracker) cancel(channel string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.m[channel]
+	if !ok || d.outcome != "" {
+		return false
+	}
+	d.outcome = proxy.DialCancelled
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	return true
+}
+
+// remove ends the tracking of the dial of the given channel, returning it if
+// it was in progress
+func (t *dialTracker) remove(channel string) (*pendingDial, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.m[channel]
+	if !ok {
+		return nil, false
+	}
+	delete(t.m, channel)
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	return d, true
+}
+
+// resolve updates the dials in progress from the given event, returning the
+// result of the dial which it concludes, if any
+func (t *dialTracker) resolve(e ari.Event) *proxy.DialResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var d *pendingDial
+	var cause int
+	var causeText string
+
+	switch v := e.(type) {
+	case *ari.Dial:
+		d = t.m[v.Peer.ID]
+		if d == nil || v.Dialstatus == "" {
+			return nil
+		}
+		d.status = v.Dialstatus
+		if v.Dialstatus != "ANSWER" {
+			// Wait for the channel to be destroyed, which reports the cause
+			return nil
+		}
+	case *ari.ChannelStateChange:
+		d = t.m[v.Channel.ID]
+		if d == nil || v.Channel.State != "Up" {
+			return nil
+		}
+		d.status = "ANSWER"
+	case *ari.ChannelDestroyed:
+		d = t.m[v.Channel.ID]
+		if d == nil {
+			return nil
+		}
+		cause, causeText = v.Cause, v.CauseTxt
+	default:
+		return nil
+	}
+
+	delete(t.m, d.channel)
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	result := d.outcome
+	if d.status == "ANSWER" || result == "" {
+		result = dialResult(d.status, cause)
+	}
+
+	ret := &proxy.DialResult{
+		ChannelID:  d.channel,
+		Caller:     d.caller,
+		Result:     result,
+		DialStatus: d.status,
+		Cause:      cause,
+		CauseText:  causeText,
+	}
+	if !d.started.IsZero() {
+		ret.Duration = time.Since(d.started)
+	}
+	return ret
+}
+
+// dialResult returns the outcome of a dial, given the last dial status
+// reported by Asterisk and the hangup cause of the dialed channel
+func dialResult(status string, cause int) string {
+	switch status {
+	case "ANSWER":
+		return proxy.DialAnswer
+	case "BUSY":
+		return proxy.DialBusy
+	case "NOANSWER":
+		return proxy.DialNoAnswer
+	case "CONGESTION":
+		return proxy.DialCongestion
+	case "CHANUNAVAIL":
+		return proxy.DialUnavailable
+	case "CANCEL":
+		return proxy.DialCancelled
+	case "DONTCALL", "TORTURE", "INVALIDARGS":
+		return proxy.DialFailed
+	}
+
+	// No final status was reported, so derive the outcome from the Q.850
+	// hangup cause
+	switch cause {
+	case 17, 21:
+		return proxy.DialBusy
+	case 18, 19, 20:
+		return proxy.DialNoAnswer
+	case 34, 38, 41, 42, 44, 47:
+		return proxy.DialCongestion
+	case 1, 2, 3, 27, 28:
+		return proxy.DialUnavailable
+	case 16:
+		return proxy.DialCancelled
+	}
+	return proxy.DialFailed
+}
+
+func (s *Server) channelDial(ctx context.Context, reply string, req *proxy.Request) {
+	d := &pendingDial{
+		channel: req.Key.ID,
+		caller:  req.ChannelDial.Caller,
+		started: time.Now(),
+	}
+	if !s.dials.add(d) {
+		s.sendError(reply, eris.Errorf("channel %s is already being dialed", req.Key.ID))
+		return
+	}
+
+	// Asterisk only enforces whole seconds, so the proxy enforces the timeout
+	// itself
+	if timeout := req.ChannelDial.Timeout; timeout > 0 {
+		s.dials.mu.Lock()
+		d.timer = time.AfterFunc(timeout, func() {
+			s.timeoutDial(d)
+		})
+		s.dials.mu.Unlock()
+	}
+
+	if err := s.ari.Channel().Dial(req.Key, req.ChannelDial.Caller, req.ChannelDial.Timeout); err != nil {
+		s.dials.remove(d.channel)
+		s.sendError(reply, err)
+		return
+	}
+	s.sendError(reply, nil)
+}
+
+// timeoutDial hangs up a channel whose dial was not answered in time
+func (s *Server) timeoutDial(d *pendingDial) {
+	if !s.dials.expire(d) {
+		return
+	}
+
+	if err := s.ari.Channel().Hangup(ari.NewKey(ari.ChannelKey, d.channel), "no_answer"); err != nil {
+		s.Log.Debug("failed to hang up timed out dial", "channel", d.channel, "error", err)
+	}
+}
+
+func (s *Server) dialCancel(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	// Only unanswered dials may be cancelled; an answered call must be hung
+	// up explicitly
+	if !s.dials.cancel(req.Key.ID) {
+		s.sendError(reply, eris.Errorf("no dial of channel %s is in progress", req.Key.ID))
+		return
+	}
+
+	reason := "normal"
+	if req.DialCancel != nil && req.DialCancel.Reason != "" {
+		reason = req.DialCancel.Reason
+	}
+	s.sendError(reply, s.ari.Channel().Hangup(req.Key, reason))
+}
+
+// processDialEvent correlates the events of dials in progress, publishing a
+// DialResult event when a dial is answered or its channel is destroyed
+func (s *Server) processDialEvent(e ari.Event) {
+	ev := s.dials.resolve(e)
+	if ev == nil {
+		return
+	}
+	ev.EventData = s.newEventData(proxy.EventDialResult)
+
+	s.publishEvent(ev)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestDialTracker(t *testing.T) {
+	var dt dialTracker
+
+	d := &pendingDial{channel: "c1", timer: time.AfterFunc(time.Hour, func() {})}
+	if !dt.add(d) {
+		t.Fatal("failed to add dial")
+	}
+	if dt.add(&pendingDial{channel: "c1"}) {
+		t.Error("channel should not be dialed twice")
+	}
+
+	if _, ok := dt.remove("c1"); !ok {
+		t.Error("failed to remove dial")
+	}
+	if dt.expire(d) {
+		t.Error("removed dial should not expire")
+	}
+
+	// A stale timer does not end a later dial of the same channel
+	d2 := &pendingDial{channel: "c1"}
+	dt.add(d2)
+	if dt.expire(d) {
+		t.Error("stale dial should not expire the current dial")
+	}
+	if !dt.expire(d2) {
+		t.Error("current dial should expire")
+	}
+}
+
+func TestResolveDial(t *testing.T) {
+	var dt dialTracker
+	dt.add(&pendingDial{channel: "c1", caller: "a1"})
+	dt.add(&pendingDial{channel: "c2"})
+	dt.add(&pendingDial{channel: "c3"})
+
+	if r := dt.resolve(&ari.ChannelStateChange{Channel: ari.ChannelData{ID: "c1", State: "Ringing"}}); r != nil {
+		t.Errorf("ringing dial should not have a result: %+v", r)
+	}
+	if _, ok := dt.m["c1"]; !ok {
+		t.Error("ringing dial should remain in progress")
+	}
+
+	r := dt.resolve(&ari.ChannelStateChange{Channel: ari.ChannelData{ID: "c1", State: "Up"}})
+	if r == nil || r.Result != proxy.DialAnswer || r.Caller != "a1" {
+		t.Errorf("unexpected result of answered dial: %+v", r)
+	}
+	if _, ok := dt.m["c1"]; ok {
+		t.Error("answered dial should no longer be in progress")
+	}
+
+	// The final dial status takes precedence over the hangup cause
+	dt.resolve(&ari.Dial{Peer: ari.ChannelData{ID: "c2"}, Dialstatus: "BUSY"})
+	if _, ok := dt.m["c2"]; !ok {
+		t.Error("busy dial should await the destruction of its channel")
+	}
+	r = dt.resolve(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c2"}, Cause: 16, CauseTxt: "Normal Clearing"})
+	if r == nil || r.Result != proxy.DialBusy || r.DialStatus != "BUSY" || r.Cause != 16 {
+		t.Errorf("unexpected result of busy dial: %+v", r)
+	}
+	if _, ok := dt.m["c2"]; ok {
+		t.Error("destroyed dial should no longer be in progress")
+	}
+
+	// A dial ended by the proxy reports its own outcome
+	dt.cancel("c3")
+	r = dt.resolve(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c3"}, Cause: 16})
+	if r == nil || r.Result != proxy.DialCancelled {
+		t.Errorf("unexpected result of cancelled dial: %+v", r)
+	}
+
+	if r := dt.resolve(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c3"}}); r != nil {
+		t.Errorf("dial result should only be reported once: %+v", r)
+	}
+}
+
+func TestDialResultFromCause(t *testing.T) {
+	for cause, expected := range map[int]string{
+		17: proxy.DialBusy,
+		19: proxy.DialNoAnswer,
+		34: proxy.DialCongestion,
+		1:  proxy.DialUnavailable,
+		16: proxy.DialCancelled,
+		99: proxy.DialFailed,
+	} {
+		if r := dialResult("", cause); r != expected {
+			t.Errorf("cause %d: expected %s, got %s", cause, expected, r)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// campaign is the state of a dialer campaign
+type campaign struct {
+	id     string
+	cfg    proxy.Campaign
+	dialog string
+	tenant string
+
+	queue  []string
+	active map[string]string // channel ID -> number
+
+	// answered is the set of active channels which have been answered
+	answered map[string]bool
+
+	stats  proxy.CampaignStats
+	paused bool
+
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+}
+
+func newCampaign(id string, cfg proxy.Campaign) *campaign {
+	queue := make([]string, len(cfg.Numbers))
+	copy(queue, cfg.Numbers)
+
+	return &campaign{
+		id:       id,
+		cfg:      cfg,
+		queue:    queue,
+		active:   make(map[string]string),
+		answered: make(map[string]bool),
+		stats: proxy.CampaignStats{
+			ID:    id,
+			State: proxy.CampaignRunning,
+			Total: len(queue),
+		},
+	}
+}
+
+// next returns the next number to dial, if the campaign is running and below
+// its concurrency limit
+func (c *campaign) next() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused || len(c.queue) == 0 {
+		return "", false
+	}
+	if c.cfg.Concurrency > 0 && len(c.active) >= c.cfg.Concurrency {
+		return "", false
+	}
+
+	n := c.queue[0]
+	c.queue = c.queue[1:]
+	return n, true
+}
+
+// dialed records the result of an origination
+func (c *campaign) dialed(id, number string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Dialed++
+	if err != nil {
+		c.stats.Failed++
+		return
+	}
+	c.active[id] = number
+}
+
+// process updates the campaign from a channel event.  It returns true if the
+// event concerned one of the campaign's channels.
+func (c *campaign) process(e ari.Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch v := e.(type) {
+	case *ari.StasisStart:
+		if _, ok := c.active[v.Channel.ID]; !ok || c.answered[v.Channel.ID] {
+			return false
+		}
+		c.answered[v.Channel.ID] = true
+		c.stats.Answered++
+		return true
+	case *ari.ChannelDestroyed:
+		if _, ok := c.active[v.Channel.ID]; !ok {
+			return false
+		}
+		if !c.answered[v.Channel.ID] {
+			c.stats.NoAnswer++
+		}
+		delete(c.active, v.Channel.ID)
+		delete(c.answered, v.Channel.ID)
+		return true
+	}
+	return false
+}
+
+// machine records an answered call which AMD classified as a machine
+func (c *campaign) machine() {
+	c.mu.Lock()
+	c.stats.Machines++
+	c.mu.Unlock()
+}
+
+func (c *campaign) setPaused(paused bool) {
+	c.mu.Lock()
+	c.paused = paused
+	if paused {
+		c.stats.State = proxy.CampaignPaused
+	} else {
+		c.stats.State = proxy.CampaignRunning
+	}
+	c.mu.Unlock()
+}
+
+// done indicates whether all numbers have been dialed and all calls have ended
+func (c *campaign) done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.queue) == 0 && len(c.active) == 0
+}
+
+// Stats returns a snapshot of the campaign statistics
+func (c *campaign) Stats() proxy.CampaignStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := c.stats
+	ret.Pending = len(c.queue)
+	ret.Active = len(c.active)
+	return ret
+}
+
+func (c *campaign) finish(state string) {
+	c.mu.Lock()
+	c.stats.State = state
+	c.mu.Unlock()
+}
+
+// campaignSet is the set of campaigns known to the server
+type campaignSet struct {
+	m  map[string]*campaign
+	mu sync.RWMutex
+}
+
+func (cs *campaignSet) add(c *campaign) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.m == nil {
+		cs.m = make(map[string]*campaign)
+	}
+	if old, ok := cs.m[c.id]; ok && old.Stats().State != proxy.CampaignStopped && old.Stats().State != proxy.CampaignCompleted {
+		return eris.Errorf("campaign %s is already running", c.id)
+	}
+	cs.m[c.id] = c
+	return nil
+}
+
+func (cs *campaignSet) get(id string) (*campaign, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	c, ok := cs.m[id]
+	if !ok {
+		return nil, proxy.ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *Server) campaignStart(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Campaign == nil || len(req.Campaign.Numbers) == 0 {
+		s.sendError(reply, eris.New("campaign requires a list of numbers"))
+		return
+	}
+	if !strings.Contains(req.Campaign.Endpoint, "{number}") {
+		s.sendError(reply, eris.New("campaign endpoint must contain {number}"))
+		return
+	}
+
+	id := req.Key.ID
+	if id == "" {
+		id = rid.New("cp")
+	}
+
+	c := newCampaign(id, *req.Campaign)
+	c.dialog = req.Key.Dialog
+	c.tenant = req.Tenant
+
+	if err := s.campaigns.add(c); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	var cctx context.Context
+	cctx, c.cancel = context.WithCancel(ctx)
+
+	go s.runCampaign(cctx, c)
+
+	s.publish(reply, &proxy.Response{
+		Key: ari.NewKey(proxy.CampaignKey, id, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+	})
+}
+
+func (s *Server) campaignPause(ctx context.Context, reply string, req *proxy.Request) {
+	c, err := s.campaigns.get(req.Key.ID)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	c.setPaused(true)
+	s.sendError(reply, nil)
+}
+
+func (s *Server) campaignResume(ctx context.Context, reply string, req *proxy.Request) {
+	c, err := s.campaigns.get(req.Key.ID)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	c.setPaused(false)
+	s.sendError(reply, nil)
+}
+
+func (s *Server) campaignStop(ctx context.Context, reply string, req *proxy.Request) {
+	c, err := s.campaigns.get(req.Key.ID)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	c.cancel()
+	s.sendError(reply, nil)
+}
+
+func (s *Server) campaignStats(ctx context.Context, reply string, req *proxy.Request) {
+	c, err := s.campaigns.get(req.Key.ID)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	stats := c.Stats()
+	s.publish(reply, &proxy.Response{
+		Data: &proxy.EntityData{
+			Campaign: &stats,
+		},
+	})
+}
+
+// runCampaign dials the numbers of the campaign at its configured pace until
+// all numbers have been dialed and all calls have ended, or the campaign is
+// stopped.  Answered calls enter the ARI application normally.
+func (s *Server) runCampaign(ctx context.Context, c *campaign) {
+	sub := s.ari.Bus().Subscribe(nil, ari.Events.StasisStart, ari.Events.ChannelDestroyed)
+	defer sub.Cancel()
+
+	interval := time.Second
+	if c.cfg.CallsPerMinute > 0 {
+		interval = time.Minute / time.Duration(c.cfg.CallsPerMinute)
+	}
+	ticker := s.clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	state := proxy.CampaignCompleted
+
+loop:
+	for !c.done() {
+		select {
+		case <-ctx.Done():
+			state = proxy.CampaignStopped
+			break loop
+		case <-ticker.C():
+			if number, ok := c.next(); ok {
+				s.dialCampaignNumber(c, number)
+			}
+		case e := <-sub.Events():
+			if c.process(e) && c.cfg.AMD != nil && s.AMD != nil {
+				if v, ok := e.(*ari.StasisStart); ok {
+					go s.campaignAMD(ctx, c, v.Channel.ID)
+				}
+			}
+		}
+	}
+
+	c.finish(state)
+
+	s.publishEvent(&proxy.CampaignFinished{
+		EventData:     s.newEventData(proxy.EventCampaignFinished),
+		CampaignStats: c.Stats(),
+	})
+}
+
+func (s *Server) dialCampaignNumber(c *campaign, number string) {
+	timeout := c.cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	appArgs := c.cfg.AppArgs
+	if appArgs == "" {
+		appArgs = "campaign:" + c.id
+	}
+
+	id := rid.New(rid.Channel)
+	req := &proxy.Request{
+		Kind:   "CampaignStart",
+		Key:    ari.NewKey(ari.ChannelKey, id, ari.WithDialog(c.dialog)),
+		Tenant: c.tenant,
+	}
+
+	orig := ari.OriginateRequest{
+		Endpoint:  strings.Replace(c.cfg.Endpoint, "{number}", number, -1),
+		Timeout:   int(timeout / time.Second),
+		CallerID:  c.cfg.CallerID,
+		App:       s.Application,
+		AppArgs:   appArgs,
+		ChannelID: id,
+		Variables: c.cfg.Variables,
+	}
+
+	if c.dialog != "" {
+		s.Dialog.Bind(c.dialog, "channel", id)
+	}
+
+	err := s.originateLeg(req, &orig)
+	if err != nil {
+		s.Log.Warn("campaign call failed", "campaign", c.id, "number", number, "error", err)
+	}
+	c.dialed(id, number, err)
+}
+
+// campaignAMD runs answering machine detection on an answered campaign call,
+// hanging it up if it was answered by a machine and the campaign so requests
+func (s *Server) campaignAMD(ctx context.Context, c *campaign, id string) {
+	key := ari.NewKey(ari.ChannelKey, id, ari.WithDialog(c.dialog))
+
+	ev := s.detectAMD(ctx, key, c.cfg.AMD)
+	s.publishEvent(ev)
+
+	if ev.Status != proxy.AMDMachine {
+		return
+	}
+	c.machine()
+
+	if c.cfg.HangupMachines {
+		if err := s.ari.Channel().Hangup(key, "normal"); err != nil {
+			s.Log.Debug("failed to hang up machine-answered call", "campaign", c.id, "channel", id, "error", err)
+		}
+	}
+}
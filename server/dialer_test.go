@@ -0,0 +1,147 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCampaignPacing(t *testing.T) {
+	c := newCampaign("cp1", proxy.Campaign{
+		Numbers:     []string{"100", "101", "102"},
+		Concurrency: 2,
+	})
+
+	n, ok := c.next()
+	if !ok || n != "100" {
+		t.Fatalf("expected first number, got %q (%v)", n, ok)
+	}
+	c.dialed("c1", n, nil)
+
+	n, _ = c.next()
+	c.dialed("c2", n, nil)
+
+	if _, ok = c.next(); ok {
+		t.Error("concurrency limit not enforced")
+	}
+
+	c.process(&ari.StasisStart{Channel: ari.ChannelData{ID: "c1"}})
+	c.process(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c1"}})
+	c.process(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c2"}})
+
+	c.setPaused(true)
+	if _, ok = c.next(); ok {
+		t.Error("paused campaign should not dial")
+	}
+	c.setPaused(false)
+
+	n, ok = c.next()
+	if !ok || n != "102" {
+		t.Fatalf("expected last number, got %q (%v)", n, ok)
+	}
+	c.dialed("c3", n, errHangup)
+
+	if !c.done() {
+		t.Error("campaign should be done")
+	}
+
+	stats := c.Stats()
+	if stats.Dialed != 3 || stats.Answered != 1 || stats.NoAnswer != 1 || stats.Failed != 1 || stats.Pending != 0 || stats.Active != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCampaignFlow(t *testing.T) {
+	fc := clock.NewFake(time.Unix(0, 0))
+	ft := newFlowTest(t, WithClock(fc))
+	defer ft.Close()
+
+	dialed := make(chan ari.OriginateRequest, 10)
+	ft.channel.On("Originate", mock.Anything, mock.Anything).Return(func(key *ari.Key, orig ari.OriginateRequest) *ari.ChannelHandle {
+		dialed <- orig
+		return ari.NewChannelHandle(key.New(ari.ChannelKey, orig.ChannelID), ft.channel, nil)
+	}, nil)
+
+	resp := ft.request(t, &proxy.Request{
+		Kind: "CampaignStart",
+		Key:  ari.NewKey(proxy.CampaignKey, "cp1"),
+		Campaign: &proxy.Campaign{
+			Numbers:        []string{"100", "101"},
+			Endpoint:       "PJSIP/{number}@trunk",
+			CallsPerMinute: 60,
+			Concurrency:    1,
+		},
+	})
+	if resp.Err() != nil || resp.Key == nil || resp.Key.ID != "cp1" {
+		t.Fatalf("unexpected response: %+v (%v)", resp, resp.Err())
+	}
+
+	// dial ticks the pacing of the campaign until it places a call
+	dial := func() ari.OriginateRequest {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			fc.Advance(time.Second)
+			select {
+			case orig := <-dialed:
+				return orig
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		t.Fatal("campaign placed no call")
+		return ari.OriginateRequest{}
+	}
+	stats := func() *proxy.CampaignStats {
+		t.Helper()
+		resp := ft.request(t, &proxy.Request{Kind: "CampaignStats", Key: ari.NewKey(proxy.CampaignKey, "cp1")})
+		if resp.Err() != nil || resp.Data == nil || resp.Data.Campaign == nil {
+			t.Fatalf("unexpected stats response: %+v (%v)", resp, resp.Err())
+		}
+		return resp.Data.Campaign
+	}
+
+	first := dial()
+	if first.Endpoint != "PJSIP/100@trunk" || first.App != "app" || first.AppArgs != "campaign:cp1" {
+		t.Errorf("unexpected origination: %+v", first)
+	}
+
+	// The second call waits for the first to end
+	fc.Advance(5 * time.Second)
+	select {
+	case orig := <-dialed:
+		t.Fatalf("concurrency limit exceeded by %s", orig.Endpoint)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if st := stats(); st.Dialed != 1 || st.Active != 1 || st.Pending != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	ft.send(&ari.StasisStart{
+		EventData: ari.EventData{Type: ari.Events.StasisStart},
+		Channel:   ari.ChannelData{ID: first.ChannelID},
+	})
+	ft.send(&ari.ChannelDestroyed{
+		EventData: ari.EventData{Type: ari.Events.ChannelDestroyed},
+		Channel:   ari.ChannelData{ID: first.ChannelID},
+	})
+
+	second := dial()
+	if second.Endpoint != "PJSIP/101@trunk" {
+		t.Errorf("unexpected origination: %+v", second)
+	}
+	ft.send(&ari.ChannelDestroyed{
+		EventData: ari.EventData{Type: ari.Events.ChannelDestroyed},
+		Channel:   ari.ChannelData{ID: second.ChannelID},
+	})
+
+	e, ok := ft.event(t, proxy.EventCampaignFinished).(*proxy.CampaignFinished)
+	if !ok {
+		t.Fatal("unexpected event")
+	}
+	if e.ID != "cp1" || e.State != proxy.CampaignCompleted || e.Dialed != 2 || e.Answered != 1 || e.NoAnswer != 1 || e.Active != 0 {
+		t.Errorf("unexpected campaign result: %+v", e.CampaignStats)
+	}
+}
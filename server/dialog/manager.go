@@ -4,7 +4,8 @@ import "sync"
 
 // Manager is a dialog manager, which tracks associations between dialogs and entities
 type Manager interface {
-	// List returns a list of dialogs for the given entity type-ID pair
+	// List returns a list of dialogs for the given entity type-ID pair.  The
+	// returned list must not be modified.
 	List(eType, id string) []string
 
 	// Bind binds the given dialog to an entity type-ID pair
@@ -17,12 +18,27 @@ type Manager interface {
 	UnbindDialog(dialog string)
 }
 
-func bindingHash(eType, id string) string {
-	return eType + ":" + id
+// Counter is implemented by the Managers which can count their bindings, for
+// metrics
+type Counter interface {
+	// Count returns the number of dialogs with bindings and the total number
+	// of bindings
+	Count() (dialogs, bindings int)
 }
 
+// entity identifies an entity by its type and ID
+type entity struct {
+	eType string
+	id    string
+}
+
+// memManager indexes the bindings both by entity, for the lookup of the
+// dialogs of each event, and by dialog, so that unbinding a dialog need not
+// scan every binding.  The lists of dialogs are never modified once they are
+// stored, so that List may return them without copying.
 type memManager struct {
-	bindings map[string][]string
+	bindings map[entity][]string
+	dialogs  map[string]map[entity]struct{}
 
 	mu sync.RWMutex
 }
@@ -30,7 +46,8 @@ type memManager struct {
 // NewMemManager returns a new in-memory dialog manager
 func NewMemManager() Manager {
 	return &memManager{
-		bindings: make(map[string][]string),
+		bindings: make(map[entity][]string),
+		dialogs:  make(map[string]map[entity]struct{}),
 	}
 }
 
@@ -38,8 +55,8 @@ func (m *memManager) List(eType, id string) []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	list, ok := m.bindings[bindingHash(eType, id)]
-	if !ok {
+	list, ok := m.bindings[entity{eType, id}]
+	if !ok || len(list) == 0 {
 		return nil
 	}
 	return list
@@ -49,50 +66,75 @@ func (m *memManager) Bind(dialog, eType, id string) {
 	if dialog == "" || eType == "" || id == "" {
 		return
 	}
+	e := entity{eType, id}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	list, ok := m.bindings[bindingHash(eType, id)]
-	if !ok {
-		list = []string{dialog}
-	} else {
-		// Don't add the binding if it is already there
-		for _, b := range list {
-			if b == dialog {
-				return
-			}
+	list := m.bindings[e]
+
+	// Don't add the binding if it is already there
+	for _, b := range list {
+		if b == dialog {
+			return
 		}
+	}
+
+	// Add the dialog to a copy of the list, which may be in use by callers of
+	// List
+	m.bindings[e] = append(list[:len(list):len(list)], dialog)
 
-		// Add the dialog
-		list = append(list, dialog)
+	entities, ok := m.dialogs[dialog]
+	if !ok {
+		entities = make(map[entity]struct{})
+		m.dialogs[dialog] = entities
 	}
-	m.bindings[bindingHash(eType, id)] = list
+	entities[e] = struct{}{}
 }
 
 func (m *memManager) Unbind(eType, id string) {
+	e := entity{eType, id}
+
 	m.mu.Lock()
-	delete(m.bindings, bindingHash(eType, id))
+	for _, d := range m.bindings[e] {
+		if entities, ok := m.dialogs[d]; ok {
+			delete(entities, e)
+			if len(entities) == 0 {
+				delete(m.dialogs, d)
+			}
+		}
+	}
+	delete(m.bindings, e)
 	m.mu.Unlock()
 }
 
 func (m *memManager) UnbindDialog(dialog string) {
-
-	var dialogIndex int
-
 	m.mu.Lock()
-	for k, v := range m.bindings {
-		dialogIndex = -1
-		for i, d := range v {
-			if d == dialog {
-				dialogIndex = i
+	for e := range m.dialogs[dialog] {
+		list := m.bindings[e]
+
+		rest := make([]string, 0, len(list))
+		for _, d := range list {
+			if d != dialog {
+				rest = append(rest, d)
 			}
 		}
-		if dialogIndex >= 0 {
-			v[dialogIndex] = v[len(v)-1]
-			v = v[:len(v)-1]
-			m.bindings[k] = v
+		if len(rest) == 0 {
+			delete(m.bindings, e)
+		} else {
+			m.bindings[e] = rest
 		}
 	}
+	delete(m.dialogs, dialog)
 	m.mu.Unlock()
 }
+
+func (m *memManager) Count() (dialogs, bindings int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, entities := range m.dialogs {
+		bindings += len(entities)
+	}
+	return len(m.dialogs), bindings
+}
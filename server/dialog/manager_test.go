@@ -1,6 +1,9 @@
 package dialog
 
-import "testing"
+import (
+	"strconv"
+	"testing"
+)
 
 func TestMemBind(t *testing.T) {
 	m := NewMemManager().(*memManager)
@@ -23,12 +26,11 @@ func TestMemUnbindDialog(t *testing.T) {
 
 	m.UnbindDialog("testDialog")
 
-	// The unbinding of a dialog doesn't clear the testType/testID
-	if len(m.bindings) != 1 {
+	// The entity bound to no other dialog is forgotten
+	if len(m.bindings) != 0 {
 		t.Errorf("Unbinding Dialog failed; count %d != 0", len(m.bindings))
 	}
 
-	// But it should make the testType/testID empty
 	if i := len(m.List("testType", "testID")); i != 0 {
 		t.Errorf("List('testType','testID'); count %d != 0", i)
 	}
@@ -111,6 +113,19 @@ func TestMemBindDuplicate(t *testing.T) {
 	}
 }
 
+func TestMemCount(t *testing.T) {
+	m := NewMemManager().(*memManager)
+
+	m.Bind("d1", "channel", "c1")
+	m.Bind("d1", "bridge", "b1")
+	m.Bind("d2", "channel", "c1")
+	m.UnbindDialog("d2")
+
+	if dialogs, bindings := m.Count(); dialogs != 1 || bindings != 2 {
+		t.Errorf("Count() = %d, %d; expected 1, 2", dialogs, bindings)
+	}
+}
+
 func TestMemList(t *testing.T) {
 	m := NewMemManager().(*memManager)
 	m.Bind("testDialog", "testType", "testID")
@@ -142,3 +157,72 @@ func TestMemList(t *testing.T) {
 		t.Errorf("Incorrect number of testDialog2 dialogs: %d != 1", test2Found)
 	}
 }
+
+func TestMemListUnmodified(t *testing.T) {
+	m := NewMemManager()
+	m.Bind("testDialog", "testType", "testID")
+	m.Bind("testDialog2", "testType", "testID")
+
+	list := m.List("testType", "testID")
+
+	m.UnbindDialog("testDialog")
+	m.Bind("testDialog3", "testType", "testID")
+
+	if len(list) != 2 || list[0] != "testDialog" || list[1] != "testDialog2" {
+		t.Errorf("listed dialogs were modified: %v", list)
+	}
+	if l := m.List("testType", "testID"); len(l) != 2 || l[0] != "testDialog2" || l[1] != "testDialog3" {
+		t.Errorf("incorrect dialogs %v", l)
+	}
+}
+
+func TestMemUnbindDialogIndex(t *testing.T) {
+	m := NewMemManager().(*memManager)
+	m.Bind("testDialog", "testType", "testID")
+	m.Bind("testDialog", "testType", "testID2")
+	m.Bind("testDialog2", "testType", "testID")
+
+	m.Unbind("testType", "testID2")
+	if n := len(m.dialogs["testDialog"]); n != 1 {
+		t.Errorf("dialog index not updated by Unbind; count %d != 1", n)
+	}
+
+	m.UnbindDialog("testDialog")
+	if _, ok := m.dialogs["testDialog"]; ok {
+		t.Error("dialog index not updated by UnbindDialog")
+	}
+	if l := m.List("testType", "testID"); len(l) != 1 || l[0] != "testDialog2" {
+		t.Errorf("incorrect dialogs %v", l)
+	}
+}
+
+func benchmarkManager(n int) Manager {
+	m := NewMemManager()
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		m.Bind("dialog"+id, "channel", id)
+		m.Bind("dialog"+id, "bridge", "bridge"+id)
+	}
+	return m
+}
+
+func BenchmarkMemList(b *testing.B) {
+	m := benchmarkManager(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(m.List("channel", "5000")) != 1 {
+			b.Fatal("dialog not found")
+		}
+	}
+}
+
+func BenchmarkMemUnbindDialog(b *testing.B) {
+	m := benchmarkManager(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.UnbindDialog("dialog5000")
+		m.Bind("dialog5000", "channel", "5000")
+	}
+}
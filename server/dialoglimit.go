@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultDialogEventSummaryInterval is the default interval at which the
+// events dropped by the dialog event limit are summarized to their dialogs
+const DefaultDialogEventSummaryInterval = time.Second
+
+// DialogEventLimitConfig describes the limit on the rate at which events of
+// high-frequency types (e.g. ChannelVarset) are published to each dialog, so
+// that a storm of such events does not flood the clients of a dialog.  The
+// rate applies separately to each dialog and event type.  Events over the
+// limit are dropped, and the number dropped is periodically reported to the
+// dialog by a DialogEventsDropped event.  The canonical subjects of events
+// are not limited.
+type DialogEventLimitConfig struct {
+	// Types are the event types which are limited
+	Types []string `mapstructure:"types"`
+
+	// Rate is the number of events of each type per second which are
+	// published to each dialog
+	Rate float64 `mapstructure:"rate"`
+
+	// Burst is the number of events of each type which may be published to
+	// each dialog at once, in excess of the rate.  It defaults to 1.
+	Burst int `mapstructure:"burst"`
+
+	// Sample, if positive, publishes every Sample-th event over the limit
+	// rather than dropping them all, so that clients still observe a sample
+	// of the events of a storm
+	Sample int `mapstructure:"sample"`
+
+	// SummaryInterval is the interval at which the dropped events are
+	// reported to their dialogs.  It defaults to
+	// DefaultDialogEventSummaryInterval.
+	SummaryInterval time.Duration `mapstructure:"summary_interval"`
+}
+
+func (c *DialogEventLimitConfig) validate() error {
+	if len(c.Types) == 0 {
+		return eris.New("dialog event limit has no event types")
+	}
+	for _, t := range c.Types {
+		if t == "" {
+			return eris.New("dialog event limit has an empty event type")
+		}
+	}
+	if c.Rate <= 0 {
+		return eris.New("dialog event rate must be positive")
+	}
+	if c.Burst < 0 || c.Sample < 0 || c.SummaryInterval < 0 {
+		return eris.New("dialog event burst, sample and summary interval may not be negative")
+	}
+	return nil
+}
+
+// dialogEventKey identifies the events of a type published to a dialog
+type dialogEventKey struct {
+	dialog string
+	typ    string
+}
+
+// dialogEventBucket is the token bucket of the events of a type published to
+// a dialog
+type dialogEventBucket struct {
+	tokens float64
+	last   time.Time
+
+	// over counts the events over the limit, for sampling
+	over int
+
+	// dropped counts the events dropped since the last summary
+	dropped uint64
+}
+
+// dialogEventLimiter enforces a DialogEventLimitConfig
+type dialogEventLimiter struct {
+	rate   float64
+	burst  float64
+	sample int
+
+	types map[string]bool
+	clock clock.Clock
+
+	buckets map[dialogEventKey]*dialogEventBucket
+	mu      sync.Mutex
+}
+
+// newDialogEventLimiter returns the limiter described by the given
+// configuration, or nil if dialog events are not limited
+func newDialogEventLimiter(cfg *DialogEventLimitConfig, c clock.Clock) *dialogEventLimiter {
+	if cfg == nil {
+		return nil
+	}
+
+	l := &dialogEventLimiter{
+		rate:    cfg.Rate,
+		burst:   float64(cfg.Burst),
+		sample:  cfg.Sample,
+		types:   make(map[string]bool),
+		clock:   c,
+		buckets: make(map[dialogEventKey]*dialogEventBucket),
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	for _, t := range cfg.Types {
+		l.types[t] = true
+	}
+	return l
+}
+
+// refill adds the tokens accrued by the bucket since it was last used
+func (l *dialogEventLimiter) refill(b *dialogEventBucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+}
+
+// allow indicates whether an event of the given type may be published to the
+// given dialog, counting it as dropped if not
+func (l *dialogEventLimiter) allow(dialog, typ string) bool {
+	if l == nil || !l.types[typ] {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	k := dialogEventKey{dialog, typ}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &dialogEventBucket{tokens: l.burst, last: now}
+		l.buckets[k] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.over = 0
+		return true
+	}
+
+	b.over++
+	if l.sample > 0 && b.over%l.sample == 0 {
+		return true
+	}
+	b.dropped++
+	return false
+}
+
+// flush returns the numbers of events dropped since the last flush, by dialog
+// and type, and forgets the buckets which are full again
+func (l *dialogEventLimiter) flush() map[string]map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	ret := make(map[string]map[string]uint64)
+	for k, b := range l.buckets {
+		if b.dropped > 0 {
+			if ret[k.dialog] == nil {
+				ret[k.dialog] = make(map[string]uint64)
+			}
+			ret[k.dialog][k.typ] = b.dropped
+			b.dropped = 0
+			continue
+		}
+
+		// A full bucket is equivalent to a new one
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+	return ret
+}
+
+// runDialogEventSummaries periodically reports the events dropped by the
+// dialog event limit to their dialogs
+func (s *Server) runDialogEventSummaries(ctx context.Context) {
+	interval := s.DialogEventLimit.SummaryInterval
+	if interval <= 0 {
+		interval = DefaultDialogEventSummaryInterval
+	}
+	ticker := s.clock().NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		s.publishDialogEventSummaries()
+	}
+}
+
+// publishDialogEventSummaries publishes a DialogEventsDropped event to each
+// dialog of which events were dropped since the last summary
+func (s *Server) publishDialogEventSummaries() {
+	dropped := s.dialogEventLimiter.flush()
+
+	dialogs := make([]string, 0, len(dropped))
+	for d := range dropped {
+		dialogs = append(dialogs, d)
+	}
+	sort.Strings(dialogs)
+
+	for _, d := range dialogs {
+		e := &proxy.DialogEventsDropped{
+			EventData: s.newEventData(proxy.EventDialogEventsDropped),
+			Dropped:   dropped[d],
+		}
+		e.SetDialog(d)
+
+		h := s.newEventHeader(e)
+		h.Set(proxy.HeaderDialog, d)
+		s.metrics.eventPublished(e.GetType())
+		s.publishEventTo(s.Subjects.DialogEvent(d), e, h)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+)
+
+func TestDialogEventLimiter(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	l := newDialogEventLimiter(&DialogEventLimitConfig{
+		Types: []string{"ChannelVarset"},
+		Rate:  2,
+		Burst: 2,
+	}, c)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if l.allow("d1", "ChannelVarset") {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("allowed %d events of the burst, want 2", allowed)
+	}
+
+	// Other types and dialogs are not affected
+	if !l.allow("d1", "ChannelDtmfReceived") || !l.allow("d2", "ChannelVarset") {
+		t.Error("unrelated event dropped")
+	}
+
+	// The rate refills the bucket
+	c.Advance(500 * time.Millisecond)
+	if !l.allow("d1", "ChannelVarset") || l.allow("d1", "ChannelVarset") {
+		t.Error("bucket not refilled at the configured rate")
+	}
+
+	dropped := l.flush()
+	if len(dropped) != 1 || dropped["d1"]["ChannelVarset"] != 9 {
+		t.Errorf("unexpected dropped counts %v", dropped)
+	}
+
+	// Counts are reset by the flush, and full buckets forgotten
+	c.Advance(time.Minute)
+	if dropped = l.flush(); len(dropped) != 0 {
+		t.Errorf("unexpected dropped counts %v after flush", dropped)
+	}
+	if len(l.buckets) != 0 {
+		t.Errorf("%d idle buckets kept", len(l.buckets))
+	}
+}
+
+func TestDialogEventLimiterSample(t *testing.T) {
+	l := newDialogEventLimiter(&DialogEventLimitConfig{
+		Types:  []string{"ChannelVarset"},
+		Rate:   1,
+		Sample: 3,
+	}, clock.NewFake(time.Unix(0, 0)))
+
+	var allowed []int
+	for i := 0; i < 8; i++ {
+		if l.allow("d1", "ChannelVarset") {
+			allowed = append(allowed, i)
+		}
+	}
+	if len(allowed) != 3 || allowed[0] != 0 || allowed[1] != 3 || allowed[2] != 6 {
+		t.Errorf("unexpected sampled events %v", allowed)
+	}
+	if n := l.flush()["d1"]["ChannelVarset"]; n != 5 {
+		t.Errorf("%d events dropped, want 5", n)
+	}
+}
+
+func TestDialogEventLimiterDisabled(t *testing.T) {
+	var l *dialogEventLimiter
+	if !l.allow("d1", "ChannelVarset") {
+		t.Error("event dropped without a limit")
+	}
+}
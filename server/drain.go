@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultDrainTimeout is the default time for which a stopping server waits
+// for the requests being handled to complete
+const DefaultDrainTimeout = 5 * time.Second
+
+// requestTracker tracks the requests being handled by a server, so that it
+// can wait for them when it stops
+type requestTracker struct {
+	n      int
+	closed bool
+
+	// idle is closed once the tracker is closed and no request remains
+	idle chan struct{}
+
+	mu sync.Mutex
+}
+
+// reset accepts requests again, when the server starts listening
+func (t *requestTracker) reset() {
+	t.mu.Lock()
+	t.closed = false
+	t.mu.Unlock()
+}
+
+// begin records the start of the handling of a request, returning false if
+// the tracker is closed, in which case the request must be refused
+func (t *requestTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.n++
+	return true
+}
+
+// end records the completion of the handling of a request
+func (t *requestTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	if t.n == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// close refuses new requests, returning a channel which is closed once the
+// requests being handled have completed
+func (t *requestTracker) close() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	ch := make(chan struct{})
+	if t.n == 0 {
+		close(ch)
+	} else {
+		t.idle = ch
+	}
+	return ch
+}
+
+// leaving indicates whether the server is stopping, and so refuses new
+// requests
+func (s *Server) leaving() bool {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return s.requests.closed
+}
+
+// drain stops the server from accepting new requests, announces that it is
+// leaving the cluster, so that clients route their requests to other nodes at
+// once, and waits for at most the drain timeout for the requests being
+// handled to complete, before cancelling those which have not
+func (s *Server) drain(cancelRequests context.CancelFunc) {
+	defer cancelRequests()
+
+	idle := s.requests.close()
+	s.announce()
+	if s.systemd != nil {
+		s.notifySystemd("STOPPING=1\nSTATUS=" + s.systemdStatus())
+	}
+
+	timeout := s.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	s.Log.Info("draining requests", "timeout", timeout)
+	select {
+	case <-idle:
+		s.Log.Debug("requests drained")
+	case <-time.After(timeout):
+		s.Log.Warn("timeout waiting for requests to complete; cancelling them", "timeout", timeout)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/nats-io/nats.go"
+)
+
+func TestRequestTracker(t *testing.T) {
+	var tr requestTracker
+	if !tr.begin() || !tr.begin() {
+		t.Fatal("requests refused before close")
+	}
+
+	idle := tr.close()
+	if tr.begin() {
+		t.Error("request accepted after close")
+	}
+	tr.end()
+	select {
+	case <-idle:
+		t.Fatal("idle with a request in flight")
+	default:
+	}
+	tr.end()
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("not idle once the requests completed")
+	}
+
+	tr.reset()
+	if !tr.begin() {
+		t.Error("request refused after reset")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	s := New(WithDrainTimeout(50 * time.Millisecond))
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+
+	// A request which completes within the drain timeout is not cancelled
+	s.requests.begin()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Error("request cancelled before the drain timeout")
+		}
+		s.requests.end()
+	}()
+	s.drain(cancel)
+	if !s.leaving() || !s.newAnnouncement().Leaving {
+		t.Error("server not leaving")
+	}
+
+	// A request which does not is cancelled
+	s.requests.reset()
+	s.requests.begin()
+	ctx, cancel = context.WithCancel(context.Background())
+	start := time.Now()
+	s.drain(cancel)
+	if ctx.Err() == nil {
+		t.Error("request not cancelled")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("drain returned after %s", d)
+	}
+}
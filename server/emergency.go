@@ -0,0 +1,61 @@
+package server
+
+import (
+	"regexp"
+
+	"github.com/rotisserie/eris"
+)
+
+// emergencyMatcher identifies safety-critical destinations which must never be
+// blocked by proxy policies (quotas, rate limits, draining).
+type emergencyMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+func newEmergencyMatcher(patterns []string) (*emergencyMatcher, error) {
+	m := new(emergencyMatcher)
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid emergency destination pattern %q", p)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+
+	return m, nil
+}
+
+// Match indicates whether any of the given destinations matches an emergency
+// pattern.  Endpoints (tech/resource) are reduced to their dialed number
+// before matching.
+func (m *emergencyMatcher) Match(destinations ...string) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, d := range destinations {
+		if d == "" {
+			continue
+		}
+		n := endpointNumber(d)
+		for _, re := range m.patterns {
+			if re.MatchString(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emergencyBypass checks whether the destination is an emergency destination
+// and, if so, records an audit log entry noting that the named policy was
+// bypassed.
+func (s *Server) emergencyBypass(policy string, tenant string, destinations ...string) bool {
+	if !s.emergency.Match(destinations...) {
+		return false
+	}
+
+	s.Log.Warn("AUDIT: emergency destination bypassed proxy policy", "policy", policy, "tenant", tenant, "destinations", destinations)
+	return true
+}
@@ -0,0 +1,29 @@
+package server
+
+import "testing"
+
+func TestEmergencyMatch(t *testing.T) {
+	m, err := newEmergencyMatcher([]string{"^911$", "^112$"})
+	if err != nil {
+		t.Fatalf("failed to create matcher: %s", err)
+	}
+
+	if !m.Match("PJSIP/911@trunk") {
+		t.Error("failed to match emergency endpoint")
+	}
+	if !m.Match("PJSIP/operator", "112") {
+		t.Error("failed to match emergency extension")
+	}
+	if m.Match("PJSIP/9115551212@trunk") {
+		t.Error("matched non-emergency endpoint")
+	}
+
+	var nilMatcher *emergencyMatcher
+	if nilMatcher.Match("911") {
+		t.Error("nil matcher should never match")
+	}
+
+	if _, err := newEmergencyMatcher([]string{"("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
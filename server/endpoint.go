@@ -39,9 +39,7 @@ func (s *Server) endpointList(ctx context.Context, reply string, req *proxy.Requ
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) endpointListByTech(ctx context.Context, reply string, req *proxy.Request) {
@@ -51,7 +49,5 @@ func (s *Server) endpointListByTech(ctx context.Context, reply string, req *prox
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
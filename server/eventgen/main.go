@@ -0,0 +1,113 @@
+// Command eventgen generates the table of the entities referenced by each
+// event of the ARI events specification (events.json, as published by
+// Asterisk), against which the routing of events to dialogs is tested
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// entityKinds maps the entity model types of the specification to the key
+// kinds of the ari package
+var entityKinds = map[string]string{
+	"Bridge":        "ari.BridgeKey",
+	"Channel":       "ari.ChannelKey",
+	"DeviceState":   "ari.DeviceStateKey",
+	"Endpoint":      "ari.EndpointKey",
+	"LiveRecording": "ari.LiveRecordingKey",
+	"Playback":      "ari.PlaybackKey",
+}
+
+type spec struct {
+	Models map[string]model `json:"models"`
+}
+
+type model struct {
+	SubTypes   []string            `json:"subTypes"`
+	Properties map[string]property `json:"properties"`
+}
+
+type property struct {
+	Type string `json:"type"`
+}
+
+func main() {
+	in := flag.String("spec", "eventgen/events.json", "ARI events specification")
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+
+	if err := run(*in, *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string) error {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to parse specification: %v", err)
+	}
+
+	events, ok := s.Models["Event"]
+	if !ok {
+		return fmt.Errorf("no Event model in specification")
+	}
+	types := append([]string(nil), events.SubTypes...)
+	sort.Strings(types)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by eventgen from the ARI events specification. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package server\n\n")
+	fmt.Fprintf(buf, "import \"github.com/CyCoreSystems/ari/v5\"\n\n")
+	fmt.Fprintf(buf, "// specEventEntities lists, for each event type of the ARI specification, the\n")
+	fmt.Fprintf(buf, "// properties of the event which reference entities, with the kind of each\n")
+	fmt.Fprintf(buf, "var specEventEntities = map[string][]specEntity{\n")
+	for _, typ := range types {
+		m, ok := s.Models[typ]
+		if !ok {
+			return fmt.Errorf("event %s has no model", typ)
+		}
+
+		var props []string
+		for name, p := range m.Properties {
+			if _, ok := entityKinds[p.Type]; ok {
+				props = append(props, name)
+			}
+		}
+		sort.Strings(props)
+
+		if len(props) == 0 {
+			fmt.Fprintf(buf, "%q: nil,\n", typ)
+			continue
+		}
+		fmt.Fprintf(buf, "%q: {\n", typ)
+		for _, name := range props {
+			fmt.Fprintf(buf, "{%q, %s},\n", name, entityKinds[m.Properties[name].Type])
+		}
+		fmt.Fprintf(buf, "},\n")
+	}
+	fmt.Fprintf(buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated code: %v", err)
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
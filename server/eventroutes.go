@@ -0,0 +1,166 @@
+package server
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// EventRoute publishes the events of the given types to an additional NATS
+// subject, so that specialized consumers (e.g. of DTMF) need not filter the
+// full event stream of the application.
+//
+// The subject may be a template, containing the placeholders:
+//
+//	{app}       the name of the ARI application
+//	{node}      the Asterisk ID of the node
+//	{instance}  the instance ID of the server
+//	{type}      the type of the event
+//
+// For example, "dtmf.{app}".  The subject is not prefixed with the NATS
+// prefix of the server.
+type EventRoute struct {
+	// Types is the list of event types (e.g. "ChannelDtmfReceived") which are
+	// published to the subject
+	Types []string `mapstructure:"types"`
+
+	// Subject is the template of the subject to which the events are published
+	Subject string `mapstructure:"subject"`
+
+	// Exclusive indicates that the events are published to the subject
+	// instead of the event subject of the application.  Events are still
+	// published to their dialogs.
+	Exclusive bool `mapstructure:"exclusive"`
+}
+
+var eventRoutePlaceholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// expandEventSubject expands the placeholders of the given subject template
+func expandEventSubject(tmpl, app, node, instance, typ string) (string, error) {
+	var err error
+	subject := eventRoutePlaceholderRegex.ReplaceAllStringFunc(tmpl, func(p string) string {
+		switch p {
+		case "{app}":
+			return app
+		case "{node}":
+			return node
+		case "{instance}":
+			return instance
+		case "{type}":
+			return typ
+		}
+		if err == nil {
+			err = eris.Errorf("unknown event subject placeholder %s", p)
+		}
+		return p
+	})
+	if err != nil {
+		return "", err
+	}
+	if !validPublishSubject(subject) {
+		return "", eris.Errorf("invalid event subject %q", subject)
+	}
+	return subject, nil
+}
+
+// validPublishSubject indicates whether the given subject may be published
+// to: it must have no empty tokens, whitespace or wildcards
+func validPublishSubject(subject string) bool {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return false
+	}
+	for _, tok := range strings.Split(subject, ".") {
+		if tok == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// eventRouter holds the routes of each event type
+type eventRouter map[string][]EventRoute
+
+// newEventRouter validates the given routes and indexes them by event type.
+// It returns nil if there are no routes.
+func newEventRouter(routes []EventRoute) (eventRouter, error) {
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	r := make(eventRouter)
+	for i, route := range routes {
+		if len(route.Types) == 0 {
+			return nil, eris.Errorf("event route %d has no event types", i)
+		}
+		for _, typ := range route.Types {
+			if typ == "" {
+				return nil, eris.Errorf("event route %d has an empty event type", i)
+			}
+			if _, err := expandEventSubject(route.Subject, "app", "node", "instance", typ); err != nil {
+				return nil, eris.Wrapf(err, "invalid subject of event route %d", i)
+			}
+			r[typ] = append(r[typ], route)
+		}
+	}
+	return r, nil
+}
+
+// eventSubjects returns the subjects of the routes of the given event type
+func (s *Server) eventSubjects(typ string) (subjects []string, exclusive bool) {
+	for _, route := range s.eventRoutes[typ] {
+		subject, err := expandEventSubject(route.Subject, s.Application, s.nodeID(), s.InstanceID, typ)
+		if err != nil {
+			s.Log.Warn("failed to expand event subject", "subject", route.Subject, "event", typ, "error", err)
+			continue
+		}
+		subjects = append(subjects, subject)
+		exclusive = exclusive || route.Exclusive
+	}
+	return subjects, exclusive
+}
+
+// nodeEventSubject returns the subject of the events of the given type of the
+// node, which is per-type if EventTypeSubjects is set
+func (s *Server) nodeEventSubject(typ string) string {
+	if b, ok := s.Subjects.(proxy.TypedEventSubjectBuilder); ok && s.EventTypeSubjects {
+		return b.TypedEvent(s.Application, s.nodeID(), typ)
+	}
+	return s.Subjects.Event(s.Application, s.nodeID())
+}
+
+// publishEventRoutes publishes an event to the subjects of its routes,
+// returning whether it may only be published to them, rather than to the
+// event subject of the application
+func (s *Server) publishEventRoutes(e ari.Event, h ari.Header) (exclusive bool) {
+	subjects, exclusive := s.eventSubjects(e.GetType())
+	for _, subject := range subjects {
+		s.publishEventTo(subject, e, h)
+	}
+	return exclusive
+}
+
+// routedEventSubjects returns the subjects of all the event routes, for the
+// permission check
+func (s *Server) routedEventSubjects() (ret []requiredSubject) {
+	types := make([]string, 0, len(s.eventRoutes))
+	for typ := range s.eventRoutes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	seen := make(map[string]bool)
+	for _, typ := range types {
+		subjects, _ := s.eventSubjects(typ)
+		for _, subject := range subjects {
+			if !seen[subject] {
+				seen[subject] = true
+				ret = append(ret, requiredSubject{Name: "routed " + typ + " events", Subject: subject, Publish: true})
+			}
+		}
+	}
+	return ret
+}
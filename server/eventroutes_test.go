@@ -0,0 +1,76 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestExpandEventSubject(t *testing.T) {
+	for tmpl, want := range map[string]string{
+		"dtmf.{app}":                  "dtmf.myapp",
+		"events.{node}.{type}":        "events.00:11.ChannelDtmfReceived",
+		"{instance}.{app}.{type}.all": "in1.myapp.ChannelDtmfReceived.all",
+		"dtmf.{application}":          "",
+		"dtmf.*":                      "",
+		"dtmf..{app}":                 "",
+		"":                            "",
+	} {
+		got, err := expandEventSubject(tmpl, "myapp", "00:11", "in1", "ChannelDtmfReceived")
+		if want == "" {
+			if err == nil {
+				t.Errorf("%q: expected error, got %q", tmpl, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("%q: got %q (%v), want %q", tmpl, got, err, want)
+		}
+	}
+}
+
+func TestEventRouter(t *testing.T) {
+	if r, err := newEventRouter(nil); r != nil || err != nil {
+		t.Errorf("unexpected router %v (%v) without routes", r, err)
+	}
+	if _, err := newEventRouter([]EventRoute{{Subject: "dtmf"}}); err == nil {
+		t.Error("expected error for route without types")
+	}
+
+	r, err := newEventRouter([]EventRoute{
+		{Types: []string{"ChannelDtmfReceived"}, Subject: "dtmf.{app}"},
+		{Types: []string{"ChannelDtmfReceived", "ChannelHangupRequest"}, Subject: "audit.{type}", Exclusive: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Application: "myapp", eventRoutes: r}
+
+	subjects, exclusive := s.eventSubjects("ChannelDtmfReceived")
+	if len(subjects) != 2 || subjects[0] != "dtmf.myapp" || subjects[1] != "audit.ChannelDtmfReceived" || !exclusive {
+		t.Errorf("unexpected DTMF routes %v (exclusive %v)", subjects, exclusive)
+	}
+	if subjects, exclusive := s.eventSubjects("StasisStart"); len(subjects) != 0 || exclusive {
+		t.Errorf("unexpected StasisStart routes %v (exclusive %v)", subjects, exclusive)
+	}
+
+	required := s.routedEventSubjects()
+	if len(required) != 3 {
+		t.Errorf("unexpected required subjects %v", required)
+	}
+}
+
+func TestNodeEventSubject(t *testing.T) {
+	s := &Server{Application: "app", AsteriskID: "node", Subjects: proxy.NewSubjectBuilder("ari.")}
+	if got := s.nodeEventSubject("StasisStart"); got != "ari.event.app.node" {
+		t.Errorf("unexpected subject %q", got)
+	}
+
+	s.EventTypeSubjects = true
+	if got := s.nodeEventSubject("StasisStart"); got != "ari.event.app.node.StasisStart" {
+		t.Errorf("unexpected per-type subject %q", got)
+	}
+	if !s.newAnnouncement().HasFeature(proxy.FeatureEventTypeSubjects) {
+		t.Error("per-type event subjects should be announced")
+	}
+}
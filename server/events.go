@@ -1,14 +1,104 @@
 package server
 
-import "github.com/CyCoreSystems/ari/v5"
+//go:generate go run ./eventgen -o events_spec_gen_test.go
 
+import (
+	"reflect"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// dialogsForEvent returns the dialogs bound to any of the entities of the
+// given event, each listed once
 func (s *Server) dialogsForEvent(e ari.Event) (ret []string) {
-	for _, k := range e.Keys() {
+	for _, k := range eventEntities(e) {
 		if k == nil {
 			s.Log.Warn("received nil key for event", "event", e)
 			continue
 		}
-		ret = append(ret, s.Dialog.List(k.Kind, k.ID)...)
+		if k.ID == "" {
+			continue
+		}
+		for _, d := range s.Dialog.List(k.Kind, k.ID) {
+			if !containsDialog(ret, d) {
+				ret = append(ret, d)
+			}
+		}
 	}
 	return
 }
+
+// eventEntities returns the keys of the entities of the given event.  In
+// addition to the keys of the event itself, the channel or bridge on which a
+// playback or recording takes place is included, so that the dialogs of a
+// call see the media operations of the call.
+func eventEntities(e ari.Event) ari.Keys {
+	keys := e.Keys()
+
+	var target string
+	switch v := e.(type) {
+	case *ari.PlaybackStarted:
+		target = v.Playback.TargetURI
+	case *ari.PlaybackContinuing:
+		target = v.Playback.TargetURI
+	case *ari.PlaybackFinished:
+		target = v.Playback.TargetURI
+	case *ari.RecordingStarted:
+		target = v.Recording.TargetURI
+	case *ari.RecordingFinished:
+		target = v.Recording.TargetURI
+	case *ari.RecordingFailed:
+		target = v.Recording.TargetURI
+	}
+	if target != "" {
+		if k := proxy.TargetKey(ari.EventData{}, target); k != nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// containsDialog indicates whether the list contains the given dialog.  Events
+// concern few entities, which are bound to few dialogs, so a linear search is
+// cheaper than a set.
+func containsDialog(list []string, dialog string) bool {
+	for _, d := range list {
+		if d == dialog {
+			return true
+		}
+	}
+	return false
+}
+
+// dialogEvent returns the copy of the given event, and of its header, which is
+// published to the given dialog.  The event itself is left unmodified, as it
+// is shared by the canonical publication, the other dialogs (which may be
+// published to concurrently), and the event processors.
+func dialogEvent(e ari.Event, h ari.Header, dialog string) (ari.Event, ari.Header, bool) {
+	de, ok := cloneEvent(e)
+	if !ok {
+		return nil, nil, false
+	}
+	de.SetDialog(dialog)
+
+	dh := make(ari.Header, len(h)+1)
+	for k, v := range h {
+		dh[k] = v
+	}
+	dh.Set(proxy.HeaderDialog, dialog)
+
+	return de, dh, true
+}
+
+// cloneEvent returns a shallow copy of the given event.  Both ARI events and
+// proxy events are pointers to structs, of which the dialog is a plain field.
+func cloneEvent(e ari.Event) (ari.Event, bool) {
+	v := reflect.ValueOf(e)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(ari.Event), true
+}
@@ -0,0 +1,140 @@
+// Code generated by eventgen from the ARI events specification. DO NOT EDIT.
+
+package server
+
+import "github.com/CyCoreSystems/ari/v5"
+
+// specEventEntities lists, for each event type of the ARI specification, the
+// properties of the event which reference entities, with the kind of each
+var specEventEntities = map[string][]specEntity{
+	"ApplicationReplaced": nil,
+	"BridgeAttendedTransfer": {
+		{"destination_link_first_leg", ari.ChannelKey},
+		{"destination_link_second_leg", ari.ChannelKey},
+		{"destination_threeway_bridge", ari.BridgeKey},
+		{"destination_threeway_channel", ari.ChannelKey},
+		{"replace_channel", ari.ChannelKey},
+		{"transfer_target", ari.ChannelKey},
+		{"transferee", ari.ChannelKey},
+		{"transferer_first_leg", ari.ChannelKey},
+		{"transferer_first_leg_bridge", ari.BridgeKey},
+		{"transferer_second_leg", ari.ChannelKey},
+		{"transferer_second_leg_bridge", ari.BridgeKey},
+	},
+	"BridgeBlindTransfer": {
+		{"bridge", ari.BridgeKey},
+		{"channel", ari.ChannelKey},
+		{"replace_channel", ari.ChannelKey},
+		{"transferee", ari.ChannelKey},
+	},
+	"BridgeCreated": {
+		{"bridge", ari.BridgeKey},
+	},
+	"BridgeDestroyed": {
+		{"bridge", ari.BridgeKey},
+	},
+	"BridgeMerged": {
+		{"bridge", ari.BridgeKey},
+		{"bridge_from", ari.BridgeKey},
+	},
+	"BridgeVideoSourceChanged": {
+		{"bridge", ari.BridgeKey},
+	},
+	"ChannelCallerId": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelConnectedLine": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelCreated": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelDestroyed": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelDialplan": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelDtmfReceived": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelEnteredBridge": {
+		{"bridge", ari.BridgeKey},
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelHangupRequest": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelHold": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelLeftBridge": {
+		{"bridge", ari.BridgeKey},
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelStateChange": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelTalkingFinished": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelTalkingStarted": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelUnhold": {
+		{"channel", ari.ChannelKey},
+	},
+	"ChannelUserevent": {
+		{"bridge", ari.BridgeKey},
+		{"channel", ari.ChannelKey},
+		{"endpoint", ari.EndpointKey},
+	},
+	"ChannelVarset": {
+		{"channel", ari.ChannelKey},
+	},
+	"ContactStatusChange": {
+		{"endpoint", ari.EndpointKey},
+	},
+	"DeviceStateChanged": {
+		{"device_state", ari.DeviceStateKey},
+	},
+	"Dial": {
+		{"caller", ari.ChannelKey},
+		{"forwarded", ari.ChannelKey},
+		{"peer", ari.ChannelKey},
+	},
+	"EndpointStateChange": {
+		{"endpoint", ari.EndpointKey},
+	},
+	"PeerStatusChange": {
+		{"endpoint", ari.EndpointKey},
+	},
+	"PlaybackContinuing": {
+		{"playback", ari.PlaybackKey},
+	},
+	"PlaybackFinished": {
+		{"playback", ari.PlaybackKey},
+	},
+	"PlaybackStarted": {
+		{"playback", ari.PlaybackKey},
+	},
+	"RecordingFailed": {
+		{"recording", ari.LiveRecordingKey},
+	},
+	"RecordingFinished": {
+		{"recording", ari.LiveRecordingKey},
+	},
+	"RecordingStarted": {
+		{"recording", ari.LiveRecordingKey},
+	},
+	"StasisEnd": {
+		{"channel", ari.ChannelKey},
+	},
+	"StasisStart": {
+		{"channel", ari.ChannelKey},
+		{"replace_channel", ari.ChannelKey},
+	},
+	"TextMessageReceived": {
+		{"endpoint", ari.EndpointKey},
+	},
+}
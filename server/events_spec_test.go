@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// specEntity is a property of an event which references an entity of the
+// given kind
+type specEntity struct {
+	property string
+	kind     string
+}
+
+// specEntityData returns the JSON of an entity of the given kind with the
+// given ID, along with the keys by which it must be routed to dialogs
+func specEntityData(kind, id string) (map[string]interface{}, []*ari.Key) {
+	switch kind {
+	case ari.EndpointKey:
+		return map[string]interface{}{"technology": "PJSIP", "resource": id},
+			[]*ari.Key{ari.NewKey(kind, "PJSIP/"+id)}
+	case ari.DeviceStateKey:
+		return map[string]interface{}{"name": id},
+			[]*ari.Key{ari.NewKey(kind, id)}
+	case ari.LiveRecordingKey:
+		return map[string]interface{}{"name": id, "target_uri": "bridge:target-" + id},
+			[]*ari.Key{ari.NewKey(kind, id), ari.NewKey(ari.BridgeKey, "target-"+id)}
+	case ari.PlaybackKey:
+		return map[string]interface{}{"id": id, "target_uri": "channel:target-" + id},
+			[]*ari.Key{ari.NewKey(kind, id), ari.NewKey(ari.ChannelKey, "target-"+id)}
+	default:
+		return map[string]interface{}{"id": id},
+			[]*ari.Key{ari.NewKey(kind, id)}
+	}
+}
+
+// TestEventEntitiesCoverage verifies that every entity referenced by each
+// event of the ARI specification is among the entities by which the event is
+// routed to dialogs.  The table of referenced entities is generated from the
+// specification; run `go generate ./server` to update it.
+func TestEventEntitiesCoverage(t *testing.T) {
+	for typ, props := range specEventEntities {
+		raw := map[string]interface{}{"type": typ}
+		var expected []*ari.Key
+		for _, p := range props {
+			data, keys := specEntityData(p.kind, typ+"-"+p.property)
+			raw[p.property] = data
+			expected = append(expected, keys...)
+		}
+
+		data, err := json.Marshal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := ari.DecodeEvent(data)
+		if err != nil {
+			t.Errorf("%s: failed to decode event: %v", typ, err)
+			continue
+		}
+
+		entities := eventEntities(e)
+		for _, k := range expected {
+			if !containsEntity(entities, k) {
+				t.Errorf("%s: entity %s %s is not routed to dialogs", typ, k.Kind, k.ID)
+			}
+		}
+	}
+}
+
+// TestEventTypesInSpec verifies that every event type known to the ari
+// package is either covered by the specification table or known to reference
+// its entities otherwise
+func TestEventTypesInSpec(t *testing.T) {
+	// Event types which are missing from the specification of the table,
+	// with the entities they reference
+	others := map[string][]specEntity{
+		"ApplicationMoveFailed": {{"channel", ari.ChannelKey}},
+		"ContactInfo":           nil,
+		"MissingParams":         nil,
+		"Peer":                  nil,
+	}
+
+	v := reflect.ValueOf(ari.Events)
+	for i := 0; i < v.NumField(); i++ {
+		typ := v.Field(i).String()
+		if typ == ari.Events.All {
+			continue
+		}
+		if _, ok := specEventEntities[typ]; ok {
+			continue
+		}
+		props, ok := others[typ]
+		if !ok {
+			t.Errorf("event type %s is not covered", typ)
+			continue
+		}
+		for _, p := range props {
+			data, err := json.Marshal(map[string]interface{}{
+				"type":     typ,
+				p.property: map[string]interface{}{"id": "x"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := ari.DecodeEvent(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !containsEntity(eventEntities(e), ari.NewKey(p.kind, "x")) {
+				t.Errorf("%s: entity %s is not routed to dialogs", typ, p.property)
+			}
+		}
+	}
+}
+
+func containsEntity(keys ari.Keys, k *ari.Key) bool {
+	for _, x := range keys {
+		if x != nil && x.Kind == k.Kind && x.ID == k.ID {
+			return true
+		}
+	}
+	return false
+}
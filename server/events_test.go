@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+func TestDialogsForEvent(t *testing.T) {
+	s := &Server{
+		Dialog: dialog.NewMemManager(),
+		Log:    log15.New(),
+	}
+	s.Log.SetHandler(log15.DiscardHandler())
+
+	s.Dialog.Bind("d1", ari.ChannelKey, "c1")
+	s.Dialog.Bind("d1", ari.BridgeKey, "b1")
+	s.Dialog.Bind("d2", ari.BridgeKey, "b1")
+	s.Dialog.Bind("d3", ari.PlaybackKey, "p1")
+
+	tests := []struct {
+		name     string
+		event    ari.Event
+		expected []string
+	}{
+		{
+			"channel entered bridge",
+			&ari.ChannelEnteredBridge{
+				Channel: ari.ChannelData{ID: "c1"},
+				Bridge:  ari.BridgeData{ID: "b1", ChannelIDs: []string{"c1", "c2"}},
+			},
+			[]string{"d1", "d2"},
+		},
+		{
+			"playback on channel",
+			&ari.PlaybackStarted{
+				Playback: ari.PlaybackData{ID: "p1", TargetURI: "channel:c1"},
+			},
+			[]string{"d3", "d1"},
+		},
+		{
+			"recording on bridge",
+			&ari.RecordingFinished{
+				Recording: ari.LiveRecordingData{Name: "r1", TargetURI: "bridge:b1"},
+			},
+			[]string{"d1", "d2"},
+		},
+		{
+			"user event without bridge",
+			&ari.ChannelUserevent{
+				Channel: ari.ChannelData{ID: "c1"},
+			},
+			[]string{"d1"},
+		},
+		{
+			"unbound channel",
+			&ari.ChannelStateChange{
+				Channel: ari.ChannelData{ID: "c2"},
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		if dialogs := s.dialogsForEvent(tt.event); !reflect.DeepEqual(dialogs, tt.expected) {
+			t.Errorf("%s: dialogs %v != %v", tt.name, dialogs, tt.expected)
+		}
+	}
+}
+
+func BenchmarkDialogsForEvent(b *testing.B) {
+	s := &Server{
+		Dialog: dialog.NewMemManager(),
+		Log:    log15.New(),
+	}
+	s.Log.SetHandler(log15.DiscardHandler())
+
+	for i := 0; i < 10000; i++ {
+		id := strconv.Itoa(i)
+		s.Dialog.Bind("dialog"+id, ari.ChannelKey, id)
+		s.Dialog.Bind("dialog"+id, ari.BridgeKey, "bridge"+id)
+	}
+
+	events := []ari.Event{
+		&ari.ChannelStateChange{Channel: ari.ChannelData{ID: "5000"}},
+		&ari.ChannelEnteredBridge{
+			Channel: ari.ChannelData{ID: "5000"},
+			Bridge:  ari.BridgeData{ID: "bridge5000", ChannelIDs: []string{"5000", "5001"}},
+		},
+		&ari.PlaybackFinished{Playback: ari.PlaybackData{ID: "p", TargetURI: "channel:5000"}},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(s.dialogsForEvent(events[i%len(events)])) == 0 {
+			b.Fatal("no dialogs")
+		}
+	}
+}
+
+func TestDialogEvent(t *testing.T) {
+	e := &ari.ChannelDtmfReceived{
+		EventData: ari.EventData{Type: "ChannelDtmfReceived", Application: "app"},
+		Channel:   ari.ChannelData{ID: "c1"},
+		Digit:     "5",
+	}
+	h := ari.Header{}
+	h.Set(proxy.HeaderApplication, "app")
+
+	// Dialogs are published to concurrently with the processing of the event
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		d := "d" + strconv.Itoa(i)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			de, dh, ok := dialogEvent(e, h, d)
+			if !ok {
+				t.Error("failed to copy event")
+				return
+			}
+			if de.GetDialog() != d || proxy.EventHeader(dh).Dialog() != d {
+				t.Errorf("dialog %q (header %q) != %q", de.GetDialog(), proxy.EventHeader(dh).Dialog(), d)
+			}
+			if v := de.(*ari.ChannelDtmfReceived); v.Digit != "5" || v.Channel.ID != "c1" {
+				t.Errorf("event not copied: %+v", v)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := json.Marshal(e); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if e.GetDialog() != "" {
+		t.Errorf("original event modified: dialog %q", e.GetDialog())
+	}
+	if len(h) != 1 {
+		t.Errorf("original header modified: %v", h)
+	}
+}
+
+func TestCloneEventProxy(t *testing.T) {
+	e := &proxy.HoldStateChanged{ChannelID: "c1"}
+	c, ok := cloneEvent(e)
+	if !ok {
+		t.Fatal("failed to copy proxy event")
+	}
+	c.SetDialog("d1")
+	if e.GetDialog() != "" || c.(*proxy.HoldStateChanged).ChannelID != "c1" {
+		t.Errorf("unexpected copy %+v of %+v", c, e)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// EventStreamConfig describes the storage of the events of the application in
+// a JetStream stream, from which clients which restart may replay the events
+// they missed (see client.Client.SubscribeStream).  Events are still
+// published to their subjects, which the stream captures; the server requests
+// the acknowledgment of each event by the stream, logging the events which
+// could not be stored.
+type EventStreamConfig struct {
+	// Stream is the name of the stream
+	Stream string `mapstructure:"stream"`
+
+	// Create indicates that the server creates the stream if it does not
+	// exist, with the following settings.  Otherwise, the stream must
+	// already exist and capture the event subjects.
+	Create bool `mapstructure:"create"`
+
+	// Subjects is the list of subjects captured by a created stream.  It
+	// defaults to the event subjects of all applications (e.g.
+	// "ari.event.>").
+	Subjects []string `mapstructure:"subjects"`
+
+	// MaxAge is the maximum age of the events retained by a created stream.
+	// Zero means unlimited.
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	// MaxMsgs is the maximum number of events retained by a created stream.
+	// Zero means unlimited.
+	MaxMsgs int64 `mapstructure:"max_msgs"`
+
+	// MaxBytes is the maximum size of the events retained by a created
+	// stream.  Zero means unlimited.
+	MaxBytes int64 `mapstructure:"max_bytes"`
+
+	// Storage is the storage of a created stream: "file" (the default) or
+	// "memory"
+	Storage string `mapstructure:"storage"`
+
+	// Replicas is the number of replicas of a created stream.  It defaults
+	// to 1.
+	Replicas int `mapstructure:"replicas"`
+
+	// APIPrefix is the prefix of the subjects of the JetStream API.  It
+	// defaults to DefaultJetStreamAPIPrefix.
+	APIPrefix string `mapstructure:"api_prefix"`
+}
+
+func (cfg EventStreamConfig) validate() error {
+	if cfg.Stream == "" {
+		return eris.New("no event stream")
+	}
+	if cfg.Storage != "" && cfg.Storage != "file" && cfg.Storage != "memory" {
+		return eris.Errorf("invalid event stream storage %q", cfg.Storage)
+	}
+	if cfg.MaxAge < 0 || cfg.MaxMsgs < 0 || cfg.MaxBytes < 0 {
+		return eris.New("event stream limits may not be negative")
+	}
+	if cfg.Replicas < 0 {
+		return eris.New("event stream replicas may not be negative")
+	}
+	for _, subject := range cfg.Subjects {
+		if subject == "" {
+			return eris.New("empty event stream subject")
+		}
+	}
+	return nil
+}
+
+func (cfg EventStreamConfig) withDefaults() EventStreamConfig {
+	if cfg.Storage == "" {
+		cfg.Storage = "file"
+	}
+	if cfg.Replicas == 0 {
+		cfg.Replicas = 1
+	}
+	if cfg.APIPrefix == "" {
+		cfg.APIPrefix = DefaultJetStreamAPIPrefix
+	}
+	return cfg
+}
+
+// streamConfig is the configuration of a JetStream stream in the JetStream API
+type streamConfig struct {
+	Name      string   `json:"name"`
+	Subjects  []string `json:"subjects"`
+	Retention string   `json:"retention"`
+	MaxAge    int64    `json:"max_age"`
+	MaxMsgs   int64    `json:"max_msgs"`
+	MaxBytes  int64    `json:"max_bytes"`
+	Storage   string   `json:"storage"`
+	Replicas  int      `json:"num_replicas"`
+	Discard   string   `json:"discard"`
+}
+
+// streamConfig returns the JetStream configuration of the stream which the
+// server creates
+func (s *Server) streamConfig(cfg EventStreamConfig) streamConfig {
+	subjects := cfg.Subjects
+	if len(subjects) == 0 {
+		subjects = []string{s.Subjects.Event("", "")}
+	}
+	noLimit := func(v int64) int64 {
+		if v == 0 {
+			return -1
+		}
+		return v
+	}
+	return streamConfig{
+		Name:      cfg.Stream,
+		Subjects:  subjects,
+		Retention: "limits",
+		MaxAge:    int64(cfg.MaxAge),
+		MaxMsgs:   noLimit(cfg.MaxMsgs),
+		MaxBytes:  noLimit(cfg.MaxBytes),
+		Storage:   cfg.Storage,
+		Replicas:  cfg.Replicas,
+		Discard:   "old",
+	}
+}
+
+// jetStreamNotFound is the code of the JetStream API errors indicating that
+// a stream does not exist
+const jetStreamNotFound = 404
+
+// ensureEventStream creates the event stream, unless it exists
+func (s *Server) ensureEventStream(cfg EventStreamConfig) error {
+	msg, err := s.nats.Conn.Request(cfg.APIPrefix+".STREAM.INFO."+cfg.Stream, nil, jetStreamAPITimeout)
+	if err != nil {
+		return eris.Wrap(err, "JetStream API request failed")
+	}
+	var info jetStreamError
+	if err := json.Unmarshal(msg.Data, &info); err != nil {
+		return eris.Wrap(err, "invalid JetStream API response")
+	}
+	if info.Error == nil {
+		return nil
+	}
+	if info.Error.Code != jetStreamNotFound {
+		return eris.Errorf("JetStream error %d: %s", info.Error.Code, info.Error.Description)
+	}
+
+	data, err := json.Marshal(s.streamConfig(cfg))
+	if err != nil {
+		return err
+	}
+	msg, err = s.nats.Conn.Request(cfg.APIPrefix+".STREAM.CREATE."+cfg.Stream, data, jetStreamAPITimeout)
+	if err != nil {
+		return eris.Wrap(err, "JetStream API request failed")
+	}
+	var resp jetStreamError
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return eris.Wrap(err, "invalid JetStream API response")
+	}
+	if resp.Error != nil {
+		return eris.Errorf("JetStream error %d: %s", resp.Error.Code, resp.Error.Description)
+	}
+	s.Log.Info("created event stream", "stream", cfg.Stream)
+	return nil
+}
+
+// startEventStream prepares the storage of events in the event stream:
+// creating the stream, if so configured, and subscribing to the
+// acknowledgments of the stored events
+func (s *Server) startEventStream(cg *closeGroup) error {
+	if s.EventStream == nil {
+		return nil
+	}
+	cfg := s.EventStream.withDefaults()
+
+	if cfg.Create {
+		if err := s.ensureEventStream(cfg); err != nil {
+			return eris.Wrapf(err, "failed to create event stream %s", cfg.Stream)
+		}
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := s.nats.Conn.Subscribe(inbox, s.processEventAck)
+	if err != nil {
+		return eris.Wrap(err, "failed to subscribe to event acknowledgments")
+	}
+	cg.Add("event acknowledgment subscription", sub.Unsubscribe)
+
+	s.eventAckInbox.Store(inbox)
+	return nil
+}
+
+// processEventAck logs the events which the event stream failed to store
+func (s *Server) processEventAck(m *nats.Msg) {
+	var ack jetStreamError
+	if err := json.Unmarshal(m.Data, &ack); err != nil {
+		s.Log.Warn("invalid event acknowledgment", "error", err)
+		return
+	}
+	if ack.Error != nil {
+		s.Log.Warn("event stream failed to store event", "code", ack.Error.Code, "error", ack.Error.Description)
+	}
+}
+
+// eventAckSubject returns the subject on which the event stream acknowledges
+// the stored events, or the empty string if events are not stored
+func (s *Server) eventAckSubject() string {
+	inbox, _ := s.eventAckInbox.Load().(string)
+	return inbox
+}
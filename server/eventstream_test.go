@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestEventStreamConfig(t *testing.T) {
+	for name, cfg := range map[string]EventStreamConfig{
+		"no stream": {},
+		"storage":   {Stream: "EVENTS", Storage: "tape"},
+		"max age":   {Stream: "EVENTS", MaxAge: -time.Second},
+		"replicas":  {Stream: "EVENTS", Replicas: -1},
+		"subject":   {Stream: "EVENTS", Subjects: []string{""}},
+	} {
+		if cfg.validate() == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	s := &Server{Subjects: proxy.NewSubjectBuilder("ari.")}
+	sc := s.streamConfig(EventStreamConfig{Stream: "EVENTS", MaxAge: time.Hour, MaxMsgs: 1000}.withDefaults())
+	if len(sc.Subjects) != 1 || sc.Subjects[0] != "ari.event.>" {
+		t.Errorf("unexpected stream subjects %v", sc.Subjects)
+	}
+	if sc.MaxAge != int64(time.Hour) || sc.MaxMsgs != 1000 || sc.MaxBytes != -1 || sc.Storage != "file" || sc.Replicas != 1 {
+		t.Errorf("unexpected stream configuration %+v", sc)
+	}
+}
+
+func TestEventStreamPermissions(t *testing.T) {
+	s := &Server{
+		Application: "app",
+		AsteriskID:  "00:11:22",
+		Subjects:    proxy.NewSubjectBuilder("ari."),
+		EventStream: &EventStreamConfig{Stream: "EVENTS", Create: true},
+	}
+
+	required := make(map[string]bool)
+	for _, r := range s.requiredSubjects("tok") {
+		required[r.Subject] = true
+	}
+	for _, subject := range []string{"$JS.API.STREAM.INFO.EVENTS", "$JS.API.STREAM.CREATE.EVENTS", "_INBOX.tok"} {
+		if !required[subject] {
+			t.Errorf("subject %s is not required", subject)
+		}
+	}
+}
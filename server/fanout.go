@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// FanOutConfig describes the configuration of the worker pool which publishes
+// events to their dialogs.  Without it, the dialogs of each event are looked up
+// and published to serially, so that a slow dialog manager delays the
+// publishing of every later event.
+type FanOutConfig struct {
+	// Workers is the number of goroutines which look up and publish to the
+	// dialogs of events.  If it is not positive, events are published to their
+	// dialogs serially.
+	Workers int `mapstructure:"workers"`
+
+	// QueueSize is the number of events which may wait for each worker.  Once
+	// a worker's queue is full, publishing blocks.  It defaults to
+	// DefaultFanOutQueueSize.
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// DefaultFanOutQueueSize is the default number of events which may wait for
+// each dialog fan-out worker
+const DefaultFanOutQueueSize = 256
+
+// fanOutPool publishes events to their dialogs from a set of workers.  The
+// dialogs of each event are looked up by its worker, so that a slow dialog
+// manager does not hold up the event loop.  Events are assigned to workers by
+// the entity they concern (their first key, which is the channel for channel
+// events), so that the events of an entity, and hence of the dialogs bound to
+// it, are published in the order they were submitted.
+type fanOutPool struct {
+	queues  []chan fanOutEvent
+	publish func(ari.Event, ari.Header)
+
+	done <-chan struct{}
+}
+
+// fanOutEvent is an event queued for publishing to its dialogs, with the
+// header with which it was published
+type fanOutEvent struct {
+	event  ari.Event
+	header ari.Header
+}
+
+// newFanOutPool returns the worker pool described by the given configuration,
+// or nil if events are to be published to their dialogs serially
+func newFanOutPool(cfg *FanOutConfig, publish func(ari.Event, ari.Header)) *fanOutPool {
+	if cfg == nil || cfg.Workers <= 0 {
+		return nil
+	}
+
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = DefaultFanOutQueueSize
+	}
+
+	p := &fanOutPool{
+		queues:  make([]chan fanOutEvent, cfg.Workers),
+		publish: publish,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan fanOutEvent, size)
+	}
+	return p
+}
+
+// run starts the workers, which stop when the context is cancelled
+func (p *fanOutPool) run(ctx context.Context) {
+	p.done = ctx.Done()
+	for _, q := range p.queues {
+		go p.runWorker(ctx, q)
+	}
+}
+
+func (p *fanOutPool) runWorker(ctx context.Context, q chan fanOutEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-q:
+			p.publish(e.event, e.header)
+		}
+	}
+}
+
+// submit queues the event for publishing to its dialogs.  It blocks while the
+// queue of the event's worker is full, and drops the event once the pool is
+// stopped.
+func (p *fanOutPool) submit(e ari.Event, h ari.Header) {
+	select {
+	case p.queues[fanOutShard(e, len(p.queues))] <- fanOutEvent{e, h}:
+	case <-p.done:
+	}
+}
+
+// fanOutShard returns the index of the worker to which the event is assigned
+func fanOutShard(e ari.Event, n int) int {
+	for _, k := range e.Keys() {
+		if k == nil {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(k.Kind)) // nolint: errcheck
+		h.Write([]byte{0})      // nolint: errcheck
+		h.Write([]byte(k.ID))   // nolint: errcheck
+		return int(h.Sum32() % uint32(n))
+	}
+	return 0
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/nats-io/nats.go"
+)
+
+func channelEvent(id string, seq int) ari.Event {
+	return &ari.ChannelVarset{
+		EventData: ari.EventData{Type: "ChannelVarset"},
+		Channel:   ari.ChannelData{ID: id},
+		Value:     string(rune('a' + seq)),
+	}
+}
+
+func TestFanOutPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	published := make(map[string][]string)
+	done := make(chan string, 20)
+
+	p := newFanOutPool(&FanOutConfig{Workers: 4, QueueSize: 8}, func(e ari.Event, h ari.Header) {
+		v := e.(*ari.ChannelVarset)
+		if v.Channel.ID == "slow" {
+			<-release
+		}
+		mu.Lock()
+		published[v.Channel.ID] = append(published[v.Channel.ID], v.Value)
+		mu.Unlock()
+		done <- v.Channel.ID
+	})
+	p.run(ctx)
+
+	// Find a channel served by another worker than the slow one
+	fast := "fast"
+	for i := 0; fanOutShard(channelEvent(fast, 0), 4) == fanOutShard(channelEvent("slow", 0), 4); i++ {
+		fast = "fast" + string(rune('0'+i))
+	}
+
+	p.submit(channelEvent("slow", 0), nil)
+	for i := 0; i < 5; i++ {
+		p.submit(channelEvent(fast, i), nil)
+	}
+
+	// The events of the fast channel are not held up by the slow one
+	for i := 0; i < 5; i++ {
+		select {
+		case id := <-done:
+			if id != fast {
+				t.Fatalf("unexpected publish of %s", id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for fast channel events")
+		}
+	}
+
+	for i := 1; i < 5; i++ {
+		p.submit(channelEvent("slow", i), nil)
+	}
+	close(release)
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for slow channel events")
+		}
+	}
+
+	// The events of each channel are published in order
+	mu.Lock()
+	defer mu.Unlock()
+	for id, values := range published {
+		if len(values) != 5 {
+			t.Errorf("%s: %d events published", id, len(values))
+		}
+		for i, v := range values {
+			if v != string(rune('a'+i)) {
+				t.Errorf("%s: events out of order: %v", id, values)
+				break
+			}
+		}
+	}
+}
+
+func TestNewFanOutPoolDisabled(t *testing.T) {
+	if p := newFanOutPool(nil, nil); p != nil {
+		t.Error("expected no pool without configuration")
+	}
+	if p := newFanOutPool(&FanOutConfig{}, nil); p != nil {
+		t.Error("expected no pool without workers")
+	}
+}
+
+// blockingManager is a dialog manager whose lookups of the "slow" channel
+// block until released
+type blockingManager struct {
+	dialog.Manager
+
+	release chan struct{}
+	listed  chan string
+}
+
+func (m *blockingManager) List(eType, id string) []string {
+	if eType == ari.ChannelKey && id == "slow" {
+		<-m.release
+	}
+	m.listed <- id
+	return m.Manager.List(eType, id)
+}
+
+func TestPublishEventFanOutLookup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &blockingManager{
+		Manager: dialog.NewMemManager(),
+		release: make(chan struct{}),
+		listed:  make(chan string, 10),
+	}
+	defer close(m.release)
+
+	s := New()
+	s.Dialog = m
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+	s.fanOut = newFanOutPool(&FanOutConfig{Workers: 4, QueueSize: 8}, s.publishDialogEvents)
+	s.fanOut.run(ctx)
+
+	// Find a channel served by another worker than the slow one
+	fast := "fast"
+	for i := 0; fanOutShard(channelEvent(fast, 0), 4) == fanOutShard(channelEvent("slow", 0), 4); i++ {
+		fast = "fast" + string(rune('0'+i))
+	}
+
+	published := make(chan struct{})
+	go func() {
+		s.publishEvent(channelEvent("slow", 0))
+		s.publishEvent(channelEvent(fast, 0))
+		close(published)
+	}()
+
+	// The event loop is not held up by the lookup of the slow channel
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publishing blocked on the dialog lookup")
+	}
+
+	// Nor are the events of other channels
+	for {
+		select {
+		case id := <-m.listed:
+			if id == fast {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for the lookup of the fast channel")
+		}
+	}
+}
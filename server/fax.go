@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// FaxUserEvent is the name of the user event by which the fax dialplan
+// reports the completion of a fax operation
+const FaxUserEvent = "AriProxyFax"
+
+// FaxConfig describes the configuration of the fax module.  ARI has no fax
+// primitives, so fax operations are performed by continuing the channel into
+// a dialplan context which runs SendFAX or ReceiveFAX and reports the result
+// with a user event.  The context must provide the "send" and "receive"
+// extensions, such as:
+//
+//   [ari-proxy-fax]
+//   exten => send,1,SendFAX(${ARI_PROXY_FAX_FILE},${ARI_PROXY_FAX_OPTIONS})
+//    same => n,Goto(done,1)
+//   exten => receive,1,ReceiveFAX(${ARI_PROXY_FAX_FILE},${ARI_PROXY_FAX_OPTIONS})
+//    same => n,Goto(done,1)
+//   exten => done,1,Set(ARI_PROXY_FAX_DONE=1)
+//    same => n,UserEvent(AriProxyFax,status:${FAXSTATUS},pages:${FAXPAGES},error:${FAXERROR},remote_station_id:${REMOTESTATIONID},bitrate:${FAXBITRATE})
+//    same => n,Stasis(${ARI_PROXY_FAX_APP})
+//   exten => h,1,ExecIf($["${ARI_PROXY_FAX_DONE}" != "1"]?UserEvent(AriProxyFax,status:${FAXSTATUS},pages:${FAXPAGES},error:${FAXERROR},remote_station_id:${REMOTESTATIONID},bitrate:${FAXBITRATE}))
+//
+// The channel returns to the ARI application when the fax is complete, unless
+// it has been hung up.
+type FaxConfig struct {
+	// Context is the dialplan context which performs fax operations.  It
+	// defaults to "ari-proxy-fax".
+	Context string `mapstructure:"context"`
+}
+
+type faxJob struct {
+	operation string
+	file      string
+}
+
+// faxTracker tracks the fax operations in progress, indexed by channel ID
+type faxTracker struct {
+	jobs map[string]faxJob
+	mu   sync.Mutex
+}
+
+func (t *faxTracker) add(id string, job faxJob) {
+	t.mu.Lock()
+	if t.jobs == nil {
+		t.jobs = make(map[string]faxJob)
+	}
+	t.jobs[id] = job
+	t.mu.Unlock()
+}
+
+func (t *faxTracker) remove(id string) (faxJob, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, ok := t.jobs[id]
+	delete(t.jobs, id)
+	return job, ok
+}
+
+func (s *Server) faxSend(ctx context.Context, reply string, req *proxy.Request) {
+	s.startFax(reply, req, "send")
+}
+
+func (s *Server) faxReceive(ctx context.Context, reply string, req *proxy.Request) {
+	s.startFax(reply, req, "receive")
+}
+
+func (s *Server) startFax(reply string, req *proxy.Request, operation string) {
+	if s.Fax == nil {
+		s.sendError(reply, eris.New("fax module is not enabled"))
+		return
+	}
+	if req.Fax == nil || req.Fax.File == "" {
+		s.sendError(reply, eris.New("fax file is required"))
+		return
+	}
+
+	faxContext := s.Fax.Context
+	if faxContext == "" {
+		faxContext = "ari-proxy-fax"
+	}
+
+	// Keep receiving the channel's events once it leaves the application so
+	// that the completion user event is delivered
+	if err := s.ari.Application().Subscribe(ari.NewKey(ari.ApplicationKey, s.Application), "channel:"+req.Key.ID); err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to subscribe to channel"))
+		return
+	}
+
+	vars := map[string]string{
+		"ARI_PROXY_FAX_APP":     s.Application,
+		"ARI_PROXY_FAX_FILE":    req.Fax.File,
+		"ARI_PROXY_FAX_OPTIONS": req.Fax.Options,
+	}
+	if req.Fax.LocalStationID != "" {
+		vars["LOCALSTATIONID"] = req.Fax.LocalStationID
+	}
+	if req.Fax.HeaderInfo != "" {
+		vars["LOCALHEADERINFO"] = req.Fax.HeaderInfo
+	}
+	for k, v := range vars {
+		if err := s.ari.Channel().SetVariable(req.Key, k, v); err != nil {
+			s.sendError(reply, eris.Wrapf(err, "failed to set %s", k))
+			return
+		}
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	s.faxes.add(req.Key.ID, faxJob{operation: operation, file: req.Fax.File})
+
+	if err := s.ari.Channel().Continue(req.Key, faxContext, operation, 1); err != nil {
+		s.faxes.remove(req.Key.ID)
+		s.sendError(reply, eris.Wrap(err, "failed to start fax"))
+		return
+	}
+
+	s.sendError(reply, nil)
+}
+
+// processFaxEvent converts the completion user events of the fax dialplan into
+// FaxFinished events
+func (s *Server) processFaxEvent(e ari.Event) {
+	var id string
+	var result interface{}
+
+	switch v := e.(type) {
+	case *ari.ChannelUserevent:
+		if v.Eventname != FaxUserEvent {
+			return
+		}
+		id, result = v.Channel.ID, v.Userevent
+	case *ari.ChannelDestroyed:
+		// The channel was destroyed without reporting a result
+		id = v.Channel.ID
+	default:
+		return
+	}
+
+	job, ok := s.faxes.remove(id)
+	if !ok {
+		return
+	}
+
+	ev := &proxy.FaxFinished{
+		EventData: s.newEventData(proxy.EventFaxFinished),
+		ChannelID: id,
+		Operation: job.operation,
+		File:      job.file,
+	}
+	parseFaxResult(ev, result)
+
+	s.publishEvent(ev)
+}
+
+// parseFaxResult fills the FaxFinished event from the data of the completion
+// user event
+func parseFaxResult(ev *proxy.FaxFinished, result interface{}) {
+	if data, ok := result.(map[string]interface{}); ok {
+		str := func(k string) string {
+			if v, ok := data[k]; ok && v != nil {
+				return fmt.Sprint(v)
+			}
+			return ""
+		}
+		ev.Status = str("status")
+		ev.Error = str("error")
+		ev.RemoteStationID = str("remote_station_id")
+		ev.Pages, _ = strconv.Atoi(str("pages"))     // nolint: errcheck
+		ev.Bitrate, _ = strconv.Atoi(str("bitrate")) // nolint: errcheck
+	}
+
+	if ev.Status == "" {
+		ev.Status = "FAILED"
+		if ev.Error == "" {
+			ev.Error = "no fax result was reported"
+		}
+	}
+}
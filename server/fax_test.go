@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestParseFaxResult(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"status":"SUCCESS","pages":"3","error":"","remote_station_id":"5551212","bitrate":"14400"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := new(proxy.FaxFinished)
+	parseFaxResult(ev, data)
+	if ev.Status != "SUCCESS" || ev.Pages != 3 || ev.Bitrate != 14400 || ev.RemoteStationID != "5551212" || ev.Error != "" {
+		t.Errorf("unexpected fax result: %+v", ev)
+	}
+
+	ev = new(proxy.FaxFinished)
+	parseFaxResult(ev, nil)
+	if ev.Status != "FAILED" || ev.Error == "" {
+		t.Errorf("expected failure for missing result, got %+v", ev)
+	}
+}
+
+func TestFaxTracker(t *testing.T) {
+	var tr faxTracker
+
+	tr.add("c1", faxJob{operation: "send", file: "/tmp/fax.tiff"})
+	if job, ok := tr.remove("c1"); !ok || job.operation != "send" {
+		t.Errorf("unexpected job: %+v (%v)", job, ok)
+	}
+	if _, ok := tr.remove("c1"); ok {
+		t.Error("job should only be removed once")
+	}
+}
+
+func TestFaxFlow(t *testing.T) {
+	ft := newFlowTest(t)
+	defer ft.Close()
+	ft.s.Fax = &FaxConfig{Context: "faxing"}
+	ft.handleEvents(t)
+
+	app := new(arimocks.Application)
+	ft.client.On("Application").Return(app)
+	app.On("Subscribe", ari.NewKey(ari.ApplicationKey, "app"), "channel:c1").Return(nil)
+	app.On("Subscribe", ari.NewKey(ari.ApplicationKey, "app"), "channel:c2").Return(nil)
+
+	c1 := ari.NewKey(ari.ChannelKey, "c1")
+	c2 := ari.NewKey(ari.ChannelKey, "c2")
+	ft.channel.On("SetVariable", c1, "ARI_PROXY_FAX_APP", "app").Return(nil)
+	ft.channel.On("SetVariable", c1, "ARI_PROXY_FAX_FILE", "/var/spool/fax/out.tiff").Return(nil)
+	ft.channel.On("SetVariable", c1, "ARI_PROXY_FAX_OPTIONS", "f").Return(nil)
+	ft.channel.On("SetVariable", c1, "LOCALSTATIONID", "5551000").Return(nil)
+	ft.channel.On("Continue", c1, "faxing", "send", 1).Return(nil)
+	ft.channel.On("SetVariable", c2, "ARI_PROXY_FAX_APP", "app").Return(nil)
+	ft.channel.On("SetVariable", c2, "ARI_PROXY_FAX_FILE", "/var/spool/fax/in.tiff").Return(nil)
+	ft.channel.On("SetVariable", c2, "ARI_PROXY_FAX_OPTIONS", "").Return(nil)
+	ft.channel.On("Continue", c2, "faxing", "receive", 1).Return(nil)
+
+	// A sent fax is reported by the user event of the fax dialplan
+	resp := ft.request(t, &proxy.Request{
+		Kind: "FaxSend",
+		Key:  c1,
+		Fax:  &proxy.Fax{File: "/var/spool/fax/out.tiff", Options: "f", LocalStationID: "5551000"},
+	})
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	ft.send(&ari.ChannelUserevent{
+		EventData: ari.EventData{Type: ari.Events.ChannelUserevent},
+		Channel:   ari.ChannelData{ID: "c1"},
+		Eventname: FaxUserEvent,
+		Userevent: map[string]interface{}{"status": "SUCCESS", "pages": "2", "remote_station_id": "5552000", "bitrate": "9600"},
+	})
+	e, ok := ft.event(t, proxy.EventFaxFinished).(*proxy.FaxFinished)
+	if !ok || e.ChannelID != "c1" || e.Operation != "send" || e.File != "/var/spool/fax/out.tiff" || e.Status != "SUCCESS" || e.Pages != 2 || e.Bitrate != 9600 || e.RemoteStationID != "5552000" {
+		t.Errorf("unexpected fax result: %+v", e)
+	}
+
+	// A received fax fails if its channel hangs up without a result
+	resp = ft.request(t, &proxy.Request{
+		Kind: "FaxReceive",
+		Key:  c2,
+		Fax:  &proxy.Fax{File: "/var/spool/fax/in.tiff"},
+	})
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	ft.send(&ari.ChannelDestroyed{
+		EventData: ari.EventData{Type: ari.Events.ChannelDestroyed},
+		Channel:   ari.ChannelData{ID: "c2"},
+	})
+	e, ok = ft.event(t, proxy.EventFaxFinished).(*proxy.FaxFinished)
+	if !ok || e.ChannelID != "c2" || e.Operation != "receive" || e.Status != "FAILED" || e.Error == "" {
+		t.Errorf("unexpected fax result: %+v", e)
+	}
+
+	ft.channel.AssertExpectations(t)
+	app.AssertExpectations(t)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// errHangup indicates that the channel of a call flow left the application
+var errHangup = eris.New("channel left the application")
+
+// recordingFinishTimeout is the time to wait for a recording to be finalized
+// after its channel has left the application
+var recordingFinishTimeout = 5 * time.Second
+
+// callFlow provides the blocking primitives (play, collect digit, record) used
+// by the server-side call flows.  It must be created before the first
+// operation on the channel so that no events are missed, and closed when the
+// flow is complete.
+type callFlow struct {
+	s   *Server
+	key *ari.Key
+	sub ari.Subscription
+}
+
+func (s *Server) newCallFlow(key *ari.Key) *callFlow {
+	return &callFlow{
+		s:   s,
+		key: key,
+		sub: s.ari.Bus().Subscribe(key, ari.Events.ChannelDtmfReceived, ari.Events.StasisEnd, ari.Events.ChannelDestroyed),
+	}
+}
+
+// Close releases the resources of the call flow
+func (f *callFlow) Close() {
+	f.sub.Cancel()
+}
+
+// digit extracts the DTMF digit from a channel event, returning errHangup if
+// the event indicates that the channel has left the application
+func (f *callFlow) digit(e ari.Event) (string, error) {
+	if v, ok := e.(*ari.ChannelDtmfReceived); ok {
+		return v.Digit, nil
+	}
+	return "", errHangup
+}
+
+// Play plays the given media to the channel and waits for it to finish.  If
+// one of the interrupt digits is pressed, the playback is stopped and the
+// digit is returned.
+func (f *callFlow) Play(ctx context.Context, mediaURI string, interrupt string) (string, error) {
+	id := rid.New(rid.Playback)
+
+	pbSub := f.s.ari.Bus().Subscribe(ari.NewKey(ari.PlaybackKey, id), ari.Events.PlaybackFinished)
+	defer pbSub.Cancel()
+
+	pb, err := f.s.ari.Channel().Play(f.key, id, mediaURI)
+	if err != nil {
+		return "", eris.Wrapf(err, "failed to play %s", mediaURI)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-pbSub.Events():
+			return "", nil
+		case e := <-f.sub.Events():
+			digit, err := f.digit(e)
+			if err != nil {
+				return "", err
+			}
+			if interrupt != "" && strings.Contains(interrupt, digit) {
+				if err := pb.Stop(); err != nil {
+					f.s.Log.Debug("failed to stop interrupted playback", "error", err)
+				}
+				return digit, nil
+			}
+		}
+	}
+}
+
+// WaitDigit waits for a DTMF digit.  An empty digit is returned if none is
+// received within the timeout.
+func (f *callFlow) WaitDigit(ctx context.Context, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-timer.C:
+		return "", nil
+	case e := <-f.sub.Events():
+		return f.digit(e)
+	}
+}
+
+// Record records the channel and waits for the recording to finish
+func (f *callFlow) Record(ctx context.Context, name string, opts *ari.RecordingOptions) (*ari.LiveRecordingData, error) {
+	recSub := f.s.ari.Bus().Subscribe(ari.NewKey(ari.LiveRecordingKey, name), ari.Events.RecordingFinished, ari.Events.RecordingFailed)
+	defer recSub.Cancel()
+
+	if _, err := f.s.ari.Channel().Record(f.key, name, opts); err != nil {
+		return nil, eris.Wrap(err, "failed to start recording")
+	}
+
+	var hangup <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-hangup:
+			return nil, errHangup
+		case e := <-recSub.Events():
+			switch v := e.(type) {
+			case *ari.RecordingFinished:
+				return &v.Recording, nil
+			case *ari.RecordingFailed:
+				return nil, eris.Errorf("recording failed: %s", v.Recording.Cause)
+			}
+		case e := <-f.sub.Events():
+			// Recordings are finalized when the channel hangs up, so allow
+			// time for the RecordingFinished event to arrive
+			if _, err := f.digit(e); err != nil && hangup == nil {
+				hangup = time.After(recordingFinishTimeout)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/natstest"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/CyCoreSystems/ari/v5/stdbus"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/mock"
+)
+
+// flowTest runs a server against mock ARI, whose events are sent by the test
+// on a real event bus, and an in-process NATS server, on which the replies
+// and events published by the server are received
+type flowTest struct {
+	s        *Server
+	client   *arimocks.Client
+	bus      ari.Bus
+	channel  *arimocks.Channel
+	playback *arimocks.Playback
+
+	nats   *natstest.Server
+	nc     *nats.Conn
+	events chan ari.Event
+
+	// played receives the media of each playback started on a channel
+	played chan string
+
+	// stop stops the event handler, if it runs
+	stop context.CancelFunc
+}
+
+func newFlowTest(t *testing.T, opts ...Option) *flowTest {
+	t.Helper()
+
+	ft := &flowTest{
+		s:        New(opts...),
+		client:   new(arimocks.Client),
+		bus:      stdbus.New(),
+		channel:  new(arimocks.Channel),
+		playback: new(arimocks.Playback),
+		events:   make(chan ari.Event, 100),
+		played:   make(chan string, 100),
+	}
+	if err := ft.s.optErr; err != nil {
+		t.Fatal(err)
+	}
+	ft.client.On("Bus").Return(ft.bus)
+	ft.client.On("Channel").Return(ft.channel)
+	ft.client.On("Connected").Return(true)
+	ft.playback.On("Stop", mock.Anything).Return(nil)
+
+	var err error
+	if ft.nats, err = natstest.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if ft.nc, err = nats.Connect(ft.nats.URL()); err != nil {
+		ft.nats.Close()
+		t.Fatal(err)
+	}
+
+	s := ft.s
+	s.ari = ft.client
+	s.nats = &nats.EncodedConn{Conn: ft.nc}
+	s.Application = "app"
+	s.setNodeID("node")
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+	s.quota = newQuotaEngine(s.Quota)
+
+	if _, err := ft.nc.Subscribe(s.Subjects.Event("", ""), func(m *nats.Msg) {
+		if e, err := proxy.DecodeEvent(m.Data); err == nil {
+			ft.events <- e
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ft.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return ft
+}
+
+// Close stops the event handler and disconnects the server from NATS
+func (ft *flowTest) Close() {
+	if ft.stop != nil {
+		ft.stop()
+	}
+	ft.nc.Close()
+	ft.nats.Close()
+}
+
+// handleEvents runs the event handler of the server, which processes the
+// events sent by the test before publishing them, as it does those of
+// Asterisk
+func (ft *flowTest) handleEvents(t *testing.T) {
+	t.Helper()
+
+	var ctx context.Context
+	ctx, ft.stop = context.WithCancel(context.Background())
+	go ft.s.runEventHandler(ctx)
+
+	// Wait for the handler to subscribe to the bus
+	for i := 0; i < 100; i++ {
+		ft.send(&ari.DeviceStateChanged{EventData: ari.EventData{Type: ari.Events.DeviceStateChanged}})
+		select {
+		case e := <-ft.events:
+			if e.GetType() == ari.Events.DeviceStateChanged {
+				return
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("event handler not running")
+}
+
+// request dispatches a request to the server, returning its reply
+func (ft *flowTest) request(t *testing.T, req *proxy.Request) *proxy.Response {
+	t.Helper()
+
+	reply := nats.NewInbox()
+	sub, err := ft.nc.SubscribeSync(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe() // nolint: errcheck
+	if err := ft.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ft.s.dispatchRequest(context.Background(), reply, req)
+
+	m, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("no reply to %s: %v", req.Kind, err)
+	}
+	resp, err := proxy.DecodeResponse(m.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// event waits for the next published event of the given type, skipping
+// events of other types
+func (ft *flowTest) event(t *testing.T, typ string) ari.Event {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-ft.events:
+			if e.GetType() == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s event", typ)
+		}
+	}
+}
+
+// send sends an event of Asterisk to the server
+func (ft *flowTest) send(e ari.Event) {
+	ft.bus.Send(e)
+}
+
+// dtmf sends a DTMF digit received on the given channel
+func (ft *flowTest) dtmf(channelID, digit string) {
+	ft.send(&ari.ChannelDtmfReceived{
+		EventData: ari.EventData{Type: ari.Events.ChannelDtmfReceived},
+		Channel:   ari.ChannelData{ID: channelID},
+		Digit:     digit,
+	})
+}
+
+// mockPlay plays media to channels, finishing each playback at once unless
+// held, in which case it plays until it is interrupted
+func (ft *flowTest) mockPlay(held func(mediaURI string) bool) {
+	ft.channel.On("Play", mock.Anything, mock.Anything, mock.Anything).Return(func(_ *ari.Key, id, mediaURI string) *ari.PlaybackHandle {
+		ft.played <- mediaURI
+		if held == nil || !held(mediaURI) {
+			go ft.send(&ari.PlaybackFinished{
+				EventData: ari.EventData{Type: ari.Events.PlaybackFinished},
+				Playback:  ari.PlaybackData{ID: id, MediaURI: mediaURI},
+			})
+		}
+		return ari.NewPlaybackHandle(ari.NewKey(ari.PlaybackKey, id), ft.playback, nil)
+	}, nil)
+}
+
+// nextPlayed waits for the next playback started on a channel
+func (ft *flowTest) nextPlayed(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case m := <-ft.played:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for playback")
+	}
+	return ""
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// OriginateAttempt describes an outbound channel which is about to be created
+type OriginateAttempt struct {
+	// ChannelID is the ID of the channel
+	ChannelID string
+
+	// Account is the tenant on whose behalf the channel is requested
+	Account string
+
+	// Destination is the dialed number, as requested
+	Destination string
+
+	// Endpoint is the Asterisk endpoint of the channel, after rewriting
+	Endpoint string
+}
+
+// OriginatePolicy is consulted before each outbound channel is created, so as
+// to block fraudulent calls (e.g. by destination, cost or velocity).
+type OriginatePolicy interface {
+	// CheckOriginate admits the given attempt, or returns an error to
+	// block it, preferably an *OriginateBlockedError.
+	CheckOriginate(a *OriginateAttempt) error
+
+	// ReleaseOriginate is called when a channel admitted by the policy ends,
+	// or could not be created after all
+	ReleaseOriginate(channelID string)
+}
+
+// OriginatePolicyFunc is a function which implements a stateless
+// OriginatePolicy
+type OriginatePolicyFunc func(a *OriginateAttempt) error
+
+// CheckOriginate implements OriginatePolicy
+func (f OriginatePolicyFunc) CheckOriginate(a *OriginateAttempt) error {
+	return f(a)
+}
+
+// ReleaseOriginate implements OriginatePolicy
+func (f OriginatePolicyFunc) ReleaseOriginate(channelID string) {}
+
+// OriginateBlockedError is the error of an outbound channel which was blocked
+// by an originate policy.  Clients detect it with proxy.IsOriginateBlocked.
+type OriginateBlockedError struct {
+	// Policy is the name of the policy
+	Policy string
+
+	// Reason describes why the channel was blocked
+	Reason string
+}
+
+func (e *OriginateBlockedError) Error() string {
+	if e.Policy == "" {
+		return proxy.ErrOriginateBlocked.Error() + ": " + e.Reason
+	}
+	return proxy.ErrOriginateBlocked.Error() + " by " + e.Policy + ": " + e.Reason
+}
+
+// Unwrap returns proxy.ErrOriginateBlocked
+func (e *OriginateBlockedError) Unwrap() error {
+	return proxy.ErrOriginateBlocked
+}
+
+// evaluateOriginatePolicies consults the given policies in order, stopping at
+// the first which blocks the attempt, in which case the attempt is released
+// from the policies which admitted it
+func evaluateOriginatePolicies(policies []OriginatePolicy, a *OriginateAttempt) *OriginateBlockedError {
+	for i, p := range policies {
+		err := p.CheckOriginate(a)
+		if err == nil {
+			continue
+		}
+		for _, admitted := range policies[:i] {
+			admitted.ReleaseOriginate(a.ChannelID)
+		}
+
+		blocked, ok := err.(*OriginateBlockedError)
+		if !ok {
+			blocked = &OriginateBlockedError{Reason: err.Error()}
+		}
+		return blocked
+	}
+	return nil
+}
+
+// checkOriginatePolicies consults the Server's originate policies about a new
+// outbound channel to the given destinations (the dialed number, followed by
+// the rewritten endpoint), recording an audit log entry and an
+// OriginateBlocked event if it is blocked.  Channels without a destination
+// (e.g. snoops) are not checked.
+func (s *Server) checkOriginatePolicies(req *proxy.Request, id string, destinations ...string) error {
+	if len(s.OriginatePolicies) == 0 || len(destinations) == 0 {
+		return nil
+	}
+
+	a := &OriginateAttempt{
+		ChannelID:   id,
+		Account:     req.Tenant,
+		Destination: endpointNumber(destinations[0]),
+		Endpoint:    destinations[0],
+	}
+	if len(destinations) > 1 {
+		a.Endpoint = destinations[1]
+	}
+
+	blocked := evaluateOriginatePolicies(s.OriginatePolicies, a)
+	if blocked == nil {
+		return nil
+	}
+
+	s.Log.Warn("AUDIT: originate blocked by policy", "policy", blocked.Policy, "reason", blocked.Reason,
+		"tenant", a.Account, "channel", a.ChannelID, "destination", a.Destination)
+	s.publishEvent(&proxy.OriginateBlocked{
+		EventData:   s.newEventData(proxy.EventOriginateBlocked),
+		ChannelID:   a.ChannelID,
+		Tenant:      a.Account,
+		Destination: a.Destination,
+		Policy:      blocked.Policy,
+		Reason:      blocked.Reason,
+	})
+	return blocked
+}
+
+// releaseChannel releases a channel from the quotas and originate policies
+// which admitted it
+func (s *Server) releaseChannel(id string) {
+	s.quota.ReleaseChannel(id)
+	s.originated.remove(id)
+	for _, p := range s.OriginatePolicies {
+		p.ReleaseOriginate(id)
+	}
+}
+
+// processPolicyEvent releases the channels which end from the originate
+// policies
+func (s *Server) processPolicyEvent(e ari.Event) {
+	if v, ok := e.(*ari.ChannelDestroyed); ok {
+		for _, p := range s.OriginatePolicies {
+			p.ReleaseOriginate(v.Channel.ID)
+		}
+	}
+}
+
+// InternationalCallLimit is an OriginatePolicy which limits the number of
+// simultaneous international calls of each account (tenant).  A call is
+// international if its dialed number, in E.164 format or prefixed with the
+// InternationalPrefix, has a country calling code other than CountryCode.
+// National numbers are not limited.
+type InternationalCallLimit struct {
+	// CountryCode is the country calling code of the domestic numbers (e.g.
+	// "1")
+	CountryCode string `mapstructure:"country_code"`
+
+	// InternationalPrefix is the dialing prefix of international numbers
+	// (e.g. "011" or "00"), if they are not dialed in E.164 format
+	InternationalPrefix string `mapstructure:"international_prefix"`
+
+	// MaxCalls is the maximum number of simultaneous international calls of
+	// an account.  Zero blocks the international calls of the accounts
+	// without a limit of their own.
+	MaxCalls int `mapstructure:"max_calls"`
+
+	// Accounts overrides MaxCalls for the given accounts
+	Accounts map[string]int `mapstructure:"accounts"`
+
+	// active maps the IDs of the admitted international calls to their
+	// accounts
+	active map[string]string
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+// international indicates whether the given dialed number is international
+func (l *InternationalCallLimit) international(number string) bool {
+	number = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -().", r) {
+			return -1
+		}
+		return r
+	}, number)
+
+	var digits string
+	switch {
+	case strings.HasPrefix(number, "+"):
+		digits = number[1:]
+	case l.InternationalPrefix != "" && strings.HasPrefix(number, l.InternationalPrefix):
+		digits = strings.TrimPrefix(number, l.InternationalPrefix)
+	default:
+		return false
+	}
+	if !isDigits(digits) {
+		return false
+	}
+	return callingCode(digits) != l.CountryCode
+}
+
+// limit returns the maximum number of simultaneous international calls of the
+// given account
+func (l *InternationalCallLimit) limit(account string) int {
+	if max, ok := l.Accounts[account]; ok {
+		return max
+	}
+	return l.MaxCalls
+}
+
+// CheckOriginate implements OriginatePolicy
+func (l *InternationalCallLimit) CheckOriginate(a *OriginateAttempt) error {
+	if !l.international(a.Destination) {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active == nil {
+		l.active = make(map[string]string)
+		l.counts = make(map[string]int)
+	}
+	if _, ok := l.active[a.ChannelID]; ok {
+		return nil
+	}
+
+	max := l.limit(a.Account)
+	if l.counts[a.Account] >= max {
+		return &OriginateBlockedError{
+			Policy: "international call limit",
+			Reason: fmt.Sprintf("account %q has reached its limit of %d simultaneous international calls", a.Account, max),
+		}
+	}
+	l.active[a.ChannelID] = a.Account
+	l.counts[a.Account]++
+	return nil
+}
+
+// ReleaseOriginate implements OriginatePolicy
+func (l *InternationalCallLimit) ReleaseOriginate(channelID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	account, ok := l.active[channelID]
+	if !ok {
+		return
+	}
+	delete(l.active, channelID)
+	l.counts[account]--
+	if l.counts[account] <= 0 {
+		delete(l.counts, account)
+	}
+}
+
+// Calls returns the number of simultaneous international calls of the given
+// account
+func (l *InternationalCallLimit) Calls(account string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[account]
+}
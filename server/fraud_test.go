@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+func TestInternationalCallLimit(t *testing.T) {
+	l := &InternationalCallLimit{
+		CountryCode:         "1",
+		InternationalPrefix: "011",
+		MaxCalls:            1,
+		Accounts:            map[string]int{"acme": 2, "blocked": 0},
+	}
+
+	for number, expected := range map[string]bool{
+		"+442079460000":       true,
+		"011 44 20 7946 0000": true,
+		"+12125550100":        false,
+		"2125550100":          false,
+		"1001":                false,
+	} {
+		if l.international(number) != expected {
+			t.Errorf("%s: expected international=%v", number, expected)
+		}
+	}
+
+	attempt := func(id, account string) error {
+		return l.CheckOriginate(&OriginateAttempt{ChannelID: id, Account: account, Destination: "+442079460000"})
+	}
+
+	if err := attempt("a1", "acme"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := attempt("a2", "acme"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := attempt("a3", "acme")
+	if _, ok := err.(*OriginateBlockedError); !ok || !proxy.IsOriginateBlocked(eris.New(err.Error())) {
+		t.Errorf("expected originate to be blocked, got %v", err)
+	}
+	if l.CheckOriginate(&OriginateAttempt{ChannelID: "a4", Account: "acme", Destination: "+12125550100"}) != nil {
+		t.Error("domestic call should not be limited")
+	}
+
+	l.ReleaseOriginate("a1")
+	if err := attempt("a3", "acme"); err != nil {
+		t.Errorf("expected released call to make room, got %v", err)
+	}
+	if l.Calls("acme") != 2 {
+		t.Errorf("expected 2 calls, got %d", l.Calls("acme"))
+	}
+
+	if attempt("b1", "other") != nil || attempt("b2", "other") == nil {
+		t.Error("expected default limit of 1 call")
+	}
+	if attempt("c1", "blocked") == nil {
+		t.Error("expected international calls to be blocked")
+	}
+}
+
+func TestEvaluateOriginatePolicies(t *testing.T) {
+	limit := &InternationalCallLimit{CountryCode: "1", MaxCalls: 1}
+	deny := OriginatePolicyFunc(func(a *OriginateAttempt) error {
+		if a.Account == "fraudster" {
+			return eris.New("account is suspended")
+		}
+		return nil
+	})
+	policies := []OriginatePolicy{limit, deny}
+
+	a := &OriginateAttempt{ChannelID: "ch1", Account: "fraudster", Destination: "+442079460000"}
+	blocked := evaluateOriginatePolicies(policies, a)
+	if blocked == nil || blocked.Reason != "account is suspended" {
+		t.Fatalf("unexpected result %v", blocked)
+	}
+	if blocked.Error() != "originate blocked: account is suspended" {
+		t.Errorf("unexpected error %q", blocked.Error())
+	}
+	if limit.Calls("fraudster") != 0 {
+		t.Error("expected blocked attempt to be released from the previous policies")
+	}
+
+	a.Account = "acme"
+	if blocked := evaluateOriginatePolicies(policies, a); blocked != nil {
+		t.Errorf("unexpected block %v", blocked)
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// GeographyConfig describes the resolution of the geography of caller numbers
+type GeographyConfig struct {
+	// E164 optionally normalizes caller numbers which are not in E.164
+	// format (e.g. national numbers) before they are resolved.  Otherwise,
+	// numbers without a leading "+" are assumed to start with their country
+	// calling code.
+	E164 *E164Normalizer `mapstructure:"e164"`
+
+	// Regions extends the built-in table of country calling codes with
+	// finer-grained number prefixes, such as area codes
+	Regions []GeographyRegion `mapstructure:"regions"`
+}
+
+// GeographyRegion assigns the numbers starting with an E.164 prefix to a
+// country and region
+type GeographyRegion struct {
+	// Prefix is the prefix of the numbers in E.164 format, including the
+	// country calling code (e.g. "1415")
+	Prefix string `mapstructure:"prefix"`
+
+	// Country is the ISO 3166-1 alpha-2 code of the country
+	Country string `mapstructure:"country"`
+
+	// Region is the region within the country
+	Region string `mapstructure:"region"`
+}
+
+// geoMinLength is the minimum length of a number whose geography is resolved,
+// so that extensions and service codes are ignored
+const geoMinLength = 7
+
+// Geographer resolves the country and region of telephone numbers by the
+// longest matching prefix of their E.164 format
+type Geographer struct {
+	normalizer *E164Normalizer
+	prefixes   map[string]GeographyRegion
+	maxLen     int
+}
+
+// NewGeographer returns a Geographer for the given configuration
+func NewGeographer(cfg GeographyConfig) (*Geographer, error) {
+	g := &Geographer{
+		normalizer: cfg.E164,
+		prefixes:   make(map[string]GeographyRegion),
+	}
+	add := func(r GeographyRegion) {
+		g.prefixes[r.Prefix] = r
+		if len(r.Prefix) > g.maxLen {
+			g.maxLen = len(r.Prefix)
+		}
+	}
+
+	for code, country := range callingCodes {
+		add(GeographyRegion{Prefix: code, Country: country})
+	}
+	for prefix, country := range geoPrefixes {
+		add(GeographyRegion{Prefix: prefix, Country: country})
+	}
+
+	for i, r := range cfg.Regions {
+		r.Prefix = strings.TrimPrefix(r.Prefix, "+")
+		if !isDigits(r.Prefix) {
+			return nil, eris.Errorf("invalid prefix %q of geography region %d", r.Prefix, i)
+		}
+		if callingCode(r.Prefix) == "" {
+			return nil, eris.Errorf("prefix %q of geography region %d has no known country calling code", r.Prefix, i)
+		}
+		if r.Country == "" {
+			return nil, eris.Errorf("geography region %d has no country", i)
+		}
+		add(r)
+	}
+	return g, nil
+}
+
+// Lookup returns the geography of the given number, or nil if it cannot be
+// resolved
+func (g *Geographer) Lookup(number string) *proxy.NumberGeography {
+	digits := g.e164Digits(number)
+	if digits == "" {
+		return nil
+	}
+	code := callingCode(digits)
+	if code == "" {
+		return nil
+	}
+
+	n := len(digits)
+	if n > g.maxLen {
+		n = g.maxLen
+	}
+	for ; n >= len(code); n-- {
+		if r, ok := g.prefixes[digits[:n]]; ok {
+			return &proxy.NumberGeography{
+				Country:     r.Country,
+				CallingCode: code,
+				Region:      r.Region,
+			}
+		}
+	}
+	return nil
+}
+
+// e164Digits returns the digits of the E.164 format of the given number, or
+// the empty string if it is not a telephone number
+func (g *Geographer) e164Digits(number string) string {
+	number = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -().", r) {
+			return -1
+		}
+		return r
+	}, number)
+
+	if g.normalizer != nil && !strings.HasPrefix(number, "+") {
+		number, _ = g.normalizer.Rewrite(number, nil)
+	}
+
+	digits := strings.TrimPrefix(number, "+")
+	if !isDigits(digits) || len(digits) < geoMinLength {
+		return ""
+	}
+	return digits
+}
+
+// callingCode returns the country calling code which prefixes the given E.164
+// digits, if any.  Calling codes form a prefix code, so at most one matches.
+func callingCode(digits string) string {
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if _, ok := callingCodes[digits[:n]]; ok {
+			return digits[:n]
+		}
+	}
+	return ""
+}
+
+// attachGeography resolves the geography of the caller number of a call
+// entering the application and attaches it to the channel variables of its
+// StasisStart event (see proxy.GetNumberGeography)
+func (s *Server) attachGeography(e *ari.StasisStart) {
+	if s.Geography == nil {
+		return
+	}
+	proxy.SetNumberGeography(&e.Channel, s.Geography.Lookup(e.Channel.GetCaller().GetNumber()))
+}
+
+// callingCodes maps the country calling codes to the ISO 3166-1 alpha-2 code
+// of their (main) country.  "001" denotes the non-geographic services.
+var callingCodes = map[string]string{
+	"1": "US", "7": "RU",
+	"20": "EG", "27": "ZA", "30": "GR", "31": "NL", "32": "BE", "33": "FR",
+	"34": "ES", "36": "HU", "39": "IT", "40": "RO", "41": "CH", "43": "AT",
+	"44": "GB", "45": "DK", "46": "SE", "47": "NO", "48": "PL", "49": "DE",
+	"51": "PE", "52": "MX", "53": "CU", "54": "AR", "55": "BR", "56": "CL",
+	"57": "CO", "58": "VE", "60": "MY", "61": "AU", "62": "ID", "63": "PH",
+	"64": "NZ", "65": "SG", "66": "TH", "81": "JP", "82": "KR", "84": "VN",
+	"86": "CN", "90": "TR", "91": "IN", "92": "PK", "93": "AF", "94": "LK",
+	"95": "MM", "98": "IR",
+	"211": "SS", "212": "MA", "213": "DZ", "216": "TN", "218": "LY", "220": "GM",
+	"221": "SN", "222": "MR", "223": "ML", "224": "GN", "225": "CI", "226": "BF",
+	"227": "NE", "228": "TG", "229": "BJ", "230": "MU", "231": "LR", "232": "SL",
+	"233": "GH", "234": "NG", "235": "TD", "236": "CF", "237": "CM", "238": "CV",
+	"239": "ST", "240": "GQ", "241": "GA", "242": "CG", "243": "CD", "244": "AO",
+	"245": "GW", "246": "IO", "247": "AC", "248": "SC", "249": "SD", "250": "RW",
+	"251": "ET", "252": "SO", "253": "DJ", "254": "KE", "255": "TZ", "256": "UG",
+	"257": "BI", "258": "MZ", "260": "ZM", "261": "MG", "262": "RE", "263": "ZW",
+	"264": "NA", "265": "MW", "266": "LS", "267": "BW", "268": "SZ", "269": "KM",
+	"290": "SH", "291": "ER", "297": "AW", "298": "FO", "299": "GL",
+	"350": "GI", "351": "PT", "352": "LU", "353": "IE", "354": "IS", "355": "AL",
+	"356": "MT", "357": "CY", "358": "FI", "359": "BG", "370": "LT", "371": "LV",
+	"372": "EE", "373": "MD", "374": "AM", "375": "BY", "376": "AD", "377": "MC",
+	"378": "SM", "379": "VA", "380": "UA", "381": "RS", "382": "ME", "383": "XK",
+	"385": "HR", "386": "SI", "387": "BA", "389": "MK", "420": "CZ", "421": "SK",
+	"423": "LI",
+	"500": "FK", "501": "BZ", "502": "GT", "503": "SV", "504": "HN", "505": "NI",
+	"506": "CR", "507": "PA", "508": "PM", "509": "HT", "590": "GP", "591": "BO",
+	"592": "GY", "593": "EC", "594": "GF", "595": "PY", "596": "MQ", "597": "SR",
+	"598": "UY", "599": "CW",
+	"670": "TL", "672": "NF", "673": "BN", "674": "NR", "675": "PG", "676": "TO",
+	"677": "SB", "678": "VU", "679": "FJ", "680": "PW", "681": "WF", "682": "CK",
+	"683": "NU", "685": "WS", "686": "KI", "687": "NC", "688": "TV", "689": "PF",
+	"690": "TK", "691": "FM", "692": "MH",
+	"800": "001", "808": "001", "850": "KP", "852": "HK", "853": "MO", "855": "KH",
+	"856": "LA", "870": "001", "878": "001", "880": "BD", "881": "001", "882": "001",
+	"883": "001", "886": "TW", "888": "001",
+	"960": "MV", "961": "LB", "962": "JO", "963": "SY", "964": "IQ", "965": "KW",
+	"966": "SA", "967": "YE", "968": "OM", "970": "PS", "971": "AE", "972": "IL",
+	"973": "BH", "974": "QA", "975": "BT", "976": "MN", "977": "NP", "979": "001",
+	"992": "TJ", "993": "TM", "994": "AZ", "995": "GE", "996": "KG", "998": "UZ",
+}
+
+// geoPrefixes assigns the prefixes of shared country calling codes to their
+// other countries: the area codes of the North American Numbering Plan outside
+// the US, and Kazakhstan.
+var geoPrefixes = map[string]string{
+	"1204": "CA", "1226": "CA", "1236": "CA", "1249": "CA", "1250": "CA", "1263": "CA",
+	"1289": "CA", "1306": "CA", "1343": "CA", "1354": "CA", "1365": "CA", "1367": "CA",
+	"1368": "CA", "1382": "CA", "1403": "CA", "1416": "CA", "1418": "CA", "1428": "CA",
+	"1431": "CA", "1437": "CA", "1438": "CA", "1450": "CA", "1468": "CA", "1474": "CA",
+	"1506": "CA", "1514": "CA", "1519": "CA", "1548": "CA", "1579": "CA", "1581": "CA",
+	"1584": "CA", "1587": "CA", "1604": "CA", "1613": "CA", "1639": "CA", "1647": "CA",
+	"1672": "CA", "1683": "CA", "1705": "CA", "1709": "CA", "1742": "CA", "1753": "CA",
+	"1778": "CA", "1780": "CA", "1782": "CA", "1807": "CA", "1819": "CA", "1825": "CA",
+	"1867": "CA", "1873": "CA", "1879": "CA", "1902": "CA", "1905": "CA",
+	"1242": "BS", "1246": "BB", "1264": "AI", "1268": "AG", "1284": "VG", "1340": "VI",
+	"1345": "KY", "1441": "BM", "1473": "GD", "1649": "TC", "1658": "JM", "1664": "MS",
+	"1670": "MP", "1671": "GU", "1684": "AS", "1721": "SX", "1758": "LC", "1767": "DM",
+	"1784": "VC", "1787": "PR", "1809": "DO", "1829": "DO", "1849": "DO", "1868": "TT",
+	"1869": "KN", "1876": "JM", "1939": "PR",
+	"76": "KZ", "77": "KZ",
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestGeographerLookup(t *testing.T) {
+	g, err := NewGeographer(GeographyConfig{
+		E164: &E164Normalizer{CountryCode: "1", NationalLength: 10, InternationalPrefix: "011"},
+		Regions: []GeographyRegion{
+			{Prefix: "+1415", Country: "US", Region: "CA"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create geographer: %s", err)
+	}
+
+	tests := map[string]*proxy.NumberGeography{
+		"+14155550100":    {Country: "US", CallingCode: "1", Region: "CA"},
+		"(212) 555-0100":  {Country: "US", CallingCode: "1"},
+		"6135550100":      {Country: "CA", CallingCode: "1"},
+		"18765550100":     {Country: "JM", CallingCode: "1"},
+		"011442079460000": {Country: "GB", CallingCode: "44"},
+		"+77012345678":    {Country: "KZ", CallingCode: "7"},
+		"+74951234567":    {Country: "RU", CallingCode: "7"},
+		"+353123456789":   {Country: "IE", CallingCode: "353"},
+		"+80012345678":    {Country: "001", CallingCode: "800"},
+		"1001":            nil,
+		"anonymous":       nil,
+		"+2801234567":     nil,
+	}
+	for number, expected := range tests {
+		g := g.Lookup(number)
+		switch {
+		case expected == nil && g != nil:
+			t.Errorf("%s: expected no geography, got %+v", number, g)
+		case expected != nil && (g == nil || *g != *expected):
+			t.Errorf("%s: expected %+v, got %+v", number, expected, g)
+		}
+	}
+}
+
+func TestNewGeographerInvalidRegions(t *testing.T) {
+	for name, r := range map[string]GeographyRegion{
+		"non-numeric prefix":   {Prefix: "1abc", Country: "US"},
+		"unknown calling code": {Prefix: "280", Country: "XX"},
+		"no country":           {Prefix: "1415"},
+	} {
+		if _, err := NewGeographer(GeographyConfig{Regions: []GeographyRegion{r}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAttachGeography(t *testing.T) {
+	g, err := NewGeographer(GeographyConfig{})
+	if err != nil {
+		t.Fatalf("failed to create geographer: %s", err)
+	}
+	s := &Server{Geography: g}
+
+	e := &ari.StasisStart{Channel: ari.ChannelData{ID: "ch1", Caller: &ari.CallerID{Number: "+33123456789"}}}
+	s.attachGeography(e)
+
+	geo := proxy.GetNumberGeography(&e.Channel)
+	if geo == nil || geo.Country != "FR" || geo.CallingCode != "33" || geo.Region != "" {
+		t.Errorf("unexpected geography: %+v", geo)
+	}
+
+	e = &ari.StasisStart{Channel: ari.ChannelData{ID: "ch2", Caller: &ari.CallerID{Number: "100"}}}
+	s.attachGeography(e)
+	if geo := proxy.GetNumberGeography(&e.Channel); geo != nil {
+		t.Errorf("expected no geography for extension, got %+v", geo)
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// Health describes the health of a running server
+type Health struct {
+	// Instance is the instance ID of the server
+	Instance string
+
+	// ARIConnected indicates that the ARI connection is up (and, if the
+	// keepalive is enabled, answering its pings)
+	ARIConnected bool
+
+	// NATSConnected indicates that the NATS connection is up
+	NATSConnected bool
+
+	// Ready indicates that the server has subscribed to its requests and is
+	// serving them (see Server.Ready)
+	Ready bool
+
+	// Draining indicates that the server is draining (see Maintenance), and
+	// rejects requests to create new calls
+	Draining bool
+
+	// PermissionViolations lists the NATS subjects which the server's NATS
+	// user was denied since the server started, in the order of their first
+	// violation.  A server whose user may not use its subjects silently
+	// fails to receive requests or deliver responses and events.
+	PermissionViolations []PermissionViolation
+
+	// PermissionViolationCount is the total number of NATS permissions
+	// violations reported since the server started
+	PermissionViolationCount int64
+
+	// ConflictingInstances lists the instance IDs of the other servers which
+	// recently announced themselves as serving the same application and node.
+	// Conflicts do not make the server unhealthy, as they concern the
+	// deployment rather than the server itself.
+	ConflictingInstances []string
+}
+
+// Healthy indicates whether the server is connected to ARI and has not been
+// denied the use of any NATS subject
+func (h Health) Healthy() bool {
+	return h.ARIConnected && h.PermissionViolationCount == 0
+}
+
+// Live indicates whether the server is connected to both ARI and NATS.  It is
+// the state reported by the /healthz endpoint.
+func (h Health) Live() bool {
+	return h.ARIConnected && h.NATSConnected
+}
+
+// Serving indicates whether the server is live, ready and not draining, and
+// so may be sent new calls.  It is the state reported by the /readyz
+// endpoint.
+func (h Health) Serving() bool {
+	return h.Live() && h.Ready && !h.Draining
+}
+
+// Health returns the current health of the server
+func (s *Server) Health() Health {
+	h := Health{Instance: s.InstanceID}
+	h.ARIConnected = s.ari != nil && s.ariConnected()
+	h.NATSConnected = s.nats != nil && s.nats.Conn.IsConnected()
+	h.Ready = s.isReady()
+	h.Draining = s.draining()
+	h.PermissionViolations, h.PermissionViolationCount = s.permissions.list()
+	h.ConflictingInstances = s.conflicts.active(s.clock().Now())
+	return h
+}
+
+// isReady indicates whether the ready channel of the server has been closed
+func (s *Server) isReady() bool {
+	if s.readyCh == nil {
+		return false
+	}
+	select {
+	case <-s.readyCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// HealthConfig describes the optional HTTP listener on which the liveness and
+// readiness of the server are exposed for orchestrators' probes
+type HealthConfig struct {
+	// Listen is the address on which to listen (e.g. ":8086" or
+	// "unix:/run/ari-proxy/health.sock")
+	Listen string `mapstructure:"listen"`
+
+	// LivenessPath is the path of the liveness probe.  It defaults to
+	// "/healthz".
+	LivenessPath string `mapstructure:"liveness_path"`
+
+	// ReadinessPath is the path of the readiness probe.  It defaults to
+	// "/readyz".
+	ReadinessPath string `mapstructure:"readiness_path"`
+}
+
+func (c *HealthConfig) validate() error {
+	if c.Listen == "" {
+		return eris.New("health endpoint requires a listen address")
+	}
+	for _, p := range []string{c.LivenessPath, c.ReadinessPath} {
+		if p != "" && !strings.HasPrefix(p, "/") {
+			return eris.Errorf("health path %q must start with a slash", p)
+		}
+	}
+	if c.LivenessPath != "" && c.LivenessPath == c.ReadinessPath {
+		return eris.New("liveness and readiness paths must differ")
+	}
+	return nil
+}
+
+// healthStatus is the body of the responses of the health endpoint
+type healthStatus struct {
+	Status        string `json:"status"`
+	Instance      string `json:"instance,omitempty"`
+	ARIConnected  bool   `json:"ari_connected"`
+	NATSConnected bool   `json:"nats_connected"`
+	Ready         bool   `json:"ready"`
+	Draining      bool   `json:"draining"`
+}
+
+// healthHandler returns the handler of a health probe, which responds with
+// 200 if the given check passes and 503 otherwise
+func (s *Server) healthHandler(check func(Health) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := s.Health()
+
+		status := healthStatus{
+			Status:        "ok",
+			Instance:      h.Instance,
+			ARIConnected:  h.ARIConnected,
+			NATSConnected: h.NATSConnected,
+			Ready:         h.Ready,
+			Draining:      h.Draining,
+		}
+		code := http.StatusOK
+		if !check(h) {
+			status.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status) // nolint: errcheck
+	}
+}
+
+// startHealth starts the health HTTP listener, which is stopped when the
+// context is closed
+func (s *Server) startHealth(ctx context.Context) error {
+	ln, err := listen(s.HealthEndpoint.Listen)
+	if err != nil {
+		return eris.Wrap(err, "failed to listen for health probes")
+	}
+
+	liveness := s.HealthEndpoint.LivenessPath
+	if liveness == "" {
+		liveness = "/healthz"
+	}
+	readiness := s.HealthEndpoint.ReadinessPath
+	if readiness == "" {
+		readiness = "/readyz"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(liveness, s.healthHandler(Health.Live))
+	mux.Handle(readiness, s.healthHandler(Health.Serving))
+
+	srv := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close() // nolint: errcheck
+	}()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.Log.Error("health endpoint failed", "error", err)
+		}
+	}()
+
+	return nil
+}
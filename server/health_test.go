@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	s := new(Server)
+	if h := s.Health(); h.Healthy() || h.ARIConnected {
+		t.Errorf("unexpected health of stopped server %+v", h)
+	}
+
+	if !(Health{ARIConnected: true}).Healthy() || (Health{ARIConnected: true, PermissionViolationCount: 1}).Healthy() {
+		t.Error("unexpected health")
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	live := Health{ARIConnected: true, NATSConnected: true}
+	if !live.Live() || live.Serving() {
+		t.Errorf("unexpected probes of unready server %+v", live)
+	}
+
+	ready := live
+	ready.Ready = true
+	if !ready.Serving() {
+		t.Errorf("unexpected readiness of ready server %+v", ready)
+	}
+
+	draining := ready
+	draining.Draining = true
+	if !draining.Live() || draining.Serving() {
+		t.Errorf("unexpected probes of draining server %+v", draining)
+	}
+
+	if (Health{ARIConnected: true, Ready: true}).Live() {
+		t.Error("server without NATS is live")
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	s := New()
+	close(s.readyCh)
+
+	for name, check := range map[string]func(Health) bool{
+		"liveness":  Health.Live,
+		"readiness": Health.Serving,
+	} {
+		w := httptest.NewRecorder()
+		s.healthHandler(check)(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: unexpected status %d of disconnected server", name, w.Code)
+		}
+
+		var status healthStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", name, err)
+		}
+		if status.Status != "unavailable" || !status.Ready || status.ARIConnected {
+			t.Errorf("%s: unexpected response %+v", name, status)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// contactTracker records the time of the last contact with Asterisk
+type contactTracker struct {
+	last time.Time
+	mu   sync.Mutex
+}
+
+func (c *contactTracker) touch(now time.Time) {
+	c.mu.Lock()
+	c.last = now
+	c.mu.Unlock()
+}
+
+func (c *contactTracker) get() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// runHeartbeat publishes a Heartbeat event every proxy.HeartbeatInterval
+func (s *Server) runHeartbeat(ctx context.Context) {
+	ticker := s.clock().NewTicker(proxy.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		s.publishEvent(s.newHeartbeat())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (s *Server) newHeartbeat() *proxy.Heartbeat {
+	_, violations := s.permissions.list()
+	return &proxy.Heartbeat{
+		EventData:            s.newEventData(proxy.EventHeartbeat),
+		StartedAt:            s.started,
+		Uptime:               s.clock().Now().Sub(s.started),
+		LastARIContact:       s.ariContact.get(),
+		Draining:             s.draining(),
+		PermissionViolations: violations,
+	}
+}
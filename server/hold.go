@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// holdState is the hold state of a channel
+type holdState struct {
+	held     bool
+	since    time.Time
+	mohClass string
+
+	// count is the number of times the channel has been held
+	count int
+
+	// total is the cumulative duration of the completed holds
+	total time.Duration
+}
+
+// holdTracker tracks the hold state of channels held by CallHold, indexed by
+// channel ID
+type holdTracker struct {
+	m  map[string]*holdState
+	mu sync.Mutex
+}
+
+// hold marks the channel as held.  It returns false if it already was.
+func (t *holdTracker) hold(id, mohClass string, now time.Time) (holdState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m == nil {
+		t.m = make(map[string]*holdState)
+	}
+	st, ok := t.m[id]
+	if !ok {
+		st = new(holdState)
+		t.m[id] = st
+	}
+	if st.held {
+		return *st, false
+	}
+
+	st.held = true
+	st.since = now
+	st.mohClass = mohClass
+	st.count++
+	return *st, true
+}
+
+// resume marks the channel as no longer held and returns the duration of the
+// hold.  It returns false if the channel was not held.
+func (t *holdTracker) resume(id string, now time.Time) (holdState, time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.m[id]
+	if !ok || !st.held {
+		return holdState{}, 0, false
+	}
+
+	d := now.Sub(st.since)
+	st.held = false
+	st.total += d
+	return *st, d, true
+}
+
+// cancel reverts a hold which could not be applied
+func (t *holdTracker) cancel(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if st, ok := t.m[id]; ok && st.held {
+		st.held = false
+		st.count--
+	}
+}
+
+// remove forgets the channel, returning its final state (and the duration of
+// the hold in progress, if any)
+func (t *holdTracker) remove(id string, now time.Time) (holdState, time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.m[id]
+	if !ok {
+		return holdState{}, 0, false
+	}
+	delete(t.m, id)
+
+	var d time.Duration
+	if st.held {
+		d = now.Sub(st.since)
+		st.total += d
+	}
+	return *st, d, true
+}
+
+func (s *Server) callHold(ctx context.Context, reply string, req *proxy.Request) {
+	mohClass := "default"
+	if req.CallHold != nil && req.CallHold.MOHClass != "" {
+		mohClass = req.CallHold.MOHClass
+	}
+
+	st, ok := s.holds.hold(req.Key.ID, mohClass, s.clock().Now())
+	if !ok {
+		s.sendError(reply, eris.New("channel is already on hold"))
+		return
+	}
+
+	if err := s.ari.Channel().Hold(req.Key); err != nil {
+		s.holds.cancel(req.Key.ID)
+		s.sendError(reply, eris.Wrap(err, "failed to hold channel"))
+		return
+	}
+	if err := s.ari.Channel().MOH(req.Key, mohClass); err != nil {
+		s.ari.Channel().StopHold(req.Key) // nolint: errcheck
+		s.holds.cancel(req.Key.ID)
+		s.sendError(reply, eris.Wrap(err, "failed to start music on hold"))
+		return
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	s.publishEvent(s.newHoldEvent(req.Key.ID, proxy.HoldStateHeld, "request", st, 0))
+
+	s.sendError(reply, nil)
+}
+
+func (s *Server) callResume(ctx context.Context, reply string, req *proxy.Request) {
+	st, d, ok := s.holds.resume(req.Key.ID, s.clock().Now())
+	if !ok {
+		s.sendError(reply, eris.New("channel is not on hold"))
+		return
+	}
+
+	err := s.ari.Channel().StopMOH(req.Key)
+	if err != nil {
+		err = eris.Wrap(err, "failed to stop music on hold")
+	}
+	if herr := s.ari.Channel().StopHold(req.Key); herr != nil && err == nil {
+		err = eris.Wrap(herr, "failed to retrieve channel from hold")
+	}
+
+	s.publishEvent(s.newHoldEvent(req.Key.ID, proxy.HoldStateResumed, "request", st, d))
+
+	s.sendError(reply, err)
+}
+
+// processHoldEvent ends the hold of channels which are destroyed while held
+func (s *Server) processHoldEvent(e ari.Event) {
+	v, ok := e.(*ari.ChannelDestroyed)
+	if !ok {
+		return
+	}
+
+	st, d, ok := s.holds.remove(v.Channel.ID, s.clock().Now())
+	if !ok || !st.held {
+		return
+	}
+
+	s.publishEvent(s.newHoldEvent(v.Channel.ID, proxy.HoldStateEnded, "hangup", st, d))
+}
+
+func (s *Server) newHoldEvent(id, state, reason string, st holdState, d time.Duration) *proxy.HoldStateChanged {
+	return &proxy.HoldStateChanged{
+		EventData:       s.newEventData(proxy.EventHoldStateChanged),
+		ChannelID:       id,
+		State:           state,
+		Reason:          reason,
+		MOHClass:        st.mohClass,
+		DurationMs:      int64(d / time.Millisecond),
+		HoldCount:       st.count,
+		TotalDurationMs: int64(st.total / time.Millisecond),
+	}
+}
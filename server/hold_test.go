@@ -0,0 +1,103 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestHoldTracker(t *testing.T) {
+	var tr holdTracker
+	now := time.Now()
+
+	if _, ok := tr.hold("c1", "default", now); !ok {
+		t.Fatal("failed to hold channel")
+	}
+	if _, ok := tr.hold("c1", "default", now); ok {
+		t.Error("channel should not be held twice")
+	}
+
+	st, d, ok := tr.resume("c1", now.Add(5*time.Second))
+	if !ok || d != 5*time.Second || st.count != 1 || st.total != 5*time.Second {
+		t.Errorf("unexpected resume: %+v %v (%v)", st, d, ok)
+	}
+	if _, _, ok := tr.resume("c1", now); ok {
+		t.Error("channel should not be resumed twice")
+	}
+
+	// A failed hold is not counted
+	tr.hold("c1", "jazz", now.Add(10*time.Second))
+	tr.cancel("c1")
+
+	tr.hold("c1", "jazz", now.Add(20*time.Second))
+	st, d, ok = tr.remove("c1", now.Add(23*time.Second))
+	if !ok || !st.held || d != 3*time.Second || st.count != 2 || st.total != 8*time.Second || st.mohClass != "jazz" {
+		t.Errorf("unexpected removal: %+v %v (%v)", st, d, ok)
+	}
+	if _, _, ok := tr.remove("c1", now); ok {
+		t.Error("channel should have been forgotten")
+	}
+}
+
+func TestHoldFlow(t *testing.T) {
+	fc := clock.NewFake(time.Unix(1600000000, 0))
+	ft := newFlowTest(t, WithClock(fc))
+	defer ft.Close()
+	ft.handleEvents(t)
+
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	ft.channel.On("Hold", key).Return(nil)
+	ft.channel.On("MOH", key, "jazz").Return(nil)
+	ft.channel.On("StopMOH", key).Return(nil)
+	ft.channel.On("StopHold", key).Return(nil)
+
+	holdEvent := func() *proxy.HoldStateChanged {
+		t.Helper()
+		e, ok := ft.event(t, proxy.EventHoldStateChanged).(*proxy.HoldStateChanged)
+		if !ok {
+			t.Fatal("unexpected event")
+		}
+		return e
+	}
+	hold := &proxy.Request{Kind: "CallHold", Key: key, CallHold: &proxy.CallHold{MOHClass: "jazz"}}
+
+	if err := ft.request(t, hold).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if e := holdEvent(); e.ChannelID != "c1" || e.State != proxy.HoldStateHeld || e.Reason != "request" || e.MOHClass != "jazz" || e.HoldCount != 1 {
+		t.Errorf("unexpected hold event: %+v", e)
+	}
+	if err := ft.request(t, hold).Err(); err == nil {
+		t.Error("channel held twice")
+	}
+
+	fc.Advance(5 * time.Second)
+	if err := ft.request(t, &proxy.Request{Kind: "CallResume", Key: key}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if e := holdEvent(); e.State != proxy.HoldStateResumed || e.DurationMs != 5000 || e.TotalDurationMs != 5000 {
+		t.Errorf("unexpected resume event: %+v", e)
+	}
+
+	// A channel which hangs up while on hold ends its hold
+	if err := ft.request(t, hold).Err(); err != nil {
+		t.Fatal(err)
+	}
+	holdEvent()
+	fc.Advance(3 * time.Second)
+	ft.send(&ari.ChannelDestroyed{
+		EventData: ari.EventData{Type: ari.Events.ChannelDestroyed},
+		Channel:   ari.ChannelData{ID: "c1"},
+	})
+	if e := holdEvent(); e.State != proxy.HoldStateEnded || e.Reason != "hangup" || e.DurationMs != 3000 || e.TotalDurationMs != 8000 || e.HoldCount != 2 {
+		t.Errorf("unexpected end event: %+v", e)
+	}
+
+	ft.channel.AssertNumberOfCalls(t, "Hold", 2)
+	ft.channel.AssertNumberOfCalls(t, "MOH", 2)
+	ft.channel.AssertNumberOfCalls(t, "StopMOH", 1)
+	ft.channel.AssertNumberOfCalls(t, "StopHold", 1)
+}
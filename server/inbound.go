@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// originatedChannels records the channels which the proxy creates itself, so
+// that their StasisStart events are not taken for those of inbound calls
+type originatedChannels struct {
+	ids map[string]struct{}
+	mu  sync.Mutex
+}
+
+func (o *originatedChannels) add(ids ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ids == nil {
+		o.ids = make(map[string]struct{})
+	}
+	for _, id := range ids {
+		if id != "" {
+			o.ids[id] = struct{}{}
+		}
+	}
+}
+
+func (o *originatedChannels) remove(id string) {
+	o.mu.Lock()
+	delete(o.ids, id)
+	o.mu.Unlock()
+}
+
+func (o *originatedChannels) has(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.ids[id]
+	return ok
+}
+
+// processOriginatedEvent forgets the originated channels which are destroyed
+func (s *Server) processOriginatedEvent(e ari.Event) {
+	if v, ok := e.(*ari.ChannelDestroyed); ok {
+		s.originated.remove(v.Channel.ID)
+	}
+}
+
+// isInbound indicates whether the StasisStart is that of an inbound call,
+// rather than that of a channel which the proxy created or of a channel
+// which replaces another
+func (s *Server) isInbound(e *ari.StasisStart) bool {
+	return e.ReplaceChannel.ID == "" && !s.originated.has(e.Channel.ID)
+}
+
+// preparesStarts indicates whether the StasisStarts of inbound calls are
+// prepared (looked up and screened) before they are published
+func (s *Server) preparesStarts() bool {
+	return len(s.Screeners) > 0 || s.CallerID != nil || s.StirShaken
+}
+
+// preparedStart is the StasisStart of an inbound call whose preparation
+// (attestation, caller ID lookup and screening) is complete
+type preparedStart struct {
+	event *ari.StasisStart
+
+	// publish indicates whether the event is to be published, or the call
+	// was removed from the application
+	publish bool
+}
+
+// pendingStarts holds the events of the inbound calls which are being
+// prepared off the event loop, so that the events of each channel are
+// published after its StasisStart.  It is owned by the event handler.
+type pendingStarts struct {
+	// held are the events held for each channel being prepared
+	held map[string][]ari.Event
+
+	// done receives the prepared StasisStarts
+	done chan *preparedStart
+}
+
+func newPendingStarts() *pendingStarts {
+	return &pendingStarts{
+		held: make(map[string][]ari.Event),
+		done: make(chan *preparedStart),
+	}
+}
+
+// start holds the events of the channel until its StasisStart is released
+func (p *pendingStarts) start(e *ari.StasisStart) {
+	p.held[e.Channel.ID] = nil
+}
+
+// hold holds the event if it concerns a channel being prepared, returning
+// whether it did
+func (p *pendingStarts) hold(e ari.Event) bool {
+	for _, k := range e.Keys() {
+		if k.Kind != ari.ChannelKey {
+			continue
+		}
+		if held, ok := p.held[k.ID]; ok {
+			p.held[k.ID] = append(held, e)
+			return true
+		}
+	}
+	return false
+}
+
+// release ends the holding of the events of the channel, returning them
+func (p *pendingStarts) release(id string) []ari.Event {
+	held := p.held[id]
+	delete(p.held, id)
+	return held
+}
+
+// prepareStart looks up and screens the inbound call off the event loop, then
+// hands its StasisStart back to the event handler
+func (s *Server) prepareStart(ctx context.Context, e *ari.StasisStart, done chan<- *preparedStart) {
+	s.attachAttestation(e)
+	s.attachCallerInfo(ctx, e)
+
+	r := &preparedStart{
+		event:   e,
+		publish: s.screen(ctx, e),
+	}
+	select {
+	case done <- r:
+	case <-ctx.Done():
+	}
+}
+
+// releaseStart delivers the prepared StasisStart, if the call remains in the
+// application, followed by the events which were held for its channel
+func (s *Server) releaseStart(ctx context.Context, p *pendingStarts, r *preparedStart) {
+	held := p.release(r.event.Channel.ID)
+	if r.publish {
+		s.deliverEvent(ctx, r.event)
+	}
+	for _, e := range held {
+		// An event may also concern another channel being prepared
+		if !p.hold(e) {
+			s.deliverEvent(ctx, e)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+func TestIsInbound(t *testing.T) {
+	s := new(Server)
+	in := &ari.StasisStart{Channel: ari.ChannelData{ID: "c1"}}
+	if !s.isInbound(in) {
+		t.Error("inbound call not recognized")
+	}
+
+	s.originated.add("c1", "")
+	if s.isInbound(in) {
+		t.Error("originated channel taken for an inbound call")
+	}
+	s.processOriginatedEvent(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c1"}})
+	if !s.isInbound(in) {
+		t.Error("destroyed originated channel not forgotten")
+	}
+
+	replacing := &ari.StasisStart{Channel: ari.ChannelData{ID: "c2"}, ReplaceChannel: ari.ChannelData{ID: "c3"}}
+	if s.isInbound(replacing) {
+		t.Error("replacing channel taken for an inbound call")
+	}
+}
+
+func TestPendingStarts(t *testing.T) {
+	p := newPendingStarts()
+	p.start(&ari.StasisStart{Channel: ari.ChannelData{ID: "c1"}})
+
+	varset := &ari.ChannelVarset{Channel: ari.ChannelData{ID: "c1"}, Variable: "X"}
+	other := &ari.ChannelVarset{Channel: ari.ChannelData{ID: "c2"}, Variable: "X"}
+	end := &ari.StasisEnd{Channel: ari.ChannelData{ID: "c1"}}
+	if !p.hold(varset) || p.hold(other) || !p.hold(end) {
+		t.Fatal("events not held by channel")
+	}
+
+	held := p.release("c1")
+	if len(held) != 2 || held[0] != varset || held[1] != end {
+		t.Errorf("unexpected held events: %v", held)
+	}
+	if p.hold(varset) {
+		t.Error("event held after release")
+	}
+}
+
+func TestScreenTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	s := &Server{
+		Log: log15.New(),
+		Screeners: []Screener{ScreenerFunc(func(ctx context.Context, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error) {
+			// A screener which ignores its deadline
+			<-block
+			return &ScreeningVerdict{Action: ScreenHangup}, nil
+		})},
+		ScreeningTimeout: 10 * time.Millisecond,
+	}
+	s.Log.SetHandler(log15.DiscardHandler())
+
+	start := time.Now()
+	if !s.screen(context.Background(), &ari.StasisStart{Channel: ari.ChannelData{ID: "c1"}}) {
+		t.Error("call not allowed after the screening timeout")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("screening took %s", d)
+	}
+}
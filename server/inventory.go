@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// inventory records the Asterisk version and the loaded channel drivers of
+// the node, which are announced so that clients may place calls on the nodes
+// with the capabilities they require
+type inventory struct {
+	asteriskVersion string
+	channelDrivers  []string
+
+	mu sync.RWMutex
+}
+
+func (inv *inventory) get() (version string, drivers []string) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	return inv.asteriskVersion, inv.channelDrivers
+}
+
+func (inv *inventory) setVersion(version string) {
+	inv.mu.Lock()
+	inv.asteriskVersion = version
+	inv.mu.Unlock()
+}
+
+func (inv *inventory) setChannelDrivers(drivers []string) {
+	inv.mu.Lock()
+	inv.channelDrivers = drivers
+	inv.mu.Unlock()
+}
+
+// channelDrivers returns the sorted names of the channel driver modules (e.g.
+// "chan_pjsip") among the given module names
+func channelDrivers(modules []string) (ret []string) {
+	for _, m := range modules {
+		m = strings.TrimSuffix(m, ".so")
+		if strings.HasPrefix(m, "chan_") {
+			ret = append(ret, m)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// refreshChannelDrivers updates the inventory of the channel drivers which
+// are loaded in Asterisk
+func (s *Server) refreshChannelDrivers() {
+	list, err := s.ari.Asterisk().Modules().List(nil)
+	if err != nil {
+		s.Log.Warn("failed to list Asterisk modules", "error", err)
+		return
+	}
+
+	names := make([]string, 0, len(list))
+	for _, k := range list {
+		names = append(names, k.ID)
+	}
+	s.inventory.setChannelDrivers(channelDrivers(names))
+}
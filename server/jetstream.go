@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JetStreamConfig describes the consumption of requests from a JetStream
+// stream, which gives them at-least-once semantics: each request is
+// acknowledged once it has been executed, so the requests in progress when a
+// proxy crashes are redelivered (to it or to another proxy) after AckWait.
+// The stream must already exist and capture the request subjects of the
+// classes (e.g. "ari.create.>" and "ari.command.>").  The server then no
+// longer receives these requests directly, and its clients must make them
+// through the stream (see client.WithJetStream), giving the subject of their
+// response in Request.ReplyTo.
+type JetStreamConfig struct {
+	// Stream is the name of the stream
+	Stream string `mapstructure:"stream"`
+
+	// Consumer is the prefix of the names of the durable consumers created
+	// on the stream, one for each request subject.  It defaults to
+	// DefaultJetStreamConsumer.
+	Consumer string `mapstructure:"consumer"`
+
+	// Classes is the list of request classes ("create" and/or "command")
+	// consumed from the stream.  It defaults to both.
+	Classes []string `mapstructure:"classes"`
+
+	// AckWait is the time within which a request must be executed, after
+	// which it is redelivered.  It defaults to DefaultJetStreamAckWait.
+	AckWait time.Duration `mapstructure:"ack_wait"`
+
+	// MaxDeliver is the maximum number of deliveries of each request.  Zero
+	// means unlimited.
+	MaxDeliver int `mapstructure:"max_deliver"`
+
+	// APIPrefix is the prefix of the subjects of the JetStream API.  It
+	// defaults to DefaultJetStreamAPIPrefix.
+	APIPrefix string `mapstructure:"api_prefix"`
+}
+
+// Defaults of the JetStreamConfig
+const (
+	DefaultJetStreamConsumer  = "ari-proxy"
+	DefaultJetStreamAckWait   = 30 * time.Second
+	DefaultJetStreamAPIPrefix = "$JS.API"
+)
+
+// jetStreamAPITimeout is the time allowed for requests to the JetStream API
+const jetStreamAPITimeout = 5 * time.Second
+
+// jetStreamDeliverPrefix prefixes the subjects to which the consumers
+// deliver requests
+const jetStreamDeliverPrefix = "_ARI_PROXY.deliver."
+
+// JetStream acknowledgments (see the JetStream wire API)
+var (
+	jetStreamAck  = []byte("+ACK")
+	jetStreamNak  = []byte("-NAK")
+	jetStreamTerm = []byte("+TERM")
+)
+
+func (cfg JetStreamConfig) validate() error {
+	if cfg.Stream == "" {
+		return eris.New("no JetStream stream")
+	}
+	for _, class := range cfg.Classes {
+		if class != "create" && class != "command" {
+			return eris.Errorf("cannot consume %q requests from JetStream", class)
+		}
+	}
+	if cfg.AckWait < 0 {
+		return eris.New("JetStream acknowledgment wait may not be negative")
+	}
+	if cfg.MaxDeliver < 0 {
+		return eris.New("JetStream maximum deliveries may not be negative")
+	}
+	return nil
+}
+
+func (cfg JetStreamConfig) withDefaults() JetStreamConfig {
+	if cfg.Consumer == "" {
+		cfg.Consumer = DefaultJetStreamConsumer
+	}
+	if len(cfg.Classes) == 0 {
+		cfg.Classes = []string{"create", "command"}
+	}
+	if cfg.AckWait == 0 {
+		cfg.AckWait = DefaultJetStreamAckWait
+	}
+	if cfg.APIPrefix == "" {
+		cfg.APIPrefix = DefaultJetStreamAPIPrefix
+	}
+	return cfg
+}
+
+// streamsClass indicates whether the requests of the given class are consumed
+// from JetStream, rather than received directly
+func (s *Server) streamsClass(class string) bool {
+	if s.JetStream == nil {
+		return false
+	}
+	for _, c := range s.JetStream.withDefaults().Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+var consumerNameRegex = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// streamConsumer is a durable consumer of the requests of one subject
+type streamConsumer struct {
+	Name    string
+	Subject string
+	Deliver string
+}
+
+// streamConsumers returns the consumers of the request subjects of the
+// streamed classes.  The consumers of the subjects shared by several servers
+// are shared by them, so that each request is delivered to one of them.
+func (s *Server) streamConsumers(cfg JetStreamConfig) (ret []streamConsumer) {
+	for _, class := range cfg.Classes {
+		scopes := [][2]string{{"", ""}, {s.Application, ""}}
+		if s.nodeID() != "" {
+			scopes = append(scopes, [2]string{s.Application, s.nodeID()})
+		}
+		for _, scope := range scopes {
+			name := cfg.Consumer + "_" + class
+			for _, part := range scope {
+				if part != "" {
+					name += "_" + part
+				}
+			}
+			name = consumerNameRegex.ReplaceAllString(name, "_")
+			ret = append(ret, streamConsumer{
+				Name:    name,
+				Subject: s.Subjects.Request(class, scope[0], scope[1]),
+				Deliver: jetStreamDeliverPrefix + name,
+			})
+		}
+	}
+	return ret
+}
+
+// consumerCreateRequest is the JetStream API request which creates a durable
+// push consumer
+type consumerCreateRequest struct {
+	Stream string         `json:"stream_name"`
+	Config consumerConfig `json:"config"`
+}
+
+type consumerConfig struct {
+	Durable       string `json:"durable_name"`
+	DeliverSubj   string `json:"deliver_subject"`
+	DeliverGroup  string `json:"deliver_group"`
+	DeliverPolicy string `json:"deliver_policy"`
+	AckPolicy     string `json:"ack_policy"`
+	AckWait       int64  `json:"ack_wait"`
+	MaxDeliver    int    `json:"max_deliver,omitempty"`
+	FilterSubject string `json:"filter_subject"`
+}
+
+// jetStreamError is the error of a JetStream API response, if any
+type jetStreamError struct {
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// createConsumer creates (or, if it exists with the same configuration,
+// reuses) the durable consumer of the given subject
+func (s *Server) createConsumer(cfg JetStreamConfig, c streamConsumer) error {
+	req := consumerCreateRequest{
+		Stream: cfg.Stream,
+		Config: consumerConfig{
+			Durable:       c.Name,
+			DeliverSubj:   c.Deliver,
+			DeliverGroup:  "ariproxy",
+			DeliverPolicy: "new",
+			AckPolicy:     "explicit",
+			AckWait:       int64(cfg.AckWait),
+			MaxDeliver:    cfg.MaxDeliver,
+			FilterSubject: c.Subject,
+		},
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.nats.Conn.Request(cfg.APIPrefix+".CONSUMER.DURABLE.CREATE."+cfg.Stream+"."+c.Name, data, jetStreamAPITimeout)
+	if err != nil {
+		return eris.Wrap(err, "JetStream API request failed")
+	}
+	var resp jetStreamError
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return eris.Wrap(err, "invalid JetStream API response")
+	}
+	if resp.Error != nil {
+		return eris.Errorf("JetStream error %d: %s", resp.Error.Code, resp.Error.Description)
+	}
+	return nil
+}
+
+// startJetStream creates the consumers of the streamed request classes and
+// subscribes to their deliveries
+func (s *Server) startJetStream(ctx context.Context, cg *closeGroup) error {
+	if s.JetStream == nil {
+		return nil
+	}
+	cfg := s.JetStream.withDefaults()
+	handler := s.newStreamHandler(ctx)
+
+	for _, c := range s.streamConsumers(cfg) {
+		if err := s.createConsumer(cfg, c); err != nil {
+			return eris.Wrapf(err, "failed to create JetStream consumer %s", c.Name)
+		}
+		sub, err := s.nats.Conn.QueueSubscribe(c.Deliver, "ariproxy", handler)
+		if err != nil {
+			return eris.Wrapf(err, "failed to subscribe to JetStream consumer %s", c.Name)
+		}
+		cg.Add("JetStream consumer "+c.Name, sub.Unsubscribe)
+	}
+	return nil
+}
+
+// newStreamHandler returns the handler of the requests delivered by
+// JetStream, which acknowledges each request once it has been executed.  The
+// requests which cannot be executed while ARI is disconnected are refused, so
+// that they are redelivered.
+func (s *Server) newStreamHandler(ctx context.Context) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		subject, ack := m.Subject, m.Reply
+		req, err := proxy.DecodeRequest(m.Data)
+		if err != nil || req.Kind == "" {
+			s.Log.Warn("discarding invalid streamed request", "subject", subject)
+			s.acknowledge(ack, jetStreamTerm)
+			return
+		}
+		if !s.ariConnected() {
+			s.acknowledge(ack, jetStreamNak)
+			return
+		}
+
+		reply := req.ReplyTo
+		if s.rejectDraining(subject, req) {
+			s.sendError(reply, proxy.ErrDraining)
+			s.acknowledge(ack, jetStreamAck)
+			return
+		}
+		if !s.supportedByAsterisk(req.Kind) {
+			s.sendError(reply, proxy.ErrNotSupportedByAsterisk)
+			s.acknowledge(ack, jetStreamAck)
+			return
+		}
+		// A stopping server refuses the request, so that it is redelivered
+		// to another server
+		if !s.requests.begin() {
+			s.acknowledge(ack, jetStreamNak)
+			return
+		}
+		go func() {
+			defer s.requests.end()
+			s.dispatchRequest(ctx, reply, req)
+			s.acknowledge(ack, jetStreamAck)
+		}()
+	}
+}
+
+// acknowledge sends the given acknowledgment of a streamed request
+func (s *Server) acknowledge(ack string, kind []byte) {
+	if ack == "" {
+		return
+	}
+	if err := s.nats.Conn.Publish(ack, kind); err != nil {
+		s.Log.Warn("failed to acknowledge streamed request", "ack", string(kind), "error", err)
+	}
+}
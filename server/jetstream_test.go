@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestJetStreamConfig(t *testing.T) {
+	for name, cfg := range map[string]JetStreamConfig{
+		"no stream":   {},
+		"get class":   {Stream: "ARI", Classes: []string{"get"}},
+		"ack wait":    {Stream: "ARI", AckWait: -1},
+		"max deliver": {Stream: "ARI", MaxDeliver: -1},
+	} {
+		if cfg.validate() == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	cfg := JetStreamConfig{Stream: "ARI"}.withDefaults()
+	if cfg.Consumer != DefaultJetStreamConsumer || len(cfg.Classes) != 2 || cfg.AckWait != DefaultJetStreamAckWait {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestStreamConsumers(t *testing.T) {
+	s := &Server{
+		Application: "app",
+		AsteriskID:  "00:11:22",
+		Subjects:    proxy.NewSubjectBuilder("ari."),
+		JetStream:   &JetStreamConfig{Stream: "ARI", Classes: []string{"command"}},
+	}
+	if !s.streamsClass("command") || s.streamsClass("create") {
+		t.Error("unexpected streamed classes")
+	}
+
+	consumers := s.streamConsumers(s.JetStream.withDefaults())
+	if len(consumers) != 3 {
+		t.Fatalf("unexpected consumers %v", consumers)
+	}
+	c := consumers[2]
+	if c.Name != "ari-proxy_command_app_00_11_22" || c.Subject != "ari.command.app.00:11:22" || c.Deliver != "_ARI_PROXY.deliver.ari-proxy_command_app_00_11_22" {
+		t.Errorf("unexpected consumer %+v", c)
+	}
+
+	// The server subscribes to the deliveries instead of the requests
+	for _, r := range s.requiredSubjects("tok") {
+		if r.Subject == "ari.command.app.00:11:22" {
+			t.Error("streamed request subject is required")
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// ErrARIKeepaliveTimeout indicates that the server stopped because the ARI
+// WebSocket stopped delivering the answers to its keepalive pings
+var ErrARIKeepaliveTimeout = eris.New("ARI keepalive timed out")
+
+// KeepaliveConfig describes the keepalive of the ARI WebSocket.  A silently
+// dead connection (e.g. one dropped by a NAT or firewall) is not noticed by
+// TCP for many minutes, during which no events are received.  The keepalive
+// pings Asterisk by toggling the state of a Stasis device to which the
+// application is subscribed, and the resulting DeviceStateChanged event is the
+// pong, which must arrive over the WebSocket before the next ping.
+type KeepaliveConfig struct {
+	// Interval is the time between pings.  It defaults to
+	// DefaultKeepaliveInterval.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// MaxMissed is the number of consecutive pings which may go unanswered
+	// before the connection is considered dead and the server stops with
+	// ErrARIKeepaliveTimeout, so that it may be restarted.  From the first
+	// unanswered ping, the server rejects requests as if ARI were
+	// disconnected.  It defaults to DefaultKeepaliveMaxMissed.
+	MaxMissed int `mapstructure:"max_missed"`
+}
+
+// Defaults of the KeepaliveConfig
+const (
+	DefaultKeepaliveInterval  = 5 * time.Second
+	DefaultKeepaliveMaxMissed = 2
+)
+
+func (cfg KeepaliveConfig) withDefaults() KeepaliveConfig {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultKeepaliveInterval
+	}
+	if cfg.MaxMissed <= 0 {
+		cfg.MaxMissed = DefaultKeepaliveMaxMissed
+	}
+	return cfg
+}
+
+// keepaliveDevicePrefix prefixes the name of the Stasis device whose state
+// is toggled by the keepalive
+const keepaliveDevicePrefix = "Stasis:ari-proxy-keepalive-"
+
+// Device states alternated by the keepalive pings, so that each ping changes
+// the state and hence emits an event
+var keepaliveStates = [2]string{"NOT_INUSE", "INUSE"}
+
+// keepaliveTracker tracks the pings and pongs of the keepalive
+type keepaliveTracker struct {
+	device string
+
+	// count is the number of pings sent
+	count int
+
+	// pending indicates that the last ping has not been answered
+	pending bool
+
+	// missed is the number of consecutive pings which went unanswered
+	missed int
+
+	mu sync.Mutex
+}
+
+// ping records a ping, returning the device state to set and the number of
+// consecutive pings which went unanswered
+func (k *keepaliveTracker) ping() (state string, missed int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.pending {
+		k.missed++
+	}
+	k.pending = true
+	k.count++
+	return keepaliveStates[k.count%2], k.missed
+}
+
+// pong records the change of the device to the given state, returning whether
+// it answered the last ping after others had been missed
+func (k *keepaliveTracker) pong(state string) (recovered bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if !k.pending || state != keepaliveStates[k.count%2] {
+		return false
+	}
+	recovered = k.missed > 0
+	k.pending = false
+	k.missed = 0
+	return recovered
+}
+
+// reset forgets the pings sent so far, once a new connection is established
+func (k *keepaliveTracker) reset() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pending = false
+	k.missed = 0
+}
+
+// healthy indicates that no ping has been missed
+func (k *keepaliveTracker) healthy() bool {
+	if k == nil {
+		return true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.missed == 0
+}
+
+// newKeepaliveTracker returns the tracker of the keepalive of the application,
+// or nil if the keepalive is not enabled
+func newKeepaliveTracker(cfg *KeepaliveConfig, application string) *keepaliveTracker {
+	if cfg == nil {
+		return nil
+	}
+	return &keepaliveTracker{device: keepaliveDevicePrefix + application}
+}
+
+// subscribeKeepalive subscribes the application to the keepalive device, once
+// per ARI connection
+func (s *Server) subscribeKeepalive() error {
+	device := s.keepalive.device
+	deviceKey := ari.NewKey(ari.DeviceStateKey, device)
+	appKey := ari.NewKey(ari.ApplicationKey, s.Application)
+
+	// Clear any state left by a previous run, so that the first ping changes
+	// the state of the device
+	s.ari.DeviceState().Delete(deviceKey) // nolint: errcheck
+
+	if err := s.ari.Application().Subscribe(appKey, "deviceState:"+device); err != nil {
+		return eris.Wrap(err, "failed to subscribe to keepalive device")
+	}
+	return nil
+}
+
+// startKeepalive subscribes the application to the keepalive device and runs
+// the keepalive, if it is enabled
+func (s *Server) startKeepalive(ctx context.Context, cg *closeGroup) error {
+	if s.keepalive == nil {
+		return nil
+	}
+	cfg := s.Keepalive.withDefaults()
+
+	device := s.keepalive.device
+	deviceKey := ari.NewKey(ari.DeviceStateKey, device)
+	appKey := ari.NewKey(ari.ApplicationKey, s.Application)
+	source := "deviceState:" + device
+
+	if err := s.subscribeKeepalive(); err != nil {
+		return err
+	}
+	cg.Add("ARI keepalive", func() error {
+		if err := s.ari.Application().Unsubscribe(appKey, source); err != nil {
+			return err
+		}
+		return s.ari.DeviceState().Delete(deviceKey)
+	})
+
+	go s.runKeepalive(ctx, cfg, deviceKey)
+	return nil
+}
+
+// runKeepalive pings Asterisk at the configured interval, stopping the server
+// once too many pings go unanswered
+func (s *Server) runKeepalive(ctx context.Context, cfg KeepaliveConfig, key *ari.Key) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		state, missed := s.keepalive.ping()
+		if missed >= cfg.MaxMissed {
+			s.Log.Error("ARI keepalive timed out", "missed", missed)
+			s.ariLost(ErrARIKeepaliveTimeout)
+			if s.reconnector == nil {
+				return
+			}
+			continue
+		}
+		if missed > 0 {
+			s.Log.Warn("ARI keepalive missed; rejecting requests", "missed", missed)
+		}
+
+		if err := s.ari.DeviceState().Update(key, state); err != nil {
+			s.Log.Warn("failed to send ARI keepalive", "error", err)
+		}
+	}
+}
+
+// processKeepaliveEvent records the pongs of the keepalive, returning whether
+// the event was a pong, which is not published
+func (s *Server) processKeepaliveEvent(e ari.Event) bool {
+	v, ok := e.(*ari.DeviceStateChanged)
+	if !ok || s.keepalive == nil || v.DeviceState.Name != s.keepalive.device {
+		return false
+	}
+	if s.keepalive.pong(v.DeviceState.State) {
+		s.Log.Info("ARI keepalive recovered")
+	}
+	return true
+}
+
+// ariConnected indicates whether the ARI connection is up and, if the
+// keepalive is enabled, answering its pings
+func (s *Server) ariConnected() bool {
+	return s.ari.Connected() && s.keepalive.healthy()
+}
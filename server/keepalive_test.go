@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestKeepaliveTracker(t *testing.T) {
+	k := newKeepaliveTracker(new(KeepaliveConfig), "app")
+
+	state, missed := k.ping()
+	if missed != 0 {
+		t.Fatalf("missed %d pings on first ping", missed)
+	}
+	k.pong(keepaliveStates[0])
+	if !k.pending {
+		t.Error("pong of an unexpected state accepted")
+	}
+	if k.pong(state) || k.pending || !k.healthy() {
+		t.Error("pong of healthy keepalive not accepted")
+	}
+
+	// Unanswered pings are counted until a pong arrives
+	k.ping()
+	state, missed = k.ping()
+	if missed != 1 || k.healthy() {
+		t.Errorf("missed %d pings, healthy %v", missed, k.healthy())
+	}
+	if _, missed = k.ping(); missed != 2 {
+		t.Errorf("missed %d pings", missed)
+	}
+	if k.pong(state) {
+		t.Error("pong of an earlier ping accepted")
+	}
+
+	state, _ = k.ping()
+	if !k.pong(state) || !k.healthy() {
+		t.Error("failed to recover")
+	}
+}
+
+func TestProcessKeepaliveEvent(t *testing.T) {
+	s := &Server{keepalive: newKeepaliveTracker(new(KeepaliveConfig), "app")}
+	state, _ := s.keepalive.ping()
+
+	other := &ari.DeviceStateChanged{DeviceState: ari.DeviceStateData{Name: "Stasis:other", State: state}}
+	if s.processKeepaliveEvent(other) || s.processKeepaliveEvent(&ari.StasisStart{}) {
+		t.Error("withheld event of another device")
+	}
+
+	pong := &ari.DeviceStateChanged{DeviceState: ari.DeviceStateData{Name: keepaliveDevicePrefix + "app", State: state}}
+	if !s.processKeepaliveEvent(pong) {
+		t.Error("published keepalive pong")
+	}
+
+	if (&Server{}).processKeepaliveEvent(pong) {
+		t.Error("withheld event without keepalive")
+	}
+}
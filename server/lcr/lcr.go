@@ -0,0 +1,164 @@
+// Package lcr provides least-cost routing for ARI proxy originations.  A rate
+// table maps destination prefixes to trunks and their costs; for each
+// destination, the table yields the available trunks ordered from cheapest to
+// most expensive, which the server attempts in turn.
+package lcr
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultEndpointTemplate is the endpoint template used for rates which do not
+// define their own.  `{number}` is replaced by the dialed number and `{trunk}`
+// by the trunk name.
+var DefaultEndpointTemplate = "PJSIP/{number}@{trunk}"
+
+// Rate is a single entry of the rate table
+type Rate struct {
+	// Prefix is the destination number prefix to which this rate applies
+	Prefix string
+
+	// Trunk is the name of the trunk (carrier)
+	Trunk string
+
+	// Rate is the cost of calls to the prefix over the trunk
+	Rate float64
+
+	// Endpoint is the endpoint template for calls over this trunk.  If empty,
+	// DefaultEndpointTemplate is used.
+	Endpoint string
+}
+
+// Table is a least-cost routing rate table.  It is safe for concurrent use.
+type Table struct {
+	rates []Rate
+
+	unavailable map[string]bool
+
+	mu sync.RWMutex
+}
+
+// New returns a new Table with the given rates
+func New(rates []Rate) *Table {
+	t := &Table{
+		unavailable: make(map[string]bool),
+	}
+	t.Load(rates)
+	return t
+}
+
+// Load replaces the rates of the table.  This allows rates to be sourced from
+// databases or other external systems.
+func (t *Table) Load(rates []Rate) {
+	list := make([]Rate, len(rates))
+	copy(list, rates)
+
+	t.mu.Lock()
+	t.rates = list
+	t.mu.Unlock()
+}
+
+// LoadCSV replaces the rates of the table with those read from the given CSV
+// data.  Each record has the columns `prefix,trunk,rate[,endpoint]`.  Empty
+// lines and lines beginning with `#` are ignored.
+func (t *Table) LoadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var rates []Rate
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return eris.Wrap(err, "failed to read rate table")
+		}
+		if len(rec) < 3 {
+			return eris.Errorf("invalid rate record %v: expected at least 3 fields", rec)
+		}
+
+		cost, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return eris.Wrapf(err, "invalid rate for prefix %s on trunk %s", rec[0], rec[1])
+		}
+
+		rate := Rate{
+			Prefix: rec[0],
+			Trunk:  rec[1],
+			Rate:   cost,
+		}
+		if len(rec) > 3 {
+			rate.Endpoint = rec[3]
+		}
+		rates = append(rates, rate)
+	}
+
+	t.Load(rates)
+	return nil
+}
+
+// SetAvailable marks a trunk as available or unavailable.  Unavailable trunks
+// are excluded from routing.
+func (t *Table) SetAvailable(trunk string, available bool) {
+	t.mu.Lock()
+	if available {
+		delete(t.unavailable, trunk)
+	} else {
+		t.unavailable[trunk] = true
+	}
+	t.mu.Unlock()
+}
+
+// Route returns the available routes for the given number, ordered from
+// cheapest to most expensive.  For each trunk, the rate with the longest
+// matching prefix is used.
+func (t *Table) Route(number string, req *proxy.Request) ([]proxy.Route, error) {
+	lookup := strings.TrimPrefix(number, "+")
+
+	t.mu.RLock()
+	best := make(map[string]Rate)
+	for _, r := range t.rates {
+		if t.unavailable[r.Trunk] || !strings.HasPrefix(lookup, strings.TrimPrefix(r.Prefix, "+")) {
+			continue
+		}
+		if cur, ok := best[r.Trunk]; !ok || len(r.Prefix) > len(cur.Prefix) {
+			best[r.Trunk] = r
+		}
+	}
+	t.mu.RUnlock()
+
+	routes := make([]proxy.Route, 0, len(best))
+	for _, r := range best {
+		tmpl := r.Endpoint
+		if tmpl == "" {
+			tmpl = DefaultEndpointTemplate
+		}
+
+		routes = append(routes, proxy.Route{
+			Endpoint: strings.NewReplacer("{number}", number, "{trunk}", r.Trunk).Replace(tmpl),
+			Trunk:    r.Trunk,
+			Prefix:   r.Prefix,
+			Rate:     r.Rate,
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Rate == routes[j].Rate {
+			return routes[i].Trunk < routes[j].Trunk
+		}
+		return routes[i].Rate < routes[j].Rate
+	})
+
+	return routes, nil
+}
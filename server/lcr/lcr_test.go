@@ -0,0 +1,81 @@
+package lcr
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRates = `# prefix,trunk,rate,endpoint
+1,carrierA,0.010
+1,carrierB,0.008
+1800,carrierA,0.000
+44,carrierB,0.020,SIP/carrierB/{number}
+`
+
+func TestRoute(t *testing.T) {
+	table := New(nil)
+	if err := table.LoadCSV(strings.NewReader(testRates)); err != nil {
+		t.Fatalf("failed to load rates: %s", err)
+	}
+
+	routes, err := table.Route("+15555551212", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("incorrect number of routes: %d != 2", len(routes))
+	}
+	if routes[0].Trunk != "carrierB" || routes[1].Trunk != "carrierA" {
+		t.Errorf("incorrect route order: %v", routes)
+	}
+	if routes[0].Endpoint != "PJSIP/+15555551212@carrierB" {
+		t.Errorf("incorrect endpoint: %s", routes[0].Endpoint)
+	}
+
+	// Longest prefix wins per trunk
+	routes, _ = table.Route("18005551212", nil)
+	if len(routes) != 2 || routes[0].Trunk != "carrierA" || routes[0].Prefix != "1800" {
+		t.Errorf("incorrect longest-prefix routing: %v", routes)
+	}
+
+	routes, _ = table.Route("442079460000", nil)
+	if len(routes) != 1 || routes[0].Endpoint != "SIP/carrierB/442079460000" {
+		t.Errorf("incorrect templated routing: %v", routes)
+	}
+
+	routes, _ = table.Route("33123456789", nil)
+	if len(routes) != 0 {
+		t.Errorf("expected no routes: %v", routes)
+	}
+}
+
+func TestAvailability(t *testing.T) {
+	table := New([]Rate{
+		{Prefix: "1", Trunk: "carrierA", Rate: 0.01},
+		{Prefix: "1", Trunk: "carrierB", Rate: 0.02},
+	})
+
+	table.SetAvailable("carrierA", false)
+
+	routes, _ := table.Route("15555551212", nil)
+	if len(routes) != 1 || routes[0].Trunk != "carrierB" {
+		t.Errorf("unavailable trunk was routed: %v", routes)
+	}
+
+	table.SetAvailable("carrierA", true)
+
+	routes, _ = table.Route("15555551212", nil)
+	if len(routes) != 2 || routes[0].Trunk != "carrierA" {
+		t.Errorf("restored trunk was not routed: %v", routes)
+	}
+}
+
+func TestLoadCSVInvalid(t *testing.T) {
+	table := New(nil)
+	if err := table.LoadCSV(strings.NewReader("1,carrierA,cheap\n")); err == nil {
+		t.Error("expected error for invalid rate")
+	}
+	if err := table.LoadCSV(strings.NewReader("1,carrierA\n")); err == nil {
+		t.Error("expected error for short record")
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rotisserie/eris"
+)
+
+// unixListenPrefix prefixes the listen addresses of the HTTP endpoints which
+// are Unix domain sockets (e.g. "unix:/run/ari-proxy/health.sock"), which
+// co-located agents may use instead of a TCP port.  Unix domain sockets are
+// supported on Linux, macOS and Windows 10 or later.
+const unixListenPrefix = "unix:"
+
+// listen listens on the given address of an HTTP endpoint: a TCP address
+// (e.g. ":8086") or a Unix domain socket path prefixed by "unix:".  A stale
+// socket file left by a previous run is replaced.
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixListenPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixListenPrefix)
+	if path == "" {
+		return nil, eris.New("no Unix domain socket path")
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, eris.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, eris.Wrap(err, "failed to remove stale socket")
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix domain sockets depend on the Windows version")
+	}
+
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "health.sock")
+
+	ln, err := listen(unixListenPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln.Addr().Network() != "unix" {
+		t.Errorf("unexpected network %s", ln.Addr().Network())
+	}
+
+	// A stale socket is replaced, but not another file
+	if ln, err = listen(unixListenPrefix + path); err != nil {
+		t.Fatalf("failed to replace stale socket: %v", err)
+	}
+	ln.Close() // nolint: errcheck
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(unixListenPrefix + file); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+}
+
+func TestAtomicAlignment(t *testing.T) {
+	// The counters which are accessed atomically must be 64-bit aligned on
+	// 32-bit platforms, where only the start of an allocated struct is
+	var s Server
+	for name, off := range map[string]uintptr{
+		"eventSeq":           unsafe.Offsetof(s.eventSeq),
+		"natsErrors":         unsafe.Offsetof(s.metrics) + unsafe.Offsetof(s.metrics.natsErrors),
+		"chunkedResponses":   unsafe.Offsetof(s.metrics) + unsafe.Offsetof(s.metrics.chunkedResponses),
+		"oversizedResponses": unsafe.Offsetof(s.metrics) + unsafe.Offsetof(s.metrics.oversizedResponses),
+		"filteredVarsets":    unsafe.Offsetof(s.metrics) + unsafe.Offsetof(s.metrics.filteredVarsets),
+	} {
+		if off%8 != 0 {
+			t.Errorf("%s is not 64-bit aligned (offset %d)", name, off)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// localPairResolver resolves Local channel pairs from a snapshot of the
+// channels and bridges of the node
+type localPairResolver struct {
+	byID      map[string]*ari.ChannelData
+	byName    map[string]*ari.ChannelData
+	bridgesOf map[string][]*ari.BridgeData
+
+	// bridgePeer returns the value of the BRIDGEPEER variable of the given
+	// channel, which lists the names of the channels to which it is bridged
+	// by the dialplan
+	bridgePeer func(id string) string
+}
+
+func newLocalPairResolver(channels []*ari.ChannelData, bridges []*ari.BridgeData, bridgePeer func(id string) string) *localPairResolver {
+	r := &localPairResolver{
+		byID:       make(map[string]*ari.ChannelData, len(channels)),
+		byName:     make(map[string]*ari.ChannelData, len(channels)),
+		bridgesOf:  make(map[string][]*ari.BridgeData),
+		bridgePeer: bridgePeer,
+	}
+	for _, c := range channels {
+		r.byID[c.ID] = c
+		r.byName[c.Name] = c
+	}
+	for _, b := range bridges {
+		for _, id := range b.ChannelIDs {
+			r.bridgesOf[id] = append(r.bridgesOf[id], b)
+		}
+	}
+	return r
+}
+
+// peer returns the channel to which the given channel is bridged, if any,
+// preferring its BRIDGEPEER (set by the dialplan) to the bridges of the node
+func (r *localPairResolver) peer(c *ari.ChannelData) *ari.ChannelData {
+	for _, name := range strings.Split(r.bridgePeer(c.ID), ",") {
+		if p, ok := r.byName[strings.TrimSpace(name)]; ok && p.ID != c.ID {
+			return p
+		}
+	}
+
+	// A bridge of two channels (e.g. one created by ARI)
+	for _, b := range r.bridgesOf[c.ID] {
+		if len(b.ChannelIDs) != 2 {
+			continue
+		}
+		for _, id := range b.ChannelIDs {
+			if p, ok := r.byID[id]; ok && id != c.ID {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// pair describes the Local channel pair of which the given channel is a half
+func (r *localPairResolver) pair(c *ari.ChannelData) *proxy.LocalChannelPair {
+	base := c.Name[:len(c.Name)-len(";1")]
+	ret := &proxy.LocalChannelPair{Name: base}
+	if one, ok := r.byName[base+";1"]; ok {
+		ret.One = one.ID
+	}
+	if two, ok := r.byName[base+";2"]; ok {
+		ret.Two = two.ID
+		if p := r.peer(two); p != nil {
+			ret.Peer = p.ID
+			ret.PeerName = p.Name
+		}
+	}
+	return ret
+}
+
+// resolve describes the Local channel pair of the given channel, which may
+// be either half of a Local channel or the channel behind its ;2 half
+func (r *localPairResolver) resolve(id string) (*proxy.LocalChannelPair, error) {
+	c, ok := r.byID[id]
+	if !ok {
+		return nil, proxy.ErrNotFound
+	}
+	if localPartnerName(c.Name) != "" {
+		return r.pair(c), nil
+	}
+
+	for _, two := range r.byID {
+		if !strings.HasPrefix(two.Name, "Local/") || !strings.HasSuffix(two.Name, ";2") {
+			continue
+		}
+		if p := r.peer(two); p != nil && p.ID == id {
+			return r.pair(two), nil
+		}
+	}
+	return nil, eris.Errorf("channel %s is neither a Local channel nor bridged to one", id)
+}
+
+func (s *Server) channelLocalPair(ctx context.Context, reply string, req *proxy.Request) {
+	if _, err := s.ari.Channel().Data(req.Key); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	channels, bridges, err := s.snapshotTopology()
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	r := newLocalPairResolver(channels, bridges, func(id string) string {
+		// Channels which are not bridged by the dialplan have no BRIDGEPEER
+		v, err := s.ari.Channel().GetVariable(ari.NewKey(ari.ChannelKey, id), "BRIDGEPEER")
+		if err != nil {
+			return ""
+		}
+		return v
+	})
+
+	pair, err := r.resolve(req.Key.ID)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key,
+		Data: &proxy.EntityData{
+			LocalPair: pair,
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestResolveLocalPair(t *testing.T) {
+	channels := []*ari.ChannelData{
+		{ID: "one", Name: "Local/200@default-00000002;1"},
+		{ID: "two", Name: "Local/200@default-00000002;2"},
+		{ID: "callee", Name: "PJSIP/200-00000003"},
+		{ID: "other", Name: "PJSIP/300-00000004"},
+		{ID: "lone", Name: "Local/300@default-00000005;1"},
+		{ID: "lone2", Name: "Local/300@default-00000005;2"},
+	}
+	peers := map[string]string{"two": "PJSIP/200-00000003"}
+	r := newLocalPairResolver(channels, nil, func(id string) string { return peers[id] })
+
+	want := proxy.LocalChannelPair{
+		One:      "one",
+		Two:      "two",
+		Name:     "Local/200@default-00000002",
+		Peer:     "callee",
+		PeerName: "PJSIP/200-00000003",
+	}
+	for _, id := range []string{"one", "two", "callee"} {
+		pair, err := r.resolve(id)
+		if err != nil {
+			t.Errorf("failed to resolve pair of %s: %v", id, err)
+			continue
+		}
+		if *pair != want {
+			t.Errorf("unexpected pair of %s: %+v", id, pair)
+		}
+	}
+
+	pair, err := r.resolve("lone")
+	if err != nil || pair.Two != "lone2" || pair.Peer != "" {
+		t.Errorf("unexpected pair of unbridged Local channel: %+v, %v", pair, err)
+	}
+
+	if _, err := r.resolve("other"); err == nil {
+		t.Error("resolved pair of unrelated channel")
+	}
+	if _, err := r.resolve("gone"); err != proxy.ErrNotFound {
+		t.Errorf("unexpected error for missing channel: %v", err)
+	}
+}
+
+func TestResolveLocalPairFromBridge(t *testing.T) {
+	channels := []*ari.ChannelData{
+		{ID: "one", Name: "Local/200@default-00000002;1"},
+		{ID: "two", Name: "Local/200@default-00000002;2"},
+		{ID: "callee", Name: "PJSIP/200-00000003"},
+	}
+	bridges := []*ari.BridgeData{{ID: "b1", ChannelIDs: []string{"two", "callee"}}}
+	r := newLocalPairResolver(channels, bridges, func(string) string { return "" })
+
+	pair, err := r.resolve("callee")
+	if err != nil || pair.One != "one" || pair.Peer != "callee" {
+		t.Errorf("unexpected pair: %+v, %v", pair, err)
+	}
+}
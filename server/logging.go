@@ -13,9 +13,7 @@ func (s *Server) asteriskLoggingList(ctx context.Context, reply string, req *pro
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) asteriskLoggingGet(ctx context.Context, reply string, req *proxy.Request) {
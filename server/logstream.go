@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// LogStreamConfig describes the configuration of the log stream module.  A
+// log stream creates an Asterisk logging channel, which Asterisk writes as a
+// file in its log directory, and tails that file, publishing each line on a
+// NATS subject (see proxy.LogStreamSubject).  The proxy must therefore share
+// the log directory of Asterisk (e.g. by running on the same host).
+type LogStreamConfig struct {
+	// LogDir is the Asterisk log directory (astlogdir).  It defaults to
+	// DefaultLogDir.
+	LogDir string `mapstructure:"log_dir"`
+
+	// MaxDuration is the time after which a log stream is stopped, so that a
+	// stream whose client has gone away does not run forever.  It defaults
+	// to DefaultLogStreamMaxDuration.
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+}
+
+// DefaultLogDir is the default Asterisk log directory
+const DefaultLogDir = "/var/log/asterisk"
+
+// DefaultLogStreamMaxDuration is the default maximum duration of a log stream
+const DefaultLogStreamMaxDuration = time.Hour
+
+// DefaultLogStreamLevels is the default set of logging levels of a log stream
+const DefaultLogStreamLevels = "notice,warning,error"
+
+// LogStreamPollInterval is the interval at which the files of log streams are
+// checked for new lines
+var LogStreamPollInterval = 250 * time.Millisecond
+
+// maxLogLineLength is the length at which an unterminated log line is
+// published as it is
+const maxLogLineLength = 64 * 1024
+
+// logLevels is the set of Asterisk logging levels which may be streamed
+var logLevels = map[string]bool{
+	"debug":    true,
+	"dtmf":     true,
+	"error":    true,
+	"fax":      true,
+	"notice":   true,
+	"security": true,
+	"verbose":  true,
+	"warning":  true,
+}
+
+// validateLogLevels checks a comma-separated list of logging levels
+func validateLogLevels(levels string) error {
+	for _, l := range strings.Split(levels, ",") {
+		if !logLevels[strings.TrimSpace(l)] {
+			return eris.Errorf("invalid logging level %q", l)
+		}
+	}
+	return nil
+}
+
+// logTailer reads the lines which are appended to a file.  The file need not
+// exist yet, as Asterisk only creates it once it writes the first line, and
+// it may be truncated or replaced (e.g. by log rotation).
+type logTailer struct {
+	path string
+
+	f       *os.File
+	offset  int64
+	partial []byte
+}
+
+// poll returns the complete lines which have been appended to the file since
+// the last poll
+func (t *logTailer) poll() ([]string, error) {
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to stat log file")
+	}
+
+	if t.f != nil {
+		if cur, err := t.f.Stat(); err != nil || !os.SameFile(cur, info) {
+			t.reset()
+		}
+	}
+	if t.f == nil {
+		if t.f, err = os.Open(t.path); err != nil {
+			return nil, eris.Wrap(err, "failed to open log file")
+		}
+	}
+	if info.Size() < t.offset {
+		// Truncated
+		t.offset = 0
+		t.partial = nil
+	}
+	if info.Size() == t.offset {
+		return nil, nil
+	}
+
+	buf := make([]byte, info.Size()-t.offset)
+	n, err := t.f.ReadAt(buf, t.offset)
+	if err != nil && err != io.EOF {
+		return nil, eris.Wrap(err, "failed to read log file")
+	}
+	t.offset += int64(n)
+
+	data := append(t.partial, buf[:n]...)
+	t.partial = nil
+
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	if len(data) >= maxLogLineLength {
+		lines = append(lines, string(data))
+		data = nil
+	}
+	if len(data) > 0 {
+		t.partial = append([]byte(nil), data...)
+	}
+	return lines, nil
+}
+
+// reset closes the file, so that it is reopened from the start by the next
+// poll
+func (t *logTailer) reset() {
+	if t.f != nil {
+		t.f.Close() // nolint: errcheck
+	}
+	t.f = nil
+	t.offset = 0
+	t.partial = nil
+}
+
+// logStream is a stream of the lines of an Asterisk logging channel
+type logStream struct {
+	id      string
+	channel *ari.Key
+	levels  string
+
+	tail logTailer
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// logStreamSet is the set of log streams in progress
+type logStreamSet struct {
+	m  map[string]*logStream
+	mu sync.RWMutex
+}
+
+func (ls *logStreamSet) add(l *logStream) {
+	ls.mu.Lock()
+	if ls.m == nil {
+		ls.m = make(map[string]*logStream)
+	}
+	ls.m[l.id] = l
+	ls.mu.Unlock()
+}
+
+func (ls *logStreamSet) get(id string) (*logStream, bool) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	l, ok := ls.m[id]
+	return l, ok
+}
+
+func (ls *logStreamSet) remove(id string) {
+	ls.mu.Lock()
+	delete(ls.m, id)
+	ls.mu.Unlock()
+}
+
+func (s *Server) logStreamStart(ctx context.Context, reply string, req *proxy.Request) {
+	if s.LogStream == nil {
+		s.sendError(reply, eris.New("log stream module is not enabled"))
+		return
+	}
+
+	levels := DefaultLogStreamLevels
+	if req.LogStream != nil && req.LogStream.Levels != "" {
+		levels = req.LogStream.Levels
+	}
+	if err := validateLogLevels(levels); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	logDir := s.LogStream.LogDir
+	if logDir == "" {
+		logDir = DefaultLogDir
+	}
+
+	id := rid.New("ls")
+	name := "ari-proxy-" + id
+
+	h, err := s.ari.Asterisk().Logging().Create(ari.NewKey(ari.LoggingKey, name), levels)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to create logging channel"))
+		return
+	}
+
+	l := &logStream{
+		id:      id,
+		channel: h.Key(),
+		levels:  levels,
+		tail:    logTailer{path: filepath.Join(logDir, name)},
+		stop:    make(chan struct{}),
+	}
+	s.logStreams.add(l)
+
+	go s.runLogStream(ctx, l)
+
+	s.publish(reply, &proxy.Response{
+		Key: ari.NewKey(proxy.LogStreamKey, l.id, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+		Data: &proxy.EntityData{
+			LogStream: &proxy.LogStreamData{
+				ID:      l.id,
+				Channel: name,
+				Levels:  levels,
+				Subject: s.Subjects.LogStream(l.id),
+			},
+		},
+	})
+}
+
+// runLogStream publishes the lines of the log stream until it is stopped or
+// reaches its maximum duration
+func (s *Server) runLogStream(ctx context.Context, l *logStream) {
+	defer s.teardownLogStream(l)
+
+	maxDuration := s.LogStream.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultLogStreamMaxDuration
+	}
+	expiry := time.NewTimer(maxDuration)
+	defer expiry.Stop()
+
+	ticker := time.NewTicker(LogStreamPollInterval)
+	defer ticker.Stop()
+
+	subject := s.Subjects.LogStream(l.id)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.stop:
+			return
+		case <-expiry.C:
+			s.Log.Info("log stream reached its maximum duration", "stream", l.id)
+			return
+		case <-ticker.C:
+		}
+
+		lines, err := l.tail.poll()
+		if err != nil {
+			s.Log.Warn("failed to read log stream", "stream", l.id, "error", err)
+			return
+		}
+		for _, line := range lines {
+			if err := s.nats.Conn.Publish(subject, []byte(line)); err != nil {
+				s.Log.Debug("failed to publish log line", "stream", l.id, "error", err)
+			}
+		}
+	}
+}
+
+// stopStream signals the log stream to stop
+func (l *logStream) stopStream() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+// teardownLogStream deletes the logging channel and file of the log stream
+func (s *Server) teardownLogStream(l *logStream) {
+	s.logStreams.remove(l.id)
+
+	if err := s.ari.Asterisk().Logging().Delete(l.channel); err != nil {
+		s.Log.Debug("failed to delete logging channel", "channel", l.channel.ID, "error", err)
+	}
+	l.tail.reset()
+	os.Remove(l.tail.path) // nolint: errcheck
+}
+
+func (s *Server) logStreamStop(ctx context.Context, reply string, req *proxy.Request) {
+	l, ok := s.logStreams.get(req.Key.ID)
+	if !ok {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+	l.stopStream()
+	s.sendError(reply, nil)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, "ari-proxy-ls1")
+	tail := &logTailer{path: path}
+	defer tail.reset()
+
+	// The file does not exist until Asterisk logs to it
+	if lines, err := tail.poll(); err != nil || lines != nil {
+		t.Fatalf("unexpected lines before file exists: %v (%v)", lines, err)
+	}
+
+	write := func(flag int, data string) {
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		f.Close() // nolint: errcheck
+	}
+	expect := func(expected ...string) {
+		t.Helper()
+		lines, err := tail.poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(lines, expected) {
+			t.Errorf("lines %q != %q", lines, expected)
+		}
+	}
+
+	write(os.O_APPEND, "one\ntwo\nthr")
+	expect("one", "two")
+
+	// Partial lines are completed by later writes
+	write(os.O_APPEND, "ee\r\n")
+	expect("three")
+	expect()
+
+	// Truncation restarts the file
+	write(os.O_TRUNC, "four\n")
+	expect("four")
+
+	// So does replacement (e.g. rotation)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_APPEND, "five\n")
+	expect("five")
+
+	// Overlong lines are not buffered indefinitely
+	long := strings.Repeat("x", maxLogLineLength)
+	write(os.O_APPEND, long)
+	expect(long)
+}
+
+func TestValidateLogLevels(t *testing.T) {
+	if err := validateLogLevels("notice, warning,error"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, levels := range []string{"", "warning,", "chatty", "error;debug"} {
+		if err := validateLogLevels(levels); err == nil {
+			t.Errorf("%q: expected error", levels)
+		}
+	}
+}
@@ -43,9 +43,7 @@ func (s *Server) mailboxList(ctx context.Context, reply string, req *proxy.Reque
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
 
 func (s *Server) mailboxUpdate(ctx context.Context, reply string, req *proxy.Request) {
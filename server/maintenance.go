@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/rotisserie/eris"
+)
+
+// maintenanceSchedule is the maintenance window scheduled on the node
+type maintenanceSchedule struct {
+	window *proxy.MaintenanceWindow
+
+	// timers announce the start and the end of the window
+	timers []clock.Timer
+
+	// clock is the time source of the timers.  It defaults to the system
+	// clock.
+	clock clock.Clock
+
+	mu sync.Mutex
+}
+
+// set replaces the scheduled window, calling onChange when the new window
+// starts and ends.  A nil window cancels the schedule.
+func (m *maintenanceSchedule) set(w *proxy.MaintenanceWindow, onChange func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.timers {
+		t.Stop()
+	}
+	m.timers = nil
+	m.window = w
+
+	if w == nil {
+		return
+	}
+
+	c := m.clock
+	if c == nil {
+		c = clock.Real
+	}
+	now := c.Now()
+	if d := w.Start.Sub(now); d > 0 {
+		m.timers = append(m.timers, c.AfterFunc(d, onChange))
+	}
+	m.timers = append(m.timers, c.AfterFunc(w.End.Sub(now), func() {
+		m.expire(w)
+		onChange()
+	}))
+}
+
+// expire removes the given window once it has ended
+func (m *maintenanceSchedule) expire(w *proxy.MaintenanceWindow) {
+	m.mu.Lock()
+	if m.window == w {
+		m.window = nil
+		m.timers = nil
+	}
+	m.mu.Unlock()
+}
+
+// get returns the scheduled window, if any
+func (m *maintenanceSchedule) get() *proxy.MaintenanceWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.window == nil {
+		return nil
+	}
+	w := *m.window
+	return &w
+}
+
+// active indicates whether the node is within its maintenance window at the
+// given time
+func (m *maintenanceSchedule) active(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.window != nil && !now.Before(m.window.Start) && now.Before(m.window.End)
+}
+
+// validateMaintenanceWindow checks a requested maintenance window, starting
+// it immediately if it has no start time
+func validateMaintenanceWindow(w *proxy.MaintenanceWindow, now time.Time) (*proxy.MaintenanceWindow, error) {
+	if w == nil {
+		return nil, eris.New("no maintenance window")
+	}
+	ret := *w
+	if ret.Start.IsZero() {
+		ret.Start = now
+	}
+	if !ret.End.After(ret.Start) {
+		return nil, eris.New("maintenance window must end after it starts")
+	}
+	if !ret.End.After(now) {
+		return nil, eris.New("maintenance window has already ended")
+	}
+	return &ret, nil
+}
+
+// draining indicates whether the node is rejecting new create requests
+func (s *Server) draining() bool {
+	return s.maintenance.active(s.clock().Now())
+}
+
+// rejectDraining indicates whether the given create request must be rejected
+// because the node is draining.  Requests to emergency destinations are never
+// rejected.
+func (s *Server) rejectDraining(subject string, req *proxy.Request) bool {
+	if !s.draining() || !s.isCreateSubject(subject) {
+		return false
+	}
+	return !s.emergencyBypass("draining", req.Tenant, requestDestinations(req)...)
+}
+
+// isCreateSubject indicates whether the given subject is one of the subjects
+// of create requests on which the server listens
+func (s *Server) isCreateSubject(subject string) bool {
+	for _, subj := range []string{
+		s.Subjects.Request("create", "", ""),
+		s.Subjects.Request("create", s.Application, ""),
+		s.Subjects.Request("create", s.Application, s.nodeID()),
+	} {
+		if subject == subj {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDestinations returns the dialed destinations of the given request
+func requestDestinations(req *proxy.Request) (ret []string) {
+	if req.ChannelCreate != nil {
+		ret = append(ret, req.ChannelCreate.ChannelCreateRequest.Endpoint)
+	}
+	if req.ChannelOriginate != nil {
+		ret = append(ret, req.ChannelOriginate.OriginateRequest.Endpoint, req.ChannelOriginate.OriginateRequest.Extension)
+	}
+	return ret
+}
+
+// announceMaintenance announces the change of the maintenance state of the
+// node
+func (s *Server) announceMaintenance() {
+	if s.draining() {
+		s.Log.Info("maintenance window started; draining")
+	} else {
+		s.Log.Info("maintenance window ended; resuming")
+	}
+	s.announce()
+}
+
+func (s *Server) maintenanceSchedule(ctx context.Context, reply string, req *proxy.Request) {
+	w, err := validateMaintenanceWindow(req.Maintenance, s.clock().Now())
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.Log.Info("maintenance window scheduled", "start", w.Start, "end", w.End)
+	s.maintenance.set(w, s.announceMaintenance)
+	s.announce()
+
+	s.sendError(reply, nil)
+}
+
+func (s *Server) maintenanceCancel(ctx context.Context, reply string, req *proxy.Request) {
+	if s.maintenance.get() == nil {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+
+	s.Log.Info("maintenance window cancelled")
+	s.maintenance.set(nil, nil)
+	s.announce()
+
+	s.sendError(reply, nil)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/inconshreveable/log15"
+)
+
+func TestValidateMaintenanceWindow(t *testing.T) {
+	now := time.Now()
+
+	w, err := validateMaintenanceWindow(&proxy.MaintenanceWindow{End: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Start.Equal(now) {
+		t.Errorf("window without start should start immediately: %v", w.Start)
+	}
+
+	for _, w := range []*proxy.MaintenanceWindow{
+		nil,
+		{Start: now.Add(time.Hour), End: now},
+		{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+	} {
+		if _, err := validateMaintenanceWindow(w, now); err == nil {
+			t.Errorf("%+v: expected error", w)
+		}
+	}
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	var m maintenanceSchedule
+	changed := make(chan struct{}, 2)
+
+	now := time.Now()
+	m.set(&proxy.MaintenanceWindow{Start: now.Add(20 * time.Millisecond), End: now.Add(40 * time.Millisecond)}, func() {
+		changed <- struct{}{}
+	})
+	if m.active(now) {
+		t.Error("window should not be active before it starts")
+	}
+	if !m.active(now.Add(30 * time.Millisecond)) {
+		t.Error("window should be active once it starts")
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+			t.Fatal("window start and end should be announced")
+		}
+	}
+	if m.get() != nil {
+		t.Error("ended window should be removed")
+	}
+
+	// Cancellation stops the timers of the window
+	m.set(&proxy.MaintenanceWindow{Start: now, End: now.Add(time.Hour)}, func() {
+		t.Error("cancelled window should not be announced")
+	})
+	m.set(nil, nil)
+	if m.active(time.Now()) {
+		t.Error("cancelled window should not be active")
+	}
+}
+
+func TestRejectDraining(t *testing.T) {
+	s := &Server{
+		Application: "app",
+		AsteriskID:  "node",
+		Subjects:    proxy.NewSubjectBuilder("ari."),
+		Log:         log15.New(),
+	}
+	s.Log.SetHandler(log15.DiscardHandler())
+	s.emergency, _ = newEmergencyMatcher([]string{"^911$"})
+
+	req := &proxy.Request{
+		Kind: "ChannelOriginate",
+		ChannelOriginate: &proxy.ChannelOriginate{
+			OriginateRequest: ari.OriginateRequest{Endpoint: "PJSIP/100@trunk"},
+		},
+	}
+	if s.rejectDraining("ari.create.app", req) {
+		t.Error("requests should not be rejected outside of maintenance")
+	}
+
+	now := time.Now()
+	s.maintenance.set(&proxy.MaintenanceWindow{Start: now, End: now.Add(time.Hour)}, func() {})
+	defer s.maintenance.set(nil, nil)
+
+	for _, subject := range []string{"ari.create", "ari.create.app", "ari.create.app.node"} {
+		if !s.rejectDraining(subject, req) {
+			t.Errorf("%s: create request should be rejected while draining", subject)
+		}
+	}
+	if s.rejectDraining("ari.command.app.node", req) {
+		t.Error("command requests should not be rejected while draining")
+	}
+
+	req.ChannelOriginate.OriginateRequest.Endpoint = "PJSIP/911@trunk"
+	if s.rejectDraining("ari.create.app", req) {
+		t.Error("emergency requests should not be rejected while draining")
+	}
+}
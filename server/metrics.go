@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/rotisserie/eris"
+)
+
+// MetricsConfig describes the optional HTTP listener on which the metrics of
+// the server are exposed in the Prometheus text format
+type MetricsConfig struct {
+	// Listen is the address on which to listen (e.g. ":9180" or
+	// "unix:/run/ari-proxy/metrics.sock")
+	Listen string `mapstructure:"listen"`
+
+	// Path is the path of the metrics.  It defaults to "/metrics".
+	Path string `mapstructure:"path"`
+}
+
+// requestDurationBuckets are the upper bounds, in seconds, of the buckets of
+// the request handling latency histograms
+var requestDurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestMetrics are the metrics of the requests of a kind
+type requestMetrics struct {
+	count   uint64
+	errors  uint64
+	retries uint64
+	expired uint64
+
+	// buckets counts the requests by latency bucket (not cumulatively)
+	buckets []uint64
+	sum     float64
+}
+
+// serverMetrics collects the metrics of a server.  The counters which are
+// accessed atomically come first, so that they are 64-bit aligned on 32-bit
+// platforms (e.g. ARM), where the server keeps the metrics after eventSeq.
+type serverMetrics struct {
+	natsErrors uint64
+
+	chunkedResponses   uint64
+	oversizedResponses uint64
+
+	// filteredVarsets counts the ChannelVarset events withheld by the varset
+	// filter
+	filteredVarsets uint64
+
+	requests map[string]*requestMetrics
+	events   map[string]uint64
+
+	// oversizedEvents counts, by type, the events which exceeded the
+	// maximum NATS payload and were dropped
+	oversizedEvents map[string]uint64
+
+	// compressedOversized counts, by message ("event" or "response"), the
+	// messages which were compressed because they exceeded the maximum size
+	compressedOversized map[string]uint64
+
+	// droppedDialogEvents counts, by type, the events which were not
+	// published to a dialog because of the dialog event limit
+	droppedDialogEvents map[string]uint64
+
+	mu sync.Mutex
+}
+
+func (m *serverMetrics) request(kind string) *requestMetrics {
+	if m.requests == nil {
+		m.requests = make(map[string]*requestMetrics)
+	}
+	r, ok := m.requests[kind]
+	if !ok {
+		r = &requestMetrics{buckets: make([]uint64, len(requestDurationBuckets)+1)}
+		m.requests[kind] = r
+	}
+	return r
+}
+
+// observeRequest records the handling of a request of the given kind
+func (m *serverMetrics) observeRequest(kind string, d time.Duration) {
+	secs := d.Seconds()
+	i := sort.SearchFloat64s(requestDurationBuckets, secs)
+
+	m.mu.Lock()
+	r := m.request(kind)
+	r.count++
+	r.buckets[i]++
+	r.sum += secs
+	m.mu.Unlock()
+}
+
+// requestFailed records the failure of a request of the given kind
+func (m *serverMetrics) requestFailed(kind string) {
+	m.mu.Lock()
+	m.request(kind).errors++
+	m.mu.Unlock()
+}
+
+// requestRetried records a retry of a request of the given kind
+func (m *serverMetrics) requestRetried(kind string) {
+	m.mu.Lock()
+	m.request(kind).retries++
+	m.mu.Unlock()
+}
+
+// requestExpired records a request of the given kind which was discarded
+// because its deadline passed before it was executed
+func (m *serverMetrics) requestExpired(kind string) {
+	m.mu.Lock()
+	m.request(kind).expired++
+	m.mu.Unlock()
+}
+
+// eventPublished records the publication of an event of the given type
+func (m *serverMetrics) eventPublished(typ string) {
+	m.mu.Lock()
+	if m.events == nil {
+		m.events = make(map[string]uint64)
+	}
+	m.events[typ]++
+	m.mu.Unlock()
+}
+
+// publishFailed records a failure to publish a NATS message
+func (m *serverMetrics) publishFailed() {
+	atomic.AddUint64(&m.natsErrors, 1)
+}
+
+// responseChunked records the publication of a response in chunks
+func (m *serverMetrics) responseChunked() {
+	atomic.AddUint64(&m.chunkedResponses, 1)
+}
+
+// responseOversized records a response which exceeded the maximum message
+// size and could not be chunked
+func (m *serverMetrics) responseOversized() {
+	atomic.AddUint64(&m.oversizedResponses, 1)
+}
+
+// eventOversized records an event of the given type which exceeded the
+// maximum NATS payload
+func (m *serverMetrics) eventOversized(typ string) {
+	m.mu.Lock()
+	if m.oversizedEvents == nil {
+		m.oversizedEvents = make(map[string]uint64)
+	}
+	m.oversizedEvents[typ]++
+	m.mu.Unlock()
+}
+
+// oversizedCompressed records the compression of a message of the given kind
+// ("event" or "response") which exceeded the maximum size
+func (m *serverMetrics) oversizedCompressed(message string) {
+	m.mu.Lock()
+	if m.compressedOversized == nil {
+		m.compressedOversized = make(map[string]uint64)
+	}
+	m.compressedOversized[message]++
+	m.mu.Unlock()
+}
+
+// dialogEventDropped records an event of the given type which was not
+// published to a dialog because of the dialog event limit
+func (m *serverMetrics) dialogEventDropped(typ string) {
+	m.mu.Lock()
+	if m.droppedDialogEvents == nil {
+		m.droppedDialogEvents = make(map[string]uint64)
+	}
+	m.droppedDialogEvents[typ]++
+	m.mu.Unlock()
+}
+
+// varsetFiltered records a ChannelVarset event withheld by the varset filter
+func (m *serverMetrics) varsetFiltered() {
+	atomic.AddUint64(&m.filteredVarsets, 1)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// write writes the metrics in the Prometheus text format
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kinds := make([]string, 0, len(m.requests))
+	for k := range m.requests {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintln(w, "# HELP ari_proxy_requests_total Number of requests handled, by kind.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_requests_total counter")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "ari_proxy_requests_total{kind=%q} %d\n", k, m.requests[k].count)
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_request_errors_total Number of requests which failed, by kind.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_request_errors_total counter")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "ari_proxy_request_errors_total{kind=%q} %d\n", k, m.requests[k].errors)
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_request_retries_total Number of retries of requests after transient ARI errors, by kind.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_request_retries_total counter")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "ari_proxy_request_retries_total{kind=%q} %d\n", k, m.requests[k].retries)
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_requests_expired_total Number of requests discarded because their deadline passed before they were executed, by kind.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_requests_expired_total counter")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "ari_proxy_requests_expired_total{kind=%q} %d\n", k, m.requests[k].expired)
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_request_duration_seconds Request handling latency, by kind.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_request_duration_seconds histogram")
+	for _, k := range kinds {
+		r := m.requests[k]
+		var cumulative uint64
+		for i, le := range requestDurationBuckets {
+			cumulative += r.buckets[i]
+			fmt.Fprintf(w, "ari_proxy_request_duration_seconds_bucket{kind=%q,le=\"%g\"} %d\n", k, le, cumulative)
+		}
+		fmt.Fprintf(w, "ari_proxy_request_duration_seconds_bucket{kind=%q,le=\"+Inf\"} %d\n", k, r.count)
+		fmt.Fprintf(w, "ari_proxy_request_duration_seconds_sum{kind=%q} %g\n", k, r.sum)
+		fmt.Fprintf(w, "ari_proxy_request_duration_seconds_count{kind=%q} %d\n", k, r.count)
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_events_published_total Number of events published, by type.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_events_published_total counter")
+	for _, t := range sortedKeys(m.events) {
+		fmt.Fprintf(w, "ari_proxy_events_published_total{type=%q} %d\n", t, m.events[t])
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_nats_publish_errors_total Number of NATS messages which could not be published.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_nats_publish_errors_total counter")
+	fmt.Fprintf(w, "ari_proxy_nats_publish_errors_total %d\n", atomic.LoadUint64(&m.natsErrors))
+
+	fmt.Fprintln(w, "# HELP ari_proxy_responses_chunked_total Number of responses which exceeded the maximum message size and were published in chunks.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_responses_chunked_total counter")
+	fmt.Fprintf(w, "ari_proxy_responses_chunked_total %d\n", atomic.LoadUint64(&m.chunkedResponses))
+
+	fmt.Fprintln(w, "# HELP ari_proxy_responses_oversized_total Number of responses which exceeded the maximum message size and were rejected.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_responses_oversized_total counter")
+	fmt.Fprintf(w, "ari_proxy_responses_oversized_total %d\n", atomic.LoadUint64(&m.oversizedResponses))
+
+	fmt.Fprintln(w, "# HELP ari_proxy_events_oversized_total Number of events which exceeded the maximum NATS payload and were dropped, by type.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_events_oversized_total counter")
+	for _, t := range sortedKeys(m.oversizedEvents) {
+		fmt.Fprintf(w, "ari_proxy_events_oversized_total{type=%q} %d\n", t, m.oversizedEvents[t])
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_oversized_compressed_total Number of messages which exceeded the maximum message size and were compressed, by message.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_oversized_compressed_total counter")
+	for _, k := range sortedKeys(m.compressedOversized) {
+		fmt.Fprintf(w, "ari_proxy_oversized_compressed_total{message=%q} %d\n", k, m.compressedOversized[k])
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_dialog_events_dropped_total Number of events which were not published to a dialog because of the dialog event limit, by type.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_dialog_events_dropped_total counter")
+	for _, t := range sortedKeys(m.droppedDialogEvents) {
+		fmt.Fprintf(w, "ari_proxy_dialog_events_dropped_total{type=%q} %d\n", t, m.droppedDialogEvents[t])
+	}
+
+	fmt.Fprintln(w, "# HELP ari_proxy_varset_events_filtered_total Number of ChannelVarset events withheld by the varset filter.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_varset_events_filtered_total counter")
+	fmt.Fprintf(w, "ari_proxy_varset_events_filtered_total %d\n", atomic.LoadUint64(&m.filteredVarsets))
+}
+
+// writeMetrics writes the metrics of the server, including its gauges, in the
+// Prometheus text format
+func (s *Server) writeMetrics(w io.Writer) {
+	s.metrics.write(w)
+
+	connected := 0
+	if s.ari != nil && s.ariConnected() {
+		connected = 1
+	}
+	fmt.Fprintln(w, "# HELP ari_proxy_ari_connected Whether the ARI connection is up.")
+	fmt.Fprintln(w, "# TYPE ari_proxy_ari_connected gauge")
+	fmt.Fprintf(w, "ari_proxy_ari_connected %d\n", connected)
+
+	if max := s.natsMaxPayload(); max > 0 {
+		fmt.Fprintln(w, "# HELP ari_proxy_nats_max_payload_bytes Maximum payload of the NATS connection.")
+		fmt.Fprintln(w, "# TYPE ari_proxy_nats_max_payload_bytes gauge")
+		fmt.Fprintf(w, "ari_proxy_nats_max_payload_bytes %d\n", max)
+	}
+
+	if c, ok := s.Dialog.(dialog.Counter); ok {
+		dialogs, bindings := c.Count()
+		fmt.Fprintln(w, "# HELP ari_proxy_dialogs Number of dialogs with entity bindings.")
+		fmt.Fprintln(w, "# TYPE ari_proxy_dialogs gauge")
+		fmt.Fprintf(w, "ari_proxy_dialogs %d\n", dialogs)
+		fmt.Fprintln(w, "# HELP ari_proxy_dialog_bindings Number of active dialog bindings.")
+		fmt.Fprintln(w, "# TYPE ari_proxy_dialog_bindings gauge")
+		fmt.Fprintf(w, "ari_proxy_dialog_bindings %d\n", bindings)
+	}
+}
+
+// startMetrics starts the metrics HTTP listener, which is stopped when the
+// context is closed
+func (s *Server) startMetrics(ctx context.Context) error {
+	ln, err := listen(s.Metrics.Listen)
+	if err != nil {
+		return eris.Wrap(err, "failed to listen for metrics requests")
+	}
+
+	path := s.Metrics.Path
+	if path == "" {
+		path = "/metrics"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.writeMetrics(w)
+	})
+
+	srv := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close() // nolint: errcheck
+	}()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.Log.Error("metrics endpoint failed", "error", err)
+		}
+	}()
+
+	return nil
+}
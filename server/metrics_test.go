@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/natstest"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestServerMetrics(t *testing.T) {
+	s := New()
+	s.metrics.observeRequest("ChannelAnswer", 3*time.Millisecond)
+	s.metrics.observeRequest("ChannelAnswer", 2*time.Second)
+	s.metrics.requestFailed("ChannelAnswer")
+	s.metrics.eventPublished("StasisStart")
+	s.metrics.publishFailed()
+	s.Dialog.Bind("d1", "channel", "c1")
+	s.Dialog.Bind("d1", "bridge", "b1")
+
+	var buf bytes.Buffer
+	s.writeMetrics(&buf)
+	out := buf.String()
+
+	for _, line := range []string{
+		`ari_proxy_requests_total{kind="ChannelAnswer"} 2`,
+		`ari_proxy_request_errors_total{kind="ChannelAnswer"} 1`,
+		`ari_proxy_request_duration_seconds_bucket{kind="ChannelAnswer",le="0.0025"} 0`,
+		`ari_proxy_request_duration_seconds_bucket{kind="ChannelAnswer",le="0.005"} 1`,
+		`ari_proxy_request_duration_seconds_bucket{kind="ChannelAnswer",le="2.5"} 2`,
+		`ari_proxy_request_duration_seconds_bucket{kind="ChannelAnswer",le="+Inf"} 2`,
+		`ari_proxy_request_duration_seconds_count{kind="ChannelAnswer"} 2`,
+		`ari_proxy_events_published_total{type="StasisStart"} 1`,
+		`ari_proxy_nats_publish_errors_total 1`,
+		`ari_proxy_ari_connected 0`,
+		`ari_proxy_dialogs 1`,
+		`ari_proxy_dialog_bindings 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing metric %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetricsFlow(t *testing.T) {
+	if !withMetrics {
+		t.Skip("metrics subsystem excluded from the build")
+	}
+
+	dir, err := ioutil.TempDir("", "ari-proxy-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	sock := filepath.Join(dir, "metrics.sock")
+
+	ft := newFlowTest(t, WithMetrics(&MetricsConfig{Listen: "unix:" + sock, Path: "/stats"}))
+	defer ft.Close()
+	ft.handleEvents(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ft.s.startMetrics(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	ft.channel.On("Data", key).Return(&ari.ChannelData{ID: "c1"}, nil)
+	ft.channel.On("Answer", key).Return(errors.New("channel not found"))
+
+	if resp := ft.request(t, &proxy.Request{Kind: "ChannelData", Key: key}); resp.Err() != nil {
+		t.Fatal(resp.Err())
+	}
+	if resp := ft.request(t, &proxy.Request{Kind: "ChannelAnswer", Key: key}); resp.Err() == nil {
+		t.Fatal("expected answer to fail")
+	}
+	ft.send(&ari.ChannelHangupRequest{
+		EventData: ari.EventData{Type: ari.Events.ChannelHangupRequest},
+		Channel:   ari.ChannelData{ID: "c1"},
+	})
+	ft.event(t, ari.Events.ChannelHangupRequest)
+
+	cl := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := cl.Get("http://metrics/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(body)
+
+	for _, line := range []string{
+		`ari_proxy_requests_total{kind="ChannelData"} 1`,
+		`ari_proxy_requests_total{kind="ChannelAnswer"} 1`,
+		`ari_proxy_request_errors_total{kind="ChannelAnswer"} 1`,
+		`ari_proxy_request_errors_total{kind="ChannelData"} 0`,
+		`ari_proxy_request_duration_seconds_count{kind="ChannelData"} 1`,
+		`ari_proxy_events_published_total{type="ChannelHangupRequest"} 1`,
+		`ari_proxy_ari_connected 1`,
+		fmt.Sprintf("ari_proxy_nats_max_payload_bytes %d", natstest.MaxPayload),
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing metric %q in:\n%s", line, out)
+		}
+	}
+}
@@ -7,15 +7,34 @@ import (
 )
 
 func (s *Server) asteriskModuleLoad(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Asterisk().Modules().Load(req.Key))
+	err := s.ari.Asterisk().Modules().Load(req.Key)
+	s.sendError(reply, err)
+	if err == nil {
+		s.moduleChanged()
+	}
 }
 
 func (s *Server) asteriskModuleUnload(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Asterisk().Modules().Unload(req.Key))
+	err := s.ari.Asterisk().Modules().Unload(req.Key)
+	s.sendError(reply, err)
+	if err == nil {
+		s.moduleChanged()
+	}
 }
 
 func (s *Server) asteriskModuleReload(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Asterisk().Modules().Reload(req.Key))
+	err := s.ari.Asterisk().Modules().Reload(req.Key)
+	s.sendError(reply, err)
+	if err == nil {
+		s.moduleChanged()
+	}
+}
+
+// moduleChanged announces the channel drivers of the node after a module was
+// loaded, unloaded or reloaded
+func (s *Server) moduleChanged() {
+	s.refreshChannelDrivers()
+	s.announce()
 }
 
 func (s *Server) asteriskModuleData(ctx context.Context, reply string, req *proxy.Request) {
@@ -51,7 +70,5 @@ func (s *Server) asteriskModuleList(ctx context.Context, reply string, req *prox
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// ErrNATSConnectionClosed indicates that the server stopped because its NATS
+// connection was closed after failing to reconnect
+var ErrNATSConnectionClosed = eris.New("NATS connection closed")
+
+// States of the NATS connection reported to the NATSStateHandler
+const (
+	// NATSDisconnected indicates that the connection was lost.  The NATS
+	// client reconnects in the background, while the server receives no
+	// requests, and the messages it publishes are buffered.
+	NATSDisconnected = "disconnected"
+
+	// NATSReconnected indicates that the connection was re-established.  The
+	// NATS client restores the subscriptions of the server, and the server
+	// announces itself again.
+	NATSReconnected = "reconnected"
+
+	// NATSClosed indicates that the connection was closed for good, after
+	// failing to reconnect, and that the server is stopping with
+	// ErrNATSConnectionClosed
+	NATSClosed = "closed"
+)
+
+// NATSStateChange describes a change of the state of the NATS connection of
+// a server
+type NATSStateChange struct {
+	// State is the new state of the connection (NATSDisconnected, etc.)
+	State string
+
+	// URL is the URL of the NATS server to which the connection is
+	// connected, once reconnected
+	URL string
+
+	// Err is the error which caused the change, if any
+	Err error
+
+	// Time is the time of the change
+	Time time.Time
+}
+
+// natsConnectOptions returns the options of the NATS connections established
+// by Listen, which reconnect indefinitely, as the server cannot serve without
+// its connection
+func natsConnectOptions() []nats.Option {
+	return []nats.Option{
+		nats.MaxReconnects(-1),
+	}
+}
+
+// watchConnection tracks the state of the given NATS connection, announcing
+// the server when the connection is re-established, and stopping it if the
+// connection is closed while the server is running.  The handlers already set
+// on the connection are still called.
+func (s *Server) watchConnection(ctx context.Context, nc *nats.Conn) {
+	nextDisconnected := nc.Opts.DisconnectedCB
+	nextDisconnectedErr := nc.Opts.DisconnectedErrCB
+	nc.SetDisconnectErrHandler(func(c *nats.Conn, err error) {
+		s.Log.Warn("NATS connection lost", "error", err)
+		s.natsStateChanged(NATSDisconnected, "", err)
+
+		if nextDisconnectedErr != nil {
+			nextDisconnectedErr(c, err)
+		} else if nextDisconnected != nil {
+			nextDisconnected(c)
+		}
+	})
+
+	nextReconnected := nc.Opts.ReconnectedCB
+	nc.SetReconnectHandler(func(c *nats.Conn) {
+		s.Log.Info("NATS connection re-established", "url", c.ConnectedUrl())
+		s.natsStateChanged(NATSReconnected, c.ConnectedUrl(), nil)
+
+		// Let the cluster know we are back, rather than waiting for the next
+		// periodic announcement
+		if ctx.Err() == nil {
+			s.announce()
+		}
+
+		if nextReconnected != nil {
+			nextReconnected(c)
+		}
+	})
+
+	nextClosed := nc.Opts.ClosedCB
+	nc.SetClosedHandler(func(c *nats.Conn) {
+		// The connection is closed by the server itself when it stops
+		if ctx.Err() == nil {
+			s.Log.Error("NATS connection closed", "error", c.LastError())
+			s.natsStateChanged(NATSClosed, "", c.LastError())
+			s.stop(ErrNATSConnectionClosed)
+		}
+
+		if nextClosed != nil {
+			nextClosed(c)
+		}
+	})
+}
+
+// natsStateChanged reports a change of the state of the NATS connection to
+// the NATSStateHandler, if any
+func (s *Server) natsStateChanged(state, url string, err error) {
+	if s.NATSStateHandler == nil {
+		return
+	}
+	s.NATSStateHandler(NATSStateChange{
+		State: state,
+		URL:   url,
+		Err:   err,
+		Time:  time.Now(),
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestWatchConnection(t *testing.T) {
+	var states []string
+	s := New(WithNATSStateHandler(func(c NATSStateChange) {
+		states = append(states, c.State)
+	}))
+
+	var chained int
+	opts := nats.GetDefaultOptions()
+	opts.DisconnectedCB = func(*nats.Conn) { chained++ }
+	opts.ClosedCB = func(*nats.Conn) { chained++ }
+	nc := &nats.Conn{Opts: opts}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.watchConnection(ctx, nc)
+
+	nc.Opts.DisconnectedErrCB(nc, errors.New("connection reset"))
+	nc.Opts.ClosedCB(nc)
+
+	if len(states) != 2 || states[0] != NATSDisconnected || states[1] != NATSClosed {
+		t.Errorf("unexpected states %v", states)
+	}
+	if chained != 2 {
+		t.Errorf("called %d of the previous handlers", chained)
+	}
+	if err := s.stopErr(); err != ErrNATSConnectionClosed {
+		t.Errorf("server stopped with %v", err)
+	}
+
+	// The closure of the connection of a stopped server is expected
+	cancel()
+	states = nil
+	nc.Opts.ClosedCB(nc)
+	if len(states) != 0 {
+		t.Errorf("unexpected states of stopped server %v", states)
+	}
+
+	// No announcement is published by a stopped server
+	nc.Opts.ReconnectedCB(nc)
+	if len(states) != 1 || states[0] != NATSReconnected {
+		t.Errorf("unexpected states %v", states)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !race
+// +build !race
+
+package server
+
+// raceEnabled indicates that the tests run with the race detector
+const raceEnabled = false
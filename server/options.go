@@ -2,8 +2,14 @@ package server
 
 import (
 	"context"
+	"strings"
+	"time"
 
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
 	"github.com/inconshreveable/log15"
+	"github.com/rotisserie/eris"
 )
 
 // Options are the group of options for the ari-proxy server
@@ -15,3 +21,491 @@ type Options struct {
 	Logger log15.Logger
 	Parent context.Context
 }
+
+// Option configures a Server.  Options are applied and validated by New, so
+// that a Server need not be configured by setting its fields after it is
+// constructed.  If an option is invalid, Listen fails with its error.
+type Option func(*Server) error
+
+// WithPrefix sets the string which is prepended to all NATS subjects.  It
+// defaults to "ari.".
+func WithPrefix(prefix string) Option {
+	return func(s *Server) error {
+		if prefix != "" && !strings.HasSuffix(prefix, ".") {
+			return eris.Errorf("NATS prefix %q must end with a dot", prefix)
+		}
+		s.NATSPrefix = prefix
+		return nil
+	}
+}
+
+// WithCodec sets the codec with which responses and events are encoded (see
+// Server.Codec)
+func WithCodec(name string) Option {
+	return func(s *Server) error {
+		if _, err := proxy.LookupCodec(name); err != nil {
+			return err
+		}
+		s.Codec = name
+		return nil
+	}
+}
+
+// WithMaxResponseSize sets the maximum size, in bytes, of a response message
+// (see Server.MaxResponseSize)
+func WithMaxResponseSize(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return eris.New("maximum response size may not be negative")
+		}
+		if n > 0 && n < MinMaxResponseSize {
+			return eris.Errorf("maximum response size may not be less than %d bytes", MinMaxResponseSize)
+		}
+		s.MaxResponseSize = n
+		return nil
+	}
+}
+
+// WithSubjectBuilder customizes the construction of NATS subjects (see
+// Server.Subjects)
+func WithSubjectBuilder(b proxy.SubjectBuilder) Option {
+	return func(s *Server) error {
+		if b == nil {
+			return eris.New("no subject builder")
+		}
+		s.Subjects = b
+		return nil
+	}
+}
+
+// WithDialogManager sets the dialog manager.  It defaults to an in-memory
+// manager.
+func WithDialogManager(m dialog.Manager) Option {
+	return func(s *Server) error {
+		if m == nil {
+			return eris.New("no dialog manager")
+		}
+		s.Dialog = m
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the Server.  It defaults to a logger which
+// discards its records.
+func WithLogger(l log15.Logger) Option {
+	return func(s *Server) error {
+		if l == nil {
+			return eris.New("no logger")
+		}
+		s.Log = l
+		return nil
+	}
+}
+
+// WithQuota enforces the given quotas on creation requests
+func WithQuota(cfg *QuotaConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no quota configuration")
+		}
+		check := func(scope string, l QuotaLimits) error {
+			if l.MaxChannels < 0 || l.OriginatesPerMinute < 0 || l.MaxRecordings < 0 {
+				return eris.Errorf("quota limits of %s may not be negative", scope)
+			}
+			return nil
+		}
+		if err := check("default", cfg.Default); err != nil {
+			return err
+		}
+		for app, l := range cfg.Applications {
+			if err := check("application "+app, l); err != nil {
+				return err
+			}
+		}
+		for tenant, l := range cfg.Tenants {
+			if err := check("tenant "+tenant, l); err != nil {
+				return err
+			}
+		}
+		s.Quota = cfg
+		return nil
+	}
+}
+
+// WithCompression enables the gzip compression of large responses
+func WithCompression(cfg *CompressionConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no compression configuration")
+		}
+		if cfg.MinSize < 0 {
+			return eris.New("compression minimum size may not be negative")
+		}
+		for _, k := range cfg.Kinds {
+			if !isSupportedKind(k) {
+				return eris.Errorf("cannot compress unknown request kind %q", k)
+			}
+		}
+		s.Compression = cfg
+		return nil
+	}
+}
+
+// WithMetrics enables the HTTP listener on which the metrics of the server are
+// exposed (see Server.Metrics)
+func WithMetrics(cfg *MetricsConfig) Option {
+	return func(s *Server) error {
+		if !withMetrics {
+			return errExcluded(SubsystemMetrics)
+		}
+		if cfg == nil || cfg.Listen == "" {
+			return eris.New("metrics require a listen address")
+		}
+		if cfg.Path != "" && !strings.HasPrefix(cfg.Path, "/") {
+			return eris.Errorf("metrics path %q must start with a slash", cfg.Path)
+		}
+		s.Metrics = cfg
+		return nil
+	}
+}
+
+// WithHealthEndpoint enables the HTTP listener on which the liveness and
+// readiness of the server are exposed (see Server.HealthEndpoint)
+func WithHealthEndpoint(cfg *HealthConfig) Option {
+	return func(s *Server) error {
+		if !withHealth {
+			return errExcluded(SubsystemHealth)
+		}
+		if cfg == nil {
+			return eris.New("health endpoint requires a listen address")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		s.HealthEndpoint = cfg
+		return nil
+	}
+}
+
+// WithEmergencyDestinations sets the regular expressions describing the
+// safety-critical destinations (see Server.EmergencyDestinations)
+func WithEmergencyDestinations(patterns ...string) Option {
+	return func(s *Server) error {
+		if _, err := newEmergencyMatcher(patterns); err != nil {
+			return err
+		}
+		s.EmergencyDestinations = patterns
+		return nil
+	}
+}
+
+// WithFanOut configures the worker pool which publishes events to their
+// dialogs
+func WithFanOut(cfg *FanOutConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no fan-out configuration")
+		}
+		if cfg.Workers < 0 || cfg.QueueSize < 0 {
+			return eris.New("fan-out workers and queue size may not be negative")
+		}
+		s.FanOut = cfg
+		return nil
+	}
+}
+
+// WithDialogEventLimit limits the rate at which events of high-frequency
+// types are published to each dialog
+func WithDialogEventLimit(cfg *DialogEventLimitConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no dialog event limit configuration")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		s.DialogEventLimit = cfg
+		return nil
+	}
+}
+
+// WithSoundUpload enables the upload of sound files into the sounds
+// directory of the node, with the given configuration
+func WithSoundUpload(cfg *SoundUploadConfig) Option {
+	return func(s *Server) error {
+		if !withSoundUpload {
+			return errExcluded(SubsystemSoundUpload)
+		}
+		if cfg == nil {
+			return eris.New("no sound upload configuration")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		s.SoundUpload = cfg
+		return nil
+	}
+}
+
+// WithSystemd enables the integration of the server with the systemd service
+// manager (readiness and stopping notifications, status text, and watchdog),
+// with the given configuration
+func WithSystemd(cfg *SystemdConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no systemd configuration")
+		}
+		if cfg.StatusInterval < 0 {
+			return eris.New("systemd status interval may not be negative")
+		}
+		s.Systemd = cfg
+		return nil
+	}
+}
+
+// WithDrainTimeout sets the time for which the server, when it stops, waits
+// for the requests being handled to complete.  It defaults to
+// DefaultDrainTimeout.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return eris.New("drain timeout must be positive")
+		}
+		s.DrainTimeout = d
+		return nil
+	}
+}
+
+// WithShutdownGracePeriod sets the time allowed for the cleanup of the
+// server's subcomponents when it stops.  It defaults to
+// DefaultShutdownGracePeriod.
+func WithShutdownGracePeriod(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return eris.New("shutdown grace period must be positive")
+		}
+		s.ShutdownGracePeriod = d
+		return nil
+	}
+}
+
+// WithVersion sets the version of the proxy, which is announced to clients
+func WithVersion(version string) Option {
+	return func(s *Server) error {
+		s.Version = version
+		return nil
+	}
+}
+
+// WithInstanceID sets the instance ID of the server, instead of generating one
+// when it starts listening
+func WithInstanceID(id string) Option {
+	return func(s *Server) error {
+		if id == "" || strings.ContainsAny(id, " \t\r\n") {
+			return eris.New("instance ID may not be empty or contain whitespace")
+		}
+		s.InstanceID = id
+		return nil
+	}
+}
+
+// WithEventRoutes publishes the events of particular types to additional
+// subjects (see EventRoute)
+func WithEventRoutes(routes ...EventRoute) Option {
+	return func(s *Server) error {
+		if _, err := newEventRouter(routes); err != nil {
+			return err
+		}
+		s.EventRoutes = append(s.EventRoutes, routes...)
+		return nil
+	}
+}
+
+// WithCallFlows adds declarative call flows, which the proxy executes itself
+// for the calls which match them (see CallFlow)
+func WithCallFlows(flows ...CallFlow) Option {
+	return func(s *Server) error {
+		if _, err := newCallFlows(flows); err != nil {
+			return err
+		}
+		s.CallFlows = append(s.CallFlows, flows...)
+		return nil
+	}
+}
+
+// WithVarsetFilter selects, by variable name, the ChannelVarset events which
+// are published (see VarsetFilterConfig)
+func WithVarsetFilter(cfg *VarsetFilterConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no varset filter configuration")
+		}
+		if _, err := newVarsetFilter(cfg); err != nil {
+			return err
+		}
+		s.VarsetFilter = cfg
+		return nil
+	}
+}
+
+// WithJetStream consumes create and command requests from a JetStream stream
+// with the given configuration, acknowledging each once it has been executed
+func WithJetStream(cfg *JetStreamConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no JetStream configuration")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		s.JetStream = cfg
+		return nil
+	}
+}
+
+// WithEventStream stores the events of the application in a JetStream stream
+// with the given configuration
+func WithEventStream(cfg *EventStreamConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("no event stream configuration")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		s.EventStream = cfg
+		return nil
+	}
+}
+
+// WithChannelVariables sets the channel variables which are reported for each
+// call entering the application (see Server.ChannelVariables)
+func WithChannelVariables(names ...string) Option {
+	return func(s *Server) error {
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return eris.New("empty channel variable name")
+			}
+		}
+		s.ChannelVariables = names
+		return nil
+	}
+}
+
+// WithKeepalive enables the keepalive of the ARI WebSocket with the given
+// configuration
+func WithKeepalive(cfg *KeepaliveConfig) Option {
+	return func(s *Server) error {
+		if cfg != nil && (cfg.Interval < 0 || cfg.MaxMissed < 0) {
+			return eris.New("keepalive interval and maximum missed pings may not be negative")
+		}
+		s.Keepalive = cfg
+		return nil
+	}
+}
+
+// WithARIReconnect enables the reconnection of the server to ARI with the
+// given configuration (see Server.ARIReconnect)
+func WithARIReconnect(cfg *ARIReconnectConfig) Option {
+	return func(s *Server) error {
+		if cfg != nil && (cfg.InitialBackoff < 0 || cfg.MaxBackoff < 0) {
+			return eris.New("ARI reconnection backoffs may not be negative")
+		}
+		s.ARIReconnect = cfg
+		return nil
+	}
+}
+
+// WithClock sets the time source of the server (see Server.Clock)
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) error {
+		if c == nil {
+			return eris.New("clock may not be nil")
+		}
+		s.Clock = c
+		return nil
+	}
+}
+
+// WithStateConflict configures the retries of idempotent channel operations
+// which fail because their channel is in an invalid state (see
+// Server.StateConflict)
+func WithStateConflict(cfg *StateConflictConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("state conflict configuration is required")
+		}
+		if cfg.Retries < 0 || cfg.Backoff < 0 {
+			return eris.New("state conflict retries and backoff may not be negative")
+		}
+		s.StateConflict = cfg
+		return nil
+	}
+}
+
+// WithRetry enables the retries of idempotent requests which fail with a
+// transient ARI error (see Server.Retry)
+func WithRetry(cfg *RetryConfig) Option {
+	return func(s *Server) error {
+		if cfg == nil {
+			return eris.New("retry configuration is required")
+		}
+		if cfg.MaxRetries < 0 || cfg.Backoff < 0 || cfg.MaxBackoff < 0 {
+			return eris.New("retry limits may not be negative")
+		}
+		for _, k := range cfg.Kinds {
+			if !isSupportedKind(k) {
+				return eris.Errorf("cannot retry unknown request kind %q", k)
+			}
+		}
+		s.Retry = cfg
+		return nil
+	}
+}
+
+// WithNATSStateHandler sets the function called on each change of the state
+// of the NATS connection (see Server.NATSStateHandler)
+func WithNATSStateHandler(fn func(NATSStateChange)) Option {
+	return func(s *Server) error {
+		s.NATSStateHandler = fn
+		return nil
+	}
+}
+
+// WithMaxCalls sets the number of concurrent calls which the node is expected
+// to handle, which is announced as a hint for call placement
+func WithMaxCalls(n int) Option {
+	return func(s *Server) error {
+		if n < 0 {
+			return eris.New("maximum calls may not be negative")
+		}
+		s.MaxCalls = n
+		return nil
+	}
+}
+
+// WithLabels sets the labels of the server, which are announced as hints for
+// call placement
+func WithLabels(labels map[string]string) Option {
+	return func(s *Server) error {
+		for k := range labels {
+			if k == "" || strings.ContainsAny(k, " \t\r\n") {
+				return eris.Errorf("invalid label name %q", k)
+			}
+		}
+		s.Labels = labels
+		return nil
+	}
+}
+
+// WithARIVersion sets the version of the ARI interface of Asterisk (e.g.
+// "5.0.0"), instead of detecting it on connection
+func WithARIVersion(version string) Option {
+	return func(s *Server) error {
+		if _, err := parseARIVersion(version); err != nil {
+			return err
+		}
+		s.ARIVersion = version
+		return nil
+	}
+}
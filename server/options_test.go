@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
+	"github.com/inconshreveable/log15"
+)
+
+func TestNewOptions(t *testing.T) {
+	log := log15.New()
+	m := dialog.NewMemManager()
+
+	s := New(
+		WithPrefix("test."),
+		WithLogger(log),
+		WithDialogManager(m),
+		WithQuota(&QuotaConfig{Default: QuotaLimits{MaxChannels: 10}}),
+		WithCompression(&CompressionConfig{Kinds: []string{"SoundList"}}),
+		WithEmergencyDestinations("^911$"),
+		WithFanOut(&FanOutConfig{Workers: 4}),
+		WithShutdownGracePeriod(time.Second),
+		WithVersion("v1"),
+	)
+	if s.optErr != nil {
+		t.Fatalf("unexpected option error: %v", s.optErr)
+	}
+	if s.NATSPrefix != "test." || s.Log != log || s.Dialog != m || s.Quota.Default.MaxChannels != 10 ||
+		s.Compression == nil || len(s.EmergencyDestinations) != 1 || s.FanOut.Workers != 4 ||
+		s.ShutdownGracePeriod != time.Second || s.Version != "v1" {
+		t.Errorf("options not applied: %+v", s)
+	}
+
+	// Defaults
+	s = New()
+	if s.NATSPrefix != "ari." || s.Dialog == nil || s.Log == nil {
+		t.Errorf("unexpected defaults: %+v", s)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"prefix":       WithPrefix("ari"),
+		"ari version":  WithARIVersion("five"),
+		"max calls":    WithMaxCalls(-1),
+		"instance":     WithInstanceID("a b"),
+		"labels":       WithLabels(map[string]string{"": "eu-west-1"}),
+		"variables":    WithChannelVariables("CALLERID(num)", ""),
+		"jetstream":    WithJetStream(&JetStreamConfig{Stream: "ARI", Classes: []string{"get"}}),
+		"eventstream":  WithEventStream(&EventStreamConfig{Stream: "EVENTS", Storage: "tape"}),
+		"event route":  WithEventRoutes(EventRoute{Types: []string{"ChannelDtmfReceived"}, Subject: "dtmf.{application}"}),
+		"call flow":    WithCallFlows(CallFlow{Name: "all", Initial: "start", States: map[string]CallFlowState{"start": {}}}),
+		"keepalive":    WithKeepalive(&KeepaliveConfig{Interval: -time.Second}),
+		"reconnect":    WithARIReconnect(&ARIReconnectConfig{MaxBackoff: -time.Second}),
+		"dialog":       WithDialogManager(nil),
+		"logger":       WithLogger(nil),
+		"quota":        WithQuota(&QuotaConfig{Tenants: map[string]QuotaLimits{"acme": {MaxRecordings: -1}}}),
+		"compression":  WithCompression(&CompressionConfig{Kinds: []string{"NoSuchKind"}}),
+		"codec":        WithCodec("no-such-codec"),
+		"max response": WithMaxResponseSize(100),
+		"clock":        WithClock(nil),
+		"retry":        WithRetry(&RetryConfig{Kinds: []string{"NoSuchKind"}}),
+		"conflict":     WithStateConflict(&StateConflictConfig{Backoff: -time.Millisecond}),
+		"metrics":      WithMetrics(&MetricsConfig{Listen: ":9180", Path: "metrics"}),
+		"health":       WithHealthEndpoint(&HealthConfig{Listen: ":8086", LivenessPath: "/probe", ReadinessPath: "/probe"}),
+		"emergency":    WithEmergencyDestinations("(911"),
+		"fan-out":      WithFanOut(&FanOutConfig{Workers: -1}),
+		"dialog limit": WithDialogEventLimit(&DialogEventLimitConfig{Types: []string{"ChannelVarset"}}),
+		"varset":       WithVarsetFilter(&VarsetFilterConfig{Deny: []string{"RTPAUDIOQOS("}}),
+		"grace":        WithShutdownGracePeriod(0),
+		"drain":        WithDrainTimeout(-time.Second),
+		"systemd":      WithSystemd(&SystemdConfig{StatusInterval: -time.Second}),
+		"sound upload": WithSoundUpload(&SoundUploadConfig{Dir: "sounds"}),
+	} {
+		s := New(opt)
+		if s.optErr == nil {
+			t.Errorf("%s: expected option error", name)
+			continue
+		}
+
+		// The error is reported by Listen, before any connection is made
+		err := s.ListenOn(context.Background(), nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "invalid server option") {
+			t.Errorf("%s: unexpected listen error %v", name, err)
+		}
+	}
+}
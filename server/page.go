@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// PageAppArgs is the application argument of the paged channels, by which
+// applications may recognize (and ignore) their StasisStart events
+const PageAppArgs = "ari-proxy-page"
+
+// DefaultPageHeaders are the channel variables set on paged channels when the
+// request does not define its own.  They request that the device answers
+// automatically.
+var DefaultPageHeaders = map[string]string{
+	"PJSIP_HEADER(add,Alert-Info)": "<http://localhost>;info=alert-autoanswer;delay=0",
+	"PJSIP_HEADER(add,Call-Info)":  "<sip:localhost>;answer-after=0",
+}
+
+// DefaultPageTimeout is the default time to wait for a paged device to answer
+var DefaultPageTimeout = 10 * time.Second
+
+func (s *Server) page(ctx context.Context, reply string, req *proxy.Request) {
+	if req.Page == nil || len(req.Page.Endpoints) == 0 {
+		s.sendError(reply, eris.New("at least one endpoint is required"))
+		return
+	}
+
+	bridgeKey := ari.NewKey(ari.BridgeKey, rid.New(rid.Bridge))
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+		s.Dialog.Bind(req.Key.Dialog, "bridge", bridgeKey.ID)
+	}
+
+	// Subscribe before originating, so that no lifecycle events are missed
+	sub := s.ari.Bus().Subscribe(nil, ari.Events.StasisStart, ari.Events.StasisEnd, ari.Events.ChannelDestroyed)
+
+	bridge, err := s.ari.Bridge().Create(bridgeKey, "mixing", "page-"+req.Key.ID)
+	if err != nil {
+		sub.Cancel()
+		s.sendError(reply, eris.Wrap(err, "failed to create page bridge"))
+		return
+	}
+
+	if err = s.ari.Bridge().AddChannel(bridge.Key(), req.Key.ID); err != nil {
+		sub.Cancel()
+		s.destroyBridge(bridge.Key())
+		s.sendError(reply, eris.Wrap(err, "failed to add paging channel to bridge"))
+		return
+	}
+
+	legs := s.originatePages(req)
+	if len(legs) == 0 {
+		sub.Cancel()
+		s.destroyBridge(bridge.Key())
+		s.sendError(reply, eris.New("failed to page any endpoint"))
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: bridge.Key(),
+	})
+
+	go s.runPage(ctx, req, sub, bridge.Key(), legs)
+}
+
+// originatePages originates the paged channels, returning the set of channel
+// IDs which were successfully originated
+func (s *Server) originatePages(req *proxy.Request) map[string]bool {
+	timeout := DefaultPageTimeout
+	if req.Page.Timeout > 0 {
+		timeout = req.Page.Timeout
+	}
+
+	headers := req.Page.Headers
+	if headers == nil {
+		headers = DefaultPageHeaders
+	}
+
+	legs := make(map[string]bool)
+	for _, endpoint := range req.Page.Endpoints {
+		orig := ari.OriginateRequest{
+			Endpoint:   endpoint,
+			Timeout:    int(timeout / time.Second),
+			CallerID:   req.Page.CallerID,
+			App:        s.Application,
+			AppArgs:    PageAppArgs,
+			ChannelID:  rid.New(rid.Channel),
+			Originator: req.Key.ID,
+			Variables:  headers,
+		}
+
+		var err error
+		if orig.Endpoint, err = s.rewriteEndpoint(endpoint, req); err != nil {
+			s.Log.Warn("failed to page endpoint", "endpoint", endpoint, "error", err)
+			continue
+		}
+		if err = s.admitChannel(req, orig.ChannelID, true, endpoint, orig.Endpoint); err != nil {
+			s.Log.Warn("failed to page endpoint", "endpoint", endpoint, "error", err)
+			continue
+		}
+
+		if req.Key.Dialog != "" {
+			s.Dialog.Bind(req.Key.Dialog, "channel", orig.ChannelID)
+		}
+
+		if _, err = s.originate(req, orig); err != nil {
+			s.releaseChannel(orig.ChannelID)
+			s.Log.Warn("failed to page endpoint", "endpoint", endpoint, "error", err)
+			continue
+		}
+		legs[orig.ChannelID] = true
+	}
+	return legs
+}
+
+// runPage joins answered paged channels to the bridge, listen-only, and tears
+// the page down once the paging channel leaves, all paged channels have hung
+// up, or the maximum duration has elapsed.
+func (s *Server) runPage(ctx context.Context, req *proxy.Request, sub ari.Subscription, bridgeKey *ari.Key, legs map[string]bool) {
+	defer sub.Cancel()
+
+	ev := &proxy.PageFinished{
+		EventData: s.newEventData(proxy.EventPageFinished),
+		ChannelID: req.Key.ID,
+		BridgeID:  bridgeKey.ID,
+		Paged:     len(legs),
+	}
+
+	var maxDuration <-chan time.Time
+	if req.Page.MaxDuration > 0 {
+		t := time.NewTimer(req.Page.MaxDuration)
+		defer t.Stop()
+		maxDuration = t.C
+	}
+
+	remaining := len(legs)
+
+loop:
+	for remaining > 0 {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-maxDuration:
+			break loop
+		case e := <-sub.Events():
+			switch v := e.(type) {
+			case *ari.StasisStart:
+				if !legs[v.Channel.ID] {
+					continue
+				}
+				key := ari.NewKey(ari.ChannelKey, v.Channel.ID)
+				if err := s.ari.Channel().Mute(key, ari.DirectionIn); err != nil {
+					s.Log.Warn("failed to mute paged channel", "channel", v.Channel.ID, "error", err)
+				}
+				if err := s.ari.Bridge().AddChannel(bridgeKey, v.Channel.ID); err != nil {
+					s.Log.Warn("failed to add paged channel to bridge", "channel", v.Channel.ID, "error", err)
+					continue
+				}
+				ev.Answered++
+			case *ari.StasisEnd:
+				if v.Channel.ID == req.Key.ID {
+					break loop
+				}
+			case *ari.ChannelDestroyed:
+				if v.Channel.ID == req.Key.ID {
+					break loop
+				}
+				if legs[v.Channel.ID] {
+					delete(legs, v.Channel.ID)
+					remaining--
+				}
+			}
+		}
+	}
+
+	for id := range legs {
+		if err := s.ari.Channel().Hangup(ari.NewKey(ari.ChannelKey, id), "normal"); err != nil {
+			s.Log.Debug("failed to hang up paged channel", "channel", id, "error", err)
+		}
+	}
+	s.destroyBridge(bridgeKey)
+
+	s.publishEvent(ev)
+}
+
+func (s *Server) destroyBridge(key *ari.Key) {
+	if err := s.ari.Bridge().Delete(key); err != nil {
+		s.Log.Debug("failed to destroy bridge", "bridge", key.ID, "error", err)
+	}
+}
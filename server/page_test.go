@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/mock"
+)
+
+// pageTest runs a page against mock ARI, on which the given endpoints fail
+// to be originated
+type pageTest struct {
+	channel *arimocks.Channel
+	bridge  *arimocks.Bridge
+	events  chan ari.Event
+
+	// legs are the IDs of the originated channels, by endpoint
+	legs map[string]string
+	mu   sync.Mutex
+
+	// destroyed is closed once the page bridge is destroyed
+	destroyed chan struct{}
+}
+
+func newPageTest(failing ...string) *pageTest {
+	pt := &pageTest{
+		channel:   new(arimocks.Channel),
+		bridge:    new(arimocks.Bridge),
+		events:    make(chan ari.Event),
+		legs:      make(map[string]string),
+		destroyed: make(chan struct{}),
+	}
+
+	sub := new(arimocks.Subscription)
+	sub.On("Events").Return((<-chan ari.Event)(pt.events))
+	sub.On("Cancel").Return()
+	bus := new(arimocks.Bus)
+	bus.On("Subscribe", (*ari.Key)(nil), ari.Events.StasisStart, ari.Events.StasisEnd, ari.Events.ChannelDestroyed).Return(sub)
+
+	pt.channel.On("Originate", mock.Anything, mock.Anything).Return(nil, func(_ *ari.Key, o ari.OriginateRequest) error {
+		for _, endpoint := range failing {
+			if o.Endpoint == endpoint {
+				return errors.New("originate failed")
+			}
+		}
+		pt.mu.Lock()
+		pt.legs[o.Endpoint] = o.ChannelID
+		pt.mu.Unlock()
+		return nil
+	})
+	pt.channel.On("Mute", mock.Anything, ari.DirectionIn).Return(nil)
+	pt.channel.On("Hangup", mock.Anything, "normal").Return(nil)
+
+	pt.bridge.On("Create", mock.Anything, "mixing", "page-pager").Return(func(key *ari.Key, _, _ string) *ari.BridgeHandle {
+		return ari.NewBridgeHandle(key, pt.bridge, nil)
+	}, nil)
+	pt.bridge.On("AddChannel", mock.Anything, mock.Anything).Return(nil)
+	pt.bridge.On("Delete", mock.Anything).Return(nil).Run(func(mock.Arguments) { close(pt.destroyed) })
+
+	cl := new(arimocks.Client)
+	cl.On("Bus").Return(bus)
+	cl.On("Channel").Return(pt.channel)
+	cl.On("Bridge").Return(pt.bridge)
+
+	s := New()
+	s.ari = cl
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+
+	s.page(context.Background(), "", &proxy.Request{
+		Key:  ari.NewKey(ari.ChannelKey, "pager"),
+		Page: &proxy.Page{Endpoints: []string{"PJSIP/101", "PJSIP/102", "PJSIP/103"}},
+	})
+	return pt
+}
+
+func (pt *pageTest) leg(endpoint string) string {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.legs[endpoint]
+}
+
+func (pt *pageTest) send(e ari.Event) {
+	select {
+	case pt.events <- e:
+	case <-pt.destroyed:
+	}
+}
+
+func (pt *pageTest) waitDestroyed(t *testing.T) {
+	t.Helper()
+	select {
+	case <-pt.destroyed:
+	case <-time.After(time.Second):
+		t.Fatal("page bridge not destroyed")
+	}
+}
+
+func TestPage(t *testing.T) {
+	pt := newPageTest("PJSIP/102")
+
+	// The page proceeds with the endpoints which could be originated
+	pt.channel.AssertNumberOfCalls(t, "Originate", 3)
+	leg1, leg3 := pt.leg("PJSIP/101"), pt.leg("PJSIP/103")
+	if leg1 == "" || leg3 == "" || pt.leg("PJSIP/102") != "" {
+		t.Fatalf("unexpected paged channels %v", pt.legs)
+	}
+	pt.bridge.AssertCalled(t, "AddChannel", mock.Anything, "pager")
+
+	// Answered paged channels are bridged listen-only; other channels are
+	// ignored
+	pt.send(&ari.StasisStart{Channel: ari.ChannelData{ID: "other"}})
+	pt.send(&ari.StasisStart{Channel: ari.ChannelData{ID: leg1}})
+	pt.send(&ari.StasisStart{Channel: ari.ChannelData{ID: leg3}})
+
+	// The page ends once every paged channel has hung up
+	pt.send(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: leg1}})
+	pt.send(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: leg3}})
+	pt.waitDestroyed(t)
+
+	for _, id := range []string{leg1, leg3} {
+		pt.channel.AssertCalled(t, "Mute", ari.NewKey(ari.ChannelKey, id), ari.DirectionIn)
+		pt.bridge.AssertCalled(t, "AddChannel", mock.Anything, id)
+	}
+	pt.bridge.AssertNotCalled(t, "AddChannel", mock.Anything, "other")
+	pt.channel.AssertNotCalled(t, "Hangup", mock.Anything, mock.Anything)
+}
+
+func TestPageLeave(t *testing.T) {
+	pt := newPageTest()
+	leg1 := pt.leg("PJSIP/101")
+	pt.send(&ari.StasisStart{Channel: ari.ChannelData{ID: leg1}})
+
+	// The paged channels are hung up once the paging channel leaves
+	pt.send(&ari.StasisEnd{Channel: ari.ChannelData{ID: "pager"}})
+	pt.waitDestroyed(t)
+
+	for _, endpoint := range []string{"PJSIP/101", "PJSIP/102", "PJSIP/103"} {
+		pt.channel.AssertCalled(t, "Hangup", ari.NewKey(ari.ChannelKey, pt.leg(endpoint)), "normal")
+	}
+}
+
+func TestPageFailure(t *testing.T) {
+	pt := newPageTest("PJSIP/101", "PJSIP/102", "PJSIP/103")
+
+	// The bridge is destroyed when no endpoint could be paged
+	pt.waitDestroyed(t)
+	pt.channel.AssertNumberOfCalls(t, "Originate", 3)
+	pt.bridge.AssertNumberOfCalls(t, "AddChannel", 1)
+}
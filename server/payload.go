@@ -0,0 +1,140 @@
+package server
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// MinMaxResponseSize is the smallest MaxResponseSize which may be set, so that
+// chunks carry a meaningful amount of data besides their headers
+const MinMaxResponseSize = 1024
+
+// largeReplyEncodings are the encodings which a request accepts for a
+// response exceeding the maximum message size
+type largeReplyEncodings struct {
+	gzip    bool
+	chunked bool
+}
+
+// negotiateLargeReply records the encodings which the request accepts for a
+// response exceeding the maximum message size (as the client library does),
+// returning whether it accepts any
+func (s *Server) negotiateLargeReply(reply string, req *proxy.Request) bool {
+	if reply == "" {
+		return false
+	}
+	enc := largeReplyEncodings{
+		gzip:    s.CompressOversized && req.AcceptsEncoding(proxy.EncodingGzip),
+		chunked: req.AcceptsEncoding(proxy.EncodingChunked),
+	}
+	if enc == (largeReplyEncodings{}) {
+		return false
+	}
+	s.largeReplies.Store(reply, enc)
+	return true
+}
+
+// natsMaxPayload returns the maximum payload, in bytes, of the NATS
+// connection, as announced by the NATS server, or zero if it is not known
+func (s *Server) natsMaxPayload() int {
+	if s.nats != nil && s.nats.Conn != nil {
+		return int(s.nats.Conn.MaxPayload())
+	}
+	return 0
+}
+
+// checkMaxPayload logs the maximum payload of the NATS connection, warning if
+// the MaxResponseSize exceeds it
+func (s *Server) checkMaxPayload() {
+	max := s.natsMaxPayload()
+	s.Log.Debug("NATS maximum payload", "bytes", max)
+	if max > 0 && s.MaxResponseSize > max {
+		s.Log.Warn("maximum response size exceeds the maximum NATS payload, which applies instead", "max_response_size", s.MaxResponseSize, "max_payload", max)
+	}
+}
+
+// maxResponseSize returns the maximum size, in bytes, of a response message:
+// the MaxResponseSize of the server, if set and below the maximum payload of
+// its NATS connection, or else that maximum payload
+func (s *Server) maxResponseSize() int {
+	max := s.natsMaxPayload()
+	if s.MaxResponseSize > 0 && (max == 0 || s.MaxResponseSize < max) {
+		return s.MaxResponseSize
+	}
+	return max
+}
+
+// publishResponse publishes the encoding of a response.  A response larger
+// than the maximum size of a message is compressed, if CompressOversized is
+// set and the request accepts compressed responses, and then split into
+// chunks if the request accepts chunked responses, or else replaced by an
+// ErrResponseTooLarge error response, rather than failing to publish.
+func (s *Server) publishResponse(subject string, data []byte) error {
+	limit := s.maxResponseSize()
+	if limit <= 0 || len(data) <= limit {
+		return s.nats.Conn.Publish(subject, data)
+	}
+
+	var enc largeReplyEncodings
+	if v, ok := s.largeReplies.Load(subject); ok {
+		enc = v.(largeReplyEncodings)
+	}
+
+	if enc.gzip && !proxy.IsCompressed(data) {
+		compressed, err := proxy.CompressResponse(data)
+		if err != nil {
+			return err
+		}
+		s.metrics.oversizedCompressed("response")
+		if len(compressed) <= limit {
+			return s.nats.Conn.Publish(subject, compressed)
+		}
+		data = compressed
+	}
+
+	if enc.chunked {
+		s.metrics.responseChunked()
+		err := proxy.ChunkResponse(rid.New("ck"), data, limit, func(chunk []byte) error {
+			return s.nats.Conn.Publish(subject, chunk)
+		})
+		if err == nil || !eris.Is(err, proxy.ErrResponseTooLarge) {
+			return err
+		}
+	}
+
+	s.metrics.responseOversized()
+	s.Log.Warn("response exceeds the maximum message size", "subject", subject, "size", len(data), "max", limit, "chunked", enc.chunked)
+
+	resp := proxy.NewErrorResponse(eris.Wrapf(proxy.ErrResponseTooLarge, "response of %d bytes exceeds the maximum message size of %d bytes", len(data), limit))
+	resp.Instance = s.InstanceID
+	return proxy.EncodeWith(s.codec, resp, func(data []byte) error {
+		return s.nats.Conn.Publish(subject, data)
+	})
+}
+
+// fitEvent returns the encoding of an event of the given type to be published,
+// compressed if it exceeds the given maximum payload (of the NATS connection)
+// and CompressOversized is set.  It fails if the event exceeds the maximum
+// payload, as the NATS server would reject it.
+func (s *Server) fitEvent(typ string, data []byte, limit int) ([]byte, error) {
+	if limit <= 0 || len(data) <= limit {
+		return data, nil
+	}
+
+	size := len(data)
+	if s.CompressOversized {
+		compressed, err := proxy.CompressResponse(data)
+		if err != nil {
+			return nil, err
+		}
+		s.metrics.oversizedCompressed("event")
+		if len(compressed) <= limit {
+			return compressed, nil
+		}
+		size = len(compressed)
+	}
+
+	s.metrics.eventOversized(typ)
+	return nil, eris.Errorf("%s event of %d bytes exceeds the maximum NATS payload of %d bytes", typ, size, limit)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestNegotiateLargeReply(t *testing.T) {
+	s := New()
+
+	if s.negotiateLargeReply("r1", &proxy.Request{Kind: "SoundList"}) {
+		t.Error("responses should not be chunked unless accepted")
+	}
+	if s.negotiateLargeReply("", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingChunked}}) {
+		t.Error("requests without a reply subject should not be chunked")
+	}
+	if s.negotiateLargeReply("r2", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingGzip}}) {
+		t.Error("oversized responses should not be compressed unless enabled")
+	}
+	if !s.negotiateLargeReply("r3", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingGzip, proxy.EncodingChunked}}) {
+		t.Error("response should be chunked when accepted")
+	}
+	if v, ok := s.largeReplies.Load("r3"); !ok || v.(largeReplyEncodings) != (largeReplyEncodings{chunked: true}) {
+		t.Errorf("unexpected encodings %v", v)
+	}
+
+	s.CompressOversized = true
+	if !s.negotiateLargeReply("r4", &proxy.Request{Kind: "SoundList", AcceptEncoding: []string{proxy.EncodingGzip}}) {
+		t.Error("oversized response should be compressed when enabled")
+	}
+
+	if s.maxResponseSize() != 0 {
+		t.Error("maximum response size should be unknown without a NATS connection")
+	}
+	s.MaxResponseSize = 4096
+	if s.maxResponseSize() != 4096 {
+		t.Errorf("unexpected maximum response size: %d", s.maxResponseSize())
+	}
+}
+
+func TestFitEvent(t *testing.T) {
+	s := New()
+	data := []byte(`{"type":"ChannelVarset","value":"` + strings.Repeat("x", 2000) + `"}`)
+
+	if out, err := s.fitEvent("ChannelVarset", data, 4096); err != nil || !bytes.Equal(out, data) {
+		t.Error("events within the maximum payload should be unchanged")
+	}
+	if _, err := s.fitEvent("ChannelVarset", data, 1024); err == nil {
+		t.Error("oversized events should be rejected")
+	}
+
+	s.CompressOversized = true
+	out, err := s.fitEvent("ChannelVarset", data, 1024)
+	if err != nil || !proxy.IsCompressed(out) || len(out) > 1024 {
+		t.Fatalf("oversized event should be compressed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	s.metrics.write(&buf)
+	for _, line := range []string{
+		`ari_proxy_events_oversized_total{type="ChannelVarset"} 1`,
+		`ari_proxy_oversized_compressed_total{message="event"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("metrics lack %q", line)
+		}
+	}
+}
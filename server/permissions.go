@@ -0,0 +1,290 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// requiredSubject is a NATS subject which the server publishes or subscribes
+// to, and which its NATS user must therefore be permitted to use
+type requiredSubject struct {
+	// Name describes the use of the subject
+	Name string
+
+	Subject   string
+	Publish   bool
+	Subscribe bool
+}
+
+// requiredSubjects returns the NATS subjects which the server uses.  Subjects
+// which are scoped to an entity (e.g. a dialog) are represented by a subject
+// scoped to the given token, and the subjects of the node are omitted while
+// the Asterisk ID is unknown.
+func (s *Server) requiredSubjects(token string) (ret []requiredSubject) {
+	ret = append(ret,
+		requiredSubject{Name: "pings", Subject: s.Subjects.Ping(), Subscribe: true},
+		requiredSubject{Name: "pings of the cluster", Subject: s.Subjects.Ping(), Publish: true},
+	)
+	for _, class := range []string{"get", "data", "command", "create"} {
+		if s.streamsClass(class) {
+			continue
+		}
+		ret = append(ret,
+			requiredSubject{Name: class + " requests", Subject: s.Subjects.Request(class, "", ""), Subscribe: true},
+			requiredSubject{Name: class + " requests of the application", Subject: s.Subjects.Request(class, s.Application, ""), Subscribe: true},
+		)
+		if s.nodeID() != "" {
+			ret = append(ret, requiredSubject{Name: class + " requests of the node", Subject: s.Subjects.Request(class, s.Application, s.nodeID()), Subscribe: true})
+		}
+	}
+
+	ret = append(ret,
+		requiredSubject{Name: "announcements", Subject: s.Subjects.Announcement(), Publish: true},
+		requiredSubject{Name: "announcements of the cluster", Subject: s.Subjects.Announcement(), Subscribe: true},
+	)
+	if s.nodeID() != "" {
+		ret = append(ret, requiredSubject{Name: "events", Subject: s.nodeEventSubject("StasisStart"), Publish: true})
+		ret = append(ret, s.routedEventSubjects()...)
+	}
+	if s.JetStream != nil {
+		cfg := s.JetStream.withDefaults()
+		for _, c := range s.streamConsumers(cfg) {
+			ret = append(ret,
+				requiredSubject{Name: "JetStream consumer " + c.Name, Subject: cfg.APIPrefix + ".CONSUMER.DURABLE.CREATE." + cfg.Stream + "." + c.Name, Publish: true},
+				requiredSubject{Name: "JetStream deliveries of " + c.Name, Subject: c.Deliver, Subscribe: true},
+			)
+		}
+	}
+	if s.EventStream != nil {
+		cfg := s.EventStream.withDefaults()
+		if cfg.Create {
+			ret = append(ret,
+				requiredSubject{Name: "event stream information", Subject: cfg.APIPrefix + ".STREAM.INFO." + cfg.Stream, Publish: true},
+				requiredSubject{Name: "event stream creation", Subject: cfg.APIPrefix + ".STREAM.CREATE." + cfg.Stream, Publish: true},
+			)
+		}
+		ret = append(ret, requiredSubject{Name: "event acknowledgments", Subject: nats.InboxPrefix + token, Subscribe: true})
+	}
+	return append(ret,
+		requiredSubject{Name: "dialog events", Subject: s.Subjects.DialogEvent(token), Publish: true},
+		requiredSubject{Name: "audio forks", Subject: s.Subjects.Audio(token), Publish: true},
+		requiredSubject{Name: "log streams", Subject: s.Subjects.LogStream(token), Publish: true},
+		requiredSubject{Name: "replies to requests", Subject: nats.InboxPrefix + token, Publish: true},
+		requiredSubject{Name: "replies to broadcast requests", Subject: rid.New("rp"), Publish: true},
+	)
+}
+
+// PermissionViolation is a NATS permissions violation reported by the NATS
+// server, when the server's NATS user is denied the use of a subject
+type PermissionViolation struct {
+	// Publish indicates that the violation was of a publish, rather than of a
+	// subscription
+	Publish bool
+
+	// Subject is the subject which the user may not use
+	Subject string
+
+	// Time is the time of the first violation of the subject
+	Time time.Time
+
+	// Count is the number of violations of the subject
+	Count int64
+}
+
+// maxRecordedViolations bounds the number of distinct subjects whose
+// violations are recorded, as the subjects of dialogs, for instance, are
+// numerous
+const maxRecordedViolations = 100
+
+// permissionMonitor records the permissions violations reported on a NATS
+// connection, by subject
+type permissionMonitor struct {
+	violations []*PermissionViolation
+
+	// total is the number of violations reported
+	total int64
+
+	mu sync.Mutex
+}
+
+// handleError records the given asynchronous error of a NATS connection,
+// returning the violation, and whether it is the first violation of its
+// subject, if the error was a permissions violation
+func (m *permissionMonitor) handleError(nc *nats.Conn, sub *nats.Subscription, err error) (v PermissionViolation, first bool, ok bool) {
+	v, ok = parsePermissionViolation(err)
+	if !ok {
+		return v, false, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total++
+	for _, r := range m.violations {
+		if r.Subject == v.Subject && r.Publish == v.Publish {
+			r.Count++
+			return *r, false, true
+		}
+	}
+
+	v.Time = time.Now()
+	v.Count = 1
+	if len(m.violations) < maxRecordedViolations {
+		m.violations = append(m.violations, &v)
+	}
+	return v, true, true
+}
+
+// violated indicates whether the use of the subject was reported as a
+// violation
+func (m *permissionMonitor) violated(subject string, publish bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.violations {
+		if v.Subject == subject && v.Publish == publish {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the recorded violations, in the order of their first
+// occurrence, and the total number of violations reported
+func (m *permissionMonitor) list() (ret []PermissionViolation, total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.violations {
+		ret = append(ret, *v)
+	}
+	return ret, m.total
+}
+
+// watchPermissions records the permissions violations reported on the NATS
+// connection of the server, logging the first violation of each subject.  Any
+// error handler of the connection is still called.
+func (s *Server) watchPermissions(nc *nats.Conn) {
+	next := nc.Opts.AsyncErrorCB
+	nc.SetErrorHandler(func(c *nats.Conn, sub *nats.Subscription, err error) {
+		if v, first, ok := s.permissions.handleError(c, sub, err); ok && first {
+			s.Log.Error("NATS permissions violation", "subject", v.Subject, "publish", v.Publish)
+		}
+		if next != nil {
+			next(c, sub, err)
+		}
+	})
+}
+
+// permissionCheckTimeout is the time allowed for the NATS server to process
+// the subscriptions and publishes of the startup permission check
+const permissionCheckTimeout = 5 * time.Second
+
+// verifyPermissions checks that the server's NATS user may use every subject
+// which the server uses, failing with the subjects which it may not
+func (s *Server) verifyPermissions(timeout time.Duration) error {
+	denied, err := verifySubjects(s.nats.Conn, &s.permissions, s.requiredSubjects(rid.New("pv")), timeout)
+	if err != nil {
+		return eris.Wrap(err, "failed to verify NATS permissions")
+	}
+	if len(denied) > 0 {
+		return eris.Errorf("permission denied to %s", describeSubjects(denied))
+	}
+	return nil
+}
+
+// describeSubjects describes the operations on the given subjects
+func describeSubjects(list []requiredSubject) string {
+	var ret []string
+	for _, r := range list {
+		op := "subscribe to"
+		if r.Publish {
+			op = "publish to"
+		}
+		ret = append(ret, fmt.Sprintf("%s %q (%s)", op, r.Subject, r.Name))
+	}
+	return strings.Join(ret, ", ")
+}
+
+// parsePermissionViolation parses the error reported by the NATS server for a
+// permissions violation, such as:
+//
+//	nats: permissions violation for publish to "ari.announce"
+func parsePermissionViolation(err error) (v PermissionViolation, ok bool) {
+	if err == nil {
+		return v, false
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "permissions violation") {
+		return v, false
+	}
+
+	switch {
+	case strings.Contains(msg, "for publish to "):
+		v.Publish = true
+	case strings.Contains(msg, "for subscription to "):
+	default:
+		return v, false
+	}
+
+	// Subjects are case sensitive, so they are read from the original message
+	orig := err.Error()
+	i := strings.Index(orig, "\"")
+	if i < 0 {
+		return v, false
+	}
+	j := strings.Index(orig[i+1:], "\"")
+	if j < 0 {
+		return v, false
+	}
+	v.Subject = orig[i+1 : i+1+j]
+	return v, true
+}
+
+// permissionSettleTime is the time allowed for the asynchronous reports of
+// permissions violations to be delivered after the connection is flushed
+var permissionSettleTime = 250 * time.Millisecond
+
+// verifySubjects subscribes and publishes (an empty message) to each of the
+// subjects, as required, returning the subjects whose use was reported as a
+// permissions violation by the monitor of the connection
+func verifySubjects(nc *nats.Conn, m *permissionMonitor, subjects []requiredSubject, timeout time.Duration) (denied []requiredSubject, err error) {
+	var subs []*nats.Subscription
+	defer func() {
+		for _, sub := range subs {
+			sub.Unsubscribe() // nolint: errcheck
+		}
+	}()
+
+	for _, r := range subjects {
+		if r.Subscribe {
+			sub, err := nc.SubscribeSync(r.Subject)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+		if r.Publish {
+			if err := nc.Publish(r.Subject, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := nc.FlushTimeout(timeout); err != nil {
+		return nil, err
+	}
+	time.Sleep(permissionSettleTime)
+
+	for _, r := range subjects {
+		if (r.Subscribe && m.violated(r.Subject, false)) || (r.Publish && m.violated(r.Subject, true)) {
+			denied = append(denied, r)
+		}
+	}
+	return denied, nil
+}
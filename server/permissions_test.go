@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+func TestParsePermissionViolation(t *testing.T) {
+	for msg, want := range map[string]PermissionViolation{
+		`nats: permissions violation for publish to "ari.announce"`:                           {Publish: true, Subject: "ari.announce"},
+		`nats: Permissions Violation for Publish to "ari.event.App.node"`:                     {Publish: true, Subject: "ari.event.App.node"},
+		`nats: Permissions Violation for Subscription to "ari.create"`:                        {Subject: "ari.create"},
+		`nats: Permissions Violation for Subscription to "ari.create" using queue "ariproxy"`: {Subject: "ari.create"},
+	} {
+		v, ok := parsePermissionViolation(errors.New(msg))
+		if !ok || v.Publish != want.Publish || v.Subject != want.Subject {
+			t.Errorf("%s: got %+v, %v", msg, v, ok)
+		}
+	}
+
+	for _, err := range []error{nil, errors.New("nats: slow consumer, messages dropped"), errors.New("nats: permissions violation")} {
+		if _, ok := parsePermissionViolation(err); ok {
+			t.Errorf("%v: parsed as violation", err)
+		}
+	}
+}
+
+func TestPermissionMonitor(t *testing.T) {
+	m := new(permissionMonitor)
+	if _, _, ok := m.handleError(nil, nil, errors.New("nats: slow consumer, messages dropped")); ok {
+		t.Error("recorded other error as violation")
+	}
+
+	denied := errors.New(`nats: Permissions Violation for Publish to "ari.announce"`)
+	if v, first, ok := m.handleError(nil, nil, denied); !ok || !first || v.Count != 1 {
+		t.Errorf("unexpected first violation %+v, first %v", v, first)
+	}
+	if v, first, ok := m.handleError(nil, nil, denied); !ok || first || v.Count != 2 {
+		t.Errorf("unexpected repeated violation %+v, first %v", v, first)
+	}
+	m.handleError(nil, nil, errors.New(`nats: Permissions Violation for Subscription to "ari.ping"`))
+
+	if !m.violated("ari.announce", true) || m.violated("ari.announce", false) || m.violated("ari.ping", true) {
+		t.Error("unexpected violations")
+	}
+
+	list, total := m.list()
+	if total != 3 || len(list) != 2 || list[0].Subject != "ari.announce" || list[0].Count != 2 || list[1].Subject != "ari.ping" {
+		t.Errorf("unexpected list %+v, total %d", list, total)
+	}
+
+	// Distinct subjects are bounded
+	for i := 0; i < 2*maxRecordedViolations; i++ {
+		m.handleError(nil, nil, fmt.Errorf(`nats: Permissions Violation for Publish to "ari.dialogevent.%d"`, i))
+	}
+	if list, total = m.list(); len(list) != maxRecordedViolations || total != 3+2*maxRecordedViolations {
+		t.Errorf("recorded %d violations of %d", len(list), total)
+	}
+}
+
+func TestRequiredSubjects(t *testing.T) {
+	s := &Server{Application: "app", Subjects: proxy.NewSubjectBuilder("ari.")}
+
+	// Without the Asterisk ID, the subjects of the node are omitted
+	n := len(s.requiredSubjects("tok"))
+	s.AsteriskID = "node"
+	list := s.requiredSubjects("tok")
+	if len(list) != n+5 {
+		t.Errorf("got %d subjects with node, %d without", len(list), n)
+	}
+
+	want := map[string]bool{
+		"ari.ping":            false,
+		"ari.create.app.node": false,
+		"ari.announce":        true,
+		"ari.event.app.node":  true,
+		"ari.dialogevent.tok": true,
+		"_INBOX.tok":          true,
+	}
+	for _, r := range list {
+		if r.Publish == r.Subscribe {
+			t.Errorf("%s: both or neither of publish and subscribe", r.Subject)
+		}
+		if pub, ok := want[r.Subject]; ok {
+			if pub != r.Publish {
+				t.Errorf("%s: publish %v", r.Subject, r.Publish)
+			}
+			delete(want, r.Subject)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing subjects %v", want)
+	}
+}
@@ -2,12 +2,120 @@ package server
 
 import (
 	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
 )
 
+// playbackCommands are the valid playback control commands
+var playbackCommands = map[string]bool{
+	"restart": true,
+	"pause":   true,
+	"unpause": true,
+	"reverse": true,
+	"forward": true,
+}
+
+// languageRegex matches the valid sound languages (e.g. "en", "en_GB")
+var languageRegex = regexp.MustCompile(`^[A-Za-z]{2,3}([_-][A-Za-z0-9]+)*$`)
+
+// validatePlayOptions checks the optional parameters of a playback
+func validatePlayOptions(o proxy.PlayOptions) error {
+	if o.Language != "" && !languageRegex.MatchString(o.Language) {
+		return eris.Errorf("invalid language %q", o.Language)
+	}
+	if o.OffsetMS < 0 {
+		return eris.New("offsetms may not be negative")
+	}
+	if o.SkipMS < 0 {
+		return eris.New("skipms may not be negative")
+	}
+	return nil
+}
+
+// validateMedia checks the list of media URIs of a playback
+func validateMedia(media []string) error {
+	for _, uri := range media {
+		if uri == "" {
+			return eris.New("empty media URI")
+		}
+
+		// Asterisk separates multiple media URIs by commas
+		if len(media) > 1 && strings.Contains(uri, ",") {
+			return eris.Errorf("media URI %q of playlist may not contain a comma", uri)
+		}
+	}
+	return nil
+}
+
+// play starts a playback on the given channel or bridge, returning the key of
+// the playback.  Playlists and playback options, which are not supported by
+// the ARI client, are sent by the proxy's own REST request.
+func (s *Server) play(key *ari.Key, playbackID string, media []string, o proxy.PlayOptions) (*ari.Key, error) {
+	if len(media) == 1 && o.Empty() {
+		var ph *ari.PlaybackHandle
+		var err error
+		if key.Kind == ari.BridgeKey {
+			ph, err = s.ari.Bridge().Play(key, playbackID, media[0])
+		} else {
+			ph, err = s.ari.Channel().Play(key, playbackID, media[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ph.Key(), nil
+	}
+
+	if playbackID == "" {
+		playbackID = rid.New(rid.Playback)
+	}
+
+	params := url.Values{}
+	params.Set("media", strings.Join(media, ","))
+	if o.Language != "" {
+		params.Set("lang", o.Language)
+	}
+	if o.OffsetMS > 0 {
+		params.Set("offsetms", strconv.Itoa(o.OffsetMS))
+	}
+	if o.SkipMS > 0 {
+		params.Set("skipms", strconv.Itoa(o.SkipMS))
+	}
+
+	if len(media) > 1 {
+		s.playlists.add(playbackID, media)
+	}
+
+	resource := "/channels/"
+	if key.Kind == ari.BridgeKey {
+		resource = "/bridges/"
+	}
+	if err := s.rest.post(resource+url.PathEscape(key.ID)+"/play/"+url.PathEscape(playbackID), params); err != nil {
+		s.playlists.remove(playbackID)
+		return nil, err
+	}
+
+	return ari.NewKey(ari.PlaybackKey, playbackID, ari.WithApp(s.Application), ari.WithNode(s.nodeID())), nil
+}
+
 func (s *Server) playbackControl(ctx context.Context, reply string, req *proxy.Request) {
-	s.sendError(reply, s.ari.Playback().Control(req.Key, req.PlaybackControl.Command))
+	cmd := req.PlaybackControl.Command
+	if cmd == "stop" {
+		s.sendError(reply, eris.New("playbacks are stopped by PlaybackStop, not by a control command"))
+		return
+	}
+	if !playbackCommands[cmd] {
+		s.sendError(reply, eris.Errorf("invalid playback command %q", cmd))
+		return
+	}
+
+	s.sendError(reply, s.ari.Playback().Control(req.Key, cmd))
 }
 
 func (s *Server) playbackData(ctx context.Context, reply string, req *proxy.Request) {
@@ -38,6 +146,11 @@ func (s *Server) playbackGet(ctx context.Context, reply string, req *proxy.Reque
 }
 
 func (s *Server) playbackStop(ctx context.Context, reply string, req *proxy.Request) {
+	// bind dialog
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "playback", req.Key.ID)
+	}
+
 	s.sendError(reply, s.ari.Playback().Stop(req.Key))
 }
 
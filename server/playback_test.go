@@ -1,9 +1,14 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/internal/integration"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
 )
 
 func TestPlaybackData(t *testing.T) {
@@ -17,3 +22,75 @@ func TestPlaybackControl(t *testing.T) {
 func TestPlaybackStop(t *testing.T) {
 	integration.TestPlaybackStop(t, &srv{})
 }
+
+func TestValidatePlayOptions(t *testing.T) {
+	for _, o := range []proxy.PlayOptions{
+		{},
+		{Language: "en"},
+		{Language: "en_GB", OffsetMS: 1500, SkipMS: 5000},
+	} {
+		if err := validatePlayOptions(o); err != nil {
+			t.Errorf("%+v: unexpected error: %v", o, err)
+		}
+	}
+
+	for _, o := range []proxy.PlayOptions{
+		{Language: "en GB"},
+		{OffsetMS: -1},
+		{SkipMS: -1},
+	} {
+		if err := validatePlayOptions(o); err == nil {
+			t.Errorf("%+v: expected error", o)
+		}
+	}
+}
+
+func TestPlayWithOptions(t *testing.T) {
+	var path, query, user string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.RawQuery
+		user, _, _ = r.BasicAuth()
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	s := &Server{
+		Application: "app",
+		AsteriskID:  "node",
+		rest:        newARIREST(&native.Options{URL: ts.URL + "/ari", Username: "admin"}),
+	}
+
+	k, err := s.play(ari.NewKey(ari.BridgeKey, "b1"), "pb1", []string{"sound:hello"}, proxy.PlayOptions{Language: "fr", OffsetMS: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ID != "pb1" || k.Kind != ari.PlaybackKey || k.Node != "node" {
+		t.Errorf("unexpected playback key: %v", k)
+	}
+	if path != "/ari/bridges/b1/play/pb1" {
+		t.Errorf("unexpected path: %s", path)
+	}
+	if query != "lang=fr&media=sound%3Ahello&offsetms=500" {
+		t.Errorf("unexpected query: %s", query)
+	}
+	if user != "admin" {
+		t.Errorf("unexpected user: %s", user)
+	}
+
+	// A playlist is sent as a comma-separated list and tracked
+	if _, err := s.play(ari.NewKey(ari.ChannelKey, "c1"), "pb3", []string{"sound:one", "sound:two"}, proxy.PlayOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/ari/channels/c1/play/pb3" || query != "media=sound%3Aone%2Csound%3Atwo" {
+		t.Errorf("unexpected playlist request: %s?%s", path, query)
+	}
+	if _, ok := s.playlists.m["pb3"]; !ok {
+		t.Error("playlist should be tracked")
+	}
+
+	// Without connection parameters, the options cannot be applied
+	s.rest = nil
+	if _, err := s.play(ari.NewKey(ari.ChannelKey, "c1"), "pb2", []string{"sound:hello"}, proxy.PlayOptions{SkipMS: 1000}); err == nil {
+		t.Error("expected error without REST access")
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// playlist is a playback of multiple media URIs
+type playlist struct {
+	media []string
+
+	// index is the position of the item being played, or -1 if the playback
+	// has not yet started
+	index int
+}
+
+// playlistTracker tracks the progress of playlists, indexed by playback ID
+type playlistTracker struct {
+	m  map[string]*playlist
+	mu sync.Mutex
+}
+
+func (t *playlistTracker) add(playbackID string, media []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m == nil {
+		t.m = make(map[string]*playlist)
+	}
+	t.m[playbackID] = &playlist{
+		media: media,
+		index: -1,
+	}
+}
+
+func (t *playlistTracker) remove(playbackID string) {
+	t.mu.Lock()
+	delete(t.m, playbackID)
+	t.mu.Unlock()
+}
+
+// advance updates the playlists from the given event, returning the progress
+// of the playlist whose item it starts, if any
+func (t *playlistTracker) advance(e ari.Event) *proxy.PlaylistItemStarted {
+	var data ari.PlaybackData
+
+	switch v := e.(type) {
+	case *ari.PlaybackStarted:
+		data = v.Playback
+	case *ari.PlaybackContinuing:
+		data = v.Playback
+	case *ari.PlaybackFinished:
+		t.remove(v.Playback.ID)
+		return nil
+	default:
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.m[data.ID]
+	if !ok || p.index+1 >= len(p.media) {
+		return nil
+	}
+	p.index++
+
+	uri := p.media[p.index]
+	if data.MediaURI != "" {
+		uri = data.MediaURI
+	}
+	return &proxy.PlaylistItemStarted{
+		PlaybackID: data.ID,
+		TargetURI:  data.TargetURI,
+		Index:      p.index,
+		Count:      len(p.media),
+		MediaURI:   uri,
+	}
+}
+
+// processPlaylistEvent reports the progress of playlists, following the
+// playback events which start each item
+func (s *Server) processPlaylistEvent(e ari.Event) {
+	ev := s.playlists.advance(e)
+	if ev == nil {
+		return
+	}
+	ev.EventData = s.newEventData(proxy.EventPlaylistItemStarted)
+
+	s.publishEvent(ev)
+}
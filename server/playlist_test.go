@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestPlaylistTracker(t *testing.T) {
+	var pt playlistTracker
+	pt.add("pb1", []string{"sound:one", "sound:two"})
+
+	pb := ari.PlaybackData{ID: "pb1", TargetURI: "channel:c1", MediaURI: "sound:one"}
+
+	ev := pt.advance(&ari.PlaybackStarted{Playback: pb})
+	if ev == nil || ev.Index != 0 || ev.Count != 2 || ev.MediaURI != "sound:one" {
+		t.Fatalf("unexpected progress of first item: %+v", ev)
+	}
+	if keys := ev.Keys(); len(keys) != 2 || keys[1].Kind != ari.ChannelKey || keys[1].ID != "c1" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	pb.MediaURI = "sound:two"
+	ev = pt.advance(&ari.PlaybackContinuing{Playback: pb})
+	if ev == nil || ev.Index != 1 || ev.MediaURI != "sound:two" {
+		t.Fatalf("unexpected progress of second item: %+v", ev)
+	}
+
+	if ev := pt.advance(&ari.PlaybackContinuing{Playback: pb}); ev != nil {
+		t.Errorf("progress should not pass the end of the playlist: %+v", ev)
+	}
+
+	pt.advance(&ari.PlaybackFinished{Playback: pb})
+	if _, ok := pt.m["pb1"]; ok {
+		t.Error("finished playlist should no longer be tracked")
+	}
+
+	// Playbacks of single media are not reported
+	if ev := pt.advance(&ari.PlaybackStarted{Playback: ari.PlaybackData{ID: "pb2"}}); ev != nil {
+		t.Errorf("unexpected progress of untracked playback: %+v", ev)
+	}
+}
+
+func TestValidateMedia(t *testing.T) {
+	if err := validateMedia([]string{"sound:one", "recording:two"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateMedia([]string{"sound:one", ""}); err == nil {
+		t.Error("expected error for empty media URI")
+	}
+	if err := validateMedia([]string{"sound:one", "tone:ring,1"}); err == nil {
+		t.Error("expected error for comma in playlist")
+	}
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// QuotaLimits describes the set of resource limits which apply to a single
+// application or tenant.  A zero value for any limit indicates that the
+// resource is not limited.
+type QuotaLimits struct {
+	// MaxChannels is the maximum number of concurrent channels which may be
+	// created through the proxy
+	MaxChannels int `json:"max_channels" mapstructure:"max_channels"`
+
+	// OriginatesPerMinute is the maximum number of originations which may be
+	// requested within any one-minute window
+	OriginatesPerMinute int `json:"originates_per_minute" mapstructure:"originates_per_minute"`
+
+	// MaxRecordings is the maximum number of recordings which may be in
+	// progress at once
+	MaxRecordings int `json:"max_recordings" mapstructure:"max_recordings"`
+}
+
+// QuotaConfig describes the quotas to be enforced by the Server on its
+// creation requests.
+type QuotaConfig struct {
+	// Default is the set of limits applied to the application when no
+	// application-specific limits are defined
+	Default QuotaLimits `json:"default" mapstructure:"default"`
+
+	// Applications is the set of limits for specific ARI applications, indexed
+	// by application name
+	Applications map[string]QuotaLimits `json:"applications" mapstructure:"applications"`
+
+	// Tenants is the set of limits for specific tenants, indexed by tenant
+	// name.  Tenant limits are enforced in addition to application limits for
+	// any request which declares a tenant.
+	Tenants map[string]QuotaLimits `json:"tenants" mapstructure:"tenants"`
+}
+
+// QuotaStats describes the current usage and rejection counts of a quota
+// scope.
+type QuotaStats struct {
+	// Channels is the number of channels currently counted against the scope
+	Channels int `json:"channels"`
+
+	// Recordings is the number of recordings currently counted against the scope
+	Recordings int `json:"recordings"`
+
+	// Originates is the number of originations within the last minute
+	Originates int `json:"originates"`
+
+	// Rejected is the number of requests rejected, indexed by limit name
+	Rejected map[string]int64 `json:"rejected"`
+}
+
+const (
+	quotaChannels   = "max_channels"
+	quotaOriginates = "originates_per_minute"
+	quotaRecordings = "max_recordings"
+)
+
+// quotaScope identifies a set of limits and the usage counted against them
+type quotaScope struct {
+	name   string
+	limits QuotaLimits
+}
+
+type quotaUsage struct {
+	channels   map[string]struct{}
+	recordings map[string]struct{}
+	originates []time.Time
+	rejected   map[string]int64
+}
+
+func newQuotaUsage() *quotaUsage {
+	return &quotaUsage{
+		channels:   make(map[string]struct{}),
+		recordings: make(map[string]struct{}),
+		rejected:   make(map[string]int64),
+	}
+}
+
+// quotaEngine tracks resource usage and enforces the QuotaConfig
+type quotaEngine struct {
+	cfg *QuotaConfig
+
+	usage map[string]*quotaUsage
+
+	// clock is the time source of the origination rate limits.  It defaults
+	// to the system clock.
+	clock clock.Clock
+
+	mu sync.Mutex
+}
+
+// now returns the current time of the clock of the engine
+func (q *quotaEngine) now() time.Time {
+	if q.clock == nil {
+		return time.Now()
+	}
+	return q.clock.Now()
+}
+
+func newQuotaEngine(cfg *QuotaConfig) *quotaEngine {
+	return &quotaEngine{
+		cfg:   cfg,
+		usage: make(map[string]*quotaUsage),
+	}
+}
+
+// scopes returns the list of quota scopes which apply to the given application and tenant
+func (q *quotaEngine) scopes(app, tenant string) (ret []quotaScope) {
+	if q == nil || q.cfg == nil {
+		return nil
+	}
+
+	limits, ok := q.cfg.Applications[app]
+	if !ok {
+		limits = q.cfg.Default
+	}
+	ret = append(ret, quotaScope{name: "application " + app, limits: limits})
+
+	if tenant != "" {
+		if limits, ok := q.cfg.Tenants[tenant]; ok {
+			ret = append(ret, quotaScope{name: "tenant " + tenant, limits: limits})
+		}
+	}
+	return
+}
+
+func (q *quotaEngine) getUsage(scope string) *quotaUsage {
+	u, ok := q.usage[scope]
+	if !ok {
+		u = newQuotaUsage()
+		q.usage[scope] = u
+	}
+	return u
+}
+
+// AdmitChannel checks and reserves a new channel against the quotas of the
+// given application and tenant.  If originate is true, the origination rate
+// limit is also checked.
+func (q *quotaEngine) AdmitChannel(app, tenant, id string, originate bool) error {
+	scopes := q.scopes(app, tenant)
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+
+	for _, sc := range scopes {
+		u := q.getUsage(sc.name)
+
+		if sc.limits.MaxChannels > 0 && len(u.channels) >= sc.limits.MaxChannels {
+			u.rejected[quotaChannels]++
+			return eris.Errorf("quota exceeded: %s has reached its limit of %d concurrent channels", sc.name, sc.limits.MaxChannels)
+		}
+
+		if originate && sc.limits.OriginatesPerMinute > 0 {
+			u.originates = pruneOriginates(u.originates, now)
+			if len(u.originates) >= sc.limits.OriginatesPerMinute {
+				u.rejected[quotaOriginates]++
+				return eris.Errorf("quota exceeded: %s has reached its limit of %d originates per minute", sc.name, sc.limits.OriginatesPerMinute)
+			}
+		}
+	}
+
+	q.reserveChannel(scopes, id, originate, now)
+
+	return nil
+}
+
+// ReserveChannel records a new channel against the quotas of the given
+// application and tenant without checking the limits.  It is used for
+// channels which are exempt from quota enforcement.
+func (q *quotaEngine) ReserveChannel(app, tenant, id string, originate bool) {
+	scopes := q.scopes(app, tenant)
+	if len(scopes) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	q.reserveChannel(scopes, id, originate, q.now())
+	q.mu.Unlock()
+}
+
+func (q *quotaEngine) reserveChannel(scopes []quotaScope, id string, originate bool, now time.Time) {
+	for _, sc := range scopes {
+		u := q.getUsage(sc.name)
+		u.channels[id] = struct{}{}
+		if originate {
+			u.originates = append(u.originates, now)
+		}
+	}
+}
+
+// AdmitRecording checks and reserves a new recording against the quotas of the
+// given application and tenant.
+func (q *quotaEngine) AdmitRecording(app, tenant, name string) error {
+	scopes := q.scopes(app, tenant)
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, sc := range scopes {
+		u := q.getUsage(sc.name)
+
+		if sc.limits.MaxRecordings > 0 && len(u.recordings) >= sc.limits.MaxRecordings {
+			u.rejected[quotaRecordings]++
+			return eris.Errorf("quota exceeded: %s has reached its limit of %d recordings in progress", sc.name, sc.limits.MaxRecordings)
+		}
+	}
+
+	for _, sc := range scopes {
+		q.getUsage(sc.name).recordings[name] = struct{}{}
+	}
+
+	return nil
+}
+
+// ReleaseChannel removes the channel from all quota scopes
+func (q *quotaEngine) ReleaseChannel(id string) {
+	if q == nil || q.cfg == nil {
+		return
+	}
+
+	q.mu.Lock()
+	for _, u := range q.usage {
+		delete(u.channels, id)
+	}
+	q.mu.Unlock()
+}
+
+// ReleaseRecording removes the recording from all quota scopes
+func (q *quotaEngine) ReleaseRecording(name string) {
+	if q == nil || q.cfg == nil {
+		return
+	}
+
+	q.mu.Lock()
+	for _, u := range q.usage {
+		delete(u.recordings, name)
+	}
+	q.mu.Unlock()
+}
+
+// ProcessEvent releases resources based on the lifecycle events received from ARI
+func (q *quotaEngine) ProcessEvent(e ari.Event) {
+	switch v := e.(type) {
+	case *ari.ChannelDestroyed:
+		q.ReleaseChannel(v.Channel.ID)
+	case *ari.RecordingFinished:
+		q.ReleaseRecording(v.Recording.Name)
+	case *ari.RecordingFailed:
+		q.ReleaseRecording(v.Recording.Name)
+	}
+}
+
+// Stats returns the current usage statistics, indexed by scope name
+func (q *quotaEngine) Stats() map[string]QuotaStats {
+	ret := make(map[string]QuotaStats)
+	if q == nil {
+		return ret
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	for name, u := range q.usage {
+		u.originates = pruneOriginates(u.originates, now)
+
+		rejected := make(map[string]int64, len(u.rejected))
+		for k, v := range u.rejected {
+			rejected[k] = v
+		}
+
+		ret[name] = QuotaStats{
+			Channels:   len(u.channels),
+			Recordings: len(u.recordings),
+			Originates: len(u.originates),
+			Rejected:   rejected,
+		}
+	}
+	return ret
+}
+
+// admitChannel admits a new channel for the given request against the Server's
+// quotas and originate policies, recording it as originated by the proxy.
+// Channels for emergency destinations are counted but never rejected.
+func (s *Server) admitChannel(req *proxy.Request, id string, originate bool, destinations ...string) error {
+	if s.emergencyBypass("quota", req.Tenant, destinations...) {
+		s.quota.ReserveChannel(s.Application, req.Tenant, id, originate)
+		s.originated.add(id)
+		return nil
+	}
+	if err := s.quota.AdmitChannel(s.Application, req.Tenant, id, originate); err != nil {
+		return err
+	}
+	if err := s.checkOriginatePolicies(req, id, destinations...); err != nil {
+		s.quota.ReleaseChannel(id)
+		return err
+	}
+	s.originated.add(id)
+	return nil
+}
+
+// pruneOriginates removes origination timestamps which are older than one minute
+func pruneOriginates(list []time.Time, now time.Time) []time.Time {
+	var i int
+	for i < len(list) && now.Sub(list[i]) >= time.Minute {
+		i++
+	}
+	return list[i:]
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestQuotaDisabled(t *testing.T) {
+	q := newQuotaEngine(nil)
+
+	for i := 0; i < 100; i++ {
+		if err := q.AdmitChannel("app", "", "c", true); err != nil {
+			t.Errorf("unexpected error from disabled quota engine: %s", err)
+		}
+	}
+}
+
+func TestQuotaMaxChannels(t *testing.T) {
+	q := newQuotaEngine(&QuotaConfig{
+		Default: QuotaLimits{MaxChannels: 2},
+	})
+
+	if err := q.AdmitChannel("app", "", "c1", false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := q.AdmitChannel("app", "", "c2", false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := q.AdmitChannel("app", "", "c3", false); err == nil {
+		t.Error("expected quota error for third channel")
+	}
+
+	q.ProcessEvent(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c1"}})
+
+	if err := q.AdmitChannel("app", "", "c3", false); err != nil {
+		t.Errorf("unexpected error after release: %s", err)
+	}
+
+	stats := q.Stats()["application app"]
+	if stats.Channels != 2 {
+		t.Errorf("incorrect channel count: %d != 2", stats.Channels)
+	}
+	if stats.Rejected[quotaChannels] != 1 {
+		t.Errorf("incorrect rejection count: %d != 1", stats.Rejected[quotaChannels])
+	}
+}
+
+func TestQuotaTenant(t *testing.T) {
+	q := newQuotaEngine(&QuotaConfig{
+		Applications: map[string]QuotaLimits{
+			"app": {MaxRecordings: 2},
+		},
+		Tenants: map[string]QuotaLimits{
+			"acme": {MaxRecordings: 1},
+		},
+	})
+
+	if err := q.AdmitRecording("app", "acme", "r1"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := q.AdmitRecording("app", "acme", "r2"); err == nil {
+		t.Error("expected tenant quota error")
+	}
+	if err := q.AdmitRecording("app", "other", "r3"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := q.AdmitRecording("app", "other", "r4"); err == nil {
+		t.Error("expected application quota error")
+	}
+
+	q.ProcessEvent(&ari.RecordingFinished{Recording: ari.LiveRecordingData{Name: "r1"}})
+
+	if err := q.AdmitRecording("app", "acme", "r5"); err != nil {
+		t.Errorf("unexpected error after release: %s", err)
+	}
+}
+
+func TestQuotaOriginateRate(t *testing.T) {
+	q := newQuotaEngine(&QuotaConfig{
+		Default: QuotaLimits{OriginatesPerMinute: 1},
+	})
+
+	if err := q.AdmitChannel("app", "", "c1", true); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := q.AdmitChannel("app", "", "c2", true); err == nil {
+		t.Error("expected originate rate error")
+	}
+
+	// Non-originate channel creation is not rate-limited
+	if err := q.AdmitChannel("app", "", "c3", false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestPruneOriginates(t *testing.T) {
+	now := time.Now()
+	list := []time.Time{now.Add(-2 * time.Minute), now.Add(-time.Minute), now.Add(-time.Second)}
+
+	if l := len(pruneOriginates(list, now)); l != 1 {
+		t.Errorf("incorrect pruned length: %d != 1", l)
+	}
+}
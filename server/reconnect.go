@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/CyCoreSystems/ari/v5/stdbus"
+	"github.com/rotisserie/eris"
+)
+
+// ARIReconnectConfig describes the reconnection of a server to ARI when its
+// connection is lost (the keepalive times out) or Asterisk restarts (its
+// entity ID changes), instead of stopping the server.  The NATS connection
+// and subscriptions are kept while ARI is reconnected; the events emitted by
+// Asterisk in the meantime are lost.  Reconnection is only available to
+// servers run by Listen, which owns the ARI connection.
+type ARIReconnectConfig struct {
+	// InitialBackoff is the time to wait after the first failed attempt to
+	// reconnect.  It is doubled after each further failure.  It defaults to
+	// DefaultARIReconnectInitialBackoff.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+
+	// MaxBackoff is the maximum time between attempts to reconnect.  It
+	// defaults to DefaultARIReconnectMaxBackoff.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// Defaults of the ARIReconnectConfig
+const (
+	DefaultARIReconnectInitialBackoff = time.Second
+	DefaultARIReconnectMaxBackoff     = 30 * time.Second
+)
+
+func (cfg ARIReconnectConfig) withDefaults() ARIReconnectConfig {
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultARIReconnectInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultARIReconnectMaxBackoff
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	return cfg
+}
+
+// backoff returns the time to wait after the given number of consecutive
+// failed attempts
+func (cfg ARIReconnectConfig) backoff(failures int) time.Duration {
+	d := cfg.InitialBackoff
+	for i := 1; i < failures && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	return d
+}
+
+// reconnectingClient is an ARI client whose underlying native connection may
+// be replaced.  Its event bus outlives the native connections, so that the
+// subscriptions of the server survive reconnections.
+type reconnectingClient struct {
+	opts *native.Options
+	bus  ari.Bus
+
+	cur *native.Client
+	mu  sync.RWMutex
+}
+
+func newReconnectingClient(opts *native.Options) *reconnectingClient {
+	return &reconnectingClient{
+		opts: opts,
+		bus:  stdbus.New(),
+	}
+}
+
+// connect attempts to establish a new native connection, replacing the
+// current one if it succeeds
+func (c *reconnectingClient) connect() error {
+	n := native.New(c.opts)
+
+	// Check that the REST interface answers before connecting the WebSocket,
+	// which is retried indefinitely by the native client
+	if _, err := n.Asterisk().Info(nil); err != nil {
+		return eris.Wrap(err, "failed to get Asterisk info")
+	}
+	if err := n.Connect(); err != nil {
+		return eris.Wrap(err, "failed to connect to ARI")
+	}
+
+	// Forward the events of the new connection to the bus of the client,
+	// until the connection is closed
+	sub := n.Bus().Subscribe(nil, ari.Events.All)
+	go func() {
+		for e := range sub.Events() {
+			c.bus.Send(e)
+		}
+	}()
+
+	c.mu.Lock()
+	old := c.cur
+	c.cur = n
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+func (c *reconnectingClient) current() *native.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cur
+}
+
+// ApplicationName implements ari.Client
+func (c *reconnectingClient) ApplicationName() string {
+	return c.opts.Application
+}
+
+// Bus implements ari.Client
+func (c *reconnectingClient) Bus() ari.Bus {
+	return c.bus
+}
+
+// Connected implements ari.Client
+func (c *reconnectingClient) Connected() bool {
+	n := c.current()
+	return n != nil && n.Connected()
+}
+
+// Close implements ari.Client
+func (c *reconnectingClient) Close() {
+	if n := c.current(); n != nil {
+		n.Close()
+	}
+	c.bus.Close()
+}
+
+// Application implements ari.Client
+func (c *reconnectingClient) Application() ari.Application { return c.current().Application() }
+
+// Asterisk implements ari.Client
+func (c *reconnectingClient) Asterisk() ari.Asterisk { return c.current().Asterisk() }
+
+// Bridge implements ari.Client
+func (c *reconnectingClient) Bridge() ari.Bridge { return c.current().Bridge() }
+
+// Channel implements ari.Client
+func (c *reconnectingClient) Channel() ari.Channel { return c.current().Channel() }
+
+// DeviceState implements ari.Client
+func (c *reconnectingClient) DeviceState() ari.DeviceState { return c.current().DeviceState() }
+
+// Endpoint implements ari.Client
+func (c *reconnectingClient) Endpoint() ari.Endpoint { return c.current().Endpoint() }
+
+// LiveRecording implements ari.Client
+func (c *reconnectingClient) LiveRecording() ari.LiveRecording { return c.current().LiveRecording() }
+
+// Mailbox implements ari.Client
+func (c *reconnectingClient) Mailbox() ari.Mailbox { return c.current().Mailbox() }
+
+// Playback implements ari.Client
+func (c *reconnectingClient) Playback() ari.Playback { return c.current().Playback() }
+
+// Sound implements ari.Client
+func (c *reconnectingClient) Sound() ari.Sound { return c.current().Sound() }
+
+// StoredRecording implements ari.Client
+func (c *reconnectingClient) StoredRecording() ari.StoredRecording {
+	return c.current().StoredRecording()
+}
+
+// TextMessage implements ari.Client
+func (c *reconnectingClient) TextMessage() ari.TextMessage { return c.current().TextMessage() }
+
+// ariLost handles the loss of the ARI connection, or the restart of
+// Asterisk, for the given reason.  The server is stopped with the reason,
+// unless it reconnects to ARI.
+func (s *Server) ariLost(reason error) {
+	if s.reconnector == nil {
+		s.stop(reason)
+		return
+	}
+	select {
+	case s.reconnector.lost <- reason:
+	default:
+		// A reconnection is already pending
+	}
+}
+
+// ariReconnector reconnects the ARI client of a server
+type ariReconnector struct {
+	client *reconnectingClient
+	cfg    ARIReconnectConfig
+	lost   chan error
+}
+
+// connectARI establishes a new connection of the reconnecting client, retrying with backoff until it succeeds or the context is closed
+func (s *Server) connectARI(ctx context.Context) error {
+	for failures := 0; ; failures++ {
+		err := s.reconnector.client.connect()
+		if err == nil {
+			return nil
+		}
+
+		wait := s.reconnector.cfg.backoff(failures + 1)
+		s.Log.Warn("failed to connect to ARI; retrying", "error", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock().After(wait):
+		}
+	}
+}
+
+// runARIReconnector reconnects to ARI each time the connection is reported
+// lost, until the context is closed
+func (s *Server) runARIReconnector(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reason := <-s.reconnector.lost:
+			s.Log.Warn("ARI connection lost; reconnecting", "reason", reason)
+			if err := s.connectARI(ctx); err != nil {
+				return
+			}
+			if err := s.ariReconnected(); err != nil {
+				s.Log.Error("failed to resume after ARI reconnection", "error", err)
+				s.stop(err)
+				return
+			}
+
+			// Forget the losses reported while reconnecting
+			select {
+			case <-s.reconnector.lost:
+			default:
+			}
+		}
+	}
+}
+
+// ariReconnected refreshes the state of the server derived from Asterisk
+// once ARI is reconnected, and announces the server
+func (s *Server) ariReconnected() error {
+	info, err := s.ari.Asterisk().Info(nil)
+	if err != nil {
+		return eris.Wrap(err, "failed to get Asterisk ID")
+	}
+	id := info.SystemInfo.EntityID
+	if id == "" {
+		return eris.New("empty Asterisk ID")
+	}
+	s.ariContact.touch(s.clock().Now())
+	s.inventory.setVersion(info.SystemInfo.Version)
+	s.detectARIVersion()
+	s.refreshChannelDrivers()
+	if s.keepalive != nil {
+		s.keepalive.reset()
+		if err := s.subscribeKeepalive(); err != nil {
+			return err
+		}
+	}
+
+	if old := s.nodeID(); id != old {
+		s.Log.Warn("Asterisk entity ID changed on reconnection", "old", old, "new", id)
+		if err := s.moveNode(id); err != nil {
+			return err
+		}
+	}
+
+	s.Log.Info("ARI reconnected", "asterisk", s.nodeID())
+	s.announce()
+	return nil
+}
+
+// moveNode moves the server to the given Asterisk entity ID, subscribing to
+// the requests addressed to the new node in place of the old one.  The
+// JetStream consumers of the node cannot be moved, so a server which consumes
+// requests from JetStream stops with ErrEntityIDChanged instead.
+func (s *Server) moveNode(id string) error {
+	if s.streamsClass("command") || s.streamsClass("create") {
+		return ErrEntityIDChanged
+	}
+
+	// Hold the node while it moves, so that the subscriptions are not
+	// changed concurrently by the shutdown of the server
+	s.nodeMu.Lock()
+	defer s.nodeMu.Unlock()
+	if s.nodeClosed {
+		return nil
+	}
+	if err := s.unsubscribeNodeLocked(); err != nil {
+		s.Log.Warn("failed to unsubscribe from the requests of the old node", "error", err)
+	}
+	s.AsteriskID = id
+	return s.subscribeNodeLocked()
+}
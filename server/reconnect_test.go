@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/natstest"
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/nats-io/nats.go"
+)
+
+func TestARIReconnectBackoff(t *testing.T) {
+	cfg := ARIReconnectConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}.withDefaults()
+	for failures, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	} {
+		if got := cfg.backoff(failures); got != want {
+			t.Errorf("backoff after %d failures is %v, want %v", failures, got, want)
+		}
+	}
+
+	cfg = ARIReconnectConfig{InitialBackoff: time.Minute}.withDefaults()
+	if cfg.MaxBackoff != time.Minute {
+		t.Errorf("maximum backoff %v is below the initial backoff", cfg.MaxBackoff)
+	}
+}
+
+func TestARILost(t *testing.T) {
+	s := New()
+	s.ariLost(ErrARIKeepaliveTimeout)
+	if err := s.stopErr(); err != ErrARIKeepaliveTimeout {
+		t.Errorf("server without reconnection stopped with %v", err)
+	}
+
+	s = New(WithARIReconnect(new(ARIReconnectConfig)))
+	s.reconnector = &ariReconnector{lost: make(chan error, 1)}
+	s.ariLost(ErrEntityIDChanged)
+	s.ariLost(ErrARIKeepaliveTimeout)
+	if err := s.stopErr(); err != nil {
+		t.Errorf("server with reconnection stopped with %v", err)
+	}
+	if reason := <-s.reconnector.lost; reason != ErrEntityIDChanged {
+		t.Errorf("unexpected reason %v", reason)
+	}
+}
+
+func TestKeepaliveReset(t *testing.T) {
+	k := newKeepaliveTracker(new(KeepaliveConfig), "app")
+	k.ping()
+	k.ping()
+	if k.healthy() {
+		t.Fatal("missed ping not counted")
+	}
+	k.reset()
+	if !k.healthy() {
+		t.Error("reset keepalive is unhealthy")
+	}
+	if _, missed := k.ping(); missed != 0 {
+		t.Errorf("missed %d pings after reset", missed)
+	}
+}
+
+// TestMoveNodeDuringRequests moves the server between nodes while requests
+// are in flight, for the race detector
+func TestMoveNodeDuringRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ns, err := natstest.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	nc, err := nats.Connect(ns.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	channel := &arimocks.Channel{}
+	channel.On("List", (*ari.Key)(nil)).Return(nil, nil)
+	bridge := &arimocks.Bridge{}
+	bridge.On("List", (*ari.Key)(nil)).Return(nil, nil)
+	cl := &arimocks.Client{}
+	cl.On("Connected").Return(true)
+	cl.On("Channel").Return(channel)
+	cl.On("Bridge").Return(bridge)
+
+	s := New()
+	s.ari = cl
+	s.nats = &nats.EncodedConn{Conn: nc}
+	s.Application = "app"
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+	s.requestHandler = s.newRequestHandler(ctx)
+	s.setNodeID("node0")
+	if err := s.subscribeNode(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(&proxy.Request{Kind: "ClusterInfo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	answered := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				// Requests to a node which moves away are not answered
+				m, err := nc.Request(s.Subjects.Request("get", "app", s.nodeID()), data, 100*time.Millisecond)
+				if err != nil {
+					continue
+				}
+				var resp proxy.Response
+				if err := json.Unmarshal(m.Data, &resp); err != nil || resp.Err() != nil {
+					t.Errorf("failed request: %v %v", err, resp.Err())
+					continue
+				}
+				mu.Lock()
+				answered++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 20; i++ {
+			if err := s.moveNode(fmt.Sprintf("node%d", i)); err != nil {
+				t.Errorf("failed to move node: %v", err)
+			}
+			s.announce()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	if answered == 0 {
+		t.Error("no request was answered")
+	}
+
+	// Shutdown races the last move, which does not subscribe again once the
+	// node is closed
+	done := make(chan struct{})
+	go func() {
+		s.moveNode("node21") // nolint: errcheck
+		close(done)
+	}()
+	if err := s.closeNode(); err != nil {
+		t.Error(err)
+	}
+	<-done
+	if err := s.moveNode("node22"); err != nil {
+		t.Error(err)
+	}
+	s.nodeMu.RLock()
+	defer s.nodeMu.RUnlock()
+	if len(s.nodeSubs) != 0 {
+		t.Errorf("%d node subscriptions left after shutdown", len(s.nodeSubs))
+	}
+}
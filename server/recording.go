@@ -0,0 +1,343 @@
+package server
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// RecordingConfig describes the naming of recordings.
+//
+// Recording names may be templates, containing the placeholders:
+//
+//	{date}     the date, as YYYYMMDD
+//	{time}     the time, as HHMMSS
+//	{channel}  the ID of the recorded channel
+//	{bridge}   the ID of the recorded bridge
+//	{dialog}   the dialog of the request
+//	{app}      the name of the ARI application
+//	{id}       a unique ID
+//
+// For example, "calls/{date}/{channel}-{id}".
+type RecordingConfig struct {
+	// NameTemplate is the template of the names of recordings which are
+	// requested without a name.  It defaults to "{id}".
+	NameTemplate string `mapstructure:"name_template"`
+
+	// IfExists is the policy ("fail", "overwrite", or "append") for
+	// recordings whose request does not specify what to do if the recording
+	// already exists.  If not set, Asterisk's default ("fail") applies.
+	IfExists string `mapstructure:"if_exists"`
+
+	// ArchiveURL is the URL template of the recordings offloaded to an
+	// archive, which is reported by RecordingStored events.  It may contain
+	// the placeholders {name}, {format}, and {app}, such as
+	// "https://archive.example.com/{app}/{name}.{format}".
+	ArchiveURL string `mapstructure:"archive_url"`
+}
+
+// DefaultRecordingNameTemplate is the template of the names of recordings
+// which are requested without a name
+const DefaultRecordingNameTemplate = "{id}"
+
+var recordingPlaceholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// recordingNameRegex matches the valid recording names, which may contain
+// directories
+var recordingNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.@+-]+(/[A-Za-z0-9_.@+-]+)*$`)
+
+// expandRecordingName expands the placeholders of the given recording name
+// template for a recording of the given channel or bridge
+func expandRecordingName(tmpl string, key *ari.Key, app string, now time.Time) (string, error) {
+	var err error
+	name := recordingPlaceholderRegex.ReplaceAllStringFunc(tmpl, func(p string) string {
+		var v string
+		switch p {
+		case "{date}":
+			v = now.Format("20060102")
+		case "{time}":
+			v = now.Format("150405")
+		case "{channel}":
+			if key.Kind == ari.ChannelKey {
+				v = key.ID
+			}
+		case "{bridge}":
+			if key.Kind == ari.BridgeKey {
+				v = key.ID
+			}
+		case "{dialog}":
+			v = key.Dialog
+		case "{app}":
+			v = app
+		case "{id}":
+			v = rid.New(rid.Recording)
+		default:
+			err = eris.Errorf("unknown recording name placeholder %s", p)
+			return p
+		}
+		if v == "" && err == nil {
+			err = eris.Errorf("recording name placeholder %s has no value", p)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !recordingNameRegex.MatchString(name) {
+		return "", eris.Errorf("invalid recording name %q", name)
+	}
+	for _, dir := range strings.Split(name, "/") {
+		if dir == "." || dir == ".." {
+			return "", eris.Errorf("invalid recording name %q", name)
+		}
+	}
+	return name, nil
+}
+
+// recordingName returns the name of a recording of the given channel or
+// bridge, given the requested name.  An empty name is generated from the
+// configured template, and a name containing placeholders is expanded.
+func (s *Server) recordingName(name string, key *ari.Key) (string, error) {
+	if name != "" && !strings.Contains(name, "{") {
+		return name, nil
+	}
+
+	if name == "" {
+		if s.Recording == nil || s.Recording.NameTemplate == "" {
+			return rid.New(rid.Recording), nil
+		}
+		name = s.Recording.NameTemplate
+	}
+	return expandRecordingName(name, key, s.Application, time.Now())
+}
+
+// validateRecordingLimits checks the duration limits of a recording, which
+// Asterisk only supports in whole seconds
+func validateRecordingLimits(opts *ari.RecordingOptions) error {
+	if opts.MaxDuration < 0 || opts.MaxDuration%time.Second != 0 {
+		return eris.Errorf("invalid maximum recording duration %s: must be a whole number of seconds", opts.MaxDuration)
+	}
+	if opts.MaxSilence < 0 || opts.MaxSilence%time.Second != 0 {
+		return eris.Errorf("invalid maximum recording silence %s: must be a whole number of seconds", opts.MaxSilence)
+	}
+	return nil
+}
+
+// recordingOptions validates the options of a recording and applies the
+// configured collision policy
+func (s *Server) recordingOptions(opts *ari.RecordingOptions) (*ari.RecordingOptions, error) {
+	if opts != nil {
+		if err := validateRecordingLimits(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts == nil || opts.Exists == "" {
+		if s.Recording == nil || s.Recording.IfExists == "" {
+			return opts, nil
+		}
+
+		o := new(ari.RecordingOptions)
+		if opts != nil {
+			*o = *opts
+		}
+		o.Exists = s.Recording.IfExists
+		opts = o
+	}
+
+	switch opts.Exists {
+	case "fail", "overwrite", "append":
+		return opts, nil
+	default:
+		return nil, eris.Errorf("invalid recording ifExists policy %q", opts.Exists)
+	}
+}
+
+// archiveURL returns the URL of the given recording in the archive, or the
+// empty string if no archive is configured
+func (s *Server) archiveURL(name, format string) string {
+	if s.Recording == nil || s.Recording.ArchiveURL == "" {
+		return ""
+	}
+
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return strings.NewReplacer(
+		"{name}", strings.Join(segments, "/"),
+		"{format}", url.PathEscape(format),
+		"{app}", url.PathEscape(s.Application),
+	).Replace(s.Recording.ArchiveURL)
+}
+
+// processRecordingEvent reports the limits reached by finished live
+// recordings and links them to their stored recordings, following each
+// RecordingFinished event with a RecordingStored event
+func (s *Server) processRecordingEvent(e ari.Event) {
+	if ev := s.recordingLimits.check(e); ev != nil {
+		ev.EventData = s.newEventData(proxy.EventRecordingLimitReached)
+		s.publishEvent(ev)
+	}
+
+	v, ok := e.(*ari.RecordingFinished)
+	if !ok || v.Recording.Name == "" {
+		return
+	}
+
+	ev := &proxy.RecordingStored{
+		EventData:  s.newEventData(proxy.EventRecordingStored),
+		Name:       v.Recording.Name,
+		Format:     v.Recording.Format,
+		Duration:   time.Duration(v.Recording.Duration),
+		TargetURI:  v.Recording.TargetURI,
+		ArchiveURL: s.archiveURL(v.Recording.Name, v.Recording.Format),
+	}
+	ev.StoredRecording = ev.Key(ari.StoredRecordingKey, v.Recording.Name)
+
+	s.publishEvent(ev)
+}
+
+// RecordingLimitGrace is the time for which the proxy allows Asterisk to
+// enforce the maximum duration of a recording before stopping it itself
+var RecordingLimitGrace = 2 * time.Second
+
+// recordingLimit is the maximum duration of a live recording in progress
+type recordingLimit struct {
+	name        string
+	target      string
+	maxDuration time.Duration
+
+	// timer stops the recording if Asterisk fails to enforce the limit
+	timer *time.Timer
+}
+
+// recordingLimitTracker tracks the limits of live recordings in progress,
+// indexed by recording name
+type recordingLimitTracker struct {
+	m  map[string]*recordingLimit
+	mu sync.Mutex
+}
+
+func (t *recordingLimitTracker) add(l *recordingLimit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m == nil {
+		t.m = make(map[string]*recordingLimit)
+	}
+	if old, ok := t.m[l.name]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	t.m[l.name] = l
+}
+
+// expire ends the tracking of the given limit, returning false if it is no
+// longer tracked
+func (t *recordingLimitTracker) expire(l *recordingLimit) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m[l.name] != l {
+		return false
+	}
+	delete(t.m, l.name)
+	return true
+}
+
+// remove ends the tracking of the limit of the given recording, returning it
+// if it was tracked
+func (t *recordingLimitTracker) remove(name string) *recordingLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.m[name]
+	if !ok {
+		return nil
+	}
+	delete(t.m, name)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	return l
+}
+
+// limitRecording arms the proxy's enforcement of the maximum duration of the
+// given recording of the given channel or bridge
+func (s *Server) limitRecording(name string, key *ari.Key, opts *ari.RecordingOptions) {
+	if opts == nil || opts.MaxDuration <= 0 {
+		return
+	}
+
+	l := &recordingLimit{
+		name:        name,
+		target:      key.Kind + ":" + key.ID,
+		maxDuration: opts.MaxDuration,
+	}
+	s.recordingLimits.mu.Lock()
+	l.timer = time.AfterFunc(opts.MaxDuration+RecordingLimitGrace, func() {
+		s.enforceRecordingLimit(l)
+	})
+	s.recordingLimits.mu.Unlock()
+
+	s.recordingLimits.add(l)
+}
+
+// enforceRecordingLimit stops a recording which Asterisk has allowed to
+// exceed its maximum duration
+func (s *Server) enforceRecordingLimit(l *recordingLimit) {
+	if !s.recordingLimits.expire(l) {
+		return
+	}
+
+	s.Log.Warn("stopping recording which exceeded its maximum duration", "recording", l.name, "max_duration", l.maxDuration)
+	if err := s.ari.LiveRecording().Stop(ari.NewKey(ari.LiveRecordingKey, l.name)); err != nil {
+		s.Log.Debug("failed to stop recording", "recording", l.name, "error", err)
+	}
+
+	s.publishEvent(&proxy.RecordingLimitReached{
+		EventData:  s.newEventData(proxy.EventRecordingLimitReached),
+		Name:       l.name,
+		TargetURI:  l.target,
+		Limit:      proxy.RecordingLimitMaxDuration,
+		Value:      l.maxDuration,
+		EnforcedBy: proxy.EnforcedByProxy,
+	})
+}
+
+// check ends the tracking of the limit of a finished recording,
+// returning the event which reports that Asterisk enforced the limit, if it
+// did
+func (t *recordingLimitTracker) check(e ari.Event) *proxy.RecordingLimitReached {
+	var data ari.LiveRecordingData
+	switch v := e.(type) {
+	case *ari.RecordingFinished:
+		data = v.Recording
+	case *ari.RecordingFailed:
+		t.remove(v.Recording.Name)
+		return nil
+	default:
+		return nil
+	}
+
+	l := t.remove(data.Name)
+	if l == nil || time.Duration(data.Duration) < l.maxDuration {
+		return nil
+	}
+	return &proxy.RecordingLimitReached{
+		Name:       data.Name,
+		TargetURI:  data.TargetURI,
+		Limit:      proxy.RecordingLimitMaxDuration,
+		Value:      l.maxDuration,
+		EnforcedBy: proxy.EnforcedByAsterisk,
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestExpandRecordingName(t *testing.T) {
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	key := ari.NewKey(ari.ChannelKey, "c1", ari.WithDialog("d1"))
+
+	name, err := expandRecordingName("calls/{date}/{time}-{channel}-{dialog}-{app}", key, "app", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "calls/20200304/050607-c1-d1-app" {
+		t.Errorf("unexpected name: %s", name)
+	}
+
+	if name, err := expandRecordingName("{channel}-{id}", key, "app", now); err != nil || !strings.HasPrefix(name, "c1-") || len(name) <= 3 {
+		t.Errorf("unexpected name %q (%v)", name, err)
+	}
+
+	for _, tmpl := range []string{
+		"{bogus}",
+		"{bridge}",
+		"../{channel}",
+		"{channel} {date}",
+	} {
+		if name, err := expandRecordingName(tmpl, key, "app", now); err == nil {
+			t.Errorf("%s: expected error, got %q", tmpl, name)
+		}
+	}
+}
+
+func TestRecordingName(t *testing.T) {
+	s := &Server{Application: "app"}
+	key := ari.NewKey(ari.BridgeKey, "b1")
+
+	if name, _ := s.recordingName("fixed", key); name != "fixed" {
+		t.Errorf("literal name should not change: %s", name)
+	}
+	if name, _ := s.recordingName("", key); name == "" {
+		t.Error("empty name should be generated")
+	}
+
+	s.Recording = &RecordingConfig{NameTemplate: "conf-{bridge}"}
+	if name, _ := s.recordingName("", key); name != "conf-b1" {
+		t.Errorf("unexpected templated name: %s", name)
+	}
+	if name, _ := s.recordingName("{app}/{bridge}", key); name != "app/b1" {
+		t.Errorf("unexpected requested template name: %s", name)
+	}
+}
+
+func TestRecordingOptions(t *testing.T) {
+	s := new(Server)
+
+	if opts, err := s.recordingOptions(nil); err != nil || opts != nil {
+		t.Errorf("unconfigured policy should not change options: %v (%v)", opts, err)
+	}
+	if _, err := s.recordingOptions(&ari.RecordingOptions{Exists: "clobber"}); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+
+	s.Recording = &RecordingConfig{IfExists: "append"}
+	orig := &ari.RecordingOptions{Format: "wav"}
+	opts, err := s.recordingOptions(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Exists != "append" || opts.Format != "wav" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if orig.Exists != "" {
+		t.Error("original options should not be modified")
+	}
+
+	if opts, _ := s.recordingOptions(&ari.RecordingOptions{Exists: "overwrite"}); opts.Exists != "overwrite" {
+		t.Errorf("requested policy should take precedence: %+v", opts)
+	}
+}
+
+func TestArchiveURL(t *testing.T) {
+	s := &Server{Application: "my app"}
+	if u := s.archiveURL("calls/r1", "wav"); u != "" {
+		t.Errorf("unexpected URL without archive: %s", u)
+	}
+
+	s.Recording = &RecordingConfig{ArchiveURL: "https://archive.example.com/{app}/{name}.{format}"}
+	if u := s.archiveURL("calls/r 1", "wav"); u != "https://archive.example.com/my%20app/calls/r%201.wav" {
+		t.Errorf("unexpected archive URL: %s", u)
+	}
+}
+
+func TestValidateRecordingLimits(t *testing.T) {
+	if err := validateRecordingLimits(&ari.RecordingOptions{MaxDuration: time.Minute, MaxSilence: 5 * time.Second}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, opts := range []*ari.RecordingOptions{
+		{MaxDuration: -time.Second},
+		{MaxDuration: 1500 * time.Millisecond},
+		{MaxSilence: 500 * time.Millisecond},
+	} {
+		if err := validateRecordingLimits(opts); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+}
+
+func TestRecordingLimitTracker(t *testing.T) {
+	var lt recordingLimitTracker
+	lt.add(&recordingLimit{name: "r1", maxDuration: 10 * time.Second})
+	lt.add(&recordingLimit{name: "r2", maxDuration: 10 * time.Second})
+
+	// A recording stopped at its limit was stopped by Asterisk
+	ev := lt.check(&ari.RecordingFinished{Recording: ari.LiveRecordingData{Name: "r1", TargetURI: "channel:c1", Duration: ari.DurationSec(10 * time.Second)}})
+	if ev == nil || ev.EnforcedBy != proxy.EnforcedByAsterisk || ev.Limit != proxy.RecordingLimitMaxDuration {
+		t.Errorf("unexpected limit event: %+v", ev)
+	}
+
+	// A recording stopped before its limit reached no limit
+	if ev := lt.check(&ari.RecordingFinished{Recording: ari.LiveRecordingData{Name: "r2", Duration: ari.DurationSec(3 * time.Second)}}); ev != nil {
+		t.Errorf("unexpected limit event: %+v", ev)
+	}
+	if len(lt.m) != 0 {
+		t.Errorf("finished recordings should no longer be tracked: %v", lt.m)
+	}
+
+	// An expired limit is only enforced once
+	l := &recordingLimit{name: "r3", maxDuration: time.Second}
+	lt.add(l)
+	if !lt.expire(l) || lt.expire(l) {
+		t.Error("limit should expire exactly once")
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultARIURL is the default root URL of the ARI REST interface
+const DefaultARIURL = "http://localhost:8088/ari"
+
+// errRESTUnavailable indicates that the proxy was not given the ARI connection
+// parameters (as when it is run with ListenOn), so that it cannot make raw
+// REST requests
+var errRESTUnavailable = eris.New("operation not available without direct ARI connection parameters")
+
+// ariREST makes raw requests to the ARI REST interface, for the operations
+// whose parameters are not supported by the ARI client library
+type ariREST struct {
+	url      string
+	username string
+	password string
+
+	client *http.Client
+}
+
+func newARIREST(opts *native.Options) *ariREST {
+	u := opts.URL
+	if u == "" {
+		u = DefaultARIURL
+	}
+
+	return &ariREST{
+		url:      strings.TrimSuffix(u, "/"),
+		username: opts.Username,
+		password: opts.Password,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// post makes a POST request to the given path (relative to the root URL) with
+// the given query parameters, discarding the response body
+func (r *ariREST) post(path string, params url.Values) error {
+	return r.do(http.MethodPost, path, params, nil)
+}
+
+// get makes a GET request to the given path (relative to the root URL),
+// decoding the JSON response body into v
+func (r *ariREST) get(path string, v interface{}) error {
+	return r.do(http.MethodGet, path, nil, v)
+}
+
+// open makes a GET request to the given path (relative to the root URL),
+// returning the response body, which the caller must close.  Unlike other
+// requests, the transfer of the body is only bounded by the context, so that
+// large files (e.g. recordings) may be downloaded.
+func (r *ariREST) open(ctx context.Context, path string) (io.ReadCloser, error) {
+	if r == nil {
+		return nil, errRESTUnavailable
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.url+path, nil)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(r.username, r.password)
+
+	client := *r.client
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to make request")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close() // nolint: errcheck
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// apiVersion returns the version of the ARI interface, as described by its
+// Swagger resource listing
+func (r *ariREST) apiVersion() (string, error) {
+	var listing struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := r.get("/api-docs/resources.json", &listing); err != nil {
+		return "", err
+	}
+	if listing.APIVersion == "" {
+		return "", eris.New("no API version in resource listing")
+	}
+	return listing.APIVersion, nil
+}
+
+// do makes a request with the given method to the given path (relative to the
+// root URL) with the given query parameters, decoding the JSON response body
+// into v, or discarding it if v is nil
+func (r *ariREST) do(method, path string, params url.Values, v interface{}) error {
+	if r == nil {
+		return errRESTUnavailable
+	}
+
+	u := r.url + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return eris.Wrap(err, "failed to create request")
+	}
+	req.SetBasicAuth(r.username, r.password)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return eris.Wrap(err, "failed to make request")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				return eris.Wrap(err, "failed to decode response")
+			}
+			return nil
+		}
+		io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+		return nil
+	}
+
+	return responseError(resp)
+}
+
+// responseError returns the error described by a non-2XX response
+func responseError(resp *http.Response) error {
+	// ARI describes failures by a JSON message
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&msg); err == nil && msg.Message != "" {
+		return eris.Errorf("Non-2XX response: %s: %s", resp.Status, msg.Message)
+	}
+	return eris.Errorf("Non-2XX response: %s", resp.Status)
+}
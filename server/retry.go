@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// RetryConfig describes the retries of requests which fail with a transient
+// ARI error (an HTTP 500, 502, 503 or 504 response from Asterisk), so that
+// brief Asterisk hiccups do not surface as client errors.  Only idempotent
+// requests are retried: those which read data (the kinds ending in Data, Get
+// or List) and the kinds listed in Kinds.
+type RetryConfig struct {
+	// MaxRetries is the maximum number of retries of a request.  It defaults
+	// to DefaultRetryMax.
+	MaxRetries int `mapstructure:"max_retries"`
+
+	// Backoff is the delay before the first retry, doubled for each further
+	// retry.  It defaults to DefaultRetryBackoff.
+	Backoff time.Duration `mapstructure:"backoff"`
+
+	// MaxBackoff is the maximum delay between retries.  It defaults to
+	// DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+
+	// Kinds lists the additional kinds of requests which are idempotent, and
+	// may hence be retried (e.g. "ChannelHold")
+	Kinds []string `mapstructure:"kinds"`
+}
+
+// Defaults of the RetryConfig
+const (
+	DefaultRetryMax        = 2
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Second
+)
+
+func (cfg RetryConfig) withDefaults() RetryConfig {
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = DefaultRetryMax
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultRetryBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return cfg
+}
+
+// retryable indicates whether requests of the given kind may be retried
+func (cfg RetryConfig) retryable(kind string) bool {
+	for _, suffix := range []string{"Data", "Get", "List"} {
+		if strings.HasSuffix(kind, suffix) {
+			return true
+		}
+	}
+	for _, k := range cfg.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// transientError indicates whether the given error is a transient ARI error
+func transientError(err error) bool {
+	switch ariStatusCode(err) {
+	case 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// requestRetry is the retry state of a request being dispatched
+type requestRetry struct {
+	cfg      RetryConfig
+	attempts int
+
+	// failed is the transient error with which the last attempt failed,
+	// which was not sent to the client so that the request may be retried
+	failed error
+
+	mu sync.Mutex
+}
+
+// intercept records the failure of the current attempt with the given error,
+// returning whether the request will be retried rather than failed
+func (r *requestRetry) intercept(err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !transientError(err) || r.attempts >= r.cfg.MaxRetries {
+		return false
+	}
+	r.failed = err
+	return true
+}
+
+// next returns the delay before the retry of the request, and the error of
+// its last attempt, if it is to be retried
+func (r *requestRetry) next() (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.failed
+	if err == nil {
+		return 0, nil
+	}
+	r.failed = nil
+
+	d := r.cfg.Backoff
+	for i := 0; i < r.attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+	r.attempts++
+	return d, err
+}
+
+// requestDeadline returns a context which is closed when the deadline of the
+// request, if any, passes.  It only bounds the start of the request and its
+// retries: it is not the context of its handler, which the handlers starting
+// background work (e.g. AMD detection or paging) keep beyond the request, so
+// an attempt in progress runs to completion past the deadline.
+func requestDeadline(ctx context.Context, req *proxy.Request) (context.Context, context.CancelFunc) {
+	if req.Deadline == nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, *req.Deadline)
+}
+
+// runRequest runs the handler of a request, retrying it while it fails with
+// a transient ARI error, if retries are enabled and the request may be
+// retried, until the given deadline context (see requestDeadline) is closed.
+// The handler reports the failure of each attempt with sendError, which
+// defers it to the retry.
+func (s *Server) runRequest(ctx, deadline context.Context, f func(context.Context, string, *proxy.Request), reply string, req *proxy.Request) {
+	if s.Retry == nil || reply == "" || !s.Retry.retryable(req.Kind) {
+		f(ctx, reply, req)
+		return
+	}
+
+	r := &requestRetry{cfg: s.Retry.withDefaults()}
+	s.retries.Store(reply, r)
+	defer s.retries.Delete(reply)
+
+	for {
+		f(ctx, reply, req)
+
+		wait, err := r.next()
+		if err == nil {
+			return
+		}
+		s.metrics.requestRetried(req.Kind)
+		s.Log.Debug("retrying request after transient ARI error", "kind", req.Kind, "error", err, "wait", wait)
+
+		select {
+		case <-deadline.Done():
+			s.retries.Delete(reply)
+			s.sendError(reply, err)
+			return
+		case <-s.clock().After(wait):
+		}
+	}
+}
+
+// retryFailure defers the failure of a request with the given error to its
+// retry, returning whether it was deferred
+func (s *Server) retryFailure(reply string, err error) bool {
+	if err == nil || reply == "" {
+		return false
+	}
+	r, ok := s.retries.Load(reply)
+	return ok && r.(*requestRetry).intercept(err)
+}
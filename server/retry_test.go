@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/nats-io/nats.go"
+)
+
+func TestRetryable(t *testing.T) {
+	cfg := RetryConfig{Kinds: []string{"ChannelHold"}}
+	for kind, want := range map[string]bool{
+		"ChannelData":   true,
+		"BridgeList":    true,
+		"ChannelHold":   true,
+		"ChannelHangup": false,
+		"ChannelCreate": false,
+	} {
+		if got := cfg.retryable(kind); got != want {
+			t.Errorf("retryable(%q) = %v, want %v", kind, got, want)
+		}
+	}
+
+	if !transientError(ariCodeError(503)) || transientError(ariCodeError(404)) || transientError(nil) {
+		t.Error("unexpected transient errors")
+	}
+}
+
+func TestRunRequestRetries(t *testing.T) {
+	s := New(WithRetry(&RetryConfig{MaxRetries: 2, Backoff: time.Millisecond}))
+
+	// The handler fails twice with a transient error, then succeeds (without
+	// replying, as the test server has no NATS connection)
+	var attempts int
+	f := func(ctx context.Context, reply string, req *proxy.Request) {
+		attempts++
+		if attempts <= 2 {
+			s.sendError(reply, ariCodeError(503))
+		}
+	}
+	s.runRequest(context.Background(), context.Background(), f, "reply.1", &proxy.Request{Kind: "ChannelData"})
+
+	if attempts != 3 {
+		t.Errorf("handler ran %d times", attempts)
+	}
+	if r := s.metrics.request("ChannelData").retries; r != 2 {
+		t.Errorf("counted %d retries", r)
+	}
+	if _, ok := s.retries.Load("reply.1"); ok {
+		t.Error("retry state left behind")
+	}
+}
+
+func TestRunRequestDeadline(t *testing.T) {
+	s := New(WithRetry(&RetryConfig{MaxRetries: 5, Backoff: time.Hour}))
+
+	// The final error response fails to publish on the unconnected connection
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+
+	// The deadline passes while waiting for the first retry
+	req := &proxy.Request{Kind: "ChannelData"}
+	d := time.Now().Add(10 * time.Millisecond)
+	req.Deadline = &d
+	deadline, cancel := requestDeadline(context.Background(), req)
+	defer cancel()
+
+	var attempts int
+	f := func(ctx context.Context, reply string, req *proxy.Request) {
+		attempts++
+		s.sendError(reply, ariCodeError(503))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.runRequest(context.Background(), deadline, f, "reply.1", req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retries continued past the deadline")
+	}
+	if attempts != 1 {
+		t.Errorf("handler ran %d times", attempts)
+	}
+}
+
+func TestRunRequestBackoff(t *testing.T) {
+	start := time.Unix(0, 0)
+	fc := clock.NewFake(start)
+	s := New(WithClock(fc), WithRetry(&RetryConfig{MaxRetries: 3, Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}))
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+
+	// The handler always fails with a transient error
+	attempts := make(chan time.Duration, 4)
+	f := func(ctx context.Context, reply string, req *proxy.Request) {
+		attempts <- fc.Now().Sub(start)
+		s.sendError(reply, ariCodeError(503))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.runRequest(context.Background(), context.Background(), f, "reply.1", &proxy.Request{Kind: "ChannelData"})
+		close(done)
+	}()
+
+	// Each retry waits for the backoff, doubled up to the maximum
+	var waited time.Duration
+	for i, backoff := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond} {
+		if i > 0 {
+			for fc.Waiters() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			fc.Advance(backoff - time.Millisecond)
+			fc.Advance(time.Millisecond)
+			waited += backoff
+		}
+		select {
+		case at := <-attempts:
+			if at != waited {
+				t.Errorf("attempt %d at %v, want %v", i+1, at, waited)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("attempt %d not made", i+1)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request retried beyond the limit")
+	}
+}
+
+func TestDispatchExpiredRequest(t *testing.T) {
+	s := New()
+
+	past := time.Now().Add(-time.Second)
+	s.dispatchRequest(context.Background(), "", &proxy.Request{Kind: "ChannelData", Deadline: &past})
+
+	m := s.metrics.request("ChannelData")
+	if m.expired != 1 || m.count != 0 {
+		t.Errorf("expired request counted %d expired, %d handled", m.expired, m.count)
+	}
+}
+
+func TestRequestRetryLimit(t *testing.T) {
+	r := &requestRetry{cfg: RetryConfig{MaxRetries: 2, Backoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond}}
+
+	for i, want := range []time.Duration{10 * time.Millisecond, 15 * time.Millisecond} {
+		if !r.intercept(ariCodeError(502)) {
+			t.Fatalf("failure %d not retried", i+1)
+		}
+		if wait, err := r.next(); err == nil || wait != want {
+			t.Errorf("retry %d after %v, want %v", i+1, wait, want)
+		}
+	}
+	if r.intercept(ariCodeError(502)) {
+		t.Error("failure retried beyond the limit")
+	}
+	if r.intercept(ariCodeError(404)) {
+		t.Error("permanent failure retried")
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
+)
+
+// EndpointRewriter is a hook which may rewrite the destination endpoint of a
+// channel creation (originate or create) request before it is sent to
+// Asterisk.  Rewriters are applied in order, each receiving the output of the
+// last.
+type EndpointRewriter interface {
+	// Rewrite returns the endpoint to be used in place of the given endpoint.
+	// Returning an error rejects the request.
+	Rewrite(endpoint string, req *proxy.Request) (string, error)
+}
+
+// EndpointRewriterFunc is a function which implements EndpointRewriter
+type EndpointRewriterFunc func(endpoint string, req *proxy.Request) (string, error)
+
+// Rewrite implements EndpointRewriter
+func (f EndpointRewriterFunc) Rewrite(endpoint string, req *proxy.Request) (string, error) {
+	return f(endpoint, req)
+}
+
+// E164Normalizer is an EndpointRewriter which normalizes the dialed number of
+// an endpoint to E.164 format.  Non-numeric resources and numbers shorter than
+// MinLength (such as extensions and emergency numbers) are left untouched.
+type E164Normalizer struct {
+	// CountryCode is the country calling code to assume for national numbers (e.g. "1")
+	CountryCode string `mapstructure:"country_code"`
+
+	// NationalLength is the length of a national number (e.g. 10 for NANP).
+	// Numbers of exactly this length are prefixed with the CountryCode.
+	NationalLength int `mapstructure:"national_length"`
+
+	// InternationalPrefix is the dialing prefix for international numbers
+	// (e.g. "011" or "00"), which is replaced by "+"
+	InternationalPrefix string `mapstructure:"international_prefix"`
+
+	// MinLength is the minimum length of a number to be normalized.  It
+	// defaults to 7.
+	MinLength int `mapstructure:"min_length"`
+}
+
+// Rewrite implements EndpointRewriter
+func (n *E164Normalizer) Rewrite(endpoint string, req *proxy.Request) (string, error) {
+	number := endpointNumber(endpoint)
+
+	digits := strings.TrimPrefix(number, "+")
+	if !isDigits(digits) {
+		return endpoint, nil
+	}
+
+	minLength := n.MinLength
+	if minLength == 0 {
+		minLength = 7
+	}
+	if len(digits) < minLength || strings.HasPrefix(number, "+") {
+		return endpoint, nil
+	}
+
+	switch {
+	case n.InternationalPrefix != "" && strings.HasPrefix(digits, n.InternationalPrefix):
+		digits = strings.TrimPrefix(digits, n.InternationalPrefix)
+	case n.NationalLength > 0 && len(digits) == n.NationalLength:
+		digits = n.CountryCode + digits
+	}
+
+	return replaceEndpointNumber(endpoint, "+"+digits), nil
+}
+
+// RewriteRule describes a regular-expression-based endpoint rewrite.  If Match
+// matches the endpoint, the endpoint is replaced by the Endpoint template, in
+// which `$1`-style references are expanded from the submatches of Match.
+//
+// This allows technology prefix injection and trunk selection, such as:
+//
+//   match: "^PJSIP/\+1(\d{10})$"
+//   endpoint: "PJSIP/1$1@us-trunk"
+type RewriteRule struct {
+	// Match is the regular expression which is matched against the full endpoint
+	Match string `mapstructure:"match"`
+
+	// Endpoint is the replacement template for the endpoint
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type ruleRewriter struct {
+	rules []compiledRewriteRule
+}
+
+type compiledRewriteRule struct {
+	re       *regexp.Regexp
+	template string
+}
+
+// NewRuleRewriter returns an EndpointRewriter which applies the first matching
+// rule of the given list.
+func NewRuleRewriter(rules []RewriteRule) (EndpointRewriter, error) {
+	r := new(ruleRewriter)
+
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid rewrite rule pattern %q", rule.Match)
+		}
+		r.rules = append(r.rules, compiledRewriteRule{re: re, template: rule.Endpoint})
+	}
+
+	return r, nil
+}
+
+// Rewrite implements EndpointRewriter
+func (r *ruleRewriter) Rewrite(endpoint string, req *proxy.Request) (string, error) {
+	for _, rule := range r.rules {
+		m := rule.re.FindStringSubmatchIndex(endpoint)
+		if m == nil {
+			continue
+		}
+		return string(rule.re.ExpandString(nil, rule.template, endpoint, m)), nil
+	}
+	return endpoint, nil
+}
+
+// rewriteEndpoint runs the endpoint through the Server's rewriters
+func (s *Server) rewriteEndpoint(endpoint string, req *proxy.Request) (string, error) {
+	var err error
+
+	for _, r := range s.EndpointRewriters {
+		orig := endpoint
+
+		endpoint, err = r.Rewrite(endpoint, req)
+		if err != nil {
+			return "", eris.Wrapf(err, "failed to rewrite endpoint %q", orig)
+		}
+	}
+	return endpoint, nil
+}
+
+// endpointNumber returns the dialed number or resource from an Asterisk
+// endpoint string.  For example, each of "PJSIP/911@trunk", "SIP/trunk/911",
+// and "Local/911@default" yields "911".  Strings which do not contain a
+// technology prefix are returned unchanged.
+func endpointNumber(endpoint string) string {
+	start, end := endpointNumberIndex(endpoint)
+	return endpoint[start:end]
+}
+
+// replaceEndpointNumber replaces the dialed number or resource of an Asterisk
+// endpoint string with the given number.
+func replaceEndpointNumber(endpoint, number string) string {
+	start, end := endpointNumberIndex(endpoint)
+	return endpoint[:start] + number + endpoint[end:]
+}
+
+func endpointNumberIndex(endpoint string) (start, end int) {
+	end = len(endpoint)
+
+	i := strings.Index(endpoint, "/")
+	if i < 0 {
+		return 0, end
+	}
+	start = i + 1
+
+	if j := strings.LastIndex(endpoint[start:], "/"); j >= 0 {
+		start += j + 1
+	}
+	if j := strings.Index(endpoint[start:], "@"); j >= 0 {
+		end = start + j
+	}
+	return
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
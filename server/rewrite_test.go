@@ -0,0 +1,92 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+var endpointNumberTests = []struct {
+	Input    string
+	Expected string
+}{
+	{"PJSIP/911@trunk", "911"},
+	{"SIP/trunk/112", "112"},
+	{"Local/911@default", "911"},
+	{"DAHDI/8005558282", "8005558282"},
+	{"911", "911"},
+}
+
+func TestEndpointNumber(t *testing.T) {
+	for _, test := range endpointNumberTests {
+		if n := endpointNumber(test.Input); n != test.Expected {
+			t.Errorf("endpointNumber(%q) => %q, expected %q", test.Input, n, test.Expected)
+		}
+	}
+}
+
+func TestReplaceEndpointNumber(t *testing.T) {
+	if e := replaceEndpointNumber("PJSIP/8005558282@trunk", "+18005558282"); e != "PJSIP/+18005558282@trunk" {
+		t.Errorf("incorrect replacement: %s", e)
+	}
+	if e := replaceEndpointNumber("SIP/trunk/123", "456"); e != "SIP/trunk/456" {
+		t.Errorf("incorrect replacement: %s", e)
+	}
+}
+
+var e164Tests = []struct {
+	Input    string
+	Expected string
+}{
+	{"PJSIP/8005558282@trunk", "PJSIP/+18005558282@trunk"},
+	{"PJSIP/18005558282@trunk", "PJSIP/+18005558282@trunk"},
+	{"PJSIP/011442079460000@trunk", "PJSIP/+442079460000@trunk"},
+	{"PJSIP/+442079460000@trunk", "PJSIP/+442079460000@trunk"},
+	{"PJSIP/911@trunk", "PJSIP/911@trunk"},
+	{"PJSIP/alice", "PJSIP/alice"},
+}
+
+func TestE164Normalizer(t *testing.T) {
+	n := &E164Normalizer{
+		CountryCode:         "1",
+		NationalLength:      10,
+		InternationalPrefix: "011",
+	}
+
+	for _, test := range e164Tests {
+		e, err := n.Rewrite(test.Input, &proxy.Request{})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if e != test.Expected {
+			t.Errorf("Rewrite(%q) => %q, expected %q", test.Input, e, test.Expected)
+		}
+	}
+}
+
+func TestRuleRewriter(t *testing.T) {
+	r, err := NewRuleRewriter([]RewriteRule{
+		{Match: `^PJSIP/\+1(\d{10})$`, Endpoint: "PJSIP/1$1@us-trunk"},
+		{Match: `^PJSIP/\+(\d+)$`, Endpoint: "PJSIP/011$1@intl-trunk"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create rewriter: %s", err)
+	}
+
+	s := &Server{EndpointRewriters: []EndpointRewriter{r}}
+
+	e, err := s.rewriteEndpoint("PJSIP/+18005558282", &proxy.Request{})
+	if err != nil || e != "PJSIP/18005558282@us-trunk" {
+		t.Errorf("incorrect rewrite: %s (%v)", e, err)
+	}
+
+	e, err = s.rewriteEndpoint("PJSIP/+442079460000", &proxy.Request{})
+	if err != nil || e != "PJSIP/011442079460000@intl-trunk" {
+		t.Errorf("incorrect rewrite: %s (%v)", e, err)
+	}
+
+	e, err = s.rewriteEndpoint("PJSIP/alice", &proxy.Request{})
+	if err != nil || e != "PJSIP/alice" {
+		t.Errorf("incorrect rewrite: %s (%v)", e, err)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// Router selects the routes for an originate request.  The returned routes
+// are attempted in order until one succeeds, providing failover.  If no
+// routes are returned, the originate proceeds with its original endpoint.
+//
+// See the lcr package for a least-cost routing implementation.
+type Router interface {
+	Route(number string, req *proxy.Request) ([]proxy.Route, error)
+}
+
+// originate sends the originate request to Asterisk, attempting each of the
+// routes selected by the Server's Router, if there is one.  A RoutingDecision
+// event is published for each attempt.
+func (s *Server) originate(req *proxy.Request, orig ari.OriginateRequest) (*ari.ChannelHandle, error) {
+	if s.Router == nil {
+		return s.ari.Channel().Originate(req.Key, orig)
+	}
+
+	number := endpointNumber(orig.Endpoint)
+
+	routes, err := s.Router.Route(number, req)
+	if err != nil {
+		return nil, eris.Wrapf(err, "failed to route originate to %s", number)
+	}
+	if len(routes) == 0 {
+		return s.ari.Channel().Originate(req.Key, orig)
+	}
+
+	var h *ari.ChannelHandle
+	for i, r := range routes {
+		orig.Endpoint = r.Endpoint
+
+		h, err = s.ari.Channel().Originate(req.Key, orig)
+
+		e := &proxy.RoutingDecision{
+			EventData:   s.newEventData(proxy.EventRoutingDecision),
+			ChannelID:   orig.ChannelID,
+			Tenant:      req.Tenant,
+			Destination: number,
+			Route:       r,
+			Attempt:     i + 1,
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		s.publishEvent(e)
+
+		if err == nil {
+			return h, nil
+		}
+		s.Log.Warn("originate route failed", "trunk", r.Trunk, "endpoint", r.Endpoint, "error", err)
+	}
+
+	return nil, eris.Wrapf(err, "all %d routes to %s failed", len(routes), number)
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultScreeningTimeout is the default time within which the screeners must
+// return their verdict on a call
+const DefaultScreeningTimeout = 2 * time.Second
+
+// ScreeningAction is the action to be taken for a screened call
+type ScreeningAction string
+
+const (
+	// ScreenAllow passes the call to the application unchanged.  An explicit
+	// allow stops the evaluation of any further screeners, which permits
+	// whitelists to be placed ahead of blacklists.
+	ScreenAllow ScreeningAction = "allow"
+
+	// ScreenHangup hangs up the call before the application sees it
+	ScreenHangup ScreeningAction = "hangup"
+
+	// ScreenDivert returns the call to the dialplan at the given location
+	// before the application sees it
+	ScreenDivert ScreeningAction = "divert"
+
+	// ScreenTag passes the call to the application, preceded by a
+	// CallScreened event describing the match
+	ScreenTag ScreeningAction = "tag"
+)
+
+// ScreeningVerdict describes the outcome of screening a call
+type ScreeningVerdict struct {
+	// Action is the action to take for the call
+	Action ScreeningAction
+
+	// Rule is the name of the rule or list which matched, for logging and tagging
+	Rule string
+
+	// Tag is an optional label passed to the application by the ScreenTag action
+	Tag string
+
+	// Reason is the hangup reason for the ScreenHangup action (e.g. "busy",
+	// "rejected").  If empty, "normal" is used.
+	Reason string
+
+	// Context, Extension, and Priority describe the dialplan location for the
+	// ScreenDivert action
+	Context   string
+	Extension string
+	Priority  int
+}
+
+// Screener checks the calling and called numbers of inbound calls entering
+// the ARI application.  Screeners allow for static lists as well as lookups
+// against external systems.
+type Screener interface {
+	// Screen returns the verdict for the call.  A nil verdict indicates that
+	// the screener has no opinion and the next screener should be consulted.
+	// The screener must return by the deadline of the context, after which
+	// the call is allowed.
+	Screen(ctx context.Context, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error)
+}
+
+// ScreenerFunc is a function which implements Screener
+type ScreenerFunc func(ctx context.Context, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error)
+
+// Screen implements Screener
+func (f ScreenerFunc) Screen(ctx context.Context, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error) {
+	return f(ctx, caller, callee, e)
+}
+
+// ScreeningRule describes a static screening list entry.  A rule matches if
+// both the Caller and Callee expressions (where set) match.
+type ScreeningRule struct {
+	// Name identifies the rule in logs and CallScreened events
+	Name string `mapstructure:"name"`
+
+	// Caller is the regular expression matched against the caller ID number
+	Caller string `mapstructure:"caller"`
+
+	// Callee is the regular expression matched against the dialed extension
+	Callee string `mapstructure:"callee"`
+
+	// Action is the action to take on a match
+	Action ScreeningAction `mapstructure:"action"`
+
+	// Tag is the label passed to the application by the tag action
+	Tag string `mapstructure:"tag"`
+
+	// Reason is the hangup reason for the hangup action
+	Reason string `mapstructure:"reason"`
+
+	// Context, Extension, and Priority describe the dialplan location for
+	// the divert action
+	Context   string `mapstructure:"context"`
+	Extension string `mapstructure:"extension"`
+	Priority  int    `mapstructure:"priority"`
+}
+
+type ruleScreener struct {
+	rules []compiledScreeningRule
+}
+
+type compiledScreeningRule struct {
+	caller *regexp.Regexp
+	callee *regexp.Regexp
+	rule   ScreeningRule
+}
+
+// NewRuleScreener returns a Screener which applies the first matching rule of
+// the given list.
+func NewRuleScreener(rules []ScreeningRule) (Screener, error) {
+	r := new(ruleScreener)
+
+	for _, rule := range rules {
+		c := compiledScreeningRule{rule: rule}
+
+		switch rule.Action {
+		case ScreenAllow, ScreenHangup, ScreenTag:
+		case ScreenDivert:
+			if rule.Context == "" && rule.Extension == "" {
+				return nil, eris.Errorf("screening rule %q: divert requires a context or extension", rule.Name)
+			}
+		default:
+			return nil, eris.Errorf("screening rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+
+		var err error
+		if rule.Caller != "" {
+			if c.caller, err = regexp.Compile(rule.Caller); err != nil {
+				return nil, eris.Wrapf(err, "screening rule %q: invalid caller pattern", rule.Name)
+			}
+		}
+		if rule.Callee != "" {
+			if c.callee, err = regexp.Compile(rule.Callee); err != nil {
+				return nil, eris.Wrapf(err, "screening rule %q: invalid callee pattern", rule.Name)
+			}
+		}
+
+		r.rules = append(r.rules, c)
+	}
+
+	return r, nil
+}
+
+// Screen implements Screener
+func (r *ruleScreener) Screen(ctx context.Context, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error) {
+	for _, c := range r.rules {
+		if c.caller != nil && !c.caller.MatchString(caller) {
+			continue
+		}
+		if c.callee != nil && !c.callee.MatchString(callee) {
+			continue
+		}
+
+		return &ScreeningVerdict{
+			Action:    c.rule.Action,
+			Rule:      c.rule.Name,
+			Tag:       c.rule.Tag,
+			Reason:    c.rule.Reason,
+			Context:   c.rule.Context,
+			Extension: c.rule.Extension,
+			Priority:  c.rule.Priority,
+		}, nil
+	}
+	return nil, nil
+}
+
+// screen runs the Server's screeners against an inbound call entering the
+// application.  It returns false if the call was removed from the
+// application and its StasisStart event should not be published.  It is run
+// off the event loop, by prepareStart.
+func (s *Server) screen(ctx context.Context, e *ari.StasisStart) bool {
+	if len(s.Screeners) == 0 {
+		return true
+	}
+
+	caller := e.Channel.GetCaller().GetNumber()
+	callee := e.Channel.GetDialplan().GetExten()
+
+	timeout := s.ScreeningTimeout
+	if timeout <= 0 {
+		timeout = DefaultScreeningTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var v *ScreeningVerdict
+	for _, sc := range s.Screeners {
+		var err error
+
+		v, err = screenCall(ctx, sc, caller, callee, e)
+		if err != nil {
+			// Fail open: a broken lookup must not block calls
+			s.Log.Error("call screening failed", "channel", e.Channel.ID, "error", err)
+			continue
+		}
+		if v != nil {
+			break
+		}
+	}
+	if v == nil || v.Action == ScreenAllow {
+		return true
+	}
+
+	log := s.Log.New("channel", e.Channel.ID, "caller", caller, "callee", callee, "rule", v.Rule, "action", v.Action)
+
+	if v.Action != ScreenTag && s.emergencyBypass("screening", "", callee) {
+		return true
+	}
+
+	key := ari.NewKey(ari.ChannelKey, e.Channel.ID)
+
+	switch v.Action {
+	case ScreenHangup:
+		log.Info("screened call hung up")
+
+		reason := v.Reason
+		if reason == "" {
+			reason = "normal"
+		}
+		if err := s.ari.Channel().Hangup(key, reason); err != nil {
+			log.Error("failed to hang up screened call", "error", err)
+			return true
+		}
+		return false
+	case ScreenDivert:
+		log.Info("screened call diverted", "context", v.Context, "extension", v.Extension, "priority", v.Priority)
+
+		if err := s.ari.Channel().Continue(key, v.Context, v.Extension, v.Priority); err != nil {
+			log.Error("failed to divert screened call", "error", err)
+			return true
+		}
+		return false
+	case ScreenTag:
+		log.Debug("screened call tagged", "tag", v.Tag)
+
+		ev := &proxy.CallScreened{
+			EventData: s.newEventData(proxy.EventCallScreened),
+			ChannelID: e.Channel.ID,
+			Caller:    caller,
+			Callee:    callee,
+			Rule:      v.Rule,
+			Tag:       v.Tag,
+		}
+		s.publishEvent(ev)
+	}
+
+	return true
+}
+
+// screenCall consults the screener, giving up on it at the deadline of the
+// context even if it does not honour it
+func screenCall(ctx context.Context, sc Screener, caller, callee string, e *ari.StasisStart) (*ScreeningVerdict, error) {
+	type result struct {
+		v   *ScreeningVerdict
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		v, err := sc.Screen(ctx, caller, callee, e)
+		ch <- result{v, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRuleScreener(t *testing.T) {
+	sc, err := NewRuleScreener([]ScreeningRule{
+		{Name: "vip", Caller: `^\+15555550100$`, Action: ScreenAllow},
+		{Name: "spam", Caller: `^\+1900`, Action: ScreenHangup, Reason: "rejected"},
+		{Name: "sales", Callee: `^2\d{3}$`, Action: ScreenDivert, Context: "sales", Extension: "s", Priority: 1},
+		{Name: "anonymous", Caller: `^$`, Action: ScreenTag, Tag: "anonymous"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create screener: %s", err)
+	}
+
+	tests := []struct {
+		caller string
+		callee string
+		action ScreeningAction
+	}{
+		{"+15555550100", "2000", ScreenAllow},
+		{"+19005551212", "100", ScreenHangup},
+		{"+15555551234", "2001", ScreenDivert},
+		{"", "100", ScreenTag},
+	}
+	for _, tt := range tests {
+		v, err := sc.Screen(context.Background(), tt.caller, tt.callee, nil)
+		if err != nil {
+			t.Errorf("%s -> %s: unexpected error: %s", tt.caller, tt.callee, err)
+			continue
+		}
+		if v == nil || v.Action != tt.action {
+			t.Errorf("%s -> %s: expected action %s, got %+v", tt.caller, tt.callee, tt.action, v)
+		}
+	}
+
+	v, err := sc.Screen(context.Background(), "+15555551234", "100", nil)
+	if err != nil || v != nil {
+		t.Errorf("expected no verdict for unmatched call, got %+v (%v)", v, err)
+	}
+}
+
+func TestRuleScreenerInvalid(t *testing.T) {
+	if _, err := NewRuleScreener([]ScreeningRule{{Name: "bad", Action: "drop"}}); err == nil {
+		t.Error("expected error for unknown action")
+	}
+	if _, err := NewRuleScreener([]ScreeningRule{{Name: "bad", Action: ScreenDivert}}); err == nil {
+		t.Error("expected error for divert without destination")
+	}
+	if _, err := NewRuleScreener([]ScreeningRule{{Name: "bad", Caller: "(", Action: ScreenHangup}}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultSecureInputTimeout is the default maximum duration of a secure input
+// capture
+var DefaultSecureInputTimeout = 2 * time.Minute
+
+// secureCapture is the state of a secure input capture
+type secureCapture struct {
+	token   string
+	channel string
+	opts    proxy.SecureInput
+
+	digits strings.Builder
+
+	// active indicates that digits are being captured
+	active bool
+
+	// paused is the list of recordings paused for the capture
+	paused []*ari.Key
+
+	timer clock.Timer
+}
+
+// secureCompletion is the completion of a secure input capture, which is
+// reported once the secure input lock is released
+type secureCompletion struct {
+	channel string
+	reason  string
+	digits  int
+
+	// paused is the list of recordings to be resumed
+	paused []*ari.Key
+}
+
+// complete ends the capture of digits, returning its completion, or nil if it
+// had already completed.  The secure input lock must be held.
+func (c *secureCapture) complete(reason string) *secureCompletion {
+	if !c.active {
+		return nil
+	}
+	c.active = false
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	done := &secureCompletion{
+		channel: c.channel,
+		reason:  reason,
+		digits:  c.digits.Len(),
+		paused:  c.paused,
+	}
+	c.paused = nil
+	return done
+}
+
+// add captures a digit.  It returns the reason the capture completed, if the
+// digit completed it.
+func (c *secureCapture) add(digit string) string {
+	if c.opts.Terminator != "" && strings.Contains(c.opts.Terminator, digit) {
+		return "terminator"
+	}
+	c.digits.WriteString(digit)
+	max := c.opts.MaxDigits
+	if max == 0 {
+		max = proxy.MaxSecureInputDigits
+	}
+	if c.digits.Len() >= max {
+		return "max_digits"
+	}
+	return ""
+}
+
+// secureInputSet is the set of secure input captures, indexed by token and by
+// channel ID
+type secureInputSet struct {
+	byToken   map[string]*secureCapture
+	byChannel map[string]*secureCapture
+	mu        sync.Mutex
+}
+
+func (ss *secureInputSet) add(c *secureCapture) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.byToken == nil {
+		ss.byToken = make(map[string]*secureCapture)
+		ss.byChannel = make(map[string]*secureCapture)
+	}
+	if _, ok := ss.byChannel[c.channel]; ok {
+		return eris.Errorf("secure input is already being captured on channel %s", c.channel)
+	}
+	ss.byToken[c.token] = c
+	ss.byChannel[c.channel] = c
+	return nil
+}
+
+func (ss *secureInputSet) remove(token string) (*secureCapture, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	c, ok := ss.byToken[token]
+	if ok {
+		delete(ss.byToken, token)
+		delete(ss.byChannel, c.channel)
+	}
+	return c, ok
+}
+
+// recordingTracker tracks the targets of the live recordings in progress,
+// indexed by recording name
+type recordingTracker struct {
+	targets map[string]string
+	mu      sync.Mutex
+}
+
+func (t *recordingTracker) ProcessEvent(e ari.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch v := e.(type) {
+	case *ari.RecordingStarted:
+		if t.targets == nil {
+			t.targets = make(map[string]string)
+		}
+		t.targets[v.Recording.Name] = v.Recording.TargetURI
+	case *ari.RecordingFinished:
+		delete(t.targets, v.Recording.Name)
+	case *ari.RecordingFailed:
+		delete(t.targets, v.Recording.Name)
+	}
+}
+
+// snapshot returns the targets of the live recordings in progress, indexed by
+// recording name
+func (t *recordingTracker) snapshot() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ret := make(map[string]string, len(t.targets))
+	for name, target := range t.targets {
+		ret[name] = target
+	}
+	return ret
+}
+
+// newToken returns a random, unguessable token
+func newToken() (string, error) {
+	tok := make([]byte, 16)
+	if _, err := rand.Read(tok); err != nil {
+		return "", eris.Wrap(err, "failed to generate token")
+	}
+	return hex.EncodeToString(tok), nil
+}
+
+func (s *Server) secureInputStart(ctx context.Context, reply string, req *proxy.Request) {
+	if req.SecureInput == nil {
+		s.sendError(reply, eris.New("secure input options are required"))
+		return
+	}
+	if err := req.SecureInput.Validate(); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	tok, err := newToken()
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	c := &secureCapture{
+		token:   tok,
+		channel: req.Key.ID,
+		opts:    *req.SecureInput,
+		active:  true,
+	}
+	if err := s.secureInputs.add(c); err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	// Digits are withheld from this point; pause the recordings before
+	// arming the timeout
+	paused := s.pauseRecordings(req.Key.ID)
+
+	timeout := DefaultSecureInputTimeout
+	if c.opts.Timeout > 0 {
+		timeout = c.opts.Timeout
+	}
+
+	s.secureInputs.mu.Lock()
+	active := c.active
+	if active {
+		c.paused = paused
+		c.timer = s.clock().AfterFunc(timeout, func() {
+			s.secureInputs.mu.Lock()
+			done := c.complete("timeout")
+			s.secureInputs.mu.Unlock()
+
+			// The capture is abandoned, so its digits are discarded and the
+			// channel may capture again
+			if done != nil {
+				s.secureInputs.remove(c.token)
+			}
+			s.completeSecureInput(done)
+		})
+	}
+	s.secureInputs.mu.Unlock()
+
+	if !active {
+		// The capture completed while the recordings were being paused
+		s.resumeRecordings(paused)
+	}
+
+	s.publish(reply, &proxy.Response{
+		Key: ari.NewKey(proxy.SecureInputKey, c.token, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+	})
+}
+
+func (s *Server) secureInputStop(ctx context.Context, reply string, req *proxy.Request) {
+	c, ok := s.secureInputs.remove(req.Key.ID)
+	if !ok {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+
+	s.secureInputs.mu.Lock()
+	done := c.complete("stopped")
+	digits := c.digits.String()
+	s.secureInputs.mu.Unlock()
+
+	s.completeSecureInput(done)
+
+	ciphertext, err := proxy.EncryptSecureInput(c.opts.PublicKey, digits)
+	if err != nil {
+		s.sendError(reply, eris.Wrap(err, "failed to encrypt secure input"))
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Data: &proxy.EntityData{
+			SecureInput: &proxy.SecureInputResult{
+				Digits: ciphertext,
+			},
+		},
+	})
+}
+
+// processSecureInput captures the DTMF events of channels with active secure
+// input captures.  It returns true if the event must be withheld from clients.
+func (s *Server) processSecureInput(e ari.Event) bool {
+	switch v := e.(type) {
+	case *ari.ChannelDtmfReceived:
+		s.secureInputs.mu.Lock()
+		c, ok := s.secureInputs.byChannel[v.Channel.ID]
+		if !ok || !c.active {
+			s.secureInputs.mu.Unlock()
+			return false
+		}
+		var done *secureCompletion
+		if reason := c.add(v.Digit); reason != "" {
+			done = c.complete(reason)
+		}
+		s.secureInputs.mu.Unlock()
+
+		s.completeSecureInput(done)
+		return true
+	case *ari.ChannelDestroyed:
+		// Captured digits are discarded with the channel
+		s.secureInputs.mu.Lock()
+		c, ok := s.secureInputs.byChannel[v.Channel.ID]
+		var done *secureCompletion
+		if ok {
+			done = c.complete("hangup")
+		}
+		s.secureInputs.mu.Unlock()
+
+		if ok {
+			s.secureInputs.remove(c.token)
+		}
+		s.completeSecureInput(done)
+	}
+	return false
+}
+
+// completeSecureInput publishes the SecureInputComplete event of a completed
+// capture, if any, and resumes its paused recordings.  As it is called from
+// the event loop, the recordings are resumed in the background.  The secure
+// input lock must not be held.
+func (s *Server) completeSecureInput(done *secureCompletion) {
+	if done == nil {
+		return
+	}
+
+	s.publishEvent(&proxy.SecureInputComplete{
+		EventData: s.newEventData(proxy.EventSecureInputComplete),
+		ChannelID: done.channel,
+		Reason:    done.reason,
+		Digits:    done.digits,
+	})
+
+	if len(done.paused) > 0 {
+		go s.resumeRecordings(done.paused)
+	}
+}
+
+// resumeRecordings resumes the given recordings, paused for a capture
+func (s *Server) resumeRecordings(paused []*ari.Key) {
+	for _, k := range paused {
+		if err := s.ari.LiveRecording().Resume(k); err != nil {
+			s.Log.Warn("failed to resume recording after secure input", "recording", k.ID, "error", err)
+		}
+	}
+}
+
+// pauseRecordings pauses the recordings of the channel and of any bridge
+// which it is in, returning the keys of the paused recordings.  It makes ARI
+// requests, so it must not be called from the event loop.
+func (s *Server) pauseRecordings(id string) (paused []*ari.Key) {
+	var names []string
+	for name, target := range s.recordings.snapshot() {
+		if target == "channel:"+id || (strings.HasPrefix(target, "bridge:") && s.bridgeHasChannel(strings.TrimPrefix(target, "bridge:"), id)) {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		k := ari.NewKey(ari.LiveRecordingKey, name)
+		if err := s.ari.LiveRecording().Pause(k); err != nil {
+			s.Log.Warn("failed to pause recording for secure input", "recording", name, "error", err)
+			continue
+		}
+		paused = append(paused, k)
+	}
+	return
+}
+
+func (s *Server) bridgeHasChannel(bridgeID, channelID string) bool {
+	data, err := s.ari.Bridge().Data(ari.NewKey(ari.BridgeKey, bridgeID))
+	if err != nil {
+		return false
+	}
+	for _, id := range data.ChannelIDs {
+		if id == channelID {
+			return true
+		}
+	}
+	return false
+}
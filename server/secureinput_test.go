@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/inconshreveable/log15"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSecureCapture(t *testing.T) {
+	c := &secureCapture{opts: proxy.SecureInput{MaxDigits: 4, Terminator: "#"}}
+
+	for _, d := range []string{"1", "2", "3"} {
+		if reason := c.add(d); reason != "" {
+			t.Fatalf("capture completed early: %s", reason)
+		}
+	}
+	if reason := c.add("#"); reason != "terminator" {
+		t.Errorf("expected terminator, got %q", reason)
+	}
+	if reason := c.add("4"); reason != "max_digits" {
+		t.Errorf("expected max_digits, got %q", reason)
+	}
+	if c.digits.String() != "1234" {
+		t.Errorf("unexpected digits: %q", c.digits.String())
+	}
+}
+
+func TestSecureCaptureUnlimited(t *testing.T) {
+	c := &secureCapture{}
+
+	for i := 1; i < proxy.MaxSecureInputDigits; i++ {
+		if reason := c.add("1"); reason != "" {
+			t.Fatalf("capture completed after %d digits: %s", i, reason)
+		}
+	}
+	if reason := c.add("1"); reason != "max_digits" {
+		t.Errorf("expected max_digits, got %q", reason)
+	}
+}
+
+func TestSecureInputSet(t *testing.T) {
+	var ss secureInputSet
+
+	if err := ss.add(&secureCapture{token: "t1", channel: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.add(&secureCapture{token: "t2", channel: "c1"}); err == nil {
+		t.Error("expected error for second capture on the same channel")
+	}
+	if c, ok := ss.remove("t1"); !ok || c.channel != "c1" {
+		t.Errorf("unexpected capture: %+v (%v)", c, ok)
+	}
+	if err := ss.add(&secureCapture{token: "t2", channel: "c1"}); err != nil {
+		t.Errorf("failed to add capture after removal: %v", err)
+	}
+}
+
+func TestSecureInputTimeout(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := ari.NewKey(ari.LiveRecordingKey, "r1")
+	resumed := make(chan struct{})
+	lr := new(arimocks.LiveRecording)
+	lr.On("Pause", rec).Return(nil)
+	lr.On("Resume", rec).Return(nil).Run(func(_ mock.Arguments) { close(resumed) })
+	cl := new(arimocks.Client)
+	cl.On("LiveRecording").Return(lr)
+
+	fc := clock.NewFake(time.Unix(0, 0))
+	s := New(WithClock(fc))
+	s.Log.SetHandler(log15.DiscardHandler())
+	s.ari = cl
+	s.nats = &nats.EncodedConn{Conn: &nats.Conn{}}
+	s.Subjects = proxy.NewSubjectBuilder("ari.")
+	s.recordings.ProcessEvent(&ari.RecordingStarted{Recording: ari.LiveRecordingData{Name: "r1", TargetURI: "channel:c1"}})
+
+	s.secureInputStart(context.Background(), "", &proxy.Request{
+		Key:         ari.NewKey(ari.ChannelKey, "c1"),
+		SecureInput: &proxy.SecureInput{PublicKey: pub, Timeout: time.Minute},
+	})
+	if !s.processSecureInput(&ari.ChannelDtmfReceived{Channel: ari.ChannelData{ID: "c1"}, Digit: "1"}) {
+		t.Error("captured digit not withheld")
+	}
+
+	fc.Advance(time.Minute)
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("recording not resumed after the timeout")
+	}
+	lr.AssertExpectations(t)
+
+	if s.processSecureInput(&ari.ChannelDtmfReceived{Channel: ari.ChannelData{ID: "c1"}, Digit: "2"}) {
+		t.Error("digit withheld after the timeout")
+	}
+	s.secureInputs.mu.Lock()
+	n := len(s.secureInputs.byChannel) + len(s.secureInputs.byToken)
+	s.secureInputs.mu.Unlock()
+	if n != 0 {
+		t.Error("capture not unregistered after the timeout")
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/nats-io/nats.go"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultSelfTestTimeout is the default time allowed for each step of the
+// self-test
+const DefaultSelfTestTimeout = 10 * time.Second
+
+// SelfTestCheck is the result of a step of the self-test
+type SelfTestCheck struct {
+	// Name describes the step
+	Name string
+
+	// Detail describes the outcome of a successful step
+	Detail string
+
+	// Err is the failure of the step, if it failed
+	Err error
+
+	// Skipped indicates that the step was not run, because a step on which
+	// it depends failed
+	Skipped bool
+
+	// Duration is the time taken by the step
+	Duration time.Duration
+}
+
+// SelfTestReport is the result of the self-test of a server
+type SelfTestReport struct {
+	Checks []SelfTestCheck
+}
+
+// Failed indicates whether any step of the self-test failed or was skipped
+func (r *SelfTestReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Err != nil || c.Skipped {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes the report, one step per line
+func (r *SelfTestReport) Write(w io.Writer) error {
+	for _, c := range r.Checks {
+		var line string
+		switch {
+		case c.Skipped:
+			line = fmt.Sprintf("[SKIP] %s", c.Name)
+		case c.Err != nil:
+			line = fmt.Sprintf("[FAIL] %s (%s): %v", c.Name, c.Duration.Round(time.Millisecond), c.Err)
+		default:
+			line = fmt.Sprintf("[ OK ] %s (%s)", c.Name, c.Duration.Round(time.Millisecond))
+			if c.Detail != "" {
+				line += ": " + c.Detail
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selfTest records the steps of a self-test
+type selfTest struct {
+	report SelfTestReport
+}
+
+// run runs the step, if the steps on which it depends succeeded (as indicated
+// by ok), returning whether it succeeded
+func (t *selfTest) run(name string, ok bool, fn func() (detail string, err error)) bool {
+	if !ok {
+		t.report.Checks = append(t.report.Checks, SelfTestCheck{Name: name, Skipped: true})
+		return false
+	}
+
+	started := time.Now()
+	detail, err := fn()
+	t.report.Checks = append(t.report.Checks, SelfTestCheck{
+		Name:     name,
+		Detail:   detail,
+		Err:      err,
+		Duration: time.Since(started),
+	})
+	return err == nil
+}
+
+// SelfTest validates the configuration of the server without serving: it
+// connects to ARI and NATS, makes a harmless round trip on each (an Asterisk
+// Info request and a NATS request to itself), and verifies that the NATS user
+// is permitted to use every subject which the server uses.  The permission
+// check subscribes to the subjects and publishes an empty message to each
+// subject which the server publishes to, which clients ignore.  Each step is
+// given the timeout (or DefaultSelfTestTimeout, if zero).
+func (s *Server) SelfTest(ctx context.Context, ariOpts *native.Options, natsURI string, timeout time.Duration) *SelfTestReport {
+	if timeout <= 0 {
+		timeout = DefaultSelfTestTimeout
+	}
+	t := new(selfTest)
+
+	t.run("server options", true, func() (string, error) {
+		if s.optErr != nil {
+			return "", s.optErr
+		}
+		var err error
+		if s.eventRoutes, err = newEventRouter(s.EventRoutes); err != nil {
+			return "", err
+		}
+		if s.callFlows, err = newCallFlows(s.CallFlows); err != nil {
+			return "", err
+		}
+		s.varsetFilter, err = newVarsetFilter(s.VarsetFilter)
+		return "", err
+	})
+
+	restOK := t.run("ARI REST interface", true, func() (string, error) {
+		v, err := newARIREST(ariOpts).apiVersion()
+		if err != nil {
+			return "", err
+		}
+		if s.ARIVersion != "" {
+			return fmt.Sprintf("ARI %s (configured as %s)", v, s.ARIVersion), nil
+		}
+		return "ARI " + v, nil
+	})
+
+	var a ari.Client
+	defer func() {
+		if a != nil {
+			a.Close()
+		}
+	}()
+	ariOK := t.run("ARI WebSocket connection", restOK, func() (string, error) {
+		var err error
+		a, err = connectARI(ctx, ariOpts, timeout)
+		if err != nil {
+			return "", err
+		}
+		return "application " + a.ApplicationName(), nil
+	})
+
+	t.run("Asterisk info", ariOK, func() (string, error) {
+		info, err := a.Asterisk().Info(nil)
+		if err != nil {
+			return "", err
+		}
+		if info.SystemInfo.EntityID == "" {
+			return "", eris.New("empty Asterisk ID")
+		}
+		s.setNodeID(info.SystemInfo.EntityID)
+		s.Application = a.ApplicationName()
+		return fmt.Sprintf("node %s, Asterisk %s", info.SystemInfo.EntityID, info.SystemInfo.Version), nil
+	})
+
+	var nc *nats.Conn
+	defer func() {
+		if nc != nil {
+			nc.Close()
+		}
+	}()
+	mon := new(permissionMonitor)
+	natsOK := t.run("NATS connection", true, func() (string, error) {
+		var err error
+		nc, err = nats.Connect(natsURI, nats.Timeout(timeout), nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			mon.handleError(nc, sub, err)
+		}))
+		if err != nil {
+			return "", err
+		}
+		return nc.ConnectedUrl(), nil
+	})
+
+	if s.Subjects == nil {
+		s.Subjects = proxy.NewSubjectBuilder(s.NATSPrefix)
+	}
+	token := rid.New("st")
+
+	t.run("NATS round trip", natsOK, func() (string, error) {
+		// The request and its reply stay within the request subjects of the
+		// node, under which the server's user is permitted to subscribe
+		subject := s.Subjects.Request("get", s.Application, s.nodeID()) + "." + token
+		reply := subject + ".reply"
+
+		sub, err := nc.Subscribe(subject, func(m *nats.Msg) {
+			nc.Publish(m.Reply, m.Data) // nolint: errcheck
+		})
+		if err != nil {
+			return "", err
+		}
+		defer sub.Unsubscribe() // nolint: errcheck
+
+		replySub, err := nc.SubscribeSync(reply)
+		if err != nil {
+			return "", err
+		}
+		defer replySub.Unsubscribe() // nolint: errcheck
+
+		started := time.Now()
+		if err := nc.PublishRequest(subject, reply, []byte(token)); err != nil {
+			return "", err
+		}
+		if _, err := replySub.NextMsg(timeout); err != nil {
+			return "", eris.Wrapf(err, "no reply on %s", reply)
+		}
+		return fmt.Sprintf("%s in %s", subject, time.Since(started).Round(time.Microsecond)), nil
+	})
+
+	t.run("NATS subject permissions", natsOK, func() (string, error) {
+		subjects := s.requiredSubjects(token)
+		denied, err := verifySubjects(nc, mon, subjects, timeout)
+		if err != nil {
+			return "", err
+		}
+		if len(denied) > 0 {
+			return "", eris.Errorf("permission denied to %s", describeSubjects(denied))
+		}
+		return fmt.Sprintf("%d subjects", len(subjects)), nil
+	})
+
+	return &t.report
+}
+
+// connectARI connects to ARI, giving up after the timeout
+func connectARI(ctx context.Context, opts *native.Options, timeout time.Duration) (ari.Client, error) {
+	type result struct {
+		a   ari.Client
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		a, err := native.Connect(opts)
+		ch <- result{a, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.a, r.err
+	case <-time.After(timeout):
+		return nil, eris.New("timeout connecting to the ARI WebSocket")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
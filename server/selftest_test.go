@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/internal/natstest"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/native"
+	"golang.org/x/net/websocket"
+)
+
+func TestSelfTestReport(t *testing.T) {
+	st := new(selfTest)
+	ok := st.run("first", true, func() (string, error) { return "fine", nil })
+	failed := st.run("second", ok, func() (string, error) { return "", errors.New("broken") })
+	st.run("third", failed, func() (string, error) {
+		t.Error("ran step whose dependency failed")
+		return "", nil
+	})
+
+	r := &st.report
+	if !r.Failed() {
+		t.Error("report with failures not failed")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 ||
+		!strings.HasPrefix(lines[0], "[ OK ] first") || !strings.HasSuffix(lines[0], ": fine") ||
+		!strings.HasPrefix(lines[1], "[FAIL] second") || !strings.HasSuffix(lines[1], ": broken") ||
+		lines[2] != "[SKIP] third" {
+		t.Errorf("unexpected report:\n%s", buf)
+	}
+
+	if (&SelfTestReport{Checks: r.Checks[:1]}).Failed() {
+		t.Error("successful report failed")
+	}
+}
+
+// fakeAsterisk serves the parts of ARI which the self-test uses, recording
+// the requests it receives
+type fakeAsterisk struct {
+	*httptest.Server
+
+	requests []string
+	mu       sync.Mutex
+}
+
+func newFakeAsterisk(t *testing.T) *fakeAsterisk {
+	a := new(fakeAsterisk)
+
+	mux := http.NewServeMux()
+	reply := func(v interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(v) // nolint: errcheck
+		}
+	}
+	mux.Handle("/ari/api-docs/resources.json", reply(map[string]string{"apiVersion": "5.0.0"}))
+	mux.Handle("/ari/asterisk/info", reply(&ari.AsteriskInfo{
+		SystemInfo: ari.SystemInfo{EntityID: "node1", Version: "16.10.0"},
+	}))
+	mux.Handle("/ari/events", websocket.Handler(func(ws *websocket.Conn) {
+		// Hold the connection open, without events, until the client closes it
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}))
+
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+			t.Errorf("unexpected credentials for %s: %s/%s", r.URL.Path, user, pass)
+		}
+		a.mu.Lock()
+		a.requests = append(a.requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		a.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	return a
+}
+
+// received indicates whether the given request was received
+func (a *fakeAsterisk) received(req string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, r := range a.requests {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSelfTest(t *testing.T) {
+	if raceEnabled {
+		// The native ARI client closes its WebSocket connection racily
+		t.Skip("native ARI client is not race-free")
+	}
+
+	ast := newFakeAsterisk(t)
+	defer ast.Close()
+
+	ns, err := natstest.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	ariOpts := func() *native.Options {
+		return &native.Options{
+			Application:  "app",
+			Username:     "user",
+			Password:     "secret",
+			URL:          ast.URL + "/ari",
+			WebsocketURL: "ws" + strings.TrimPrefix(ast.URL, "http") + "/ari/events",
+		}
+	}
+
+	s := New()
+	r := s.SelfTest(context.Background(), ariOpts(), ns.URL(), time.Second)
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if r.Failed() {
+		t.Fatalf("self-test failed:\n%s", buf)
+	}
+
+	details := make(map[string]string)
+	for _, c := range r.Checks {
+		details[c.Name] = c.Detail
+	}
+	for name, detail := range map[string]string{
+		"ARI REST interface":       "ARI 5.0.0",
+		"ARI WebSocket connection": "application app",
+		"Asterisk info":            "node node1, Asterisk 16.10.0",
+		"NATS connection":          ns.URL(),
+	} {
+		if details[name] != detail {
+			t.Errorf("unexpected detail of %q: %q", name, details[name])
+		}
+	}
+	if s.nodeID() != "node1" || s.Application != "app" {
+		t.Errorf("unexpected identity: node %q, application %q", s.nodeID(), s.Application)
+	}
+	for _, req := range []string{
+		"GET /ari/api-docs/resources.json?",
+		"GET /ari/events?app=app",
+		"GET /ari/asterisk/info?",
+	} {
+		if !ast.received(req) {
+			t.Errorf("ARI request %q not received in %v", req, ast.requests)
+		}
+	}
+
+	// The NATS steps are skipped if NATS is unreachable
+	ns.Close()
+	r = New().SelfTest(context.Background(), ariOpts(), ns.URL(), time.Second)
+	buf.Reset()
+	r.Write(buf) // nolint: errcheck
+	if !r.Failed() ||
+		!strings.Contains(buf.String(), "[FAIL] NATS connection") ||
+		!strings.Contains(buf.String(), "[SKIP] NATS round trip") ||
+		!strings.Contains(buf.String(), "[SKIP] NATS subject permissions") ||
+		!strings.Contains(buf.String(), "[ OK ] Asterisk info") {
+		t.Errorf("unexpected report:\n%s", buf)
+	}
+}
@@ -2,14 +2,16 @@ package server
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
 	"github.com/CyCoreSystems/ari-proxy/v5/server/dialog"
 	"github.com/CyCoreSystems/ari/v5"
 	"github.com/CyCoreSystems/ari/v5/client/native"
+	"github.com/CyCoreSystems/ari/v5/rid"
 	"github.com/rotisserie/eris"
 
 	"github.com/inconshreveable/log15"
@@ -20,12 +22,25 @@ import (
 // It implements a hard coded fault tolerance for a starting NATS cluster
 const DefaultNATSReconnectionAttemts = 5
 
+// ErrEntityIDChanged is returned by Listen when the entity ID of the Asterisk
+// system changes (e.g. Asterisk was replaced), as the server's announced
+// identity is no longer valid
+var ErrEntityIDChanged = eris.New("Asterisk entity ID changed")
+
 // DefaultNATSReconnectionWait is the default wating time between each reconnection
 // attempt
 const DefaultNATSReconnectionWait = 5 * time.Second
 
 // Server describes the asterisk-facing ARI proxy server
 type Server struct {
+	// eventSeq is the sequence number of the last event published.  It is
+	// accessed atomically, so it comes first to be 64-bit aligned.
+	eventSeq uint64
+
+	// metrics collects the metrics of the server.  Its atomic counters
+	// follow eventSeq to be 64-bit aligned as well.
+	metrics serverMetrics
+
 	// Application is the name of the ARI application of this server
 	Application string
 
@@ -33,60 +48,525 @@ type Server struct {
 	// to which this server is connected.
 	AsteriskID string
 
+	// InstanceID uniquely identifies this server among the servers of the
+	// cluster, distinguishing the servers which serve the same Asterisk node
+	// (e.g. an HA pair, or blue/green deployments).  It is carried in
+	// announcements, in the headers of events and in responses.  If empty,
+	// one is generated when the server starts listening.
+	InstanceID string
+
+	// conflicts records the other instances which announce themselves as
+	// serving the same application and node
+	conflicts conflictTracker
+
+	// Version is the version of the proxy, which is announced to clients
+	Version string
+
 	// NATSPrefix is the string which should be prepended to all NATS subjects, sending and receiving.  It defaults to "ari.".
 	NATSPrefix string
 
+	// EventRoutes is the list of additional subjects to which events of
+	// particular types are published
+	EventRoutes []EventRoute
+
+	// eventRoutes is the validated EventRoutes, indexed by event type
+	eventRoutes eventRouter
+
+	// EventTypeSubjects indicates that events are published to per-type
+	// subjects (e.g. "ari.event.<app>.<node>.ChannelDtmfReceived") rather
+	// than to the event subject of the node, so that the NATS servers only
+	// deliver to clients the types of events to which they subscribe.  The
+	// Subjects builder must implement proxy.TypedEventSubjectBuilder, and
+	// clients must subscribe accordingly (see client.WithEventTypeSubjects).
+	EventTypeSubjects bool
+
+	// Subjects optionally customizes the construction of NATS subjects.  If
+	// nil, the default scheme is used with NATSPrefix.  Clients must use an
+	// equivalent builder.
+	Subjects proxy.SubjectBuilder
+
+	// Codec is the name of the codec with which responses and events are
+	// encoded (see proxy.RegisterCodec).  It defaults to JSON.  Requests are
+	// decoded with the codec which encoded them, so clients and proxies may
+	// switch codecs one at a time.
+	Codec string
+
+	// codec is the Codec named by Codec
+	codec proxy.Codec
+
 	// ari is the native Asterisk ARI client by which this proxy is directly connected
 	ari ari.Client
 
+	// rest makes the raw ARI REST requests which the ARI client does not
+	// support.  It is only available when the server connects to ARI itself.
+	rest *ariREST
+
+	// ARIVersion is the version of the ARI interface of Asterisk (e.g.
+	// "5.0.0").  If empty, it is detected on connection, where the server
+	// connects to ARI itself.  Requests for operations which the version does
+	// not provide are rejected with proxy.ErrNotSupportedByAsterisk.
+	ARIVersion string
+
+	// ariVersion is the parsed ARIVersion, if it is known
+	ariVersion *ariVersion
+
+	// inventory records the Asterisk version and channel drivers of the node
+	inventory inventory
+
+	// MaxCalls is the number of concurrent calls which the node is expected
+	// to handle (e.g. the maxcalls setting of Asterisk), which is announced
+	// as a hint for call placement.  Zero means unknown.
+	MaxCalls int
+
+	// Labels are arbitrary labels (e.g. the region or zone of the node)
+	// which are announced as hints for call placement
+	Labels map[string]string
+
 	// nats is the JSON-encoded NATS connection
 	nats *nats.EncodedConn
 
+	// VerifyPermissions indicates that the server checks, on startup, that
+	// its NATS user may use every subject which it uses, failing to start if
+	// it may not
+	VerifyPermissions bool
+
+	// permissions records the NATS permissions violations reported on the
+	// connection
+	permissions permissionMonitor
+
 	// Dialog is the dialog manager
 	Dialog dialog.Manager
 
+	// FanOut optionally configures a worker pool which publishes events to
+	// their dialogs.  If nil, events are published to their dialogs serially.
+	FanOut *FanOutConfig
+
+	// fanOut is the worker pool described by FanOut
+	fanOut *fanOutPool
+
+	// DialogEventLimit optionally limits the rate at which events of
+	// high-frequency types are published to each dialog.  If nil, dialog
+	// events are not limited.
+	DialogEventLimit *DialogEventLimitConfig
+
+	// dialogEventLimiter enforces DialogEventLimit
+	dialogEventLimiter *dialogEventLimiter
+
+	// Quota is the optional set of resource quotas to enforce on creation
+	// requests.  If nil, no quotas are enforced.
+	Quota *QuotaConfig
+
+	// quota is the engine which tracks and enforces the Quota configuration
+	quota *quotaEngine
+
+	// EmergencyDestinations is the list of regular expressions describing
+	// safety-critical destinations (e.g. "^911$", "^112$").  Calls to matching
+	// destinations bypass quotas, rate limits, and draining, and each bypass is
+	// audit-logged.  Patterns are matched against the dialed number of the
+	// endpoint (e.g. "911" for "PJSIP/911@trunk") and the dialplan extension.
+	EmergencyDestinations []string
+
+	// emergency is the compiled matcher for EmergencyDestinations
+	emergency *emergencyMatcher
+
+	// maintenance is the maintenance window scheduled on the node, during
+	// which it drains
+	maintenance maintenanceSchedule
+
+	// started is the time at which the server started listening
+	started time.Time
+
+	// ariContact records the time of the last contact with Asterisk
+	ariContact contactTracker
+
+	// JetStream optionally consumes create and command requests from a
+	// JetStream stream, acknowledging each once it has been executed.  If
+	// nil, they are received directly.
+	JetStream *JetStreamConfig
+
+	// EventStream optionally stores the events of the application in a
+	// JetStream stream, from which clients may replay them.  If nil, events
+	// are only published.
+	EventStream *EventStreamConfig
+
+	// eventAckInbox holds the subject on which the event stream acknowledges
+	// stored events
+	eventAckInbox atomic.Value
+
+	// Keepalive optionally enables the keepalive of the ARI WebSocket, which
+	// detects a silently dead connection.  If nil, the connection is only
+	// considered down once the ARI client notices it.
+	Keepalive *KeepaliveConfig
+
+	// keepalive tracks the pings of the ARI WebSocket keepalive, if enabled
+	keepalive *keepaliveTracker
+
+	// EndpointRewriters is the ordered list of hooks which rewrite the
+	// destination endpoints of originate and channel create requests before
+	// they are sent to Asterisk.
+	EndpointRewriters []EndpointRewriter
+
+	// Router optionally selects the routes (with failover order) for originate
+	// requests, after endpoint rewriting.
+	Router Router
+
+	// OriginatePolicies is the ordered list of policies which are consulted
+	// before each outbound channel is created, any of which may block it
+	// (e.g. for fraud detection).  Emergency destinations bypass them.
+	OriginatePolicies []OriginatePolicy
+
+	// Screeners is the ordered list of call screeners which are consulted for
+	// each inbound call entering the ARI application, before the StasisStart
+	// event is published to clients.
+	Screeners []Screener
+
+	// ScreeningTimeout is the time within which the screeners must return
+	// their verdict on a call, after which the call is allowed.  It
+	// defaults to DefaultScreeningTimeout.
+	ScreeningTimeout time.Duration
+
+	// CallFlows are the declarative call flows which the proxy executes
+	// itself for the calls entering the application which match them, after
+	// screening, in place of publishing their StasisStart events
+	CallFlows []CallFlow
+
+	// callFlows is the validated CallFlows
+	callFlows []*compiledCallFlow
+
+	// VarsetFilter optionally selects, by variable name, the ChannelVarset
+	// events which are published.  If nil, all are published.
+	VarsetFilter *VarsetFilterConfig
+
+	// varsetFilter is the compiled VarsetFilter
+	varsetFilter *varsetFilter
+
+	// AllowDebugCapture enables the capture of the ARI exchanges of the
+	// requests selected at runtime by DebugCaptureStart requests.  The
+	// debug capture requests are rejected unless it is set.
+	AllowDebugCapture bool
+
+	// debugCapture captures the ARI exchanges of the requests selected at
+	// runtime by DebugCaptureStart requests.  It is nil if the capture is
+	// not allowed or the server was not given the ARI connection parameters.
+	debugCapture *debugCapture
+
+	// SoundUpload enables the upload of sound files into the sounds
+	// directory of the node.  If nil, the sound upload requests are
+	// rejected.
+	SoundUpload *SoundUploadConfig
+
+	// soundUploads tracks the sound uploads in progress
+	soundUploads *soundUploads
+
+	// Voicemail enables the voicemail module with the given configuration.
+	// If nil, the voicemail requests are rejected.
+	Voicemail *VoicemailConfig
+
+	// Fax enables the fax module with the given configuration.  If nil, the
+	// fax requests are rejected.
+	Fax *FaxConfig
+
+	// faxes tracks the fax operations in progress
+	faxes faxTracker
+
+	// AMD is the answering machine detector used by ChannelAMD requests and
+	// dialer campaigns.  If nil, answering machine detection is not available.
+	AMD AMDDetector
+
+	// Metrics enables the HTTP listener on which the metrics of the server are
+	// exposed, with the given configuration.  Metrics are collected even if it
+	// is nil.
+	Metrics *MetricsConfig
+
+	// HealthEndpoint enables the HTTP listener on which the liveness and
+	// readiness of the server are exposed, with the given configuration
+	HealthEndpoint *HealthConfig
+
+	// Clock is the time source of the server's announcements, heartbeats,
+	// quotas, watch leases and maintenance windows.  It defaults to the
+	// system clock; tests and replays may use a clock.Fake.
+	Clock clock.Clock
+
+	// Retry enables the retries of idempotent requests which fail with a
+	// transient ARI error, with the given configuration
+	Retry *RetryConfig
+
+	// StateConflict configures the retries of idempotent channel operations
+	// which fail because their channel is in an invalid state.  If nil, the
+	// defaults of StateConflictConfig apply.
+	StateConflict *StateConflictConfig
+
+	// NATSStateHandler, if set, is called on each change of the state of the
+	// NATS connection (see NATSStateChange).  It is called from the
+	// goroutine of the NATS client, and must not block.
+	NATSStateHandler func(NATSStateChange)
+
+	// ARIReconnect enables the reconnection of the server to ARI, with the
+	// given configuration, when the ARI connection is lost or Asterisk
+	// restarts.  If nil, the server stops in these cases.  It only applies to
+	// servers run by Listen, and enables the default Keepalive if none is
+	// set, by which the loss of the connection is detected.
+	ARIReconnect *ARIReconnectConfig
+
+	// reconnector reconnects to ARI, if the reconnection is enabled
+	reconnector *ariReconnector
+
+	// requestHandler is the handler of the NATS request subscriptions
+	requestHandler nats.MsgHandler
+
+	// nodeSubs are the subscriptions to the requests addressed to the node
+	nodeSubs []*nats.Subscription
+
+	// nodeClosed indicates that the node subscriptions were closed on
+	// shutdown, and may not be moved
+	nodeClosed bool
+
+	// nodeMu guards AsteriskID, nodeSubs and nodeClosed, which change when
+	// the server moves to another node on reconnection
+	nodeMu sync.RWMutex
+
+	// ClickToCall enables the click-to-call HTTP endpoint with the given
+	// configuration
+	ClickToCall *ClickToCallConfig
+
+	// AudioFork enables the audio fork module with the given configuration.
+	// If nil, audio fork requests are rejected.
+	AudioFork *AudioForkConfig
+
+	// forks is the set of audio forks in progress
+	forks audioForkSet
+
+	// LogStream enables the streaming of Asterisk logging channels with the
+	// given configuration.  If nil, log stream requests are rejected.
+	LogStream *LogStreamConfig
+
+	// logStreams is the set of log streams in progress
+	logStreams logStreamSet
+
+	// Compression enables the compression of large responses with the given
+	// configuration
+	Compression *CompressionConfig
+
+	// compressed is the set of reply subjects whose responses may be compressed
+	compressed compressedReplies
+
+	// MaxResponseSize is the maximum size, in bytes, of a response message,
+	// above which the response is split into chunks (if the request accepts
+	// chunked responses) or rejected with proxy.ErrResponseTooLarge.  It
+	// defaults to the maximum payload of the NATS connection.
+	MaxResponseSize int
+
+	// CompressOversized indicates that events and responses exceeding the
+	// maximum NATS payload are gzip-compressed (if their requests accept
+	// compressed responses), whether or not Compression is enabled, rather
+	// than rejected
+	CompressOversized bool
+
+	// largeReplies maps the reply subjects of the requests being dispatched
+	// to the encodings which they accept for large responses
+	largeReplies sync.Map
+
+	// requestKinds maps the reply subjects of the requests being dispatched
+	// to their kinds, by which their errors are classified
+	requestKinds sync.Map
+
+	// retries maps the reply subjects of the requests being dispatched to
+	// their retry state, if they may be retried
+	retries sync.Map
+
+	// DeadAir enables dead-air monitoring of bridged calls with the given
+	// configuration
+	DeadAir *DeadAirConfig
+
+	// deadAir tracks the talk state of bridges
+	deadAir *deadAirMonitor
+
+	// Recording configures the naming and collision policy of recordings.  If
+	// nil, recordings requested without a name are given unique IDs.
+	Recording *RecordingConfig
+
+	// holds tracks the hold state of the channels held by CallHold
+	holds holdTracker
+
+	// dials tracks the dials in progress
+	dials dialTracker
+
+	// bridgeParties tracks the parties of bridges, from which bridge party
+	// change events are derived
+	bridgeParties bridgePartyTracker
+
+	// playlists tracks the progress of playbacks of multiple media URIs
+	playlists playlistTracker
+
+	// recordingLimits tracks the maximum durations of live recordings
+	recordingLimits recordingLimitTracker
+
+	// campaigns is the set of dialer campaigns run by this server
+	campaigns campaignSet
+
+	// secureInputs is the set of secure input captures in progress
+	secureInputs secureInputSet
+
+	// originated records the channels which the proxy created
+	originated originatedChannels
+
+	// digitCollectors is the set of digit collections in progress
+	digitCollectors digitCollectorSet
+
+	// recordings tracks the targets of the live recordings in progress
+	recordings recordingTracker
+
+	// watches is the set of watches of channels and bridges in progress
+	watches watchSet
+
+	// CallerID optionally resolves the caller ID numbers of calls entering
+	// the application, whose results are attached to the channel variables
+	// of their StasisStart events (see proxy.GetCallerInfo)
+	CallerID CallerIDProvider
+
+	// Geography optionally resolves the country and region of the caller
+	// numbers of calls entering the application, which are attached to the
+	// channel variables of their StasisStart events (see
+	// proxy.GetNumberGeography)
+	Geography *Geographer
+
+	// ChannelVariables is the list of channel variables which are read for
+	// each call entering the application, and reported by a
+	// ChannelVariables event following its StasisStart event
+	ChannelVariables []string
+
+	// StirShaken enables the surfacing of STIR/SHAKEN attestation data on
+	// StasisStart events (see proxy.GetAttestation)
+	StirShaken bool
+
+	// ShutdownGracePeriod is the time allowed for the cleanup of the
+	// server's subcomponents when it stops.  It defaults to
+	// DefaultShutdownGracePeriod.
+	ShutdownGracePeriod time.Duration
+
+	// Systemd enables the integration of the server with the systemd
+	// service manager, with the given configuration
+	Systemd *SystemdConfig
+
+	// systemd notifies systemd, if the server integrates with it and is run
+	// by it
+	systemd *systemdNotifier
+
+	// DrainTimeout is the time for which the server, when it stops, waits
+	// for the requests being handled to complete, after refusing new
+	// requests and before cancelling them.  It defaults to
+	// DefaultDrainTimeout.
+	DrainTimeout time.Duration
+
+	// requests tracks the requests being handled
+	requests requestTracker
+
+	// shutdowns records the cleanups of the server's shutdowns
+	shutdowns shutdownTracker
+
 	readyCh chan struct{}
 
 	// cancel is the context cancel function, by which all subtended subscriptions may be terminated
 	cancel context.CancelFunc
 
+	// err is the error with which the server was stopped, if any
+	err error
+
+	// optErr is the error of the first invalid option given to New
+	optErr error
+
+	// lifecycle protects cancel and err
+	lifecycle sync.Mutex
+
 	// Log is the log15.Logger for the service.  You may replace or call SetHandler() on this at any time to change the logging of the service.
 	Log log15.Logger
 }
 
-// New returns a new Server
-func New() *Server {
+// New returns a new Server, configured by the given options.  If any option is
+// invalid, Listen fails with its error.
+func New(opts ...Option) *Server {
 	log := log15.New()
 	log.SetHandler(log15.DiscardHandler())
 
-	return &Server{
+	s := &Server{
 		NATSPrefix: "ari.",
 		readyCh:    make(chan struct{}),
 		Dialog:     dialog.NewMemManager(),
 		Log:        log,
 	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil && s.optErr == nil {
+			s.optErr = err
+		}
+	}
+	return s
 }
 
 // Listen runs the given server, listening to ARI and NATS, as specified
 func (s *Server) Listen(ctx context.Context, ariOpts *native.Options, natsURI string) (err error) {
+	if s.optErr != nil {
+		return eris.Wrap(s.optErr, "invalid server option")
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
-	s.cancel = cancel
+	defer cancel()
+	s.start(cancel)
+
+	// Prepare the debug capture of the exchanges with ARI, relaying the
+	// requests of the ARI client through its transport
+	restOpts := ariOpts
+	if withDebugCapture && s.AllowDebugCapture {
+		s.debugCapture = newDebugCapture(ariOpts.URL, s.clock())
+		relayed, stop, err := s.debugCapture.relay(ariOpts)
+		if err != nil {
+			return eris.Wrap(err, "failed to prepare debug capture")
+		}
+		defer stop()
+		ariOpts = relayed
+	}
 
 	// Connect to ARI
-	s.ari, err = native.Connect(ariOpts)
-	if err != nil {
-		return eris.Wrap(err, "failed to connect to ARI")
+	if s.ARIReconnect != nil {
+		// The native client redials a dropped WebSocket without reporting
+		// it, so the loss of the connection is detected by the keepalive
+		if s.Keepalive == nil {
+			s.Keepalive = new(KeepaliveConfig)
+		}
+
+		rc := newReconnectingClient(ariOpts)
+		s.reconnector = &ariReconnector{
+			client: rc,
+			cfg:    s.ARIReconnect.withDefaults(),
+			lost:   make(chan error, 1),
+		}
+		s.ari = rc
+		if err := s.connectARI(ctx); err != nil {
+			return eris.Wrap(err, "failed to connect to ARI")
+		}
+	} else {
+		s.ari, err = native.Connect(ariOpts)
+		if err != nil {
+			return eris.Wrap(err, "failed to connect to ARI")
+		}
 	}
 	defer s.ari.Close()
+	s.rest = newARIREST(restOpts)
+	if s.debugCapture != nil {
+		s.rest.client.Transport = s.debugCapture.transport
+	}
 
 	// Connect to NATS
-	nc, err := nats.Connect(natsURI)
+	nc, err := nats.Connect(natsURI, natsConnectOptions()...)
 	reconnectionAttempts := DefaultNATSReconnectionAttemts
 	for err == nats.ErrNoServers && reconnectionAttempts > 0 {
 		s.Log.Info("retrying to connect to NATS server", "attempts", reconnectionAttempts)
-		time.Sleep(DefaultNATSReconnectionWait)
-        	nc, err = nats.Connect(natsURI)
-                reconnectionAttempts -= 1
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(DefaultNATSReconnectionWait):
+		}
+		nc, err = nats.Connect(natsURI, natsConnectOptions()...)
+		reconnectionAttempts--
 	}
 	if err != nil {
 		return eris.Wrap(err, "failed to connect to NATS")
@@ -95,15 +575,25 @@ func (s *Server) Listen(ctx context.Context, ariOpts *native.Options, natsURI st
 	if err != nil {
 		return eris.Wrap(err, "failed to encode NATS connection")
 	}
-	defer s.nats.Close()
+	defer func() {
+		// Stop the server before closing its connection, so that the
+		// closure is not taken for a failure
+		cancel()
+		s.nats.Close()
+	}()
 
 	return s.listen(ctx)
 }
 
 // ListenOn runs the given server, listening on the provided ARI and NATS connections
 func (s *Server) ListenOn(ctx context.Context, a ari.Client, n *nats.EncodedConn) error {
+	if s.optErr != nil {
+		return eris.Wrap(s.optErr, "invalid server option")
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
-	s.cancel = cancel
+	defer cancel()
+	s.start(cancel)
 
 	s.ari = a
 	s.nats = n
@@ -111,6 +601,14 @@ func (s *Server) ListenOn(ctx context.Context, a ari.Client, n *nats.EncodedConn
 	return s.listen(ctx)
 }
 
+// clock returns the time source of the server
+func (s *Server) clock() clock.Clock {
+	if s.Clock == nil {
+		return clock.Real
+	}
+	return s.Clock
+}
+
 // Ready returns a channel which is closed when the Server is ready
 func (s *Server) Ready() <-chan struct{} {
 	if s.readyCh == nil {
@@ -121,16 +619,19 @@ func (s *Server) Ready() <-chan struct{} {
 
 // nolint: gocyclo
 func (s *Server) listen(ctx context.Context) error {
-	s.Log.Debug("starting listener")
+	if s.InstanceID == "" {
+		s.InstanceID = rid.New("in")
+	}
+	s.Log.Debug("starting listener", "instance", s.InstanceID)
 
-	var wg closeGroup
-	defer func() {
-		select {
-		case <-wg.Done():
-		case <-time.After(500 * time.Millisecond):
-			panic("timeout waiting for shutdown of sub components")
-		}
-	}()
+	var cg closeGroup
+	defer s.shutdown(&cg)
+
+	// Requests are handled in a context which outlives the server's, so that
+	// they may complete while the server drains
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	s.requests.reset()
 
 	// First, get the Asterisk ID
 
@@ -139,106 +640,263 @@ func (s *Server) listen(ctx context.Context) error {
 		return eris.Wrap(err, "failed to get Asterisk ID")
 	}
 
-	s.AsteriskID = ret.SystemInfo.EntityID
-	if s.AsteriskID == "" {
+	s.setNodeID(ret.SystemInfo.EntityID)
+	if s.nodeID() == "" {
 		return eris.New("empty Asterisk ID")
 	}
+	s.inventory.setVersion(ret.SystemInfo.Version)
 
 	// Store the ARI application name for top-level access
 	s.Application = s.ari.ApplicationName()
 
+	s.detectARIVersion()
+	s.refreshChannelDrivers()
+
+	if s.Subjects == nil {
+		s.Subjects = proxy.NewSubjectBuilder(s.NATSPrefix)
+	}
+	if _, ok := s.Subjects.(proxy.TypedEventSubjectBuilder); s.EventTypeSubjects && !ok {
+		return eris.New("subject builder does not support per-type event subjects")
+	}
+	if s.codec, err = proxy.LookupCodec(s.Codec); err != nil {
+		return err
+	}
+
+	s.started = s.clock().Now()
+	s.ariContact.touch(s.clock().Now())
+
+	// Start tracking quota usage
+	s.quota = newQuotaEngine(s.Quota)
+	s.quota.clock = s.clock()
+	s.maintenance.clock = s.clock()
+
+	s.emergency, err = newEmergencyMatcher(s.EmergencyDestinations)
+	if err != nil {
+		return eris.Wrap(err, "failed to load emergency destinations")
+	}
+
+	s.eventRoutes, err = newEventRouter(s.EventRoutes)
+	if err != nil {
+		return eris.Wrap(err, "failed to load event routes")
+	}
+
+	s.callFlows, err = newCallFlows(s.CallFlows)
+	if err != nil {
+		return eris.Wrap(err, "failed to load call flows")
+	}
+
+	s.varsetFilter, err = newVarsetFilter(s.VarsetFilter)
+	if err != nil {
+		return eris.Wrap(err, "failed to load varset filter")
+	}
+
+	if s.SoundUpload != nil {
+		if !withSoundUpload {
+			return errExcluded(SubsystemSoundUpload)
+		}
+		if err := s.SoundUpload.validate(); err != nil {
+			return eris.Wrap(err, "invalid sound upload configuration")
+		}
+	}
+	s.soundUploads = newSoundUploads(s.SoundUpload, s.clock())
+
+	if s.Systemd != nil {
+		if s.systemd, err = newSystemdNotifier(); err != nil {
+			return err
+		}
+	}
+	defer s.soundUploads.close()
+
+	s.fanOut = newFanOutPool(s.FanOut, s.publishDialogEvents)
+	s.dialogEventLimiter = newDialogEventLimiter(s.DialogEventLimit, s.clock())
+	s.keepalive = newKeepaliveTracker(s.Keepalive, s.Application)
+
+	// Start tracking the talk state of bridges
+	if s.DeadAir != nil {
+		s.deadAir = newDeadAirMonitor(s.DeadAir.withDefaults().SilenceThreshold)
+	}
+
+	// Record the NATS permissions violations, checking the permissions up
+	// front if requested
+	s.watchPermissions(s.nats.Conn)
+
+	// Track the state of the NATS connection
+	s.watchConnection(ctx, s.nats.Conn)
+	s.checkMaxPayload()
+	if s.VerifyPermissions {
+		if err := s.verifyPermissions(permissionCheckTimeout); err != nil {
+			return err
+		}
+	}
+
 	//
 	// Listen on the initial NATS subjects
 	//
 
 	// ping handler
-	pingSub, err := s.nats.Subscribe(proxy.PingSubject(s.NATSPrefix), s.pingHandler)
+	pingSub, err := s.nats.Subscribe(s.Subjects.Ping(), s.pingHandler)
 	if err != nil {
 		return eris.Wrap(err, "failed to subscribe to pings")
 	}
-	defer wg.Add(pingSub.Unsubscribe)
+	cg.Add("ping subscription", pingSub.Unsubscribe)
 
 	// get a contextualized request handler
-	requestHandler := s.newRequestHandler(ctx)
+	requestHandler := s.newRequestHandler(reqCtx)
 
 	// get handlers
-	allGet, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "get", "", ""), requestHandler)
+	allGet, err := s.nats.Conn.Subscribe(s.Subjects.Request("get", "", ""), requestHandler)
 	if err != nil {
 		return eris.Wrap(err, "failed to create get-all subscription")
 	}
-	defer wg.Add(allGet.Unsubscribe)()
+	cg.Add("get-all subscription", allGet.Unsubscribe)
 
-	appGet, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "get", s.Application, ""), requestHandler)
+	appGet, err := s.nats.Conn.Subscribe(s.Subjects.Request("get", s.Application, ""), requestHandler)
 	if err != nil {
 		return eris.Wrap(err, "failed to create get-app subscription")
 	}
-	defer wg.Add(appGet.Unsubscribe)()
-	idGet, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "get", s.Application, s.AsteriskID), requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create get-id subscription")
-	}
-	defer wg.Add(idGet.Unsubscribe)()
+	cg.Add("get-app subscription", appGet.Unsubscribe)
 
 	// data handlers
-	allData, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "data", "", ""), requestHandler)
+	allData, err := s.nats.Conn.Subscribe(s.Subjects.Request("data", "", ""), requestHandler)
 	if err != nil {
 		return eris.Wrap(err, "failed to create data-all subscription")
 	}
-	defer wg.Add(allData.Unsubscribe)()
-	appData, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "data", s.Application, ""), requestHandler)
+	cg.Add("data-all subscription", allData.Unsubscribe)
+	appData, err := s.nats.Conn.Subscribe(s.Subjects.Request("data", s.Application, ""), requestHandler)
 	if err != nil {
 		return eris.Wrap(err, "failed to create data-app subscription")
 	}
-	defer wg.Add(appData.Unsubscribe)()
-	idData, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "data", s.Application, s.AsteriskID), requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create data-id subscription")
-	}
-	defer wg.Add(idData.Unsubscribe)()
+	cg.Add("data-app subscription", appData.Unsubscribe)
 
-	// command handlers
-	allCommand, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "command", "", ""), requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create command-all subscription")
+	// command handlers (unless they are consumed from JetStream)
+	if !s.streamsClass("command") {
+		allCommand, err := s.nats.Conn.Subscribe(s.Subjects.Request("command", "", ""), requestHandler)
+		if err != nil {
+			return eris.Wrap(err, "failed to create command-all subscription")
+		}
+		cg.Add("command-all subscription", allCommand.Unsubscribe)
+		appCommand, err := s.nats.Conn.Subscribe(s.Subjects.Request("command", s.Application, ""), requestHandler)
+		if err != nil {
+			return eris.Wrap(err, "failed to create command-app subscription")
+		}
+		cg.Add("command-app subscription", appCommand.Unsubscribe)
 	}
-	defer wg.Add(allCommand.Unsubscribe)()
-	appCommand, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "command", s.Application, ""), requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create command-app subscription")
+
+	// create handlers (unless they are consumed from JetStream)
+	if !s.streamsClass("create") {
+		allCreate, err := s.nats.Conn.QueueSubscribe(s.Subjects.Request("create", "", ""), "ariproxy", requestHandler)
+		if err != nil {
+			return eris.Wrap(err, "failed to create create-all subscription")
+		}
+		cg.Add("create-all subscription", allCreate.Unsubscribe)
+		appCreate, err := s.nats.Conn.QueueSubscribe(s.Subjects.Request("create", s.Application, ""), "ariproxy", requestHandler)
+		if err != nil {
+			return eris.Wrap(err, "failed to create create-app subscription")
+		}
+		cg.Add("create-app subscription", appCreate.Unsubscribe)
 	}
-	defer wg.Add(appCommand.Unsubscribe)()
-	idCommand, err := s.nats.Subscribe(proxy.Subject(s.NATSPrefix, "command", s.Application, s.AsteriskID), requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create command-id subscription")
+
+	// node handlers
+	s.requestHandler = requestHandler
+	if err := s.subscribeNode(); err != nil {
+		return err
 	}
-	defer wg.Add(idCommand.Unsubscribe)()
+	cg.Add("node subscriptions", s.closeNode)
 
-	// create handlers
-	allCreate, err := s.nats.QueueSubscribe(proxy.Subject(s.NATSPrefix, "create", "", ""), "ariproxy", requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create create-all subscription")
+	// JetStream consumers
+	if err := s.startJetStream(reqCtx, &cg); err != nil {
+		return err
 	}
-	defer wg.Add(allCreate.Unsubscribe)()
-	appCreate, err := s.nats.QueueSubscribe(proxy.Subject(s.NATSPrefix, "create", s.Application, ""), "ariproxy", requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create create-app subscription")
+
+	// JetStream event storage
+	if err := s.startEventStream(&cg); err != nil {
+		return err
 	}
-	defer wg.Add(appCreate.Unsubscribe)()
-	idCreate, err := s.nats.QueueSubscribe(proxy.Subject(s.NATSPrefix, "create", s.Application, s.AsteriskID), "ariproxy", requestHandler)
-	if err != nil {
-		return eris.Wrap(err, "failed to create create-id subscription")
+
+	// Detect other instances serving the same application and node
+	if err := s.watchConflicts(&cg); err != nil {
+		return err
 	}
-	defer wg.Add(idCreate.Unsubscribe)()
 
 	// Run the periodic announcer
 	go s.runAnnouncer(ctx)
 
+	// Run the heartbeat
+	go s.runHeartbeat(ctx)
+
+	// Run the dialog fan-out workers
+	if s.fanOut != nil {
+		s.fanOut.run(ctx)
+	}
+
+	// Run the summaries of the events dropped by the dialog event limit
+	if s.dialogEventLimiter != nil {
+		go s.runDialogEventSummaries(ctx)
+	}
+
 	// Run the event handler
 	go s.runEventHandler(ctx)
 
+	// Run the dead-air monitor
+	if s.deadAir != nil {
+		go s.runDeadAirMonitor(ctx)
+	}
+
 	// Run the entity check handler
 	go s.runEntityChecker(ctx)
 
+	// Run the ARI reconnector
+	if s.reconnector != nil {
+		go s.runARIReconnector(ctx)
+	}
+
+	// Run the ARI WebSocket keepalive
+	if err := s.startKeepalive(ctx, &cg); err != nil {
+		return err
+	}
+
+	// Run the health endpoint
+	if s.HealthEndpoint != nil {
+		if !withHealth {
+			return errExcluded(SubsystemHealth)
+		}
+		if err := s.startHealth(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Run the metrics endpoint
+	if s.Metrics != nil {
+		if !withMetrics {
+			return errExcluded(SubsystemMetrics)
+		}
+		if err := s.startMetrics(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Run the click-to-call endpoint
+	if s.ClickToCall != nil {
+		if !withClickToCall {
+			return errExcluded(SubsystemClickToCall)
+		}
+		if err := s.startClickToCall(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Run the audio fork WebSocket endpoint
+	if s.AudioFork != nil {
+		if !withAudioFork {
+			return errExcluded(SubsystemAudioFork)
+		}
+		if s.AudioFork.WebSocketListen != "" {
+			if err := s.startAudioForkWebSocket(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
 	// TODO: run the dialog cleanup routine (remove bindings for entities which no longer exist)
 	// go s.runDialogCleaner(ctx)
 
@@ -247,30 +905,84 @@ func (s *Server) listen(ctx context.Context) error {
 		close(s.readyCh)
 	}
 
-	// Wait for context closure to exit
+	// Notify systemd that we are operational
+	if s.systemd != nil {
+		go s.runSystemd(ctx)
+	}
+
+	// Wait for context closure to exit, draining the requests
 	<-ctx.Done()
+	s.drain(cancelRequests)
+	if err := s.stopErr(); err != nil {
+		return err
+	}
 	return ctx.Err()
 }
 
+// Stop stops the server, causing Listen (or ListenOn) to return
+// context.Canceled once its subcomponents are cleaned up.  It is a no-op if
+// the server is not listening.
+func (s *Server) Stop() {
+	s.stop(nil)
+}
+
+// stop stops the server, causing Listen to return the given error, if any
+func (s *Server) stop(err error) {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// stopErr returns the error with which the server was stopped, if any
+func (s *Server) stopErr() error {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	return s.err
+}
+
+// start records the cancel function of the context of a listening server
+func (s *Server) start(cancel context.CancelFunc) {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	s.cancel = cancel
+	s.err = nil
+}
+
 // runEntityChecker runs the periodic check againt Asterisk entity id
 func (s *Server) runEntityChecker(ctx context.Context) {
-	ticker := time.NewTicker(proxy.EntityCheckInterval)
+	ticker := s.clock().NewTicker(proxy.EntityCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			info, err := s.ari.Asterisk().Info(nil)
 			if err != nil {
 				s.Log.Error("failed to get info from Asterisk", "error", err)
 				continue
 			}
-			if s.AsteriskID != info.SystemInfo.EntityID {
-				s.Log.Warn("system entitiy id changed", "old", s.AsteriskID, "new", info.SystemInfo.EntityID)
-				// We need to exit with non-zero to make sure systemd restarts when service defined with Restart=on-failure
-				os.Exit(1)
+			s.ariContact.touch(s.clock().Now())
+			s.inventory.setVersion(info.SystemInfo.Version)
+			if id := s.nodeID(); id != info.SystemInfo.EntityID {
+				s.Log.Warn("system entitiy id changed", "old", id, "new", info.SystemInfo.EntityID)
+				// Reconnect, if enabled, or else stop with an error, so
+				// that the process embedding the server may restart it
+				// (e.g. systemd with Restart=on-failure, once the binary
+				// exits non-zero)
+				s.ariLost(ErrEntityIDChanged)
+				if s.reconnector == nil {
+					return
+				}
 			}
 		}
 	}
@@ -278,14 +990,14 @@ func (s *Server) runEntityChecker(ctx context.Context) {
 
 // runAnnouncer runs the periodic discovery announcer
 func (s *Server) runAnnouncer(ctx context.Context) {
-	ticker := time.NewTicker(proxy.AnnouncementInterval)
+	ticker := s.clock().NewTicker(proxy.AnnouncementInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			s.announce()
 		}
 	}
@@ -293,10 +1005,7 @@ func (s *Server) runAnnouncer(ctx context.Context) {
 
 // announce publishes the presence of this server to the cluster
 func (s *Server) announce() {
-	s.publish(proxy.AnnouncementSubject(s.NATSPrefix), &proxy.Announcement{
-		Node:        s.AsteriskID,
-		Application: s.Application,
-	})
+	s.publish(s.Subjects.Announcement(), s.newAnnouncement())
 }
 
 // runEventHandler processes events which are received from ARI
@@ -304,49 +1013,386 @@ func (s *Server) runEventHandler(ctx context.Context) {
 	sub := s.ari.Bus().Subscribe(nil, ari.Events.All)
 	defer sub.Cancel()
 
+	pending := newPendingStarts()
+
 	for {
 		s.Log.Debug("listening for events", "application", s.Application)
 		select {
 		case <-ctx.Done():
 			return
+		case r := <-pending.done:
+			s.releaseStart(ctx, pending, r)
 		case e := <-sub.Events():
 			s.Log.Debug("event received", "kind", e.GetType())
+			s.ariContact.touch(s.clock().Now())
+
+			// Withhold the pongs of the keepalive
+			if s.processKeepaliveEvent(e) {
+				continue
+			}
 
-			// Publish event to canonical destination
-			s.publish(fmt.Sprintf("%sevent.%s.%s", s.NATSPrefix, s.Application, s.AsteriskID), e)
+			// Release any resources tracked by the quota engine
+			s.quota.ProcessEvent(e)
+			s.processPolicyEvent(e)
+			s.processOriginatedEvent(e)
 
-			// Publish event to any associated dialogs
-			for _, d := range s.dialogsForEvent(e) {
-				de := e
-				de.SetDialog(d)
-				s.publish(fmt.Sprintf("%sdialogevent.%s", s.NATSPrefix, d), de)
+			// Keep track of the recordings which secure input may pause
+			s.recordings.ProcessEvent(e)
+
+			// Report the completion of fax operations
+			s.processFaxEvent(e)
+
+			// Report the end of holds of destroyed channels
+			s.processHoldEvent(e)
+
+			// Report the results of dials
+			s.processDialEvent(e)
+
+			// Track the talk state of bridges for dead-air monitoring
+			s.processDeadAirEvent(e)
+
+			// Notify the watchers of changed channels and bridges
+			s.processWatchEvent(e)
+
+			// Withhold the digits captured by secure input
+			if s.processSecureInput(e) {
+				continue
+			}
+
+			// Collect the digits requested by CollectDigits
+			s.processDigitCollection(e)
+
+			// Annotate calls before the application sees them
+			if v, ok := e.(*ari.StasisStart); ok {
+				// The legs of click-to-call calls are handled by the
+				// proxy itself
+				if isClickToCallStart(v) {
+					continue
+				}
+
+				s.attachGeography(v)
+
+				// Look up and screen inbound calls off the event loop,
+				// holding the events of their channels until they are
+				// released
+				if s.preparesStarts() && s.isInbound(v) {
+					pending.start(v)
+					go s.prepareStart(ctx, v, pending.done)
+					continue
+				}
 			}
+
+			if pending.hold(e) {
+				continue
+			}
+
+			s.deliverEvent(ctx, e)
 		}
 	}
 }
 
+// deliverEvent publishes an event which the event handler has processed,
+// followed by the reports which derive from it, unless a call flow takes
+// over the call
+func (s *Server) deliverEvent(ctx context.Context, e ari.Event) {
+	// Run the matching call flow in place of a client application
+	if v, ok := e.(*ari.StasisStart); ok && s.startCallFlow(ctx, v) {
+		return
+	}
+
+	// Withhold the changes of uninteresting variables
+	if s.filterVarset(e) {
+		return
+	}
+
+	s.publishEvent(e)
+
+	// Report the channel variables of calls entering the application
+	if v, ok := e.(*ari.StasisStart); ok {
+		s.reportChannelVariables(v)
+	}
+
+	// Report bridge party changes after their bridge events
+	s.processBridgePartyEvent(e)
+
+	// Report the progress of playlists after their playback events
+	s.processPlaylistEvent(e)
+
+	// Report recording limits and link finished recordings to their stored
+	// recordings
+	s.processRecordingEvent(e)
+}
+
+// publishEvent publishes an event to its canonical destination and to any
+// associated dialogs
+func (s *Server) publishEvent(e ari.Event) {
+	s.metrics.eventPublished(e.GetType())
+	h := s.newEventHeader(e)
+
+	// Publish event to canonical destination, unless it is routed
+	// exclusively to other subjects
+	if !s.publishEventRoutes(e, h) {
+		s.publishEventTo(s.nodeEventSubject(e.GetType()), e, h)
+	}
+
+	// Publish event to any associated dialogs
+	if s.fanOut != nil {
+		s.fanOut.submit(e, h)
+		return
+	}
+	s.publishDialogEvents(e, h)
+}
+
+// publishDialogEvents publishes an event to the dialogs with which it is
+// associated
+func (s *Server) publishDialogEvents(e ari.Event, h ari.Header) {
+	for _, d := range s.dialogsForEvent(e) {
+		if !s.dialogEventLimiter.allow(d, e.GetType()) {
+			s.metrics.dialogEventDropped(e.GetType())
+			continue
+		}
+
+		de, dh, ok := dialogEvent(e, h, d)
+		if !ok {
+			s.Log.Warn("cannot copy event for dialogs", "event", e.GetType())
+			return
+		}
+		s.publishEventTo(s.Subjects.DialogEvent(d), de, dh)
+	}
+}
+
+// newEventHeader returns the header of the given event, numbering it in the
+// sequence of published events
+func (s *Server) newEventHeader(e ari.Event) ari.Header {
+	h := ari.Header{}
+	h.Set(proxy.HeaderApplication, s.Application)
+	h.Set(proxy.HeaderAsterisk, s.nodeID())
+	h.Set(proxy.HeaderInstance, s.InstanceID)
+	if s.Version != "" {
+		h.Set(proxy.HeaderVersion, s.Version)
+	}
+	if v, ok := e.(*proxy.RoutingDecision); ok && v.Tenant != "" {
+		h.Set(proxy.HeaderTenant, v.Tenant)
+	}
+	proxy.EventHeader(h).SetSequence(atomic.AddUint64(&s.eventSeq, 1))
+	return h
+}
+
+// publishEventTo publishes an event with the given header, logging any error
+func (s *Server) publishEventTo(subject string, e ari.Event, h ari.Header) {
+	ack := s.eventAckSubject()
+	err := proxy.EncodeEventWith(s.codec, e, h, func(data []byte) (err error) {
+		if data, err = s.fitEvent(e.GetType(), data, s.natsMaxPayload()); err != nil {
+			return err
+		}
+		if ack != "" {
+			return s.nats.Conn.PublishRequest(subject, ack, data)
+		}
+		return s.nats.Conn.Publish(subject, data)
+	})
+	if err != nil {
+		s.metrics.publishFailed()
+		s.Log.Warn("failed to publish event", "subject", subject, "event", e.GetType(), "error", err)
+	}
+}
+
+// newEventData returns the event metadata for a proxy-generated event of the given type
+func (s *Server) newEventData(typ string) ari.EventData {
+	return ari.EventData{
+		Application: s.Application,
+		Node:        s.nodeID(),
+		Timestamp:   ari.DateTime(s.clock().Now()),
+		Type:        typ,
+	}
+}
+
+// ShutdownStats returns the statistics of the cleanups performed when the
+// server stopped
+func (s *Server) ShutdownStats() ShutdownStats {
+	return s.shutdowns.get()
+}
+
+// shutdown cleans up the subcomponents of the server once it stops
+// listening, waiting for at most the shutdown grace period
+func (s *Server) shutdown(cg *closeGroup) {
+	grace := s.ShutdownGracePeriod
+	if grace <= 0 {
+		grace = DefaultShutdownGracePeriod
+	}
+
+	started := time.Now()
+	failed, completed := cg.Close(grace, s.Log)
+	s.shutdowns.record(failed, completed, time.Since(started))
+
+	s.Log.Debug("listener stopped", "cleanup_errors", failed, "completed", completed)
+}
+
+// QuotaStats returns the current quota usage and rejection counts, indexed by
+// quota scope
+func (s *Server) QuotaStats() map[string]QuotaStats {
+	return s.quota.Stats()
+}
+
 // pingHandler publishes the server's presence
 func (s *Server) pingHandler(m *nats.Msg) {
-	if s.ari.Connected() {
+	// A leaving server has announced its departure, and clients ping the
+	// cluster on receiving it
+	if s.ariConnected() && !s.leaving() {
 		s.announce()
 	}
 }
 
-// publish sends a message out over NATS, logging any error
+// publish sends a message out over NATS, logging any error.  Requests made
+// without a reply subject (e.g. streamed requests without a ReplyTo) are not
+// answered.
 func (s *Server) publish(subject string, msg interface{}) {
-	if err := s.nats.Publish(subject, msg); err != nil {
+	if subject == "" {
+		return
+	}
+	if resp, ok := msg.(*proxy.Response); ok {
+		resp.Instance = s.InstanceID
+		if data, ok := s.compressResponse(subject, resp); ok {
+			if err := s.publishResponse(subject, data); err != nil {
+				s.metrics.publishFailed()
+				s.Log.Warn("failed to publish NATS message", "subject", subject, "error", err)
+			}
+			return
+		}
+	}
+
+	err := proxy.EncodeWith(s.codec, msg, func(data []byte) error {
+		if _, ok := msg.(*proxy.Response); ok {
+			return s.publishResponse(subject, data)
+		}
+		return s.nats.Conn.Publish(subject, data)
+	})
+	if err != nil {
+		s.metrics.publishFailed()
 		s.Log.Warn("failed to publish NATS message", "subject", subject, "data", msg, "error", err)
 	}
 }
 
+// publishList publishes a list of keys in response to a list request,
+// applying the request's pagination
+func (s *Server) publishList(reply string, req *proxy.Request, list []*ari.Key) {
+	page, next, err := proxy.Paginate(list, req.Pagination)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publish(reply, &proxy.Response{
+		Keys:       page,
+		NextCursor: next,
+	})
+}
+
+// nodeID returns the Asterisk ID of the node of the server
+func (s *Server) nodeID() string {
+	s.nodeMu.RLock()
+	defer s.nodeMu.RUnlock()
+	return s.AsteriskID
+}
+
+// setNodeID sets the Asterisk ID of the node of the server
+func (s *Server) setNodeID(id string) {
+	s.nodeMu.Lock()
+	s.AsteriskID = id
+	s.nodeMu.Unlock()
+}
+
+// subscribeNode subscribes the request handler to the requests addressed to
+// the node of the server
+func (s *Server) subscribeNode() error {
+	s.nodeMu.Lock()
+	defer s.nodeMu.Unlock()
+	s.nodeClosed = false
+	return s.subscribeNodeLocked()
+}
+
+// closeNode cancels the subscriptions to the requests addressed to the node
+// of the server on shutdown, after which the node is no longer moved
+func (s *Server) closeNode() error {
+	s.nodeMu.Lock()
+	defer s.nodeMu.Unlock()
+	s.nodeClosed = true
+	return s.unsubscribeNodeLocked()
+}
+
+// unsubscribeNode cancels the subscriptions to the requests addressed to the
+// node of the server
+func (s *Server) unsubscribeNode() error {
+	s.nodeMu.Lock()
+	defer s.nodeMu.Unlock()
+	return s.unsubscribeNodeLocked()
+}
+
+// subscribeNodeLocked is subscribeNode, with nodeMu held
+func (s *Server) subscribeNodeLocked() error {
+	for _, class := range []string{"get", "data", "command", "create"} {
+		if (class == "command" || class == "create") && s.streamsClass(class) {
+			continue
+		}
+
+		var sub *nats.Subscription
+		var err error
+		subject := s.Subjects.Request(class, s.Application, s.AsteriskID)
+		if class == "create" {
+			sub, err = s.nats.Conn.QueueSubscribe(subject, "ariproxy", s.requestHandler)
+		} else {
+			sub, err = s.nats.Conn.Subscribe(subject, s.requestHandler)
+		}
+		if err != nil {
+			s.unsubscribeNodeLocked() // nolint: errcheck
+			return eris.Wrapf(err, "failed to create %s-id subscription", class)
+		}
+		s.nodeSubs = append(s.nodeSubs, sub)
+	}
+	return nil
+}
+
+// unsubscribeNodeLocked is unsubscribeNode, with nodeMu held
+func (s *Server) unsubscribeNodeLocked() error {
+	var firstErr error
+	for _, sub := range s.nodeSubs {
+		if err := sub.Unsubscribe(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.nodeSubs = nil
+	return firstErr
+}
+
 // newRequestHandler returns a context-wrapped nats.Handler to handle requests
-func (s *Server) newRequestHandler(ctx context.Context) func(subject string, reply string, req *proxy.Request) {
-	return func(subject string, reply string, req *proxy.Request) {
-		if !s.ari.Connected() {
+func (s *Server) newRequestHandler(ctx context.Context) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		subject, reply := m.Subject, m.Reply
+		req, err := proxy.DecodeRequest(m.Data)
+		if err != nil {
+			s.Log.Warn("failed to decode request", "subject", subject, "error", err)
+			s.sendError(reply, err)
+			return
+		}
+		if !s.ariConnected() {
 			s.sendError(reply, eris.New("ARI connection is down"))
 			return
 		}
-		go s.dispatchRequest(ctx, reply, req)
+		if s.rejectDraining(subject, req) {
+			s.sendError(reply, proxy.ErrDraining)
+			return
+		}
+		if !s.supportedByAsterisk(req.Kind) {
+			s.sendError(reply, proxy.ErrNotSupportedByAsterisk)
+			return
+		}
+		if !s.requests.begin() {
+			s.sendError(reply, proxy.ErrLeaving)
+			return
+		}
+		go func() {
+			defer s.requests.end()
+			s.dispatchRequest(ctx, reply, req)
+		}()
 	}
 }
 
@@ -356,6 +1402,23 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 	var f func(context.Context, string, *proxy.Request)
 
 	s.Log.Debug("received request", "kind", req.Kind)
+
+	deadline, cancel := requestDeadline(ctx, req)
+	defer cancel()
+	if deadline.Err() == context.DeadlineExceeded {
+		s.metrics.requestExpired(req.Kind)
+		s.Log.Debug("discarding request past its deadline", "kind", req.Kind, "deadline", *req.Deadline)
+		s.sendError(reply, proxy.ErrDeadlineExceeded)
+		return
+	}
+
+	// Forget the negotiated encodings of requests which send no response
+	s.negotiateCompression(reply, req)
+	defer s.compressed.m.Delete(reply)
+	if s.negotiateLargeReply(reply, req) {
+		defer s.largeReplies.Delete(reply)
+	}
+
 	switch req.Kind {
 	case "ApplicationData":
 		f = s.applicationData
@@ -403,8 +1466,14 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.asteriskVariableGet
 	case "AsteriskVariableSet":
 		f = s.asteriskVariableSet
+	case "AudioForkStart":
+		f = s.audioForkStart
+	case "AudioForkStop":
+		f = s.audioForkStop
 	case "BridgeAddChannel":
 		f = s.bridgeAddChannel
+	case "BridgeAssemble":
+		f = s.bridgeAssemble
 	case "BridgeCreate":
 		f = s.bridgeCreate
 	case "BridgeStageCreate":
@@ -413,6 +1482,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.bridgeData
 	case "BridgeDelete":
 		f = s.bridgeDelete
+	case "BridgeEnsure":
+		f = s.bridgeEnsure
 	case "BridgeGet":
 		f = s.bridgeGet
 	case "BridgeList":
@@ -439,6 +1510,24 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.bridgeVideoSource
 	case "BridgeVideoSourceDelete":
 		f = s.bridgeVideoSourceDelete
+	case "CallGraph":
+		f = s.callGraph
+	case "CallHold":
+		f = s.callHold
+	case "CallResume":
+		f = s.callResume
+	case "CampaignPause":
+		f = s.campaignPause
+	case "CampaignResume":
+		f = s.campaignResume
+	case "CampaignStart":
+		f = s.campaignStart
+	case "CampaignStats":
+		f = s.campaignStats
+	case "CampaignStop":
+		f = s.campaignStop
+	case "ChannelAMD":
+		f = s.channelAMD
 	case "ChannelAnswer":
 		f = s.channelAnswer
 	case "ChannelBusy":
@@ -461,8 +1550,12 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.channelHold
 	case "ChannelList":
 		f = s.channelList
+	case "ChannelLocalPair":
+		f = s.channelLocalPair
 	case "ChannelMOH":
 		f = s.channelMOH
+	case "ChannelMove":
+		f = s.channelMove
 	case "ChannelMute":
 		f = s.channelMute
 	case "ChannelOriginate":
@@ -473,8 +1566,12 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.channelPlay
 	case "ChannelStagePlay":
 		f = s.channelStagePlay
+	case "ChannelRTPStatistics":
+		f = s.channelRTPStatistics
 	case "ChannelRecord":
 		f = s.channelRecord
+	case "ChannelRecordConsent":
+		f = s.channelRecordConsent
 	case "ChannelStageRecord":
 		f = s.channelStageRecord
 	case "ChannelRing":
@@ -507,6 +1604,16 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.channelVariableGet
 	case "ChannelVariableSet":
 		f = s.channelVariableSet
+	case "ClusterInfo":
+		f = s.clusterInfo
+	case "CollectDigits":
+		f = s.collectDigits
+	case "DebugCaptureData":
+		f = s.debugCaptureData
+	case "DebugCaptureStart":
+		f = s.debugCaptureStart
+	case "DebugCaptureStop":
+		f = s.debugCaptureStop
 	case "DeviceStateData":
 		f = s.deviceStateData
 	case "DeviceStateDelete":
@@ -517,6 +1624,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.deviceStateList
 	case "DeviceStateUpdate":
 		f = s.deviceStateUpdate
+	case "DialCancel":
+		f = s.dialCancel
 	case "EndpointData":
 		f = s.endpointData
 	case "EndpointGet":
@@ -525,6 +1634,14 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.endpointList
 	case "EndpointListByTech":
 		f = s.endpointListByTech
+	case "FaxReceive":
+		f = s.faxReceive
+	case "FaxSend":
+		f = s.faxSend
+	case "LogStreamStart":
+		f = s.logStreamStart
+	case "LogStreamStop":
+		f = s.logStreamStop
 	case "MailboxData":
 		f = s.mailboxData
 	case "MailboxDelete":
@@ -535,6 +1652,12 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.mailboxList
 	case "MailboxUpdate":
 		f = s.mailboxUpdate
+	case "MaintenanceCancel":
+		f = s.maintenanceCancel
+	case "MaintenanceSchedule":
+		f = s.maintenanceSchedule
+	case "Page":
+		f = s.page
 	case "PlaybackControl":
 		f = s.playbackControl
 	case "PlaybackData":
@@ -551,6 +1674,8 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.recordingStoredData
 	case "RecordingStoredDelete":
 		f = s.recordingStoredDelete
+	case "RecordingStoredFile":
+		f = s.recordingStoredFile
 	case "RecordingStoredGet":
 		f = s.recordingStoredGet
 	case "RecordingStoredList":
@@ -573,20 +1698,60 @@ func (s *Server) dispatchRequest(ctx context.Context, reply string, req *proxy.R
 		f = s.recordingLiveStop
 	case "RecordingLiveUnmute":
 		f = s.recordingLiveUnmute
+	case "SecureInputStart":
+		f = s.secureInputStart
+	case "SecureInputStop":
+		f = s.secureInputStop
 	case "SoundData":
 		f = s.soundData
 	case "SoundList":
 		f = s.soundList
+	case "SoundUploadAbort":
+		f = s.soundUploadAbort
+	case "SoundUploadChunk":
+		f = s.soundUploadChunk
+	case "SoundUploadStart":
+		f = s.soundUploadStart
+	case "VoicemailDeposit":
+		f = s.voicemailDeposit
+	case "VoicemailList":
+		f = s.voicemailList
+	case "VoicemailRetrieve":
+		f = s.voicemailRetrieve
+	case "Watch":
+		f = s.watchCreate
+	case "WatchCancel":
+		f = s.watchCancel
+	case "WatchRenew":
+		f = s.watchRenew
 	default:
 		f = func(ctx context.Context, reply string, req *proxy.Request) {
 			s.sendError(reply, eris.New("Not implemented"))
 		}
 	}
 
-	f(ctx, reply, req)
+	if reply != "" {
+		s.requestKinds.Store(reply, req.Kind)
+		defer s.requestKinds.Delete(reply)
+	}
+
+	endCapture := s.debugCapture.begin(req)
+	start := time.Now()
+	s.runRequest(ctx, deadline, f, reply, req)
+	s.metrics.observeRequest(req.Kind, time.Since(start))
+	endCapture()
 }
 
 func (s *Server) sendError(reply string, err error) {
+	if s.retryFailure(reply, err) {
+		return
+	}
+	if kind, ok := s.requestKinds.Load(reply); ok {
+		err = classifyError(kind.(string), err)
+		if err != nil {
+			s.metrics.requestFailed(kind.(string))
+		}
+	}
 	s.publish(reply, proxy.NewErrorResponse(err))
 }
 
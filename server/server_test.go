@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestStop(t *testing.T) {
+	s := New()
+
+	// Stopping a server which is not listening is a no-op
+	s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.start(cancel)
+
+	s.stop(ErrEntityIDChanged)
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("context not cancelled")
+	}
+	if err := s.stopErr(); err != ErrEntityIDChanged {
+		t.Errorf("stop error %v != %v", err, ErrEntityIDChanged)
+	}
+
+	// The first error is kept
+	s.Stop()
+	if err := s.stopErr(); err != ErrEntityIDChanged {
+		t.Errorf("stop error %v != %v", err, ErrEntityIDChanged)
+	}
+
+	// Listening again clears the error
+	s.start(cancel)
+	if err := s.stopErr(); err != nil {
+		t.Errorf("unexpected stop error %v", err)
+	}
+}
+
+func TestEventHeaderInstance(t *testing.T) {
+	s := New(WithInstanceID("pbx1-blue"))
+	h := proxy.EventHeader(s.newEventHeader(&ari.ChannelDestroyed{}))
+	if h.Instance() != "pbx1-blue" {
+		t.Errorf("unexpected instance %q", h.Instance())
+	}
+	if got := s.Health().Instance; got != "pbx1-blue" {
+		t.Errorf("unexpected health instance %q", got)
+	}
+}
@@ -33,7 +33,5 @@ func (s *Server) soundList(ctx context.Context, reply string, req *proxy.Request
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
 }
@@ -0,0 +1,459 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// DefaultSoundUploadMaxSize is the default maximum size of an uploaded
+	// sound file
+	DefaultSoundUploadMaxSize = 16 << 20
+
+	// DefaultSoundUploadIdleTimeout is the default time after which an
+	// upload which receives no chunk is discarded
+	DefaultSoundUploadIdleTimeout = time.Minute
+
+	// DefaultSoundUploadMaxUploads is the default maximum number of uploads
+	// in progress
+	DefaultSoundUploadMaxUploads = 4
+
+	// DefaultSoundUploadMaxTotalSize is the default maximum size of the
+	// files of the uploads in progress, together
+	DefaultSoundUploadMaxTotalSize = 64 << 20
+)
+
+var (
+	soundNameRegex     = regexp.MustCompile(`^[A-Za-z0-9_-]+(/[A-Za-z0-9_-]+)*$`)
+	soundFormatRegex   = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	soundLanguageRegex = regexp.MustCompile(`^[A-Za-z]+(_[A-Za-z]+)?$`)
+)
+
+// errSoundUploadDisabled indicates that the server does not accept sound
+// uploads
+var errSoundUploadDisabled = eris.New("sound upload is not enabled")
+
+// SoundUploadConfig describes the upload of sound files through the proxy
+// (see SoundUploadStart).  Asterisk has no ARI operation for storing sounds,
+// so the proxy writes them into the sounds directory of its node itself,
+// which it must therefore share with Asterisk.
+type SoundUploadConfig struct {
+	// Dir is the sounds directory of Asterisk (e.g.
+	// "/var/lib/asterisk/sounds"), into which sounds are written as
+	// `[<language>/]<name>.<format>`
+	Dir string `mapstructure:"dir"`
+
+	// MaxSize is the maximum size of a sound file.  It defaults to
+	// DefaultSoundUploadMaxSize.
+	MaxSize int64 `mapstructure:"max_size"`
+
+	// IdleTimeout is the time after which an upload which receives no chunk
+	// is discarded.  It defaults to DefaultSoundUploadIdleTimeout.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+
+	// MaxUploads is the maximum number of uploads in progress, beyond which
+	// new uploads are rejected.  It defaults to DefaultSoundUploadMaxUploads.
+	MaxUploads int `mapstructure:"max_uploads"`
+
+	// MaxTotalSize is the maximum size of the files of the uploads in
+	// progress, together, beyond which their chunks are rejected.  It
+	// defaults to DefaultSoundUploadMaxTotalSize.
+	MaxTotalSize int64 `mapstructure:"max_total_size"`
+}
+
+func (c *SoundUploadConfig) validate() error {
+	if c.Dir == "" || !filepath.IsAbs(c.Dir) {
+		return eris.New("sound upload directory must be an absolute path")
+	}
+	if c.MaxSize < 0 || c.IdleTimeout < 0 || c.MaxUploads < 0 || c.MaxTotalSize < 0 {
+		return eris.New("sound upload limits and idle timeout may not be negative")
+	}
+	if cfg := c.withDefaults(); cfg.MaxTotalSize < cfg.MaxSize {
+		return eris.New("sound upload maximum total size is below the maximum size of a sound")
+	}
+	return nil
+}
+
+func (c *SoundUploadConfig) withDefaults() SoundUploadConfig {
+	ret := *c
+	if ret.MaxSize == 0 {
+		ret.MaxSize = DefaultSoundUploadMaxSize
+	}
+	if ret.IdleTimeout == 0 {
+		ret.IdleTimeout = DefaultSoundUploadIdleTimeout
+	}
+	if ret.MaxUploads == 0 {
+		ret.MaxUploads = DefaultSoundUploadMaxUploads
+	}
+	if ret.MaxTotalSize == 0 {
+		ret.MaxTotalSize = DefaultSoundUploadMaxTotalSize
+	}
+	return ret
+}
+
+// soundUpload is an upload in progress, which is written to a temporary file
+// in the directory of the sound until it completes
+type soundUpload struct {
+	// path is the path of the sound file
+	path      string
+	overwrite bool
+
+	file *os.File
+	seq  uint64
+	size int64
+
+	// last is the time at which the upload last received a chunk.  It is
+	// guarded by the mutex of the tracker.
+	last time.Time
+
+	// reserved is the size of the upload counted in the total of the
+	// tracker.  It is guarded by the mutex of the tracker.
+	reserved int64
+
+	// mu serializes the chunks of the upload.  It is acquired before the
+	// mutex of the tracker.
+	mu sync.Mutex
+}
+
+// discard closes and removes the temporary file of the upload
+func (u *soundUpload) discard() {
+	u.file.Close()           // nolint: errcheck
+	os.Remove(u.file.Name()) // nolint: errcheck
+}
+
+// soundUploads tracks the uploads in progress
+type soundUploads struct {
+	cfg   SoundUploadConfig
+	clock clock.Clock
+
+	uploads map[string]*soundUpload
+
+	// total is the size of the uploads in progress
+	total int64
+
+	mu sync.Mutex
+}
+
+// newSoundUploads returns the tracker of the uploads described by the given
+// configuration, or nil if sound uploads are not enabled
+func newSoundUploads(cfg *SoundUploadConfig, c clock.Clock) *soundUploads {
+	if cfg == nil {
+		return nil
+	}
+	return &soundUploads{
+		cfg:     cfg.withDefaults(),
+		clock:   c,
+		uploads: make(map[string]*soundUpload),
+	}
+}
+
+// soundPath returns the path of the file of the described sound, relative to
+// the sounds directory
+func soundPath(u *proxy.SoundUpload) (string, error) {
+	if !soundNameRegex.MatchString(u.Name) {
+		return "", eris.Errorf("invalid sound name %q", u.Name)
+	}
+	if !soundFormatRegex.MatchString(u.Format) {
+		return "", eris.Errorf("invalid sound format %q", u.Format)
+	}
+	name := filepath.FromSlash(u.Name) + "." + u.Format
+	if u.Language == "" {
+		return name, nil
+	}
+	if !soundLanguageRegex.MatchString(u.Language) {
+		return "", eris.Errorf("invalid sound language %q", u.Language)
+	}
+	return filepath.Join(u.Language, name), nil
+}
+
+// start begins the upload of the described sound, returning its ID
+func (t *soundUploads) start(req *proxy.SoundUpload) (string, error) {
+	rel, err := soundPath(req)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(t.cfg.Dir, rel)
+	if !req.Overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return "", eris.Errorf("sound file %s already exists", rel)
+		}
+	}
+
+	t.expire()
+	t.mu.Lock()
+	n := len(t.uploads)
+	t.mu.Unlock()
+	if n >= t.cfg.MaxUploads {
+		return "", eris.Errorf("too many sound uploads in progress (maximum %d)", t.cfg.MaxUploads)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", eris.Wrap(err, "failed to create sound directory")
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", eris.Wrap(err, "failed to create sound file")
+	}
+
+	id := rid.New("su")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.uploads) >= t.cfg.MaxUploads {
+		f.Close()           // nolint: errcheck
+		os.Remove(f.Name()) // nolint: errcheck
+		return "", eris.Errorf("too many sound uploads in progress (maximum %d)", t.cfg.MaxUploads)
+	}
+	t.uploads[id] = &soundUpload{
+		path:      path,
+		overwrite: req.Overwrite,
+		file:      f,
+		last:      t.clock.Now(),
+	}
+	return id, nil
+}
+
+// expire discards the uploads which have been idle for longer than the idle
+// timeout
+func (t *soundUploads) expire() {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	var expired []*soundUpload
+	for id, u := range t.uploads {
+		if now.Sub(u.last) > t.cfg.IdleTimeout {
+			t.forget(id, u)
+			expired = append(expired, u)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, u := range expired {
+		u.mu.Lock()
+		u.discard()
+		u.mu.Unlock()
+	}
+}
+
+func (t *soundUploads) get(id string) (*soundUpload, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.uploads[id]
+	if !ok {
+		return nil, eris.Errorf("unknown sound upload %q", id)
+	}
+	return u, nil
+}
+
+// remove forgets the upload, returning whether it was still tracked
+func (t *soundUploads) remove(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.uploads[id]
+	if ok {
+		t.forget(id, u)
+	}
+	return ok
+}
+
+// forget forgets the upload, releasing its size from the total.  The mutex of
+// the tracker must be held.
+func (t *soundUploads) forget(id string, u *soundUpload) {
+	delete(t.uploads, id)
+	t.total -= u.reserved
+	u.reserved = 0
+}
+
+// reserve counts the given size of a chunk of the upload in the total,
+// returning whether it remains within the maximum
+func (t *soundUploads) reserve(id string, u *soundUpload, n int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.uploads[id] != u || t.total+n > t.cfg.MaxTotalSize {
+		return false
+	}
+	t.total += n
+	u.reserved += n
+	return true
+}
+
+// write writes the encoded file chunk to the upload, completing it if the
+// chunk is the last.  The upload is discarded if the chunk is invalid.
+func (t *soundUploads) write(id string, data []byte) (*proxy.SoundUploadData, error) {
+	u, err := t.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	fail := func(err error) (*proxy.SoundUploadData, error) {
+		if t.remove(id) {
+			u.discard()
+		}
+		return nil, err
+	}
+
+	c, err := proxy.DecodeFileChunk(data)
+	if err != nil {
+		return fail(err)
+	}
+	if c.Seq+1 == u.seq && !c.Last {
+		// A chunk retried after its response was lost
+		return &proxy.SoundUploadData{Upload: id, Size: u.size}, nil
+	}
+	if c.Seq != u.seq {
+		return fail(eris.Errorf("expected chunk %d of sound upload, received %d", u.seq, c.Seq))
+	}
+	if u.size+int64(len(c.Data)) > t.cfg.MaxSize {
+		return fail(eris.Errorf("sound file exceeds the maximum size of %d bytes", t.cfg.MaxSize))
+	}
+	if !t.reserve(id, u, int64(len(c.Data))) {
+		return fail(eris.Errorf("sound uploads in progress exceed the maximum total size of %d bytes", t.cfg.MaxTotalSize))
+	}
+	if _, err := u.file.Write(c.Data); err != nil {
+		return fail(eris.Wrap(err, "failed to write sound file"))
+	}
+	u.seq++
+	u.size += int64(len(c.Data))
+	t.mu.Lock()
+	u.last = t.clock.Now()
+	t.mu.Unlock()
+
+	ret := &proxy.SoundUploadData{Upload: id, Size: u.size}
+	if !c.Last {
+		return ret, nil
+	}
+
+	if err := u.file.Sync(); err != nil {
+		return fail(eris.Wrap(err, "failed to write sound file"))
+	}
+	if err := u.file.Close(); err != nil {
+		return fail(eris.Wrap(err, "failed to write sound file"))
+	}
+	if !u.overwrite {
+		if _, err := os.Stat(u.path); err == nil {
+			return fail(eris.New("sound file was created during the upload"))
+		}
+	}
+	if err := os.Chmod(u.file.Name(), 0644); err != nil {
+		return fail(eris.Wrap(err, "failed to set the mode of the sound file"))
+	}
+	if err := os.Rename(u.file.Name(), u.path); err != nil {
+		return fail(eris.Wrap(err, "failed to store sound file"))
+	}
+	t.remove(id)
+	return ret, nil
+}
+
+// abort discards the upload
+func (t *soundUploads) abort(id string) error {
+	u, err := t.get(id)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if t.remove(id) {
+		u.discard()
+	}
+	return nil
+}
+
+// close discards the uploads in progress
+func (t *soundUploads) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	uploads := t.uploads
+	t.uploads = make(map[string]*soundUpload)
+	t.total = 0
+	t.mu.Unlock()
+
+	for _, u := range uploads {
+		u.mu.Lock()
+		u.discard()
+		u.mu.Unlock()
+	}
+}
+
+// soundUploadRequest checks that sound uploads are enabled and that the
+// request describes an upload
+func (s *Server) soundUploadRequest(reply string, req *proxy.Request) bool {
+	if !withSoundUpload {
+		s.sendError(reply, errExcluded(SubsystemSoundUpload))
+		return false
+	}
+	if s.soundUploads == nil {
+		s.sendError(reply, errSoundUploadDisabled)
+		return false
+	}
+	if req.SoundUpload == nil {
+		s.sendError(reply, eris.New("no sound upload"))
+		return false
+	}
+	return true
+}
+
+func (s *Server) soundUploadStart(ctx context.Context, reply string, req *proxy.Request) {
+	if !s.soundUploadRequest(reply, req) {
+		return
+	}
+
+	id, err := s.soundUploads.start(req.SoundUpload)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	s.Log.Info("started sound upload", "upload", id, "sound", req.SoundUpload.Name, "format", req.SoundUpload.Format, "language", req.SoundUpload.Language)
+
+	var key *ari.Key
+	if req.Key != nil {
+		key = req.Key.New(ari.SoundKey, req.SoundUpload.Name)
+	} else {
+		key = ari.NewKey(ari.SoundKey, req.SoundUpload.Name, ari.WithApp(s.Application), ari.WithNode(s.nodeID()))
+	}
+	s.publish(reply, &proxy.Response{
+		Key: key,
+		Data: &proxy.EntityData{
+			SoundUpload: &proxy.SoundUploadData{Upload: id},
+		},
+	})
+}
+
+func (s *Server) soundUploadChunk(ctx context.Context, reply string, req *proxy.Request) {
+	if !s.soundUploadRequest(reply, req) {
+		return
+	}
+
+	data, err := s.soundUploads.write(req.SoundUpload.Upload, req.SoundUpload.Chunk)
+	if err != nil {
+		s.Log.Warn("sound upload failed", "upload", req.SoundUpload.Upload, "error", err)
+		s.sendError(reply, err)
+		return
+	}
+	s.publish(reply, &proxy.Response{
+		Data: &proxy.EntityData{
+			SoundUpload: data,
+		},
+	})
+}
+
+func (s *Server) soundUploadAbort(ctx context.Context, reply string, req *proxy.Request) {
+	if !s.soundUploadRequest(reply, req) {
+		return
+	}
+	s.sendError(reply, s.soundUploads.abort(req.SoundUpload.Upload))
+}
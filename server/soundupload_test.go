@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+)
+
+func TestSoundPath(t *testing.T) {
+	for _, c := range []struct {
+		upload proxy.SoundUpload
+		path   string
+	}{
+		{proxy.SoundUpload{Name: "welcome", Format: "wav"}, "welcome.wav"},
+		{proxy.SoundUpload{Name: "custom/welcome", Format: "ulaw", Language: "en_GB"}, filepath.Join("en_GB", "custom", "welcome.ulaw")},
+		{proxy.SoundUpload{Name: "../etc/passwd", Format: "wav"}, ""},
+		{proxy.SoundUpload{Name: "/welcome", Format: "wav"}, ""},
+		{proxy.SoundUpload{Name: "welcome", Format: "wav/x"}, ""},
+		{proxy.SoundUpload{Name: "welcome", Format: "wav", Language: ".."}, ""},
+	} {
+		path, err := soundPath(&c.upload)
+		if c.path == "" {
+			if err == nil {
+				t.Errorf("%+v: expected an error", c.upload)
+			}
+			continue
+		}
+		if err != nil || path != c.path {
+			t.Errorf("%+v: unexpected path %q (%v)", c.upload, path, err)
+		}
+	}
+}
+
+func TestSoundUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sounds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	clk := clock.NewFake(time.Now())
+	uploads := newSoundUploads(&SoundUploadConfig{Dir: dir, MaxSize: 10}, clk)
+	chunk := func(seq uint64, data string, last bool) []byte {
+		return (&proxy.FileChunk{Seq: seq, Data: []byte(data), Last: last}).Encode()
+	}
+
+	id, err := uploads.start(&proxy.SoundUpload{Name: "custom/hello", Format: "wav", Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.write(id, chunk(0, "hello", false)); err != nil {
+		t.Fatal(err)
+	}
+	// A retried chunk is acknowledged again
+	if data, err := uploads.write(id, chunk(0, "hello", false)); err != nil || data.Size != 5 {
+		t.Fatalf("unexpected retry result %+v (%v)", data, err)
+	}
+	if data, err := uploads.write(id, chunk(1, "!", true)); err != nil || data.Size != 6 {
+		t.Fatalf("unexpected result %+v (%v)", data, err)
+	}
+	path := filepath.Join(dir, "en", "custom", "hello.wav")
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "hello!" {
+		t.Errorf("unexpected sound file %q (%v)", data, err)
+	}
+
+	// The existing sound is not replaced unless requested
+	if _, err := uploads.start(&proxy.SoundUpload{Name: "custom/hello", Format: "wav", Language: "en"}); err == nil {
+		t.Error("expected an error for an existing sound")
+	}
+
+	// An oversized file is discarded
+	id, err = uploads.start(&proxy.SoundUpload{Name: "custom/hello", Format: "wav", Language: "en", Overwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.write(id, chunk(0, "hello, world", true)); err == nil {
+		t.Error("expected an error for an oversized file")
+	}
+	if _, err := uploads.write(id, chunk(1, "", true)); err == nil {
+		t.Error("expected an error for a discarded upload")
+	}
+
+	// An idle upload expires when the next starts
+	id, err = uploads.start(&proxy.SoundUpload{Name: "bye", Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(DefaultSoundUploadIdleTimeout + time.Second)
+	other, err := uploads.start(&proxy.SoundUpload{Name: "other", Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.write(id, chunk(0, "bye", true)); err == nil {
+		t.Error("expected an error for an expired upload")
+	}
+	if err := uploads.abort(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the completed sound remains
+	var files []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error { // nolint: errcheck
+		if err == nil && !info.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if len(files) != 1 || files[0] != path {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestSoundUploadLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sounds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	uploads := newSoundUploads(&SoundUploadConfig{Dir: dir, MaxSize: 6, MaxUploads: 2, MaxTotalSize: 8}, clock.NewFake(time.Now()))
+	chunk := func(seq uint64, data string, last bool) []byte {
+		return (&proxy.FileChunk{Seq: seq, Data: []byte(data), Last: last}).Encode()
+	}
+
+	first, err := uploads.start(&proxy.SoundUpload{Name: "first", Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := uploads.start(&proxy.SoundUpload{Name: "second", Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No further upload starts while two are in progress
+	if _, err := uploads.start(&proxy.SoundUpload{Name: "third", Format: "wav"}); err == nil {
+		t.Error("expected an error for too many uploads")
+	}
+
+	// The uploads in progress may not exceed the total size together
+	if _, err := uploads.write(first, chunk(0, "hello", false)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.write(second, chunk(0, "bye!", false)); err == nil {
+		t.Error("expected an error beyond the total size")
+	}
+
+	// The discarded upload released its place and size
+	third, err := uploads.start(&proxy.SoundUpload{Name: "third", Format: "wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploads.write(third, chunk(0, "bye", true)); err != nil {
+		t.Fatal(err)
+	}
+
+	// As does the completed upload
+	if _, err := uploads.write(first, chunk(1, "!", true)); err != nil {
+		t.Fatal(err)
+	}
+	if uploads.total != 0 || len(uploads.uploads) != 0 {
+		t.Errorf("%d bytes of %d uploads left in progress", uploads.total, len(uploads.uploads))
+	}
+}
+
+func TestSoundUploadConfigValidate(t *testing.T) {
+	for name, cfg := range map[string]SoundUploadConfig{
+		"relative dir":       {Dir: "sounds"},
+		"negative uploads":   {Dir: "/sounds", MaxUploads: -1},
+		"negative total":     {Dir: "/sounds", MaxTotalSize: -1},
+		"total below a file": {Dir: "/sounds", MaxSize: 10, MaxTotalSize: 5},
+		"default total":      {Dir: "/sounds", MaxSize: DefaultSoundUploadMaxTotalSize + 1},
+	} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := (&SoundUploadConfig{Dir: "/sounds"}).validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestListenValidatesSoundUpload(t *testing.T) {
+	if !withSoundUpload {
+		t.Skip("sound upload is excluded from this build")
+	}
+
+	modules := new(arimocks.Modules)
+	modules.On("List", (*ari.Key)(nil)).Return(nil, errors.New("no modules"))
+	asterisk := new(arimocks.Asterisk)
+	asterisk.On("Info", (*ari.Key)(nil)).Return(&ari.AsteriskInfo{SystemInfo: ari.SystemInfo{EntityID: "node"}}, nil)
+	asterisk.On("Modules").Return(modules)
+	cl := new(arimocks.Client)
+	cl.On("Asterisk").Return(asterisk)
+	cl.On("ApplicationName").Return("app")
+
+	// The configuration is validated even if it was not set by the option
+	s := New()
+	s.ARIVersion = "5.0.0"
+	s.SoundUpload = &SoundUploadConfig{Dir: "sounds"}
+	err := s.ListenOn(context.Background(), cl, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid sound upload configuration") {
+		t.Errorf("unexpected listen error %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+)
+
+// StateConflictConfig describes the retries of idempotent channel operations
+// (e.g. hold or mute) when Asterisk reports that their entity is in an
+// invalid state (HTTP 412), which is often transient (e.g. while a channel is
+// being answered or moved between bridges)
+type StateConflictConfig struct {
+	// Retries is the maximum number of retries of an operation.  It defaults
+	// to DefaultStateConflictRetries.
+	Retries int `mapstructure:"retries"`
+
+	// Backoff is the delay before the first retry, doubled for each further
+	// retry.  It defaults to DefaultStateConflictBackoff.
+	Backoff time.Duration `mapstructure:"backoff"`
+}
+
+// Defaults of the StateConflictConfig
+const (
+	DefaultStateConflictRetries = 2
+	DefaultStateConflictBackoff = 50 * time.Millisecond
+)
+
+func (cfg StateConflictConfig) withDefaults() StateConflictConfig {
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultStateConflictRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultStateConflictBackoff
+	}
+	return cfg
+}
+
+// stateError is an ARI error classified as one of the typed errors of the
+// proxy package
+type stateError struct {
+	typed error
+	err   error
+}
+
+func (e *stateError) Error() string {
+	return e.typed.Error() + ": " + e.err.Error()
+}
+
+// Unwrap returns the typed error
+func (e *stateError) Unwrap() error {
+	return e.typed
+}
+
+// ariStatusCode returns the HTTP status code of the ARI response which caused
+// the given error, or zero if it was not caused by an ARI response
+func ariStatusCode(err error) int {
+	for err != nil {
+		switch v := err.(type) {
+		case interface{ Code() int }:
+			return v.Code()
+		case interface{ Unwrap() error }:
+			err = v.Unwrap()
+		case interface{ Cause() error }:
+			err = v.Cause()
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// channelCommand indicates whether the given kind of request operates on an
+// existing channel, as opposed to reading its data or creating it
+func channelCommand(kind string) bool {
+	if !strings.HasPrefix(kind, "Channel") {
+		return false
+	}
+	switch kind {
+	case "ChannelCreate", "ChannelData", "ChannelGet", "ChannelList", "ChannelOriginate":
+		return false
+	}
+	return true
+}
+
+// classifyError maps an ARI error of a request of the given kind to the
+// corresponding typed error, if any.  Commands on channels which no longer
+// exist or are no longer in the application (HTTP 404 and 409) fail with
+// proxy.ErrChannelGone, as do channels added to bridges which are no longer
+// in the application (HTTP 422).
+func classifyError(kind string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var typed error
+	switch ariStatusCode(err) {
+	case 404:
+		if channelCommand(kind) {
+			typed = proxy.ErrChannelGone
+		}
+	case 409:
+		if channelCommand(kind) {
+			typed = proxy.ErrChannelGone
+		} else {
+			typed = proxy.ErrConflict
+		}
+	case 412:
+		typed = proxy.ErrInvalidState
+	case 422:
+		if kind == "BridgeAddChannel" {
+			typed = proxy.ErrChannelGone
+		}
+	}
+	if typed == nil {
+		return err
+	}
+	return &stateError{typed: typed, err: err}
+}
+
+// retryInvalidState runs an idempotent ARI operation, retrying it while
+// Asterisk reports that its entity is in an invalid state, until the context
+// of the request is closed
+func (s *Server) retryInvalidState(ctx context.Context, op func() error) error {
+	var cfg StateConflictConfig
+	if s.StateConflict != nil {
+		cfg = *s.StateConflict
+	}
+	cfg = cfg.withDefaults()
+
+	backoff := cfg.Backoff
+	err := op()
+	for i := 0; i < cfg.Retries && ariStatusCode(err) == 412; i++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-s.clock().After(backoff):
+		}
+		backoff *= 2
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/rotisserie/eris"
+)
+
+type ariCodeError int
+
+func (e ariCodeError) Error() string { return "Non-2XX response" }
+func (e ariCodeError) Code() int     { return int(e) }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		kind     string
+		code     int
+		expected error
+	}{
+		{"ChannelHold", 409, proxy.ErrChannelGone},
+		{"ChannelHangup", 404, proxy.ErrChannelGone},
+		{"ChannelData", 404, nil},
+		{"ChannelAnswer", 412, proxy.ErrInvalidState},
+		{"BridgeAddChannel", 422, proxy.ErrChannelGone},
+		{"BridgeAddChannel", 409, proxy.ErrConflict},
+		{"PlaybackControl", 409, proxy.ErrConflict},
+		{"ChannelHold", 500, nil},
+	}
+	for _, tt := range tests {
+		cause := eris.Wrap(ariCodeError(tt.code), "failed to run operation")
+		err := classifyError(tt.kind, cause)
+		if tt.expected == nil {
+			if err != cause {
+				t.Errorf("%s %d: expected unclassified error, got %v", tt.kind, tt.code, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s %d: expected %v, got %v", tt.kind, tt.code, tt.expected, err)
+		}
+
+		// The classification survives the response
+		resp := proxy.NewErrorResponse(err)
+		if !errors.Is(resp.Err(), tt.expected) {
+			t.Errorf("%s %d: expected response error %v, got %v", tt.kind, tt.code, tt.expected, resp.Err())
+		}
+	}
+}
+
+func TestRetryInvalidState(t *testing.T) {
+	s := New(WithStateConflict(&StateConflictConfig{Retries: 2, Backoff: time.Millisecond}))
+	ctx := context.Background()
+
+	var calls int
+	err := s.retryInvalidState(ctx, func() error {
+		calls++
+		if calls < 2 {
+			return ariCodeError(412)
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected success after a retry, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = s.retryInvalidState(ctx, func() error {
+		calls++
+		return ariCodeError(412)
+	})
+	if ariStatusCode(err) != 412 || calls != 3 {
+		t.Errorf("expected failure after 2 retries, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	s.retryInvalidState(ctx, func() error { // nolint: errcheck
+		calls++
+		return ariCodeError(409)
+	})
+	if calls != 1 {
+		t.Errorf("expected no retry of conflict, got %d calls", calls)
+	}
+}
+
+func TestRetryInvalidStateBackoff(t *testing.T) {
+	start := time.Unix(0, 0)
+	fc := clock.NewFake(start)
+	s := New(WithClock(fc), WithStateConflict(&StateConflictConfig{Retries: 3, Backoff: 10 * time.Millisecond}))
+
+	attempts := make(chan time.Duration, 4)
+	op := func() error {
+		attempts <- fc.Now().Sub(start)
+		return ariCodeError(412)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.retryInvalidState(ctx, op)
+	}()
+
+	// The retries wait for the doubling backoff on the server clock
+	var waited time.Duration
+	for i, backoff := range []time.Duration{0, 10 * time.Millisecond, 20 * time.Millisecond} {
+		if i > 0 {
+			for fc.Waiters() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			fc.Advance(backoff)
+			waited += backoff
+		}
+		select {
+		case at := <-attempts:
+			if at != waited {
+				t.Errorf("attempt %d at %v, want %v", i+1, at, waited)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("attempt %d not made", i+1)
+		}
+	}
+
+	// The request is abandoned while waiting for the last retry
+	for fc.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if ariStatusCode(err) != 412 {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retries continued past the request")
+	}
+	if len(attempts) != 0 {
+		t.Error("operation retried after the request was abandoned")
+	}
+}
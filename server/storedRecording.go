@@ -2,10 +2,17 @@ package server
 
 import (
 	"context"
+	"io"
+	"net/url"
 
 	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/rotisserie/eris"
 )
 
+// defaultFileChunkSize is the size of the data of the chunks of a file
+// transfer, if the maximum payload of the NATS connection is not known
+const defaultFileChunkSize = 64 * 1024
+
 func (s *Server) recordingStoredCopy(ctx context.Context, reply string, req *proxy.Request) {
 	h, err := s.ari.StoredRecording().Copy(req.Key, req.RecordingStoredCopy.Destination)
 	if err != nil {
@@ -55,7 +62,47 @@ func (s *Server) recordingStoredList(ctx context.Context, reply string, req *pro
 		return
 	}
 
-	s.publish(reply, &proxy.Response{
-		Keys: list,
-	})
+	s.publishList(reply, req, list)
+}
+
+// recordingStoredFile streams the file of the stored recording to the reply
+// subject, in a sequence of file chunks, downloading it through the REST
+// interface, as the ARI client library does not provide the operation.  A
+// failure is reported by an error response, which may follow chunks.
+func (s *Server) recordingStoredFile(ctx context.Context, reply string, req *proxy.Request) {
+	if reply == "" {
+		return
+	}
+
+	body, err := s.rest.open(ctx, "/recordings/stored/"+url.PathEscape(req.Key.ID)+"/file")
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	defer body.Close() // nolint: errcheck
+
+	size := s.maxResponseSize() - proxy.FileChunkHeaderSize
+	if size <= 0 {
+		size = defaultFileChunkSize
+	}
+	buf := make([]byte, size)
+
+	for seq := uint64(0); ; seq++ {
+		n, err := io.ReadFull(body, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			s.sendError(reply, eris.Wrap(err, "failed to read recording file"))
+			return
+		}
+
+		c := &proxy.FileChunk{Seq: seq, Data: buf[:n], Last: last}
+		if err := s.nats.Conn.Publish(reply, c.Encode()); err != nil {
+			s.metrics.publishFailed()
+			s.Log.Warn("failed to publish recording file chunk", "recording", req.Key.ID, "error", err)
+			return
+		}
+		if last {
+			return
+		}
+	}
 }
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5/client/native"
+)
+
+func TestRESTOpen(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ari/recordings/stored/r1/file" {
+			http.Error(w, `{"message":"Recording not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/wav")
+		w.Write([]byte("RIFF....WAVE")) // nolint: errcheck
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.rest = newARIREST(&native.Options{URL: ts.URL + "/ari"})
+
+	body, err := s.rest.open(context.Background(), "/recordings/stored/r1/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(body)
+	body.Close() // nolint: errcheck
+	if err != nil || string(data) != "RIFF....WAVE" {
+		t.Errorf("unexpected file %q (%v)", data, err)
+	}
+
+	if _, err := s.rest.open(context.Background(), "/recordings/stored/r2/file"); err == nil {
+		t.Error("expected an error for a missing recording")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !no_audiofork
+// +build !no_audiofork
+
+package server
+
+// withAudioFork indicates that the audiofork subsystem is included in the build
+const withAudioFork = true
@@ -0,0 +1,7 @@
+//go:build no_clicktocall
+// +build no_clicktocall
+
+package server
+
+// withClickToCall indicates that the clicktocall subsystem is excluded from the build
+const withClickToCall = false
@@ -0,0 +1,7 @@
+//go:build !no_debugcapture
+// +build !no_debugcapture
+
+package server
+
+// withDebugCapture indicates that the debugcapture subsystem is included in the build
+const withDebugCapture = true
@@ -0,0 +1,7 @@
+//go:build !no_health
+// +build !no_health
+
+package server
+
+// withHealth indicates that the health subsystem is included in the build
+const withHealth = true
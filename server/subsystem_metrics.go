@@ -0,0 +1,7 @@
+//go:build !no_metrics
+// +build !no_metrics
+
+package server
+
+// withMetrics indicates that the metrics subsystem is included in the build
+const withMetrics = true
@@ -0,0 +1,7 @@
+//go:build !no_soundupload
+// +build !no_soundupload
+
+package server
+
+// withSoundUpload indicates that the soundupload subsystem is included in the build
+const withSoundUpload = true
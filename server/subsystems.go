@@ -0,0 +1,67 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/rotisserie/eris"
+)
+
+// Names of the optional subsystems which may be excluded from the build of the
+// server, to reduce the size and the attack surface of minimal proxies.  A
+// subsystem is excluded by the build tag "no_" followed by its name, e.g.:
+//
+//	go build -tags "no_metrics no_clicktocall"
+//
+// The code of an excluded subsystem is not linked into the binary, and its
+// configuration is rejected when the server starts.
+const (
+	// SubsystemAudioFork is the audio fork module, with its RTP and
+	// WebSocket listeners
+	SubsystemAudioFork = "audiofork"
+
+	// SubsystemClickToCall is the click-to-call HTTP endpoint
+	SubsystemClickToCall = "clicktocall"
+
+	// SubsystemDebugCapture is the runtime capture of ARI exchanges
+	SubsystemDebugCapture = "debugcapture"
+
+	// SubsystemHealth is the HTTP endpoint of the health probes
+	SubsystemHealth = "health"
+
+	// SubsystemMetrics is the HTTP endpoint of the metrics.  Metrics are
+	// still collected, for the other subsystems which report them.
+	SubsystemMetrics = "metrics"
+
+	// SubsystemSoundUpload is the upload of sound files into the sounds
+	// directory of the node
+	SubsystemSoundUpload = "soundupload"
+)
+
+// subsystems indicates, by name, whether each optional subsystem is included
+// in the build
+var subsystems = map[string]bool{
+	SubsystemAudioFork:    withAudioFork,
+	SubsystemClickToCall:  withClickToCall,
+	SubsystemDebugCapture: withDebugCapture,
+	SubsystemHealth:       withHealth,
+	SubsystemMetrics:      withMetrics,
+	SubsystemSoundUpload:  withSoundUpload,
+}
+
+// ExcludedSubsystems returns the sorted names of the optional subsystems which
+// were excluded from the build by their build tags
+func ExcludedSubsystems() (ret []string) {
+	for name, included := range subsystems {
+		if !included {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// errExcluded returns the error reporting that the named subsystem was
+// excluded from the build
+func errExcluded(name string) error {
+	return eris.Errorf("the %s subsystem is excluded from this build (build tag no_%s)", name, name)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExcludedSubsystems(t *testing.T) {
+	excluded := ExcludedSubsystems()
+	for _, name := range excluded {
+		if subsystems[name] {
+			t.Errorf("included subsystem %s reported as excluded", name)
+		}
+	}
+
+	// The configuration of an excluded subsystem is rejected
+	s := New(WithMetrics(&MetricsConfig{Listen: ":9180"}))
+	if withMetrics != (s.optErr == nil) {
+		t.Errorf("unexpected option error %v", s.optErr)
+	}
+	if !withMetrics && !strings.Contains(s.optErr.Error(), "no_metrics") {
+		t.Errorf("unexpected option error %v", s.optErr)
+	}
+}
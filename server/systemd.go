@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+// DefaultSystemdStatusInterval is the default interval at which the status
+// text of the service is updated
+const DefaultSystemdStatusInterval = 30 * time.Second
+
+// SystemdConfig describes the integration of the server with the systemd
+// service manager, for a proxy run as a service of Type=notify.  The server
+// notifies systemd once it is ready and when it stops, keeps the status text
+// of the service up to date, and, if the service has a watchdog
+// (WatchdogSec), pings it while the server is live, so that systemd restarts
+// a wedged proxy.  It does nothing if the proxy is not run by systemd.
+type SystemdConfig struct {
+	// StatusInterval is the interval at which the status text of the
+	// service (the connected node and its number of channels) is updated.
+	// It defaults to DefaultSystemdStatusInterval.
+	StatusInterval time.Duration `mapstructure:"status_interval"`
+}
+
+// systemdNotifier sends notifications to systemd over its notification
+// socket (see sd_notify(3))
+type systemdNotifier struct {
+	addr *net.UnixAddr
+
+	// watchdog is the interval at which the watchdog must be pinged, or
+	// zero if the service has no watchdog
+	watchdog time.Duration
+}
+
+// newSystemdNotifier returns the notifier of the service manager which runs
+// the process, or nil if the process is not run by systemd
+func newSystemdNotifier() (*systemdNotifier, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil, nil
+	}
+	n := &systemdNotifier{
+		addr: &net.UnixAddr{Name: socket, Net: "unixgram"},
+	}
+
+	// The watchdog is pinged at half its timeout, as recommended
+	if usec := os.Getenv("WATCHDOG_USEC"); usec != "" {
+		v, err := strconv.ParseInt(usec, 10, 64)
+		if err != nil || v <= 0 {
+			return nil, eris.Errorf("invalid WATCHDOG_USEC %q", usec)
+		}
+		pid := os.Getenv("WATCHDOG_PID")
+		if pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			n.watchdog = time.Duration(v) * time.Microsecond / 2
+		}
+	}
+	return n, nil
+}
+
+// notify sends the given state assignments (e.g. "READY=1") to systemd
+func (n *systemdNotifier) notify(state string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return eris.Wrap(err, "failed to connect to the systemd notification socket")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return eris.Wrap(err, "failed to notify systemd")
+	}
+	return nil
+}
+
+// notifySystemd sends the given state assignments to systemd, if the server
+// integrates with it, logging any failure
+func (s *Server) notifySystemd(state string) {
+	if err := s.systemd.notify(state); err != nil {
+		s.Log.Warn("failed to notify systemd", "state", state, "error", err)
+	}
+}
+
+// systemdStatus returns the status text of the service
+func (s *Server) systemdStatus() string {
+	h := s.Health()
+	switch {
+	case s.leaving():
+		return "Stopping: draining requests"
+	case !h.ARIConnected:
+		return fmt.Sprintf("Node %s (%s): ARI disconnected", s.nodeID(), s.Application)
+	case !h.NATSConnected:
+		return fmt.Sprintf("Node %s (%s): NATS disconnected", s.nodeID(), s.Application)
+	}
+
+	status := fmt.Sprintf("Node %s (%s)", s.nodeID(), s.Application)
+	if channels, err := s.ari.Channel().List(nil); err == nil {
+		status += fmt.Sprintf(": %d channels", len(channels))
+	}
+	if h.Draining {
+		status += ", draining"
+	}
+	return status
+}
+
+// runSystemd notifies systemd that the server is ready, then updates the
+// status of the service and pings its watchdog until the context is closed.
+// The watchdog is only pinged while the server is live, so that systemd
+// restarts a proxy which has lost its connections.
+func (s *Server) runSystemd(ctx context.Context) {
+	interval := s.Systemd.StatusInterval
+	if interval <= 0 {
+		interval = DefaultSystemdStatusInterval
+	}
+	status := s.clock().NewTicker(interval)
+	defer status.Stop()
+
+	var watchdog <-chan time.Time
+	if s.systemd.watchdog > 0 {
+		t := s.clock().NewTicker(s.systemd.watchdog)
+		defer t.Stop()
+		watchdog = t.C()
+	}
+
+	s.notifySystemd("READY=1\nSTATUS=" + s.systemdStatus())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-status.C():
+			s.notifySystemd("STATUS=" + s.systemdStatus())
+		case <-watchdog:
+			if h := s.Health(); h.Live() {
+				s.notifySystemd("WATCHDOG=1")
+			} else {
+				s.Log.Warn("withholding systemd watchdog ping", "ari_connected", h.ARIConnected, "nats_connected", h.NATSConnected)
+			}
+		}
+	}
+}
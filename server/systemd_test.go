@@ -0,0 +1,76 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSystemdNotifier(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd is not available on Windows")
+	}
+
+	for _, env := range []string{"NOTIFY_SOCKET", "WATCHDOG_USEC", "WATCHDOG_PID"} {
+		defer os.Setenv(env, os.Getenv(env)) // nolint: errcheck
+		os.Unsetenv(env)                     // nolint: errcheck
+	}
+
+	// Not run by systemd
+	if n, err := newSystemdNotifier(); n != nil || err != nil {
+		t.Fatalf("unexpected notifier %+v (%v)", n, err)
+	}
+	if err := (*systemdNotifier)(nil).notify("READY=1"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() // nolint: errcheck
+
+	os.Setenv("NOTIFY_SOCKET", socket)                   // nolint: errcheck
+	os.Setenv("WATCHDOG_USEC", "10000000")               // nolint: errcheck
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid())) // nolint: errcheck
+
+	n, err := newSystemdNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.watchdog != 5*time.Second {
+		t.Errorf("unexpected watchdog interval %s", n.watchdog)
+	}
+
+	if err := n.notify("READY=1\nSTATUS=ok"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	m, err := conn.Read(buf)
+	if err != nil || string(buf[:m]) != "READY=1\nSTATUS=ok" {
+		t.Errorf("unexpected notification %q (%v)", buf[:m], err)
+	}
+
+	// The watchdog of another process is not pinged
+	os.Setenv("WATCHDOG_PID", "1") // nolint: errcheck
+	if n, err := newSystemdNotifier(); err != nil || n.watchdog != 0 {
+		t.Errorf("unexpected watchdog of another process %+v (%v)", n, err)
+	}
+
+	os.Setenv("WATCHDOG_USEC", "soon") // nolint: errcheck
+	if _, err := newSystemdNotifier(); err == nil {
+		t.Error("expected an error for an invalid watchdog timeout")
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"regexp"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/rotisserie/eris"
+)
+
+// VarsetFilterConfig selects, by the name of the variable, the ChannelVarset
+// events which the proxy publishes.  Variable changes usually dominate the
+// event volume of an application (e.g. the variables set by dialplan
+// applications and channel drivers) while clients care about few of them.
+// The patterns are regular expressions matched against the variable name.
+type VarsetFilterConfig struct {
+	// Allow, if not empty, restricts the published events to the variables
+	// matching one of its patterns
+	Allow []string `mapstructure:"allow"`
+
+	// Deny excludes the variables matching one of its patterns, even if they
+	// are allowed
+	Deny []string `mapstructure:"deny"`
+}
+
+// varsetFilter is a compiled VarsetFilterConfig
+type varsetFilter struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+func compileVarsetPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var ret []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, eris.Wrapf(err, "invalid variable pattern %q", p)
+		}
+		ret = append(ret, re)
+	}
+	return ret, nil
+}
+
+// newVarsetFilter compiles the given configuration, returning nil if no
+// ChannelVarset events are filtered
+func newVarsetFilter(cfg *VarsetFilterConfig) (*varsetFilter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	f := new(varsetFilter)
+	var err error
+	if f.allow, err = compileVarsetPatterns(cfg.Allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = compileVarsetPatterns(cfg.Deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// allows indicates whether the changes of the given variable are published
+func (f *varsetFilter) allows(variable string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.allow) > 0 {
+		allowed := false
+		for _, re := range f.allow {
+			if re.MatchString(variable) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, re := range f.deny {
+		if re.MatchString(variable) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterVarset indicates whether the given event is a ChannelVarset event
+// which is withheld by the varset filter.  The proxy still processes it
+// internally (e.g. for watches).
+func (s *Server) filterVarset(e ari.Event) bool {
+	v, ok := e.(*ari.ChannelVarset)
+	if !ok || s.varsetFilter.allows(v.Variable) {
+		return false
+	}
+	s.metrics.varsetFiltered()
+	return true
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestVarsetFilter(t *testing.T) {
+	f, err := newVarsetFilter(&VarsetFilterConfig{
+		Allow: []string{"^CUSTOMER_", "^RTPAUDIOQOS"},
+		Deny:  []string{"^RTPAUDIOQOS"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for v, want := range map[string]bool{
+		"CUSTOMER_ID":    true,
+		"RTPAUDIOQOSRTT": false,
+		"DIALSTATUS":     false,
+	} {
+		if f.allows(v) != want {
+			t.Errorf("%s: allowed %v, want %v", v, !want, want)
+		}
+	}
+
+	// Without allow patterns, everything not denied is published
+	if f, err = newVarsetFilter(&VarsetFilterConfig{Deny: []string{"^RTPAUDIOQOS"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.allows("DIALSTATUS") || f.allows("RTPAUDIOQOS") {
+		t.Error("deny-only filter misapplied")
+	}
+
+	if _, err = newVarsetFilter(&VarsetFilterConfig{Allow: []string{"("}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestFilterVarset(t *testing.T) {
+	s := New(WithVarsetFilter(&VarsetFilterConfig{Deny: []string{"^RTPAUDIOQOS"}}))
+	var err error
+	if s.varsetFilter, err = newVarsetFilter(s.VarsetFilter); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.filterVarset(&ari.ChannelVarset{Variable: "RTPAUDIOQOS"}) {
+		t.Error("denied variable published")
+	}
+	if s.filterVarset(&ari.ChannelVarset{Variable: "DIALSTATUS"}) || s.filterVarset(&ari.ChannelDtmfReceived{}) {
+		t.Error("event withheld")
+	}
+	if s.metrics.filteredVarsets != 1 {
+		t.Errorf("%d filtered events counted", s.metrics.filteredVarsets)
+	}
+}
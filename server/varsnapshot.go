@@ -0,0 +1,49 @@
+package server
+
+import (
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+// snapshotVariables reads the given channel variables of a channel.  The
+// variables already reported with the channel (e.g. by the channelvars
+// setting of ari.conf) are taken from known, and the others are fetched from
+// Asterisk.  Variables which cannot be read are returned as missing.
+func snapshotVariables(ch ari.Channel, key *ari.Key, names []string, known map[string]string) (vars map[string]string, missing []string) {
+	vars = make(map[string]string, len(names))
+	for _, name := range names {
+		if v, ok := known[name]; ok {
+			vars[name] = v
+			continue
+		}
+		v, err := ch.GetVariable(key, name)
+		if err != nil {
+			missing = append(missing, name)
+			continue
+		}
+		vars[name] = v
+	}
+	return vars, missing
+}
+
+// reportChannelVariables publishes a ChannelVariables event with the
+// configured channel variables of a call entering the application.  The
+// variables are fetched in the background, so that other events are not
+// delayed.
+func (s *Server) reportChannelVariables(e *ari.StasisStart) {
+	if len(s.ChannelVariables) == 0 {
+		return
+	}
+
+	key := ari.NewKey(ari.ChannelKey, e.Channel.ID)
+	known := e.Channel.ChannelVars
+	go func() {
+		vars, missing := snapshotVariables(s.ari.Channel(), key, s.ChannelVariables, known)
+		s.publishEvent(&proxy.ChannelVariables{
+			EventData: s.newEventData(proxy.EventChannelVariables),
+			ChannelID: e.Channel.ID,
+			Variables: vars,
+			Missing:   missing,
+		})
+	}()
+}
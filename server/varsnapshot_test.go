@@ -0,0 +1,28 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/rotisserie/eris"
+)
+
+func TestSnapshotVariables(t *testing.T) {
+	key := ari.NewKey(ari.ChannelKey, "c1")
+
+	ch := new(arimocks.Channel)
+	ch.On("GetVariable", key, "CALLERID(num)").Return("+15551234567", nil)
+	ch.On("GetVariable", key, "TENANT").Return("", eris.New("Not found"))
+
+	vars, missing := snapshotVariables(ch, key, []string{"CALLERID(num)", "TENANT", "CAMPAIGN"}, map[string]string{"CAMPAIGN": "spring"})
+	want := map[string]string{"CALLERID(num)": "+15551234567", "CAMPAIGN": "spring"}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("variables %v, want %v", vars, want)
+	}
+	if len(missing) != 1 || missing[0] != "TENANT" {
+		t.Errorf("unexpected missing variables %v", missing)
+	}
+	ch.AssertNotCalled(t, "GetVariable", key, "CAMPAIGN")
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// Voicemail folders
+const (
+	voicemailInbox = "INBOX"
+	voicemailOld   = "Old"
+)
+
+// VoicemailConfig describes the configuration of the voicemail module.
+// Messages are stored as Asterisk stored recordings named
+// `<Prefix>/<mailbox>/<folder>/<message>`, where folder is "INBOX" for new
+// messages and "Old" for messages which have been heard.
+type VoicemailConfig struct {
+	// Prefix is the stored recording directory under which mailboxes are
+	// kept.  It defaults to "voicemail".
+	Prefix string `mapstructure:"prefix"`
+
+	// Greeting is the default greeting played before a message is recorded.
+	// It defaults to "sound:vm-intro".
+	Greeting string `mapstructure:"greeting"`
+
+	// MenuPrompt is the prompt played after each message during retrieval.
+	// It defaults to "sound:vm-advopts".
+	MenuPrompt string `mapstructure:"menu_prompt"`
+
+	// Format is the recording format of messages.  It defaults to "wav".
+	Format string `mapstructure:"format"`
+
+	// MaxDuration is the maximum length of a message.  It defaults to two minutes.
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+
+	// MaxSilence is the duration of silence after which recording of a
+	// message is stopped.  It defaults to ten seconds.
+	MaxSilence time.Duration `mapstructure:"max_silence"`
+
+	// MenuTimeout is the time to wait for a menu selection during retrieval.
+	// It defaults to five seconds.
+	MenuTimeout time.Duration `mapstructure:"menu_timeout"`
+}
+
+func (c *VoicemailConfig) prefix() string {
+	if c.Prefix == "" {
+		return "voicemail"
+	}
+	return strings.Trim(c.Prefix, "/")
+}
+
+func (c *VoicemailConfig) withDefaults() VoicemailConfig {
+	ret := *c
+	ret.Prefix = c.prefix()
+	if ret.Greeting == "" {
+		ret.Greeting = "sound:vm-intro"
+	}
+	if ret.MenuPrompt == "" {
+		ret.MenuPrompt = "sound:vm-advopts"
+	}
+	if ret.Format == "" {
+		ret.Format = "wav"
+	}
+	if ret.MaxDuration == 0 {
+		ret.MaxDuration = 2 * time.Minute
+	}
+	if ret.MaxSilence == 0 {
+		ret.MaxSilence = 10 * time.Second
+	}
+	if ret.MenuTimeout == 0 {
+		ret.MenuTimeout = 5 * time.Second
+	}
+	return ret
+}
+
+// voicemailPath returns the stored recording name of the given message
+func voicemailPath(prefix, mailbox, folder, message string) string {
+	return strings.Join([]string{prefix, mailbox, folder, message}, "/")
+}
+
+// voicemailFolder returns the folder of the given stored recording name if it
+// is a message of the given mailbox
+func voicemailFolder(prefix, mailbox, name string) (string, bool) {
+	rest := strings.TrimPrefix(name, prefix+"/"+mailbox+"/")
+	if rest == name {
+		return "", false
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || (parts[0] != voicemailInbox && parts[0] != voicemailOld) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (s *Server) voicemailRequest(reply string, req *proxy.Request) (VoicemailConfig, bool) {
+	if s.Voicemail == nil {
+		s.sendError(reply, eris.New("voicemail module is not enabled"))
+		return VoicemailConfig{}, false
+	}
+	if req.Voicemail == nil || req.Voicemail.Mailbox == "" {
+		s.sendError(reply, eris.New("mailbox is required"))
+		return VoicemailConfig{}, false
+	}
+	if strings.Contains(req.Voicemail.Mailbox, "/") {
+		s.sendError(reply, eris.Errorf("invalid mailbox %q", req.Voicemail.Mailbox))
+		return VoicemailConfig{}, false
+	}
+	return s.Voicemail.withDefaults(), true
+}
+
+// voicemailMessages returns the stored recording keys of the messages in the
+// mailbox, new messages first and each folder in order of arrival
+func (s *Server) voicemailMessages(cfg VoicemailConfig, mailbox string) (inbox []*ari.Key, old []*ari.Key, err error) {
+	list, err := s.ari.StoredRecording().List(nil)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "failed to list stored recordings")
+	}
+
+	for _, k := range list {
+		switch folder, _ := voicemailFolder(cfg.Prefix, mailbox, k.ID); folder {
+		case voicemailInbox:
+			inbox = append(inbox, k)
+		case voicemailOld:
+			old = append(old, k)
+		}
+	}
+
+	byID := func(list []*ari.Key) func(i, j int) bool {
+		return func(i, j int) bool { return list[i].ID < list[j].ID }
+	}
+	sort.Slice(inbox, byID(inbox))
+	sort.Slice(old, byID(old))
+
+	return inbox, old, nil
+}
+
+// updateMWI updates the message waiting indication of the mailbox from its
+// stored messages
+func (s *Server) updateMWI(cfg VoicemailConfig, mailbox string) {
+	inbox, old, err := s.voicemailMessages(cfg, mailbox)
+	if err != nil {
+		s.Log.Warn("failed to count voicemail messages", "mailbox", mailbox, "error", err)
+		return
+	}
+
+	if err := s.ari.Mailbox().Update(ari.NewKey(ari.MailboxKey, mailbox), len(old), len(inbox)); err != nil {
+		s.Log.Warn("failed to update mailbox", "mailbox", mailbox, "error", err)
+	}
+}
+
+func (s *Server) voicemailList(ctx context.Context, reply string, req *proxy.Request) {
+	cfg, ok := s.voicemailRequest(reply, req)
+	if !ok {
+		return
+	}
+
+	inbox, old, err := s.voicemailMessages(cfg, req.Voicemail.Mailbox)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	s.publishList(reply, req, append(inbox, old...))
+}
+
+func (s *Server) voicemailDeposit(ctx context.Context, reply string, req *proxy.Request) {
+	cfg, ok := s.voicemailRequest(reply, req)
+	if !ok {
+		return
+	}
+
+	mailbox := req.Voicemail.Mailbox
+	message := fmt.Sprintf("%d-%s", s.clock().Now().Unix(), rid.New(rid.Recording))
+	name := voicemailPath(cfg.Prefix, mailbox, voicemailInbox, message)
+
+	greeting := req.Voicemail.Greeting
+	if greeting == "" {
+		greeting = cfg.Greeting
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+		s.Dialog.Bind(req.Key.Dialog, "recording", name)
+	}
+
+	f := s.newCallFlow(req.Key)
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key.New(ari.StoredRecordingKey, name),
+	})
+
+	go func() {
+		defer f.Close()
+
+		ev := &proxy.VoicemailFinished{
+			EventData: s.newEventData(proxy.EventVoicemailFinished),
+			ChannelID: req.Key.ID,
+			Mailbox:   mailbox,
+			Operation: "deposit",
+		}
+
+		data, err := s.depositVoicemail(ctx, f, cfg, req.Tenant, greeting, name)
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		if data != nil {
+			ev.Message = name
+			ev.Duration = int(time.Duration(data.Duration) / time.Second)
+
+			s.updateMWI(cfg, mailbox)
+		}
+
+		s.publishEvent(ev)
+	}()
+}
+
+func (s *Server) depositVoicemail(ctx context.Context, f *callFlow, cfg VoicemailConfig, tenant, greeting, name string) (*ari.LiveRecordingData, error) {
+	// Pressing # skips the greeting
+	if _, err := f.Play(ctx, greeting, "#"); err != nil {
+		return nil, err
+	}
+
+	if err := s.quota.AdmitRecording(s.Application, tenant, name); err != nil {
+		return nil, err
+	}
+	defer s.quota.ReleaseRecording(name)
+
+	return f.Record(ctx, name, &ari.RecordingOptions{
+		Format:      cfg.Format,
+		MaxDuration: cfg.MaxDuration,
+		MaxSilence:  cfg.MaxSilence,
+		Beep:        true,
+		Terminate:   "#",
+		Exists:      "fail",
+	})
+}
+
+func (s *Server) voicemailRetrieve(ctx context.Context, reply string, req *proxy.Request) {
+	cfg, ok := s.voicemailRequest(reply, req)
+	if !ok {
+		return
+	}
+
+	mailbox := req.Voicemail.Mailbox
+
+	inbox, old, err := s.voicemailMessages(cfg, mailbox)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, "channel", req.Key.ID)
+	}
+
+	f := s.newCallFlow(req.Key)
+
+	s.publish(reply, &proxy.Response{
+		Key: req.Key.New(ari.MailboxKey, mailbox),
+	})
+
+	go func() {
+		defer f.Close()
+
+		ev := &proxy.VoicemailFinished{
+			EventData: s.newEventData(proxy.EventVoicemailFinished),
+			ChannelID: req.Key.ID,
+			Mailbox:   mailbox,
+			Operation: "retrieve",
+		}
+
+		err := s.retrieveVoicemail(ctx, f, cfg, mailbox, inbox, old, ev)
+		if err != nil && err != errHangup {
+			ev.Error = err.Error()
+		}
+
+		s.updateMWI(cfg, mailbox)
+
+		s.publishEvent(ev)
+	}()
+}
+
+// retrieveVoicemail runs the retrieval menu.  After each message, the caller
+// may press 1 to replay it, 7 to delete it, 9 (or nothing) to save it and
+// continue, or # to exit.
+func (s *Server) retrieveVoicemail(ctx context.Context, f *callFlow, cfg VoicemailConfig, mailbox string, inbox, old []*ari.Key, ev *proxy.VoicemailFinished) error {
+	const menuDigits = "179#"
+
+	for _, m := range []string{"sound:vm-youhave", fmt.Sprintf("number:%d", len(inbox)), "sound:vm-INBOX", "sound:vm-messages"} {
+		if _, err := f.Play(ctx, m, ""); err != nil {
+			return err
+		}
+	}
+
+	messages := append(inbox, old...)
+	for i := 0; i < len(messages); {
+		k := messages[i]
+
+		digit, err := f.Play(ctx, "recording:"+k.ID, menuDigits)
+		if err != nil {
+			return err
+		}
+		if digit == "" {
+			if digit, err = f.Play(ctx, cfg.MenuPrompt, menuDigits); err != nil {
+				return err
+			}
+		}
+		if digit == "" {
+			if digit, err = f.WaitDigit(ctx, cfg.MenuTimeout); err != nil {
+				return err
+			}
+		}
+
+		switch digit {
+		case "1":
+			continue
+		case "#":
+			return s.markVoicemailOld(cfg, mailbox, k)
+		case "7":
+			if err := s.ari.StoredRecording().Delete(k); err != nil {
+				return eris.Wrap(err, "failed to delete message")
+			}
+			ev.Deleted++
+		default:
+			if err := s.markVoicemailOld(cfg, mailbox, k); err != nil {
+				return err
+			}
+		}
+
+		ev.Played++
+		i++
+	}
+
+	if _, err := f.Play(ctx, "sound:vm-nomore", ""); err != nil {
+		return err
+	}
+	_, err := f.Play(ctx, "sound:vm-goodbye", "")
+	return err
+}
+
+// markVoicemailOld moves a message from the INBOX to the Old folder
+func (s *Server) markVoicemailOld(cfg VoicemailConfig, mailbox string, k *ari.Key) error {
+	if folder, _ := voicemailFolder(cfg.Prefix, mailbox, k.ID); folder != voicemailInbox {
+		return nil
+	}
+
+	dest := voicemailPath(cfg.Prefix, mailbox, voicemailOld, k.ID[strings.LastIndex(k.ID, "/")+1:])
+	if _, err := s.ari.StoredRecording().Copy(k, dest); err != nil {
+		return eris.Wrap(err, "failed to save message")
+	}
+	if err := s.ari.StoredRecording().Delete(k); err != nil {
+		return eris.Wrap(err, "failed to remove saved message from inbox")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/client/arimocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVoicemailFolder(t *testing.T) {
+	tests := []struct {
+		name   string
+		folder string
+		ok     bool
+	}{
+		{voicemailPath("voicemail", "1000@default", voicemailInbox, "1600000000-rc1"), voicemailInbox, true},
+		{voicemailPath("voicemail", "1000@default", voicemailOld, "1600000000-rc1"), voicemailOld, true},
+		{voicemailPath("voicemail", "1001@default", voicemailInbox, "1600000000-rc1"), "", false},
+		{"voicemail/1000@default/Work/1600000000-rc1", "", false},
+		{"other/recording", "", false},
+	}
+	for _, tt := range tests {
+		folder, ok := voicemailFolder("voicemail", "1000@default", tt.name)
+		if folder != tt.folder || ok != tt.ok {
+			t.Errorf("%s: expected (%q, %v), got (%q, %v)", tt.name, tt.folder, tt.ok, folder, ok)
+		}
+	}
+}
+
+func TestVoicemailConfigDefaults(t *testing.T) {
+	cfg := (&VoicemailConfig{Prefix: "/vm/"}).withDefaults()
+	if cfg.Prefix != "vm" {
+		t.Errorf("expected trimmed prefix, got %q", cfg.Prefix)
+	}
+	if cfg.Greeting == "" || cfg.MenuPrompt == "" || cfg.Format == "" || cfg.MaxDuration == 0 || cfg.MenuTimeout == 0 {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+}
+
+// voicemailStore mocks the stored recordings of Asterisk, and the mailbox
+// whose message waiting indication is updated from them
+type voicemailStore struct {
+	names map[string]bool
+	mu    sync.Mutex
+
+	recordings *arimocks.StoredRecording
+	mailbox    *arimocks.Mailbox
+}
+
+func newVoicemailStore(ft *flowTest, names ...string) *voicemailStore {
+	vs := &voicemailStore{
+		names:      make(map[string]bool),
+		recordings: new(arimocks.StoredRecording),
+		mailbox:    new(arimocks.Mailbox),
+	}
+	for _, name := range names {
+		vs.names[name] = true
+	}
+
+	vs.recordings.On("List", (*ari.Key)(nil)).Return(func(*ari.Key) []*ari.Key {
+		vs.mu.Lock()
+		defer vs.mu.Unlock()
+		var ret []*ari.Key
+		for name := range vs.names {
+			ret = append(ret, ari.NewKey(ari.StoredRecordingKey, name))
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+		return ret
+	}, nil)
+	vs.recordings.On("Copy", mock.Anything, mock.Anything).Return(func(_ *ari.Key, dest string) *ari.StoredRecordingHandle {
+		vs.add(dest)
+		return nil
+	}, nil)
+	vs.recordings.On("Delete", mock.Anything).Return(func(k *ari.Key) error {
+		vs.mu.Lock()
+		delete(vs.names, k.ID)
+		vs.mu.Unlock()
+		return nil
+	})
+	vs.mailbox.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	ft.client.On("StoredRecording").Return(vs.recordings)
+	ft.client.On("Mailbox").Return(vs.mailbox)
+	return vs
+}
+
+func (vs *voicemailStore) add(name string) {
+	vs.mu.Lock()
+	vs.names[name] = true
+	vs.mu.Unlock()
+}
+
+func (vs *voicemailStore) has(name string) bool {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return vs.names[name]
+}
+
+func TestVoicemailDeposit(t *testing.T) {
+	ft := newFlowTest(t, WithClock(clock.NewFake(time.Unix(1600000000, 0))))
+	defer ft.Close()
+	ft.s.Voicemail = &VoicemailConfig{}
+	vs := newVoicemailStore(ft, "voicemail/1000/Old/1500000000-rc1")
+	ft.mockPlay(nil)
+
+	// The recording is finished by Asterisk, once the caller hangs up
+	ft.channel.On("Record", mock.Anything, mock.Anything, mock.Anything).Return(func(_ *ari.Key, name string, _ *ari.RecordingOptions) *ari.LiveRecordingHandle {
+		vs.add(name)
+		go ft.send(&ari.RecordingFinished{
+			EventData: ari.EventData{Type: ari.Events.RecordingFinished},
+			Recording: ari.LiveRecordingData{Name: name, Duration: ari.DurationSec(7 * time.Second)},
+		})
+		return nil
+	}, nil)
+
+	key := ari.NewKey(ari.ChannelKey, "c1")
+	resp := ft.request(t, &proxy.Request{
+		Kind:      "VoicemailDeposit",
+		Key:       key,
+		Voicemail: &proxy.Voicemail{Mailbox: "1000"},
+	})
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	name := resp.Key.ID
+	if resp.Key.Kind != ari.StoredRecordingKey || !strings.HasPrefix(name, "voicemail/1000/INBOX/1600000000-") {
+		t.Fatalf("unexpected message key %v", resp.Key)
+	}
+
+	e := ft.event(t, proxy.EventVoicemailFinished).(*proxy.VoicemailFinished)
+	if e.Error != "" || e.Operation != "deposit" || e.Message != name || e.Duration != 7 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// The greeting is played before the message is recorded, and the new
+	// message is indicated
+	if m := ft.nextPlayed(t); m != "sound:vm-intro" {
+		t.Errorf("played %s instead of the greeting", m)
+	}
+	ft.channel.AssertCalled(t, "Record", key, name, mock.Anything)
+	vs.mailbox.AssertCalled(t, "Update", ari.NewKey(ari.MailboxKey, "1000"), 1, 1)
+}
+
+func TestVoicemailRetrieve(t *testing.T) {
+	ft := newFlowTest(t)
+	defer ft.Close()
+	ft.s.Voicemail = &VoicemailConfig{}
+	vs := newVoicemailStore(ft,
+		"voicemail/1000/INBOX/1600000000-rc1",
+		"voicemail/1000/INBOX/1600000001-rc2",
+		"voicemail/1000/Old/1500000000-rc0",
+	)
+
+	// Messages play until the caller makes a menu selection
+	ft.mockPlay(func(mediaURI string) bool {
+		return strings.HasPrefix(mediaURI, "recording:")
+	})
+
+	resp := ft.request(t, &proxy.Request{
+		Kind:      "VoicemailRetrieve",
+		Key:       ari.NewKey(ari.ChannelKey, "c1"),
+		Voicemail: &proxy.Voicemail{Mailbox: "1000"},
+	})
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPlayed := func(media string) {
+		t.Helper()
+		if m := ft.nextPlayed(t); m != media {
+			t.Fatalf("played %s instead of %s", m, media)
+		}
+	}
+	for _, m := range []string{"sound:vm-youhave", "number:2", "sound:vm-INBOX", "sound:vm-messages"} {
+		expectPlayed(m)
+	}
+
+	// The first new message is replayed, then deleted
+	expectPlayed("recording:voicemail/1000/INBOX/1600000000-rc1")
+	ft.dtmf("c1", "1")
+	expectPlayed("recording:voicemail/1000/INBOX/1600000000-rc1")
+	ft.dtmf("c1", "7")
+
+	// The second is saved, and the old message left as it is
+	expectPlayed("recording:voicemail/1000/INBOX/1600000001-rc2")
+	ft.dtmf("c1", "9")
+	expectPlayed("recording:voicemail/1000/Old/1500000000-rc0")
+	ft.dtmf("c1", "9")
+
+	expectPlayed("sound:vm-nomore")
+	expectPlayed("sound:vm-goodbye")
+
+	e := ft.event(t, proxy.EventVoicemailFinished).(*proxy.VoicemailFinished)
+	if e.Error != "" || e.Operation != "retrieve" || e.Played != 3 || e.Deleted != 1 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if vs.has("voicemail/1000/INBOX/1600000000-rc1") || vs.has("voicemail/1000/Old/1600000000-rc1") {
+		t.Error("deleted message not removed")
+	}
+	if vs.has("voicemail/1000/INBOX/1600000001-rc2") || !vs.has("voicemail/1000/Old/1600000001-rc2") {
+		t.Error("saved message not moved to the Old folder")
+	}
+	ft.playback.AssertNumberOfCalls(t, "Stop", 4)
+
+	// No new messages remain
+	vs.mailbox.AssertCalled(t, "Update", ari.NewKey(ari.MailboxKey, "1000"), 2, 0)
+}
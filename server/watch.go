@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/CyCoreSystems/ari-proxy/v5/proxy"
+	"github.com/CyCoreSystems/ari-proxy/v5/server/clock"
+	"github.com/CyCoreSystems/ari/v5"
+	"github.com/CyCoreSystems/ari/v5/rid"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultWatchTTL is the default duration after which an unrenewed watch
+// expires
+var DefaultWatchTTL = 5 * time.Minute
+
+// watch is the state of a watch of a channel or bridge
+type watch struct {
+	id  string
+	key *ari.Key
+
+	// fields is the last known data of the entity, indexed by JSON field name
+	fields map[string]json.RawMessage
+
+	ttl   time.Duration
+	timer clock.Timer
+
+	// mu serializes the refreshes of the entity data
+	mu sync.Mutex
+}
+
+// update replaces the known data of the entity, returning the changed fields
+func (w *watch) update(fields map[string]json.RawMessage) map[string]json.RawMessage {
+	changes := diffFields(w.fields, fields)
+	w.fields = fields
+	return changes
+}
+
+// diffFields returns the new value of each field which differs between the
+// old and new data.  Fields which are no longer set have a null value.
+func diffFields(old, cur map[string]json.RawMessage) map[string]json.RawMessage {
+	changes := make(map[string]json.RawMessage)
+	for name, v := range cur {
+		if prev, ok := old[name]; !ok || !bytes.Equal(prev, v) {
+			changes[name] = v
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			changes[name] = json.RawMessage("null")
+		}
+	}
+	return changes
+}
+
+// entityFields returns the JSON fields of the given entity data
+func entityFields(data interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, eris.Wrap(err, "failed to encode entity data")
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return nil, eris.Wrap(err, "failed to decode entity data")
+	}
+	return fields, nil
+}
+
+// watchSet is the set of watches in progress
+type watchSet struct {
+	m  map[string]*watch
+	mu sync.Mutex
+}
+
+func (ws *watchSet) add(w *watch) {
+	ws.mu.Lock()
+	if ws.m == nil {
+		ws.m = make(map[string]*watch)
+	}
+	ws.m[w.id] = w
+	ws.mu.Unlock()
+}
+
+func (ws *watchSet) get(id string) (*watch, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w, ok := ws.m[id]
+	return w, ok
+}
+
+func (ws *watchSet) remove(id string) (*watch, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w, ok := ws.m[id]
+	if ok {
+		delete(ws.m, id)
+		w.timer.Stop()
+	}
+	return w, ok
+}
+
+// matching returns the watches of the entities to which the given keys refer
+func (ws *watchSet) matching(keys ari.Keys) (ret []*watch) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, w := range ws.m {
+		for _, k := range keys {
+			if k != nil && k.Kind == w.key.Kind && k.ID == w.key.ID {
+				ret = append(ret, w)
+				break
+			}
+		}
+	}
+	return
+}
+
+// watchData returns the entity data of the given channel or bridge
+func (s *Server) watchData(key *ari.Key) (*proxy.EntityData, interface{}, error) {
+	switch key.Kind {
+	case ari.ChannelKey:
+		d, err := s.ari.Channel().Data(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &proxy.EntityData{Channel: d}, d, nil
+	case ari.BridgeKey:
+		d, err := s.ari.Bridge().Data(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &proxy.EntityData{Bridge: d}, d, nil
+	default:
+		return nil, nil, eris.Errorf("entities of kind %q may not be watched", key.Kind)
+	}
+}
+
+func (s *Server) watchCreate(ctx context.Context, reply string, req *proxy.Request) {
+	ttl := DefaultWatchTTL
+	if req.Watch != nil && req.Watch.TTL > 0 {
+		ttl = req.Watch.TTL
+	}
+
+	data, d, err := s.watchData(req.Key)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+	fields, err := entityFields(d)
+	if err != nil {
+		s.sendError(reply, err)
+		return
+	}
+
+	w := &watch{
+		id:     rid.New("wa"),
+		key:    ari.NewKey(req.Key.Kind, req.Key.ID, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+		fields: fields,
+		ttl:    ttl,
+	}
+	w.timer = s.clock().AfterFunc(ttl, func() {
+		s.expireWatch(w.id)
+	})
+
+	if req.Key.Dialog != "" {
+		s.Dialog.Bind(req.Key.Dialog, proxy.WatchKey, w.id)
+	}
+
+	s.watches.add(w)
+
+	s.publish(reply, &proxy.Response{
+		Key:  ari.NewKey(proxy.WatchKey, w.id, ari.WithApp(s.Application), ari.WithNode(s.nodeID())),
+		Data: data,
+	})
+}
+
+func (s *Server) watchRenew(ctx context.Context, reply string, req *proxy.Request) {
+	w, ok := s.watches.get(req.Key.ID)
+	if !ok {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+
+	w.mu.Lock()
+	if req.Watch != nil && req.Watch.TTL > 0 {
+		w.ttl = req.Watch.TTL
+	}
+	w.timer.Reset(w.ttl)
+	w.mu.Unlock()
+
+	s.sendError(reply, nil)
+}
+
+func (s *Server) watchCancel(ctx context.Context, reply string, req *proxy.Request) {
+	if _, ok := s.watches.remove(req.Key.ID); !ok {
+		s.sendError(reply, proxy.ErrNotFound)
+		return
+	}
+	s.sendError(reply, nil)
+}
+
+// expireWatch ends a watch which has not been renewed
+func (s *Server) expireWatch(id string) {
+	w, ok := s.watches.remove(id)
+	if !ok {
+		return
+	}
+
+	s.publishEvent(&proxy.WatchExpired{
+		EventData: s.newEventData(proxy.EventWatchExpired),
+		WatchID:   w.id,
+		Kind:      w.key.Kind,
+		EntityID:  w.key.ID,
+	})
+}
+
+// processWatchEvent notifies the watchers of the entities of an event of the
+// changes to their data
+func (s *Server) processWatchEvent(e ari.Event) {
+	watches := s.watches.matching(e.Keys())
+	if len(watches) == 0 {
+		return
+	}
+
+	for _, w := range watches {
+		if entityRemoved(e, w.key) {
+			s.watches.remove(w.id)
+			s.publishEvent(&proxy.EntityChanged{
+				EventData: s.newEventData(proxy.EventEntityChanged),
+				WatchID:   w.id,
+				Kind:      w.key.Kind,
+				EntityID:  w.key.ID,
+				Removed:   true,
+			})
+			continue
+		}
+
+		go s.refreshWatch(w)
+	}
+}
+
+// entityRemoved indicates whether the event reports the destruction of the entity
+func entityRemoved(e ari.Event, key *ari.Key) bool {
+	switch v := e.(type) {
+	case *ari.ChannelDestroyed:
+		return key.Kind == ari.ChannelKey && v.Channel.ID == key.ID
+	case *ari.BridgeDestroyed:
+		return key.Kind == ari.BridgeKey && v.Bridge.ID == key.ID
+	}
+	return false
+}
+
+// refreshWatch retrieves the data of a watched entity and publishes its
+// changes, if any
+func (s *Server) refreshWatch(w *watch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, d, err := s.watchData(w.key)
+	if err != nil {
+		// The entity may be gone; its destruction event ends the watch
+		s.Log.Debug("failed to refresh watched entity", "watch", w.id, "error", err)
+		return
+	}
+	fields, err := entityFields(d)
+	if err != nil {
+		s.Log.Debug("failed to refresh watched entity", "watch", w.id, "error", err)
+		return
+	}
+
+	changes := w.update(fields)
+	if len(changes) == 0 {
+		return
+	}
+
+	s.publishEvent(&proxy.EntityChanged{
+		EventData: s.newEventData(proxy.EventEntityChanged),
+		WatchID:   w.id,
+		Kind:      w.key.Kind,
+		EntityID:  w.key.ID,
+		Changes:   changes,
+	})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CyCoreSystems/ari/v5"
+)
+
+func TestWatchUpdate(t *testing.T) {
+	initial, err := entityFields(&ari.ChannelData{ID: "c1", State: "Ring", Accountcode: "acct"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watch{id: "w1", key: ari.NewKey(ari.ChannelKey, "c1"), fields: initial}
+
+	cur, err := entityFields(&ari.ChannelData{ID: "c1", State: "Up", Name: "PJSIP/100-0001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := w.update(cur)
+
+	if len(changes) != 3 {
+		t.Errorf("expected 3 changes, got %v", changes)
+	}
+	if string(changes["state"]) != `"Up"` {
+		t.Errorf("unexpected state change: %s", changes["state"])
+	}
+	if string(changes["name"]) != `"PJSIP/100-0001"` {
+		t.Errorf("unexpected name change: %s", changes["name"])
+	}
+	if string(changes["accountcode"]) != `""` {
+		t.Errorf("unexpected accountcode change: %s", changes["accountcode"])
+	}
+
+	if changes = w.update(cur); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	old := map[string]json.RawMessage{"a": json.RawMessage(`1`), "b": json.RawMessage(`2`)}
+	cur := map[string]json.RawMessage{"a": json.RawMessage(`1`)}
+
+	changes := diffFields(old, cur)
+	if len(changes) != 1 || string(changes["b"]) != "null" {
+		t.Errorf("removed field should be null: %v", changes)
+	}
+}
+
+func TestWatchMatching(t *testing.T) {
+	var ws watchSet
+	ws.add(&watch{id: "w1", key: ari.NewKey(ari.ChannelKey, "c1"), timer: time.AfterFunc(time.Hour, func() {})})
+	ws.add(&watch{id: "w2", key: ari.NewKey(ari.BridgeKey, "b1"), timer: time.AfterFunc(time.Hour, func() {})})
+
+	e := &ari.ChannelEnteredBridge{
+		Bridge:  ari.BridgeData{ID: "b1"},
+		Channel: ari.ChannelData{ID: "c2"},
+	}
+	if ret := ws.matching(e.Keys()); len(ret) != 1 || ret[0].id != "w2" {
+		t.Errorf("unexpected matches: %v", ret)
+	}
+
+	if !entityRemoved(&ari.ChannelDestroyed{Channel: ari.ChannelData{ID: "c1"}}, ari.NewKey(ari.ChannelKey, "c1")) {
+		t.Error("channel destruction should remove the watched channel")
+	}
+
+	if _, ok := ws.remove("w1"); !ok {
+		t.Error("failed to remove watch")
+	}
+	if _, ok := ws.get("w1"); ok {
+		t.Error("removed watch still present")
+	}
+}